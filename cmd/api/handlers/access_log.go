@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"net/http"
+	"time"
+)
+
+// AccessLog middleware log every request once it is handled: its method, route, status, latency (in seconds) and
+// client ip, with the request id and user logged in added by the logger of the request (see ContextLogger). The route
+// is logged instead of the path (as /v1/track/:token), so the tokens sent on the paths are not written on the logs;
+// the path is only logged for the requests which do not match a route. Server errors are logged as errors
+func AccessLog() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		start := time.Now()
+
+		ctx.Next()
+
+		path := ctx.FullPath()
+		if path == "" {
+			path = ctx.Request.URL.Path
+		}
+
+		status := ctx.Writer.Status()
+		fields := []log.Field{
+			log.String("method", ctx.Request.Method),
+			log.String("path", path),
+			log.Int("status", status),
+			log.Duration("latency", time.Since(start)),
+			log.String("client_ip", ctx.ClientIP()),
+			log.Int("response_size", ctx.Writer.Size()),
+		}
+
+		if status >= http.StatusInternalServerError {
+			log.Error(ctx, "access", fields...)
+			return
+		}
+
+		log.Info(ctx, "access", fields...)
+	}
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/user"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap/zapcore"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// logEntry is a line written on the recordLogger
+type logEntry struct {
+	level  string
+	msg    string
+	fields map[string]interface{}
+}
+
+// recordLogger a logger to use on AccessLog test, it keeps the lines written
+type recordLogger struct {
+	entries []logEntry
+}
+
+func (l *recordLogger) Error(msg string, fields ...log.Field) {
+	l.record("error", msg, fields)
+}
+
+func (l *recordLogger) Info(msg string, fields ...log.Field) {
+	l.record("info", msg, fields)
+}
+
+func (l *recordLogger) record(level, msg string, fields []log.Field) {
+	encoder := zapcore.NewMapObjectEncoder()
+	for _, field := range fields {
+		field.AddTo(encoder)
+	}
+
+	l.entries = append(l.entries, logEntry{level: level, msg: msg, fields: encoder.Fields})
+}
+
+func Test_accessLog(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	logger := &recordLogger{}
+	previous := log.DefaultLogger
+	log.DefaultLogger = logger
+	defer func() { log.DefaultLogger = previous }()
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.Use(RequestID(), ContextLogger(), AccessLog())
+	router.GET("/v1/track/:token", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{})
+	})
+	router.GET("/v1/me", AuthenticateRequest(), func(c *gin.Context) {
+		c.JSON(http.StatusInternalServerError, apiError{Code: "storage_failure"})
+	})
+
+	token, err := jwt.GenerateToken(7, "an_email@", user.RoleDriver, user.RolePermissions(user.RoleDriver))
+	assert.Nil(t, err)
+
+	testscases := map[string]struct {
+		path          string
+		token         string
+		wantLevel     string
+		wantPath      string
+		wantStatus    int
+		wantUserID    interface{}
+		wantRequestID string
+	}{
+		"successful logged request with the route instead of the token on the path": {
+			path:          "/v1/track/a-secret-token",
+			wantLevel:     "info",
+			wantPath:      "/v1/track/:token",
+			wantStatus:    http.StatusOK,
+			wantRequestID: "a-request",
+		},
+		"successful logged server error with the user logged in": {
+			path:          "/v1/me",
+			token:         token,
+			wantLevel:     "error",
+			wantPath:      "/v1/me",
+			wantStatus:    http.StatusInternalServerError,
+			wantUserID:    int64(7),
+			wantRequestID: "another-request",
+		},
+		"successful logged request not matching a route": {
+			path:          "/v1/unknown",
+			wantLevel:     "info",
+			wantPath:      "/v1/unknown",
+			wantStatus:    http.StatusNotFound,
+			wantRequestID: "a-request-not-found",
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			logger.entries = nil
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set(RequestIDHeader, tc.wantRequestID)
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			router.ServeHTTP(w, req)
+
+			var access *logEntry
+			for i, entry := range logger.entries {
+				if entry.msg == "access" {
+					access = &logger.entries[i]
+				}
+			}
+			if !assert.NotNil(t, access) {
+				return
+			}
+
+			assert.Equal(t, tc.wantLevel, access.level)
+			assert.Equal(t, http.MethodGet, access.fields["method"])
+			assert.Equal(t, tc.wantPath, access.fields["path"])
+			assert.Equal(t, int64(tc.wantStatus), access.fields["status"])
+			assert.Equal(t, tc.wantRequestID, access.fields["request_id"])
+			assert.Equal(t, tc.wantUserID, access.fields["request_user_id"])
+			assert.Contains(t, access.fields, "latency")
+		})
+	}
+}
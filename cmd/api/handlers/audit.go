@@ -0,0 +1,139 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type SecurityEvents interface {
+	Record(ctx context.Context, event audit.Event)
+	Search(ctx context.Context, opt ...audit.SearchOption) ([]audit.Event, audit.Metadata, error)
+}
+
+type AuditHandler struct {
+	Events SecurityEvents
+}
+
+// List get the security events filtered by type, user and date (RFC 3339) with pagination, the most recent first
+// ?type={type}&user_id={userID}&from={from}&to={to}&limit={pageSize}&offset={offset}
+func (h AuditHandler) List(c *gin.Context) {
+	var searchOptions []audit.SearchOption
+	if eventType := c.Query("type"); eventType != "" {
+		searchOptions = append(searchOptions, audit.WithType(eventType))
+	}
+
+	if userID := c.Query("user_id"); userID != "" {
+		id, err := strconv.ParseInt(userID, 10, 64)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid search user id received",
+			})
+			return
+		}
+		searchOptions = append(searchOptions, audit.WithUserID(id))
+	}
+
+	if from := c.Query("from"); from != "" {
+		date, err := time.Parse(time.RFC3339, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid search from date received",
+			})
+			return
+		}
+		searchOptions = append(searchOptions, audit.WithFrom(date))
+	}
+
+	if to := c.Query("to"); to != "" {
+		date, err := time.Parse(time.RFC3339, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid search to date received",
+			})
+			return
+		}
+		searchOptions = append(searchOptions, audit.WithTo(date))
+	}
+
+	// parse limit if it was received
+	if limit := c.Query("limit"); limit != "" {
+		limitNmbr, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || limitNmbr <= 0 {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid search limit received",
+			})
+			return
+		}
+		searchOptions = append(searchOptions, audit.WithLimit(limitNmbr))
+	}
+
+	// parse offset if it was received
+	if offset := c.Query("offset"); offset != "" {
+		offsetNmbr, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil || offsetNmbr < 0 {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid search offset received",
+			})
+			return
+		}
+		searchOptions = append(searchOptions, audit.WithOffset(offsetNmbr))
+	}
+
+	events, meta, err := h.Events.Search(c, searchOptions...)
+	if err != nil {
+		code, resp := mapAuditError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"total":   meta.Total,
+		"pending": meta.Pending,
+		"result":  events,
+	})
+}
+
+// RequestClient store the ip and user agent of the request on context, so the security events recorded while it is
+// handled have them
+func RequestClient() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(audit.ClientKey, audit.Client{
+			IP:        ctx.ClientIP(),
+			UserAgent: ctx.Request.UserAgent(),
+		})
+	}
+}
+
+func mapAuditError(err error) (int, error) {
+	errToStatus := map[code_error.Error]int{
+		audit.ErrInvalidEventType: http.StatusBadRequest,
+		audit.ErrInvalidDateRange: http.StatusBadRequest,
+		audit.ErrStorageGet:       http.StatusInternalServerError,
+	}
+
+	var auditErr code_error.Error
+	if errors.As(err, &auditErr) {
+		if code, ok := errToStatus[auditErr]; ok {
+			return code, apiError{
+				Code:    auditErr.GetCode(),
+				Message: auditErr.GetDetail(),
+			}
+		}
+	}
+
+	return http.StatusInternalServerError, apiError{
+		Code:    "error",
+		Message: err.Error(),
+	}
+}
@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/user"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+// eventMockDb a 'db' to use on AuditHandler test, it ignores the search filters
+type eventMockDb struct {
+	events []audit.Event
+}
+
+func (db *eventMockDb) SaveEvent(ctx context.Context, event audit.Event) (audit.Event, error) {
+	event.ID = int64(len(db.events) + 1)
+	db.events = append(db.events, event)
+
+	return event, nil
+}
+
+func (db *eventMockDb) GetEvents(ctx context.Context, search audit.Search) ([]audit.Event, int64, error) {
+	var events []audit.Event
+	for i := len(db.events) - 1; i >= 0; i-- {
+		events = append(events, db.events[i])
+	}
+
+	return events, int64(len(events)), nil
+}
+
+func Test_auditAccessDenied(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	events := audit.NewEventStorage(&eventMockDb{})
+	rules := Rules{http.MethodGet: {"/v1/audit/events": {user.PermissionAuditRead}}}
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.Use(RequestClient())
+	router.GET("/v1/audit/events", AuthenticateRequest(), AuthorizeRequest(rules, events),
+		AuditHandler{Events: events}.List)
+
+	list := func(role string, query string) *httptest.ResponseRecorder {
+		token, err := jwt.GenerateToken(1, "an_email@", role, user.RolePermissions(role))
+		assert.Nil(t, err)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/v1/audit/events"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		req.Header.Set("User-Agent", "curl/7.68.0")
+		req.RemoteAddr = "10.0.0.1:53000"
+
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w = list(user.RoleDispatcher, "")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	w = list(user.RoleAdmin, "?type=access_denied&limit=10")
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp struct {
+		Total  int64         `json:"total"`
+		Result []audit.Event `json:"result"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &resp)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), resp.Total)
+	assert.Equal(t, audit.EventAccessDenied, resp.Result[0].Type)
+	assert.Equal(t, "GET /v1/audit/events", resp.Result[0].Detail)
+	assert.Equal(t, "an_email@", resp.Result[0].Email)
+	assert.Equal(t, "10.0.0.1", resp.Result[0].IP)
+	assert.Equal(t, "curl/7.68.0", resp.Result[0].UserAgent)
+
+	for query, want := range map[string]string{
+		"?type=logout":    "invalid_search - the event type should be login, login_failed, token_refresh, token_refresh_failed, token_revoked, access_denied, token_replay or impersonation",
+		"?user_id=a":      "invalid_request - invalid search user id received",
+		"?from=yesterday": "invalid_request - invalid search from date received",
+		"?limit=0":        "invalid_request - invalid search limit received",
+	} {
+		w = list(user.RoleAdmin, query)
+		assert.Equal(t, http.StatusBadRequest, w.Code)
+
+		var apiErr apiError
+		err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+		assert.Nil(t, err)
+		assert.Equal(t, want, apiErr.Error())
+	}
+}
@@ -5,6 +5,8 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
 	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
 	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
 	"github.com/nicocarolo/space-drivers/internal/platform/log"
@@ -13,19 +15,32 @@ import (
 )
 
 type Authenticate interface {
-	Login(ctx context.Context, user user.User) (string, error)
+	Login(ctx context.Context, user user.User) (user.Session, error)
+	LoginWithScope(ctx context.Context, user user.User, scope string) (user.Session, error)
+	LoginTwoFactor(ctx context.Context, challenge, code string) (user.Session, error)
+	Refresh(ctx context.Context, refreshToken string) (user.Session, error)
 }
 
+// TokenRenewer renew the tokens which are about to expire, it return an empty token when the token is not renewed
+type TokenRenewer interface {
+	RenewToken(ctx context.Context, claims jwt.Claims) (string, error)
+}
+
+// RenewedTokenHeader is the response header with the new token of the requests whose token is about to expire
+const RenewedTokenHeader = "X-Renewed-Token"
+
 type AuthHandler struct {
 	Users UsersStorage
 }
 
 // Login handler will receive an email and password and login a user returning a token to authenticate on future
-// requests
+// requests, or the challenge to complete the login with LoginTwoFactor if the user has two factor authentication.
+// The optional scope restricts the tokens of the session (e.g. driver_app for the mobile driver app)
 func (h AuthHandler) Login(c *gin.Context) {
 	type loginRequest struct {
 		Email    string `json:"email" binding:"required"`
 		Password string `json:"password" binding:"required"`
+		Scope    string `json:"scope"`
 	}
 	var loginReq loginRequest
 	if err := c.ShouldBindJSON(&loginReq); err != nil {
@@ -40,111 +55,229 @@ func (h AuthHandler) Login(c *gin.Context) {
 		},
 		Password: loginReq.Password,
 	}
-	token, err := h.Users.Login(c, userToLogin)
+	session, err := h.Users.LoginWithScope(c, userToLogin, loginReq.Scope)
 	if err != nil {
 		code, resp := mapAuthError(err)
 		c.JSON(code, resp)
 		return
 	}
 
-	c.JSON(http.StatusOK, map[string]interface{}{
-		"token": token,
-	})
+	c.JSON(http.StatusOK, session)
+}
+
+// LoginTwoFactor handler will receive the challenge returned on login and the two factor code, and complete the login
+// returning a token to authenticate on future requests
+func (h AuthHandler) LoginTwoFactor(c *gin.Context) {
+	var loginReq struct {
+		Challenge string `json:"challenge" binding:"required"`
+		Code      string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&loginReq); err != nil {
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	session, err := h.Users.LoginTwoFactor(c, loginReq.Challenge, loginReq.Code)
+	if err != nil {
+		code, resp := mapAuthError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// Refresh handler will receive the refresh token returned on login and return a new session, with a new token and
+// refresh token. The received refresh token cannot be used again
+func (h AuthHandler) Refresh(c *gin.Context) {
+	var refreshReq struct {
+		RefreshToken string `json:"refresh_token" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&refreshReq); err != nil {
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	session, err := h.Users.Refresh(c, refreshReq.RefreshToken)
+	if err != nil {
+		code, resp := mapAuthError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, session)
+}
+
+// JWKS handler return the public keys (JWKS) of the keys which sign tokens with RS256 or EdDSA, so other services
+// can validate the tokens without the secret
+func (h AuthHandler) JWKS(c *gin.Context) {
+	keys, err := jwt.PublicKeys()
+	if err != nil {
+		log.Error(c, "there was an error getting public keys on jwks", log.Err(err))
+		c.JSON(http.StatusInternalServerError, apiError{
+			Code:    "error",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, keys)
 }
 
 func mapAuthError(err error) (int, error) {
 	errToStatus := map[code_error.Error]int{
 		user.ErrNotFoundUser:           http.StatusNotFound,
 		user.ErrInvalidPasswordToLogin: http.StatusBadRequest,
+		user.ErrSuspendedUser:          http.StatusForbidden,
+		user.ErrInvalidChallenge:       http.StatusUnauthorized,
+		user.ErrInvalidTwoFactorCode:   http.StatusUnauthorized,
+		user.ErrInvalidRefreshToken:    http.StatusUnauthorized,
+		user.ErrTooManyLoginAttempts:   http.StatusTooManyRequests,
+		user.ErrInvalidScope:           http.StatusBadRequest,
+		user.ErrGenerateSession:        http.StatusInternalServerError,
 		user.ErrStorageGet:             http.StatusInternalServerError,
+		user.ErrStorageSave:            http.StatusInternalServerError,
 	}
 
 	var userErr code_error.Error
 	if errors.As(err, &userErr) {
 		if code, ok := errToStatus[userErr]; ok {
 			return code, apiError{
-				Code:        userErr.GetCode(),
-				Description: userErr.GetDetail(),
+				Code:    userErr.GetCode(),
+				Message: userErr.GetDetail(),
 			}
 		}
 	}
 
 	return http.StatusInternalServerError, apiError{
-		Code:        "error",
-		Description: err.Error(),
+		Code:    "error",
+		Message: err.Error(),
 	}
 }
 
 // AuthenticateRequest authenticate the received request with the jwt token on Bearer header.
-// The token is validated and if it is ok, the user on it is stored on context.
+// The token is validated and if it is ok, the user on it is stored on context. The requests with impersonation
+// tokens are logged on the audit log with their impersonator.
 func AuthenticateRequest() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		const BearerSchema string = "Bearer "
 		authHeader := ctx.GetHeader("Authorization")
 		if authHeader == "" {
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, apiError{
-				Code:        "authorization_token_missing",
-				Description: "it was not received the authorization header with token",
+				Code:    "authorization_token_missing",
+				Message: "it was not received the authorization header with token",
 			})
 			return
 		}
 		tokenString := authHeader[len(BearerSchema):]
 
-		token, err := jwt.ValidateToken(tokenString)
+		token, err := jwt.ValidateToken(ctx, tokenString)
 		if err != nil {
-			log.Error(ctx, "there was an error validating token on authenticate request", log.Err(err))
+			log.ErrorLimited(ctx, "there was an error validating token on authenticate request", log.Err(err))
 			if errors.Is(err, jwt.ErrTokenExpired) {
 				ctx.AbortWithStatusJSON(http.StatusUnauthorized, apiError{
-					Code:        "expired_token",
-					Description: err.Error(),
+					Code:    "expired_token",
+					Message: err.Error(),
 				})
 				return
 			}
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, apiError{
-				Code:        "invalid_token",
-				Description: err.Error(),
+				Code:    "invalid_token",
+				Message: err.Error(),
 			})
 			return
 		}
 
 		claims, err := jwt.GetClaims(token)
 		if err != nil {
-			log.Error(ctx, "there was an error getting claims from token on authenticate request", log.Err(err))
+			log.ErrorLimited(ctx, "there was an error getting claims from token on authenticate request", log.Err(err))
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, apiError{
-				Code:        "invalid_token_data",
-				Description: err.Error(),
+				Code:    "invalid_token_data",
+				Message: err.Error(),
 			})
 			return
 		}
 
+		if claims.ImpersonatorID != 0 {
+			auditlog.Log(ctx, "impersonated request",
+				log.Int64("user_id", claims.UserID),
+				log.Int64("impersonator_id", claims.ImpersonatorID),
+				log.String("method", ctx.Request.Method),
+				log.String("path", ctx.Request.URL.Path))
+		}
+
 		ctx.Set("user_on_call", claims)
+		enrichLogger(ctx, userFields(claims)...)
+	}
+}
+
+// RenewToken renew the token of the user who is authenticated if it is about to expire, and answer the new token on
+// the RenewedTokenHeader, so the users do not get an expired token while they use the application. It should be
+// used after AuthorizeRequest, so only the tokens which can access the resource are renewed. A token which cannot be
+// renewed is still valid until it expires
+func RenewToken(renewer TokenRenewer) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		claims, ok := loggedUser(ctx)
+		if !ok {
+			return
+		}
+
+		renewed, err := renewer.RenewToken(ctx, claims)
+		if err != nil {
+			log.Info(ctx, "the token cannot be renewed on renew token", log.Int64("user_id", claims.UserID),
+				log.Err(err))
+			return
+		}
+		if renewed != "" {
+			ctx.Header(RenewedTokenHeader, renewed)
+		}
 	}
 }
 
 // AuthorizeRequest get the user who is authenticated from context, and check if it can
-// access to the resource (endpoint and action)
-func AuthorizeRequest(rules Ruler) gin.HandlerFunc {
+// access to the resource (endpoint and action): the scope of its token should include the resource, and its
+// permissions should be accepted by the rules. The denied accesses are recorded on events, if it is not nil
+func AuthorizeRequest(rules Ruler, events SecurityEvents) gin.HandlerFunc {
 	return func(ctx *gin.Context) {
 		claimsCtx, exist := ctx.Get("user_on_call")
 		if !exist {
 			log.Error(ctx, "there was an error getting logged in user from context on authorize request")
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, apiError{
-				Code:        "authorize_failure",
-				Description: "cannot authorize user",
+				Code:    "authorize_failure",
+				Message: "cannot authorize user",
 			})
 			return
 		}
 
 		claims := claimsCtx.(jwt.Claims)
 
-		if !rules.CanAccess(ctx.Request.Method, ctx.FullPath(), claims.Role) {
+		inTokenScope := inScope(claims.Scope, ctx.Request.Method, ctx.FullPath())
+		if !inTokenScope || !rules.CanAccess(ctx.Request.Method, ctx.FullPath(), user.ClaimsPermissions(claims)) {
 			log.Info(ctx, "the user who was logged in cannot access resource",
 				log.Int64("user_id", claims.UserID),
 				log.String("resource", ctx.FullPath()),
-				log.String("role", claims.Role))
+				log.String("role", claims.Role),
+				log.String("scope", claims.Scope))
+			if events != nil {
+				detail := fmt.Sprintf("%s %s", ctx.Request.Method, ctx.Request.URL.Path)
+				if !inTokenScope {
+					detail += " out of scope " + claims.Scope
+				}
+				if claims.ImpersonatorID != 0 {
+					detail += fmt.Sprintf(" impersonated by user %d", claims.ImpersonatorID)
+				}
+				events.Record(ctx, audit.Event{
+					Type:   audit.EventAccessDenied,
+					UserID: claims.UserID,
+					Email:  claims.Email,
+					Detail: detail,
+				})
+			}
 			ctx.AbortWithStatusJSON(http.StatusUnauthorized, apiError{
 				Code: "authorize_failure",
-				Description: fmt.Sprintf("cannot authorize user with role: %s on %s to %s",
+				Message: fmt.Sprintf("cannot authorize user with role: %s on %s to %s",
 					claims.Role, ctx.Request.Method, ctx.Request.URL.Path),
 			})
 			return
@@ -152,46 +285,41 @@ func AuthorizeRequest(rules Ruler) gin.HandlerFunc {
 	}
 }
 
-// rule model to perform role based access control
+// loggedUser return the claims of the user authenticated on the request (stored by AuthenticateRequest)
+func loggedUser(ctx *gin.Context) (jwt.Claims, bool) {
+	claimsCtx, exist := ctx.Get("user_on_call")
+	if !exist {
+		return jwt.Claims{}, false
+	}
+
+	claims, ok := claimsCtx.(jwt.Claims)
+	return claims, ok
+}
+
+// rule model to perform permission based access control
 type rule struct {
-	url    string
-	method string
-	role   string
+	url        string
+	method     string
+	permission string
 }
 
-func newRule(url, method, role string) rule {
+func newRule(url, method, permission string) rule {
 	return rule{
-		url:    url,
-		method: method,
-		role:   role,
+		url:        url,
+		method:     method,
+		permission: permission,
 	}
 }
 
 type Ruler interface {
-	// CanAccess will return 'true' when a role is trying to access to a path (resource) with a http method,
-	// and it is authorized
-	CanAccess(method, path, role string) bool
+	// CanAccess will return 'true' when a user with the permissions is trying to access to a path (resource) with a
+	// http method, and it is authorized
+	CanAccess(method, path string, permissions user.Permissions) bool
 }
 
-// Rules will store the rule configuration
+// Rules will store the rule configuration: the permissions accepted by method and path
 type Rules map[string]map[string][]string
 
-func NewRoleControl() Rules {
-	r := Rules{}
-
-	r.AddRule(newRule("/v1/users/", "POST", "admin"))
-	r.AddRule(newRule("/v1/users/:id", "GET", "admin"))
-	r.AddRule(newRule("/v1/users/drivers", "GET", "admin"))
-
-	r.AddRule(newRule("/v1/travels/", "POST", "admin"))
-	r.AddRule(newRule("/v1/travels/:id", "GET", "admin"))
-	r.AddRule(newRule("/v1/travels/:id", "GET", "driver"))
-	r.AddRule(newRule("/v1/travels/:id", "PUT", "driver"))
-	r.AddRule(newRule("/v1/travels/:id", "PUT", "admin"))
-
-	return r
-}
-
 // AddRule create a rule on role control
 func (r Rules) AddRule(rule rule) {
 	if _, ok := r[rule.method]; !ok {
@@ -201,23 +329,20 @@ func (r Rules) AddRule(rule rule) {
 		r[rule.method][rule.url] = []string{}
 	}
 
-	r[rule.method][rule.url] = append(r[rule.method][rule.url], rule.role)
+	r[rule.method][rule.url] = append(r[rule.method][rule.url], rule.permission)
 }
 
-// CanAccess will return 'true' when a role is trying to access to a path (resource) with a http method,
-//	// and it is authorized
-func (r Rules) CanAccess(method, path, role string) bool {
-	if _, exist := r[method]; !exist {
-		return false
-	}
-
-	if _, exist := r[method][path]; !exist {
-		return false
+// CanAccess will return 'true' when a user with the permissions is trying to access to a path (resource) with a
+// http method, and any of the permissions is accepted by the rules matching them (see matchRule). Users with every
+// permission (user.PermissionAll) can access any resource
+func (r Rules) CanAccess(method, path string, permissions user.Permissions) bool {
+	if permissions.Has(user.PermissionAll) {
+		return true
 	}
 
-	rolesAccepted := r[method][path]
-	for _, roleAccepted := range rolesAccepted {
-		if roleAccepted == role {
+	permissionsAccepted := r.accepted(method, path)
+	for _, permissionAccepted := range permissionsAccepted {
+		if permissions.Has(permissionAccepted) {
 			return true
 		}
 	}
@@ -1,17 +1,32 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
 	"encoding/json"
+	"encoding/pem"
 	"errors"
 	"github.com/gin-gonic/gin"
+	jwtlib "github.com/golang-jwt/jwt/v5"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/clock"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/totp"
 	"github.com/nicocarolo/space-drivers/internal/user"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 )
 
 type NoEncrypter struct{}
@@ -42,6 +57,15 @@ func Test_LoginUser(t *testing.T) {
 		},
 		Password: "1234",
 	})
+	suspended, _ := userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "suspended_email@",
+			Role:  "driver",
+		},
+		Password: "1234",
+	})
+	suspended.Active = false
+	userDB.UpdateStatus(context.Background(), suspended)
 	testscases := map[string]struct {
 		body           map[string]interface{}
 		wantError      error
@@ -55,6 +79,16 @@ func Test_LoginUser(t *testing.T) {
 			statusExpected: http.StatusOK,
 		},
 
+		"failure login due to invalid scope: the scope of another role": {
+			body: map[string]interface{}{
+				"email":    "an_email@",
+				"password": "1234",
+				"scope":    user.ScopeDriverApp,
+			},
+			wantError:      user.ErrInvalidScope,
+			statusExpected: http.StatusBadRequest,
+		},
+
 		"failure login due to invalid request: no email ": {
 			body: map[string]interface{}{
 				"password": "12313",
@@ -80,6 +114,15 @@ func Test_LoginUser(t *testing.T) {
 			statusExpected: http.StatusBadRequest,
 		},
 
+		"failure login due to suspended user": {
+			body: map[string]interface{}{
+				"email":    "suspended_email@",
+				"password": "1234",
+			},
+			wantError:      errors.New("suspended_user - the user is suspended and cannot login"),
+			statusExpected: http.StatusForbidden,
+		},
+
 		"failure login due to storage error: user not found": {
 			body: map[string]interface{}{
 				"email":    "anemail@",
@@ -109,6 +152,108 @@ func Test_LoginUser(t *testing.T) {
 
 			assert.Equal(t, tc.statusExpected, w.Code)
 
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var resp map[string]interface{}
+				err = json.Unmarshal(w.Body.Bytes(), &resp)
+				assert.Nil(t, err)
+
+				assert.NotEmpty(t, resp["token"])
+				assert.NotEmpty(t, resp["refresh_token"])
+
+				// the token carries the email and the permissions of the user role
+				token, err := jwt.ValidateToken(context.Background(), resp["token"].(string))
+				assert.Nil(t, err)
+
+				claims, err := jwt.GetClaims(token)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.body["email"], claims.Email)
+				assert.Equal(t, []string(user.RolePermissions(user.RoleAdmin)), claims.Permissions)
+			}
+		})
+	}
+}
+
+func Test_loginTwoFactor(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	userDB := newMockDB()
+	admin, _ := userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "an_email@",
+			Role:  "admin",
+		},
+		Password: "1234",
+	})
+	secret, err := totp.GenerateSecret()
+	assert.Nil(t, err)
+	_ = userDB.UpdateTwoFactor(context.Background(), admin.ID, secret, true)
+
+	users := user.NewUserStorage(userDB, user.WithPasswordEncrypter(NoEncrypter{}))
+	session, err := users.Login(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{Email: "an_email@"},
+		Password:    "1234",
+	})
+	assert.Nil(t, err)
+	assert.Empty(t, session.Token)
+
+	code, err := totp.Code(secret, time.Now())
+	assert.Nil(t, err)
+
+	testscases := map[string]struct {
+		body           map[string]interface{}
+		wantError      error
+		statusExpected int
+	}{
+		"successful two factor login": {
+			body:           map[string]interface{}{"challenge": session.Challenge, "code": code},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to invalid request: no code": {
+			body:           map[string]interface{}{"challenge": session.Challenge},
+			wantError:      errors.New("invalid_request - there was an error with fields: code"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to invalid code": {
+			body:           map[string]interface{}{"challenge": session.Challenge, "code": "abcdef"},
+			wantError:      errors.New("invalid_two_factor_code - the two factor code received is invalid"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"failure due to invalid challenge": {
+			body:           map[string]interface{}{"challenge": "a challenge", "code": code},
+			wantError:      errors.New("invalid_challenge - the two factor challenge received is invalid or expired"),
+			statusExpected: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+
+			handler := AuthHandler{
+				Users: users,
+			}
+			handler.LoginTwoFactor(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
 			if tc.wantError != nil {
 				var apiErr apiError
 				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
@@ -125,3 +270,662 @@ func Test_LoginUser(t *testing.T) {
 		})
 	}
 }
+
+func Test_refreshToken(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	userDB := newMockDB()
+	_, _ = userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "an_email@",
+			Role:  "driver",
+		},
+		Password: "1234",
+	})
+
+	users := user.NewUserStorage(userDB, user.WithPasswordEncrypter(NoEncrypter{}))
+	session, err := users.Login(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{Email: "an_email@"},
+		Password:    "1234",
+	})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, session.RefreshToken)
+
+	handler := AuthHandler{
+		Users: users,
+	}
+	refresh := func(body map[string]interface{}) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+
+		c, _ := gin.CreateTestContext(w)
+		c.Request = &http.Request{
+			Header: make(http.Header),
+		}
+
+		err := mockJson(c, http.MethodPost, body)
+		assert.Nil(t, err)
+
+		handler.Refresh(c)
+
+		return w
+	}
+
+	// the refresh token is rotated
+	w := refresh(map[string]interface{}{"refresh_token": session.RefreshToken})
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var refreshed user.Session
+	err = json.Unmarshal(w.Body.Bytes(), &refreshed)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, refreshed.Token)
+	assert.NotEmpty(t, refreshed.RefreshToken)
+	assert.NotEqual(t, session.RefreshToken, refreshed.RefreshToken)
+
+	// a used refresh token is rejected, and the one which replaced it is revoked too
+	for _, token := range []string{session.RefreshToken, refreshed.RefreshToken} {
+		w = refresh(map[string]interface{}{"refresh_token": token})
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+		var apiErr apiError
+		err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+		assert.Nil(t, err)
+		assert.Equal(t, "invalid_refresh_token - the refresh token received is invalid or expired", apiErr.Error())
+	}
+
+	w = refresh(map[string]interface{}{})
+	assert.Equal(t, http.StatusUnprocessableEntity, w.Code)
+}
+
+func Test_authenticateRotatedKeys(t *testing.T) {
+	defer func() {
+		_ = os.Unsetenv("JWT_KEYS")
+		_ = os.Unsetenv("JWT_KEY_ID")
+	}()
+
+	// a token signed with the previous key and a token without kid, signed with the secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+	withoutKid, err := jwt.GenerateToken(1, "admin@hotmail.com", user.RoleAdmin, user.RolePermissions(user.RoleAdmin))
+	assert.Nil(t, err)
+
+	_ = os.Setenv("JWT_KEYS", "previous:a previous secret")
+	_ = os.Setenv("JWT_KEY_ID", "previous")
+	previous, err := jwt.GenerateToken(2, "admin@hotmail.com", user.RoleAdmin, user.RolePermissions(user.RoleAdmin))
+	assert.Nil(t, err)
+
+	// the new key signs the tokens while the previous one is still accepted
+	_ = os.Setenv("JWT_KEYS", "previous:a previous secret,current:a current secret")
+	_ = os.Setenv("JWT_KEY_ID", "current")
+	current, err := jwt.GenerateToken(3, "admin@hotmail.com", user.RoleAdmin, user.RolePermissions(user.RoleAdmin))
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.GET("/v1/me", AuthenticateRequest(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.MustGet("user_on_call").(jwt.Claims).UserID})
+	})
+
+	authenticate := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/v1/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	for token, userID := range map[string]float64{withoutKid: 1, previous: 2, current: 3} {
+		w := authenticate(token)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp map[string]interface{}
+		err := json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Nil(t, err)
+		assert.Equal(t, userID, resp["user_id"])
+	}
+
+	// once the previous key is removed its tokens are rejected
+	_ = os.Setenv("JWT_KEYS", "current:a current secret")
+	w = authenticate(previous)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var apiErr apiError
+	err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+	assert.Nil(t, err)
+	assert.Equal(t, "invalid_token", apiErr.Code)
+
+	w = authenticate(current)
+	assert.Equal(t, http.StatusOK, w.Code)
+}
+
+func Test_authenticateAsymmetricKeys(t *testing.T) {
+	defer func() {
+		_ = os.Unsetenv("JWT_PRIVATE_KEYS")
+		_ = os.Unsetenv("JWT_KEY_ID")
+	}()
+
+	dir := t.TempDir()
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	assert.Nil(t, err)
+
+	writeKey := func(name string, key interface{}) string {
+		der, err := x509.MarshalPKCS8PrivateKey(key)
+		assert.Nil(t, err)
+
+		path := filepath.Join(dir, name)
+		err = ioutil.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600)
+		assert.Nil(t, err)
+
+		return path
+	}
+
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+	_ = os.Setenv("JWT_PRIVATE_KEYS", "rsa-key:"+writeKey("rsa.pem", rsaKey)+",ed-key:"+writeKey("ed.pem", edKey))
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.GET("/.well-known/jwks.json", AuthHandler{}.JWKS)
+	router.GET("/v1/me", AuthenticateRequest(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.MustGet("user_on_call").(jwt.Claims).UserID})
+	})
+
+	for kid, alg := range map[string]string{"rsa-key": "RS256", "ed-key": "EdDSA"} {
+		_ = os.Setenv("JWT_KEY_ID", kid)
+		token, err := jwt.GenerateToken(1, "admin@hotmail.com", user.RoleAdmin, user.RolePermissions(user.RoleAdmin))
+		assert.Nil(t, err)
+
+		header, err := base64.RawURLEncoding.DecodeString(strings.Split(token, ".")[0])
+		assert.Nil(t, err)
+		assert.Contains(t, string(header), `"alg":"`+alg+`"`)
+		assert.Contains(t, string(header), `"kid":"`+kid+`"`)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/v1/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	// only the public keys of the asymmetric keys are published
+	w = httptest.NewRecorder()
+	req, _ := http.NewRequest(http.MethodGet, "/.well-known/jwks.json", nil)
+
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var set jwt.JSONWebKeySet
+	err = json.Unmarshal(w.Body.Bytes(), &set)
+	assert.Nil(t, err)
+	assert.Equal(t, []jwt.JSONWebKey{
+		{
+			Kty: "OKP",
+			Kid: "ed-key",
+			Use: "sig",
+			Alg: "EdDSA",
+			Crv: "Ed25519",
+			X:   base64.RawURLEncoding.EncodeToString(edKey.Public().(ed25519.PublicKey)),
+		},
+		{
+			Kty: "RSA",
+			Kid: "rsa-key",
+			Use: "sig",
+			Alg: "RS256",
+			N:   base64.RawURLEncoding.EncodeToString(rsaKey.N.Bytes()),
+			E:   "AQAB",
+		},
+	}, set.Keys)
+}
+
+func Test_authenticateTokenValidation(t *testing.T) {
+	defer func() {
+		_ = os.Unsetenv("JWT_LEEWAY")
+	}()
+
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+	_ = os.Setenv("JWT_LEEWAY", "1m")
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.GET("/v1/me", AuthenticateRequest(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.MustGet("user_on_call").(jwt.Claims).UserID})
+	})
+
+	token := func(method jwtlib.SigningMethod, key interface{}, exp time.Time) string {
+		t.Helper()
+		token, err := jwtlib.NewWithClaims(method, jwtlib.MapClaims{
+			"exp":     exp.Unix(),
+			"iat":     time.Now().Add(-time.Hour).Unix(),
+			"user_id": 1,
+			"role":    user.RoleAdmin,
+		}).SignedString(key)
+		assert.Nil(t, err)
+
+		return token
+	}
+
+	tests := []struct {
+		name   string
+		token  string
+		status int
+		code   string
+	}{
+		{
+			name:   "expired token within leeway is accepted",
+			token:  token(jwtlib.SigningMethodHS256, []byte("jdnfksdmfksd"), time.Now().Add(-30*time.Second)),
+			status: http.StatusOK,
+		},
+		{
+			name:   "expired token after leeway",
+			token:  token(jwtlib.SigningMethodHS256, []byte("jdnfksdmfksd"), time.Now().Add(-2*time.Minute)),
+			status: http.StatusUnauthorized,
+			code:   "expired_token",
+		},
+		{
+			name:   "unsigned token",
+			token:  token(jwtlib.SigningMethodNone, jwtlib.UnsafeAllowNoneSignatureType, time.Now().Add(time.Hour)),
+			status: http.StatusUnauthorized,
+			code:   "invalid_token",
+		},
+		{
+			name:   "token signed with an algorithm not allowed",
+			token:  token(jwtlib.SigningMethodHS512, []byte("jdnfksdmfksd"), time.Now().Add(time.Hour)),
+			status: http.StatusUnauthorized,
+			code:   "invalid_token",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/v1/me", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.code != "" {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+				assert.Equal(t, tt.code, apiErr.Code)
+			}
+		})
+	}
+}
+
+func Test_authenticateTokenExpiry(t *testing.T) {
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	now := clock.NewFake(time.Now())
+	previous := jwt.Clock
+	jwt.Clock = now
+	defer func() { jwt.Clock = previous }()
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.GET("/v1/me", AuthenticateRequest(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.MustGet("user_on_call").(jwt.Claims).UserID})
+	})
+
+	// the tokens expire 20 minutes after they are generated
+	token, err := jwt.GenerateToken(1, "admin@hotmail.com", user.RoleAdmin, user.RolePermissions(user.RoleAdmin))
+	assert.Nil(t, err)
+
+	for _, step := range []struct {
+		advance time.Duration
+		status  int
+		code    string
+	}{
+		{advance: 0, status: http.StatusOK},
+		{advance: 19 * time.Minute, status: http.StatusOK},
+		{advance: 2 * time.Minute, status: http.StatusUnauthorized, code: "expired_token"},
+	} {
+		now.Advance(step.advance)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/v1/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		router.ServeHTTP(w, req)
+
+		assert.Equal(t, step.status, w.Code)
+		if step.code != "" {
+			var apiErr apiError
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &apiErr))
+			assert.Equal(t, step.code, apiErr.Code)
+		}
+	}
+}
+
+func Test_authenticateIssuerAudience(t *testing.T) {
+	defer func() {
+		_ = os.Unsetenv("JWT_ISSUER")
+		_ = os.Unsetenv("JWT_AUDIENCE")
+	}()
+
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+	generate := func(issuer, audience string) string {
+		_ = os.Setenv("JWT_ISSUER", issuer)
+		_ = os.Setenv("JWT_AUDIENCE", audience)
+		token, err := jwt.GenerateToken(1, "admin@hotmail.com", user.RoleAdmin, user.RolePermissions(user.RoleAdmin))
+		assert.Nil(t, err)
+
+		return token
+	}
+
+	production := generate("space-drivers", "production")
+	staging := generate("space-drivers", "staging")
+	otherIssuer := generate("other-service", "production")
+	withoutClaims := generate("", "")
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.GET("/v1/me", AuthenticateRequest(), func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"user_id": c.MustGet("user_on_call").(jwt.Claims).UserID})
+	})
+
+	_ = os.Setenv("JWT_ISSUER", "space-drivers")
+	_ = os.Setenv("JWT_AUDIENCE", "production")
+
+	tests := map[string]struct {
+		token       string
+		status      int
+		description string
+	}{
+		"token of the environment":      {token: production, status: http.StatusOK},
+		"token of another environment":  {token: staging, status: http.StatusUnauthorized, description: "invalid aud claim"},
+		"token of another issuer":       {token: otherIssuer, status: http.StatusUnauthorized, description: "invalid iss claim"},
+		"token without issuer audience": {token: withoutClaims, status: http.StatusUnauthorized, description: "invalid iss claim"},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/v1/me", nil)
+			req.Header.Set("Authorization", "Bearer "+tt.token)
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tt.status, w.Code)
+			if tt.description != "" {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+				assert.Equal(t, "invalid_token", apiErr.Code)
+				assert.Contains(t, apiErr.Message, tt.description)
+			}
+		})
+	}
+}
+
+func Test_loginThrottleSpoofedIP(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	userDB := newMockDB()
+	userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "an_email@",
+			Role:  "admin",
+		},
+		Password: "1234",
+	})
+	handler := AuthHandler{
+		Users: user.NewUserStorage(userDB, user.WithPasswordEncrypter(NoEncrypter{}),
+			user.WithLoginThrottle(user.NewLoginThrottle(user.LoginThrottleConfig{MaxFailures: 100,
+				IPMaxFailures: 2}))),
+	}
+
+	// no proxy is trusted, as when TRUSTED_PROXIES is not configured
+	router := gin.New()
+	err := router.SetTrustedProxies(nil)
+	assert.Nil(t, err)
+	router.Use(RequestClient())
+	router.POST("/v1/login", handler.Login)
+
+	login := func(remoteAddr, forwardedFor, password string) int {
+		body, _ := json.Marshal(map[string]interface{}{"email": "an_email@", "password": password})
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodPost, "/v1/login", bytes.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("X-Forwarded-For", forwardedFor)
+		req.RemoteAddr = remoteAddr
+
+		router.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	// rotating the header does not change the ip throttled
+	assert.Equal(t, http.StatusBadRequest, login("10.0.0.1:53000", "203.0.113.1", "error"))
+	assert.Equal(t, http.StatusBadRequest, login("10.0.0.1:53000", "203.0.113.2", "error"))
+	assert.Equal(t, http.StatusTooManyRequests, login("10.0.0.1:53000", "203.0.113.3", "1234"))
+
+	// and claiming the ip banned does not throttle another client
+	assert.Equal(t, http.StatusOK, login("10.0.0.2:53000", "10.0.0.1", "1234"))
+}
+
+func Test_renewToken(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	userDB := newMockDB()
+	userDB.users[1] = user.User{SecuredUser: user.SecuredUser{ID: 1, Email: "driver@hotmail.com",
+		Role: user.RoleDriver, Active: true}}
+	session, err := userDB.SaveSession(context.Background(), user.UserSession{UserID: 1,
+		ExpiresAt: time.Now().Add(time.Hour)})
+	assert.Nil(t, err)
+	users := user.NewUserStorage(userDB, user.WithRenewalWindow(time.Hour))
+
+	rules := Rules{http.MethodGet: {"/v1/me": {user.PermissionProfileRead}}}
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.GET("/v1/me", AuthenticateRequest(), AuthorizeRequest(rules, nil), RenewToken(users),
+		func(c *gin.Context) {
+			c.JSON(http.StatusOK, gin.H{"user_id": c.MustGet("user_on_call").(jwt.Claims).UserID})
+		})
+
+	authenticate := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/v1/me", nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+	token := func(permissions []string) string {
+		token, err := jwt.GenerateSessionToken(1, "driver@hotmail.com", user.RoleDriver, "", permissions, session.ID)
+		assert.Nil(t, err)
+		return token
+	}
+
+	// the token expires within the window, so a new one is answered and it can be used
+	w = authenticate(token(user.RolePermissions(user.RoleDriver)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	renewed := w.Header().Get(RenewedTokenHeader)
+	assert.NotEmpty(t, renewed)
+
+	w = authenticate(renewed)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// the two factor challenge and enrollment tokens are not authorized, and they are never renewed
+	for _, permission := range []string{user.PermissionTwoFactorChallenge, user.PermissionTwoFactorEnroll} {
+		w = authenticate(token([]string{permission}))
+		assert.Equal(t, http.StatusUnauthorized, w.Code)
+		assert.Empty(t, w.Header().Get(RenewedTokenHeader))
+	}
+
+	// a token without session is not renewed
+	withoutSession, err := jwt.GenerateToken(1, "driver@hotmail.com", user.RoleDriver,
+		user.RolePermissions(user.RoleDriver))
+	assert.Nil(t, err)
+	w = authenticate(withoutSession)
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(RenewedTokenHeader))
+
+	// a suspended user is still authenticated until its token expires, but it is not renewed
+	userDB.users[1] = user.User{SecuredUser: user.SecuredUser{ID: 1, Email: "driver@hotmail.com",
+		Role: user.RoleDriver}}
+	w = authenticate(token(user.RolePermissions(user.RoleDriver)))
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Empty(t, w.Header().Get(RenewedTokenHeader))
+}
+
+func Test_rulesCanAccess(t *testing.T) {
+	rules, err := LoadRules("../../../config/authorization_rules.json")
+	assert.Nil(t, err)
+
+	testscases := map[string]struct {
+		method string
+		path   string
+		claims jwt.Claims
+		want   bool
+	}{
+		"admin can create users": {
+			method: http.MethodPost,
+			path:   "/v1/users",
+			claims: jwt.Claims{Role: user.RoleAdmin, Permissions: user.RolePermissions(user.RoleAdmin)},
+			want:   true,
+		},
+
+		"dispatcher can create travels": {
+			method: http.MethodPost,
+			path:   "/v1/travels",
+			claims: jwt.Claims{Role: user.RoleDispatcher, Permissions: user.RolePermissions(user.RoleDispatcher)},
+			want:   true,
+		},
+
+		"dispatcher cannot create users": {
+			method: http.MethodPost,
+			path:   "/v1/users",
+			claims: jwt.Claims{Role: user.RoleDispatcher, Permissions: user.RolePermissions(user.RoleDispatcher)},
+		},
+
+		"driver can accept travels": {
+			method: http.MethodPost,
+			path:   "/v1/travels/:id/accept",
+			claims: jwt.Claims{Role: user.RoleDriver, Permissions: user.RolePermissions(user.RoleDriver)},
+			want:   true,
+		},
+
+		"dispatcher cannot accept travels": {
+			method: http.MethodPost,
+			path:   "/v1/travels/:id/accept",
+			claims: jwt.Claims{Role: user.RoleDispatcher, Permissions: user.RolePermissions(user.RoleDispatcher)},
+		},
+
+		"admin can access every resource": {
+			method: http.MethodPost,
+			path:   "/v1/travels/:id/accept",
+			claims: jwt.Claims{Role: user.RoleAdmin, Permissions: user.RolePermissions(user.RoleAdmin)},
+			want:   true,
+		},
+
+		"zone wildcard rule": {
+			method: http.MethodDelete,
+			path:   "/v1/zones/:id/drivers/:user_id",
+			claims: jwt.Claims{Role: user.RoleDispatcher, Permissions: []string{user.PermissionZoneWrite}},
+			want:   true,
+		},
+
+		"enrollment token can enroll two factor authentication": {
+			method: http.MethodPost,
+			path:   "/v1/me/2fa",
+			claims: jwt.Claims{Role: user.RoleAdmin, Permissions: []string{user.PermissionTwoFactorEnroll}},
+			want:   true,
+		},
+
+		"enrollment token cannot get users": {
+			method: http.MethodGet,
+			path:   "/v1/users/:id",
+			claims: jwt.Claims{Role: user.RoleAdmin, Permissions: []string{user.PermissionTwoFactorEnroll}},
+		},
+
+		"two factor challenge cannot get the user logged in": {
+			method: http.MethodGet,
+			path:   "/v1/me",
+			claims: jwt.Claims{Role: user.RoleAdmin, Permissions: []string{user.PermissionTwoFactorChallenge}},
+		},
+
+		"permissions carried on claims are checked instead of role ones": {
+			method: http.MethodGet,
+			path:   "/v1/travels/stats",
+			claims: jwt.Claims{Role: user.RoleDriver, Permissions: []string{user.PermissionTravelReport}},
+			want:   true,
+		},
+
+		"claims without permissions get the role ones": {
+			method: http.MethodGet,
+			path:   "/v1/users/drivers",
+			claims: jwt.Claims{Role: user.RoleDispatcher},
+			want:   true,
+		},
+
+		"unknown path": {
+			method: http.MethodGet,
+			path:   "/v1/unknown",
+			claims: jwt.Claims{Role: user.RoleDispatcher, Permissions: user.RolePermissions(user.RoleDispatcher)},
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, rules.CanAccess(tc.method, tc.path, user.ClaimsPermissions(tc.claims)))
+		})
+	}
+}
+
+func Test_authorizeScopedToken(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	eventsDB := &eventMockDb{}
+	// the rules accept the driver permissions on the travels search too, the scope keeps the token out of it
+	rules := Rules{http.MethodGet: {
+		"/v1/me":        {user.PermissionProfileRead},
+		"/v1/travels":   {user.PermissionTravelRead, user.PermissionTravelOwn},
+		"/v1/users/:id": {user.PermissionProfileRead},
+	}}
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	for path := range rules[http.MethodGet] {
+		router.GET(path, AuthenticateRequest(), AuthorizeRequest(rules, audit.NewEventStorage(eventsDB)),
+			func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+	}
+
+	call := func(path, scope string) int {
+		token, err := jwt.GenerateScopedToken(2, "driver@", user.RoleDriver, scope,
+			user.RolePermissions(user.RoleDriver))
+		assert.Nil(t, err)
+
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		router.ServeHTTP(w, req)
+
+		return w.Code
+	}
+
+	assert.Equal(t, http.StatusOK, call("/v1/travels", ""))
+	assert.Equal(t, http.StatusOK, call("/v1/users/2", ""))
+	assert.Equal(t, http.StatusOK, call("/v1/me", user.ScopeDriverApp))
+	assert.Equal(t, http.StatusUnauthorized, call("/v1/travels", user.ScopeDriverApp))
+	assert.Equal(t, http.StatusUnauthorized, call("/v1/users/2", user.ScopeDriverApp))
+	assert.Equal(t, http.StatusUnauthorized, call("/v1/me", "unknown"))
+
+	assert.Len(t, eventsDB.events, 3)
+	assert.Equal(t, audit.EventAccessDenied, eventsDB.events[0].Type)
+	assert.Equal(t, "GET /v1/travels out of scope driver_app", eventsDB.events[0].Detail)
+}
@@ -0,0 +1,128 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/authorization"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"net/http"
+	"strconv"
+)
+
+type RulesStorage interface {
+	List(ctx context.Context) ([]authorization.Rule, error)
+	Save(ctx context.Context, rule authorization.Rule) (authorization.Rule, error)
+	Delete(ctx context.Context, id int64) error
+}
+
+type AuthorizationHandler struct {
+	Rules RulesStorage
+	// Routes return the routes registered on the router, the rules added should match any of them
+	Routes func() gin.RoutesInfo
+}
+
+// ListRules handler will get all the authorization rules managed at runtime from storage
+func (h AuthorizationHandler) ListRules(c *gin.Context) {
+	rules, err := h.Rules.List(c)
+	if err != nil {
+		code, resp := mapAuthorizationError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	if rules == nil {
+		rules = []authorization.Rule{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": rules})
+}
+
+// CreateRule handler will parse received body and save the rule to storage, the rule should match any registered
+// route
+func (h AuthorizationHandler) CreateRule(c *gin.Context) {
+	var ruleToCreate authorization.Rule
+	if err := c.ShouldBindJSON(&ruleToCreate); err != nil {
+		log.ErrorLimited(c, "there was an error parsing authorization rule create request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	if h.Routes != nil && !matchAnyRoute(ruleToCreate, h.Routes()) {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_rule",
+			Message: "the rule does not match any route",
+		})
+		return
+	}
+
+	createdRule, err := h.Rules.Save(c, ruleToCreate)
+	if err != nil {
+		code, resp := mapAuthorizationError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, createdRule)
+}
+
+// DeleteRule handler will remove the authorization rule with the received id from storage
+func (h AuthorizationHandler) DeleteRule(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a rule id to delete",
+		})
+		return
+	}
+
+	if err := h.Rules.Delete(c, id); err != nil {
+		code, resp := mapAuthorizationError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// matchAnyRoute return if the rule applies to any of the routes
+func matchAnyRoute(rule authorization.Rule, routes gin.RoutesInfo) bool {
+	for _, route := range routes {
+		if matchRule(rule.Method, rule.Path, route.Method, route.Path) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func mapAuthorizationError(err error) (int, error) {
+	errToStatus := map[code_error.Error]int{
+		authorization.ErrInvalidRuleMethod:     http.StatusBadRequest,
+		authorization.ErrInvalidRulePath:       http.StatusBadRequest,
+		authorization.ErrInvalidRulePermission: http.StatusBadRequest,
+		authorization.ErrRuleAlreadyExists:     http.StatusConflict,
+		authorization.ErrNotFoundRule:          http.StatusNotFound,
+		authorization.ErrStorageSave:           http.StatusInternalServerError,
+		authorization.ErrStorageGet:            http.StatusInternalServerError,
+		authorization.ErrStorageDelete:         http.StatusInternalServerError,
+	}
+
+	var ruleErr code_error.Error
+	if errors.As(err, &ruleErr) {
+		if code, ok := errToStatus[ruleErr]; ok {
+			return code, apiError{
+				Code:    ruleErr.GetCode(),
+				Message: ruleErr.GetDetail(),
+			}
+		}
+	}
+
+	return http.StatusInternalServerError, apiError{
+		Code:    "error",
+		Message: err.Error(),
+	}
+}
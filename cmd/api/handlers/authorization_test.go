@@ -0,0 +1,176 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/authorization"
+	"github.com/nicocarolo/space-drivers/internal/user"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+// ruleMockDb a 'db' to use on AuthorizationHandler test
+type ruleMockDb struct {
+	idCount int64
+	rules   map[int64]authorization.Rule
+}
+
+func newRuleMockDB() *ruleMockDb {
+	return &ruleMockDb{
+		idCount: 1,
+		rules:   make(map[int64]authorization.Rule),
+	}
+}
+
+func (db *ruleMockDb) SaveRule(ctx context.Context, rule authorization.Rule) (authorization.Rule, error) {
+	for _, stored := range db.rules {
+		if stored.Method == rule.Method && stored.Path == rule.Path && stored.Permission == rule.Permission {
+			return authorization.Rule{}, authorization.ErrRuleDuplicated
+		}
+	}
+
+	rule.ID = db.idCount
+	db.rules[rule.ID] = rule
+
+	db.idCount++
+
+	return rule, nil
+}
+
+func (db ruleMockDb) GetRule(ctx context.Context, id int64) (authorization.Rule, error) {
+	rule, exist := db.rules[id]
+	if !exist {
+		return authorization.Rule{}, authorization.ErrRuleNotFound
+	}
+
+	return rule, nil
+}
+
+func (db ruleMockDb) GetRules(ctx context.Context) ([]authorization.Rule, error) {
+	var rules []authorization.Rule
+	for id := int64(1); id < db.idCount; id++ {
+		if rule, exist := db.rules[id]; exist {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+func (db *ruleMockDb) DeleteRule(ctx context.Context, id int64) error {
+	if _, exist := db.rules[id]; !exist {
+		return authorization.ErrRuleNotFound
+	}
+
+	delete(db.rules, id)
+	return nil
+}
+
+func Test_manageRules(t *testing.T) {
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	noop := func(c *gin.Context) {}
+	router.GET("/v1/travels/stats", noop)
+
+	storage := authorization.NewRuleStorage(newRuleMockDB())
+	handler := AuthorizationHandler{
+		Rules:  storage,
+		Routes: router.Routes,
+	}
+	ruler := StoredRules{
+		Rules:  Rules{http.MethodGet: {"/v1/travels/stats": {user.PermissionTravelReport}}},
+		Stored: storage,
+	}
+	dispatcher := user.RolePermissions(user.RoleDispatcher)
+
+	call := func(method string, body map[string]interface{}, params gin.Params,
+		handle func(c *gin.Context)) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+
+		c, _ := gin.CreateTestContext(w)
+		c.Request = &http.Request{
+			Header: make(http.Header),
+		}
+		c.Params = params
+
+		if body != nil {
+			err := mockJson(c, method, body)
+			assert.Nil(t, err)
+		}
+
+		handle(c)
+		c.Writer.WriteHeaderNow()
+
+		return w
+	}
+	assertError := func(w *httptest.ResponseRecorder, status int, want error) {
+		assert.Equal(t, status, w.Code)
+
+		var apiErr apiError
+		err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+		assert.Nil(t, err)
+		assert.Equal(t, want.Error(), apiErr.Error())
+	}
+
+	assert.False(t, ruler.CanAccess(http.MethodGet, "/v1/travels/stats", dispatcher))
+
+	// a rule granting the travel stats to dispatchers
+	w = call(http.MethodPost, map[string]interface{}{
+		"method":     "GET",
+		"path":       "/v1/travels/*",
+		"permission": user.PermissionTravelRead,
+	}, nil, handler.CreateRule)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var created authorization.Rule
+	err := json.Unmarshal(w.Body.Bytes(), &created)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), created.ID)
+
+	assert.True(t, ruler.CanAccess(http.MethodGet, "/v1/travels/stats", dispatcher))
+
+	w = call(http.MethodPost, map[string]interface{}{
+		"method":     "GET",
+		"path":       "/v1/travels/*",
+		"permission": user.PermissionTravelRead,
+	}, nil, handler.CreateRule)
+	assertError(w, http.StatusConflict, errors.New("rule_already_exists - there is already a rule with the received "+
+		"method, path and permission"))
+
+	w = call(http.MethodPost, map[string]interface{}{
+		"method":     "GET",
+		"path":       "/v1/travel/stats",
+		"permission": user.PermissionTravelRead,
+	}, nil, handler.CreateRule)
+	assertError(w, http.StatusBadRequest, errors.New("invalid_rule - the rule does not match any route"))
+
+	w = call(http.MethodPost, map[string]interface{}{
+		"method":     "GET",
+		"path":       "/v1/travels/stats",
+		"permission": "travels:read",
+	}, nil, handler.CreateRule)
+	assertError(w, http.StatusBadRequest, errors.New("invalid_rule - the rule permission is unknown"))
+
+	w = call(http.MethodGet, nil, nil, handler.ListRules)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var listed struct {
+		Result []authorization.Rule `json:"result"`
+	}
+	err = json.Unmarshal(w.Body.Bytes(), &listed)
+	assert.Nil(t, err)
+	assert.Equal(t, []authorization.Rule{created}, listed.Result)
+
+	// removing the rule revokes the access
+	w = call(http.MethodDelete, nil, gin.Params{{Key: "id", Value: "1"}}, handler.DeleteRule)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	assert.False(t, ruler.CanAccess(http.MethodGet, "/v1/travels/stats", dispatcher))
+
+	w = call(http.MethodDelete, nil, gin.Params{{Key: "id", Value: "1"}}, handler.DeleteRule)
+	assertError(w, http.StatusNotFound, errors.New("not_found_rule - not founded the rule to get"))
+}
@@ -0,0 +1,172 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// maxLoggedBody is the size of the largest body logged by BodyLog
+const maxLoggedBody = 8 * 1024
+
+// notLoggedBody replaces the bodies which are not logged by BodyLog
+const notLoggedBody = "[NOT LOGGED: not a JSON body or bigger than 8KB]"
+
+// redactedFields are the parts of the names of the fields which values are not logged by BodyLog, as the password,
+// new_password, token, refresh_token and email fields, and the two factor secret
+var redactedFields = []string{"password", "token", "email", "secret"}
+
+// redactedNames are the names of the fields which values are not logged by BodyLog: the two factor challenge and the
+// provisioning uri with its secret, and the tracking links with their token
+var redactedNames = []string{"challenge", "uri", "url", "link"}
+
+// redactedRequestNames are the names of the fields which values are not logged on the request bodies, as the two
+// factor codes. The code of the errors answered is still logged on the response bodies
+var redactedRequestNames = []string{"code"}
+
+// redacted replaces the values of the redacted fields
+const redacted = "[REDACTED]"
+
+// BodyLog middleware log the request and response bodies of the routes received (as "POST /v1/travels", the format of
+// the authorization rules), to troubleshoot the integrations of the clients. The values of the password, token, email
+// and two factor fields and of the links are redacted, at any depth of the JSON bodies, and the bodies which are not
+// JSON are not logged. It is meant to be enabled only for a while, as the bodies have the data of the users
+func BodyLog(routes ...string) gin.HandlerFunc {
+	logged := make(map[string]bool, len(routes))
+	for _, route := range routes {
+		logged[strings.TrimSpace(route)] = true
+	}
+
+	return func(ctx *gin.Context) {
+		if !logged[ctx.Request.Method+" "+ctx.FullPath()] {
+			ctx.Next()
+			return
+		}
+
+		// only the part of the body which can be logged is read, the handler reads it and then the rest of the body
+		var request []byte
+		if ctx.Request.Body != nil {
+			body, err := ioutil.ReadAll(io.LimitReader(ctx.Request.Body, maxLoggedBody+1))
+			if err != nil {
+				log.Error(ctx, "there was an error reading the body of the request to log it", log.Err(err))
+			}
+			request = body
+			ctx.Request.Body = readCloser{
+				Reader: io.MultiReader(bytes.NewReader(body), ctx.Request.Body),
+				Closer: ctx.Request.Body,
+			}
+		}
+
+		writer := &bodyLogWriter{ResponseWriter: ctx.Writer}
+		ctx.Writer = writer
+
+		ctx.Next()
+
+		log.Info(ctx, "body",
+			log.String("method", ctx.Request.Method),
+			log.String("path", ctx.FullPath()),
+			log.Int("status", writer.Status()),
+			log.String("request_body", redactBody(request, true)),
+			log.String("response_body", redactBody(writer.body.Bytes(), false)))
+	}
+}
+
+// readCloser is the body of a request read by parts, closing the original body
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
+
+// bodyLogWriter keeps a copy of the response body written, up to a byte more than maxLoggedBody so the bigger ones
+// are known
+type bodyLogWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *bodyLogWriter) Write(body []byte) (int, error) {
+	if available := maxLoggedBody + 1 - w.body.Len(); available > 0 {
+		if len(body) > available {
+			w.body.Write(body[:available])
+		} else {
+			w.body.Write(body)
+		}
+	}
+
+	return w.ResponseWriter.Write(body)
+}
+
+func (w *bodyLogWriter) WriteString(body string) (int, error) {
+	return w.Write([]byte(body))
+}
+
+// redactBody return the JSON body with the values of the redacted fields replaced, the bodies which are not JSON or
+// are too big are replaced with notLoggedBody, as their sensitive data cannot be found. The request bodies have the
+// redactedRequestNames redacted too
+func redactBody(body []byte, request bool) string {
+	if len(bytes.TrimSpace(body)) == 0 {
+		return ""
+	}
+
+	var value interface{}
+	if len(body) > maxLoggedBody || json.Unmarshal(body, &value) != nil {
+		return notLoggedBody
+	}
+
+	redactedBody, err := json.Marshal(redactValue(value, request))
+	if err != nil {
+		return notLoggedBody
+	}
+
+	return string(redactedBody)
+}
+
+// redactValue replace the values of the redacted fields of the objects, on the nested objects and arrays too
+func redactValue(value interface{}, request bool) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if isRedacted(key, request) {
+				v[key] = redacted
+				continue
+			}
+			v[key] = redactValue(field, request)
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item, request)
+		}
+	}
+
+	return value
+}
+
+// isRedacted return true when the name of the field has one of the redactedFields or it is one of the
+// redactedNames, or of the redactedRequestNames on a request body
+func isRedacted(key string, request bool) bool {
+	key = strings.ToLower(key)
+	for _, field := range redactedFields {
+		if strings.Contains(key, field) {
+			return true
+		}
+	}
+
+	for _, name := range redactedNames {
+		if key == name {
+			return true
+		}
+	}
+	if request {
+		for _, name := range redactedRequestNames {
+			if key == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_bodyLog(t *testing.T) {
+	logger := &recordLogger{}
+	previous := log.DefaultLogger
+	log.DefaultLogger = logger
+	defer func() { log.DefaultLogger = previous }()
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.Use(BodyLog("POST /v1/login", " POST /v1/users/:id/notes", "POST /v1/login/2fa", "POST /v1/me/2fa",
+		"POST /v1/travels/:id/tracking", "POST /v1/users/:id/files"))
+	router.POST("/v1/login", func(c *gin.Context) {
+		// the handlers still read the body of the request
+		body, _ := ioutil.ReadAll(c.Request.Body)
+		assert.Contains(t, string(body), "a-password")
+		c.JSON(http.StatusOK, gin.H{"token": "a-token", "refresh_token": "a-refresh", "user": gin.H{"id": 7,
+			"email": "an_email@"}})
+	})
+	router.POST("/v1/users/:id/notes", func(c *gin.Context) {
+		c.String(http.StatusCreated, "plain text")
+	})
+	router.POST("/v1/travels", func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"id": 1})
+	})
+	router.POST("/v1/login/2fa", func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, gin.H{"code": "invalid_two_factor_code", "message": "invalid code"})
+	})
+	router.POST("/v1/me/2fa", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"secret": "JBSWY3DPEHPK3PXP",
+			"uri": "otpauth://totp/space-drivers:an_email@?secret=JBSWY3DPEHPK3PXP"})
+	})
+	router.POST("/v1/travels/:id/tracking", func(c *gin.Context) {
+		c.JSON(http.StatusCreated, gin.H{"token": "a-token", "link": "https://track.example/?token=a-token",
+			"url": "https://track.example/?token=a-token"})
+	})
+	router.POST("/v1/users/:id/files", func(c *gin.Context) {
+		// the handlers read the whole body, even when it is too big to be logged
+		body, _ := ioutil.ReadAll(c.Request.Body)
+		c.JSON(http.StatusCreated, gin.H{"size": len(body)})
+	})
+
+	testscases := map[string]struct {
+		path         string
+		body         string
+		wantLogged   bool
+		wantRequest  string
+		wantResponse string
+	}{
+		"successful logged bodies with the sensitive fields redacted": {
+			path:         "/v1/login",
+			body:         `{"email": "an_email@", "password": "a-password", "remember": true}`,
+			wantLogged:   true,
+			wantRequest:  `{"email":"[REDACTED]","password":"[REDACTED]","remember":true}`,
+			wantResponse: `{"refresh_token":"[REDACTED]","token":"[REDACTED]","user":{"email":"[REDACTED]","id":7}}`,
+		},
+		"successful not logged bodies which are not JSON": {
+			path:         "/v1/users/7/notes",
+			body:         "email=an_email@",
+			wantLogged:   true,
+			wantRequest:  notLoggedBody,
+			wantResponse: notLoggedBody,
+		},
+		"successful logged bodies of the two factor login with the challenge and code redacted": {
+			path:         "/v1/login/2fa",
+			body:         `{"challenge": "a-challenge", "code": "123456"}`,
+			wantLogged:   true,
+			wantRequest:  `{"challenge":"[REDACTED]","code":"[REDACTED]"}`,
+			wantResponse: `{"code":"invalid_two_factor_code","message":"invalid code"}`,
+		},
+		"successful logged bodies of the two factor enrollment with the secret and uri redacted": {
+			path:         "/v1/me/2fa",
+			body:         `{}`,
+			wantLogged:   true,
+			wantRequest:  `{}`,
+			wantResponse: `{"secret":"[REDACTED]","uri":"[REDACTED]"}`,
+		},
+		"successful logged bodies of the tracking link with the links redacted": {
+			path:         "/v1/travels/7/tracking",
+			body:         `{"ttl": "1h"}`,
+			wantLogged:   true,
+			wantRequest:  `{"ttl":"1h"}`,
+			wantResponse: `{"link":"[REDACTED]","token":"[REDACTED]","url":"[REDACTED]"}`,
+		},
+		"successful not logged request body bigger than the limit, still read whole by the handler": {
+			path:         "/v1/users/7/files",
+			body:         `{"data": "` + strings.Repeat("a", 2*maxLoggedBody) + `"}`,
+			wantLogged:   true,
+			wantRequest:  notLoggedBody,
+			wantResponse: fmt.Sprintf(`{"size":%d}`, 2*maxLoggedBody+12),
+		},
+		"successful not logged bodies of a route not configured": {
+			path: "/v1/travels",
+			body: `{"user_id": 7}`,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			logger.entries = nil
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPost, tc.path, strings.NewReader(tc.body))
+			router.ServeHTTP(w, req)
+
+			if !tc.wantLogged {
+				assert.Empty(t, logger.entries)
+				return
+			}
+
+			if assert.Len(t, logger.entries, 1) {
+				entry := logger.entries[0]
+				assert.Equal(t, "body", entry.msg)
+				assert.Equal(t, tc.wantRequest, entry.fields["request_body"])
+				assert.Equal(t, tc.wantResponse, entry.fields["response_body"])
+				assert.Equal(t, int64(w.Code), entry.fields["status"])
+			}
+		})
+	}
+}
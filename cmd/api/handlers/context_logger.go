@@ -0,0 +1,37 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+)
+
+// ContextLogger middleware store on context a logger of the request with its correlation fields, the request id (of
+// RequestID) and route, so every line logged while the request is handled has them. AuthenticateRequest adds the
+// user logged in and its role. The fields are prefixed with request_ so they are not mistaken with the ones of the
+// lines, as the user_id of the user edited
+func ContextLogger() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		fields := []log.Field{log.String("request_route", ctx.FullPath())}
+		if requestID := ctx.GetString(log.RequestIDKey); requestID != "" {
+			fields = append(fields, log.String("request_id", requestID))
+		}
+
+		enrichLogger(ctx, fields...)
+	}
+}
+
+// enrichLogger add the fields to the logger of the request
+func enrichLogger(ctx *gin.Context, fields ...log.Field) {
+	ctx.Set(log.LoggerKey, log.With(log.FromContext(ctx), fields...))
+}
+
+// userFields return the correlation fields of the user logged in with the claims
+func userFields(claims jwt.Claims) []log.Field {
+	fields := []log.Field{log.Int64("request_user_id", claims.UserID), log.String("request_role", claims.Role)}
+	if claims.ImpersonatorID != 0 {
+		fields = append(fields, log.Int64("request_impersonator_id", claims.ImpersonatorID))
+	}
+
+	return fields
+}
@@ -0,0 +1,83 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/user"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func Test_contextLogger(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	logger := &recordLogger{}
+	previous := log.DefaultLogger
+	log.DefaultLogger = logger
+	defer func() { log.DefaultLogger = previous }()
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.Use(RequestID(), ContextLogger())
+	handle := func(c *gin.Context) {
+		log.Info(c, "handling request", log.Int64("user_id", 3))
+		c.Status(http.StatusNoContent)
+	}
+	router.GET("/v1/travels/:id", handle)
+	router.GET("/v1/me", AuthenticateRequest(), handle)
+
+	token, err := jwt.GenerateToken(7, "an_email@", user.RoleDispatcher, user.RolePermissions(user.RoleDispatcher))
+	assert.Nil(t, err)
+
+	testscases := map[string]struct {
+		path      string
+		token     string
+		wantRoute string
+		wantUser  interface{}
+		wantRole  interface{}
+	}{
+		"successful request fields without user logged in": {
+			path:      "/v1/travels/12",
+			wantRoute: "/v1/travels/:id",
+		},
+		"successful request fields with user logged in": {
+			path:      "/v1/me",
+			token:     token,
+			wantRoute: "/v1/me",
+			wantUser:  int64(7),
+			wantRole:  user.RoleDispatcher,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			logger.entries = nil
+
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+			req.Header.Set(RequestIDHeader, "a-request")
+			if tc.token != "" {
+				req.Header.Set("Authorization", "Bearer "+tc.token)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, http.StatusNoContent, w.Code)
+			if !assert.Len(t, logger.entries, 1) {
+				return
+			}
+
+			fields := logger.entries[0].fields
+			assert.Equal(t, "a-request", fields["request_id"])
+			assert.Equal(t, tc.wantRoute, fields["request_route"])
+			assert.Equal(t, tc.wantUser, fields["request_user_id"])
+			assert.Equal(t, tc.wantRole, fields["request_role"])
+			// the fields of the line are kept
+			assert.Equal(t, int64(3), fields["user_id"])
+		})
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"net/http"
+	"strings"
+)
+
+// fieldsParam is the query param with the comma separated attributes to answer of each listed item, as
+// ?fields=id,email
+const fieldsParam = "fields"
+
+// shapeFields return the items (a slice) with only the top level attributes received on the fields query param, so
+// clients can ask for smaller responses. Unknown attributes are ignored, and the items are returned as received when
+// the param is not received
+func shapeFields(c *gin.Context, items interface{}) (interface{}, error) {
+	fields := requestedFields(c)
+	if len(fields) == 0 {
+		return items, nil
+	}
+
+	raw, err := json.Marshal(items)
+	if err != nil {
+		return nil, err
+	}
+
+	var full []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &full); err != nil {
+		return nil, err
+	}
+
+	shaped := make([]map[string]json.RawMessage, 0, len(full))
+	for _, item := range full {
+		shapedItem := make(map[string]json.RawMessage, len(fields))
+		for _, field := range fields {
+			if value, ok := item[field]; ok {
+				shapedItem[field] = value
+			}
+		}
+
+		shaped = append(shaped, shapedItem)
+	}
+
+	return shaped, nil
+}
+
+// shapeFieldsError answer the error of shapeFields as an unexpected error, it is never caused by the request but by
+// items which cannot be encoded, so its detail is only logged
+func shapeFieldsError(c *gin.Context, err error) {
+	log.Error(c, "there was an error shaping the fields of the response", log.Err(err))
+
+	c.JSON(http.StatusInternalServerError, apiError{
+		Code:      "unexpected_error",
+		Message:   "there was an unexpected error, contact support with the request id",
+		RequestID: c.GetString(log.RequestIDKey),
+	})
+}
+
+// requestedFields return the attributes received on the fields query param, without empty values
+func requestedFields(c *gin.Context) []string {
+	if c.Request.URL == nil {
+		return nil
+	}
+
+	var fields []string
+	for _, field := range strings.Split(c.Query(fieldsParam), ",") {
+		if field = strings.TrimSpace(field); field != "" {
+			fields = append(fields, field)
+		}
+	}
+
+	return fields
+}
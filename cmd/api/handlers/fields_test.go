@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_shapeFields(t *testing.T) {
+	items := []map[string]interface{}{{"id": 1, "email": "a@a.com", "role": "driver"}}
+
+	testscases := map[string]struct {
+		items     interface{}
+		url       string
+		want      interface{}
+		wantError bool
+	}{
+		"successful items as received without fields": {
+			items: items,
+			url:   "/v1/users",
+			want:  items,
+		},
+		"successful items with the fields received": {
+			items: items,
+			url:   "/v1/users?fields=id,%20email,,unknown",
+			want:  []map[string]json.RawMessage{{"id": json.RawMessage(`1`), "email": json.RawMessage(`"a@a.com"`)}},
+		},
+		"error items which cannot be encoded": {
+			items:     []map[string]interface{}{{"id": make(chan int)}},
+			url:       "/v1/users?fields=id",
+			wantError: true,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest(http.MethodGet, tc.url, nil)
+
+			shaped, err := shapeFields(c, tc.items)
+
+			if tc.wantError {
+				assert.NotNil(t, err)
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, shaped)
+		})
+	}
+}
+
+func Test_shapeFieldsError(t *testing.T) {
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = httptest.NewRequest(http.MethodGet, "/v1/users?fields=id", nil)
+	c.Set(log.RequestIDKey, "a-request-id")
+
+	_, err := shapeFields(c, []map[string]interface{}{{"id": make(chan int)}})
+	shapeFieldsError(c, err)
+
+	// the encoding error is not returned, it is not caused by the request
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+	assert.JSONEq(t, `{"code": "unexpected_error", "message": "there was an unexpected error, contact support with `+
+		`the request id", "request_id": "a-request-id"}`, w.Body.String())
+}
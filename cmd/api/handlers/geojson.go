@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/travel"
+	"strings"
+)
+
+const (
+	geoJSONFormat    = "geojson"
+	geoJSONMediaType = "application/geo+json"
+)
+
+// geoJSONTravel is a travel with its locations as GeoJSON point geometries
+type geoJSONTravel struct {
+	travel.Travel
+	From travel.GeoJSONPoint `json:"from"`
+	To   travel.GeoJSONPoint `json:"to"`
+}
+
+// geoJSONQuote is a quote with its locations as GeoJSON point geometries
+type geoJSONQuote struct {
+	travel.Quote
+	From travel.GeoJSONPoint `json:"from"`
+	To   travel.GeoJSONPoint `json:"to"`
+}
+
+// wantsGeoJSON return if the request asked for locations as GeoJSON, with the format=geojson query param, accepting
+// application/geo+json or sending its body as application/geo+json
+func wantsGeoJSON(c *gin.Context) bool {
+	if c.Request.URL != nil && c.Query("format") == geoJSONFormat {
+		return true
+	}
+
+	return strings.Contains(c.GetHeader("Accept"), geoJSONMediaType) || c.ContentType() == geoJSONMediaType
+}
+
+// travelView return the travel to answer, with its locations as GeoJSON if the request asked for it
+func travelView(c *gin.Context, trv travel.Travel) interface{} {
+	if !wantsGeoJSON(c) {
+		return trv
+	}
+
+	return geoJSONTravel{Travel: trv, From: trv.From.GeoJSON(), To: trv.To.GeoJSON()}
+}
+
+// travelsView return the travels to answer, with their locations as GeoJSON if the request asked for it
+func travelsView(c *gin.Context, travels []travel.Travel) interface{} {
+	if !wantsGeoJSON(c) {
+		return travels
+	}
+
+	views := make([]geoJSONTravel, 0, len(travels))
+	for _, trv := range travels {
+		views = append(views, geoJSONTravel{Travel: trv, From: trv.From.GeoJSON(), To: trv.To.GeoJSON()})
+	}
+
+	return views
+}
+
+// quoteView return the quote to answer, with its locations as GeoJSON if the request asked for it
+func quoteView(c *gin.Context, quote travel.Quote) interface{} {
+	if !wantsGeoJSON(c) {
+		return quote
+	}
+
+	return geoJSONQuote{Quote: quote, From: quote.From.GeoJSON(), To: quote.To.GeoJSON()}
+}
@@ -0,0 +1,46 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"net/http"
+)
+
+// LogLevel is the minimum level of the lines written by the api logger
+type LogLevel struct {
+	Level string `json:"level" binding:"required"`
+}
+
+type LogHandler struct{}
+
+// UpdateLevel handler will change the level of the api logs at runtime (until the next restart, when LOG_LEVEL is
+// used), so production can be debugged without a redeploy. Every change is logged on the audit log
+func (h LogHandler) UpdateLevel(c *gin.Context) {
+	var update LogLevel
+	if err := c.ShouldBindJSON(&update); err != nil {
+		log.ErrorLimited(c, "there was an error parsing log level update request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	previous := log.Level()
+	if err := log.SetLevel(update.Level); err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_log_level",
+			Message: err.Error(),
+		})
+		return
+	}
+
+	fields := []log.Field{log.String("previous_level", previous), log.String("level", log.Level())}
+	if userLogged, ok := c.Value("user_on_call").(jwt.Claims); ok {
+		fields = append(fields, log.Int64("logged_user_id", userLogged.UserID))
+	}
+	// the audit lines are written whatever the new level is
+	auditlog.Log(c, "log level changed", fields...)
+
+	c.JSON(http.StatusOK, LogLevel{Level: log.Level()})
+}
@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func Test_updateLogLevel(t *testing.T) {
+	defer func() { _ = log.SetLevel(log.DefaultLevel) }()
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.PUT("/admin/log-level", LogHandler{}.UpdateLevel)
+
+	testscases := map[string]struct {
+		body           string
+		want           string
+		wantCode       string
+		statusExpected int
+	}{
+		"successful changed level to debug": {
+			body:           `{"level": "debug"}`,
+			want:           "debug",
+			statusExpected: http.StatusOK,
+		},
+		"successful changed level to warn": {
+			body:           `{"level": "warn"}`,
+			want:           "warn",
+			statusExpected: http.StatusOK,
+		},
+		"error unknown level": {
+			body:           `{"level": "verbose"}`,
+			want:           "warn",
+			wantCode:       "invalid_log_level",
+			statusExpected: http.StatusBadRequest,
+		},
+		"error level which stops the api": {
+			body:           `{"level": "fatal"}`,
+			want:           "warn",
+			wantCode:       "invalid_log_level",
+			statusExpected: http.StatusBadRequest,
+		},
+		"error missing level": {
+			body:           `{}`,
+			want:           "warn",
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+	}
+
+	// the cases change the level in order
+	for _, name := range []string{"successful changed level to debug", "successful changed level to warn",
+		"error unknown level", "error level which stops the api", "error missing level"} {
+		tc := testscases[name]
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodPut, "/admin/log-level", strings.NewReader(tc.body))
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+			assert.Equal(t, tc.want, log.Level())
+
+			var resp map[string]interface{}
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			if tc.statusExpected == http.StatusOK {
+				assert.Equal(t, tc.want, resp["level"])
+			}
+			if tc.wantCode != "" {
+				assert.Equal(t, tc.wantCode, resp["code"])
+			}
+		})
+	}
+}
@@ -0,0 +1,221 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"os"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// DefaultLanguage is the language of the messages of the errors written on code, they are returned when the
+// caller does not accept any of the languages of the messages
+const DefaultLanguage = "en"
+
+// languageFormat are the languages accepted on the messages file, as es or pt-br
+var languageFormat = regexp.MustCompile(`^[a-z]{2,3}(-[a-z0-9]{2,8})?$`)
+
+// Messages are the error messages translated to other languages, by language and error code. The codes
+// are kept as they are, so the clients can still handle the errors by code
+type Messages map[string]map[string]string
+
+// messageKeySeparator separate the code from the english message on the keys of the messages of the errors which
+// share their code with other errors, as invalid_status:the travel is not queued
+const messageKeySeparator = ":"
+
+// message return the translated message of the error with the received code and english message: the one of the
+// code and message, so the errors which share a code keep distinct messages, or the one of the code
+func message(messages map[string]string, code, english string) (string, bool) {
+	if translated, ok := messages[code+messageKeySeparator+english]; ok {
+		return translated, true
+	}
+
+	translated, ok := messages[code]
+	return translated, ok
+}
+
+// LoadMessages return the messages configured on the JSON file of the path, an object with the descriptions of each
+// language by error code, as {"es": {"not_found_travel": "no se encontró el viaje"}}. The errors which share a code
+// are translated by code and english message, as {"es": {"invalid_status:the travel is not queued": "el viaje no está
+// en cola"}}, the ones without it get the description of their code. It fails if any language is not a valid language
+// tag or any description is empty
+func LoadMessages(path string) (Messages, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var configured Messages
+	if err := json.NewDecoder(file).Decode(&configured); err != nil {
+		return nil, fmt.Errorf("cannot parse messages file %s: %w", path, err)
+	}
+
+	messages := Messages{}
+	for language, descriptions := range configured {
+		tag := strings.ToLower(language)
+		if !languageFormat.MatchString(tag) {
+			return nil, fmt.Errorf("invalid messages language %s: it should be a language tag as es or pt-br", language)
+		}
+
+		for code, description := range descriptions {
+			if strings.TrimSpace(description) == "" {
+				return nil, fmt.Errorf("invalid %s message %s: it has no description", language, code)
+			}
+		}
+
+		messages[tag] = descriptions
+	}
+
+	return messages, nil
+}
+
+// Language return the language of the messages to answer to the received Accept-Language header, the one with the
+// highest quality which has messages (as es for es-AR when there are no es-ar messages), or DefaultLanguage
+func (m Messages) Language(acceptLanguage string) string {
+	for _, tag := range acceptedLanguages(acceptLanguage) {
+		if tag == "*" {
+			return DefaultLanguage
+		}
+
+		candidates := []string{tag}
+		if i := strings.Index(tag, "-"); i > 0 {
+			candidates = append(candidates, tag[:i])
+		}
+
+		for _, candidate := range candidates {
+			if candidate == DefaultLanguage {
+				return DefaultLanguage
+			}
+			if _, ok := m[candidate]; ok {
+				return candidate
+			}
+		}
+	}
+
+	return DefaultLanguage
+}
+
+// acceptedLanguages return the languages of the Accept-Language header ordered by their quality, the ones with
+// quality 0 are not accepted
+func acceptedLanguages(acceptLanguage string) []string {
+	type accepted struct {
+		tag     string
+		quality float64
+	}
+
+	var languages []accepted
+	for _, part := range strings.Split(acceptLanguage, ",") {
+		params := strings.Split(part, ";")
+		tag := strings.ToLower(strings.TrimSpace(params[0]))
+		if tag == "" {
+			continue
+		}
+
+		quality := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				q, err := strconv.ParseFloat(strings.TrimPrefix(param, "q="), 64)
+				if err != nil {
+					q = 0
+				}
+				quality = q
+			}
+		}
+
+		if quality > 0 {
+			languages = append(languages, accepted{tag: tag, quality: quality})
+		}
+	}
+
+	sort.SliceStable(languages, func(i, j int) bool {
+		return languages[i].quality > languages[j].quality
+	})
+
+	tags := make([]string, 0, len(languages))
+	for _, language := range languages {
+		tags = append(tags, language.tag)
+	}
+
+	return tags
+}
+
+// Localize middleware translate the messages of the error responses (the apiError of the handlers) to the language
+// of the Accept-Language header of the request, using the messages of the error code and message (see LoadMessages).
+// The errors without message on the language keep their english one, and the codes are never changed
+func Localize(messages Messages) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Header("Vary", "Accept-Language")
+
+		language := messages.Language(ctx.GetHeader("Accept-Language"))
+		if language == DefaultLanguage {
+			ctx.Next()
+			return
+		}
+
+		ctx.Writer = &localizeWriter{ResponseWriter: ctx.Writer, language: language, messages: messages[language]}
+
+		ctx.Next()
+	}
+}
+
+// localizeWriter replace the message of the JSON objects written as error responses (status 400 and above) with the
+// translated message of their code and message
+type localizeWriter struct {
+	gin.ResponseWriter
+	language string
+	messages map[string]string
+}
+
+func (w *localizeWriter) Write(body []byte) (int, error) {
+	if w.Status() < http.StatusBadRequest || !strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(body)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil {
+		return w.ResponseWriter.Write(body)
+	}
+
+	var code string
+	if err := json.Unmarshal(fields["code"], &code); err != nil {
+		return w.ResponseWriter.Write(body)
+	}
+
+	var english string
+	if err := json.Unmarshal(fields["message"], &english); err != nil {
+		return w.ResponseWriter.Write(body)
+	}
+
+	translated, ok := message(w.messages, code, english)
+	if !ok {
+		return w.ResponseWriter.Write(body)
+	}
+
+	localized, err := json.Marshal(translated)
+	if err != nil {
+		return w.ResponseWriter.Write(body)
+	}
+	fields["message"] = localized
+
+	var localizedBody bytes.Buffer
+	encoder := json.NewEncoder(&localizedBody)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(fields); err != nil {
+		return w.ResponseWriter.Write(body)
+	}
+
+	w.Header().Set("Content-Language", w.language)
+	if _, err := w.ResponseWriter.Write(bytes.TrimSpace(localizedBody.Bytes())); err != nil {
+		return 0, err
+	}
+
+	// the caller wrote the whole body
+	return len(body), nil
+}
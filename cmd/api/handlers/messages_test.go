@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/travel"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func Test_loadMessages(t *testing.T) {
+	dir := t.TempDir()
+
+	testscases := map[string]struct {
+		content   string
+		want      Messages
+		wantError error
+	}{
+		"successful loaded messages": {
+			content: `{"es": {"not_found_travel": "no se encontró el viaje"}, "pt-BR": {"not_found_travel": "a viagem não foi encontrada"}}`,
+			want: Messages{
+				"es":    {"not_found_travel": "no se encontró el viaje"},
+				"pt-br": {"not_found_travel": "a viagem não foi encontrada"},
+			},
+		},
+
+		"failure due to invalid language": {
+			content:   `{"spanish!": {"not_found_travel": "no se encontró el viaje"}}`,
+			wantError: errors.New("invalid messages language spanish!: it should be a language tag as es or pt-br"),
+		},
+
+		"failure due to message without description": {
+			content:   `{"es": {"not_found_travel": " "}}`,
+			wantError: errors.New("invalid es message not_found_travel: it has no description"),
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "messages.json")
+			err := ioutil.WriteFile(path, []byte(tc.content), 0600)
+			assert.Nil(t, err)
+
+			messages, err := LoadMessages(path)
+			if tc.wantError != nil {
+				assert.Equal(t, tc.wantError.Error(), err.Error())
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, messages)
+		})
+	}
+}
+
+func Test_messagesFile(t *testing.T) {
+	messages, err := LoadMessages("../../../config/messages.json")
+	assert.Nil(t, err)
+
+	// every language translates the same errors
+	for language, descriptions := range messages {
+		assert.Equal(t, len(messages["es"]), len(descriptions), language)
+		for code := range messages["es"] {
+			assert.NotEmpty(t, descriptions[code], language+" "+code)
+		}
+	}
+}
+
+func Test_localize(t *testing.T) {
+	messages := Messages{
+		"es": {"not_found_travel": "no se encontró el viaje"},
+		"pt": {"not_found_travel": "a viagem não foi encontrada"},
+	}
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.Use(RequestID(), Localize(messages))
+	router.GET("/v1/travels/:id", func(c *gin.Context) {
+		if c.Param("id") == "1" {
+			c.JSON(http.StatusOK, gin.H{"id": 1, "message": "a travel"})
+			return
+		}
+		c.JSON(http.StatusNotFound, apiError{Code: "not_found_travel", Message: "not founded the travel to get"})
+	})
+	router.GET("/v1/users/:id", func(c *gin.Context) {
+		c.JSON(http.StatusNotFound, apiError{Code: "not_found_user", Message: "not founded the user to get"})
+	})
+
+	testscases := map[string]struct {
+		path           string
+		acceptLanguage string
+		wantMessage    string
+		wantLanguage   string
+	}{
+		"successful localized message": {
+			path:           "/v1/travels/2",
+			acceptLanguage: "es-AR,es;q=0.9,en;q=0.8",
+			wantMessage:    "no se encontró el viaje",
+			wantLanguage:   "es",
+		},
+		"successful localized message on the language with the highest quality": {
+			path:           "/v1/travels/2",
+			acceptLanguage: "fr, es;q=0.5, pt;q=0.8",
+			wantMessage:    "a viagem não foi encontrada",
+			wantLanguage:   "pt",
+		},
+		"successful default message when english is preferred": {
+			path:           "/v1/travels/2",
+			acceptLanguage: "en-US, es;q=0.5",
+			wantMessage:    "not founded the travel to get",
+		},
+		"successful default message when the language is not accepted": {
+			path:           "/v1/travels/2",
+			acceptLanguage: "es;q=0",
+			wantMessage:    "not founded the travel to get",
+		},
+		"successful default message without accepted language": {
+			path:        "/v1/travels/2",
+			wantMessage: "not founded the travel to get",
+		},
+		"successful default message of an error without message": {
+			path:           "/v1/users/2",
+			acceptLanguage: "es",
+			wantMessage:    "not founded the user to get",
+		},
+		"successful not localized success response": {
+			path:           "/v1/travels/1",
+			acceptLanguage: "es",
+			wantMessage:    "a travel",
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.acceptLanguage != "" {
+				req.Header.Set("Accept-Language", tc.acceptLanguage)
+			}
+			router.ServeHTTP(w, req)
+
+			var resp map[string]interface{}
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, tc.wantMessage, resp["message"])
+			assert.Equal(t, tc.wantLanguage, w.Header().Get("Content-Language"))
+			if w.Code != http.StatusOK {
+				// the codes are not localized, and the request id is still added
+				assert.Contains(t, []interface{}{"not_found_travel", "not_found_user"}, resp["code"])
+				assert.Equal(t, w.Header().Get(RequestIDHeader), resp["request_id"])
+			}
+		})
+	}
+}
+
+func Test_localizeSharedCode(t *testing.T) {
+	messages, err := LoadMessages("../../../config/messages.json")
+	assert.Nil(t, err)
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.Use(Localize(messages))
+	router.GET("/v1/errors/:name", func(c *gin.Context) {
+		errs := map[string]code_error.Error{
+			"queue":   travel.ErrInvalidStatusToQueue,
+			"dequeue": travel.ErrInvalidStatusToDequeue,
+			"other":   {Code: travel.ErrInvalidStatusToQueue.Code, Detail: "a message without translation"},
+		}
+		err := errs[c.Param("name")]
+		c.JSON(http.StatusBadRequest, apiError{Code: err.Code, Message: err.Detail})
+	})
+
+	testscases := map[string]struct {
+		name        string
+		wantMessage string
+	}{
+		"successful message of the queue error": {
+			name:        "queue",
+			wantMessage: "solo los viajes pendientes sin usuario pueden ponerse en cola",
+		},
+		"successful message of the dequeue error with the same code": {
+			name:        "dequeue",
+			wantMessage: "el viaje no está en cola",
+		},
+		"successful message of the code of an error without its own message": {
+			name:        "other",
+			wantMessage: messages["es"]["invalid_status"],
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, "/v1/errors/"+tc.name, nil)
+			req.Header.Set("Accept-Language", "es")
+			router.ServeHTTP(w, req)
+
+			var resp map[string]interface{}
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, "invalid_status", resp["code"])
+			assert.Equal(t, tc.wantMessage, resp["message"])
+		})
+	}
+}
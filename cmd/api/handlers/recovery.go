@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"io/ioutil"
+	"net/http"
+	"runtime/debug"
+)
+
+const panicsMetric = "application.space.api.panics"
+
+// Recovery middleware recover the panics of the requests handled after it, answering a generic unexpected_error (the
+// panic value can have internal data, so it is never returned) with the request id, so the users can quote it. The
+// panic is logged with its stack trace and counted by route
+func Recovery() gin.HandlerFunc {
+	// gin writes its own panic lines, they are discarded as the panics are logged with the logger of the request
+	return gin.CustomRecoveryWithWriter(ioutil.Discard, recoverPanic)
+}
+
+func recoverPanic(ctx *gin.Context, err interface{}) {
+	route := ctx.FullPath()
+
+	log.Error(ctx, "there was a panic handling the request", log.String("route", route),
+		log.String("panic", fmt.Sprint(err)), log.String("stack", string(debug.Stack())))
+	metrics.Inc(ctx, panicsMetric, []string{"route", route})
+
+	ctx.AbortWithStatusJSON(http.StatusInternalServerError, apiError{
+		Code:      "unexpected_error",
+		Message:   "there was an unexpected error, contact support with the request id",
+		RequestID: ctx.GetString(log.RequestIDKey),
+	})
+}
@@ -0,0 +1,57 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_recovery(t *testing.T) {
+	logger := &recordLogger{}
+	previous := log.DefaultLogger
+	log.DefaultLogger = logger
+	defer func() { log.DefaultLogger = previous }()
+
+	collector := metrics.NewPrometheus()
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.Use(Recovery(), RequestID())
+	router.Use(func(c *gin.Context) {
+		c.Set(metrics.CollectorKey, collector)
+	})
+	router.GET("/v1/travels/:id", func(c *gin.Context) {
+		panic("cannot connect to db user:a-password@tcp(db:3306)")
+	})
+
+	req, _ := http.NewRequest(http.MethodGet, "/v1/travels/7", nil)
+	req.Header.Set(RequestIDHeader, "a-request")
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusInternalServerError, w.Code)
+
+	// the panic value is not returned
+	var resp apiError
+	assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, apiError{Code: "unexpected_error",
+		Message: "there was an unexpected error, contact support with the request id", RequestID: "a-request"}, resp)
+
+	if assert.Len(t, logger.entries, 1) {
+		entry := logger.entries[0]
+		assert.Equal(t, "error", entry.level)
+		assert.Equal(t, "/v1/travels/:id", entry.fields["route"])
+		assert.Equal(t, "cannot connect to db user:a-password@tcp(db:3306)", entry.fields["panic"])
+		assert.Contains(t, entry.fields["stack"], "recoverPanic")
+	}
+
+	metricsW := httptest.NewRecorder()
+	collector.Handler().ServeHTTP(metricsW, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+	body, _ := ioutil.ReadAll(metricsW.Body)
+	assert.Contains(t, string(body), `application_space_api_panics_total{route="/v1/travels/:id"} 1`)
+}
@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/uuid"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// RequestIDHeader is the header with the id of the request, received from the caller or generated and returned on
+// every response
+const RequestIDHeader = "X-Request-ID"
+
+// requestIDFormat are the ids received from the callers which are kept, the others are replaced with a generated one
+var requestIDFormat = regexp.MustCompile(`^[A-Za-z0-9._:-]{1,128}$`)
+
+// RequestID middleware identify every request with the id received on the X-Request-ID header, or a generated uuid
+// when it is missing or invalid. The id is stored on context, so every log line written while the request is handled
+// has it, and it is returned on the X-Request-ID header and on the error responses, so the users can quote it
+func RequestID() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		requestID := ctx.GetHeader(RequestIDHeader)
+		if !requestIDFormat.MatchString(requestID) {
+			generated, err := uuid.New()
+			if err != nil {
+				log.Error(ctx, "there was an error generating the request id", log.Err(err))
+			}
+			requestID = generated
+		}
+
+		ctx.Set(log.RequestIDKey, requestID)
+		ctx.Header(RequestIDHeader, requestID)
+		ctx.Writer = &requestIDWriter{ResponseWriter: ctx.Writer, requestID: requestID}
+
+		ctx.Next()
+	}
+}
+
+// requestIDWriter set the request id to the JSON objects written as error responses (status 400 and above) without
+// it, as the apiError of the handlers and the panic recover
+type requestIDWriter struct {
+	gin.ResponseWriter
+	requestID string
+}
+
+func (w *requestIDWriter) Write(body []byte) (int, error) {
+	if w.Status() < http.StatusBadRequest || w.requestID == "" ||
+		!strings.HasPrefix(w.Header().Get("Content-Type"), "application/json") {
+		return w.ResponseWriter.Write(body)
+	}
+
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(body, &fields); err != nil || fields == nil {
+		return w.ResponseWriter.Write(body)
+	}
+
+	var current string
+	if json.Unmarshal(fields["request_id"], &current) == nil && current != "" {
+		return w.ResponseWriter.Write(body)
+	}
+
+	id, err := json.Marshal(w.requestID)
+	if err != nil {
+		return w.ResponseWriter.Write(body)
+	}
+	fields["request_id"] = id
+
+	var withID bytes.Buffer
+	encoder := json.NewEncoder(&withID)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(fields); err != nil {
+		return w.ResponseWriter.Write(body)
+	}
+
+	if _, err := w.ResponseWriter.Write(bytes.TrimSpace(withID.Bytes())); err != nil {
+		return 0, err
+	}
+
+	// the caller wrote the whole body
+	return len(body), nil
+}
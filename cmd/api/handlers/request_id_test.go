@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/uuid"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_requestID(t *testing.T) {
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.Use(gin.CustomRecovery(func(c *gin.Context, err interface{}) {
+		c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{"code": "unexpected_error"})
+	}))
+	router.Use(RequestID())
+	router.GET("/ok", func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"request_id_on_context": c.GetString(log.RequestIDKey)})
+	})
+	router.GET("/fail", func(c *gin.Context) {
+		c.JSON(http.StatusBadRequest, apiError{Code: "invalid_data", Message: "invalid data"})
+	})
+	router.GET("/panic", func(c *gin.Context) {
+		panic("unexpected")
+	})
+
+	testscases := map[string]struct {
+		path           string
+		requestID      string
+		keepRequestID  bool
+		bodyRequestID  string
+		statusExpected int
+	}{
+		"successful generated request id": {
+			path:           "/ok",
+			bodyRequestID:  "request_id_on_context",
+			statusExpected: http.StatusOK,
+		},
+		"successful kept request id of the caller": {
+			path:           "/ok",
+			requestID:      "5f0c3e2a-checkout.42",
+			keepRequestID:  true,
+			bodyRequestID:  "request_id_on_context",
+			statusExpected: http.StatusOK,
+		},
+		"successful replaced invalid request id of the caller": {
+			path:           "/ok",
+			requestID:      "<script>alert(1)</script>",
+			bodyRequestID:  "request_id_on_context",
+			statusExpected: http.StatusOK,
+		},
+		"successful request id on error response": {
+			path:           "/fail",
+			requestID:      "a-request",
+			keepRequestID:  true,
+			bodyRequestID:  "request_id",
+			statusExpected: http.StatusBadRequest,
+		},
+		"successful request id on panic response": {
+			path:           "/panic",
+			bodyRequestID:  "request_id",
+			statusExpected: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+			if tc.requestID != "" {
+				req.Header.Set(RequestIDHeader, tc.requestID)
+			}
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			requestID := w.Header().Get(RequestIDHeader)
+			if tc.keepRequestID {
+				assert.Equal(t, tc.requestID, requestID)
+			} else {
+				assert.True(t, uuid.Valid(requestID))
+			}
+
+			var resp map[string]interface{}
+			assert.Nil(t, json.Unmarshal(w.Body.Bytes(), &resp))
+			assert.Equal(t, requestID, resp[tc.bodyRequestID])
+			if tc.statusExpected != http.StatusOK {
+				assert.NotEmpty(t, resp["code"])
+			}
+		})
+	}
+}
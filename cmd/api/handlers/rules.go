@@ -0,0 +1,196 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/authorization"
+	"github.com/nicocarolo/space-drivers/internal/user"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+)
+
+// configuredRule is a rule as it is configured on the rules file: the permissions accepted to access a path (as it is
+// registered on the router, e.g. /v1/users/:id) with a method
+type configuredRule struct {
+	Method      string   `json:"method"`
+	Path        string   `json:"path"`
+	Permissions []string `json:"permissions"`
+}
+
+// wildcard matches any method on rules, and any path segment (or every remaining segment, at the end) on their paths
+const wildcard = "*"
+
+// methods are the http methods accepted on rules
+var methods = map[string]bool{
+	wildcard:          true,
+	http.MethodGet:    true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// LoadRules return the rules configured on the JSON file of the path, a list of rules as
+// {"method": "GET", "path": "/v1/users/:id", "permissions": ["user:read"]}, the method and path segments can be
+// wildcards (see matchRule). It fails if any rule has an unknown method or permission, or a path which is not absolute
+func LoadRules(path string) (Rules, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var configured []configuredRule
+	decoder := json.NewDecoder(file)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&configured); err != nil {
+		return nil, fmt.Errorf("cannot parse rules file %s: %w", path, err)
+	}
+
+	r := Rules{}
+	for _, cr := range configured {
+		if !methods[cr.Method] {
+			return nil, fmt.Errorf("invalid rule %s %s: unknown method", cr.Method, cr.Path)
+		}
+		if !strings.HasPrefix(cr.Path, "/") {
+			return nil, fmt.Errorf("invalid rule %s %s: the path should start with /", cr.Method, cr.Path)
+		}
+		if len(cr.Permissions) == 0 {
+			return nil, fmt.Errorf("invalid rule %s %s: it has no permissions", cr.Method, cr.Path)
+		}
+
+		for _, permission := range cr.Permissions {
+			if !user.ValidPermission(permission) {
+				return nil, fmt.Errorf("invalid rule %s %s: unknown permission %s", cr.Method, cr.Path, permission)
+			}
+
+			r.AddRule(newRule(cr.Path, cr.Method, permission))
+		}
+	}
+
+	return r, nil
+}
+
+// Validate check the rules against the routes registered on the router: every rule should match a route and every
+// route should have a rule, except the public ones (as "POST /v1/login"), which do not authorize the requests. It
+// return an error with every mismatch, so a typo on the rules is found on start instead of denying the route
+func (r Rules) Validate(routes gin.RoutesInfo, public ...string) error {
+	isPublic := make(map[string]bool, len(public))
+	for _, route := range public {
+		isPublic[route] = true
+	}
+
+	var mismatches []string
+	for _, route := range routes {
+		if len(r.accepted(route.Method, route.Path)) == 0 && !isPublic[route.Method+" "+route.Path] {
+			mismatches = append(mismatches, fmt.Sprintf("the route %s %s has no rule", route.Method, route.Path))
+		}
+	}
+
+	for method, paths := range r {
+		for path := range paths {
+			matched := false
+			for _, route := range routes {
+				if matchRule(method, path, route.Method, route.Path) {
+					matched = true
+					break
+				}
+			}
+
+			if !matched {
+				mismatches = append(mismatches, fmt.Sprintf("the rule %s %s does not match any route", method, path))
+			}
+		}
+	}
+
+	if len(mismatches) > 0 {
+		sort.Strings(mismatches)
+		return errors.New(strings.Join(mismatches, ", "))
+	}
+
+	return nil
+}
+
+// StoredRulesLister return the authorization rules managed at runtime
+type StoredRulesLister interface {
+	List(ctx context.Context) ([]authorization.Rule, error)
+}
+
+// StoredRules is a Ruler with the rules configured on start and the ones managed at runtime, which can only grant
+// access to more permissions
+type StoredRules struct {
+	Rules  Rules
+	Stored StoredRulesLister
+}
+
+// CanAccess will return 'true' when the configured rules accept any of the permissions (see Rules.CanAccess) or
+// any stored rule matching the method and path accepts one of them. The stored rules are ignored if they cannot be
+// got
+func (r StoredRules) CanAccess(method, path string, permissions user.Permissions) bool {
+	if r.Rules.CanAccess(method, path, permissions) {
+		return true
+	}
+
+	stored, err := r.Stored.List(context.Background())
+	if err != nil {
+		return false
+	}
+
+	for _, rule := range stored {
+		if matchRule(rule.Method, rule.Path, method, path) && permissions.Has(rule.Permission) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// accepted return the permissions accepted by every rule matching the method and path
+func (r Rules) accepted(method, path string) []string {
+	var accepted []string
+	for ruleMethod, paths := range r {
+		for rulePath, permissions := range paths {
+			if matchRule(ruleMethod, rulePath, method, path) {
+				accepted = append(accepted, permissions...)
+			}
+		}
+	}
+
+	return accepted
+}
+
+// matchRule return if the rule with ruleMethod and rulePath applies to the method and path (as it is registered on
+// the router). The * method matches every method, and a * segment of the path matches any segment, or every
+// remaining segment when it is the last one: /v1/travels/* matches /v1/travels/:id and /v1/travels/:id/rating, but
+// not /v1/travels
+func matchRule(ruleMethod, rulePath, method, path string) bool {
+	if ruleMethod != wildcard && ruleMethod != method {
+		return false
+	}
+
+	ruleSegments := strings.Split(rulePath, "/")
+	segments := strings.Split(path, "/")
+	for i, ruleSegment := range ruleSegments {
+		if i >= len(segments) {
+			return false
+		}
+
+		if ruleSegment == wildcard {
+			if i == len(ruleSegments)-1 {
+				return true
+			}
+			continue
+		}
+
+		if ruleSegment != segments[i] {
+			return false
+		}
+	}
+
+	return len(ruleSegments) == len(segments)
+}
@@ -0,0 +1,187 @@
+package handlers
+
+import (
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func Test_loadRules(t *testing.T) {
+	dir := t.TempDir()
+
+	testscases := map[string]struct {
+		content   string
+		want      Rules
+		wantError error
+	}{
+		"successful loaded rules": {
+			content: `[
+				{"method": "GET", "path": "/v1/users/:id", "permissions": ["user:read", "profile:read"]},
+				{"method": "POST", "path": "/v1/users", "permissions": ["user:write"]}
+			]`,
+			want: Rules{
+				http.MethodGet:  {"/v1/users/:id": {"user:read", "profile:read"}},
+				http.MethodPost: {"/v1/users": {"user:write"}},
+			},
+		},
+
+		"successful loaded wildcard rules": {
+			content: `[{"method": "*", "path": "/v1/users/*", "permissions": ["user:write"]}]`,
+			want:    Rules{wildcard: {"/v1/users/*": {"user:write"}}},
+		},
+
+		"failure due to unknown method": {
+			content:   `[{"method": "GETS", "path": "/v1/users", "permissions": ["user:read"]}]`,
+			wantError: errors.New("invalid rule GETS /v1/users: unknown method"),
+		},
+
+		"failure due to relative path": {
+			content:   `[{"method": "GET", "path": "v1/users", "permissions": ["user:read"]}]`,
+			wantError: errors.New("invalid rule GET v1/users: the path should start with /"),
+		},
+
+		"failure due to rule without permissions": {
+			content:   `[{"method": "GET", "path": "/v1/users"}]`,
+			wantError: errors.New("invalid rule GET /v1/users: it has no permissions"),
+		},
+
+		"failure due to unknown permission": {
+			content:   `[{"method": "GET", "path": "/v1/users", "permissions": ["users:read"]}]`,
+			wantError: errors.New("invalid rule GET /v1/users: unknown permission users:read"),
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, "rules.json")
+			err := ioutil.WriteFile(path, []byte(tc.content), 0600)
+			assert.Nil(t, err)
+
+			rules, err := LoadRules(path)
+			if tc.wantError != nil {
+				assert.Equal(t, tc.wantError.Error(), err.Error())
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, rules)
+		})
+	}
+}
+
+func Test_validateRules(t *testing.T) {
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	noop := func(c *gin.Context) {}
+	router.POST("/v1/login", noop)
+	router.GET("/v1/users", noop)
+	router.GET("/v1/users/:id", noop)
+
+	testscases := map[string]struct {
+		rules     Rules
+		wantError error
+	}{
+		"successful validated rules": {
+			rules: Rules{http.MethodGet: {"/v1/users": {"user:read"}, "/v1/users/:id": {"user:read"}}},
+		},
+
+		"successful validated wildcard rules": {
+			rules: Rules{wildcard: {"/v1/users": {"user:read"}, "/v1/users/*": {"user:read"}}},
+		},
+
+		"failure due to rule and route mismatches": {
+			rules: Rules{
+				http.MethodGet:  {"/v1/users": {"user:read"}},
+				http.MethodPost: {"/v1/user/": {"user:write"}},
+			},
+			wantError: errors.New("the route GET /v1/users/:id has no rule, " +
+				"the rule POST /v1/user/ does not match any route"),
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			err := tc.rules.Validate(router.Routes(), "POST /v1/login")
+			if tc.wantError != nil {
+				assert.Equal(t, tc.wantError.Error(), err.Error())
+				return
+			}
+
+			assert.Nil(t, err)
+		})
+	}
+}
+
+func Test_matchRule(t *testing.T) {
+	testscases := map[string]struct {
+		ruleMethod string
+		rulePath   string
+		method     string
+		path       string
+		want       bool
+	}{
+		"exact rule": {
+			ruleMethod: http.MethodGet,
+			rulePath:   "/v1/travels/:id",
+			method:     http.MethodGet,
+			path:       "/v1/travels/:id",
+			want:       true,
+		},
+
+		"another method": {
+			ruleMethod: http.MethodGet,
+			rulePath:   "/v1/travels/:id",
+			method:     http.MethodPut,
+			path:       "/v1/travels/:id",
+		},
+
+		"wildcard method": {
+			ruleMethod: wildcard,
+			rulePath:   "/v1/travels/:id",
+			method:     http.MethodDelete,
+			path:       "/v1/travels/:id",
+			want:       true,
+		},
+
+		"trailing wildcard matches every remaining segment": {
+			ruleMethod: http.MethodPost,
+			rulePath:   "/v1/travels/*",
+			method:     http.MethodPost,
+			path:       "/v1/travels/:id/rating",
+			want:       true,
+		},
+
+		"trailing wildcard does not match the parent path": {
+			ruleMethod: http.MethodGet,
+			rulePath:   "/v1/travels/*",
+			method:     http.MethodGet,
+			path:       "/v1/travels",
+		},
+
+		"wildcard segment matches one segment": {
+			ruleMethod: http.MethodGet,
+			rulePath:   "/v1/users/*/travels",
+			method:     http.MethodGet,
+			path:       "/v1/users/:id/travels",
+			want:       true,
+		},
+
+		"wildcard segment does not match longer paths": {
+			ruleMethod: http.MethodGet,
+			rulePath:   "/v1/users/*/travels",
+			method:     http.MethodGet,
+			path:       "/v1/users/:id/travels/export",
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, matchRule(tc.ruleMethod, tc.rulePath, tc.method, tc.path))
+		})
+	}
+}
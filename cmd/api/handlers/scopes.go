@@ -0,0 +1,37 @@
+package handlers
+
+import "github.com/nicocarolo/space-drivers/internal/user"
+
+// tokenScopes are the endpoints (method and path) each token scope can access, whatever the permissions the
+// authorization rules accept for them. They are not configurable, so the scoped tokens stay restricted when the rules
+// grow more permissive
+var tokenScopes = map[string]map[string]bool{
+	user.ScopeDriverApp: {
+		"GET /v1/me":                       true,
+		"GET /v1/me/preferences":           true,
+		"PATCH /v1/me/preferences":         true,
+		"GET /v1/me/sessions":              true,
+		"DELETE /v1/me/sessions/:id":       true,
+		"POST /v1/me/2fa":                  true,
+		"POST /v1/me/2fa/verify":           true,
+		"GET /v1/drivers/me/travel":        true,
+		"GET /v1/users/:id/queue":          true,
+		"GET /v1/users/:id/earnings":       true,
+		"GET /v1/travels/:id":              true,
+		"PUT /v1/travels/:id":              true,
+		"POST /v1/travels/:id/accept":      true,
+		"POST /v1/travels/:id/reject":      true,
+		"POST /v1/travels/:id/attachments": true,
+		"POST /v1/travels/:id/locations":   true,
+	},
+}
+
+// inScope return if a token with the scope can access to the path (route) with the http method, tokens without scope
+// can access any of them and an unknown scope cannot access any
+func inScope(scope, method, path string) bool {
+	if scope == "" {
+		return true
+	}
+
+	return tokenScopes[scope][method+" "+path]
+}
@@ -0,0 +1,252 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/team"
+	"net/http"
+	"strconv"
+)
+
+type TeamsStorage interface {
+	Get(ctx context.Context, id int64) (team.Team, error)
+	List(ctx context.Context) ([]team.Team, error)
+	Save(ctx context.Context, team team.Team) (team.Team, error)
+	Update(ctx context.Context, team team.Team) (team.Team, error)
+	Delete(ctx context.Context, id int64) error
+	Members(ctx context.Context, id int64) (team.TeamMembers, error)
+	AddMember(ctx context.Context, id int64, userID int64) error
+	RemoveMember(ctx context.Context, id int64, userID int64) error
+}
+
+type TeamHandler struct {
+	Teams TeamsStorage
+}
+
+// Get handler will parse received id as url param and get the team from storage
+func (h TeamHandler) Get(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a team id to get",
+		})
+		return
+	}
+
+	teamResp, err := h.Teams.Get(c, id)
+	if err != nil {
+		code, resp := mapTeamError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, teamResp)
+}
+
+// List handler will get all the teams from storage
+func (h TeamHandler) List(c *gin.Context) {
+	teams, err := h.Teams.List(c)
+	if err != nil {
+		code, resp := mapTeamError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	if teams == nil {
+		teams = []team.Team{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": teams})
+}
+
+// Create handler will parse received body and save it to storage
+func (h TeamHandler) Create(c *gin.Context) {
+	var teamToCreate team.Team
+	if err := c.ShouldBindJSON(&teamToCreate); err != nil {
+		log.ErrorLimited(c, "there was an error parsing team create request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	createdTeam, err := h.Teams.Save(c, teamToCreate)
+	if err != nil {
+		code, resp := mapTeamError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, createdTeam)
+}
+
+// Edit handler will parse received body and id and replace the team name on storage
+func (h TeamHandler) Edit(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a team id to edit",
+		})
+		return
+	}
+
+	var teamToEdit team.Team
+	if err := c.ShouldBindJSON(&teamToEdit); err != nil {
+		log.ErrorLimited(c, "there was an error parsing team edit request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+	teamToEdit.ID = id
+
+	editedTeam, err := h.Teams.Update(c, teamToEdit)
+	if err != nil {
+		code, resp := mapTeamError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, editedTeam)
+}
+
+// Delete handler will remove the team with the received id from storage
+func (h TeamHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a team id to delete",
+		})
+		return
+	}
+
+	if err := h.Teams.Delete(c, id); err != nil {
+		code, resp := mapTeamError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Members handler will get the members of the team with the received id
+func (h TeamHandler) Members(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a team id to get members",
+		})
+		return
+	}
+
+	members, err := h.Teams.Members(c, id)
+	if err != nil {
+		code, resp := mapTeamError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, members)
+}
+
+// AddMember handler will parse received body and id and add the driver or dispatcher to the team, it return the
+// members of the team
+func (h TeamHandler) AddMember(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a team id to add member",
+		})
+		return
+	}
+
+	var member struct {
+		UserID int64 `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&member); err != nil {
+		log.ErrorLimited(c, "there was an error parsing team member request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	if err := h.Teams.AddMember(c, id, member.UserID); err != nil {
+		code, resp := mapTeamError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	members, err := h.Teams.Members(c, id)
+	if err != nil {
+		code, resp := mapTeamError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, members)
+}
+
+// RemoveMember handler will remove the user with the received user id from the team
+func (h TeamHandler) RemoveMember(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a team id to remove member",
+		})
+		return
+	}
+
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a user id to remove from team",
+		})
+		return
+	}
+
+	if err := h.Teams.RemoveMember(c, id, userID); err != nil {
+		code, resp := mapTeamError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// mapTeamError received an error (preferentially a one received from storage) and return a http status code and
+// an api error to use on the return value to the client
+func mapTeamError(err error) (int, error) {
+	errToStatus := map[code_error.Error]int{
+		team.ErrInvalidTeamName:    http.StatusBadRequest,
+		team.ErrNotFoundTeam:       http.StatusNotFound,
+		team.ErrInvalidTeamMember:  http.StatusBadRequest,
+		team.ErrNotFoundTeamMember: http.StatusNotFound,
+		team.ErrStorageSave:        http.StatusInternalServerError,
+		team.ErrStorageGet:         http.StatusInternalServerError,
+		team.ErrStorageUpdate:      http.StatusInternalServerError,
+		team.ErrStorageDelete:      http.StatusInternalServerError,
+	}
+
+	var teamErr code_error.Error
+	if errors.As(err, &teamErr) {
+		if code, ok := errToStatus[teamErr]; ok {
+			return code, apiError{
+				Code:    teamErr.GetCode(),
+				Message: teamErr.GetDetail(),
+			}
+		}
+	}
+
+	return http.StatusInternalServerError, apiError{
+		Code:    "error",
+		Message: err.Error(),
+	}
+}
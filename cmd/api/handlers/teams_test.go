@@ -0,0 +1,360 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/team"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+)
+
+// teamMockDb a 'db' to use on TeamHandler test with the capabilities to mock errors on save action
+type teamMockDb struct {
+	idCount int64
+	teams   map[int64]team.Team
+	// members are the user ids by team id, users from 1 to 3 are drivers and 4 is a dispatcher, the others are
+	// admins or do not exist
+	members map[int64][]int64
+
+	saveError error
+}
+
+func newTeamMockDB(teams ...team.Team) *teamMockDb {
+	db := &teamMockDb{
+		idCount: 1,
+		teams:   make(map[int64]team.Team),
+		members: make(map[int64][]int64),
+	}
+
+	for _, t := range teams {
+		db.teams[t.ID] = t
+		db.idCount++
+	}
+
+	return db
+}
+
+func (db *teamMockDb) onCreate(err error) *teamMockDb {
+	db.saveError = err
+	return db
+}
+
+func (db *teamMockDb) SaveTeam(ctx context.Context, t team.Team) (team.Team, error) {
+	if db.saveError != nil {
+		return team.Team{}, db.saveError
+	}
+
+	t.ID = db.idCount
+	db.teams[t.ID] = t
+
+	db.idCount++
+
+	return t, nil
+}
+
+func (db teamMockDb) GetTeam(ctx context.Context, id int64) (team.Team, error) {
+	t, exist := db.teams[id]
+	if !exist {
+		return team.Team{}, team.ErrTeamNotFound
+	}
+
+	return t, nil
+}
+
+func (db teamMockDb) GetTeams(ctx context.Context) ([]team.Team, error) {
+	var teams []team.Team
+	for _, t := range db.teams {
+		teams = append(teams, t)
+	}
+
+	sort.Slice(teams, func(i, j int) bool { return teams[i].ID < teams[j].ID })
+
+	return teams, nil
+}
+
+func (db *teamMockDb) UpdateTeam(ctx context.Context, t team.Team) error {
+	if _, exist := db.teams[t.ID]; !exist {
+		return team.ErrTeamNotFound
+	}
+
+	db.teams[t.ID] = t
+
+	return nil
+}
+
+func (db *teamMockDb) DeleteTeam(ctx context.Context, id int64) error {
+	if _, exist := db.teams[id]; !exist {
+		return team.ErrTeamNotFound
+	}
+
+	delete(db.teams, id)
+	delete(db.members, id)
+
+	return nil
+}
+
+func (db *teamMockDb) AddTeamMember(ctx context.Context, teamID, userID int64) error {
+	if userID < 1 || userID > 4 {
+		return team.ErrMemberNotFound
+	}
+
+	db.members[teamID] = append(db.members[teamID], userID)
+
+	return nil
+}
+
+func (db *teamMockDb) RemoveTeamMember(ctx context.Context, teamID, userID int64) error {
+	for i, id := range db.members[teamID] {
+		if id == userID {
+			db.members[teamID] = append(db.members[teamID][:i], db.members[teamID][i+1:]...)
+			return nil
+		}
+	}
+
+	return team.ErrTeamMemberNotFound
+}
+
+func (db teamMockDb) GetTeamMembers(ctx context.Context, teamID int64) ([]int64, error) {
+	return db.members[teamID], nil
+}
+
+func (db teamMockDb) GetUserTeams(ctx context.Context, userID int64) ([]int64, error) {
+	var teamIDs []int64
+	for teamID, userIDs := range db.members {
+		for _, id := range userIDs {
+			if id == userID {
+				teamIDs = append(teamIDs, teamID)
+			}
+		}
+	}
+
+	return teamIDs, nil
+}
+
+func Test_createTeam(t *testing.T) {
+	testscases := map[string]struct {
+		teamStorage    TeamsStorage
+		body           map[string]interface{}
+		want           team.Team
+		wantError      error
+		statusExpected int
+	}{
+		"successful created team": {
+			teamStorage:    team.NewTeamStorage(newTeamMockDB()),
+			body:           map[string]interface{}{"name": "north"},
+			want:           team.Team{ID: 1, Name: "north"},
+			statusExpected: http.StatusCreated,
+		},
+
+		"failure due to invalid request: no name": {
+			teamStorage:    team.NewTeamStorage(newTeamMockDB()),
+			body:           map[string]interface{}{},
+			wantError:      errors.New("invalid_request - there was an error with fields: name"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to invalid name": {
+			teamStorage:    team.NewTeamStorage(newTeamMockDB()),
+			body:           map[string]interface{}{"name": "  "},
+			wantError:      errors.New("invalid_team - the team name should have between 1 and 50 characters"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to storage error": {
+			teamStorage:    team.NewTeamStorage(newTeamMockDB().onCreate(errors.New("mocked save error"))),
+			body:           map[string]interface{}{"name": "north"},
+			wantError:      errors.New("storage_failure - an error ocurred trying to save team"),
+			statusExpected: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+
+			handler := TeamHandler{
+				Teams: tc.teamStorage,
+			}
+			handler.Create(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := team.Team{}
+
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want.ID, response.ID)
+				assert.Equal(t, tc.want.Name, response.Name)
+			}
+		})
+	}
+}
+
+func Test_editAndDeleteTeam(t *testing.T) {
+	db := newTeamMockDB(team.Team{ID: 1, Name: "north"})
+	handler := TeamHandler{
+		Teams: team.NewTeamStorage(db),
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = &http.Request{
+		Header: make(http.Header),
+	}
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	err := mockJson(c, http.MethodPut, map[string]interface{}{"name": "north east"})
+	assert.Nil(t, err)
+
+	handler.Edit(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "north east", db.teams[1].Name)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	handler.Delete(c)
+	c.Writer.WriteHeaderNow()
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, db.teams)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	handler.Delete(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func Test_teamMembers(t *testing.T) {
+	db := newTeamMockDB(team.Team{ID: 1, Name: "north"})
+	handler := TeamHandler{
+		Teams: team.NewTeamStorage(db),
+	}
+
+	testscases := map[string]struct {
+		urlParams      gin.Params
+		body           map[string]interface{}
+		want           team.TeamMembers
+		wantError      error
+		statusExpected int
+	}{
+		"successful add team driver": {
+			urlParams:      gin.Params{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{"user_id": 2},
+			want:           team.TeamMembers{TeamID: 1, UserIDs: []int64{2}},
+			statusExpected: http.StatusCreated,
+		},
+
+		"successful add team dispatcher": {
+			urlParams:      gin.Params{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{"user_id": 4},
+			want:           team.TeamMembers{TeamID: 1, UserIDs: []int64{4}},
+			statusExpected: http.StatusCreated,
+		},
+
+		"failure due to invalid request: no user": {
+			urlParams:      gin.Params{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{},
+			wantError:      errors.New("invalid_request - there was an error with fields: user_id"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to user not driver or dispatcher": {
+			urlParams:      gin.Params{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{"user_id": 10},
+			wantError:      errors.New("invalid_user - the user to add to the team should be a driver or a dispatcher"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to non existent team": {
+			urlParams:      gin.Params{{Key: "id", Value: "2"}},
+			body:           map[string]interface{}{"user_id": 2},
+			wantError:      errors.New("not_found_team - not founded the team to get"),
+			statusExpected: http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			db.members = make(map[int64][]int64)
+
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+			c.Params = tc.urlParams
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+
+			handler.AddMember(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := team.TeamMembers{}
+
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, response)
+			}
+		})
+	}
+
+	t.Run("successful remove team member", func(t *testing.T) {
+		db.members = map[int64][]int64{1: {2}}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: "1"}, {Key: "user_id", Value: "2"}}
+
+		handler.RemoveMember(c)
+		c.Writer.WriteHeaderNow()
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, db.members[1])
+
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: "1"}, {Key: "user_id", Value: "2"}}
+
+		handler.RemoveMember(c)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
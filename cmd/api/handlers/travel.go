@@ -2,20 +2,53 @@ package handlers
 
 import (
 	"context"
+	"encoding/csv"
 	"errors"
 	"github.com/gin-gonic/gin"
 	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
 	"github.com/nicocarolo/space-drivers/internal/platform/log"
 	"github.com/nicocarolo/space-drivers/internal/travel"
 	"github.com/nicocarolo/space-drivers/internal/user"
+	"io"
+	"io/ioutil"
 	"net/http"
 	"strconv"
+	"strings"
+	"time"
 )
 
 type TravelStorage interface {
 	Get(ctx context.Context, id int64) (travel.Travel, error)
+	IDByUUID(ctx context.Context, publicID string) (int64, error)
+	GetIncludingDeleted(ctx context.Context, id int64) (travel.Travel, error)
+	GetCurrent(ctx context.Context, userID int64) (travel.Travel, error)
+	Search(ctx context.Context, opt ...travel.SearchOption) ([]travel.Travel, travel.Metadata, error)
+	Each(ctx context.Context, fn func(travel.Travel) error, opt ...travel.SearchOption) error
 	Save(ctx context.Context, travel travel.Travel) (travel.Travel, error)
 	Update(ctx context.Context, travel travel.Travel) (travel.Travel, error)
+	Rate(ctx context.Context, travelID int64, rating travel.Rating) (travel.Rating, error)
+	Quote(ctx context.Context, from, to travel.Point) travel.Quote
+	Reassign(ctx context.Context, id int64, reassignment travel.Reassignment) (travel.Travel, error)
+	Offer(ctx context.Context, id int64, offer travel.Offer) (travel.Travel, error)
+	Accept(ctx context.Context, id int64) (travel.Travel, error)
+	Reject(ctx context.Context, id int64) (travel.Travel, error)
+	Enqueue(ctx context.Context, id int64, assignment travel.QueueAssignment) (travel.Travel, error)
+	Dequeue(ctx context.Context, id int64) (travel.Travel, error)
+	Queue(ctx context.Context, userID int64) ([]travel.Travel, error)
+	Delete(ctx context.Context, id int64) error
+	Restore(ctx context.Context, id int64) (travel.Travel, error)
+	Stats(ctx context.Context, days int) (travel.Stats, error)
+	Heatmap(ctx context.Context, query travel.HeatmapQuery) (travel.Heatmap, error)
+	Earnings(ctx context.Context, userID int64, query travel.EarningsQuery) (travel.Earnings, error)
+	BatchUpdateStatus(ctx context.Context, ids []int64, status travel.Status) ([]travel.BatchResult, error)
+	Attach(ctx context.Context, travelID int64, kind travel.AttachmentKind, content []byte) (travel.Attachment, error)
+	ReportLocation(ctx context.Context, travelID int64, point travel.TracePoint) (travel.TracePoint, error)
+	Trace(ctx context.Context, travelID int64) ([]travel.TracePoint, error)
+	ShareTracking(ctx context.Context, id int64) (travel.TrackingLink, error)
+	Track(ctx context.Context, token string) (travel.TrackingView, error)
+	PersonalData(ctx context.Context, userID int64) (travel.PersonalData, error)
+	ErasePersonalData(ctx context.Context, userID int64) error
 }
 
 type TravelHandler struct {
@@ -28,82 +61,1140 @@ func (h TravelHandler) Get(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, apiError{
-			Code:        "invalid_request",
-			Description: "the request has not a travel id to get",
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to get",
 		})
 		return
 	}
 
-	travelResp, err := h.Travels.Get(c, id)
+	claims, _ := loggedUser(c)
+	includeDeleted, code, err := parseIncludeDeleted(c, claims)
+	if err != nil {
+		c.JSON(code, err)
+		return
+	}
+
+	var travelResp travel.Travel
+	if includeDeleted {
+		travelResp, err = h.Travels.GetIncludingDeleted(c, id)
+	} else {
+		travelResp, err = h.Travels.Get(c, id)
+	}
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, travelView(c, travelResp))
+}
+
+// GetCurrent handler will get the travel which the logged in driver is currently assigned to. If the driver is
+// free then no content is returned
+func (h TravelHandler) GetCurrent(c *gin.Context) {
+	claims, ok := loggedUser(c)
+	if !ok {
+		log.Error(c, "there was an error getting logged in user from context on get current travel")
+		code, resp := mapTravelError(travel.ErrInvalidUserClaims)
+		c.JSON(code, resp)
+		return
+	}
+
+	travelResp, err := h.Travels.GetCurrent(c, claims.UserID)
+	if err != nil {
+		if errors.Is(err, travel.ErrNotFoundTravel) {
+			c.JSON(http.StatusNoContent, nil)
+			return
+		}
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, travelView(c, travelResp))
+}
+
+// GetByUser handler will search the travels assigned to the user received as url param, by status or with pagination.
+// Drivers can only search their own travels
+// ?status={status}&limit={pageSize}&offset={pageNumber}
+func (h TravelHandler) GetByUser(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a user id to search travels",
+		})
+		return
+	}
+
+	claims, ok := loggedUser(c)
+	if !ok {
+		log.Error(c, "there was an error getting logged in user from context on search user travels")
+		code, resp := mapTravelError(travel.ErrInvalidUserClaims)
+		c.JSON(code, resp)
+		return
+	}
+
+	if !user.ClaimsPermissions(claims).Has(user.PermissionTravelRead) && claims.UserID != userID {
+		log.Info(c, "the user who was logged in cannot search travels of another user",
+			log.Int64("user_id", userID),
+			log.Int64("logged_user_id", claims.UserID),
+			log.String("logged_role", claims.Role))
+		code, resp := mapTravelError(travel.ErrInvalidUserSearch)
+		c.JSON(code, resp)
+		return
+	}
+
+	searchOptions, apiErr := parseTravelSearch(c)
+	if apiErr != nil {
+		c.JSON(http.StatusBadRequest, apiErr)
+		return
+	}
+
+	includeDeleted, code, err := parseIncludeDeleted(c, claims)
+	if err != nil {
+		c.JSON(code, err)
+		return
+	}
+	if includeDeleted {
+		searchOptions = append(searchOptions, travel.WithDeleted())
+	}
+	searchOptions = append(searchOptions, travel.WithUser(userID))
+
+	travels, meta, err := h.Travels.Search(c, searchOptions...)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"total":   meta.Total,
+		"pending": meta.Pending,
+		"result":  travelsView(c, travels),
+	})
+}
+
+// List handler will search travels by status, near a location or with pagination. Users that cannot read every
+// travel can only search pending travels, the pending travels are listed by priority and then by age
+// ?status={status}&tag={tag}&near={latitude},{longitude}&radius_km={radius}&limit={pageSize}&offset={pageNumber}&fields={fields}
+func (h TravelHandler) List(c *gin.Context) {
+	claims, ok := loggedUser(c)
+	if !ok {
+		log.Error(c, "there was an error getting logged in user from context on search travels")
+		code, resp := mapTravelError(travel.ErrInvalidUserClaims)
+		c.JSON(code, resp)
+		return
+	}
+
+	searchOptions, apiErr := parseTravelSearch(c)
+	if apiErr != nil {
+		c.JSON(http.StatusBadRequest, apiErr)
+		return
+	}
+
+	includeDeleted, code, err := parseIncludeDeleted(c, claims)
+	if err != nil {
+		c.JSON(code, err)
+		return
+	}
+	if includeDeleted {
+		searchOptions = append(searchOptions, travel.WithDeleted())
+	}
+
+	canReadTravels := user.ClaimsPermissions(claims).Has(user.PermissionTravelRead)
+	if !canReadTravels {
+		if status := c.Query("status"); status != "" && status != travel.StatusPending {
+			log.Info(c, "the user who was logged in cannot search travels not pending",
+				log.Int64("logged_user_id", claims.UserID),
+				log.String("logged_role", claims.Role),
+				log.String("travel_status", status))
+			code, resp := mapTravelError(travel.ErrInvalidUserSearchStatus)
+			c.JSON(code, resp)
+			return
+		}
+		searchOptions = append(searchOptions, travel.WithStatus(travel.StatusPending))
+	}
+
+	if !canReadTravels || c.Query("status") == travel.StatusPending {
+		searchOptions = append(searchOptions, travel.WithPriorityOrder())
+	}
+
+	travels, meta, err := h.Travels.Search(c, searchOptions...)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	result, err := shapeFields(c, travelsView(c, travels))
+	if err != nil {
+		shapeFieldsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"total":   meta.Total,
+		"pending": meta.Pending,
+		"result":  result,
+	})
+}
+
+// Export handler will stream a csv with the travels matching the received status and creation dates
+// ?status={status}&from={yyyy-mm-dd}&to={yyyy-mm-dd}
+func (h TravelHandler) Export(c *gin.Context) {
+	const dateLayout = "2006-01-02"
+
+	var searchOptions []travel.SearchOption
+	if status := c.Query("status"); status != "" {
+		searchOptions = append(searchOptions, travel.WithStatus(travel.Status(status)))
+	}
+
+	// the travels are filtered by creation date, 'to' date is inclusive
+	var createdFrom, createdTo time.Time
+	if from := c.Query("from"); from != "" {
+		var err error
+		createdFrom, err = time.Parse(dateLayout, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid export from date received",
+			})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := time.Parse(dateLayout, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid export to date received",
+			})
+			return
+		}
+		createdTo = date.AddDate(0, 0, 1)
+	}
+	searchOptions = append(searchOptions, travel.WithCreatedBetween(createdFrom, createdTo))
+
+	writer := csv.NewWriter(c.Writer)
+	started := false
+
+	err := h.Travels.Each(c, func(trv travel.Travel) error {
+		// the response is started with the first travel so errors found before can still be answered as json
+		if !started {
+			started = true
+			startCSVExport(c, writer)
+		}
+
+		return writer.Write([]string{
+			strconv.FormatInt(trv.ID, 10),
+			string(trv.Status),
+			strconv.FormatFloat(trv.From.Lat, 'f', -1, 64),
+			strconv.FormatFloat(trv.From.Lng, 'f', -1, 64),
+			strconv.FormatFloat(trv.To.Lat, 'f', -1, 64),
+			strconv.FormatFloat(trv.To.Lng, 'f', -1, 64),
+			strconv.FormatInt(trv.UserID, 10),
+			trv.CreatedAt.Format(time.RFC3339),
+		})
+	}, searchOptions...)
+	if err != nil {
+		if started {
+			// the status code was already sent, the export is truncated
+			log.Error(c, "there was an error streaming travels export", log.Err(err))
+			return
+		}
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	if !started {
+		startCSVExport(c, writer)
+	}
+	writer.Flush()
+}
+
+// startCSVExport write the headers and the csv columns of a travels export
+func startCSVExport(c *gin.Context, writer *csv.Writer) {
+	c.Header("Content-Type", "text/csv")
+	c.Header("Content-Disposition", `attachment; filename="travels.csv"`)
+	c.Status(http.StatusOK)
+
+	_ = writer.Write([]string{"id", "status", "from_latitude", "from_longitude", "to_latitude", "to_longitude",
+		"user_id", "created_at"})
+}
+
+// parseIncludeDeleted parse the include_deleted query param, only admins can include deleted travels. On error
+// it return the http status code and the api error to answer
+func parseIncludeDeleted(c *gin.Context, claims jwt.Claims) (bool, int, error) {
+	param := c.Query("include_deleted")
+	if param == "" {
+		return false, 0, nil
+	}
+
+	includeDeleted, err := strconv.ParseBool(param)
+	if err != nil {
+		return false, http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "invalid include deleted received",
+		}
+	}
+
+	if includeDeleted && !user.ClaimsPermissions(claims).Has(user.PermissionTravelAdmin) {
+		log.Info(c, "the user who was logged in cannot include deleted travels",
+			log.Int64("logged_user_id", claims.UserID),
+			log.String("logged_role", claims.Role))
+		code, resp := mapTravelError(travel.ErrInvalidUserIncludeDeleted)
+		return false, code, resp
+	}
+
+	return includeDeleted, 0, nil
+}
+
+// parseTravelSearch parse the search options shared by travel searches from the query params:
+// status, tag, team, near location with radius, limit and offset
+func parseTravelSearch(c *gin.Context) ([]travel.SearchOption, *apiError) {
+	var searchOptions []travel.SearchOption
+
+	if status := c.Query("status"); status != "" {
+		searchOptions = append(searchOptions, travel.WithStatus(travel.Status(status)))
+	}
+
+	if tag := c.Query("tag"); tag != "" {
+		searchOptions = append(searchOptions, travel.WithTag(tag))
+	}
+
+	// parse team if it was received
+	if team := c.Query("team_id"); team != "" {
+		teamID, err := strconv.ParseInt(team, 10, 64)
+		if err != nil || teamID <= 0 {
+			return nil, &apiError{
+				Code:    "invalid_request",
+				Message: "invalid search team received",
+			}
+		}
+		searchOptions = append(searchOptions, travel.WithTeam(teamID))
+	}
+
+	// parse overdue if it was received, only true filters the travels
+	if overdue := c.Query("overdue"); overdue != "" {
+		isOverdue, err := strconv.ParseBool(overdue)
+		if err != nil {
+			return nil, &apiError{
+				Code:    "invalid_request",
+				Message: "invalid search overdue received",
+			}
+		}
+		if isOverdue {
+			searchOptions = append(searchOptions, travel.WithOverdue())
+		}
+	}
+
+	// parse near location and radius if they were received, both are required to search by location
+	near, radius := c.Query("near"), c.Query("radius_km")
+	if near != "" || radius != "" {
+		var point travel.Point
+		coordinates := strings.Split(near, ",")
+		if len(coordinates) != 2 {
+			return nil, &apiError{
+				Code:    "invalid_request",
+				Message: "invalid search near location received",
+			}
+		}
+
+		var errLat, errLng error
+		point.Lat, errLat = strconv.ParseFloat(strings.TrimSpace(coordinates[0]), 64)
+		point.Lng, errLng = strconv.ParseFloat(strings.TrimSpace(coordinates[1]), 64)
+		if errLat != nil || errLng != nil {
+			return nil, &apiError{
+				Code:    "invalid_request",
+				Message: "invalid search near location received",
+			}
+		}
+
+		radiusKm, err := strconv.ParseFloat(radius, 64)
+		if err != nil {
+			return nil, &apiError{
+				Code:    "invalid_request",
+				Message: "invalid search radius received",
+			}
+		}
+		searchOptions = append(searchOptions, travel.WithNear(point, radiusKm))
+	}
+
+	// parse limit if it was received
+	if limit := c.Query("limit"); limit != "" {
+		limitNmbr, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || limitNmbr <= 0 {
+			return nil, &apiError{
+				Code:    "invalid_request",
+				Message: "invalid search limit received",
+			}
+		}
+		searchOptions = append(searchOptions, travel.WithLimit(limitNmbr))
+	}
+
+	// parse offset if it was received
+	if offset := c.Query("offset"); offset != "" {
+		offsetNmbr, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil || offsetNmbr < 0 {
+			return nil, &apiError{
+				Code:    "invalid_request",
+				Message: "invalid search offset received",
+			}
+		}
+		searchOptions = append(searchOptions, travel.WithOffset(offsetNmbr))
+	}
+
+	return searchOptions, nil
+}
+
+// Create handler will parse received body and save it to storage
+func (h TravelHandler) Create(c *gin.Context) {
+	var travelToCreate travel.Travel
+	if err := c.ShouldBindJSON(&travelToCreate); err != nil {
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	if travelToCreate.UserID != 0 && !h.checkTravelUser(c, travelToCreate.UserID) {
+		return
+	}
+
+	createdTravel, err := h.Travels.Save(c, travelToCreate)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, travelView(c, createdTravel))
+}
+
+// Quote handler will parse received locations and return the estimated distance, duration and fare of a travel
+// between them, nothing is stored
+func (h TravelHandler) Quote(c *gin.Context) {
+	var quoteRequest struct {
+		From travel.Point `json:"from" binding:"required"`
+		To   travel.Point `json:"to" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&quoteRequest); err != nil {
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	c.JSON(http.StatusOK, quoteView(c, h.Travels.Quote(c, quoteRequest.From, quoteRequest.To)))
+}
+
+// Stats handler will return a summary of the travels for an operations dashboard, with the travels created per day
+// for the last received days
+// ?days={days}
+func (h TravelHandler) Stats(c *gin.Context) {
+	days := travel.DefaultStatsDays
+	if param := c.Query("days"); param != "" {
+		var err error
+		days, err = strconv.Atoi(param)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid days received",
+			})
+			return
+		}
+	}
+
+	stats, err := h.Travels.Stats(c, days)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, stats)
+}
+
+// Heatmap handler will get the pickups and dropoffs of the travels by geohash cell and time window
+// ?from={yyyy-mm-dd}&to={yyyy-mm-dd}&precision={geohashLength}&window={hour|day}
+func (h TravelHandler) Heatmap(c *gin.Context) {
+	const dateLayout = "2006-01-02"
+
+	query := travel.HeatmapQuery{
+		Window: travel.HeatmapWindow(c.Query("window")),
+	}
+
+	// the travels are filtered by creation date, 'to' date is inclusive
+	if from := c.Query("from"); from != "" {
+		var err error
+		query.From, err = time.Parse(dateLayout, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid heatmap from date received",
+			})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := time.Parse(dateLayout, to)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid heatmap to date received",
+			})
+			return
+		}
+		query.To = date.AddDate(0, 0, 1)
+	}
+
+	if precision := c.Query("precision"); precision != "" {
+		var err error
+		query.Precision, err = strconv.Atoi(precision)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid heatmap precision received",
+			})
+			return
+		}
+	}
+
+	heatmap, err := h.Travels.Heatmap(c, query)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, heatmap)
+}
+
+// Edit handler will parse received body and id and edit travel in to storage
+func (h TravelHandler) Edit(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		log.Error(c, "there was an error getting id from request on edit travel", log.Err(err))
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to update",
+		})
+		return
+	}
+
+	var travelToUpdate travel.Travel
+	if err := c.ShouldBindJSON(&travelToUpdate); err != nil {
+		log.ErrorLimited(c, "there was an error parsing travel edit request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	travelToUpdate.ID = id
+
+	if travelToUpdate.UserID != 0 && !h.checkTravelUser(c, travelToUpdate.UserID) {
+		return
+	}
+
+	createdTravel, err := h.Travels.Update(c, travelToUpdate)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, travelView(c, createdTravel))
+}
+
+// batchStatusResult is the result of each travel on a batch status update, it has the updated travel or the error
+// (with its http status code) found updating it
+type batchStatusResult struct {
+	ID         int64       `json:"id"`
+	StatusCode int         `json:"status_code"`
+	Travel     interface{} `json:"travel,omitempty"`
+	Error      *apiError   `json:"error,omitempty"`
+}
+
+// BatchStatus handler will parse received body and change the status of every received travel, answering the
+// result of each one
+func (h TravelHandler) BatchStatus(c *gin.Context) {
+	var batchRequest struct {
+		IDs    []int64       `json:"ids" binding:"required"`
+		Status travel.Status `json:"status" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&batchRequest); err != nil {
+		log.ErrorLimited(c, "there was an error parsing travel batch status request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	results, err := h.Travels.BatchUpdateStatus(c, batchRequest.IDs, batchRequest.Status)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	response := make([]batchStatusResult, 0, len(results))
+	for _, result := range results {
+		if result.Err != nil {
+			code, resp := mapTravelError(result.Err)
+			apiErr := resp.(apiError)
+			response = append(response, batchStatusResult{ID: result.ID, StatusCode: code, Error: &apiErr})
+			continue
+		}
+
+		response = append(response, batchStatusResult{ID: result.ID, StatusCode: http.StatusOK,
+			Travel: travelView(c, result.Travel)})
+	}
+
+	c.JSON(http.StatusOK, gin.H{"results": response})
+}
+
+// Reassign handler will parse received body and id and change the user assigned to the in process travel, the
+// new user should be an existent driver
+func (h TravelHandler) Reassign(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to reassign",
+		})
+		return
+	}
+
+	var reassignment travel.Reassignment
+	if err := c.ShouldBindJSON(&reassignment); err != nil {
+		log.ErrorLimited(c, "there was an error parsing travel reassign request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	if reassignment.UserID != 0 && !h.checkDriver(c, reassignment.UserID) {
+		return
+	}
+
+	reassignedTravel, err := h.Travels.Reassign(c, id, reassignment)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, travelView(c, reassignedTravel))
+}
+
+// Offer handler will parse received body and id and offer the pending travel to the driver, who has to accept or
+// reject it
+func (h TravelHandler) Offer(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to offer",
+		})
+		return
+	}
+
+	var offer travel.Offer
+	if err := c.ShouldBindJSON(&offer); err != nil {
+		log.ErrorLimited(c, "there was an error parsing travel offer request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	if !h.checkDriver(c, offer.UserID) {
+		return
+	}
+
+	offeredTravel, err := h.Travels.Offer(c, id, offer)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, travelView(c, offeredTravel))
+}
+
+// Accept handler will assign the travel received as url param to the logged in driver it was offered to
+func (h TravelHandler) Accept(c *gin.Context) {
+	h.answerOffer(c, h.Travels.Accept)
+}
+
+// Reject handler will send back to pending the travel received as url param, rejecting the offer made to the
+// logged in driver
+func (h TravelHandler) Reject(c *gin.Context) {
+	h.answerOffer(c, h.Travels.Reject)
+}
+
+// answerOffer parse the travel id received as url param and answer its offer with the received action
+func (h TravelHandler) answerOffer(c *gin.Context, answer func(ctx context.Context, id int64) (travel.Travel, error)) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to answer its offer",
+		})
+		return
+	}
+
+	answeredTravel, err := answer(c, id)
 	if err != nil {
 		code, resp := mapTravelError(err)
 		c.JSON(code, resp)
 		return
 	}
 
-	c.JSON(http.StatusOK, travelResp)
+	c.JSON(http.StatusOK, travelView(c, answeredTravel))
 }
 
-// Create handler will parse received body and save it to storage
-func (h TravelHandler) Create(c *gin.Context) {
-	var travelToCreate travel.Travel
-	if err := c.ShouldBindJSON(&travelToCreate); err != nil {
+// Enqueue handler will parse received body and id and queue the pending travel to the driver, it is set in process
+// once the driver completes its in process travel and the ones queued before
+func (h TravelHandler) Enqueue(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to queue",
+		})
+		return
+	}
+
+	var assignment travel.QueueAssignment
+	if err := c.ShouldBindJSON(&assignment); err != nil {
+		log.ErrorLimited(c, "there was an error parsing travel queue request", log.Err(err))
 		apiErr := mapValidateError(err)
 		c.JSON(http.StatusUnprocessableEntity, apiErr)
 		return
 	}
 
-	createdTravel, err := h.Travels.Save(c, travelToCreate)
+	if !h.checkDriver(c, assignment.UserID) {
+		return
+	}
+
+	queuedTravel, err := h.Travels.Enqueue(c, id, assignment)
 	if err != nil {
 		code, resp := mapTravelError(err)
 		c.JSON(code, resp)
 		return
 	}
 
-	c.JSON(http.StatusCreated, createdTravel)
+	c.JSON(http.StatusOK, travelView(c, queuedTravel))
 }
 
-// Edit handler will parse received body and id and edit travel in to storage
-func (h TravelHandler) Edit(c *gin.Context) {
+// Dequeue handler will remove the travel received as url param from the queue of its driver, the travel goes back
+// to pending without user
+func (h TravelHandler) Dequeue(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
-		log.Error(c, "there was an error getting id from request on edit travel", log.Err(err))
 		c.JSON(http.StatusBadRequest, apiError{
-			Code:        "invalid_request",
-			Description: "the request has not a travel id to update",
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to dequeue",
 		})
 		return
 	}
 
-	var travelToUpdate travel.Travel
-	if err := c.ShouldBindJSON(&travelToUpdate); err != nil {
-		log.Error(c, "there was an error parsing travel edit request", log.Err(err))
-		apiErr := mapValidateError(err)
-		c.JSON(http.StatusUnprocessableEntity, apiErr)
+	dequeuedTravel, err := h.Travels.Dequeue(c, id)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
 		return
 	}
 
-	travelToUpdate.ID = id
+	c.JSON(http.StatusOK, travelView(c, dequeuedTravel))
+}
+
+// GetQueue handler will get the travels queued to the user received as url param, ordered by queue position.
+// Drivers can only get their own queue
+func (h TravelHandler) GetQueue(c *gin.Context) {
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a user id to get its queue",
+		})
+		return
+	}
+
+	claims, ok := loggedUser(c)
+	if !ok {
+		log.Error(c, "there was an error getting logged in user from context on get user queue")
+		code, resp := mapTravelError(travel.ErrInvalidUserClaims)
+		c.JSON(code, resp)
+		return
+	}
+
+	if !user.ClaimsPermissions(claims).Has(user.PermissionTravelRead) && claims.UserID != userID {
+		log.Info(c, "the user who was logged in cannot get the queue of another user",
+			log.Int64("user_id", userID),
+			log.Int64("logged_user_id", claims.UserID),
+			log.String("logged_role", claims.Role))
+		code, resp := mapTravelError(travel.ErrInvalidUserSearch)
+		c.JSON(code, resp)
+		return
+	}
+
+	queue, err := h.Travels.Queue(c, userID)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	if queue == nil {
+		queue = []travel.Travel{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"user_id": userID,
+		"travels": travelsView(c, queue),
+	})
+}
+
+// Earnings handler will get the fare of the travels completed by a user totaled by day or week, drivers can only get
+// their own earnings
+// ?from={yyyy-mm-dd}&to={yyyy-mm-dd}&period={day|week}
+func (h TravelHandler) Earnings(c *gin.Context) {
+	const dateLayout = "2006-01-02"
+
+	userID, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a user id to get its earnings",
+		})
+		return
+	}
+
+	claims, ok := loggedUser(c)
+	if !ok {
+		log.Error(c, "there was an error getting logged in user from context on get user earnings")
+		code, resp := mapTravelError(travel.ErrInvalidUserClaims)
+		c.JSON(code, resp)
+		return
+	}
 
-	if travelToUpdate.UserID != 0 {
-		_, err := h.Users.Get(c, travelToUpdate.UserID)
-		if err != nil && errors.Is(err, user.ErrNotFoundUser) {
+	if !user.ClaimsPermissions(claims).Has(user.PermissionTravelReport) && claims.UserID != userID {
+		log.Info(c, "the user who was logged in cannot get the earnings of another user",
+			log.Int64("user_id", userID),
+			log.Int64("logged_user_id", claims.UserID),
+			log.String("logged_role", claims.Role))
+		code, resp := mapTravelError(travel.ErrInvalidUserEarnings)
+		c.JSON(code, resp)
+		return
+	}
+
+	query := travel.EarningsQuery{
+		Period: travel.EarningsPeriod(c.Query("period")),
+	}
+
+	// the travels are filtered by completion date, 'to' date is inclusive
+	if from := c.Query("from"); from != "" {
+		query.From, err = time.Parse(dateLayout, from)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid earnings from date received",
+			})
+			return
+		}
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := time.Parse(dateLayout, to)
+		if err != nil {
 			c.JSON(http.StatusBadRequest, apiError{
-				Code:        "invalid_travel_user",
-				Description: "the user received was not found",
+				Code:    "invalid_request",
+				Message: "invalid earnings to date received",
 			})
 			return
 		}
+		query.To = date.AddDate(0, 0, 1)
 	}
 
-	createdTravel, err := h.Travels.Update(c, travelToUpdate)
+	earnings, err := h.Travels.Earnings(c, userID, query)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, earnings)
+}
+
+// checkTravelUser check the user received to assign a travel exists and is not suspended, otherwise it answers the
+// error and return false
+func (h TravelHandler) checkTravelUser(c *gin.Context, userID int64) bool {
+	travelUser, err := h.Users.Get(c, userID)
+	if err != nil && errors.Is(err, user.ErrNotFoundUser) {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_travel_user",
+			Message: "the user received was not found",
+		})
+		return false
+	}
+
+	if err == nil && !travelUser.Active {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_travel_user",
+			Message: "the user received is suspended",
+		})
+		return false
+	}
+
+	return true
+}
+
+// checkDriver check the received user id is an existent and active driver, otherwise it answers the error and
+// return false
+func (h TravelHandler) checkDriver(c *gin.Context, userID int64) bool {
+	driver, err := h.Users.Get(c, userID)
+	if err != nil {
+		if errors.Is(err, user.ErrNotFoundUser) {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_travel_user",
+				Message: "the user received was not found",
+			})
+			return false
+		}
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return false
+	}
+
+	if driver.Role != user.RoleDriver {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_travel_user",
+			Message: "the user received is not a driver",
+		})
+		return false
+	}
+
+	if !driver.Active {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_travel_user",
+			Message: "the user received is suspended",
+		})
+		return false
+	}
+
+	return true
+}
+
+// Delete handler will soft delete the travel with the received id
+func (h TravelHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to delete",
+		})
+		return
+	}
+
+	if err := h.Travels.Delete(c, id); err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Restore handler will undo the soft delete of the travel with the received id
+func (h TravelHandler) Restore(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to restore",
+		})
+		return
+	}
+
+	restoredTravel, err := h.Travels.Restore(c, id)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, travelView(c, restoredTravel))
+}
+
+// Rate handler will parse received body and id and store the rating for the travel
+func (h TravelHandler) Rate(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to rate",
+		})
+		return
+	}
+
+	var rating travel.Rating
+	if err := c.ShouldBindJSON(&rating); err != nil {
+		log.ErrorLimited(c, "there was an error parsing travel rating request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	createdRating, err := h.Travels.Rate(c, id, rating)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, createdRating)
+}
+
+// Attach handler will parse the received multipart form (the attachment kind and file) and save the file as an
+// attachment of the travel
+func (h TravelHandler) Attach(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to attach",
+		})
+		return
+	}
+
+	fileHeader, err := c.FormFile("file")
+	if err != nil {
+		log.Info(c, "there was an error parsing travel attachment request", log.Err(err))
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not an attachment file",
+		})
+		return
+	}
+
+	file, err := fileHeader.Open()
+	if err != nil {
+		log.Error(c, "there was an error opening travel attachment file", log.Err(err))
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	defer file.Close()
+
+	// one byte more than the max is read so bigger files are rejected
+	content, err := ioutil.ReadAll(io.LimitReader(file, travel.MaxAttachmentSize+1))
+	if err != nil {
+		log.Error(c, "there was an error reading travel attachment file", log.Err(err))
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	attachment, err := h.Travels.Attach(c, id, travel.AttachmentKind(c.PostForm("kind")), content)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, attachment)
+}
+
+// ReportLocation handler will parse received body and id and store the location on the travel trace
+func (h TravelHandler) ReportLocation(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to report location",
+		})
+		return
+	}
+
+	var point travel.TracePoint
+	if err := c.ShouldBindJSON(&point); err != nil {
+		log.ErrorLimited(c, "there was an error parsing travel location request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	savedPoint, err := h.Travels.ReportLocation(c, id, point)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, savedPoint)
+}
+
+// Trace handler will parse received id as url param and get the locations reported for the travel
+func (h TravelHandler) Trace(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to get locations",
+		})
+		return
+	}
+
+	trace, err := h.Travels.Trace(c, id)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	if trace == nil {
+		trace = []travel.TracePoint{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"travel_id": id,
+		"locations": trace,
+	})
+}
+
+// ShareTracking handler will parse received id as url param and return a signed link to track the travel without a
+// user, to share it with the customer
+func (h TravelHandler) ShareTracking(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a travel id to track",
+		})
+		return
+	}
+
+	link, err := h.Travels.ShareTracking(c, id)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, link)
+}
+
+// Track handler will get the read-only view of the travel of the tracking token received as url param, it is public:
+// the token is the authorization to see the travel
+func (h TravelHandler) Track(c *gin.Context) {
+	view, err := h.Travels.Track(c, c.Param("token"))
 	if err != nil {
 		code, resp := mapTravelError(err)
 		c.JSON(code, resp)
 		return
 	}
 
-	c.JSON(http.StatusOK, createdTravel)
+	c.JSON(http.StatusOK, view)
 }
 
 func mapTravelError(err error) (int, error) {
@@ -111,26 +1202,78 @@ func mapTravelError(err error) (int, error) {
 		travel.ErrStorageSave:                 http.StatusInternalServerError,
 		travel.ErrStorageUpdate:               http.StatusInternalServerError,
 		travel.ErrStorageGet:                  http.StatusInternalServerError,
+		travel.ErrStorageErase:                http.StatusInternalServerError,
 		travel.ErrNotFoundTravel:              http.StatusNotFound,
 		travel.ErrInvalidStatusToEditLocation: http.StatusBadRequest,
 		travel.ErrInvalidStatusToEdit:         http.StatusBadRequest,
 		travel.ErrInvalidUser:                 http.StatusBadRequest,
 		travel.ErrInvalidUserClaims:           http.StatusUnauthorized,
 		travel.ErrInvalidUserAccess:           http.StatusUnauthorized,
+		travel.ErrDriverAlreadyAssigned:       http.StatusConflict,
+		travel.ErrTravelUpdateConflict:        http.StatusConflict,
+		travel.ErrInvalidStatusToReassign:     http.StatusBadRequest,
+		travel.ErrInvalidReassignUser:         http.StatusBadRequest,
+		travel.ErrInvalidStatusToOffer:        http.StatusBadRequest,
+		travel.ErrInvalidStatusToAnswer:       http.StatusBadRequest,
+		travel.ErrInvalidOfferUser:            http.StatusUnauthorized,
+		travel.ErrOfferExpired:                http.StatusConflict,
+		travel.ErrInvalidStatusToQueue:        http.StatusBadRequest,
+		travel.ErrInvalidStatusToDequeue:      http.StatusBadRequest,
+		travel.ErrDriverNotInProcess:          http.StatusConflict,
+		travel.ErrQueueFull:                   http.StatusConflict,
+		travel.ErrInvalidUserIncludeDeleted:   http.StatusUnauthorized,
+		travel.ErrInvalidStatusToDelete:       http.StatusBadRequest,
+		travel.ErrNotDeletedTravel:            http.StatusBadRequest,
+		travel.ErrInvalidTags:                 http.StatusBadRequest,
+		travel.ErrInvalidPriority:             http.StatusBadRequest,
+		travel.ErrInvalidStatusToSearch:       http.StatusBadRequest,
+		travel.ErrInvalidUserSearch:           http.StatusUnauthorized,
+		travel.ErrInvalidUserSearchStatus:     http.StatusUnauthorized,
+		travel.ErrInvalidSearchRadius:         http.StatusBadRequest,
+		travel.ErrInvalidCoordinates:          http.StatusBadRequest,
+		travel.ErrInvalidDeadline:             http.StatusBadRequest,
+		travel.ErrInvalidTracking:             http.StatusUnauthorized,
+		travel.ErrInvalidStatusToTrack:        http.StatusBadRequest,
+		travel.ErrGenerateTracking:            http.StatusInternalServerError,
+		travel.ErrOutsideZones:                http.StatusBadRequest,
+		travel.ErrDriverNotEligible:           http.StatusBadRequest,
+		travel.ErrInvalidStatsDays:            http.StatusBadRequest,
+		travel.ErrInvalidHeatmapPrecision:     http.StatusBadRequest,
+		travel.ErrInvalidHeatmapWindow:        http.StatusBadRequest,
+		travel.ErrInvalidHeatmapRange:         http.StatusBadRequest,
+		travel.ErrInvalidEarningsPeriod:       http.StatusBadRequest,
+		travel.ErrInvalidEarningsRange:        http.StatusBadRequest,
+		travel.ErrInvalidUserEarnings:         http.StatusUnauthorized,
+		travel.ErrInvalidBatchSize:            http.StatusBadRequest,
+		travel.ErrInvalidStatusToCancel:       http.StatusBadRequest,
+		travel.ErrInvalidRatingScore:          http.StatusBadRequest,
+		travel.ErrInvalidStatusToRate:         http.StatusBadRequest,
+		travel.ErrTravelAlreadyRated:          http.StatusConflict,
+		travel.ErrStorageSaveRating:           http.StatusInternalServerError,
+		travel.ErrInvalidAttachmentKind:       http.StatusBadRequest,
+		travel.ErrInvalidAttachmentFile:       http.StatusBadRequest,
+		travel.ErrInvalidStatusToAttach:       http.StatusBadRequest,
+		travel.ErrStorageSaveAttachment:       http.StatusInternalServerError,
+		travel.ErrInvalidStatusToTrace:        http.StatusBadRequest,
+		travel.ErrInvalidTraceDate:            http.StatusBadRequest,
+		travel.ErrStorageSaveLocation:         http.StatusInternalServerError,
 	}
 
 	var travelErr code_error.Error
 	if errors.As(err, &travelErr) {
-		if code, ok := errToStatus[travelErr]; ok {
-			return code, apiError{
-				Code:        travelErr.GetCode(),
-				Description: travelErr.GetDetail(),
-			}
+		code, ok := errToStatus[travelErr]
+		if !ok {
+			// business errors not known by the api (as the ones from custom update validators) are client errors
+			code = http.StatusBadRequest
+		}
+		return code, apiError{
+			Code:    travelErr.GetCode(),
+			Message: travelErr.GetDetail(),
 		}
 	}
 
 	return http.StatusInternalServerError, apiError{
-		Code:        "error",
-		Description: err.Error(),
+		Code:    "error",
+		Message: err.Error(),
 	}
 }
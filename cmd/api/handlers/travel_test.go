@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"bytes"
 	"context"
 	"encoding/json"
 	"errors"
@@ -10,9 +11,17 @@ import (
 	"github.com/nicocarolo/space-drivers/internal/travel"
 	"github.com/nicocarolo/space-drivers/internal/user"
 	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 )
 
 // travelMockDb a 'db' to use on TravelStorage test with the capabilities to mock errors on create/get/update action
@@ -20,9 +29,18 @@ type travelMockDb struct {
 	idCount int64
 	travels map[int64]travel.Travel
 
-	saveError   error
-	getError    map[int64]error
-	updateError map[int64]error
+	saveError      error
+	getError       map[int64]error
+	getByUserError map[int64]error
+	updateError    map[int64]error
+	searchError    error
+	ratingError    error
+
+	ratings     map[int64]travel.Rating
+	events      []travel.Event
+	archived    map[int64]travel.Travel
+	attachments []travel.Attachment
+	trace       []travel.TracePoint
 }
 
 func (db *travelMockDb) onCreate(err error) *travelMockDb {
@@ -37,6 +55,24 @@ func (db *travelMockDb) onGet(id int64, err error) *travelMockDb {
 	return db
 }
 
+func (db *travelMockDb) onGetByUser(userID int64, err error) *travelMockDb {
+	db.getByUserError[userID] = err
+
+	return db
+}
+
+func (db *travelMockDb) onSearch(err error) *travelMockDb {
+	db.searchError = err
+
+	return db
+}
+
+func (db *travelMockDb) onRate(err error) *travelMockDb {
+	db.ratingError = err
+
+	return db
+}
+
 func (db *travelMockDb) onUpdate(id int64, err error) *travelMockDb {
 	db.updateError[id] = err
 
@@ -51,6 +87,7 @@ func (db *travelMockDb) SaveTravel(ctx context.Context, trv travel.Travel) (trav
 	}
 
 	trv.ID = db.idCount
+	trv.UUID = fmt.Sprintf("00000000-0000-4000-8000-%012d", trv.ID)
 	db.travels[trv.ID] = trv
 
 	db.idCount++
@@ -58,523 +95,614 @@ func (db *travelMockDb) SaveTravel(ctx context.Context, trv travel.Travel) (trav
 	return trv, nil
 }
 
-func (db travelMockDb) GetTravel(ctx context.Context, id int64) (travel.Travel, error) {
+func (db travelMockDb) GetTravel(ctx context.Context, id int64, includeDeleted bool) (travel.Travel, error) {
 	if err, ok := db.getError[id]; ok {
 		return travel.Travel{}, err
 	}
 
 	trv, exist := db.travels[id]
 	if !exist {
+		if _, archived := db.archived[id]; archived {
+			return travel.Travel{}, travel.ErrTravelNotFound
+		}
 		return travel.Travel{}, fmt.Errorf("not found travel")
 	}
 
+	if trv.DeletedAt != nil && !includeDeleted {
+		return travel.Travel{}, travel.ErrTravelNotFound
+	}
+
 	return trv, nil
 }
 
-func (db *travelMockDb) EditTravel(ctx context.Context, newTravel travel.Travel) error {
-	if err, ok := db.updateError[newTravel.ID]; ok {
-		return err
-	}
-	_, exist := db.travels[newTravel.ID]
-	if !exist {
-		return fmt.Errorf("not found travel")
+func (db travelMockDb) GetArchivedTravel(ctx context.Context, id int64, includeDeleted bool) (travel.Travel, error) {
+	trv, exist := db.archived[id]
+	if !exist || (trv.DeletedAt != nil && !includeDeleted) {
+		return travel.Travel{}, travel.ErrTravelNotFound
 	}
 
-	db.travels[newTravel.ID] = newTravel
-
-	return nil
+	return trv, nil
 }
 
-func newTravelMockDb() *travelMockDb {
-	return &travelMockDb{
-		idCount: 1,
-		travels: make(map[int64]travel.Travel),
-
-		getError:    make(map[int64]error),
-		updateError: make(map[int64]error),
+func (db travelMockDb) GetTravelIDByUUID(ctx context.Context, publicID string) (int64, error) {
+	for _, travels := range []map[int64]travel.Travel{db.travels, db.archived} {
+		for _, trv := range travels {
+			if trv.UUID == publicID {
+				return trv.ID, nil
+			}
+		}
 	}
+
+	return 0, travel.ErrTravelNotFound
 }
 
-func newTravelMockDbFromMap(travels map[int64]travel.Travel) *travelMockDb {
-	return &travelMockDb{
-		idCount: 1,
-		travels: travels,
+func (db travelMockDb) GetTravelByUser(ctx context.Context, userID int64, status ...travel.Status) (travel.Travel, error) {
+	if err, ok := db.getByUserError[userID]; ok {
+		return travel.Travel{}, err
+	}
 
-		getError:    make(map[int64]error),
-		updateError: make(map[int64]error),
+	for _, s := range status {
+		for _, trv := range db.travels {
+			if trv.UserID == userID && trv.Status == s && trv.DeletedAt == nil {
+				return trv, nil
+			}
+		}
 	}
+
+	return travel.Travel{}, travel.ErrTravelNotFound
 }
 
-func Test_createTravel(t *testing.T) {
-	testscases := map[string]struct {
-		travelStorage  TravelStorage
-		body           map[string]interface{}
-		want           travel.Travel
-		wantError      error
-		statusExpected int
-	}{
-		"successful created travel without user and status": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
-			body: map[string]interface{}{
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
-			},
-			want: travel.Travel{
-				ID:     1,
-				Status: "pending",
-				From: travel.Point{
-					Lat: 1,
-					Lng: 2,
-				},
-				To: travel.Point{
-					Lat: -1,
-					Lng: -2,
-				},
-				UserID: 0,
-			},
-			statusExpected: http.StatusCreated,
-		},
+func (db travelMockDb) SearchTravels(ctx context.Context, search travel.Search) ([]travel.Travel, int64, error) {
+	if db.searchError != nil {
+		return nil, 0, db.searchError
+	}
 
-		"successful created travel without user and with status": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
-			body: map[string]interface{}{
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
-				"status": "pending",
-			},
-			want: travel.Travel{
-				ID:     1,
-				Status: "pending",
-				From: travel.Point{
-					Lat: 1,
-					Lng: 2,
-				},
-				To: travel.Point{
-					Lat: -1,
-					Lng: -2,
-				},
-				UserID: 0,
-			},
-			statusExpected: http.StatusCreated,
-		},
+	var found []travel.Travel
+	for _, trv := range db.travels {
+		if trv.DeletedAt != nil && !search.IncludeDeleted {
+			continue
+		}
 
-		"successful created travel with user and without status": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
-			body: map[string]interface{}{
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
-				"user_id": 1,
-			},
-			want: travel.Travel{
-				ID:     1,
-				Status: "pending",
-				From: travel.Point{
-					Lat: 1,
-					Lng: 2,
-				},
-				To: travel.Point{
-					Lat: -1,
-					Lng: -2,
-				},
-				UserID: 1,
-			},
-			statusExpected: http.StatusCreated,
-		},
+		if search.UserID != 0 && trv.UserID != search.UserID {
+			continue
+		}
 
-		"successful created travel with status different than pending": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
-			body: map[string]interface{}{
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
-				"status": "in_process",
-			},
-			want: travel.Travel{
-				ID:     1,
-				Status: "pending",
-				From: travel.Point{
-					Lat: 1,
-					Lng: 2,
-				},
-				To: travel.Point{
-					Lat: -1,
-					Lng: -2,
-				},
-			},
-			statusExpected: http.StatusCreated,
-		},
+		if search.TeamID != 0 && !mockTeamMember(trv.UserID, search.TeamID) {
+			continue
+		}
 
-		"failure due to invalid request: no from": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
-			body: map[string]interface{}{
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-			},
-			wantError:      errors.New("invalid_request - there was an error with fields: lat,lng"),
-			statusExpected: http.StatusUnprocessableEntity,
-		},
+		if len(search.VisibleTeams) > 0 && trv.UserID != 0 && !mockTeamMember(trv.UserID, search.VisibleTeams...) {
+			continue
+		}
 
-		"failure due to invalid request: no to": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
-			body: map[string]interface{}{
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
-			},
-			wantError:      errors.New("invalid_request - there was an error with fields: lat,lng"),
-			statusExpected: http.StatusUnprocessableEntity,
-		},
+		if search.Tag != "" && !hasTag(trv, search.Tag) {
+			continue
+		}
 
-		"failure due to storage failure": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDb().onCreate(errors.New("mocked storage error"))),
-			body: map[string]interface{}{
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
-			},
-			wantError:      errors.New("storage_failure - an error ocurred trying to save travel"),
-			statusExpected: http.StatusInternalServerError,
-		},
-	}
+		matchStatus := len(search.Status) == 0
+		for _, status := range search.Status {
+			if trv.Status == status {
+				matchStatus = true
+			}
+		}
 
-	for name, tc := range testscases {
-		t.Run(name, func(t *testing.T) {
-			w := httptest.NewRecorder()
+		if !search.CreatedFrom.IsZero() && trv.CreatedAt.Before(search.CreatedFrom) {
+			continue
+		}
 
-			c, _ := gin.CreateTestContext(w)
-			c.Request = &http.Request{
-				Header: make(http.Header),
-			}
+		if !search.CreatedTo.IsZero() && !trv.CreatedAt.Before(search.CreatedTo) {
+			continue
+		}
 
-			err := mockJson(c, http.MethodPost, tc.body)
-			assert.Nil(t, err)
+		if !search.CompletedFrom.IsZero() && (trv.CompletedAt == nil || trv.CompletedAt.Before(search.CompletedFrom)) {
+			continue
+		}
 
-			handler := TravelHandler{
-				Travels: tc.travelStorage,
-			}
-			handler.Create(c)
+		if !search.CompletedTo.IsZero() && (trv.CompletedAt == nil || !trv.CompletedAt.Before(search.CompletedTo)) {
+			continue
+		}
 
-			assert.Equal(t, tc.statusExpected, w.Code)
+		if !search.OverdueAt.IsZero() && (trv.Status != travel.StatusInProcess || trv.Deadline == nil ||
+			!trv.Deadline.Before(search.OverdueAt)) {
+			continue
+		}
 
-			if tc.wantError != nil {
-				var apiErr apiError
-				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
-				assert.Nil(t, err)
+		if search.Near != nil && search.Near.DistanceKm(trv.From) > search.RadiusKm {
+			continue
+		}
 
-				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
-			} else {
-				response := travel.Travel{}
+		if matchStatus {
+			found = append(found, trv)
+		}
+	}
 
-				err = json.Unmarshal(w.Body.Bytes(), &response)
-				assert.Nil(t, err)
+	priorityRank := map[travel.Priority]int{travel.PriorityHigh: 0, travel.PriorityLow: 2}
+	rank := func(trv travel.Travel) int {
+		if rank, ok := priorityRank[trv.Priority]; ok {
+			return rank
+		}
+		return 1
+	}
 
-				assert.Equal(t, tc.want.From.Lat, response.From.Lat)
-				assert.Equal(t, tc.want.From.Lng, response.From.Lng)
-				assert.Equal(t, tc.want.Status, response.Status)
-				assert.Equal(t, tc.want.UserID, response.UserID)
-				assert.Greater(t, response.ID, int64(0))
-			}
-		})
+	sort.Slice(found, func(i, j int) bool {
+		if search.ByPriority && rank(found[i]) != rank(found[j]) {
+			return rank(found[i]) < rank(found[j])
+		}
+		if search.ByPriority && !found[i].CreatedAt.Equal(found[j].CreatedAt) {
+			return found[i].CreatedAt.Before(found[j].CreatedAt)
+		}
+		if search.Near != nil {
+			return search.Near.DistanceKm(found[i].From) < search.Near.DistanceKm(found[j].From)
+		}
+		return found[i].ID < found[j].ID
+	})
+
+	total := int64(len(found))
+	if search.Offset >= total {
+		return nil, total, nil
+	}
+
+	top := total
+	if search.Offset+search.Limit < top {
+		top = search.Offset + search.Limit
 	}
+
+	return found[search.Offset:top], total, nil
 }
 
-func Test_getTravel(t *testing.T) {
-	dbWithUser := newTravelMockDb()
-	_, _ = dbWithUser.SaveTravel(context.Background(), travel.Travel{
-		ID:     1,
-		Status: "pending",
-		From: travel.Point{
-			Lat: 1,
-			Lng: 2,
-		},
-		To: travel.Point{
-			Lat: -1,
-			Lng: -2,
-		},
-		UserID: 1,
-	})
+func (db travelMockDb) IterateTravels(ctx context.Context, search travel.Search, fn func(travel.Travel) error) error {
+	search.Offset = 0
+	search.Limit = int64(len(db.travels))
 
-	createURLParam := func(id string) []gin.Param {
-		return []gin.Param{
-			{
-				Key:   "id",
-				Value: id,
-			},
+	found, _, err := db.SearchTravels(ctx, search)
+	if err != nil {
+		return err
+	}
+
+	for _, trv := range found {
+		if err := fn(trv); err != nil {
+			return err
 		}
 	}
 
-	testscases := map[string]struct {
-		travelStorage  TravelStorage
-		urlParam       []gin.Param
-		want           travel.Travel
-		wantError      error
-		statusExpected int
-	}{
-		"successful get travel": {
-			travelStorage: travel.NewTravelStorage(dbWithUser),
-			urlParam:      createURLParam("1"),
-			want: travel.Travel{
-				ID:     1,
-				Status: "pending",
-				From: travel.Point{
-					Lat: 1,
-					Lng: 2,
-				},
-				To: travel.Point{
-					Lat: -1,
-					Lng: -2,
-				},
-				UserID: 1,
-			},
-			statusExpected: http.StatusOK,
-		},
+	return nil
+}
 
-		"failure due to invalid request: no id": {
-			travelStorage:  travel.NewTravelStorage(newTravelMockDb()),
-			wantError:      errors.New("invalid_request - the request has not a travel id to get"),
-			statusExpected: http.StatusBadRequest,
-		},
+func (db travelMockDb) CountByStatus(ctx context.Context) (map[travel.Status]int64, error) {
+	if db.searchError != nil {
+		return nil, db.searchError
+	}
 
-		"failure due to storage error": {
-			travelStorage:  travel.NewTravelStorage(newTravelMockDb().onGet(2, travel.ErrStorageGet)),
-			urlParam:       createURLParam("1"),
-			wantError:      errors.New("storage_failure - an error ocurred trying to get travel"),
-			statusExpected: http.StatusInternalServerError,
-		},
+	counts := make(map[travel.Status]int64)
+	for _, trv := range db.travels {
+		if trv.DeletedAt == nil {
+			counts[trv.Status]++
+		}
+	}
 
-		"failure due to non existent travel": {
-			travelStorage:  travel.NewTravelStorage(newTravelMockDb().onGet(4, travel.ErrTravelNotFound)),
-			urlParam:       createURLParam("4"),
-			wantError:      errors.New("not_found_travel - not founded the travel to get"),
-			statusExpected: http.StatusNotFound,
-		},
+	return counts, nil
+}
+
+func (db travelMockDb) AverageTimeInStatus(ctx context.Context) (map[travel.Status]time.Duration, error) {
+	if db.searchError != nil {
+		return nil, db.searchError
 	}
 
-	for name, tc := range testscases {
-		t.Run(name, func(t *testing.T) {
-			w := httptest.NewRecorder()
+	changedAt := make(map[int64]time.Time)
+	totals := make(map[travel.Status]time.Duration)
+	stays := make(map[travel.Status]int64)
+	for _, event := range db.events {
+		trv, exist := db.travels[event.TravelID]
+		if event.Type != travel.EventStatusChanged || !exist || trv.DeletedAt != nil {
+			continue
+		}
 
-			c, _ := gin.CreateTestContext(w)
-			c.Request = &http.Request{
-				Header: make(http.Header),
-			}
+		since, ok := changedAt[event.TravelID]
+		if !ok {
+			since = trv.CreatedAt
+		}
+		changedAt[event.TravelID] = event.CreatedAt
 
-			c.Params = tc.urlParam
+		totals[travel.Status(event.Detail)] += event.CreatedAt.Sub(since)
+		stays[travel.Status(event.Detail)]++
+	}
 
-			handler := TravelHandler{
-				Travels: tc.travelStorage,
-			}
-			handler.Get(c)
+	averages := make(map[travel.Status]time.Duration)
+	for status, total := range totals {
+		averages[status] = total / time.Duration(stays[status])
+	}
 
-			assert.Equal(t, tc.statusExpected, w.Code)
+	return averages, nil
+}
 
-			if tc.wantError != nil {
-				var apiErr apiError
-				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
-				assert.Nil(t, err)
+func (db travelMockDb) CountCreatedByDay(ctx context.Context, from time.Time) (map[string]int64, error) {
+	if db.searchError != nil {
+		return nil, db.searchError
+	}
 
-				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
-			} else {
-				response := travel.Travel{}
+	counts := make(map[string]int64)
+	for _, trv := range db.travels {
+		if trv.DeletedAt == nil && !trv.CreatedAt.Before(from) {
+			counts[trv.CreatedAt.Format("2006-01-02")]++
+		}
+	}
 
-				err := json.Unmarshal(w.Body.Bytes(), &response)
-				assert.Nil(t, err)
+	return counts, nil
+}
 
-				assert.Equal(t, tc.want.From.Lat, response.From.Lat)
-				assert.Equal(t, tc.want.From.Lng, response.From.Lng)
-				assert.Equal(t, tc.want.Status, response.Status)
-				assert.Equal(t, tc.want.UserID, response.UserID)
-				assert.Greater(t, response.ID, int64(0))
-			}
-		})
+func (db travelMockDb) Punctuality(ctx context.Context) (travel.Punctuality, error) {
+	if db.searchError != nil {
+		return travel.Punctuality{}, db.searchError
+	}
+
+	var punctuality travel.Punctuality
+	var delay float64
+	for _, trv := range db.travels {
+		if trv.DeletedAt != nil || trv.Status != travel.StatusReady || trv.ActualMinutes == nil || trv.EstimatedMinutes == nil {
+			continue
+		}
+
+		punctuality.Completed++
+		if *trv.ActualMinutes <= float64(*trv.EstimatedMinutes) {
+			punctuality.OnTime++
+		}
+		delay += *trv.ActualMinutes - float64(*trv.EstimatedMinutes)
+	}
+
+	if punctuality.Completed > 0 {
+		punctuality.AverageDelayMinutes = delay / float64(punctuality.Completed)
 	}
+
+	return punctuality, nil
 }
 
-func Test_editTravel(t *testing.T) {
-	userDB := newMockDB()
-	_, _ = userDB.SaveUser(context.Background(), user.User{
-		SecuredUser: user.SecuredUser{
-			ID:    1,
-			Email: "an_email@hotmail.com",
-			Role:  "driver",
-		},
-	})
-	_, _ = userDB.SaveUser(context.Background(), user.User{
-		SecuredUser: user.SecuredUser{
-			ID:    2,
-			Email: "another_email@hotmail.com",
-			Role:  "driver",
-		},
-	})
-	_, _ = userDB.SaveUser(context.Background(), user.User{
-		SecuredUser: user.SecuredUser{
-			ID:    5,
-			Email: "another2_email@hotmail.com",
-			Role:  "driver",
-		},
-	})
-	userDB = userDB.onGet(3, user.ErrUserNotFound)
-	storageWithUser := user.NewUserStorage(userDB)
+func (db travelMockDb) Heatmap(ctx context.Context, query travel.HeatmapQuery) ([]travel.HeatmapCell, error) {
+	if db.searchError != nil {
+		return nil, db.searchError
+	}
 
-	newTravel := func(id int64, fromLat, fromLng, toLat, toLng float64, status travel.Status, userID int64) travel.Travel {
-		return travel.Travel{
-			ID:     id,
-			Status: status,
-			From: travel.Point{
-				Lat: fromLat,
-				Lng: fromLng,
-			},
-			To: travel.Point{
-				Lat: toLat,
-				Lng: toLng,
-			},
-			UserID: userID,
+	// every travel on range is counted on a cell of its own
+	var cells []travel.HeatmapCell
+	for id, trv := range db.travels {
+		if trv.DeletedAt == nil && !trv.CreatedAt.Before(query.From) && trv.CreatedAt.Before(query.To) {
+			cells = append(cells, travel.HeatmapCell{
+				Geohash:  strconv.FormatInt(id, 10),
+				Window:   trv.CreatedAt.Format(time.RFC3339),
+				Pickups:  1,
+				Dropoffs: 1,
+			})
 		}
 	}
 
-	createURLParam := func(id string) []gin.Param {
-		return []gin.Param{
-			{
-				Key:   "id",
-				Value: id,
-			},
+	return cells, nil
+}
+
+func (db *travelMockDb) ExpireOffers(ctx context.Context, expiredBefore time.Time) ([]int64, error) {
+	var ids []int64
+	for id, trv := range db.travels {
+		if trv.Status == travel.StatusOffered && trv.OfferExpiresAt.Before(expiredBefore) && trv.DeletedAt == nil {
+			db.events = append(db.events,
+				travel.Event{TravelID: id, Type: travel.EventOfferExpired, Detail: strconv.FormatInt(trv.UserID, 10)},
+				travel.Event{TravelID: id, Type: travel.EventStatusChanged, Detail: string(travel.StatusOffered), CreatedAt: time.Now()})
+			trv.Status = travel.StatusPending
+			trv.UserID = 0
+			trv.OfferExpiresAt = nil
+			db.travels[id] = trv
+			ids = append(ids, id)
 		}
 	}
 
-	testscases := map[string]struct {
-		travelStorage  TravelStorage
-		urlParam       []gin.Param
-		userLogged     *jwt.Claims
-		body           map[string]interface{}
-		want           travel.Travel
-		wantError      error
-		statusExpected int
-	}{
-		"successful edit travel without user: change location": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, -100, 70, 2, 20, travel.StatusPending, 0)})),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
-			},
-			body: map[string]interface{}{
-				"status": "pending",
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
-			},
-			want: travel.Travel{
-				ID:     1,
-				Status: "pending",
-				From: travel.Point{
-					Lat: 1,
-					Lng: 2,
-				},
-				To: travel.Point{
-					Lat: -1,
-					Lng: -2,
-				},
-				UserID: 0,
-			},
-			statusExpected: http.StatusOK,
-		},
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
 
-		"successful edit travel with user: change location": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, -100, 70, 2, 20, travel.StatusPending, 0)})),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
-			},
-			body: map[string]interface{}{
-				"user_id": 1,
-				"status":  "pending",
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
-			},
-			want: travel.Travel{
-				ID:     1,
-				Status: "pending",
-				From: travel.Point{
-					Lat: 1,
-					Lng: 2,
-				},
-				To: travel.Point{
-					Lat: -1,
-					Lng: -2,
-				},
-				UserID: 1,
-			},
-			statusExpected: http.StatusOK,
-		},
+	return ids, nil
+}
 
-		"successful edit travel with user: change status": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 0)})),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
-			},
-			body: map[string]interface{}{
-				"user_id": 1,
-				"status":  "in_process",
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
+func (db *travelMockDb) MarkOverdue(ctx context.Context, now time.Time) ([]int64, error) {
+	var ids []int64
+	for id, trv := range db.travels {
+		if trv.Status == travel.StatusInProcess && trv.Deadline != nil && trv.Deadline.Before(now) && trv.DeletedAt == nil {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+func (db *travelMockDb) ArchiveTravels(ctx context.Context, createdBefore time.Time) ([]int64, error) {
+	var ids []int64
+	for id, trv := range db.travels {
+		if (trv.Status == travel.StatusReady || trv.Status == travel.StatusCancelled) && trv.CreatedAt.Before(createdBefore) {
+			db.archived[id] = trv
+			delete(db.travels, id)
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+func (db *travelMockDb) SaveAttachment(ctx context.Context, attachment travel.Attachment) (travel.Attachment, error) {
+	attachment.ID = int64(len(db.attachments) + 1)
+	db.attachments = append(db.attachments, attachment)
+
+	return attachment, nil
+}
+
+func (db travelMockDb) GetAttachments(ctx context.Context, travelID int64) ([]travel.Attachment, error) {
+	var attachments []travel.Attachment
+	for _, attachment := range db.attachments {
+		if attachment.TravelID == travelID {
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	return attachments, nil
+}
+
+func (db *travelMockDb) SaveTracePoint(ctx context.Context, point travel.TracePoint) (travel.TracePoint, error) {
+	point.ID = int64(len(db.trace) + 1)
+	db.trace = append(db.trace, point)
+
+	return point, nil
+}
+
+func (db travelMockDb) GetTrace(ctx context.Context, travelID int64) ([]travel.TracePoint, error) {
+	var trace []travel.TracePoint
+	for _, point := range db.trace {
+		if point.TravelID == travelID {
+			trace = append(trace, point)
+		}
+	}
+
+	return trace, nil
+}
+
+func (db travelMockDb) GetPersonalData(ctx context.Context, userID int64) (travel.PersonalData, error) {
+	if db.searchError != nil {
+		return travel.PersonalData{}, db.searchError
+	}
+
+	var data travel.PersonalData
+	for _, t := range db.travels {
+		if t.UserID == userID {
+			data.Travels = append(data.Travels, t)
+		}
+	}
+	for _, t := range db.archived {
+		if t.UserID == userID {
+			data.Travels = append(data.Travels, t)
+		}
+	}
+	sort.Slice(data.Travels, func(i, j int) bool { return data.Travels[i].ID < data.Travels[j].ID })
+
+	for _, point := range db.trace {
+		if point.UserID == userID {
+			data.Locations = append(data.Locations, point)
+		}
+	}
+	for _, rating := range db.ratings {
+		if rating.UserID == userID {
+			data.Ratings = append(data.Ratings, rating)
+		}
+	}
+	for _, event := range db.events {
+		for _, t := range data.Travels {
+			if event.TravelID == t.ID {
+				data.Events = append(data.Events, event)
+				break
+			}
+		}
+	}
+
+	return data, nil
+}
+
+func (db *travelMockDb) ErasePersonalData(ctx context.Context, userID int64) error {
+	var trace []travel.TracePoint
+	for _, point := range db.trace {
+		if point.UserID != userID {
+			trace = append(trace, point)
+		}
+	}
+	db.trace = trace
+
+	for travelID, rating := range db.ratings {
+		if rating.UserID == userID {
+			rating.Comment = ""
+			db.ratings[travelID] = rating
+		}
+	}
+
+	return nil
+}
+
+func (db *travelMockDb) SaveRating(ctx context.Context, rating travel.Rating) error {
+	if db.ratingError != nil {
+		return db.ratingError
+	}
+
+	if _, exist := db.ratings[rating.TravelID]; exist {
+		return travel.ErrRatingDuplicated
+	}
+
+	db.ratings[rating.TravelID] = rating
+
+	return nil
+}
+
+func (db *travelMockDb) ExpirePending(ctx context.Context, createdBefore time.Time, detail string) ([]int64, error) {
+	var ids []int64
+	for id, trv := range db.travels {
+		if trv.Status == travel.StatusPending && trv.CreatedAt.Before(createdBefore) && trv.DeletedAt == nil {
+			trv.Status = travel.StatusCancelled
+			db.travels[id] = trv
+			ids = append(ids, id)
+		}
+	}
+
+	return ids, nil
+}
+
+func (db *travelMockDb) EditTravel(ctx context.Context, id int64, edit func(current travel.Travel) (travel.Travel, []travel.Event, error)) error {
+	if err, ok := db.getError[id]; ok {
+		return err
+	}
+	current, exist := db.travels[id]
+	if !exist {
+		return fmt.Errorf("not found travel")
+	}
+
+	newTravel, events, err := edit(current)
+	if err != nil {
+		return err
+	}
+
+	if err, ok := db.updateError[id]; ok {
+		return err
+	}
+
+	restored := current.DeletedAt != nil && newTravel.DeletedAt == nil
+	if newTravel.UserID != 0 && (newTravel.UserID != current.UserID || restored) {
+		for travelID, trv := range db.travels {
+			if travelID != id && trv.UserID == newTravel.UserID && trv.DeletedAt == nil &&
+				(trv.Status == travel.StatusPending || trv.Status == travel.StatusOffered || trv.Status == travel.StatusInProcess) {
+				return travel.ErrDriverBusy
+			}
+		}
+	}
+
+	if newTravel.Status != current.Status {
+		events = append(events, travel.Event{TravelID: id, Type: travel.EventStatusChanged, Detail: string(current.Status),
+			CreatedAt: time.Now().UTC().Truncate(time.Second)})
+	}
+
+	db.travels[id] = newTravel
+	db.events = append(db.events, events...)
+
+	return nil
+}
+
+func (db *travelMockDb) QueueTravel(ctx context.Context, id, userID int64, edit func(current travel.Travel, assigned []travel.Travel) (travel.Travel, []travel.Event, error)) error {
+	if err, ok := db.getError[id]; ok {
+		return err
+	}
+	current, exist := db.travels[id]
+	if !exist {
+		return fmt.Errorf("not found travel")
+	}
+
+	var assigned []travel.Travel
+	for travelID, trv := range db.travels {
+		if travelID != id && trv.UserID == userID && trv.DeletedAt == nil &&
+			(trv.Status == travel.StatusInProcess || trv.Status == travel.StatusQueued) {
+			assigned = append(assigned, trv)
+		}
+	}
+
+	newTravel, events, err := edit(current, assigned)
+	if err != nil {
+		return err
+	}
+
+	if err, ok := db.updateError[id]; ok {
+		return err
+	}
+
+	db.travels[id] = newTravel
+	db.events = append(db.events, events...)
+
+	return nil
+}
+
+func (db travelMockDb) GetQueue(ctx context.Context, userID int64) ([]travel.Travel, error) {
+	if err, ok := db.getByUserError[userID]; ok {
+		return nil, err
+	}
+
+	var queue []travel.Travel
+	for _, trv := range db.travels {
+		if trv.UserID == userID && trv.Status == travel.StatusQueued && trv.DeletedAt == nil {
+			queue = append(queue, trv)
+		}
+	}
+
+	sort.Slice(queue, func(i, j int) bool { return *queue[i].QueuePosition < *queue[j].QueuePosition })
+
+	return queue, nil
+}
+
+func newTravelMockDb() *travelMockDb {
+	return &travelMockDb{
+		idCount: 1,
+		travels: make(map[int64]travel.Travel),
+
+		getError:       make(map[int64]error),
+		getByUserError: make(map[int64]error),
+		updateError:    make(map[int64]error),
+
+		ratings:  make(map[int64]travel.Rating),
+		archived: make(map[int64]travel.Travel),
+	}
+}
+
+func newTravelMockDbFromMap(travels map[int64]travel.Travel) *travelMockDb {
+	return &travelMockDb{
+		idCount: 1,
+		travels: travels,
+
+		getError:       make(map[int64]error),
+		getByUserError: make(map[int64]error),
+		updateError:    make(map[int64]error),
+
+		ratings:  make(map[int64]travel.Rating),
+		archived: make(map[int64]travel.Travel),
+	}
+}
+
+func Test_createTravel(t *testing.T) {
+	userDB := newMockDB()
+	_, _ = userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "a_driver@hotmail.com",
+			Role:  "driver",
+		},
+	})
+	suspended, _ := userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "a_suspended_driver@hotmail.com",
+			Role:  "driver",
+		},
+	})
+	suspended.Active = false
+	_, _ = userDB.UpdateStatus(context.Background(), suspended)
+	users := user.NewUserStorage(userDB)
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		body           map[string]interface{}
+		want           travel.Travel
+		wantError      error
+		statusExpected int
+	}{
+		"successful created travel without user and status": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
+			body: map[string]interface{}{
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
 					"longitude": -2,
 				},
 			},
 			want: travel.Travel{
 				ID:     1,
-				Status: "in_process",
+				Status: "pending",
 				From: travel.Point{
 					Lat: 1,
 					Lng: 2,
@@ -583,22 +711,14 @@ func Test_editTravel(t *testing.T) {
 					Lat: -1,
 					Lng: -2,
 				},
-				UserID: 1,
+				UserID: 0,
 			},
-			statusExpected: http.StatusOK,
+			statusExpected: http.StatusCreated,
 		},
 
-		"successful edit travel by admin with one user to another user due to it is in pending status": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 2)})),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
-			},
+		"successful created travel without user and with status": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
 			body: map[string]interface{}{
-				"user_id": 5,
-				"status":  "pending",
 				"from": map[string]float64{
 					"latitude":  1,
 					"longitude": 2,
@@ -607,6 +727,7 @@ func Test_editTravel(t *testing.T) {
 					"latitude":  -1,
 					"longitude": -2,
 				},
+				"status": "pending",
 			},
 			want: travel.Travel{
 				ID:     1,
@@ -619,22 +740,14 @@ func Test_editTravel(t *testing.T) {
 					Lat: -1,
 					Lng: -2,
 				},
-				UserID: 5,
+				UserID: 0,
 			},
-			statusExpected: http.StatusOK,
+			statusExpected: http.StatusCreated,
 		},
 
-		"failure edit travel by driver with one user to another user, no matter if it is pending": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 2)})),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "driver",
-			},
+		"successful created travel with user and without status": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
 			body: map[string]interface{}{
-				"user_id": 5,
-				"status":  "pending",
 				"from": map[string]float64{
 					"latitude":  1,
 					"longitude": 2,
@@ -643,21 +756,27 @@ func Test_editTravel(t *testing.T) {
 					"latitude":  -1,
 					"longitude": -2,
 				},
+				"user_id": 1,
 			},
-			wantError:      errors.New("invalid_user_access - the user logged in cannot perform this action, he is not the owner of the travel or it is not an admin"),
-			statusExpected: http.StatusUnauthorized,
-		},
-
-		"failure travel update: change initial status without user on db travel": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 0)})),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
+			want: travel.Travel{
+				ID:     1,
+				Status: "pending",
+				From: travel.Point{
+					Lat: 1,
+					Lng: 2,
+				},
+				To: travel.Point{
+					Lat: -1,
+					Lng: -2,
+				},
 				UserID: 1,
-				Role:   "admin",
 			},
+			statusExpected: http.StatusCreated,
+		},
+
+		"successful created travel with status different than pending": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
 			body: map[string]interface{}{
-				"status": "in_process",
 				"from": map[string]float64{
 					"latitude":  1,
 					"longitude": 2,
@@ -666,70 +785,66 @@ func Test_editTravel(t *testing.T) {
 					"latitude":  -1,
 					"longitude": -2,
 				},
-			},
-			wantError:      errors.New("invalid_user - invalid user while performing update"),
-			statusExpected: http.StatusBadRequest,
-		},
-
-		"failure travel update: change locations in no pending status": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 0)})),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
-			},
-			body: map[string]interface{}{
 				"status": "in_process",
-				"from": map[string]float64{
-					"latitude":  100,
-					"longitude": 200,
+			},
+			want: travel.Travel{
+				ID:     1,
+				Status: "pending",
+				From: travel.Point{
+					Lat: 1,
+					Lng: 2,
 				},
-				"to": map[string]float64{
-					"latitude":  -100,
-					"longitude": -200,
+				To: travel.Point{
+					Lat: -1,
+					Lng: -2,
 				},
 			},
-			wantError:      errors.New("invalid_user - invalid user while performing update"),
-			statusExpected: http.StatusBadRequest,
+			statusExpected: http.StatusCreated,
 		},
 
-		"failure travel update: change user id in no pending status": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusInProcess, 1)})),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 2,
-				Role:   "driver",
-			},
+		"failure due to invalid request: no from": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
 			body: map[string]interface{}{
-				"user_id": 2,
-				"status":  "in_process",
 				"from": map[string]float64{
 					"latitude":  1,
 					"longitude": 2,
 				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
 			},
-			wantError:      errors.New("invalid_user_access - the user logged in cannot perform this action, he is not the owner of the travel or it is not an admin"),
-			statusExpected: http.StatusUnauthorized,
+			wantError:      errors.New("invalid_request - there was an error with fields: to.latitude,to.longitude"),
+			statusExpected: http.StatusUnprocessableEntity,
 		},
 
-		"failure travel update: no user id in no pending status": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusInProcess, 2)})),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+		"successful travel creation with GeoJSON points": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
+			body: map[string]interface{}{
+				"from": map[string]interface{}{
+					"type":        "Point",
+					"coordinates": []float64{2, 1},
+				},
+				"to": map[string]interface{}{
+					"type":        "Point",
+					"coordinates": []float64{-2, -1},
+				},
+			},
+			want: travel.Travel{
+				Status: "pending",
+				From: travel.Point{
+					Lat: 1,
+					Lng: 2,
+				},
+				To: travel.Point{
+					Lat: -1,
+					Lng: -2,
+				},
 			},
+			statusExpected: http.StatusCreated,
+		},
+
+		"failure due to invalid request: invalid coordinates": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
 			body: map[string]interface{}{
-				"status": "in_process",
 				"from": map[string]float64{
-					"latitude":  1,
+					"latitude":  91,
 					"longitude": 2,
 				},
 				"to": map[string]float64{
@@ -737,21 +852,25 @@ func Test_editTravel(t *testing.T) {
 					"longitude": -2,
 				},
 			},
-			wantError:      errors.New("invalid_user - invalid user while performing update"),
-			statusExpected: http.StatusBadRequest,
+			wantError:      errors.New("invalid_coordinates - the latitude should be between -90 and 90 and the longitude between -180 and 180"),
+			statusExpected: http.StatusUnprocessableEntity,
 		},
 
-		"failure travel update: pending to ready": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 1)})),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+		"failure due to invalid request: no to": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
+			body: map[string]interface{}{
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
 			},
+			wantError:      errors.New("invalid_request - there was an error with fields: from.latitude,from.longitude"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to suspended user": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
 			body: map[string]interface{}{
-				"user_id": 1,
-				"status":  "ready",
 				"from": map[string]float64{
 					"latitude":  1,
 					"longitude": 2,
@@ -760,22 +879,15 @@ func Test_editTravel(t *testing.T) {
 					"latitude":  -1,
 					"longitude": -2,
 				},
+				"user_id": 2,
 			},
-			wantError:      errors.New("invalid_status - invalid received status"),
+			wantError:      errors.New("invalid_travel_user - the user received is suspended"),
 			statusExpected: http.StatusBadRequest,
 		},
 
-		"failure travel update: in process to pending": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusInProcess, 1)})),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
-			},
+		"failure due to storage failure": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb().onCreate(errors.New("mocked storage error"))),
 			body: map[string]interface{}{
-				"user_id": 1,
-				"status":  "pending",
 				"from": map[string]float64{
 					"latitude":  1,
 					"longitude": 2,
@@ -785,171 +897,3488 @@ func Test_editTravel(t *testing.T) {
 					"longitude": -2,
 				},
 			},
-			wantError:      errors.New("invalid_status - invalid received status"),
-			statusExpected: http.StatusBadRequest,
+			wantError:      errors.New("storage_failure - an error ocurred trying to save travel"),
+			statusExpected: http.StatusInternalServerError,
 		},
+	}
 
-		"failure due to invalid request: no id": {
-			travelStorage:  travel.NewTravelStorage(newTravelMockDb()),
-			wantError:      errors.New("invalid_request - the request has not a travel id to update"),
-			statusExpected: http.StatusBadRequest,
-		},
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
 
-		"failure due to invalid request: no location": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
-			urlParam:      createURLParam("1"),
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+				Users:   users,
+			}
+			handler.Create(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := travel.Travel{}
+
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want.From.Lat, response.From.Lat)
+				assert.Equal(t, tc.want.From.Lng, response.From.Lng)
+				assert.Equal(t, tc.want.Status, response.Status)
+				assert.Equal(t, tc.want.UserID, response.UserID)
+				assert.Greater(t, response.ID, int64(0))
+			}
+		})
+	}
+}
+
+func Test_quoteTravel(t *testing.T) {
+	testscases := map[string]struct {
+		body           map[string]interface{}
+		want           travel.Quote
+		wantError      error
+		statusExpected int
+	}{
+		"successful quote": {
 			body: map[string]interface{}{
-				"status": "pending",
 				"from": map[string]float64{
 					"latitude":  1,
 					"longitude": 2,
 				},
+				"to": map[string]float64{
+					"latitude":  1,
+					"longitude": 3,
+				},
+			},
+			want: travel.Quote{
+				From:              travel.Point{Lat: 1, Lng: 2},
+				To:                travel.Point{Lat: 1, Lng: 3},
+				DistanceKm:        111.18,
+				EstimatedDuration: 167,
+				Fare:              2879.45,
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to invalid request: no from": {
+			body: map[string]interface{}{
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
 			},
-			wantError:      errors.New("invalid_request - there was an error with fields: lat,lng"),
+			wantError:      errors.New("invalid_request - there was an error with fields: from.latitude,from.longitude"),
 			statusExpected: http.StatusUnprocessableEntity,
 		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+
+			db := newTravelMockDb()
+			handler := TravelHandler{
+				Travels: travel.NewTravelStorage(db),
+			}
+			handler.Quote(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := travel.Quote{}
+
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, response)
+				// nothing is stored when quoting
+				assert.Empty(t, db.travels)
+			}
+		})
+	}
+}
+
+func Test_getTravel(t *testing.T) {
+	dbWithUser := newTravelMockDb()
+	_, _ = dbWithUser.SaveTravel(context.Background(), travel.Travel{
+		ID:     1,
+		Status: "pending",
+		From: travel.Point{
+			Lat: 1,
+			Lng: 2,
+		},
+		To: travel.Point{
+			Lat: -1,
+			Lng: -2,
+		},
+		UserID: 1,
+	})
+	deletedAt := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	_, _ = dbWithUser.SaveTravel(context.Background(), travel.Travel{
+		Status: "ready",
+		From: travel.Point{
+			Lat: 1,
+			Lng: 2,
+		},
+		To: travel.Point{
+			Lat: -1,
+			Lng: -2,
+		},
+		UserID:    1,
+		DeletedAt: &deletedAt,
+	})
+	archivedTravel := travel.Travel{
+		ID:     7,
+		Status: "ready",
+		From: travel.Point{
+			Lat: 1,
+			Lng: 2,
+		},
+		To: travel.Point{
+			Lat: -1,
+			Lng: -2,
+		},
+		UserID: 1,
+	}
+	dbWithUser.archived[7] = archivedTravel
+
+	createURLParam := func(id string) []gin.Param {
+		return []gin.Param{
+			{
+				Key:   "id",
+				Value: id,
+			},
+		}
+	}
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		urlParam       []gin.Param
+		query          map[string]string
+		userLogged     *jwt.Claims
+		want           travel.Travel
+		wantError      error
+		statusExpected int
+	}{
+		"successful get travel": {
+			travelStorage: travel.NewTravelStorage(dbWithUser),
+			urlParam:      createURLParam("1"),
+			want: travel.Travel{
+				ID:     1,
+				Status: "pending",
+				From: travel.Point{
+					Lat: 1,
+					Lng: 2,
+				},
+				To: travel.Point{
+					Lat: -1,
+					Lng: -2,
+				},
+				UserID: 1,
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful get archived travel": {
+			travelStorage:  travel.NewTravelStorage(dbWithUser),
+			urlParam:       createURLParam("7"),
+			want:           archivedTravel,
+			statusExpected: http.StatusOK,
+		},
+
+		"successful get deleted travel including deleted": {
+			travelStorage: travel.NewTravelStorage(dbWithUser),
+			urlParam:      createURLParam("2"),
+			query:         map[string]string{"include_deleted": "true"},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			want: travel.Travel{
+				ID:     2,
+				Status: "ready",
+				From: travel.Point{
+					Lat: 1,
+					Lng: 2,
+				},
+				To: travel.Point{
+					Lat: -1,
+					Lng: -2,
+				},
+				UserID:    1,
+				DeletedAt: &deletedAt,
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to deleted travel": {
+			travelStorage:  travel.NewTravelStorage(dbWithUser),
+			urlParam:       createURLParam("2"),
+			wantError:      errors.New("not_found_travel - not founded the travel to get"),
+			statusExpected: http.StatusNotFound,
+		},
+
+		"failure including deleted travels with driver role": {
+			travelStorage: travel.NewTravelStorage(dbWithUser),
+			urlParam:      createURLParam("2"),
+			query:         map[string]string{"include_deleted": "true"},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "driver",
+			},
+			wantError:      errors.New("invalid_user_access - only admin users can include deleted travels"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"failure due to invalid include deleted": {
+			travelStorage: travel.NewTravelStorage(dbWithUser),
+			urlParam:      createURLParam("2"),
+			query:         map[string]string{"include_deleted": "maybe"},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			wantError:      errors.New("invalid_request - invalid include deleted received"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to invalid request: no id": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb()),
+			wantError:      errors.New("invalid_request - the request has not a travel id to get"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to storage error": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb().onGet(2, travel.ErrStorageGet)),
+			urlParam:       createURLParam("1"),
+			wantError:      errors.New("storage_failure - an error ocurred trying to get travel"),
+			statusExpected: http.StatusInternalServerError,
+		},
+
+		"failure due to non existent travel": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb().onGet(4, travel.ErrTravelNotFound)),
+			urlParam:       createURLParam("4"),
+			wantError:      errors.New("not_found_travel - not founded the travel to get"),
+			statusExpected: http.StatusNotFound,
+		},
+
+		"failure due to travel of another team than the dispatcher ones": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				5: {ID: 5, Status: travel.StatusInProcess, UserID: 7},
+			}), travel.WithTeamFinder(mockTeamFinder{})),
+			urlParam: createURLParam("5"),
+			userLogged: &jwt.Claims{
+				UserID: 6,
+				Role:   "dispatcher",
+			},
+			wantError:      errors.New("not_found_travel - not founded the travel to get"),
+			statusExpected: http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+
+			req := &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			q := req.URL.Query()
+			for k, v := range tc.query {
+				q.Add(k, v)
+			}
+			req.URL.RawQuery = q.Encode()
+			c.Request = req
+
+			c.Params = tc.urlParam
+
+			if tc.userLogged != nil {
+				c.Set("user_on_call", *tc.userLogged)
+			}
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+			}
+			handler.Get(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := travel.Travel{}
+
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want.From.Lat, response.From.Lat)
+				assert.Equal(t, tc.want.From.Lng, response.From.Lng)
+				assert.Equal(t, tc.want.Status, response.Status)
+				assert.Equal(t, tc.want.UserID, response.UserID)
+				assert.Equal(t, tc.want.DeletedAt, response.DeletedAt)
+				assert.Greater(t, response.ID, int64(0))
+			}
+		})
+	}
+}
+
+func Test_getTravelGeoJSON(t *testing.T) {
+	db := newTravelMockDbFromMap(map[int64]travel.Travel{
+		1: {ID: 1, Status: travel.StatusPending, From: travel.Point{Lat: 1, Lng: 2}, To: travel.Point{Lat: -1, Lng: -2}},
+	})
+
+	testscases := map[string]struct {
+		query       string
+		accept      string
+		wantGeoJSON bool
+	}{
+		"successful get travel with points": {
+			accept: "application/json",
+		},
+
+		"successful get travel as GeoJSON by format param": {
+			query:       "format=geojson",
+			wantGeoJSON: true,
+		},
+
+		"successful get travel as GeoJSON by accept header": {
+			accept:      "application/geo+json, application/json",
+			wantGeoJSON: true,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				URL:    &url.URL{RawQuery: tc.query},
+				Header: http.Header{"Accept": []string{tc.accept}},
+			}
+			c.Params = []gin.Param{{Key: "id", Value: "1"}}
+
+			handler := TravelHandler{
+				Travels: travel.NewTravelStorage(db),
+			}
+			handler.Get(c)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var response map[string]json.RawMessage
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Nil(t, err)
+
+			if tc.wantGeoJSON {
+				assert.JSONEq(t, `{"type": "Point", "coordinates": [2, 1]}`, string(response["from"]))
+				assert.JSONEq(t, `{"type": "Point", "coordinates": [-2, -1]}`, string(response["to"]))
+			} else {
+				assert.JSONEq(t, `{"latitude": 1, "longitude": 2}`, string(response["from"]))
+				assert.JSONEq(t, `{"latitude": -1, "longitude": -2}`, string(response["to"]))
+			}
+			assert.JSONEq(t, `1`, string(response["id"]))
+		})
+	}
+}
+
+func Test_createTravelGeoJSON(t *testing.T) {
+	testscases := map[string]struct {
+		contentType string
+		body        string
+		wantGeoJSON bool
+	}{
+		"successful created travel with points": {
+			contentType: "application/json",
+			body:        `{"from": {"latitude": 1, "longitude": 2}, "to": {"latitude": -1, "longitude": -2}}`,
+		},
+
+		"successful created travel with GeoJSON points": {
+			contentType: "application/json",
+			body: `{"from": {"type": "Point", "coordinates": [2, 1]}, ` +
+				`"to": {"type": "Point", "coordinates": [-2, -1]}}`,
+		},
+
+		"successful created travel as GeoJSON by content type": {
+			contentType: "application/geo+json; charset=utf-8",
+			body: `{"from": {"type": "Point", "coordinates": [2, 1]}, ` +
+				`"to": {"type": "Point", "coordinates": [-2, -1]}}`,
+			wantGeoJSON: true,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Method: http.MethodPost,
+				URL:    &url.URL{},
+				Header: http.Header{"Content-Type": []string{tc.contentType}},
+				Body:   ioutil.NopCloser(strings.NewReader(tc.body)),
+			}
+
+			handler := TravelHandler{
+				Travels: travel.NewTravelStorage(newTravelMockDb()),
+			}
+			handler.Create(c)
+
+			assert.Equal(t, http.StatusCreated, w.Code)
+
+			var response map[string]json.RawMessage
+			err := json.Unmarshal(w.Body.Bytes(), &response)
+			assert.Nil(t, err)
+
+			if tc.wantGeoJSON {
+				assert.JSONEq(t, `{"type": "Point", "coordinates": [2, 1]}`, string(response["from"]))
+				assert.JSONEq(t, `{"type": "Point", "coordinates": [-2, -1]}`, string(response["to"]))
+			} else {
+				assert.JSONEq(t, `{"latitude": 1, "longitude": 2}`, string(response["from"]))
+				assert.JSONEq(t, `{"latitude": -1, "longitude": -2}`, string(response["to"]))
+			}
+		})
+	}
+}
+
+func Test_getCurrentTravel(t *testing.T) {
+	dbWithTravels := newTravelMockDbFromMap(map[int64]travel.Travel{
+		1: travel.Travel{
+			ID:     1,
+			Status: travel.StatusInProcess,
+			From: travel.Point{
+				Lat: 1,
+				Lng: 2,
+			},
+			To: travel.Point{
+				Lat: -1,
+				Lng: -2,
+			},
+			UserID: 1,
+		},
+		2: travel.Travel{
+			ID:     2,
+			Status: travel.StatusReady,
+			From: travel.Point{
+				Lat: 1,
+				Lng: 2,
+			},
+			To: travel.Point{
+				Lat: -1,
+				Lng: -2,
+			},
+			UserID: 2,
+		},
+	})
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		userLogged     *jwt.Claims
+		want           travel.Travel
+		wantError      error
+		statusExpected int
+	}{
+		"successful get current travel": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "driver",
+			},
+			want: travel.Travel{
+				ID:     1,
+				Status: travel.StatusInProcess,
+				From: travel.Point{
+					Lat: 1,
+					Lng: 2,
+				},
+				To: travel.Point{
+					Lat: -1,
+					Lng: -2,
+				},
+				UserID: 1,
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful get current travel: driver is free": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			userLogged: &jwt.Claims{
+				UserID: 2,
+				Role:   "driver",
+			},
+			statusExpected: http.StatusNoContent,
+		},
+
+		"failure due to non user logged in": {
+			travelStorage:  travel.NewTravelStorage(dbWithTravels),
+			wantError:      errors.New("invalid_user_access - cannot identify user logged in"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"failure due to storage error": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb().onGetByUser(1, errors.New("mocked storage error"))),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "driver",
+			},
+			wantError:      errors.New("storage_failure - an error ocurred trying to get travel"),
+			statusExpected: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			if tc.userLogged != nil {
+				c.Set("user_on_call", *tc.userLogged)
+			}
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+			}
+			handler.GetCurrent(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else if tc.statusExpected == http.StatusOK {
+				response := travel.Travel{}
+
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, response)
+			} else {
+				assert.Empty(t, w.Body.Bytes())
+			}
+		})
+	}
+}
+
+func Test_getTravelsByUser(t *testing.T) {
+	newTravel := func(id int64, status travel.Status, userID int64) travel.Travel {
+		return travel.Travel{
+			ID:     id,
+			Status: status,
+			From: travel.Point{
+				Lat: 1,
+				Lng: 2,
+			},
+			To: travel.Point{
+				Lat: -1,
+				Lng: -2,
+			},
+			UserID: userID,
+		}
+	}
+
+	dbWithTravels := newTravelMockDbFromMap(map[int64]travel.Travel{
+		1: newTravel(1, travel.StatusReady, 1),
+		2: newTravel(2, travel.StatusInProcess, 1),
+		3: newTravel(3, travel.StatusReady, 2),
+	})
+
+	type response struct {
+		Total   int64           `json:"total"`
+		Pending int64           `json:"pending"`
+		Result  []travel.Travel `json:"result"`
+	}
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		id             string
+		urlParams      map[string]string
+		userLogged     *jwt.Claims
+		want           response
+		wantError      error
+		statusExpected int
+	}{
+		"successful get travels by user from admin": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			id:            "1",
+			urlParams:     map[string]string{},
+			userLogged: &jwt.Claims{
+				UserID: 5,
+				Role:   "admin",
+			},
+			want: response{
+				Total:  2,
+				Result: []travel.Travel{newTravel(1, travel.StatusReady, 1), newTravel(2, travel.StatusInProcess, 1)},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful get own travels by status from driver": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			id:            "1",
+			urlParams: map[string]string{
+				"status": "ready",
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "driver",
+			},
+			want: response{
+				Total:  1,
+				Result: []travel.Travel{newTravel(1, travel.StatusReady, 1)},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful get travels by user with pagination": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			id:            "1",
+			urlParams: map[string]string{
+				"limit":  "1",
+				"offset": "0",
+			},
+			userLogged: &jwt.Claims{
+				UserID: 5,
+				Role:   "admin",
+			},
+			want: response{
+				Total:   2,
+				Pending: 1,
+				Result:  []travel.Travel{newTravel(1, travel.StatusReady, 1)},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure get travels of another user from driver": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			id:            "2",
+			urlParams:     map[string]string{},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "driver",
+			},
+			wantError:      errors.New("invalid_user_access - the user logged in cannot search travels of another user"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"failure get travels by user: invalid id": {
+			travelStorage:  travel.NewTravelStorage(dbWithTravels),
+			id:             "a",
+			urlParams:      map[string]string{},
+			wantError:      errors.New("invalid_request - the request has not a user id to search travels"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure get travels by user: invalid status": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			id:            "1",
+			urlParams: map[string]string{
+				"status": "unknown",
+			},
+			userLogged: &jwt.Claims{
+				UserID: 5,
+				Role:   "admin",
+			},
+			wantError:      errors.New("invalid_status - invalid status received to search"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure get travels by user: invalid limit": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			id:            "1",
+			urlParams: map[string]string{
+				"limit": "0",
+			},
+			userLogged: &jwt.Claims{
+				UserID: 5,
+				Role:   "admin",
+			},
+			wantError:      errors.New("invalid_request - invalid search limit received"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure get travels by user: storage error": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb().onSearch(errors.New("mocked storage error"))),
+			id:            "1",
+			urlParams:     map[string]string{},
+			userLogged: &jwt.Claims{
+				UserID: 5,
+				Role:   "admin",
+			},
+			wantError:      errors.New("storage_failure - an error ocurred trying to get travel"),
+			statusExpected: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+
+			req := &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			q := req.URL.Query()
+			for k, v := range tc.urlParams {
+				q.Add(k, v)
+			}
+			req.URL.RawQuery = q.Encode()
+			c.Request = req
+			c.Params = []gin.Param{{Key: "id", Value: tc.id}}
+
+			if tc.userLogged != nil {
+				c.Set("user_on_call", *tc.userLogged)
+			}
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+			}
+			handler.GetByUser(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var resp response
+				err := json.Unmarshal(w.Body.Bytes(), &resp)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, resp)
+			}
+		})
+	}
+}
+
+func Test_listTravels(t *testing.T) {
+	newTravel := func(id int64, status travel.Status, lat, lng float64) travel.Travel {
+		return travel.Travel{
+			ID:     id,
+			Status: status,
+			From: travel.Point{
+				Lat: lat,
+				Lng: lng,
+			},
+			To: travel.Point{
+				Lat: -1,
+				Lng: -2,
+			},
+		}
+	}
+
+	deletedAt := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	deletedTravel := newTravel(4, travel.StatusPending, -34.60, -58.38)
+	deletedTravel.DeletedAt = &deletedAt
+
+	deadline := time.Now().UTC().Add(-time.Hour).Truncate(time.Second)
+	overdueTravel := newTravel(5, travel.StatusInProcess, -1, -1)
+	overdueTravel.Deadline = &deadline
+
+	dbWithTravels := newTravelMockDbFromMap(map[int64]travel.Travel{
+		1: newTravel(1, travel.StatusPending, -34.60, -58.38),
+		2: newTravel(2, travel.StatusPending, -34.90, -56.16),
+		3: newTravel(3, travel.StatusReady, -34.61, -58.39),
+		4: deletedTravel,
+		5: overdueTravel,
+	})
+
+	type response struct {
+		Total   int64           `json:"total"`
+		Pending int64           `json:"pending"`
+		Result  []travel.Travel `json:"result"`
+	}
+
+	admin := &jwt.Claims{UserID: 1, Role: "admin"}
+	driver := &jwt.Claims{UserID: 2, Role: "driver"}
+	dispatcher := &jwt.Claims{UserID: 3, Role: "dispatcher"}
+
+	testscases := map[string]struct {
+		urlParams      map[string]string
+		userLogged     *jwt.Claims
+		want           response
+		wantError      error
+		statusExpected int
+	}{
+		"successful list travels including deleted from admin": {
+			urlParams:  map[string]string{"include_deleted": "true"},
+			userLogged: admin,
+			want: response{
+				Total: 5,
+				Result: []travel.Travel{
+					newTravel(1, travel.StatusPending, -34.60, -58.38),
+					newTravel(2, travel.StatusPending, -34.90, -56.16),
+					newTravel(3, travel.StatusReady, -34.61, -58.39),
+					deletedTravel,
+					overdueTravel,
+				},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful list travels with fields from admin": {
+			urlParams:  map[string]string{"fields": "id,status"},
+			userLogged: admin,
+			want: response{
+				Total: 4,
+				Result: []travel.Travel{
+					{ID: 1, Status: travel.StatusPending},
+					{ID: 2, Status: travel.StatusPending},
+					{ID: 3, Status: travel.StatusReady},
+					{ID: 5, Status: travel.StatusInProcess},
+				},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure list travels including deleted from driver": {
+			urlParams:      map[string]string{"include_deleted": "true"},
+			userLogged:     driver,
+			wantError:      errors.New("invalid_user_access - only admin users can include deleted travels"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"successful list travels from admin": {
+			urlParams:  map[string]string{},
+			userLogged: admin,
+			want: response{
+				Total: 4,
+				Result: []travel.Travel{
+					newTravel(1, travel.StatusPending, -34.60, -58.38),
+					newTravel(2, travel.StatusPending, -34.90, -56.16),
+					newTravel(3, travel.StatusReady, -34.61, -58.39),
+					overdueTravel,
+				},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful list overdue travels from admin": {
+			urlParams:  map[string]string{"overdue": "true"},
+			userLogged: admin,
+			want: response{
+				Total:  1,
+				Result: []travel.Travel{overdueTravel},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure list travels: invalid overdue": {
+			urlParams:      map[string]string{"overdue": "maybe"},
+			userLogged:     admin,
+			wantError:      errors.New("invalid_request - invalid search overdue received"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"successful list travels near a location from admin": {
+			urlParams: map[string]string{
+				"near":      "-34.6,-58.4",
+				"radius_km": "10",
+			},
+			userLogged: admin,
+			want: response{
+				Total: 2,
+				Result: []travel.Travel{
+					newTravel(3, travel.StatusReady, -34.61, -58.39),
+					newTravel(1, travel.StatusPending, -34.60, -58.38),
+				},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful list pending travels near a location from driver": {
+			urlParams: map[string]string{
+				"near":      "-34.6,-58.4",
+				"radius_km": "10",
+			},
+			userLogged: driver,
+			want: response{
+				Total:  1,
+				Result: []travel.Travel{newTravel(1, travel.StatusPending, -34.60, -58.38)},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful list ready travels from dispatcher": {
+			urlParams: map[string]string{
+				"status": "ready",
+			},
+			userLogged: dispatcher,
+			want: response{
+				Total:  1,
+				Result: []travel.Travel{newTravel(3, travel.StatusReady, -34.61, -58.39)},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure list travels: driver searching not pending travels": {
+			urlParams: map[string]string{
+				"status": "ready",
+			},
+			userLogged:     driver,
+			wantError:      errors.New("invalid_user_access - the user logged in can only search pending travels"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"failure list travels: near without radius": {
+			urlParams: map[string]string{
+				"near": "-34.6,-58.4",
+			},
+			userLogged:     admin,
+			wantError:      errors.New("invalid_request - invalid search radius received"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure list travels: invalid near": {
+			urlParams: map[string]string{
+				"near":      "-34.6",
+				"radius_km": "10",
+			},
+			userLogged:     admin,
+			wantError:      errors.New("invalid_request - invalid search near location received"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure list travels: near out of coordinates": {
+			urlParams: map[string]string{
+				"near":      "-134.6,-58.4",
+				"radius_km": "10",
+			},
+			userLogged:     admin,
+			wantError:      errors.New("invalid_coordinates - the latitude should be between -90 and 90 and the longitude between -180 and 180"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure list travels: invalid radius": {
+			urlParams: map[string]string{
+				"near":      "-34.6,-58.4",
+				"radius_km": "-1",
+			},
+			userLogged:     admin,
+			wantError:      errors.New("invalid_radius - the search radius should be greater than 0 and at most 500 km"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure list travels: non user logged in": {
+			urlParams:      map[string]string{},
+			wantError:      errors.New("invalid_user_access - cannot identify user logged in"),
+			statusExpected: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+
+			req := &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			q := req.URL.Query()
+			for k, v := range tc.urlParams {
+				q.Add(k, v)
+			}
+			req.URL.RawQuery = q.Encode()
+			c.Request = req
+
+			if tc.userLogged != nil {
+				c.Set("user_on_call", *tc.userLogged)
+			}
+
+			handler := TravelHandler{
+				Travels: travel.NewTravelStorage(dbWithTravels),
+			}
+			handler.List(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var resp response
+				err := json.Unmarshal(w.Body.Bytes(), &resp)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, resp)
+			}
+		})
+	}
+}
+
+// mockTeams are the members of the teams on the mocked travel searches: the users 5 and 6 are members of the team
+// 1, and the user 7 of the team 2
+var mockTeams = map[int64][]int64{1: {5, 6}, 2: {7}}
+
+// mockTeamMember return if the user is a member of any of the teams
+func mockTeamMember(userID int64, teamIDs ...int64) bool {
+	for _, teamID := range teamIDs {
+		for _, member := range mockTeams[teamID] {
+			if member == userID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mockTeamFinder return the teams of the users from mockTeams
+type mockTeamFinder struct{}
+
+func (finder mockTeamFinder) UserTeams(ctx context.Context, userID int64) ([]int64, error) {
+	var teamIDs []int64
+	for teamID := range mockTeams {
+		if mockTeamMember(userID, teamID) {
+			teamIDs = append(teamIDs, teamID)
+		}
+	}
+
+	return teamIDs, nil
+}
+
+func Test_listTeamTravels(t *testing.T) {
+	dbWithTravels := newTravelMockDbFromMap(map[int64]travel.Travel{
+		1: {ID: 1, Status: travel.StatusInProcess, UserID: 5},
+		2: {ID: 2, Status: travel.StatusInProcess, UserID: 7},
+		3: {ID: 3, Status: travel.StatusPending},
+	})
+
+	testscases := map[string]struct {
+		urlParams      map[string]string
+		userLogged     jwt.Claims
+		want           []int64
+		wantError      error
+		statusExpected int
+	}{
+		"successful list travels of team from admin": {
+			urlParams:      map[string]string{"team_id": "2"},
+			userLogged:     jwt.Claims{UserID: 1, Role: "admin"},
+			want:           []int64{2},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful list travels from dispatcher member of a team": {
+			urlParams:      map[string]string{},
+			userLogged:     jwt.Claims{UserID: 6, Role: "dispatcher"},
+			want:           []int64{1, 3},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful list travels from dispatcher without team": {
+			urlParams:      map[string]string{},
+			userLogged:     jwt.Claims{UserID: 8, Role: "dispatcher"},
+			want:           []int64{1, 2, 3},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure list travels: invalid team": {
+			urlParams:      map[string]string{"team_id": "0"},
+			userLogged:     jwt.Claims{UserID: 1, Role: "admin"},
+			wantError:      errors.New("invalid_request - invalid search team received"),
+			statusExpected: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+
+			req := &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			q := req.URL.Query()
+			for k, v := range tc.urlParams {
+				q.Add(k, v)
+			}
+			req.URL.RawQuery = q.Encode()
+			c.Request = req
+			c.Set("user_on_call", tc.userLogged)
+
+			handler := TravelHandler{
+				Travels: travel.NewTravelStorage(dbWithTravels, travel.WithTeamFinder(mockTeamFinder{})),
+			}
+			handler.List(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var resp struct {
+					Result []travel.Travel `json:"result"`
+				}
+				err := json.Unmarshal(w.Body.Bytes(), &resp)
+				assert.Nil(t, err)
+
+				var ids []int64
+				for _, trv := range resp.Result {
+					ids = append(ids, trv.ID)
+				}
+				assert.Equal(t, tc.want, ids)
+			}
+		})
+	}
+}
+
+func Test_listPendingTravelsByPriority(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	newTravel := func(id int64, priority travel.Priority, age time.Duration) travel.Travel {
+		return travel.Travel{
+			ID:        id,
+			Status:    travel.StatusPending,
+			From:      travel.Point{Lat: -34.60, Lng: -58.38},
+			To:        travel.Point{Lat: -1, Lng: -2},
+			Priority:  priority,
+			CreatedAt: now.Add(-age),
+		}
+	}
+
+	db := newTravelMockDbFromMap(map[int64]travel.Travel{
+		1: newTravel(1, travel.PriorityLow, 3*time.Hour),
+		2: newTravel(2, travel.PriorityNormal, time.Hour),
+		3: newTravel(3, travel.PriorityHigh, 0),
+		4: newTravel(4, travel.PriorityNormal, 2*time.Hour),
+	})
+
+	testscases := map[string]struct {
+		urlParams  map[string]string
+		userLogged jwt.Claims
+		want       []int64
+	}{
+		"pending travels from admin are listed by priority and age": {
+			urlParams:  map[string]string{"status": "pending"},
+			userLogged: jwt.Claims{UserID: 1, Role: "admin"},
+			want:       []int64{3, 4, 2, 1},
+		},
+
+		"travels from driver are listed by priority and age": {
+			urlParams:  map[string]string{},
+			userLogged: jwt.Claims{UserID: 2, Role: "driver"},
+			want:       []int64{3, 4, 2, 1},
+		},
+
+		"travels from admin without status are listed by id": {
+			urlParams:  map[string]string{},
+			userLogged: jwt.Claims{UserID: 1, Role: "admin"},
+			want:       []int64{1, 2, 3, 4},
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+
+			req := &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			q := req.URL.Query()
+			for k, v := range tc.urlParams {
+				q.Add(k, v)
+			}
+			req.URL.RawQuery = q.Encode()
+			c.Request = req
+			c.Set("user_on_call", tc.userLogged)
+
+			handler := TravelHandler{
+				Travels: travel.NewTravelStorage(db),
+			}
+			handler.List(c)
+
+			assert.Equal(t, http.StatusOK, w.Code)
+
+			var resp struct {
+				Result []travel.Travel `json:"result"`
+			}
+			err := json.Unmarshal(w.Body.Bytes(), &resp)
+			assert.Nil(t, err)
+
+			var ids []int64
+			for _, trv := range resp.Result {
+				ids = append(ids, trv.ID)
+			}
+			assert.Equal(t, tc.want, ids)
+		})
+	}
+}
+
+func Test_travelHeatmap(t *testing.T) {
+	day := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	db := newTravelMockDbFromMap(map[int64]travel.Travel{
+		1: {ID: 1, Status: travel.StatusPending, CreatedAt: day},
+		2: {ID: 2, Status: travel.StatusReady, CreatedAt: day.AddDate(0, 0, 1)},
+	})
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		urlParams      map[string]string
+		wantCells      int
+		wantError      error
+		statusExpected int
+	}{
+		"successful travel heatmap of a day": {
+			travelStorage:  travel.NewTravelStorage(db),
+			urlParams:      map[string]string{"from": "2021-12-01", "to": "2021-12-01", "precision": "6", "window": "day"},
+			wantCells:      1,
+			statusExpected: http.StatusOK,
+		},
+
+		"successful travel heatmap of two days": {
+			travelStorage:  travel.NewTravelStorage(db),
+			urlParams:      map[string]string{"from": "2021-12-01", "to": "2021-12-02"},
+			wantCells:      2,
+			statusExpected: http.StatusOK,
+		},
+
+		"failure travel heatmap: invalid from": {
+			travelStorage:  travel.NewTravelStorage(db),
+			urlParams:      map[string]string{"from": "yesterday"},
+			wantError:      errors.New("invalid_request - invalid heatmap from date received"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure travel heatmap: precision is not a number": {
+			travelStorage:  travel.NewTravelStorage(db),
+			urlParams:      map[string]string{"precision": "high"},
+			wantError:      errors.New("invalid_request - invalid heatmap precision received"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure travel heatmap: invalid window": {
+			travelStorage:  travel.NewTravelStorage(db),
+			urlParams:      map[string]string{"window": "week"},
+			wantError:      errors.New("invalid_window - the heatmap window should be hour or day"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure travel heatmap: db error": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb().onSearch(errors.New("mocked db error"))),
+			urlParams:      map[string]string{},
+			wantError:      errors.New("storage_failure - an error ocurred trying to get travel"),
+			statusExpected: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+
+			req := &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			q := req.URL.Query()
+			for k, v := range tc.urlParams {
+				q.Add(k, v)
+			}
+			req.URL.RawQuery = q.Encode()
+			c.Request = req
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+			}
+			handler.Heatmap(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var response travel.Heatmap
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Len(t, response.Cells, tc.wantCells)
+				assert.Equal(t, "2021-12-01T00:00:00Z", response.From.Format(time.RFC3339))
+			}
+		})
+	}
+}
+
+func Test_driverEarnings(t *testing.T) {
+	completedAt := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	point := travel.Point{Lat: -34.6037, Lng: -58.3816}
+	db := newTravelMockDbFromMap(map[int64]travel.Travel{
+		1: {ID: 1, Status: travel.StatusReady, UserID: 5, From: point, To: point, CompletedAt: &completedAt},
+		2: {ID: 2, Status: travel.StatusInProcess, UserID: 5, From: point, To: point},
+	})
+
+	driver := jwt.Claims{UserID: 5, Role: user.RoleDriver}
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		urlParam       []gin.Param
+		urlParams      map[string]string
+		userLogged     jwt.Claims
+		wantTotal      float64
+		wantPeriods    int
+		wantError      error
+		statusExpected int
+	}{
+		"successful own earnings by day": {
+			travelStorage:  travel.NewTravelStorage(db),
+			urlParam:       []gin.Param{{Key: "id", Value: "5"}},
+			urlParams:      map[string]string{"from": "2021-12-01", "to": "2021-12-02"},
+			userLogged:     driver,
+			wantTotal:      100,
+			wantPeriods:    2,
+			statusExpected: http.StatusOK,
+		},
+
+		"successful driver earnings by week as admin": {
+			travelStorage:  travel.NewTravelStorage(db),
+			urlParam:       []gin.Param{{Key: "id", Value: "5"}},
+			urlParams:      map[string]string{"from": "2021-12-01", "to": "2021-12-14", "period": "week"},
+			userLogged:     jwt.Claims{UserID: 1, Role: user.RoleAdmin},
+			wantTotal:      100,
+			wantPeriods:    3,
+			statusExpected: http.StatusOK,
+		},
+
+		"failure driver earnings: earnings of another user": {
+			travelStorage:  travel.NewTravelStorage(db),
+			urlParam:       []gin.Param{{Key: "id", Value: "6"}},
+			urlParams:      map[string]string{},
+			userLogged:     driver,
+			wantError:      errors.New("invalid_user_access - the user logged in cannot get the earnings of another user"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"failure driver earnings: invalid id": {
+			travelStorage:  travel.NewTravelStorage(db),
+			urlParam:       []gin.Param{{Key: "id", Value: "a"}},
+			urlParams:      map[string]string{},
+			userLogged:     driver,
+			wantError:      errors.New("invalid_request - the request has not a user id to get its earnings"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure driver earnings: invalid from": {
+			travelStorage:  travel.NewTravelStorage(db),
+			urlParam:       []gin.Param{{Key: "id", Value: "5"}},
+			urlParams:      map[string]string{"from": "yesterday"},
+			userLogged:     driver,
+			wantError:      errors.New("invalid_request - invalid earnings from date received"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure driver earnings: invalid period": {
+			travelStorage:  travel.NewTravelStorage(db),
+			urlParam:       []gin.Param{{Key: "id", Value: "5"}},
+			urlParams:      map[string]string{"period": "month"},
+			userLogged:     driver,
+			wantError:      errors.New("invalid_period - the earnings period should be day or week"),
+			statusExpected: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+
+			req := &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			q := req.URL.Query()
+			for k, v := range tc.urlParams {
+				q.Add(k, v)
+			}
+			req.URL.RawQuery = q.Encode()
+			c.Request = req
+			c.Params = tc.urlParam
+			c.Set("user_on_call", tc.userLogged)
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+			}
+			handler.Earnings(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var response travel.Earnings
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, int64(5), response.UserID)
+				assert.Equal(t, tc.wantTotal, response.Total)
+				assert.Len(t, response.Periods, tc.wantPeriods)
+			}
+		})
+	}
+}
+
+func Test_travelStats(t *testing.T) {
+	today := time.Now().UTC()
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		urlParams      map[string]string
+		wantCreated    []travel.DayCount
+		wantError      error
+		statusExpected int
+	}{
+		"successful travel stats with default days": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: {ID: 1, Status: travel.StatusPending, CreatedAt: today},
+				2: {ID: 2, Status: travel.StatusReady, CreatedAt: today},
+			})),
+			urlParams:      map[string]string{},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful travel stats with days": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: {ID: 1, Status: travel.StatusPending, CreatedAt: today},
+				2: {ID: 2, Status: travel.StatusReady, CreatedAt: today},
+			})),
+			urlParams: map[string]string{"days": "2"},
+			wantCreated: []travel.DayCount{
+				{Date: today.AddDate(0, 0, -1).Format("2006-01-02"), Count: 0},
+				{Date: today.Format("2006-01-02"), Count: 2},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure travel stats: days is not a number": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb()),
+			urlParams:      map[string]string{"days": "week"},
+			wantError:      errors.New("invalid_request - invalid days received"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure travel stats: invalid days": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb()),
+			urlParams:      map[string]string{"days": "365"},
+			wantError:      errors.New("invalid_days - the stats days should be between 1 and 90"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure travel stats: db error": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb().onSearch(errors.New("mocked db error"))),
+			urlParams:      map[string]string{},
+			wantError:      errors.New("storage_failure - an error ocurred trying to get travel"),
+			statusExpected: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+
+			req := &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			q := req.URL.Query()
+			for k, v := range tc.urlParams {
+				q.Add(k, v)
+			}
+			req.URL.RawQuery = q.Encode()
+			c.Request = req
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+			}
+			handler.Stats(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var response travel.Stats
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, int64(1), response.CountByStatus[travel.StatusPending])
+				assert.Equal(t, int64(1), response.CountByStatus[travel.StatusReady])
+				if tc.wantCreated != nil {
+					assert.Equal(t, tc.wantCreated, response.CreatedPerDay)
+				} else {
+					assert.Len(t, response.CreatedPerDay, travel.DefaultStatsDays)
+				}
+			}
+		})
+	}
+}
+
+func Test_exportTravels(t *testing.T) {
+	createdAt := time.Date(2021, 12, 10, 15, 4, 5, 0, time.UTC)
+	dbWithTravels := newTravelMockDbFromMap(map[int64]travel.Travel{
+		1: travel.Travel{
+			ID:        1,
+			Status:    travel.StatusReady,
+			From:      travel.Point{Lat: 1.5, Lng: 2},
+			To:        travel.Point{Lat: -1, Lng: -2.25},
+			UserID:    3,
+			CreatedAt: createdAt,
+		},
+		2: travel.Travel{
+			ID:        2,
+			Status:    travel.StatusPending,
+			From:      travel.Point{Lat: 1, Lng: 2},
+			To:        travel.Point{Lat: -1, Lng: -2},
+			CreatedAt: createdAt.AddDate(0, 0, 2),
+		},
+	})
+
+	const header = "id,status,from_latitude,from_longitude,to_latitude,to_longitude,user_id,created_at\n"
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		urlParams      map[string]string
+		want           string
+		wantError      error
+		statusExpected int
+	}{
+		"successful export all travels": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			urlParams:     map[string]string{},
+			want: header +
+				"1,ready,1.5,2,-1,-2.25,3,2021-12-10T15:04:05Z\n" +
+				"2,pending,1,2,-1,-2,0,2021-12-12T15:04:05Z\n",
+			statusExpected: http.StatusOK,
+		},
+
+		"successful export travels by status and dates": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			urlParams: map[string]string{
+				"status": "ready",
+				"from":   "2021-12-10",
+				"to":     "2021-12-10",
+			},
+			want:           header + "1,ready,1.5,2,-1,-2.25,3,2021-12-10T15:04:05Z\n",
+			statusExpected: http.StatusOK,
+		},
+
+		"successful export without travels": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			urlParams: map[string]string{
+				"from": "2022-01-01",
+			},
+			want:           header,
+			statusExpected: http.StatusOK,
+		},
+
+		"failure export travels: invalid from date": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			urlParams: map[string]string{
+				"from": "10/12/2021",
+			},
+			wantError:      errors.New("invalid_request - invalid export from date received"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure export travels: invalid status": {
+			travelStorage: travel.NewTravelStorage(dbWithTravels),
+			urlParams: map[string]string{
+				"status": "unknown",
+			},
+			wantError:      errors.New("invalid_status - invalid status received to search"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure export travels: storage error": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb().onSearch(errors.New("mocked storage error"))),
+			urlParams:      map[string]string{},
+			wantError:      errors.New("storage_failure - an error ocurred trying to get travel"),
+			statusExpected: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+
+			req := &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			q := req.URL.Query()
+			for k, v := range tc.urlParams {
+				q.Add(k, v)
+			}
+			req.URL.RawQuery = q.Encode()
+			c.Request = req
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+			}
+			handler.Export(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				assert.Equal(t, "text/csv", w.Header().Get("Content-Type"))
+				assert.Equal(t, tc.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func Test_editTravel(t *testing.T) {
+	userDB := newMockDB()
+	_, _ = userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			ID:    1,
+			Email: "an_email@hotmail.com",
+			Role:  "driver",
+		},
+	})
+	_, _ = userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			ID:    2,
+			Email: "another_email@hotmail.com",
+			Role:  "driver",
+		},
+	})
+	_, _ = userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			ID:    5,
+			Email: "another2_email@hotmail.com",
+			Role:  "driver",
+		},
+	})
+	userDB = userDB.onGet(3, user.ErrUserNotFound)
+	storageWithUser := user.NewUserStorage(userDB)
+
+	newTravel := func(id int64, fromLat, fromLng, toLat, toLng float64, status travel.Status, userID int64) travel.Travel {
+		return travel.Travel{
+			ID:     id,
+			Status: status,
+			From: travel.Point{
+				Lat: fromLat,
+				Lng: fromLng,
+			},
+			To: travel.Point{
+				Lat: toLat,
+				Lng: toLng,
+			},
+			UserID: userID,
+		}
+	}
+
+	createURLParam := func(id string) []gin.Param {
+		return []gin.Param{
+			{
+				Key:   "id",
+				Value: id,
+			},
+		}
+	}
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		urlParam       []gin.Param
+		userLogged     *jwt.Claims
+		body           map[string]interface{}
+		want           travel.Travel
+		wantError      error
+		statusExpected int
+	}{
+		"successful edit travel without user: change location": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, -100, 70, 2, 20, travel.StatusPending, 0)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"status": "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			want: travel.Travel{
+				ID:     1,
+				Status: "pending",
+				From: travel.Point{
+					Lat: 1,
+					Lng: 2,
+				},
+				To: travel.Point{
+					Lat: -1,
+					Lng: -2,
+				},
+				UserID: 0,
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful edit travel with user: change location": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, -100, 70, 2, 20, travel.StatusPending, 0)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"user_id": 1,
+				"status":  "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			want: travel.Travel{
+				ID:     1,
+				Status: "pending",
+				From: travel.Point{
+					Lat: 1,
+					Lng: 2,
+				},
+				To: travel.Point{
+					Lat: -1,
+					Lng: -2,
+				},
+				UserID: 1,
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful edit travel with user: change status": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 0)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"user_id": 1,
+				"status":  "in_process",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			want: travel.Travel{
+				ID:     1,
+				Status: "in_process",
+				From: travel.Point{
+					Lat: 1,
+					Lng: 2,
+				},
+				To: travel.Point{
+					Lat: -1,
+					Lng: -2,
+				},
+				UserID: 1,
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful edit travel by admin with one user to another user due to it is in pending status": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 2)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"user_id": 5,
+				"status":  "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			want: travel.Travel{
+				ID:     1,
+				Status: "pending",
+				From: travel.Point{
+					Lat: 1,
+					Lng: 2,
+				},
+				To: travel.Point{
+					Lat: -1,
+					Lng: -2,
+				},
+				UserID: 5,
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure edit travel by driver with one user to another user, no matter if it is pending": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 2)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "driver",
+			},
+			body: map[string]interface{}{
+				"user_id": 5,
+				"status":  "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("invalid_user_access - the user logged in cannot perform this action, he is not the owner of the travel or it is not an admin"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"failure travel update: change initial status without user on db travel": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 0)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"status": "in_process",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("invalid_user - invalid user while performing update"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure travel update: change locations in no pending status": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 0)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"status": "in_process",
+				"from": map[string]float64{
+					"latitude":  10,
+					"longitude": 20,
+				},
+				"to": map[string]float64{
+					"latitude":  -10,
+					"longitude": -20,
+				},
+			},
+			wantError:      errors.New("invalid_user - invalid user while performing update"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure travel update: change user id in no pending status": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusInProcess, 1)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 2,
+				Role:   "driver",
+			},
+			body: map[string]interface{}{
+				"user_id": 2,
+				"status":  "in_process",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("invalid_user_access - the user logged in cannot perform this action, he is not the owner of the travel or it is not an admin"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"failure travel update: no user id in no pending status": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusInProcess, 2)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"status": "in_process",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("invalid_user - invalid user while performing update"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure travel update: pending to ready": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 1)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"user_id": 1,
+				"status":  "ready",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("invalid_status - invalid received status"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure travel update: in process to pending": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusInProcess, 1)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"user_id": 1,
+				"status":  "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("invalid_status - invalid received status"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to invalid request: no id": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb()),
+			wantError:      errors.New("invalid_request - the request has not a travel id to update"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to invalid request: no location": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
+			urlParam:      createURLParam("1"),
+			body: map[string]interface{}{
+				"status": "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+			},
+			wantError:      errors.New("invalid_request - there was an error with fields: to.latitude,to.longitude"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to storage error on get": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb().onGet(1, travel.ErrStorageGet)),
+			urlParam:      createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"user_id": 1,
+				"status":  "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("storage_failure - an error ocurred trying to get travel"),
+			statusExpected: http.StatusInternalServerError,
+		},
+
+		"failure due to storage error on update": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 1)}).
+				onUpdate(1, travel.ErrStorageUpdate)),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"user_id": 1,
+				"status":  "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("storage_failure - an error ocurred trying to update travel"),
+			statusExpected: http.StatusInternalServerError,
+		},
+
+		"failure due to user assigned to another travel": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 0),
+				2: newTravel(2, 1, 2, -1, -2, travel.StatusInProcess, 1)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"user_id": 1,
+				"status":  "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("driver_not_available - the user is already assigned to another pending or in process travel"),
+			statusExpected: http.StatusConflict,
+		},
+
+		"failure due to non existent travel": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb().onGet(4, travel.ErrTravelNotFound)),
+			urlParam:      createURLParam("4"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"user_id": 1,
+				"status":  "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("not_found_travel - not founded the travel to get"),
+			statusExpected: http.StatusNotFound,
+		},
+
+		"failure due to non existent user": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusInProcess, 1)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			body: map[string]interface{}{
+				"user_id": 3,
+				"status":  "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("invalid_travel_user - the user received was not found"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to non user logged in": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusInProcess, 1)})),
+			urlParam: createURLParam("1"),
+			body: map[string]interface{}{
+				"user_id": 1,
+				"status":  "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("invalid_user_access - cannot identify user logged in"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"failure due to the user who is logged in is not an admin and is not the owner of the travel": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, 1, 2, -1, -2, travel.StatusInProcess, 2)})),
+			urlParam: createURLParam("1"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "driver",
+			},
+			body: map[string]interface{}{
+				"user_id": 1,
+				"status":  "pending",
+				"from": map[string]float64{
+					"latitude":  1,
+					"longitude": 2,
+				},
+				"to": map[string]float64{
+					"latitude":  -1,
+					"longitude": -2,
+				},
+			},
+			wantError:      errors.New("invalid_user_access - the user logged in cannot perform this action, he is not the owner of the travel or it is not an admin"),
+			statusExpected: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+			c.Params = tc.urlParam
+
+			if tc.userLogged != nil {
+				c.Set("user_on_call", *tc.userLogged)
+			}
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+				Users:   storageWithUser,
+			}
+			handler.Edit(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := travel.Travel{}
+
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want.From.Lat, response.From.Lat)
+				assert.Equal(t, tc.want.From.Lng, response.From.Lng)
+				assert.Equal(t, tc.want.Status, response.Status)
+				assert.Equal(t, tc.want.UserID, response.UserID)
+				assert.Greater(t, response.ID, int64(0))
+			}
+		})
+	}
+}
+
+func Test_rateTravel(t *testing.T) {
+	newTravel := func(id int64, status travel.Status, userID int64) travel.Travel {
+		return travel.Travel{
+			ID:     id,
+			Status: status,
+			From: travel.Point{
+				Lat: 1,
+				Lng: 2,
+			},
+			To: travel.Point{
+				Lat: -1,
+				Lng: -2,
+			},
+			UserID: userID,
+		}
+	}
+
+	createURLParam := func(id string) []gin.Param {
+		return []gin.Param{
+			{
+				Key:   "id",
+				Value: id,
+			},
+		}
+	}
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		urlParam       []gin.Param
+		body           map[string]interface{}
+		want           travel.Rating
+		wantError      error
+		statusExpected int
+	}{
+		"successful rate travel": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusReady, 2)})),
+			urlParam: createURLParam("1"),
+			body: map[string]interface{}{
+				"score":   4,
+				"comment": "on time",
+			},
+			want: travel.Rating{
+				TravelID: 1,
+				UserID:   2,
+				Score:    4,
+				Comment:  "on time",
+			},
+			statusExpected: http.StatusCreated,
+		},
+
+		"failure due to invalid request: no id": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb()),
+			body:           map[string]interface{}{"score": 4},
+			wantError:      errors.New("invalid_request - the request has not a travel id to rate"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to invalid request: no score": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb()),
+			urlParam:       createURLParam("1"),
+			body:           map[string]interface{}{"comment": "on time"},
+			wantError:      errors.New("invalid_request - there was an error with fields: score"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to invalid score": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusReady, 2)})),
+			urlParam:       createURLParam("1"),
+			body:           map[string]interface{}{"score": 10},
+			wantError:      errors.New("invalid_rating - the rating score should be between 1 and 5"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to travel not ready": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusPending, 2)})),
+			urlParam:       createURLParam("1"),
+			body:           map[string]interface{}{"score": 4},
+			wantError:      errors.New("invalid_status - only ready travels can be rated"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to travel already rated": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusReady, 2)}).onRate(travel.ErrRatingDuplicated)),
+			urlParam:       createURLParam("1"),
+			body:           map[string]interface{}{"score": 4},
+			wantError:      errors.New("already_rated - the travel was already rated"),
+			statusExpected: http.StatusConflict,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+			c.Params = tc.urlParam
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+			}
+			handler.Rate(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var response travel.Rating
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, response)
+			}
+		})
+	}
+}
+
+func Test_batchTravelStatus(t *testing.T) {
+	type batchStatusResponse struct {
+		ID         int64          `json:"id"`
+		StatusCode int            `json:"status_code"`
+		Travel     *travel.Travel `json:"travel,omitempty"`
+		Error      *apiError      `json:"error,omitempty"`
+	}
+
+	newDB := func() *travelMockDb {
+		return newTravelMockDbFromMap(map[int64]travel.Travel{
+			1: {ID: 1, Status: travel.StatusInProcess, UserID: 2},
+			2: {ID: 2, Status: travel.StatusPending},
+			3: {ID: 3, Status: travel.StatusReady, UserID: 3},
+		})
+	}
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		body           map[string]interface{}
+		want           []batchStatusResponse
+		wantError      error
+		statusExpected int
+	}{
+		"successful batch status: ready with per travel results": {
+			travelStorage: travel.NewTravelStorage(newDB()),
+			body: map[string]interface{}{
+				"ids":    []int64{1, 2, 10},
+				"status": "ready",
+			},
+			want: []batchStatusResponse{
+				{ID: 1, StatusCode: http.StatusOK, Travel: &travel.Travel{ID: 1, Status: travel.StatusReady, UserID: 2}},
+				{ID: 2, StatusCode: http.StatusBadRequest, Error: &apiError{Code: "invalid_user", Message: "invalid user while performing update"}},
+				{ID: 10, StatusCode: http.StatusInternalServerError, Error: &apiError{Code: "storage_failure", Message: "an error ocurred trying to get travel"}},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful batch status: cancelled": {
+			travelStorage: travel.NewTravelStorage(newDB()),
+			body: map[string]interface{}{
+				"ids":    []int64{1, 2, 3},
+				"status": "cancelled",
+			},
+			want: []batchStatusResponse{
+				{ID: 1, StatusCode: http.StatusOK, Travel: &travel.Travel{ID: 1, Status: travel.StatusCancelled, UserID: 2}},
+				{ID: 2, StatusCode: http.StatusOK, Travel: &travel.Travel{ID: 2, Status: travel.StatusCancelled}},
+				{ID: 3, StatusCode: http.StatusBadRequest, Error: &apiError{Code: "invalid_status", Message: "only pending or in process travels can be cancelled"}},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure batch status: no ids": {
+			travelStorage: travel.NewTravelStorage(newDB()),
+			body: map[string]interface{}{
+				"status": "ready",
+			},
+			wantError:      errors.New("invalid_request - there was an error with fields: ids"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure batch status: empty ids": {
+			travelStorage: travel.NewTravelStorage(newDB()),
+			body: map[string]interface{}{
+				"ids":    []int64{},
+				"status": "ready",
+			},
+			wantError:      errors.New("invalid_batch - the batch should have between 1 and 100 travel ids"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure batch status: invalid status": {
+			travelStorage: travel.NewTravelStorage(newDB()),
+			body: map[string]interface{}{
+				"ids":    []int64{1},
+				"status": "finished",
+			},
+			wantError:      errors.New("invalid_status - invalid received status"),
+			statusExpected: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+			c.Set("user_on_call", jwt.Claims{UserID: 1, Role: "admin"})
+
+			err := mockJson(c, http.MethodPut, tc.body)
+			assert.Nil(t, err)
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+			}
+			handler.BatchStatus(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var response struct {
+					Results []batchStatusResponse `json:"results"`
+				}
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				// the completion date is set when the travels are ready
+				for _, result := range response.Results {
+					if result.Travel != nil && result.Travel.Status == travel.StatusReady {
+						assert.NotNil(t, result.Travel.CompletedAt)
+						result.Travel.CompletedAt = nil
+					}
+				}
+				assert.Equal(t, tc.want, response.Results)
+			}
+		})
+	}
+}
+
+func Test_reassignTravel(t *testing.T) {
+	userDB := newMockDB()
+	_, _ = userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "a_driver@hotmail.com",
+			Role:  "driver",
+		},
+	})
+	_, _ = userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "another_driver@hotmail.com",
+			Role:  "driver",
+		},
+	})
+	_, _ = userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "an_admin@hotmail.com",
+			Role:  "admin",
+		},
+	})
+	userDB = userDB.onGet(4, user.ErrUserNotFound)
+	// a suspended driver
+	userDB.users[5] = user.User{SecuredUser: user.SecuredUser{ID: 5, Email: "a_suspended_driver@hotmail.com", Role: "driver"}}
+	storageWithUser := user.NewUserStorage(userDB)
+
+	newTravel := func(id int64, status travel.Status, userID int64) travel.Travel {
+		return travel.Travel{
+			ID:     id,
+			Status: status,
+			From:   travel.Point{Lat: 1, Lng: 2},
+			To:     travel.Point{Lat: -1, Lng: -2},
+			UserID: userID,
+		}
+	}
+
+	createURLParam := func(id string) []gin.Param {
+		return []gin.Param{
+			{
+				Key:   "id",
+				Value: id,
+			},
+		}
+	}
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		urlParam       gin.Params
+		body           map[string]interface{}
+		want           travel.Travel
+		wantError      error
+		statusExpected int
+	}{
+		"successful reassign to another driver": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusInProcess, 1)})),
+			urlParam: createURLParam("1"),
+			body: map[string]interface{}{
+				"user_id": 2,
+				"reason":  "the car broke down",
+			},
+			want:           newTravel(1, travel.StatusInProcess, 2),
+			statusExpected: http.StatusOK,
+		},
+
+		"successful reassign back to pending": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusInProcess, 1)})),
+			urlParam: createURLParam("1"),
+			body: map[string]interface{}{
+				"reason": "the driver is sick",
+			},
+			want:           newTravel(1, travel.StatusPending, 0),
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to invalid request: no reason": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDb()),
+			urlParam:      createURLParam("1"),
+			body: map[string]interface{}{
+				"user_id": 2,
+			},
+			wantError:      errors.New("invalid_request - there was an error with fields: reason"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to non existent user": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusInProcess, 1)})),
+			urlParam: createURLParam("1"),
+			body: map[string]interface{}{
+				"user_id": 4,
+				"reason":  "the car broke down",
+			},
+			wantError:      errors.New("invalid_travel_user - the user received was not found"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to user not a driver": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusInProcess, 1)})),
+			urlParam: createURLParam("1"),
+			body: map[string]interface{}{
+				"user_id": 3,
+				"reason":  "the car broke down",
+			},
+			wantError:      errors.New("invalid_travel_user - the user received is not a driver"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to suspended driver": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusInProcess, 1)})),
+			urlParam: createURLParam("1"),
+			body: map[string]interface{}{
+				"user_id": 5,
+				"reason":  "the car broke down",
+			},
+			wantError:      errors.New("invalid_travel_user - the user received is suspended"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to driver not free": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusInProcess, 1),
+				2: newTravel(2, travel.StatusPending, 2)})),
+			urlParam: createURLParam("1"),
+			body: map[string]interface{}{
+				"user_id": 2,
+				"reason":  "the car broke down",
+			},
+			wantError:      errors.New("driver_not_available - the user is already assigned to another pending or in process travel"),
+			statusExpected: http.StatusConflict,
+		},
+
+		"failure due to travel not in process": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusPending, 1)})),
+			urlParam: createURLParam("1"),
+			body: map[string]interface{}{
+				"reason": "the driver is sick",
+			},
+			wantError:      errors.New("invalid_status - only in process travels can be reassigned"),
+			statusExpected: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+			c.Params = tc.urlParam
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+				Users:   storageWithUser,
+			}
+			handler.Reassign(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := travel.Travel{}
+
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want.ID, response.ID)
+				assert.Equal(t, tc.want.Status, response.Status)
+				assert.Equal(t, tc.want.UserID, response.UserID)
+			}
+		})
+	}
+}
+
+func Test_offerTravel(t *testing.T) {
+	userDB := newMockDB()
+	_, _ = userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "a_driver@hotmail.com",
+			Role:  "driver",
+		},
+	})
+	_, _ = userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "an_admin@hotmail.com",
+			Role:  "admin",
+		},
+	})
+	userDB = userDB.onGet(3, user.ErrUserNotFound)
+	storageWithUser := user.NewUserStorage(userDB)
+
+	newDB := func() *travelMockDb {
+		return newTravelMockDbFromMap(map[int64]travel.Travel{
+			1: {ID: 1, Status: travel.StatusPending},
+			2: {ID: 2, Status: travel.StatusInProcess, UserID: 4},
+		})
+	}
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		urlParam       []gin.Param
+		body           map[string]interface{}
+		want           travel.Travel
+		wantError      error
+		statusExpected int
+	}{
+		"successful offer travel": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{"user_id": 1},
+			want:           travel.Travel{ID: 1, Status: travel.StatusOffered, UserID: 1},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure offer travel: travel not pending": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			urlParam:       []gin.Param{{Key: "id", Value: "2"}},
+			body:           map[string]interface{}{"user_id": 1},
+			wantError:      errors.New("invalid_status - only pending travels without user can be offered"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure offer travel: user is not a driver": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{"user_id": 2},
+			wantError:      errors.New("invalid_travel_user - the user received is not a driver"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure offer travel: user not found": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{"user_id": 3},
+			wantError:      errors.New("invalid_travel_user - the user received was not found"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure offer travel: no user": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{},
+			wantError:      errors.New("invalid_request - there was an error with fields: user_id"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure offer travel: invalid id": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			urlParam:       []gin.Param{{Key: "id", Value: "one"}},
+			body:           map[string]interface{}{"user_id": 1},
+			wantError:      errors.New("invalid_request - the request has not a travel id to offer"),
+			statusExpected: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+			c.Params = tc.urlParam
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+				Users:   storageWithUser,
+			}
+			handler.Offer(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := travel.Travel{}
+
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want.ID, response.ID)
+				assert.Equal(t, tc.want.Status, response.Status)
+				assert.Equal(t, tc.want.UserID, response.UserID)
+				assert.NotNil(t, response.OfferExpiresAt)
+			}
+		})
+	}
+}
+
+func Test_travelQueue(t *testing.T) {
+	userDB := newMockDB()
+	_, _ = userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "a_driver@hotmail.com",
+			Role:  "driver",
+		},
+	})
+	_, _ = userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "another_driver@hotmail.com",
+			Role:  "driver",
+		},
+	})
+	storageWithUser := user.NewUserStorage(userDB)
+
+	position := 1
+	newDB := func() *travelMockDb {
+		return newTravelMockDbFromMap(map[int64]travel.Travel{
+			1: {ID: 1, Status: travel.StatusPending},
+			2: {ID: 2, Status: travel.StatusInProcess, UserID: 1},
+			3: {ID: 3, Status: travel.StatusQueued, UserID: 1, QueuePosition: &position},
+		})
+	}
+
+	admin := jwt.Claims{UserID: 9, Role: user.RoleAdmin}
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		action         func(h TravelHandler) gin.HandlerFunc
+		urlParam       []gin.Param
+		body           map[string]interface{}
+		userLogged     jwt.Claims
+		want           interface{}
+		wantError      error
+		statusExpected int
+	}{
+		"successful queue travel": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			action:         func(h TravelHandler) gin.HandlerFunc { return h.Enqueue },
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{"user_id": 1},
+			userLogged:     admin,
+			want:           map[string]interface{}{"id": 1, "status": "queued", "user_id": 1, "queue_position": 2},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure queue travel: driver without in process travel": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			action:         func(h TravelHandler) gin.HandlerFunc { return h.Enqueue },
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{"user_id": 2},
+			userLogged:     admin,
+			wantError:      errors.New("driver_not_in_process - only drivers with an in process travel can have queued travels"),
+			statusExpected: http.StatusConflict,
+		},
+
+		"failure queue travel: queue full": {
+			travelStorage:  travel.NewTravelStorage(newDB(), travel.WithQueueSize(1)),
+			action:         func(h TravelHandler) gin.HandlerFunc { return h.Enqueue },
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{"user_id": 1},
+			userLogged:     admin,
+			wantError:      errors.New("queue_full - the driver queue is full"),
+			statusExpected: http.StatusConflict,
+		},
+
+		"failure queue travel: no user": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			action:         func(h TravelHandler) gin.HandlerFunc { return h.Enqueue },
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{},
+			userLogged:     admin,
+			wantError:      errors.New("invalid_request - there was an error with fields: user_id"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"successful dequeue travel": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			action:         func(h TravelHandler) gin.HandlerFunc { return h.Dequeue },
+			urlParam:       []gin.Param{{Key: "id", Value: "3"}},
+			userLogged:     admin,
+			want:           map[string]interface{}{"id": 3, "status": "pending", "user_id": 0},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure dequeue travel: travel not queued": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			action:         func(h TravelHandler) gin.HandlerFunc { return h.Dequeue },
+			urlParam:       []gin.Param{{Key: "id", Value: "2"}},
+			userLogged:     admin,
+			wantError:      errors.New("invalid_status - the travel is not queued"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"successful get own queue": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			action:         func(h TravelHandler) gin.HandlerFunc { return h.GetQueue },
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			userLogged:     jwt.Claims{UserID: 1, Role: user.RoleDriver},
+			want:           []int64{3},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful get empty queue": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			action:         func(h TravelHandler) gin.HandlerFunc { return h.GetQueue },
+			urlParam:       []gin.Param{{Key: "id", Value: "2"}},
+			userLogged:     admin,
+			want:           []int64{},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure get queue of another driver": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			action:         func(h TravelHandler) gin.HandlerFunc { return h.GetQueue },
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			userLogged:     jwt.Claims{UserID: 2, Role: user.RoleDriver},
+			wantError:      errors.New("invalid_user_access - the user logged in cannot search travels of another user"),
+			statusExpected: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+			c.Params = tc.urlParam
+			c.Set("user_on_call", tc.userLogged)
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+				Users:   storageWithUser,
+			}
+			tc.action(handler)(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+				return
+			}
+
+			switch want := tc.want.(type) {
+			case []int64:
+				var response struct {
+					UserID  int64           `json:"user_id"`
+					Travels []travel.Travel `json:"travels"`
+				}
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				ids := []int64{}
+				for _, trv := range response.Travels {
+					ids = append(ids, trv.ID)
+				}
+				assert.Equal(t, want, ids)
+			case map[string]interface{}:
+				response := map[string]interface{}{}
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				for key, value := range want {
+					assert.EqualValues(t, value, response[key], key)
+				}
+			}
+		})
+	}
+}
+
+func Test_answerTravelOffer(t *testing.T) {
+	newDB := func() *travelMockDb {
+		expiresAt := time.Now().UTC().Add(time.Minute)
+		return newTravelMockDbFromMap(map[int64]travel.Travel{
+			1: {ID: 1, Status: travel.StatusOffered, UserID: 5, OfferExpiresAt: &expiresAt},
+		})
+	}
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		accept         bool
+		urlParam       []gin.Param
+		userLogged     *jwt.Claims
+		want           travel.Travel
+		wantError      error
+		statusExpected int
+	}{
+		"successful accept travel offer": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			accept:         true,
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			userLogged:     &jwt.Claims{UserID: 5, Role: "driver"},
+			want:           travel.Travel{ID: 1, Status: travel.StatusPending, UserID: 5},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful reject travel offer": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			userLogged:     &jwt.Claims{UserID: 5, Role: "driver"},
+			want:           travel.Travel{ID: 1, Status: travel.StatusPending},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure accept travel offer: offered to another driver": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			accept:         true,
+			urlParam:       []gin.Param{{Key: "id", Value: "1"}},
+			userLogged:     &jwt.Claims{UserID: 6, Role: "driver"},
+			wantError:      errors.New("invalid_user_access - the travel was offered to another user"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"failure reject travel offer: invalid id": {
+			travelStorage:  travel.NewTravelStorage(newDB()),
+			urlParam:       []gin.Param{{Key: "id", Value: "one"}},
+			userLogged:     &jwt.Claims{UserID: 5, Role: "driver"},
+			wantError:      errors.New("invalid_request - the request has not a travel id to answer its offer"),
+			statusExpected: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+			c.Params = tc.urlParam
+
+			if tc.userLogged != nil {
+				c.Set("user_on_call", *tc.userLogged)
+			}
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+			}
+			if tc.accept {
+				handler.Accept(c)
+			} else {
+				handler.Reject(c)
+			}
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := travel.Travel{}
+
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, response)
+			}
+		})
+	}
+}
+
+func Test_deleteAndRestoreTravel(t *testing.T) {
+	deletedAt := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	newTravel := func(id int64, status travel.Status, deletedAt *time.Time) travel.Travel {
+		return travel.Travel{
+			ID:        id,
+			Status:    status,
+			From:      travel.Point{Lat: 1, Lng: 2},
+			To:        travel.Point{Lat: -1, Lng: -2},
+			DeletedAt: deletedAt,
+		}
+	}
+
+	createURLParam := func(id string) []gin.Param {
+		return []gin.Param{
+			{
+				Key:   "id",
+				Value: id,
+			},
+		}
+	}
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		restore        bool
+		urlParam       gin.Params
+		want           travel.Travel
+		wantError      error
+		statusExpected int
+	}{
+		"successful delete travel": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusPending, nil)})),
+			urlParam:       createURLParam("1"),
+			statusExpected: http.StatusNoContent,
+		},
+
+		"failure delete an in process travel": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusInProcess, nil)})),
+			urlParam:       createURLParam("1"),
+			wantError:      errors.New("invalid_status - in process and queued travels cannot be deleted"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure delete an already deleted travel": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusPending, &deletedAt)})),
+			urlParam:       createURLParam("1"),
+			wantError:      errors.New("not_found_travel - not founded the travel to get"),
+			statusExpected: http.StatusNotFound,
+		},
+
+		"failure delete due to invalid request: no id": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb()),
+			wantError:      errors.New("invalid_request - the request has not a travel id to delete"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"successful restore travel": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusPending, &deletedAt)})),
+			restore:        true,
+			urlParam:       createURLParam("1"),
+			want:           newTravel(1, travel.StatusPending, nil),
+			statusExpected: http.StatusOK,
+		},
+
+		"failure restore a not deleted travel": {
+			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: newTravel(1, travel.StatusPending, nil)})),
+			restore:        true,
+			urlParam:       createURLParam("1"),
+			wantError:      errors.New("not_deleted_travel - the travel to restore is not deleted"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure restore due to storage error": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb().onGet(1, errors.New("mocked storage error"))),
+			restore:        true,
+			urlParam:       createURLParam("1"),
+			wantError:      errors.New("storage_failure - an error ocurred trying to get travel"),
+			statusExpected: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+			c.Params = tc.urlParam
+
+			handler := TravelHandler{
+				Travels: tc.travelStorage,
+			}
+			if tc.restore {
+				handler.Restore(c)
+			} else {
+				handler.Delete(c)
+			}
+			// the status is written by the response recorder only after flushing the headers
+			c.Writer.WriteHeaderNow()
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else if tc.restore {
+				response := travel.Travel{}
+
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, response)
+			}
+		})
+	}
+}
+
+func hasTag(trv travel.Travel, tag string) bool {
+	for _, t := range trv.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// memoryFileStore an attachments store keeping the files on memory
+type memoryFileStore map[string][]byte
+
+func (store memoryFileStore) Put(ctx context.Context, key string, content []byte, contentType string) error {
+	store[key] = content
+	return nil
+}
+
+func Test_attachTravel(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+
+	createURLParam := func(id string) []gin.Param {
+		return []gin.Param{
+			{
+				Key:   "id",
+				Value: id,
+			},
+		}
+	}
+
+	testscases := map[string]struct {
+		urlParam       []gin.Param
+		kind           string
+		file           []byte
+		userLogged     *jwt.Claims
+		wantError      error
+		statusExpected int
+	}{
+		"successful attach photo": {
+			urlParam:       createURLParam("1"),
+			kind:           "photo",
+			file:           png,
+			userLogged:     &jwt.Claims{UserID: 5, Role: "driver"},
+			statusExpected: http.StatusCreated,
+		},
 
-		"failure due to storage error on get": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDb().onGet(1, travel.ErrStorageGet)),
-			urlParam:      createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
-			},
-			body: map[string]interface{}{
-				"user_id": 1,
-				"status":  "pending",
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
-			},
-			wantError:      errors.New("storage_failure - an error ocurred trying to get travel"),
-			statusExpected: http.StatusInternalServerError,
+		"failure attach: without file": {
+			urlParam:       createURLParam("1"),
+			kind:           "photo",
+			userLogged:     &jwt.Claims{UserID: 5, Role: "driver"},
+			wantError:      errors.New("invalid_request - the request has not an attachment file"),
+			statusExpected: http.StatusBadRequest,
 		},
 
-		"failure due to storage error on update": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusPending, 1)}).
-				onUpdate(1, travel.ErrStorageUpdate)),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
-			},
-			body: map[string]interface{}{
-				"user_id": 1,
-				"status":  "pending",
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
-			},
-			wantError:      errors.New("storage_failure - an error ocurred trying to update travel"),
-			statusExpected: http.StatusInternalServerError,
+		"failure attach: invalid kind": {
+			urlParam:       createURLParam("1"),
+			kind:           "video",
+			file:           png,
+			userLogged:     &jwt.Claims{UserID: 5, Role: "driver"},
+			wantError:      errors.New("invalid_attachment - the attachment kind should be photo or signature"),
+			statusExpected: http.StatusBadRequest,
 		},
 
-		"failure due to non existent travel": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDb().onGet(4, travel.ErrTravelNotFound)),
-			urlParam:      createURLParam("4"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
-			},
-			body: map[string]interface{}{
-				"user_id": 1,
-				"status":  "pending",
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
-			},
-			wantError:      errors.New("not_found_travel - not founded the travel to get"),
-			statusExpected: http.StatusNotFound,
+		"failure attach: not the travel driver": {
+			urlParam:   createURLParam("1"),
+			kind:       "photo",
+			file:       png,
+			userLogged: &jwt.Claims{UserID: 6, Role: "driver"},
+			wantError: errors.New("invalid_user_access - the user logged in cannot perform this action, he is " +
+				"not the owner of the travel or it is not an admin"),
+			statusExpected: http.StatusUnauthorized,
 		},
 
-		"failure due to non existent user": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusInProcess, 1)})),
-			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
-			},
-			body: map[string]interface{}{
-				"user_id": 3,
-				"status":  "pending",
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
-			},
-			wantError:      errors.New("invalid_travel_user - the user received was not found"),
+		"failure attach: invalid id": {
+			urlParam:       createURLParam("a"),
+			kind:           "photo",
+			file:           png,
+			userLogged:     &jwt.Claims{UserID: 5, Role: "driver"},
+			wantError:      errors.New("invalid_request - the request has not a travel id to attach"),
 			statusExpected: http.StatusBadRequest,
 		},
+	}
 
-		"failure due to non user logged in": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusInProcess, 1)})),
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			db := newTravelMockDbFromMap(map[int64]travel.Travel{
+				1: {ID: 1, Status: travel.StatusInProcess, UserID: 5},
+			})
+			store := memoryFileStore{}
+
+			body := &bytes.Buffer{}
+			form := multipart.NewWriter(body)
+			assert.Nil(t, form.WriteField("kind", tc.kind))
+			if tc.file != nil {
+				part, err := form.CreateFormFile("file", "proof.png")
+				assert.Nil(t, err)
+				_, err = part.Write(tc.file)
+				assert.Nil(t, err)
+			}
+			assert.Nil(t, form.Close())
+
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/v1/travels/1/attachments", body)
+			c.Request.Header.Set("Content-Type", form.FormDataContentType())
+			c.Params = tc.urlParam
+
+			if tc.userLogged != nil {
+				c.Set("user_on_call", *tc.userLogged)
+			}
+
+			handler := TravelHandler{
+				Travels: travel.NewTravelStorage(db, travel.WithAttachmentStore(store)),
+			}
+			handler.Attach(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+				assert.Empty(t, store)
+			} else {
+				var response travel.Attachment
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, int64(1), response.TravelID)
+				assert.Equal(t, int64(5), response.UserID)
+				assert.Equal(t, travel.AttachmentPhoto, response.Kind)
+				assert.Equal(t, "image/png", response.ContentType)
+				assert.Equal(t, tc.file, store[response.Key])
+				assert.Equal(t, []travel.Attachment{response}, db.attachments)
+			}
+		})
+	}
+}
+
+func Test_travelLocations(t *testing.T) {
+	recordedAt := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	createURLParam := func(id string) []gin.Param {
+		return []gin.Param{
+			{
+				Key:   "id",
+				Value: id,
+			},
+		}
+	}
+
+	type traceResponse struct {
+		TravelID  int64               `json:"travel_id"`
+		Locations []travel.TracePoint `json:"locations"`
+	}
+
+	db := newTravelMockDbFromMap(map[int64]travel.Travel{
+		1: {ID: 1, Status: travel.StatusInProcess, UserID: 5},
+	})
+	handler := TravelHandler{
+		Travels: travel.NewTravelStorage(db),
+	}
+
+	reportcases := map[string]struct {
+		urlParam       []gin.Param
+		body           map[string]interface{}
+		userLogged     *jwt.Claims
+		want           travel.TracePoint
+		wantError      error
+		statusExpected int
+	}{
+		"successful report location": {
 			urlParam: createURLParam("1"),
 			body: map[string]interface{}{
-				"user_id": 1,
-				"status":  "pending",
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
+				"location":    map[string]interface{}{"latitude": -34.6, "longitude": -58.4},
+				"recorded_at": recordedAt,
 			},
-			wantError:      errors.New("invalid_user_access - cannot identify user logged in"),
-			statusExpected: http.StatusUnauthorized,
+			userLogged: &jwt.Claims{UserID: 5, Role: "driver"},
+			want: travel.TracePoint{ID: 1, TravelID: 1, UserID: 5, Location: travel.Point{Lat: -34.6, Lng: -58.4},
+				RecordedAt: recordedAt},
+			statusExpected: http.StatusCreated,
 		},
 
-		"failure due to the user who is logged in is not an admin and is not the owner of the travel": {
-			travelStorage: travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{
-				1: newTravel(1, 1, 2, -1, -2, travel.StatusInProcess, 2)})),
+		"failure report location: without location": {
+			urlParam:       createURLParam("1"),
+			body:           map[string]interface{}{"recorded_at": recordedAt},
+			userLogged:     &jwt.Claims{UserID: 5, Role: "driver"},
+			wantError:      errors.New("invalid_request - there was an error with fields: location.latitude,location.longitude"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure report location: not the travel driver": {
 			urlParam: createURLParam("1"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "driver",
-			},
 			body: map[string]interface{}{
-				"user_id": 1,
-				"status":  "pending",
-				"from": map[string]float64{
-					"latitude":  1,
-					"longitude": 2,
-				},
-				"to": map[string]float64{
-					"latitude":  -1,
-					"longitude": -2,
-				},
+				"location": map[string]interface{}{"latitude": -34.6, "longitude": -58.4},
 			},
-			wantError:      errors.New("invalid_user_access - the user logged in cannot perform this action, he is not the owner of the travel or it is not an admin"),
+			userLogged: &jwt.Claims{UserID: 6, Role: "driver"},
+			wantError: errors.New("invalid_user_access - the user logged in cannot perform this action, he is " +
+				"not the owner of the travel or it is not an admin"),
 			statusExpected: http.StatusUnauthorized,
 		},
 	}
 
-	for name, tc := range testscases {
+	for name, tc := range reportcases {
 		t.Run(name, func(t *testing.T) {
 			w := httptest.NewRecorder()
 
@@ -966,11 +4395,7 @@ func Test_editTravel(t *testing.T) {
 				c.Set("user_on_call", *tc.userLogged)
 			}
 
-			handler := TravelHandler{
-				Travels: tc.travelStorage,
-				Users:   storageWithUser,
-			}
-			handler.Edit(c)
+			handler.ReportLocation(c)
 
 			assert.Equal(t, tc.statusExpected, w.Code)
 
@@ -981,17 +4406,125 @@ func Test_editTravel(t *testing.T) {
 
 				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
 			} else {
-				response := travel.Travel{}
+				var response travel.TracePoint
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, response)
+			}
+		})
+	}
+
+	tracecases := map[string]struct {
+		urlParam       []gin.Param
+		want           traceResponse
+		wantError      error
+		statusExpected int
+	}{
+		"successful get travel locations": {
+			urlParam: createURLParam("1"),
+			want: traceResponse{
+				TravelID: 1,
+				Locations: []travel.TracePoint{{ID: 1, TravelID: 1, UserID: 5,
+					Location: travel.Point{Lat: -34.6, Lng: -58.4}, RecordedAt: recordedAt}},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure get travel locations: invalid id": {
+			urlParam:       createURLParam("a"),
+			wantError:      errors.New("invalid_request - the request has not a travel id to get locations"),
+			statusExpected: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range tracecases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+			c.Params = tc.urlParam
+
+			handler.Trace(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
 
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var response traceResponse
 				err := json.Unmarshal(w.Body.Bytes(), &response)
 				assert.Nil(t, err)
 
-				assert.Equal(t, tc.want.From.Lat, response.From.Lat)
-				assert.Equal(t, tc.want.From.Lng, response.From.Lng)
-				assert.Equal(t, tc.want.Status, response.Status)
-				assert.Equal(t, tc.want.UserID, response.UserID)
-				assert.Greater(t, response.ID, int64(0))
+				assert.Equal(t, tc.want, response)
 			}
 		})
 	}
 }
+
+func Test_travelTracking(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	db := newTravelMockDbFromMap(map[int64]travel.Travel{
+		1: {ID: 1, UUID: "a-uuid", Status: travel.StatusPending, UserID: 5},
+	})
+	handler := TravelHandler{
+		Travels: travel.NewTravelStorage(db),
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = &http.Request{
+		Header: make(http.Header),
+	}
+	c.Params = []gin.Param{{Key: "id", Value: "1"}}
+	c.Set("user_on_call", jwt.Claims{UserID: 1, Role: "admin"})
+
+	handler.ShareTracking(c)
+
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var link travel.TrackingLink
+	err := json.Unmarshal(w.Body.Bytes(), &link)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, link.Token)
+
+	// the tracking link is public: it is authorized by its token
+	_, router := gin.CreateTestContext(httptest.NewRecorder())
+	router.GET("/v1/track/:token", handler.Track)
+
+	track := func(token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(http.MethodGet, "/v1/track/"+token, nil)
+
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	w = track(link.Token)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var view travel.TrackingView
+	err = json.Unmarshal(w.Body.Bytes(), &view)
+	assert.Nil(t, err)
+	assert.Equal(t, "a-uuid", view.UUID)
+	assert.Equal(t, travel.Status(travel.StatusPending), view.Status)
+	assert.NotContains(t, w.Body.String(), "user_id")
+
+	w = track("an-invalid-token")
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	var apiErr apiError
+	err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+	assert.Nil(t, err)
+	assert.Equal(t, "invalid_tracking", apiErr.Code)
+}
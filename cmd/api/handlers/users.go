@@ -7,6 +7,8 @@ import (
 	"github.com/gin-gonic/gin"
 	"github.com/go-playground/validator/v10"
 	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/travel"
 	"github.com/nicocarolo/space-drivers/internal/user"
 	"net/http"
 	"strconv"
@@ -15,13 +17,33 @@ import (
 
 type UsersStorage interface {
 	Get(ctx context.Context, id int64) (user.SecuredUser, error)
+	IDByUUID(ctx context.Context, publicID string) (int64, error)
 	Save(ctx context.Context, user user.User) (user.SecuredUser, error)
-	Login(ctx context.Context, user user.User) (string, error)
+	Update(ctx context.Context, user user.SecuredUser) (user.SecuredUser, error)
+	Delete(ctx context.Context, id int64) error
+	ChangePassword(ctx context.Context, id int64, change user.PasswordChange) error
+	ChangeStatus(ctx context.Context, id int64, change user.StatusChange) (user.SecuredUser, error)
+	Login(ctx context.Context, user user.User) (user.Session, error)
+	LoginWithScope(ctx context.Context, user user.User, scope string) (user.Session, error)
+	LoginTwoFactor(ctx context.Context, challenge, code string) (user.Session, error)
+	Refresh(ctx context.Context, refreshToken string) (user.Session, error)
+	EnrollTwoFactor(ctx context.Context) (user.TwoFactorEnrollment, error)
+	ConfirmTwoFactor(ctx context.Context, code string) error
 	Search(ctx context.Context, opt ...user.SearchOption) ([]user.SecuredUser, user.Metadata, error)
+	List(ctx context.Context, opt ...user.SearchOption) ([]user.SecuredUser, user.Metadata, error)
+	Invite(ctx context.Context, invitation user.Invitation) (user.Invitation, error)
+	AcceptInvitation(ctx context.Context, token string, acceptance user.InvitationAcceptance) (user.SecuredUser, error)
+	ErasePersonalData(ctx context.Context, id int64) error
+	GetPreferences(ctx context.Context, userID int64) (user.Preferences, error)
+	UpdatePreferences(ctx context.Context, userID int64, changes user.Preferences) (user.Preferences, error)
+	ListSessions(ctx context.Context) ([]user.UserSession, error)
+	RevokeSession(ctx context.Context, id int64) error
+	Impersonate(ctx context.Context, id int64) (user.Impersonation, error)
 }
 
 type UserHandler struct {
-	Users UsersStorage
+	Users   UsersStorage
+	Travels TravelStorage
 }
 
 // Get handler will parse received id as url param and get the user from storage
@@ -29,8 +51,8 @@ func (h UserHandler) Get(c *gin.Context) {
 	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
 	if err != nil {
 		c.JSON(http.StatusBadRequest, apiError{
-			Code:        "invalid_request",
-			Description: "the request has not a user id to get",
+			Code:    "invalid_request",
+			Message: "the request has not a user id to get",
 		})
 		return
 	}
@@ -45,44 +67,131 @@ func (h UserHandler) Get(c *gin.Context) {
 	c.JSON(http.StatusOK, userResp)
 }
 
-// GetDrivers get driver by status, or pagination
-// ?status={status}&limit={pageNumber}&offset={pageSize}
+// Me handler will get the user logged in with its preferences. Users that work on their own travels (drivers) also get the travel they are
+// currently assigned to, if any
+func (h UserHandler) Me(c *gin.Context) {
+	claims, ok := loggedUser(c)
+	if !ok {
+		log.Error(c, "there was an error getting logged in user from context on get me")
+		code, resp := mapUserError(user.ErrInvalidUserClaims)
+		c.JSON(code, resp)
+		return
+	}
+
+	userResp, err := h.Users.Get(c, claims.UserID)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	preferences, err := h.Users.GetPreferences(c, claims.UserID)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	response := map[string]interface{}{
+		"user":        userResp,
+		"preferences": preferences,
+	}
+
+	if user.ClaimsPermissions(claims).Has(user.PermissionTravelOwn) {
+		current, err := h.Travels.GetCurrent(c, claims.UserID)
+		if err != nil && !errors.Is(err, travel.ErrNotFoundTravel) {
+			code, resp := mapTravelError(err)
+			c.JSON(code, resp)
+			return
+		}
+		if err == nil {
+			response["travel"] = travelView(c, current)
+		}
+	}
+
+	c.JSON(http.StatusOK, response)
+}
+
+// GetDrivers get driver by status (free drivers can be filtered by zone), or pagination, filtered by team and min
+// rating
+// ?status={status}&zone_id={zoneID}&team_id={teamID}&min_rating={minRating}&limit={pageNumber}&offset={pageSize}&fields={fields}
 func (h UserHandler) GetDrivers(c *gin.Context) {
 	status := c.Query("status")
+	zoneID := c.Query("zone_id")
+	teamID := c.Query("team_id")
+	minRating := c.Query("min_rating")
 	limit := c.Query("limit")
 	offset := c.Query("offset")
 
 	var searchOptions []user.SearchOption
 	// validate status
-	if status != "" /* && status != user.StatusSearchBusy */ && status != user.StatusSearchFree {
-		// currently only free drivers search available
+	if status != "" && status != user.StatusSearchBusy && status != user.StatusSearchFree {
 		c.JSON(http.StatusBadRequest, apiError{
-			Code:        "invalid_request",
-			Description: "invalid search status received",
+			Code:    "invalid_request",
+			Message: "invalid search status received",
 		})
 		return
 	}
 
 	// if status received
 	if status != "" {
-		// cannot receive limit and offset with status search
-		if limit != "" || offset != "" {
+		// cannot receive limit and offset with busy search
+		if status == user.StatusSearchBusy && (limit != "" || offset != "") {
 			c.JSON(http.StatusBadRequest, apiError{
-				Code:        "invalid_request",
-				Description: "search free driver do not accept limit or offset param",
+				Code:    "invalid_request",
+				Message: "search busy driver do not accept limit or offset param",
 			})
 			return
 		}
 		searchOptions = append(searchOptions, user.WithStatus(user.StatusSearch(status)))
 	}
 
+	// parse zone if it was received, only free drivers can be searched by zone
+	if zoneID != "" {
+		zoneIDNmbr, err := strconv.ParseInt(zoneID, 10, 64)
+		if err != nil || zoneIDNmbr <= 0 || status != user.StatusSearchFree {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid search zone received, it is only accepted with free status",
+			})
+			return
+		}
+		searchOptions = append(searchOptions, user.WithZone(zoneIDNmbr))
+	}
+
+	// parse team if it was received
+	if teamID != "" {
+		teamIDNmbr, err := strconv.ParseInt(teamID, 10, 64)
+		if err != nil || teamIDNmbr <= 0 {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid search team received",
+			})
+			return
+		}
+		searchOptions = append(searchOptions, user.WithTeam(teamIDNmbr))
+	}
+
+	// parse min rating if it was received, it should be a valid rating score
+	if minRating != "" {
+		minRatingNmbr, err := strconv.ParseFloat(minRating, 64)
+		if err != nil || minRatingNmbr < 1 || minRatingNmbr > 5 {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid search min rating received, it should be between 1 and 5",
+			})
+			return
+		}
+		searchOptions = append(searchOptions, user.WithMinRating(minRatingNmbr))
+	}
+
 	// parse limit if it was received
 	if limit != "" {
 		limitNmbr, err := strconv.ParseInt(limit, 10, 64)
 		if err != nil || limitNmbr == 0 {
 			c.JSON(http.StatusBadRequest, apiError{
-				Code:        "invalid_request",
-				Description: "invalid search limit received",
+				Code:    "invalid_request",
+				Message: "invalid search limit received",
 			})
 			return
 		}
@@ -94,8 +203,8 @@ func (h UserHandler) GetDrivers(c *gin.Context) {
 		offsetNmbr, err := strconv.ParseInt(offset, 10, 64)
 		if err != nil {
 			c.JSON(http.StatusBadRequest, apiError{
-				Code:        "invalid_request",
-				Description: "invalid search offset received",
+				Code:    "invalid_request",
+				Message: "invalid search offset received",
 			})
 			return
 		}
@@ -109,10 +218,82 @@ func (h UserHandler) GetDrivers(c *gin.Context) {
 		return
 	}
 
+	result, err := shapeFields(c, userResp)
+	if err != nil {
+		shapeFieldsError(c, err)
+		return
+	}
+
 	c.JSON(http.StatusOK, map[string]interface{}{
 		"total":   meta.Total,
 		"pending": meta.Pending,
-		"result":  userResp,
+		"result":  result,
+	})
+}
+
+// List get users of any role (or filtered by role) sorted and with pagination, or the user with an email
+// ?role={role}&email={email}&sort={sort}&limit={pageSize}&offset={offset}&fields={fields}
+func (h UserHandler) List(c *gin.Context) {
+	role := c.Query("role")
+	email := c.Query("email")
+	sort := c.Query("sort")
+	limit := c.Query("limit")
+	offset := c.Query("offset")
+
+	var searchOptions []user.SearchOption
+	if role != "" {
+		searchOptions = append(searchOptions, user.WithRole(role))
+	}
+	if email != "" {
+		searchOptions = append(searchOptions, user.WithEmail(email))
+	}
+	if sort != "" {
+		searchOptions = append(searchOptions, user.WithSort(user.UserSort(sort)))
+	}
+
+	// parse limit if it was received
+	if limit != "" {
+		limitNmbr, err := strconv.ParseInt(limit, 10, 64)
+		if err != nil || limitNmbr <= 0 {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid search limit received",
+			})
+			return
+		}
+		searchOptions = append(searchOptions, user.WithLimit(limitNmbr))
+	}
+
+	// parse offset if it was received
+	if offset != "" {
+		offsetNmbr, err := strconv.ParseInt(offset, 10, 64)
+		if err != nil || offsetNmbr < 0 {
+			c.JSON(http.StatusBadRequest, apiError{
+				Code:    "invalid_request",
+				Message: "invalid search offset received",
+			})
+			return
+		}
+		searchOptions = append(searchOptions, user.WithOffset(offsetNmbr))
+	}
+
+	userResp, meta, err := h.Users.List(c, searchOptions...)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	result, err := shapeFields(c, userResp)
+	if err != nil {
+		shapeFieldsError(c, err)
+		return
+	}
+
+	c.JSON(http.StatusOK, map[string]interface{}{
+		"total":   meta.Total,
+		"pending": meta.Pending,
+		"result":  result,
 	})
 }
 
@@ -135,39 +316,454 @@ func (h UserHandler) Create(c *gin.Context) {
 	c.JSON(http.StatusCreated, createdUser)
 }
 
+// Invite handler will parse received body with the email and role to invite, and return the signed invitation
+func (h UserHandler) Invite(c *gin.Context) {
+	var invitation user.Invitation
+	if err := c.ShouldBindJSON(&invitation); err != nil {
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	created, err := h.Users.Invite(c, invitation)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// AcceptInvitation handler will parse received invitation token as url param and the body with the password and
+// profile, and create the invited user
+func (h UserHandler) AcceptInvitation(c *gin.Context) {
+	var acceptance user.InvitationAcceptance
+	if err := c.ShouldBindJSON(&acceptance); err != nil {
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	created, err := h.Users.AcceptInvitation(c, c.Param("token"), acceptance)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, created)
+}
+
+// Edit handler will parse received id as url param and the body with the email and role, and update the user on
+// storage. Drivers can only edit themselves and cannot change their role
+func (h UserHandler) Edit(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a user id to update",
+		})
+		return
+	}
+
+	var userToUpdate user.SecuredUser
+	if err := c.ShouldBindJSON(&userToUpdate); err != nil {
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+	userToUpdate.ID = id
+
+	updatedUser, err := h.Users.Update(c, userToUpdate)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, updatedUser)
+}
+
+// Delete handler will parse received id as url param and soft delete the user on storage
+func (h UserHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a user id to delete",
+		})
+		return
+	}
+
+	if err := h.Users.Delete(c, id); err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// personalDataExport is the personal data of a user: its profile and the data of its travels
+type personalDataExport struct {
+	User        user.SecuredUser `json:"user"`
+	Preferences user.Preferences `json:"preferences"`
+	travel.PersonalData
+}
+
+// ExportPersonalData handler will parse received id as url param and return all the personal data of the user. Users
+// without permission to read users can only export their own data
+func (h UserHandler) ExportPersonalData(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a user id to export its personal data",
+		})
+		return
+	}
+
+	claims, ok := loggedUser(c)
+	if !ok {
+		log.Error(c, "there was an error getting logged in user from context on export user personal data")
+		code, resp := mapUserError(user.ErrInvalidUserClaims)
+		c.JSON(code, resp)
+		return
+	}
+
+	if !user.ClaimsPermissions(claims).Has(user.PermissionUserRead) && claims.UserID != id {
+		log.Info(c, "the user who was logged in cannot export the personal data of another user",
+			log.Int64("user_id", id),
+			log.Int64("logged_user_id", claims.UserID),
+			log.String("logged_role", claims.Role))
+		code, resp := mapUserError(user.ErrInvalidExportAccess)
+		c.JSON(code, resp)
+		return
+	}
+
+	userGet, err := h.Users.Get(c, id)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	preferences, err := h.Users.GetPreferences(c, id)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	data, err := h.Travels.PersonalData(c, id)
+	if err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, personalDataExport{
+		User:         userGet,
+		Preferences:  preferences,
+		PersonalData: data,
+	})
+}
+
+// ErasePersonalData handler will parse received id as url param and anonymize the user and the personal data of its
+// travels, keeping the travels and their statistics
+func (h UserHandler) ErasePersonalData(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a user id to erase its personal data",
+		})
+		return
+	}
+
+	// the user is anonymized first since it checks the user has no active travels, erasing again is safe
+	if err := h.Users.ErasePersonalData(c, id); err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	if err := h.Travels.ErasePersonalData(c, id); err != nil {
+		code, resp := mapTravelError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ChangePassword handler will parse received id as url param and the body with the current and new password, and
+// replace the user password on storage
+func (h UserHandler) ChangePassword(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a user id to change its password",
+		})
+		return
+	}
+
+	var change user.PasswordChange
+	if err := c.ShouldBindJSON(&change); err != nil {
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	if err := h.Users.ChangePassword(c, id, change); err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// ChangeStatus handler will parse received id as url param and the body with the active flag and the reason, and
+// suspend or activate the user on storage
+func (h UserHandler) ChangeStatus(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a user id to change its status",
+		})
+		return
+	}
+
+	var change user.StatusChange
+	if err := c.ShouldBindJSON(&change); err != nil {
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	changedUser, err := h.Users.ChangeStatus(c, id, change)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, changedUser)
+}
+
+// EnrollTwoFactor handler will generate a two factor secret for the user logged in and return it with its
+// provisioning uri, the two factor authentication is enabled once a code is confirmed with ConfirmTwoFactor
+func (h UserHandler) EnrollTwoFactor(c *gin.Context) {
+	enrollment, err := h.Users.EnrollTwoFactor(c)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, enrollment)
+}
+
+// ConfirmTwoFactor handler will parse the body with a code of the enrolled secret and enable the two factor
+// authentication of the user logged in
+func (h UserHandler) ConfirmTwoFactor(c *gin.Context) {
+	var confirmation struct {
+		Code string `json:"code" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&confirmation); err != nil {
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	if err := h.Users.ConfirmTwoFactor(c, confirmation.Code); err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// GetPreferences handler will get the preferences of the user logged in
+func (h UserHandler) GetPreferences(c *gin.Context) {
+	claims, ok := loggedUser(c)
+	if !ok {
+		log.Error(c, "there was an error getting logged in user from context on get preferences")
+		code, resp := mapUserError(user.ErrInvalidUserClaims)
+		c.JSON(code, resp)
+		return
+	}
+
+	preferences, err := h.Users.GetPreferences(c, claims.UserID)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// UpdatePreferences handler will parse received body with the preferences to set (an empty value removes its key)
+// and merge them on the preferences of the user logged in
+func (h UserHandler) UpdatePreferences(c *gin.Context) {
+	claims, ok := loggedUser(c)
+	if !ok {
+		log.Error(c, "there was an error getting logged in user from context on update preferences")
+		code, resp := mapUserError(user.ErrInvalidUserClaims)
+		c.JSON(code, resp)
+		return
+	}
+
+	var changes user.Preferences
+	if err := c.ShouldBindJSON(&changes); err != nil {
+		log.ErrorLimited(c, "there was an error parsing preferences request", log.Err(err))
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the preferences should be an object of string values",
+		})
+		return
+	}
+
+	preferences, err := h.Users.UpdatePreferences(c, claims.UserID, changes)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, preferences)
+}
+
+// ListSessions handler will get the active sessions of the user logged in
+func (h UserHandler) ListSessions(c *gin.Context) {
+	sessions, err := h.Users.ListSessions(c)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": sessions})
+}
+
+// RevokeSession handler will parse received id as url param and revoke that session of the user logged in
+func (h UserHandler) RevokeSession(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a session id to revoke",
+		})
+		return
+	}
+
+	if err := h.Users.RevokeSession(c, id); err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Impersonate handler will parse received id as url param and return a short-lived token to act as that driver
+func (h UserHandler) Impersonate(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a user id to impersonate",
+		})
+		return
+	}
+
+	impersonation, err := h.Users.Impersonate(c, id)
+	if err != nil {
+		code, resp := mapUserError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, impersonation)
+}
+
+// apiError is the envelope of every error response: the code to handle the error, the message to show, the id of
+// the request (set by RequestID when it is empty) and, for the invalid requests, the error of each field
 type apiError struct {
-	Code        string `json:"code,omitempty"`
-	Description string `json:"description"`
+	Code      string       `json:"code,omitempty"`
+	Message   string       `json:"message"`
+	RequestID string       `json:"request_id,omitempty"`
+	Fields    []fieldError `json:"fields,omitempty"`
+}
+
+// fieldError is the error of a field of an invalid request: the rule it failed (the binding tag, as oneof) and its
+// parameter (as the values of the oneof)
+type fieldError struct {
+	Field   string `json:"field"`
+	Rule    string `json:"rule"`
+	Param   string `json:"param,omitempty"`
+	Message string `json:"message"`
 }
 
 func (e apiError) Error() string {
-	return fmt.Sprintf("%s - %s", e.Code, e.Description)
+	return fmt.Sprintf("%s - %s", e.Code, e.Message)
 }
 
 // mapUserError received an error (preferentially a one received from storage) and return a http status code and
 // an api error to use on the return value to the client
 func mapUserError(err error) (int, error) {
 	errToStatus := map[code_error.Error]int{
-		user.ErrInvalidPasswordToSave: http.StatusInternalServerError,
-		user.ErrInvalidRole:           http.StatusBadRequest,
-		user.ErrStorageSave:           http.StatusInternalServerError,
-		user.ErrNotFoundUser:          http.StatusNotFound,
-		user.ErrStorageGet:            http.StatusInternalServerError,
+		user.ErrInvalidPasswordToSave:   http.StatusInternalServerError,
+		user.ErrInvalidRole:             http.StatusBadRequest,
+		user.ErrInvalidSort:             http.StatusBadRequest,
+		user.ErrInvalidEmail:            http.StatusBadRequest,
+		user.ErrStorageSave:             http.StatusInternalServerError,
+		user.ErrNotFoundUser:            http.StatusNotFound,
+		user.ErrStorageGet:              http.StatusInternalServerError,
+		user.ErrStorageUpdate:           http.StatusInternalServerError,
+		user.ErrInvalidUserClaims:       http.StatusUnauthorized,
+		user.ErrInvalidUserAccess:       http.StatusUnauthorized,
+		user.ErrEmailAlreadyExists:      http.StatusConflict,
+		user.ErrStorageDelete:           http.StatusInternalServerError,
+		user.ErrUserHasActiveTravels:    http.StatusConflict,
+		user.ErrInvalidCurrentPassword:  http.StatusBadRequest,
+		user.ErrInvalidPasswordAccess:   http.StatusUnauthorized,
+		user.ErrInvalidStatusAccess:     http.StatusUnauthorized,
+		user.ErrTwoFactorAlreadyEnabled: http.StatusConflict,
+		user.ErrTwoFactorNotEnrolled:    http.StatusBadRequest,
+		user.ErrInvalidTwoFactorCode:    http.StatusBadRequest,
+		user.ErrInvalidInvitation:       http.StatusBadRequest,
+		user.ErrGenerateInvitation:      http.StatusInternalServerError,
+		user.ErrStorageErase:            http.StatusInternalServerError,
+		user.ErrInvalidExportAccess:     http.StatusUnauthorized,
+		user.ErrInvalidPreferenceKey:    http.StatusBadRequest,
+		user.ErrInvalidPreferenceValue:  http.StatusBadRequest,
+		user.ErrTooManyPreferences:      http.StatusBadRequest,
+		user.ErrStoragePreferences:      http.StatusInternalServerError,
+		user.ErrNotFoundSession:         http.StatusNotFound,
+		user.ErrInvalidImpersonation:    http.StatusBadRequest,
+		user.ErrGenerateImpersonation:   http.StatusInternalServerError,
 	}
 
 	var userErr code_error.Error
 	if errors.As(err, &userErr) {
 		if code, ok := errToStatus[userErr]; ok {
 			return code, apiError{
-				Code:        userErr.GetCode(),
-				Description: userErr.GetDetail(),
+				Code:    userErr.GetCode(),
+				Message: userErr.GetDetail(),
 			}
 		}
 	}
 
 	return http.StatusInternalServerError, apiError{
-		Code:        "error",
-		Description: err.Error(),
+		Code:    "error",
+		Message: err.Error(),
 	}
 }
 
@@ -176,18 +772,34 @@ func mapUserError(err error) (int, error) {
 func mapValidateError(err error) apiError {
 	validatorErr := validator.ValidationErrors{}
 	if errors.As(err, &validatorErr) {
-		var fields []string
-		for _, fieldError := range validatorErr {
-			fields = append(fields, fieldError.Field())
+		var names []string
+		var fields []fieldError
+		for _, validationErr := range validatorErr {
+			if validationErr.Tag() == coordinatesTag {
+				return apiError{
+					Code:    travel.ErrInvalidCoordinates.GetCode(),
+					Message: travel.ErrInvalidCoordinates.GetDetail(),
+				}
+			}
+
+			name := validationField(validationErr)
+			names = append(names, name)
+			fields = append(fields, fieldError{
+				Field:   name,
+				Rule:    validationErr.Tag(),
+				Param:   validationErr.Param(),
+				Message: validationMessage(validationErr),
+			})
 		}
 		return apiError{
-			Code:        "invalid_request",
-			Description: fmt.Sprintf("there was an error with fields: %s", strings.ToLower(strings.Join(fields, ","))),
+			Code:    "invalid_request",
+			Message: fmt.Sprintf("there was an error with fields: %s", strings.Join(names, ",")),
+			Fields:  fields,
 		}
 	}
 
 	return apiError{
-		Code:        "invalid_request",
-		Description: "the received request is invalid",
+		Code:    "invalid_request",
+		Message: "the received request is invalid",
 	}
 }
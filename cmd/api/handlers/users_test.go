@@ -7,14 +7,22 @@ import (
 	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/travel"
 	"github.com/nicocarolo/space-drivers/internal/user"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"os"
+	"sort"
 	"strconv"
 	"testing"
+	"time"
 )
 
 type FailureEncrypter struct{}
@@ -34,7 +42,54 @@ type mockDb struct {
 
 	saveError           map[string]error
 	getError            map[int64]error
+	updateError         map[int64]error
 	getFreeDriversError error
+	getByRoleError      error
+
+	// activeTravels are the users with active travels, which cannot be deleted
+	activeTravels map[int64]bool
+
+	preferences      map[int64]user.Preferences
+	preferencesError error
+
+	// refreshTokens are the stored refresh tokens by hash, revoked ones are kept to detect their reuse
+	refreshTokens map[string]user.RefreshToken
+	revokedTokens map[string]bool
+	// sessions are the stored sessions by id, revoked ones are kept with their revocation
+	sessions        map[int64]user.UserSession
+	revokedSessions map[int64]bool
+	// consumedTokens are the ids of the one-time tokens already used
+	consumedTokens map[string]bool
+}
+
+func (db mockDb) GetByRole(ctx context.Context, role string, userSort user.UserSort, limit, offset int64) ([]user.User, int64, error) {
+	if db.getByRoleError != nil {
+		return nil, 0, db.getByRoleError
+	}
+
+	var users []user.User
+	for _, u := range db.users {
+		if role == "" || u.Role == role {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	switch userSort {
+	case user.SortByCreatedAt:
+		sort.SliceStable(users, func(i, j int) bool { return users[i].CreatedAt.After(users[j].CreatedAt) })
+	case user.SortByUpdatedAt:
+		sort.SliceStable(users, func(i, j int) bool { return users[i].UpdatedAt.After(users[j].UpdatedAt) })
+	}
+
+	total := int64(len(users))
+	if offset > total {
+		offset = total
+	}
+	top := total
+	if limit+offset < top {
+		top = limit + offset
+	}
+	return users[offset:top], total, nil
 }
 
 func newMockDB() *mockDb {
@@ -42,8 +97,20 @@ func newMockDB() *mockDb {
 		idCount: 1,
 		users:   make(map[int64]user.User),
 
-		saveError: make(map[string]error),
-		getError:  make(map[int64]error),
+		saveError:   make(map[string]error),
+		getError:    make(map[int64]error),
+		updateError: make(map[int64]error),
+
+		activeTravels: make(map[int64]bool),
+		preferences:   make(map[int64]user.Preferences),
+
+		refreshTokens: make(map[string]user.RefreshToken),
+		revokedTokens: make(map[string]bool),
+
+		sessions:        make(map[int64]user.UserSession),
+		revokedSessions: make(map[int64]bool),
+
+		consumedTokens: make(map[string]bool),
 	}
 }
 
@@ -57,6 +124,16 @@ func (db *mockDb) onGet(id int64, err error) *mockDb {
 	return db
 }
 
+func (db *mockDb) onUpdate(id int64, err error) *mockDb {
+	db.updateError[id] = err
+	return db
+}
+
+func (db *mockDb) onGetByRole(err error) *mockDb {
+	db.getByRoleError = err
+	return db
+}
+
 func (db *mockDb) onGetFreeDrivers(err error) *mockDb {
 	db.getFreeDriversError = err
 	return db
@@ -68,6 +145,8 @@ func (db *mockDb) SaveUser(ctx context.Context, u user.User) (user.User, error)
 	}
 
 	u.ID = db.idCount
+	u.UUID = fmt.Sprintf("00000000-0000-4000-8000-%012d", u.ID)
+	u.Active = true
 	db.users[u.ID] = u
 
 	db.idCount++
@@ -97,16 +176,259 @@ func (db mockDb) GetUserByEmail(ctx context.Context, email string) (user.User, e
 	return user.User{}, user.ErrUserNotFound
 }
 
-func (db mockDb) GetFreeDrivers(ctx context.Context) ([]user.User, error) {
+func (db mockDb) GetUserIDByUUID(ctx context.Context, publicID string) (int64, error) {
+	for _, u := range db.users {
+		if u.UUID == publicID {
+			return u.ID, nil
+		}
+	}
+	return 0, user.ErrUserNotFound
+}
+
+func (db *mockDb) UpdateUser(ctx context.Context, u user.User) (user.User, error) {
+	if err, ok := db.updateError[u.ID]; ok {
+		return user.User{}, err
+	}
+
+	if _, exist := db.users[u.ID]; !exist {
+		return user.User{}, user.ErrUserNotFound
+	}
+
+	db.users[u.ID] = u
+
+	return u, nil
+}
+
+func (db *mockDb) UpdateStatus(ctx context.Context, u user.User) (user.User, error) {
+	if err, ok := db.updateError[u.ID]; ok {
+		return user.User{}, err
+	}
+
+	db.users[u.ID] = u
+
+	return u, nil
+}
+
+func (db *mockDb) UpdateTwoFactor(ctx context.Context, id int64, secret string, enabled bool) error {
+	if err, ok := db.updateError[id]; ok {
+		return err
+	}
+
+	u := db.users[id]
+	u.TOTPSecret, u.TwoFactorEnabled = secret, enabled
+	db.users[id] = u
+
+	return nil
+}
+
+func (db *mockDb) UpdatePassword(ctx context.Context, id int64, password string) error {
+	if err, ok := db.updateError[id]; ok {
+		return err
+	}
+
+	u, exist := db.users[id]
+	if !exist {
+		return user.ErrUserNotFound
+	}
+
+	u.Password = password
+	db.users[id] = u
+
+	return nil
+}
+
+func (db *mockDb) DeleteUser(ctx context.Context, id int64, deletedAt time.Time) error {
+	if _, exist := db.users[id]; !exist {
+		return user.ErrUserNotFound
+	}
+
+	if db.activeTravels[id] {
+		return user.ErrUserActiveTravels
+	}
+
+	delete(db.users, id)
+
+	return nil
+}
+
+func (db *mockDb) AnonymizeUser(ctx context.Context, id int64, erasedAt time.Time) error {
+	u, exist := db.users[id]
+	if !exist {
+		return user.ErrUserNotFound
+	}
+
+	if db.activeTravels[id] {
+		return user.ErrUserActiveTravels
+	}
+
+	db.users[id] = user.User{SecuredUser: user.SecuredUser{
+		ID:           id,
+		Email:        "erased-" + strconv.FormatInt(id, 10) + "@space-drivers.invalid",
+		Role:         u.Role,
+		StatusReason: user.ErasedStatusReason,
+		CreatedAt:    u.CreatedAt,
+		UpdatedAt:    erasedAt,
+	}}
+
+	delete(db.preferences, id)
+
+	return nil
+}
+
+func (db *mockDb) SaveRefreshToken(ctx context.Context, token user.RefreshToken) error {
+	db.refreshTokens[token.TokenHash] = token
+	return nil
+}
+
+func (db *mockDb) RotateRefreshToken(ctx context.Context, tokenHash string, next user.RefreshToken) (user.UserSession, error) {
+	token, exist := db.refreshTokens[tokenHash]
+	if !exist {
+		return user.UserSession{}, user.ErrRefreshTokenNotFound
+	}
+
+	if db.revokedSessions[token.SessionID] {
+		return user.UserSession{}, user.ErrRefreshTokenNotFound
+	}
+
+	if db.revokedTokens[tokenHash] {
+		_ = db.RevokeRefreshTokens(ctx, token.UserID)
+		return user.UserSession{UserID: token.UserID}, user.ErrRefreshTokenReused
+	}
+
+	if !token.ExpiresAt.After(next.CreatedAt) {
+		return user.UserSession{}, user.ErrRefreshTokenNotFound
+	}
+
+	db.revokedTokens[tokenHash] = true
+	next.UserID = token.UserID
+	next.SessionID = token.SessionID
+	db.refreshTokens[next.TokenHash] = next
+
+	session, exist := db.sessions[token.SessionID]
+	if exist {
+		session.LastUsedAt = next.CreatedAt
+		session.ExpiresAt = next.ExpiresAt
+		db.sessions[session.ID] = session
+	}
+
+	return user.UserSession{ID: token.SessionID, UserID: token.UserID, Scope: session.Scope}, nil
+}
+
+func (db *mockDb) RevokeRefreshTokens(ctx context.Context, userID int64) error {
+	for hash, token := range db.refreshTokens {
+		if token.UserID == userID {
+			db.revokedTokens[hash] = true
+		}
+	}
+	for id, session := range db.sessions {
+		if session.UserID == userID {
+			db.revokedSessions[id] = true
+		}
+	}
+	return nil
+}
+
+func (db *mockDb) SaveSession(ctx context.Context, session user.UserSession) (user.UserSession, error) {
+	session.ID = int64(len(db.sessions) + 1)
+	db.sessions[session.ID] = session
+	return session, nil
+}
+
+func (db *mockDb) GetSessions(ctx context.Context, userID int64) ([]user.UserSession, error) {
+	var sessions []user.UserSession
+	for id := int64(len(db.sessions)); id > 0; id-- {
+		session := db.sessions[id]
+		if session.UserID == userID && !db.revokedSessions[id] && session.ExpiresAt.After(time.Now()) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (db *mockDb) RevokeSession(ctx context.Context, userID, id int64) error {
+	session, exist := db.sessions[id]
+	if !exist || session.UserID != userID || db.revokedSessions[id] {
+		return user.ErrSessionNotFound
+	}
+
+	db.revokedSessions[id] = true
+	for hash, token := range db.refreshTokens {
+		if token.SessionID == id {
+			db.revokedTokens[hash] = true
+		}
+	}
+	return nil
+}
+
+func (db *mockDb) ConsumeToken(ctx context.Context, id string, expiresAt time.Time) error {
+	if db.consumedTokens[id] {
+		return user.ErrTokenConsumed
+	}
+
+	db.consumedTokens[id] = true
+	return nil
+}
+
+func (db *mockDb) ReleaseToken(ctx context.Context, id string) error {
+	delete(db.consumedTokens, id)
+	return nil
+}
+
+func (db mockDb) CountUsers(ctx context.Context) (int64, error) {
+	return int64(len(db.users)), nil
+}
+
+func (db mockDb) GetPreferences(ctx context.Context, userID int64) (user.Preferences, error) {
+	if db.preferencesError != nil {
+		return nil, db.preferencesError
+	}
+
+	preferences := make(user.Preferences)
+	for key, value := range db.preferences[userID] {
+		preferences[key] = value
+	}
+
+	return preferences, nil
+}
+
+func (db *mockDb) UpdatePreferences(ctx context.Context, userID int64, changes user.Preferences,
+	maxKeys int) (user.Preferences, error) {
+	if db.preferencesError != nil {
+		return nil, db.preferencesError
+	}
+
+	preferences, _ := db.GetPreferences(ctx, userID)
+	for key, value := range changes {
+		if value == "" {
+			delete(preferences, key)
+		} else {
+			preferences[key] = value
+		}
+	}
+
+	if len(preferences) > maxKeys {
+		return nil, user.ErrPreferencesLimit
+	}
+	db.preferences[userID] = preferences
+
+	return db.GetPreferences(ctx, userID)
+}
+
+func (db mockDb) GetFreeDrivers(ctx context.Context, availability user.DriverAvailability, zoneID, teamID int64,
+	minRating float64, limit, offset int64) ([]user.User, int64, error) {
 	if db.getFreeDriversError != nil {
-		return nil, db.getFreeDriversError
+		return nil, 0, db.getFreeDriversError
 	}
-	return []user.User{
+	drivers := []user.User{
 		user.User{
 			SecuredUser: user.SecuredUser{
 				ID:    1,
 				Email: "an_email@hotmail.com",
 				Role:  "driver",
+				Rating: &user.DriverRating{
+					Average: 4.5,
+					Count:   2,
+				},
 			},
 		},
 		user.User{
@@ -116,10 +438,72 @@ func (db mockDb) GetFreeDrivers(ctx context.Context) ([]user.User, error) {
 				Role:  "driver",
 			},
 		},
-	}, nil
+	}
+
+	if minRating != 0 {
+		var ratedDrivers []user.User
+		for _, driver := range drivers {
+			if driver.Rating != nil && driver.Rating.Average >= minRating {
+				ratedDrivers = append(ratedDrivers, driver)
+			}
+		}
+		drivers = ratedDrivers
+	}
+
+	if zoneID != 0 {
+		// only the second driver is registered on the zone 1
+		var zoneDrivers []user.User
+		for _, driver := range drivers {
+			if zoneID == 1 && driver.ID == 2 {
+				zoneDrivers = append(zoneDrivers, driver)
+			}
+		}
+		drivers = zoneDrivers
+	}
+
+	if teamID != 0 {
+		drivers = mockTeamDrivers(drivers, teamID)
+	}
+
+	total := int64(len(drivers))
+	if offset >= total {
+		return nil, total, nil
+	}
+	if offset+limit < total {
+		drivers = drivers[:offset+limit]
+	}
+
+	return drivers[offset:], total, nil
+}
+
+func (db mockDb) GetBusyDrivers(ctx context.Context, availability user.DriverAvailability, teamID int64,
+	minRating float64) ([]user.User, error) {
+	if db.getFreeDriversError != nil {
+		return nil, db.getFreeDriversError
+	}
+
+	// the third driver is busy with the travel 10
+	travelID := int64(10)
+	drivers := []user.User{
+		{
+			SecuredUser: user.SecuredUser{
+				ID:       3,
+				Email:    "busy_email@hotmail.com",
+				Role:     "driver",
+				TravelID: &travelID,
+			},
+		},
+	}
+
+	if teamID != 0 {
+		drivers = mockTeamDrivers(drivers, teamID)
+	}
+
+	return drivers, nil
 }
 
-func (db mockDb) GetPaginate(ctx context.Context, limit, offset int64) ([]user.User, int64, error) {
+func (db mockDb) GetPaginate(ctx context.Context, teamID int64, minRating float64, limit,
+	offset int64) ([]user.User, int64, error) {
 	users := []user.User{
 		user.User{
 			SecuredUser: user.SecuredUser{
@@ -144,6 +528,10 @@ func (db mockDb) GetPaginate(ctx context.Context, limit, offset int64) ([]user.U
 		},
 	}
 
+	if teamID != 0 {
+		users = mockTeamDrivers(users, teamID)
+	}
+
 	top := int64(len(users))
 	if limit < top {
 		top = limit
@@ -151,6 +539,18 @@ func (db mockDb) GetPaginate(ctx context.Context, limit, offset int64) ([]user.U
 	return users[offset:top], int64(len(users)), nil
 }
 
+// mockTeamDrivers return the drivers members of the team: the drivers 1 and 3 are members of the team 1
+func mockTeamDrivers(drivers []user.User, teamID int64) []user.User {
+	var teamDrivers []user.User
+	for _, driver := range drivers {
+		if teamID == 1 && (driver.ID == 1 || driver.ID == 3) {
+			teamDrivers = append(teamDrivers, driver)
+		}
+	}
+
+	return teamDrivers
+}
+
 func Test_createUser(t *testing.T) {
 	testscases := map[string]struct {
 		userStorage    UsersStorage
@@ -162,21 +562,55 @@ func Test_createUser(t *testing.T) {
 		"successful created user": {
 			userStorage: user.NewUserStorage(newMockDB()),
 			body: map[string]interface{}{
-				"email":    "a user email",
+				"email":    "driver@hotmail.com",
 				"password": "a user pass",
 				"role":     "driver",
 			},
 			want: user.SecuredUser{
-				Email: "a user email",
+				Email: "driver@hotmail.com",
+				Role:  "driver",
+			},
+			statusExpected: http.StatusCreated,
+		},
+
+		"successful created user with profile": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			body: map[string]interface{}{
+				"email":          "driver@hotmail.com",
+				"password":       "a user pass",
+				"role":           "driver",
+				"name":           "a driver name",
+				"phone":          "+54 11 5555-5555",
+				"license_number": "AB123456",
+			},
+			want: user.SecuredUser{
+				Email: "driver@hotmail.com",
 				Role:  "driver",
+				Profile: user.Profile{
+					Name:          "a driver name",
+					Phone:         "+54 11 5555-5555",
+					LicenseNumber: "AB123456",
+				},
 			},
 			statusExpected: http.StatusCreated,
 		},
 
+		"failure due to invalid request: too long phone": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			body: map[string]interface{}{
+				"email":    "driver@hotmail.com",
+				"password": "a user pass",
+				"role":     "driver",
+				"phone":    "+54 11 5555-5555 5555-5555 5555-5555",
+			},
+			wantError:      errors.New("invalid_request - there was an error with fields: phone"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
 		"failure due to invalid request: no password": {
 			userStorage: user.NewUserStorage(newMockDB()),
 			body: map[string]interface{}{
-				"email": "a user email",
+				"email": "driver@hotmail.com",
 				"role":  "driver",
 			},
 			wantError:      errors.New("invalid_request - there was an error with fields: password"),
@@ -186,7 +620,7 @@ func Test_createUser(t *testing.T) {
 		"failure due to invalid password": {
 			userStorage: user.NewUserStorage(newMockDB(), user.WithPasswordEncrypter(FailureEncrypter{})),
 			body: map[string]interface{}{
-				"email":    "a user email",
+				"email":    "driver@hotmail.com",
 				"password": "an invalid pass",
 				"role":     "driver",
 			},
@@ -194,14 +628,36 @@ func Test_createUser(t *testing.T) {
 			statusExpected: http.StatusInternalServerError,
 		},
 
-		"failure due to invalid role": {
+		"failure due to invalid email": {
 			userStorage: user.NewUserStorage(newMockDB()),
 			body: map[string]interface{}{
 				"email":    "a user email",
+				"password": "a user pass",
+				"role":     "driver",
+			},
+			wantError:      errors.New("invalid_email - the received email has an invalid format"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to email of another user": {
+			userStorage: user.NewUserStorage(newMockDB().onCreate("driver@hotmail.com", user.ErrUserDuplicated)),
+			body: map[string]interface{}{
+				"email":    "driver@hotmail.com",
+				"password": "a user pass",
+				"role":     "driver",
+			},
+			wantError:      errors.New("email_already_exists - there is already a user with the received email"),
+			statusExpected: http.StatusConflict,
+		},
+
+		"failure due to invalid role": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			body: map[string]interface{}{
+				"email":    "driver@hotmail.com",
 				"password": "an invalid pass",
 				"role":     "an invalid role",
 			},
-			wantError:      errors.New("invalid_role - the received role should be admin or driver"),
+			wantError:      errors.New("invalid_role - the received role should be admin, dispatcher or driver"),
 			statusExpected: http.StatusBadRequest,
 		},
 	}
@@ -239,60 +695,646 @@ func Test_createUser(t *testing.T) {
 
 				assert.Equal(t, tc.want.Email, response.Email)
 				assert.Equal(t, tc.want.Role, response.Role)
+				assert.Equal(t, tc.want.Profile, response.Profile)
 				assert.Greater(t, response.ID, int64(0))
 			}
 		})
 	}
 }
 
-func Test_getUser(t *testing.T) {
-	dbWithUser := newMockDB()
-	createdUser, _ := dbWithUser.SaveUser(context.Background(), user.User{
-		SecuredUser: user.SecuredUser{
-			Email: "anEmail@asa.com",
-			Role:  "admin",
-		},
-		Password: "a pass",
-	})
-
-	createURLParam := func(id string) []gin.Param {
-		return []gin.Param{
-			{
-				Key:   "id",
-				Value: id,
-			},
-		}
+func Test_updateUser(t *testing.T) {
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = user.User{SecuredUser: user.SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: "admin"}}
+		db.users[2] = user.User{SecuredUser: user.SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: "driver"}}
+		return db
 	}
 
+	admin := jwt.Claims{UserID: 1, Role: "admin"}
+	driver := jwt.Claims{UserID: 2, Role: "driver"}
+
 	testscases := map[string]struct {
-		userStorage    UsersStorage
-		urlParams      gin.Params
+		id             string
+		userLogged     jwt.Claims
+		body           map[string]interface{}
 		want           user.SecuredUser
 		wantError      error
 		statusExpected int
 	}{
-		"successful get user": {
-			userStorage: user.NewUserStorage(dbWithUser),
-			urlParams:   createURLParam(strconv.FormatInt(createdUser.ID, 10)),
-			want: user.SecuredUser{
-				ID:    createdUser.ID,
-				Email: "anEmail@asa.com",
-				Role:  "admin",
-			},
+		"successful updated user from admin": {
+			id:             "2",
+			userLogged:     admin,
+			body:           map[string]interface{}{"email": "new-driver@hotmail.com", "role": "admin"},
+			want:           user.SecuredUser{ID: 2, Email: "new-driver@hotmail.com", Role: "admin"},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful updated user from the same driver": {
+			id:             "2",
+			userLogged:     driver,
+			body:           map[string]interface{}{"email": "new-driver@hotmail.com", "role": "driver"},
+			want:           user.SecuredUser{ID: 2, Email: "new-driver@hotmail.com", Role: "driver"},
 			statusExpected: http.StatusOK,
 		},
 
 		"failure due to invalid request: no id": {
-			userStorage:    user.NewUserStorage(newMockDB()),
-			wantError:      errors.New("invalid_request - the request has not a user id to get"),
+			id:             "an id",
+			userLogged:     admin,
+			body:           map[string]interface{}{"email": "new-driver@hotmail.com", "role": "driver"},
+			wantError:      errors.New("invalid_request - the request has not a user id to update"),
 			statusExpected: http.StatusBadRequest,
 		},
 
-		"failure due to non existent user": {
-			userStorage:    user.NewUserStorage(newMockDB().onGet(1, user.ErrUserNotFound)),
-			urlParams:      createURLParam("1"),
-			wantError:      errors.New("not_found_user - not founded the user to get"),
-			statusExpected: http.StatusNotFound,
+		"failure due to invalid request: no role": {
+			id:             "2",
+			userLogged:     admin,
+			body:           map[string]interface{}{"email": "new-driver@hotmail.com"},
+			wantError:      errors.New("invalid_request - there was an error with fields: role"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to driver editing another user": {
+			id:             "1",
+			userLogged:     driver,
+			body:           map[string]interface{}{"email": "new-admin@hotmail.com", "role": "admin"},
+			wantError:      errors.New("invalid_user_access - the user logged in can only edit itself and cannot change its role, unless it is an admin"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"failure due to email of another user": {
+			id:             "2",
+			userLogged:     admin,
+			body:           map[string]interface{}{"email": "admin@hotmail.com", "role": "driver"},
+			wantError:      errors.New("email_already_exists - there is already a user with the received email"),
+			statusExpected: http.StatusConflict,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+			c.Params = []gin.Param{{Key: "id", Value: tc.id}}
+			c.Set("user_on_call", tc.userLogged)
+
+			err := mockJson(c, http.MethodPut, tc.body)
+			assert.Nil(t, err)
+
+			handler := UserHandler{
+				Users: user.NewUserStorage(newDb()),
+			}
+			handler.Edit(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := user.SecuredUser{}
+
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, response)
+			}
+		})
+	}
+}
+
+func Test_deleteUser(t *testing.T) {
+	testscases := map[string]struct {
+		id             string
+		wantError      error
+		statusExpected int
+	}{
+		"successful deleted user": {
+			id:             "1",
+			statusExpected: http.StatusNoContent,
+		},
+
+		"failure due to invalid request: no id": {
+			id:             "an id",
+			wantError:      errors.New("invalid_request - the request has not a user id to delete"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to non existent user": {
+			id:             "3",
+			wantError:      errors.New("not_found_user - not founded the user to get"),
+			statusExpected: http.StatusNotFound,
+		},
+
+		"failure due to user with active travels": {
+			id:             "2",
+			wantError:      errors.New("user_has_active_travels - the user has pending, offered, queued or in process travels"),
+			statusExpected: http.StatusConflict,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			db := newMockDB()
+			db.users[1] = user.User{SecuredUser: user.SecuredUser{ID: 1, Email: "driver@hotmail.com", Role: "driver"}}
+			db.users[2] = user.User{SecuredUser: user.SecuredUser{ID: 2, Email: "busy@hotmail.com", Role: "driver"}}
+			db.activeTravels[2] = true
+
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Params = []gin.Param{{Key: "id", Value: tc.id}}
+
+			handler := UserHandler{
+				Users: user.NewUserStorage(db),
+			}
+			handler.Delete(c)
+			c.Writer.WriteHeaderNow()
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			}
+		})
+	}
+}
+
+func Test_personalData(t *testing.T) {
+	newDbs := func() (*mockDb, *travelMockDb) {
+		db := newMockDB()
+		db.users[1] = user.User{SecuredUser: user.SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: "admin", Active: true}}
+		db.users[2] = user.User{SecuredUser: user.SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: "driver", Active: true,
+			Profile: user.Profile{Name: "A driver"}}}
+		db.users[3] = user.User{SecuredUser: user.SecuredUser{ID: 3, Email: "busy@hotmail.com", Role: "driver", Active: true}}
+		db.activeTravels[3] = true
+
+		travelDb := newTravelMockDbFromMap(map[int64]travel.Travel{
+			1: {ID: 1, Status: travel.StatusReady, UserID: 2},
+			2: {ID: 2, Status: travel.StatusInProcess, UserID: 3},
+		})
+		travelDb.trace = []travel.TracePoint{
+			{ID: 1, TravelID: 1, UserID: 2, Location: travel.Point{Lat: -34.6, Lng: -58.4}},
+		}
+		return db, travelDb
+	}
+
+	admin := jwt.Claims{UserID: 1, Role: "admin"}
+	driver := jwt.Claims{UserID: 2, Role: "driver"}
+
+	testscases := map[string]struct {
+		erase          bool
+		id             string
+		userLogged     jwt.Claims
+		wantTravels    int
+		wantError      error
+		statusExpected int
+	}{
+		"successful exported own personal data": {
+			id:             "2",
+			userLogged:     driver,
+			wantTravels:    1,
+			statusExpected: http.StatusOK,
+		},
+
+		"successful exported personal data by admin": {
+			id:             "2",
+			userLogged:     admin,
+			wantTravels:    1,
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to export of another user personal data": {
+			id:             "3",
+			userLogged:     driver,
+			wantError:      errors.New("invalid_user_access - the user logged in can only export its own personal data, unless it is an admin"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"successful erased personal data": {
+			erase:          true,
+			id:             "2",
+			userLogged:     admin,
+			statusExpected: http.StatusNoContent,
+		},
+
+		"failure due to erase of user with active travels": {
+			erase:          true,
+			id:             "3",
+			userLogged:     admin,
+			wantError:      errors.New("user_has_active_travels - the user has pending, offered, queued or in process travels"),
+			statusExpected: http.StatusConflict,
+		},
+
+		"failure due to invalid request: no id": {
+			erase:          true,
+			id:             "an id",
+			userLogged:     admin,
+			wantError:      errors.New("invalid_request - the request has not a user id to erase its personal data"),
+			statusExpected: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			db, travelDb := newDbs()
+
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+			c.Params = []gin.Param{{Key: "id", Value: tc.id}}
+			c.Set("user_on_call", tc.userLogged)
+
+			handler := UserHandler{
+				Users:   user.NewUserStorage(db),
+				Travels: travel.NewTravelStorage(travelDb),
+			}
+			if tc.erase {
+				handler.ErasePersonalData(c)
+			} else {
+				handler.ExportPersonalData(c)
+			}
+			c.Writer.WriteHeaderNow()
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else if tc.erase {
+				assert.Equal(t, "erased-2@space-drivers.invalid", db.users[2].Email)
+				assert.Empty(t, travelDb.trace)
+			} else {
+				var response personalDataExport
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, "driver@hotmail.com", response.User.Email)
+				assert.Len(t, response.Travels, tc.wantTravels)
+				assert.Len(t, response.Locations, 1)
+			}
+		})
+	}
+}
+
+func Test_changePassword(t *testing.T) {
+	encrypted, err := bcrypt.GenerateFromPassword([]byte("a pass"), bcrypt.MinCost)
+	assert.Nil(t, err)
+
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = user.User{SecuredUser: user.SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: "admin"}, Password: string(encrypted)}
+		db.users[2] = user.User{SecuredUser: user.SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: "driver"}, Password: string(encrypted)}
+		return db
+	}
+
+	admin := jwt.Claims{UserID: 1, Role: "admin"}
+	driver := jwt.Claims{UserID: 2, Role: "driver"}
+
+	testscases := map[string]struct {
+		id             string
+		userLogged     jwt.Claims
+		body           map[string]interface{}
+		wantError      error
+		statusExpected int
+	}{
+		"successful changed password from the same driver": {
+			id:             "2",
+			userLogged:     driver,
+			body:           map[string]interface{}{"current_password": "a pass", "new_password": "a new pass"},
+			statusExpected: http.StatusNoContent,
+		},
+
+		"successful changed password from admin": {
+			id:             "2",
+			userLogged:     admin,
+			body:           map[string]interface{}{"new_password": "a new pass"},
+			statusExpected: http.StatusNoContent,
+		},
+
+		"failure due to invalid request: no id": {
+			id:             "an id",
+			userLogged:     admin,
+			body:           map[string]interface{}{"new_password": "a new pass"},
+			wantError:      errors.New("invalid_request - the request has not a user id to change its password"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to invalid request: no new password": {
+			id:             "2",
+			userLogged:     driver,
+			body:           map[string]interface{}{"current_password": "a pass"},
+			wantError:      errors.New("invalid_request - there was an error with fields: new_password"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to invalid current password": {
+			id:             "2",
+			userLogged:     driver,
+			body:           map[string]interface{}{"current_password": "another pass", "new_password": "a new pass"},
+			wantError:      errors.New("invalid_password - the current password received is invalid"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to driver changing another user password": {
+			id:             "1",
+			userLogged:     driver,
+			body:           map[string]interface{}{"current_password": "a pass", "new_password": "a new pass"},
+			wantError:      errors.New("invalid_user_access - the user logged in can only change its own password, unless it is an admin"),
+			statusExpected: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			db := newDb()
+
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+			c.Params = []gin.Param{{Key: "id", Value: tc.id}}
+			c.Set("user_on_call", tc.userLogged)
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+
+			handler := UserHandler{
+				Users: user.NewUserStorage(db),
+			}
+			handler.ChangePassword(c)
+			c.Writer.WriteHeaderNow()
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				err = bcrypt.CompareHashAndPassword([]byte(db.users[2].Password), []byte("a new pass"))
+				assert.Nil(t, err)
+			}
+		})
+	}
+}
+
+func Test_changeStatus(t *testing.T) {
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = user.User{SecuredUser: user.SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: "admin", Active: true}}
+		db.users[2] = user.User{SecuredUser: user.SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: "driver", Active: true}}
+		return db
+	}
+
+	admin := jwt.Claims{UserID: 1, Role: "admin"}
+
+	testscases := map[string]struct {
+		id             string
+		body           map[string]interface{}
+		want           user.SecuredUser
+		wantError      error
+		statusExpected int
+	}{
+		"successful suspended driver": {
+			id:             "2",
+			body:           map[string]interface{}{"active": false, "reason": "too many complaints"},
+			want:           user.SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: "driver", StatusReason: "too many complaints"},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to invalid request: no id": {
+			id:             "an id",
+			body:           map[string]interface{}{"active": false},
+			wantError:      errors.New("invalid_request - the request has not a user id to change its status"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to invalid request: no active": {
+			id:             "2",
+			body:           map[string]interface{}{"reason": "too many complaints"},
+			wantError:      errors.New("invalid_request - there was an error with fields: active"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to admin suspending itself": {
+			id:             "1",
+			body:           map[string]interface{}{"active": false},
+			wantError:      errors.New("invalid_user_access - the user logged in cannot change its own status"),
+			statusExpected: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+			c.Params = []gin.Param{{Key: "id", Value: tc.id}}
+			c.Set("user_on_call", admin)
+
+			err := mockJson(c, http.MethodPut, tc.body)
+			assert.Nil(t, err)
+
+			handler := UserHandler{
+				Users: user.NewUserStorage(newDb()),
+			}
+			handler.ChangeStatus(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var response user.SecuredUser
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, response)
+			}
+		})
+	}
+}
+
+func Test_invitation(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	db := newMockDB()
+	db.users[1] = user.User{SecuredUser: user.SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: "admin", Active: true}}
+	db.idCount = 2
+	users := user.NewUserStorage(db, user.WithPasswordEncrypter(NoEncrypter{}))
+
+	invitation, err := users.Invite(context.WithValue(context.Background(), "user_on_call",
+		jwt.Claims{UserID: 1, Role: "admin"}), user.Invitation{Email: "driver@hotmail.com", Role: "driver"})
+	assert.Nil(t, err)
+
+	testscases := map[string]struct {
+		invite         bool
+		token          string
+		body           map[string]interface{}
+		want           user.SecuredUser
+		wantError      error
+		statusExpected int
+	}{
+		"successful invited user": {
+			invite:         true,
+			body:           map[string]interface{}{"email": "another_driver@hotmail.com", "role": "driver"},
+			statusExpected: http.StatusCreated,
+		},
+
+		"failure due to invited email of a user": {
+			invite:         true,
+			body:           map[string]interface{}{"email": "admin@hotmail.com", "role": "driver"},
+			wantError:      errors.New("email_already_exists - there is already a user with the received email"),
+			statusExpected: http.StatusConflict,
+		},
+
+		"failure due to invalid request: no role": {
+			invite:         true,
+			body:           map[string]interface{}{"email": "another_driver@hotmail.com"},
+			wantError:      errors.New("invalid_request - there was an error with fields: role"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"successful accepted invitation": {
+			token:          invitation.Token,
+			body:           map[string]interface{}{"password": "a password", "name": "A driver"},
+			want:           user.SecuredUser{ID: 2, UUID: "00000000-0000-4000-8000-000000000002", Email: "driver@hotmail.com", Role: "driver", Active: true, Profile: user.Profile{Name: "A driver"}},
+			statusExpected: http.StatusCreated,
+		},
+
+		"failure due to invalid invitation token": {
+			token:          "a token",
+			body:           map[string]interface{}{"password": "a password"},
+			wantError:      errors.New("invalid_invitation - the invitation received is invalid or expired"),
+			statusExpected: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+			c.Params = []gin.Param{{Key: "token", Value: tc.token}}
+			c.Set("user_on_call", jwt.Claims{UserID: 1, Role: "admin"})
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+
+			handler := UserHandler{
+				Users: users,
+			}
+			if tc.invite {
+				handler.Invite(c)
+			} else {
+				handler.AcceptInvitation(c)
+			}
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else if tc.invite {
+				var response user.Invitation
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.NotEmpty(t, response.Token)
+			} else {
+				var response user.SecuredUser
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, response)
+			}
+		})
+	}
+}
+
+func Test_getUser(t *testing.T) {
+	dbWithUser := newMockDB()
+	createdUser, _ := dbWithUser.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "anEmail@asa.com",
+			Role:  "admin",
+		},
+		Password: "a pass",
+	})
+
+	createURLParam := func(id string) []gin.Param {
+		return []gin.Param{
+			{
+				Key:   "id",
+				Value: id,
+			},
+		}
+	}
+
+	testscases := map[string]struct {
+		userStorage    UsersStorage
+		urlParams      gin.Params
+		want           user.SecuredUser
+		wantError      error
+		statusExpected int
+	}{
+		"successful get user": {
+			userStorage: user.NewUserStorage(dbWithUser),
+			urlParams:   createURLParam(strconv.FormatInt(createdUser.ID, 10)),
+			want: user.SecuredUser{
+				ID:    createdUser.ID,
+				Email: "anEmail@asa.com",
+				Role:  "admin",
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to invalid request: no id": {
+			userStorage:    user.NewUserStorage(newMockDB()),
+			wantError:      errors.New("invalid_request - the request has not a user id to get"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to non existent user": {
+			userStorage:    user.NewUserStorage(newMockDB().onGet(1, user.ErrUserNotFound)),
+			urlParams:      createURLParam("1"),
+			wantError:      errors.New("not_found_user - not founded the user to get"),
+			statusExpected: http.StatusNotFound,
 		},
 	}
 
@@ -312,90 +1354,484 @@ func Test_getUser(t *testing.T) {
 
 			assert.Equal(t, tc.statusExpected, w.Code)
 
-			if tc.wantError != nil {
-				var apiErr apiError
-				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
-				assert.Nil(t, err)
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := user.SecuredUser{}
+
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want.Email, response.Email)
+				assert.Equal(t, tc.want.Role, response.Role)
+				assert.Equal(t, tc.want.ID, response.ID)
+			}
+		})
+	}
+}
+
+func Test_getMe(t *testing.T) {
+	db := newMockDB()
+	admin, _ := db.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{Email: "admin@hotmail.com", Role: "admin"},
+		Password:    "a pass",
+	})
+	busyDriver, _ := db.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{Email: "busy_driver@hotmail.com", Role: "driver"},
+		Password:    "a pass",
+	})
+	freeDriver, _ := db.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{Email: "free_driver@hotmail.com", Role: "driver"},
+		Password:    "a pass",
+	})
+
+	current := travel.Travel{
+		ID:     1,
+		Status: travel.StatusInProcess,
+		From:   travel.Point{Lat: 1, Lng: 2},
+		To:     travel.Point{Lat: -1, Lng: -2},
+		UserID: busyDriver.ID,
+	}
+	travels := travel.NewTravelStorage(newTravelMockDbFromMap(map[int64]travel.Travel{1: current}))
+	db.preferences[admin.ID] = user.Preferences{"locale": "es-AR", "units": "metric"}
+
+	type response struct {
+		User        user.SecuredUser `json:"user"`
+		Preferences user.Preferences `json:"preferences"`
+		Travel      *travel.Travel   `json:"travel"`
+	}
+
+	testscases := map[string]struct {
+		travelStorage  TravelStorage
+		userLogged     *jwt.Claims
+		want           response
+		wantError      error
+		statusExpected int
+	}{
+		"successful get me: admin": {
+			travelStorage: travels,
+			userLogged:    &jwt.Claims{UserID: admin.ID, Role: "admin"},
+			want: response{
+				User:        user.SecuredUser{ID: admin.ID, UUID: admin.UUID, Email: "admin@hotmail.com", Role: "admin", Active: true},
+				Preferences: user.Preferences{"locale": "es-AR", "units": "metric"},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful get me: driver with current travel": {
+			travelStorage: travels,
+			userLogged:    &jwt.Claims{UserID: busyDriver.ID, Role: "driver"},
+			want: response{
+				User:        user.SecuredUser{ID: busyDriver.ID, UUID: busyDriver.UUID, Email: "busy_driver@hotmail.com", Role: "driver", Active: true},
+				Preferences: user.Preferences{},
+				Travel:      &current,
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful get me: free driver": {
+			travelStorage: travels,
+			userLogged:    &jwt.Claims{UserID: freeDriver.ID, Role: "driver"},
+			want: response{
+				User:        user.SecuredUser{ID: freeDriver.ID, UUID: freeDriver.UUID, Email: "free_driver@hotmail.com", Role: "driver", Active: true},
+				Preferences: user.Preferences{},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to non user logged in": {
+			travelStorage:  travels,
+			wantError:      errors.New("invalid_user_access - cannot identify user logged in"),
+			statusExpected: http.StatusUnauthorized,
+		},
+
+		"failure due to current travel storage error": {
+			travelStorage:  travel.NewTravelStorage(newTravelMockDb().onGetByUser(busyDriver.ID, errors.New("mocked storage error"))),
+			userLogged:     &jwt.Claims{UserID: busyDriver.ID, Role: "driver"},
+			wantError:      errors.New("storage_failure - an error ocurred trying to get travel"),
+			statusExpected: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			if tc.userLogged != nil {
+				c.Set("user_on_call", *tc.userLogged)
+			}
+
+			handler := UserHandler{
+				Users:   user.NewUserStorage(db),
+				Travels: tc.travelStorage,
+			}
+			handler.Me(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var resp response
+				err := json.Unmarshal(w.Body.Bytes(), &resp)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, resp)
+			}
+		})
+	}
+}
+
+func Test_preferences(t *testing.T) {
+	driver := jwt.Claims{UserID: 2, Role: "driver"}
+
+	testscases := map[string]struct {
+		update         bool
+		body           interface{}
+		userLogged     *jwt.Claims
+		want           user.Preferences
+		wantError      error
+		statusExpected int
+	}{
+		"successful get preferences": {
+			userLogged:     &driver,
+			want:           user.Preferences{"locale": "es-AR", "notifications.email": "true"},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful update preferences": {
+			update:         true,
+			body:           map[string]interface{}{"units": "metric", "notifications.email": ""},
+			userLogged:     &driver,
+			want:           user.Preferences{"locale": "es-AR", "units": "metric"},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to invalid request: not string values": {
+			update:         true,
+			body:           map[string]interface{}{"notifications.email": true},
+			userLogged:     &driver,
+			wantError:      errors.New("invalid_request - the preferences should be an object of string values"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to invalid preference key": {
+			update:         true,
+			body:           map[string]interface{}{"Locale": "es-AR"},
+			userLogged:     &driver,
+			wantError:      errors.New("invalid_preference - the preference keys should have up to 50 lowercase letters, digits, '_', '-' or '.'"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to non user logged in": {
+			update:         true,
+			body:           map[string]interface{}{"units": "metric"},
+			wantError:      errors.New("invalid_user_access - cannot identify user logged in"),
+			statusExpected: http.StatusUnauthorized,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			db := newMockDB()
+			db.preferences[2] = user.Preferences{"locale": "es-AR", "notifications.email": "true"}
+
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			if tc.userLogged != nil {
+				c.Set("user_on_call", *tc.userLogged)
+			}
+
+			handler := UserHandler{
+				Users: user.NewUserStorage(db),
+			}
+			if tc.update {
+				err := mockJson(c, http.MethodPatch, tc.body)
+				assert.Nil(t, err)
+
+				handler.UpdatePreferences(c)
+			} else {
+				handler.GetPreferences(c)
+			}
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var resp user.Preferences
+				err := json.Unmarshal(w.Body.Bytes(), &resp)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, resp)
+			}
+		})
+	}
+}
+
+func Test_searchUser(t *testing.T) {
+	type response struct {
+		Total   int64              `json:"total"`
+		Pending int64              `json:"pending"`
+		Result  []user.SecuredUser `json:"result"`
+	}
+
+	// the travel the busy driver of the mock db is busy with
+	busyTravelID := int64(10)
+
+	testscases := map[string]struct {
+		userStorage    UsersStorage
+		urlParams      map[string]string
+		want           response
+		wantError      error
+		statusExpected int
+	}{
+		"successful get free drivers": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			urlParams: map[string]string{
+				"status": "free",
+			},
+			want: response{
+				Total:   2,
+				Pending: 0,
+				Result: []user.SecuredUser{
+					user.SecuredUser{
+						ID:    1,
+						Email: "an_email@hotmail.com",
+						Role:  "driver",
+						Rating: &user.DriverRating{
+							Average: 4.5,
+							Count:   2,
+						},
+					},
+					user.SecuredUser{
+						ID:    2,
+						Email: "another_email@hotmail.com",
+						Role:  "driver",
+					},
+				},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful get free drivers of zone": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			urlParams: map[string]string{
+				"status":  "free",
+				"zone_id": "1",
+			},
+			want: response{
+				Total:   1,
+				Pending: 0,
+				Result: []user.SecuredUser{
+					user.SecuredUser{
+						ID:    2,
+						Email: "another_email@hotmail.com",
+						Role:  "driver",
+					},
+				},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure get drivers: zone without free status": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			urlParams: map[string]string{
+				"zone_id": "1",
+			},
+			wantError:      errors.New("invalid_request - invalid search zone received, it is only accepted with free status"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"successful get busy drivers": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			urlParams: map[string]string{
+				"status": "busy",
+			},
+			want: response{
+				Total:   1,
+				Pending: 0,
+				Result: []user.SecuredUser{
+					{
+						ID:       3,
+						Email:    "busy_email@hotmail.com",
+						Role:     "driver",
+						TravelID: &busyTravelID,
+					},
+				},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful get busy drivers of team": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			urlParams: map[string]string{
+				"status":  "busy",
+				"team_id": "1",
+			},
+			want: response{
+				Total:   1,
+				Pending: 0,
+				Result: []user.SecuredUser{
+					{
+						ID:       3,
+						Email:    "busy_email@hotmail.com",
+						Role:     "driver",
+						TravelID: &busyTravelID,
+					},
+				},
+			},
+			statusExpected: http.StatusOK,
+		},
 
-				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
-			} else {
-				response := user.SecuredUser{}
+		"successful get drivers of team": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			urlParams: map[string]string{
+				"team_id": "2",
+			},
+			want: response{
+				Total:   0,
+				Pending: 0,
+			},
+			statusExpected: http.StatusOK,
+		},
 
-				err := json.Unmarshal(w.Body.Bytes(), &response)
-				assert.Nil(t, err)
+		"failure get drivers: invalid team": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			urlParams: map[string]string{
+				"team_id": "north",
+			},
+			wantError:      errors.New("invalid_request - invalid search team received"),
+			statusExpected: http.StatusBadRequest,
+		},
 
-				assert.Equal(t, tc.want.Email, response.Email)
-				assert.Equal(t, tc.want.Role, response.Role)
-				assert.Equal(t, tc.want.ID, response.ID)
-			}
-		})
-	}
-}
+		"failure due to zone with busy status": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			urlParams: map[string]string{
+				"status":  "busy",
+				"zone_id": "1",
+			},
+			wantError:      errors.New("invalid_request - invalid search zone received, it is only accepted with free status"),
+			statusExpected: http.StatusBadRequest,
+		},
 
-func Test_searchUser(t *testing.T) {
-	type response struct {
-		Total   int64              `json:"total"`
-		Pending int64              `json:"pending"`
-		Result  []user.SecuredUser `json:"result"`
-	}
+		"failure get free drivers: bad status": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			urlParams: map[string]string{
+				"status": "unknown",
+			},
+			wantError:      errors.New("invalid_request - invalid search status received"),
+			statusExpected: http.StatusBadRequest,
+		},
 
-	testscases := map[string]struct {
-		userStorage    UsersStorage
-		urlParams      map[string]string
-		want           response
-		wantError      error
-		statusExpected int
-	}{
-		"successful get free drivers": {
+		"successful get free drivers: paginated": {
 			userStorage: user.NewUserStorage(newMockDB()),
 			urlParams: map[string]string{
 				"status": "free",
+				"limit":  "1",
+				"offset": "0",
 			},
 			want: response{
 				Total:   2,
-				Pending: 0,
+				Pending: 1,
 				Result: []user.SecuredUser{
 					user.SecuredUser{
 						ID:    1,
 						Email: "an_email@hotmail.com",
 						Role:  "driver",
+						Rating: &user.DriverRating{
+							Average: 4.5,
+							Count:   2,
+						},
 					},
+				},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful get free drivers: with min rating": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			urlParams: map[string]string{
+				"status":     "free",
+				"min_rating": "4",
+			},
+			want: response{
+				Total:   1,
+				Pending: 0,
+				Result: []user.SecuredUser{
 					user.SecuredUser{
-						ID:    2,
-						Email: "another_email@hotmail.com",
+						ID:    1,
+						Email: "an_email@hotmail.com",
 						Role:  "driver",
+						Rating: &user.DriverRating{
+							Average: 4.5,
+							Count:   2,
+						},
 					},
 				},
 			},
 			statusExpected: http.StatusOK,
 		},
 
-		"failure get free drivers: bad status": {
+		"failure get free drivers: invalid min rating": {
 			userStorage: user.NewUserStorage(newMockDB()),
 			urlParams: map[string]string{
-				"status": "unknown",
+				"status":     "free",
+				"min_rating": "6",
 			},
-			wantError:      errors.New("invalid_request - invalid search status received"),
+			wantError:      errors.New("invalid_request - invalid search min rating received, it should be between 1 and 5"),
 			statusExpected: http.StatusBadRequest,
 		},
 
-		"failure get free drivers: with limit": {
+		"failure get free drivers: invalid limit 0": {
 			userStorage: user.NewUserStorage(newMockDB()),
 			urlParams: map[string]string{
 				"status": "free",
 				"limit":  "0",
 			},
-			wantError:      errors.New("invalid_request - search free driver do not accept limit or offset param"),
+			wantError:      errors.New("invalid_request - invalid search limit received"),
 			statusExpected: http.StatusBadRequest,
 		},
 
-		"failure get free drivers: with offset": {
+		"failure get busy drivers: with limit": {
 			userStorage: user.NewUserStorage(newMockDB()),
 			urlParams: map[string]string{
-				"status": "free",
+				"status": "busy",
+				"limit":  "10",
+			},
+			wantError:      errors.New("invalid_request - search busy driver do not accept limit or offset param"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure get busy drivers: with offset": {
+			userStorage: user.NewUserStorage(newMockDB()),
+			urlParams: map[string]string{
+				"status": "busy",
 				"offset": "0",
 			},
-			wantError:      errors.New("invalid_request - search free driver do not accept limit or offset param"),
+			wantError:      errors.New("invalid_request - search busy driver do not accept limit or offset param"),
 			statusExpected: http.StatusBadRequest,
 		},
 
@@ -532,12 +1968,240 @@ func Test_searchUser(t *testing.T) {
 					assert.Equal(t, securedUser.Email, response.Result[i].Email)
 					assert.Equal(t, securedUser.Email, response.Result[i].Email)
 					assert.Equal(t, securedUser.Role, response.Result[i].Role)
+					assert.Equal(t, securedUser.Rating, response.Result[i].Rating)
+					assert.Equal(t, securedUser.TravelID, response.Result[i].TravelID)
 				}
 			}
 		})
 	}
 }
 
+func Test_listUsers(t *testing.T) {
+	type response struct {
+		Total   int64              `json:"total"`
+		Pending int64              `json:"pending"`
+		Result  []user.SecuredUser `json:"result"`
+	}
+
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = user.User{SecuredUser: user.SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: "admin"}}
+		db.users[2] = user.User{SecuredUser: user.SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: "driver"}}
+		return db
+	}
+
+	testscases := map[string]struct {
+		urlParams      map[string]string
+		want           response
+		wantError      error
+		statusExpected int
+	}{
+		"successful list of every role": {
+			want: response{
+				Total: 2,
+				Result: []user.SecuredUser{
+					{ID: 1, Email: "admin@hotmail.com", Role: "admin"},
+					{ID: 2, Email: "driver@hotmail.com", Role: "driver"},
+				},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful list of admins": {
+			urlParams: map[string]string{"role": "admin"},
+			want: response{
+				Total:  1,
+				Result: []user.SecuredUser{{ID: 1, Email: "admin@hotmail.com", Role: "admin"}},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful list paginated": {
+			urlParams: map[string]string{"limit": "1", "offset": "1"},
+			want: response{
+				Total:  2,
+				Result: []user.SecuredUser{{ID: 2, Email: "driver@hotmail.com", Role: "driver"}},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful list by email": {
+			urlParams: map[string]string{"email": "driver@hotmail.com"},
+			want: response{
+				Total:  1,
+				Result: []user.SecuredUser{{ID: 2, Email: "driver@hotmail.com", Role: "driver"}},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful list with fields": {
+			urlParams: map[string]string{"fields": "id, email,unknown"},
+			want: response{
+				Total: 2,
+				Result: []user.SecuredUser{
+					{ID: 1, Email: "admin@hotmail.com"},
+					{ID: 2, Email: "driver@hotmail.com"},
+				},
+			},
+			statusExpected: http.StatusOK,
+		},
+
+		"successful list by email: not found": {
+			urlParams:      map[string]string{"email": "unknown@hotmail.com"},
+			want:           response{Result: []user.SecuredUser{}},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to invalid role": {
+			urlParams:      map[string]string{"role": "an invalid role"},
+			wantError:      errors.New("invalid_role - the received role should be admin, dispatcher or driver"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to invalid sort": {
+			urlParams:      map[string]string{"sort": "email"},
+			wantError:      errors.New("invalid_sort - the users can be sorted by id, created_at or updated_at"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to invalid limit": {
+			urlParams:      map[string]string{"limit": "0"},
+			wantError:      errors.New("invalid_request - invalid search limit received"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to invalid offset": {
+			urlParams:      map[string]string{"offset": "an offset"},
+			wantError:      errors.New("invalid_request - invalid search offset received"),
+			statusExpected: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+
+			req := &http.Request{
+				URL:    &url.URL{},
+				Header: make(http.Header),
+			}
+			q := req.URL.Query()
+			for k, v := range tc.urlParams {
+				q.Add(k, v)
+			}
+			req.URL.RawQuery = q.Encode()
+			c.Request = req
+
+			handler := UserHandler{
+				Users: user.NewUserStorage(newDb()),
+			}
+			handler.List(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var resp response
+				err := json.Unmarshal(w.Body.Bytes(), &resp)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, resp)
+			}
+		})
+	}
+}
+
+func Test_sessions(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	userDB := newMockDB()
+	created, _ := userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{
+			Email: "an_email@",
+			Role:  "driver",
+		},
+		Password: "1234",
+	})
+
+	users := user.NewUserStorage(userDB, user.WithPasswordEncrypter(NoEncrypter{}))
+	var refreshTokens []string
+	for _, agent := range []string{"a phone", "a browser"} {
+		ctx := context.WithValue(context.Background(), audit.ClientKey, audit.Client{IP: "10.0.0.1", UserAgent: agent})
+		session, err := users.Login(ctx, user.User{
+			SecuredUser: user.SecuredUser{Email: "an_email@"},
+			Password:    "1234",
+		})
+		assert.Nil(t, err)
+		refreshTokens = append(refreshTokens, session.RefreshToken)
+	}
+
+	handler := UserHandler{
+		Users: users,
+	}
+	call := func(params gin.Params, handle func(c *gin.Context)) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+
+		c, _ := gin.CreateTestContext(w)
+		c.Request = &http.Request{
+			Header: make(http.Header),
+		}
+		c.Params = params
+		c.Set("user_on_call", jwt.Claims{UserID: created.ID, Role: user.RoleDriver})
+
+		handle(c)
+		c.Writer.WriteHeaderNow()
+
+		return w
+	}
+	list := func() []user.UserSession {
+		w := call(nil, handler.ListSessions)
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var resp struct {
+			Result []user.UserSession `json:"result"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &resp)
+		assert.Nil(t, err)
+
+		return resp.Result
+	}
+
+	sessions := list()
+	assert.Len(t, sessions, 2)
+	assert.Equal(t, "a browser", sessions[0].UserAgent)
+	assert.Equal(t, "10.0.0.1", sessions[0].IP)
+
+	// revoking the session of the phone revokes its refresh token
+	w := call(gin.Params{{Key: "id", Value: strconv.FormatInt(sessions[1].ID, 10)}}, handler.RevokeSession)
+	assert.Equal(t, http.StatusNoContent, w.Code)
+
+	_, err := users.Refresh(context.Background(), refreshTokens[0])
+	assert.Equal(t, user.ErrInvalidRefreshToken.Error(), err.Error())
+
+	_, err = users.Refresh(context.Background(), refreshTokens[1])
+	assert.Nil(t, err)
+
+	sessions = list()
+	assert.Len(t, sessions, 1)
+	assert.Equal(t, "a browser", sessions[0].UserAgent)
+
+	w = call(gin.Params{{Key: "id", Value: "1"}}, handler.RevokeSession)
+	assert.Equal(t, http.StatusNotFound, w.Code)
+
+	var apiErr apiError
+	err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+	assert.Nil(t, err)
+	assert.Equal(t, "not_found_session - not founded the session to get", apiErr.Error())
+}
+
 func mockJson(c *gin.Context, method string, body interface{}) error {
 	c.Request.Method = method
 	c.Request.Header.Set("Content-Type", "application/json")
@@ -551,3 +2215,146 @@ func mockJson(c *gin.Context, method string, body interface{}) error {
 
 	return nil
 }
+
+func Test_impersonate(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	userDB := newMockDB()
+	admin, _ := userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{Email: "admin@", Role: user.RoleAdmin, Active: true},
+	})
+	driver, _ := userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{Email: "driver@", Role: user.RoleDriver, Active: true},
+	})
+
+	eventsDB := &eventMockDb{}
+	events := audit.NewEventStorage(eventsDB)
+	users := user.NewUserStorage(userDB, user.WithSecurityAuditor(events))
+	rules := Rules{
+		http.MethodPost: {"/v1/users/:id/impersonate": {user.PermissionUserImpersonate}},
+		http.MethodGet:  {"/v1/audit/events": {user.PermissionAuditRead}},
+	}
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	router.POST("/v1/users/:id/impersonate", AuthenticateRequest(), AuthorizeRequest(rules, events),
+		UserHandler{Users: users}.Impersonate)
+	router.GET("/v1/audit/events", AuthenticateRequest(), AuthorizeRequest(rules, events),
+		AuditHandler{Events: events}.List)
+
+	call := func(method, path, token string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+
+		router.ServeHTTP(w, req)
+
+		return w
+	}
+
+	adminToken, err := jwt.GenerateToken(admin.ID, admin.Email, admin.Role, user.RolePermissions(admin.Role))
+	assert.Nil(t, err)
+
+	w = call(http.MethodPost, fmt.Sprintf("/v1/users/%d/impersonate", driver.ID), adminToken)
+	assert.Equal(t, http.StatusCreated, w.Code)
+
+	var impersonation user.Impersonation
+	err = json.Unmarshal(w.Body.Bytes(), &impersonation)
+	assert.Nil(t, err)
+	assert.Equal(t, driver.ID, impersonation.UserID)
+	assert.WithinDuration(t, time.Now().Add(user.DefaultImpersonationTTL), impersonation.ExpiresAt, 2*time.Second)
+
+	token, err := jwt.ValidateToken(context.Background(), impersonation.Token)
+	assert.Nil(t, err)
+	claims, err := jwt.GetClaims(token)
+	assert.Nil(t, err)
+	assert.Equal(t, driver.ID, claims.UserID)
+	assert.Equal(t, admin.ID, claims.ImpersonatorID)
+	assert.Equal(t, []string(user.RolePermissions(user.RoleDriver)), claims.Permissions)
+
+	// the impersonation token has the driver permissions, and its accesses denied are recorded with the impersonator
+	w = call(http.MethodGet, "/v1/audit/events", impersonation.Token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+	w = call(http.MethodPost, fmt.Sprintf("/v1/users/%d/impersonate", driver.ID), impersonation.Token)
+	assert.Equal(t, http.StatusUnauthorized, w.Code)
+
+	assert.Len(t, eventsDB.events, 3)
+	assert.Equal(t, audit.EventImpersonation, eventsDB.events[0].Type)
+	assert.Equal(t, admin.ID, eventsDB.events[0].UserID)
+	assert.Equal(t, fmt.Sprintf("as user %d (driver@)", driver.ID), eventsDB.events[0].Detail)
+	assert.Equal(t, audit.EventAccessDenied, eventsDB.events[1].Type)
+	assert.Equal(t, driver.ID, eventsDB.events[1].UserID)
+	assert.Equal(t, fmt.Sprintf("GET /v1/audit/events impersonated by user %d", admin.ID), eventsDB.events[1].Detail)
+
+	// only drivers can be impersonated
+	w = call(http.MethodPost, fmt.Sprintf("/v1/users/%d/impersonate", admin.ID), adminToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+
+	var apiErr apiError
+	err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+	assert.Nil(t, err)
+	assert.Equal(t, user.ErrInvalidImpersonation.Error(), apiErr.Error())
+
+	suspended, _ := userDB.SaveUser(context.Background(), user.User{
+		SecuredUser: user.SecuredUser{Email: "suspended@", Role: user.RoleDriver},
+	})
+	suspended.Active = false
+	userDB.users[suspended.ID] = suspended
+	w = call(http.MethodPost, fmt.Sprintf("/v1/users/%d/impersonate", suspended.ID), adminToken)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
+
+func Test_mapValidateError(t *testing.T) {
+	type contact struct {
+		Phone string `json:"phone" binding:"max=5"`
+	}
+	type request struct {
+		contact
+		Email string   `json:"email" binding:"required"`
+		Role  string   `json:"role" binding:"oneof=admin driver"`
+		Home  *contact `json:"home"`
+		Limit int64    `form:"limit" binding:"min=1"`
+	}
+
+	testscases := map[string]struct {
+		err  error
+		want apiError
+	}{
+		"successful error of each invalid field with its json name and rule": {
+			err: binding.Validator.ValidateStruct(request{contact: contact{Phone: "123456"}, Role: "pilot",
+				Home: &contact{Phone: "123456"}}),
+			want: apiError{
+				Code:    "invalid_request",
+				Message: "there was an error with fields: phone,email,role,home.phone,limit",
+				Fields: []fieldError{
+					{Field: "phone", Rule: "max", Param: "5", Message: "the field should be at most 5"},
+					{Field: "email", Rule: "required", Message: "the field is required"},
+					{Field: "role", Rule: "oneof", Param: "admin driver", Message: "the field should be one of: admin, driver"},
+					{Field: "home.phone", Rule: "max", Param: "5", Message: "the field should be at most 5"},
+					{Field: "limit", Rule: "min", Param: "1", Message: "the field should be at least 1"},
+				},
+			},
+		},
+		"successful error of an anonymous struct": {
+			err: binding.Validator.ValidateStruct(struct {
+				UserID int64 `json:"user_id" binding:"required"`
+			}{}),
+			want: apiError{
+				Code:    "invalid_request",
+				Message: "there was an error with fields: user_id",
+				Fields:  []fieldError{{Field: "user_id", Rule: "required", Message: "the field is required"}},
+			},
+		},
+		"successful error of a request which cannot be parsed": {
+			err:  errors.New("unexpected EOF"),
+			want: apiError{Code: "invalid_request", Message: "the received request is invalid"},
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, mapValidateError(tc.err))
+		})
+	}
+}
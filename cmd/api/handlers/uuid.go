@@ -0,0 +1,43 @@
+package handlers
+
+import (
+	"context"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/uuid"
+	"strconv"
+)
+
+// ResolveUserUUID middleware accept the public uuid of a user instead of its id as url param, replacing it with the
+// id of the user so the next handlers can parse it as usual
+func ResolveUserUUID(users UsersStorage) gin.HandlerFunc {
+	return resolveUUID(users.IDByUUID, mapUserError)
+}
+
+// ResolveTravelUUID middleware accept the public uuid of a travel instead of its id as url param, replacing it with
+// the id of the travel so the next handlers can parse it as usual
+func ResolveTravelUUID(travels TravelStorage) gin.HandlerFunc {
+	return resolveUUID(travels.IDByUUID, mapTravelError)
+}
+
+// resolveUUID replace the id url param with the result of resolve when it is a uuid, ids are kept as received
+func resolveUUID(resolve func(ctx context.Context, publicID string) (int64, error),
+	mapError func(err error) (int, error)) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		for i, param := range ctx.Params {
+			if param.Key != "id" || !uuid.Valid(param.Value) {
+				continue
+			}
+
+			id, err := resolve(ctx, param.Value)
+			if err != nil {
+				code, resp := mapError(err)
+				ctx.AbortWithStatusJSON(code, resp)
+				return
+			}
+
+			ctx.Params[i].Value = strconv.FormatInt(id, 10)
+		}
+
+		ctx.Next()
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/travel"
+	"github.com/nicocarolo/space-drivers/internal/user"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func Test_resolveUUID(t *testing.T) {
+	db := newMockDB()
+	db.users[1] = user.User{SecuredUser: user.SecuredUser{ID: 1, UUID: "0b7e1c4a-5d2f-4e8a-9c3b-1f6d2a7e8b90",
+		Email: "driver@hotmail.com", Role: "driver"}}
+
+	travels := newTravelMockDbFromMap(map[int64]travel.Travel{})
+	travels.archived[2] = travel.Travel{ID: 2, UUID: "7c9e6679-7425-40de-944b-e07fc1f90ae7"}
+
+	w := httptest.NewRecorder()
+	_, router := gin.CreateTestContext(w)
+	echoID := func(c *gin.Context) {
+		c.JSON(http.StatusOK, gin.H{"id": c.Param("id")})
+	}
+	router.GET("/users/:id", ResolveUserUUID(user.NewUserStorage(db)), echoID)
+	router.GET("/travels/:id", ResolveTravelUUID(travel.NewTravelStorage(travels)), echoID)
+
+	testscases := map[string]struct {
+		path           string
+		want           string
+		wantError      error
+		statusExpected int
+	}{
+		"successful resolved user uuid": {
+			path:           "/users/0b7e1c4a-5d2f-4e8a-9c3b-1f6d2a7e8b90",
+			want:           "1",
+			statusExpected: http.StatusOK,
+		},
+
+		"successful resolved archived travel uuid": {
+			path:           "/travels/7c9e6679-7425-40de-944b-e07fc1f90ae7",
+			want:           "2",
+			statusExpected: http.StatusOK,
+		},
+
+		"successful kept id": {
+			path:           "/users/5",
+			want:           "5",
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to non existent user uuid": {
+			path:           "/users/6ba7b810-9dad-41d1-80b4-00c04fd430c8",
+			wantError:      errors.New("not_found_user - not founded the user to get"),
+			statusExpected: http.StatusNotFound,
+		},
+
+		"failure due to non existent travel uuid": {
+			path:           "/travels/6ba7b810-9dad-41d1-80b4-00c04fd430c8",
+			wantError:      errors.New("not_found_travel - not founded the travel to get"),
+			statusExpected: http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+			req, _ := http.NewRequest(http.MethodGet, tc.path, nil)
+
+			router.ServeHTTP(w, req)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				var response map[string]string
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, response["id"])
+			}
+		})
+	}
+}
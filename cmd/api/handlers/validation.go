@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+	"github.com/nicocarolo/space-drivers/internal/travel"
+	"reflect"
+	"strings"
+)
+
+// coordinatesTag is the validation tag reported when a received point is out of the valid coordinates
+const coordinatesTag = "coordinates"
+
+// embeddedPrefix prefix the name of the embedded structs without json name, which fields are encoded as fields of
+// the struct which embeds them, so they are removed from the path of the fields (see validationField)
+const embeddedPrefix = "~"
+
+// register the custom validations on gin binding validator, so they run on every request bind, and name the fields
+// as the clients send them
+func init() {
+	if v, ok := binding.Validator.Engine().(*validator.Validate); ok {
+		v.RegisterStructValidation(validatePoint, travel.Point{})
+		v.RegisterTagNameFunc(fieldName)
+	}
+}
+
+// fieldName return the name of the field on the requests: its json name, or its form or uri one for the query and
+// path params, and its go name for the fields without them
+func fieldName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "form", "uri"} {
+		name := strings.SplitN(field.Tag.Get(tag), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		if name != "" {
+			return name
+		}
+	}
+
+	if field.Anonymous {
+		return embeddedPrefix + field.Name
+	}
+	return field.Name
+}
+
+// validatePoint report a coordinates error on each coordinate of the point out of range
+func validatePoint(sl validator.StructLevel) {
+	point := sl.Current().Interface().(travel.Point)
+	if point.Lat < -90 || point.Lat > 90 {
+		sl.ReportError(point.Lat, "latitude", "Lat", coordinatesTag, "")
+	}
+	if point.Lng < -180 || point.Lng > 180 {
+		sl.ReportError(point.Lng, "longitude", "Lng", coordinatesTag, "")
+	}
+}
+
+// validationMessage return the message of the rule which the field failed
+func validationMessage(validationErr validator.FieldError) string {
+	param := validationErr.Param()
+	switch validationErr.Tag() {
+	case "required":
+		return "the field is required"
+	case "oneof":
+		return "the field should be one of: " + strings.Join(strings.Fields(param), ", ")
+	case "min", "gte":
+		return "the field should be at least " + param
+	case "max", "lte":
+		return "the field should be at most " + param
+	case "gt":
+		return "the field should be greater than " + param
+	case "lt":
+		return "the field should be less than " + param
+	case "len":
+		return "the field should have a length of " + param
+	case "email":
+		return "the field should be an email"
+	}
+
+	if param != "" {
+		return "the field does not satisfy the " + validationErr.Tag() + "=" + param + " rule"
+	}
+	return "the field does not satisfy the " + validationErr.Tag() + " rule"
+}
+
+// validationField return the path of the field which failed the validation on the request, as from.latitude for
+// the nested ones
+func validationField(validationErr validator.FieldError) string {
+	names := strings.Split(validationErr.Namespace(), ".")
+
+	// the namespaces start with the name of the struct validated, which is the same on both of them, unless it is an
+	// anonymous struct
+	structNames := strings.Split(validationErr.StructNamespace(), ".")
+	if len(names) > 1 && names[0] == structNames[0] {
+		names = names[1:]
+	}
+
+	path := make([]string, 0, len(names))
+	for _, name := range names {
+		if !strings.HasPrefix(name, embeddedPrefix) {
+			path = append(path, name)
+		}
+	}
+
+	if len(path) == 0 {
+		return validationErr.Field()
+	}
+	return strings.Join(path, ".")
+}
@@ -0,0 +1,217 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/vehicle"
+	"net/http"
+	"strconv"
+)
+
+type VehiclesStorage interface {
+	Get(ctx context.Context, id int64) (vehicle.Vehicle, error)
+	List(ctx context.Context) ([]vehicle.Vehicle, error)
+	Save(ctx context.Context, vehicle vehicle.Vehicle) (vehicle.Vehicle, error)
+	Update(ctx context.Context, vehicle vehicle.Vehicle) (vehicle.Vehicle, error)
+	Delete(ctx context.Context, id int64) error
+	AssignDriver(ctx context.Context, id int64, userID int64) (vehicle.Vehicle, error)
+	UnassignDriver(ctx context.Context, id int64) error
+}
+
+type VehicleHandler struct {
+	Vehicles VehiclesStorage
+}
+
+// Get handler will parse received id as url param and get the vehicle from storage
+func (h VehicleHandler) Get(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a vehicle id to get",
+		})
+		return
+	}
+
+	vehicleResp, err := h.Vehicles.Get(c, id)
+	if err != nil {
+		code, resp := mapVehicleError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, vehicleResp)
+}
+
+// List handler will get all the vehicles from storage
+func (h VehicleHandler) List(c *gin.Context) {
+	vehicles, err := h.Vehicles.List(c)
+	if err != nil {
+		code, resp := mapVehicleError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	if vehicles == nil {
+		vehicles = []vehicle.Vehicle{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": vehicles})
+}
+
+// Create handler will parse received body and save it to storage
+func (h VehicleHandler) Create(c *gin.Context) {
+	var vehicleToCreate vehicle.Vehicle
+	if err := c.ShouldBindJSON(&vehicleToCreate); err != nil {
+		log.ErrorLimited(c, "there was an error parsing vehicle create request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	createdVehicle, err := h.Vehicles.Save(c, vehicleToCreate)
+	if err != nil {
+		code, resp := mapVehicleError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, createdVehicle)
+}
+
+// Edit handler will parse received body and id and replace the vehicle plate, capacity and class on storage
+func (h VehicleHandler) Edit(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a vehicle id to edit",
+		})
+		return
+	}
+
+	var vehicleToEdit vehicle.Vehicle
+	if err := c.ShouldBindJSON(&vehicleToEdit); err != nil {
+		log.ErrorLimited(c, "there was an error parsing vehicle edit request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+	vehicleToEdit.ID = id
+
+	editedVehicle, err := h.Vehicles.Update(c, vehicleToEdit)
+	if err != nil {
+		code, resp := mapVehicleError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, editedVehicle)
+}
+
+// Delete handler will remove the vehicle with the received id from storage
+func (h VehicleHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a vehicle id to delete",
+		})
+		return
+	}
+
+	if err := h.Vehicles.Delete(c, id); err != nil {
+		code, resp := mapVehicleError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// AssignDriver handler will parse received body and id and assign the vehicle to the driver, it return the vehicle
+func (h VehicleHandler) AssignDriver(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a vehicle id to assign driver",
+		})
+		return
+	}
+
+	var driver struct {
+		UserID int64 `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&driver); err != nil {
+		log.ErrorLimited(c, "there was an error parsing vehicle driver request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	assignedVehicle, err := h.Vehicles.AssignDriver(c, id, driver.UserID)
+	if err != nil {
+		code, resp := mapVehicleError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, assignedVehicle)
+}
+
+// UnassignDriver handler will leave the vehicle with the received id without driver
+func (h VehicleHandler) UnassignDriver(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a vehicle id to unassign driver",
+		})
+		return
+	}
+
+	if err := h.Vehicles.UnassignDriver(c, id); err != nil {
+		code, resp := mapVehicleError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// mapVehicleError received an error (preferentially a one received from storage) and return a http status code and
+// an api error to use on the return value to the client
+func mapVehicleError(err error) (int, error) {
+	errToStatus := map[code_error.Error]int{
+		vehicle.ErrInvalidPlate:          http.StatusBadRequest,
+		vehicle.ErrInvalidCapacity:       http.StatusBadRequest,
+		vehicle.ErrInvalidClass:          http.StatusBadRequest,
+		vehicle.ErrPlateAlreadyExists:    http.StatusConflict,
+		vehicle.ErrNotFoundVehicle:       http.StatusNotFound,
+		vehicle.ErrInvalidVehicleDriver:  http.StatusBadRequest,
+		vehicle.ErrNotFoundVehicleDriver: http.StatusNotFound,
+		vehicle.ErrStorageSave:           http.StatusInternalServerError,
+		vehicle.ErrStorageGet:            http.StatusInternalServerError,
+		vehicle.ErrStorageUpdate:         http.StatusInternalServerError,
+		vehicle.ErrStorageDelete:         http.StatusInternalServerError,
+	}
+
+	var vehicleErr code_error.Error
+	if errors.As(err, &vehicleErr) {
+		if code, ok := errToStatus[vehicleErr]; ok {
+			return code, apiError{
+				Code:    vehicleErr.GetCode(),
+				Message: vehicleErr.GetDetail(),
+			}
+		}
+	}
+
+	return http.StatusInternalServerError, apiError{
+		Code:    "error",
+		Message: err.Error(),
+	}
+}
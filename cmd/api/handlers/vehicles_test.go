@@ -0,0 +1,305 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/vehicle"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+)
+
+// vehicleMockDb a 'db' to use on VehicleHandler test with the capabilities to mock errors on save action
+type vehicleMockDb struct {
+	idCount  int64
+	vehicles map[int64]vehicle.Vehicle
+
+	saveError error
+}
+
+func newVehicleMockDB(vehicles ...vehicle.Vehicle) *vehicleMockDb {
+	db := &vehicleMockDb{
+		idCount:  1,
+		vehicles: make(map[int64]vehicle.Vehicle),
+	}
+
+	for _, v := range vehicles {
+		db.vehicles[v.ID] = v
+		db.idCount++
+	}
+
+	return db
+}
+
+func (db *vehicleMockDb) onCreate(err error) *vehicleMockDb {
+	db.saveError = err
+	return db
+}
+
+func (db *vehicleMockDb) SaveVehicle(ctx context.Context, v vehicle.Vehicle) (vehicle.Vehicle, error) {
+	if db.saveError != nil {
+		return vehicle.Vehicle{}, db.saveError
+	}
+
+	v.ID = db.idCount
+	db.vehicles[v.ID] = v
+
+	db.idCount++
+
+	return v, nil
+}
+
+func (db vehicleMockDb) GetVehicle(ctx context.Context, id int64) (vehicle.Vehicle, error) {
+	v, exist := db.vehicles[id]
+	if !exist {
+		return vehicle.Vehicle{}, vehicle.ErrVehicleNotFound
+	}
+
+	return v, nil
+}
+
+func (db vehicleMockDb) GetVehicles(ctx context.Context) ([]vehicle.Vehicle, error) {
+	var vehicles []vehicle.Vehicle
+	for _, v := range db.vehicles {
+		vehicles = append(vehicles, v)
+	}
+
+	sort.Slice(vehicles, func(i, j int) bool { return vehicles[i].ID < vehicles[j].ID })
+
+	return vehicles, nil
+}
+
+func (db *vehicleMockDb) UpdateVehicle(ctx context.Context, v vehicle.Vehicle) error {
+	if _, exist := db.vehicles[v.ID]; !exist {
+		return vehicle.ErrVehicleNotFound
+	}
+
+	db.vehicles[v.ID] = v
+
+	return nil
+}
+
+func (db *vehicleMockDb) DeleteVehicle(ctx context.Context, id int64) error {
+	if _, exist := db.vehicles[id]; !exist {
+		return vehicle.ErrVehicleNotFound
+	}
+
+	delete(db.vehicles, id)
+
+	return nil
+}
+
+// AssignVehicleDriver users from 1 to 3 are the only drivers
+func (db *vehicleMockDb) AssignVehicleDriver(ctx context.Context, id, userID int64) error {
+	v, exist := db.vehicles[id]
+	if !exist {
+		return vehicle.ErrVehicleNotFound
+	}
+
+	if userID < 1 || userID > 3 {
+		return vehicle.ErrDriverNotFound
+	}
+
+	v.UserID = &userID
+	db.vehicles[id] = v
+
+	return nil
+}
+
+func (db *vehicleMockDb) UnassignVehicleDriver(ctx context.Context, id int64) error {
+	v, exist := db.vehicles[id]
+	if !exist || v.UserID == nil {
+		return vehicle.ErrVehicleDriverNotFound
+	}
+
+	v.UserID = nil
+	db.vehicles[id] = v
+
+	return nil
+}
+
+func (db vehicleMockDb) GetDriversVehicles(ctx context.Context, userIDs []int64) ([]vehicle.Vehicle, error) {
+	var vehicles []vehicle.Vehicle
+	for _, v := range db.vehicles {
+		for _, userID := range userIDs {
+			if v.UserID != nil && *v.UserID == userID {
+				vehicles = append(vehicles, v)
+			}
+		}
+	}
+
+	return vehicles, nil
+}
+
+func Test_createVehicle(t *testing.T) {
+	testscases := map[string]struct {
+		vehicleStorage VehiclesStorage
+		body           map[string]interface{}
+		want           vehicle.Vehicle
+		wantError      error
+		statusExpected int
+	}{
+		"successful created vehicle": {
+			vehicleStorage: vehicle.NewVehicleStorage(newVehicleMockDB()),
+			body:           map[string]interface{}{"plate": "ab123cd", "capacity": 4, "class": "economy"},
+			want:           vehicle.Vehicle{ID: 1, Plate: "AB123CD", Capacity: 4, Class: vehicle.ClassEconomy},
+			statusExpected: http.StatusCreated,
+		},
+
+		"failure due to invalid request: no class": {
+			vehicleStorage: vehicle.NewVehicleStorage(newVehicleMockDB()),
+			body:           map[string]interface{}{"plate": "AB123CD", "capacity": 4},
+			wantError:      errors.New("invalid_request - there was an error with fields: class"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to invalid class": {
+			vehicleStorage: vehicle.NewVehicleStorage(newVehicleMockDB()),
+			body:           map[string]interface{}{"plate": "AB123CD", "capacity": 4, "class": "spaceship"},
+			wantError:      errors.New("invalid_vehicle - the vehicle class should be economy, comfort or cargo"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to duplicated plate": {
+			vehicleStorage: vehicle.NewVehicleStorage(newVehicleMockDB().onCreate(vehicle.ErrPlateDuplicated)),
+			body:           map[string]interface{}{"plate": "AB123CD", "capacity": 4, "class": "economy"},
+			wantError:      errors.New("plate_already_exists - there is already a vehicle with the received plate"),
+			statusExpected: http.StatusConflict,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+
+			handler := VehicleHandler{
+				Vehicles: tc.vehicleStorage,
+			}
+			handler.Create(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := vehicle.Vehicle{}
+
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				response.CreatedAt = tc.want.CreatedAt
+				assert.Equal(t, tc.want, response)
+			}
+		})
+	}
+}
+
+func Test_vehicleDriver(t *testing.T) {
+	db := newVehicleMockDB(vehicle.Vehicle{ID: 1, Plate: "AB123CD", Capacity: 4, Class: vehicle.ClassEconomy})
+	handler := VehicleHandler{
+		Vehicles: vehicle.NewVehicleStorage(db),
+	}
+
+	testscases := map[string]struct {
+		id             string
+		userID         int64
+		wantError      error
+		statusExpected int
+	}{
+		"successful assigned driver": {
+			id:             "1",
+			userID:         2,
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to invalid request: no id": {
+			id:             "an id",
+			userID:         2,
+			wantError:      errors.New("invalid_request - the request has not a vehicle id to assign driver"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to non existent vehicle": {
+			id:             "2",
+			userID:         2,
+			wantError:      errors.New("not_found_vehicle - not founded the vehicle to get"),
+			statusExpected: http.StatusNotFound,
+		},
+
+		"failure due to user that is not a driver": {
+			id:             "1",
+			userID:         4,
+			wantError:      errors.New("invalid_user - the user to assign to the vehicle should be a driver"),
+			statusExpected: http.StatusBadRequest,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+			c.Params = gin.Params{{Key: "id", Value: tc.id}}
+
+			err := mockJson(c, http.MethodPut, map[string]interface{}{"user_id": tc.userID})
+			assert.Nil(t, err)
+
+			handler.AssignDriver(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := vehicle.Vehicle{}
+
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				if assert.NotNil(t, response.UserID) {
+					assert.Equal(t, tc.userID, *response.UserID)
+				}
+			}
+		})
+	}
+
+	t.Run("successful unassigned driver", func(t *testing.T) {
+		for _, statusExpected := range []int{http.StatusNoContent, http.StatusNotFound} {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+			handler.UnassignDriver(c)
+			c.Writer.WriteHeaderNow()
+
+			// the second time the vehicle has no driver to unassign
+			assert.Equal(t, statusExpected, w.Code)
+		}
+
+		assert.Nil(t, db.vehicles[1].UserID)
+	})
+}
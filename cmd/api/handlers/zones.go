@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/zone"
+	"net/http"
+	"strconv"
+)
+
+type ZonesStorage interface {
+	Get(ctx context.Context, id int64) (zone.Zone, error)
+	List(ctx context.Context) ([]zone.Zone, error)
+	Save(ctx context.Context, zone zone.Zone) (zone.Zone, error)
+	Update(ctx context.Context, zone zone.Zone) (zone.Zone, error)
+	Delete(ctx context.Context, id int64) error
+	Drivers(ctx context.Context, id int64) (zone.ZoneDrivers, error)
+	AddDriver(ctx context.Context, id int64, userID int64) error
+	RemoveDriver(ctx context.Context, id int64, userID int64) error
+}
+
+type ZoneHandler struct {
+	Zones ZonesStorage
+}
+
+// Get handler will parse received id as url param and get the zone from storage
+func (h ZoneHandler) Get(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a zone id to get",
+		})
+		return
+	}
+
+	zoneResp, err := h.Zones.Get(c, id)
+	if err != nil {
+		code, resp := mapZoneError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, zoneResp)
+}
+
+// List handler will get all the zones from storage
+func (h ZoneHandler) List(c *gin.Context) {
+	zones, err := h.Zones.List(c)
+	if err != nil {
+		code, resp := mapZoneError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	if zones == nil {
+		zones = []zone.Zone{}
+	}
+
+	c.JSON(http.StatusOK, gin.H{"result": zones})
+}
+
+// Create handler will parse received body and save it to storage
+func (h ZoneHandler) Create(c *gin.Context) {
+	var zoneToCreate zone.Zone
+	if err := c.ShouldBindJSON(&zoneToCreate); err != nil {
+		log.ErrorLimited(c, "there was an error parsing zone create request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	createdZone, err := h.Zones.Save(c, zoneToCreate)
+	if err != nil {
+		code, resp := mapZoneError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, createdZone)
+}
+
+// Edit handler will parse received body and id and replace the zone name and area on storage
+func (h ZoneHandler) Edit(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a zone id to edit",
+		})
+		return
+	}
+
+	var zoneToEdit zone.Zone
+	if err := c.ShouldBindJSON(&zoneToEdit); err != nil {
+		log.ErrorLimited(c, "there was an error parsing zone edit request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+	zoneToEdit.ID = id
+
+	editedZone, err := h.Zones.Update(c, zoneToEdit)
+	if err != nil {
+		code, resp := mapZoneError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, editedZone)
+}
+
+// Delete handler will remove the zone with the received id from storage
+func (h ZoneHandler) Delete(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a zone id to delete",
+		})
+		return
+	}
+
+	if err := h.Zones.Delete(c, id); err != nil {
+		code, resp := mapZoneError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Drivers handler will get the drivers registered on the zone with the received id
+func (h ZoneHandler) Drivers(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a zone id to get drivers",
+		})
+		return
+	}
+
+	drivers, err := h.Zones.Drivers(c, id)
+	if err != nil {
+		code, resp := mapZoneError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusOK, drivers)
+}
+
+// AddDriver handler will parse received body and id and register the driver on the zone, it return the drivers
+// of the zone
+func (h ZoneHandler) AddDriver(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a zone id to add driver",
+		})
+		return
+	}
+
+	var driver struct {
+		UserID int64 `json:"user_id" binding:"required"`
+	}
+	if err := c.ShouldBindJSON(&driver); err != nil {
+		log.ErrorLimited(c, "there was an error parsing zone driver request", log.Err(err))
+		apiErr := mapValidateError(err)
+		c.JSON(http.StatusUnprocessableEntity, apiErr)
+		return
+	}
+
+	if err := h.Zones.AddDriver(c, id, driver.UserID); err != nil {
+		code, resp := mapZoneError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	drivers, err := h.Zones.Drivers(c, id)
+	if err != nil {
+		code, resp := mapZoneError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.JSON(http.StatusCreated, drivers)
+}
+
+// RemoveDriver handler will unregister the driver with the received user id from the zone
+func (h ZoneHandler) RemoveDriver(c *gin.Context) {
+	id, err := strconv.ParseInt(c.Param("id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a zone id to remove driver",
+		})
+		return
+	}
+
+	userID, err := strconv.ParseInt(c.Param("user_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, apiError{
+			Code:    "invalid_request",
+			Message: "the request has not a user id to remove from zone",
+		})
+		return
+	}
+
+	if err := h.Zones.RemoveDriver(c, id, userID); err != nil {
+		code, resp := mapZoneError(err)
+		c.JSON(code, resp)
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// mapZoneError received an error (preferentially a one received from storage) and return a http status code and
+// an api error to use on the return value to the client
+func mapZoneError(err error) (int, error) {
+	errToStatus := map[code_error.Error]int{
+		zone.ErrInvalidZoneName:    http.StatusBadRequest,
+		zone.ErrInvalidZoneArea:    http.StatusBadRequest,
+		zone.ErrNotFoundZone:       http.StatusNotFound,
+		zone.ErrInvalidZoneDriver:  http.StatusBadRequest,
+		zone.ErrNotFoundZoneDriver: http.StatusNotFound,
+		zone.ErrStorageSave:        http.StatusInternalServerError,
+		zone.ErrStorageGet:         http.StatusInternalServerError,
+		zone.ErrStorageUpdate:      http.StatusInternalServerError,
+		zone.ErrStorageDelete:      http.StatusInternalServerError,
+	}
+
+	var zoneErr code_error.Error
+	if errors.As(err, &zoneErr) {
+		if code, ok := errToStatus[zoneErr]; ok {
+			return code, apiError{
+				Code:    zoneErr.GetCode(),
+				Message: zoneErr.GetDetail(),
+			}
+		}
+	}
+
+	return http.StatusInternalServerError, apiError{
+		Code:    "error",
+		Message: err.Error(),
+	}
+}
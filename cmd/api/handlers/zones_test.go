@@ -0,0 +1,450 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gin-gonic/gin"
+	"github.com/nicocarolo/space-drivers/internal/travel"
+	"github.com/nicocarolo/space-drivers/internal/zone"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"testing"
+)
+
+// zoneMockDb a 'db' to use on ZoneHandler test with the capabilities to mock errors on save action
+type zoneMockDb struct {
+	idCount int64
+	zones   map[int64]zone.Zone
+	// drivers are the registered user ids by zone id, users from 1 to 3 are the only drivers
+	drivers map[int64][]int64
+
+	saveError error
+}
+
+func newZoneMockDB(zones ...zone.Zone) *zoneMockDb {
+	db := &zoneMockDb{
+		idCount: 1,
+		zones:   make(map[int64]zone.Zone),
+		drivers: make(map[int64][]int64),
+	}
+
+	for _, z := range zones {
+		db.zones[z.ID] = z
+		db.idCount++
+	}
+
+	return db
+}
+
+func (db *zoneMockDb) onCreate(err error) *zoneMockDb {
+	db.saveError = err
+	return db
+}
+
+func (db *zoneMockDb) SaveZone(ctx context.Context, z zone.Zone) (zone.Zone, error) {
+	if db.saveError != nil {
+		return zone.Zone{}, db.saveError
+	}
+
+	z.ID = db.idCount
+	db.zones[z.ID] = z
+
+	db.idCount++
+
+	return z, nil
+}
+
+func (db zoneMockDb) GetZone(ctx context.Context, id int64) (zone.Zone, error) {
+	z, exist := db.zones[id]
+	if !exist {
+		return zone.Zone{}, zone.ErrZoneNotFound
+	}
+
+	return z, nil
+}
+
+func (db zoneMockDb) GetZones(ctx context.Context) ([]zone.Zone, error) {
+	var zones []zone.Zone
+	for _, z := range db.zones {
+		zones = append(zones, z)
+	}
+
+	sort.Slice(zones, func(i, j int) bool { return zones[i].ID < zones[j].ID })
+
+	return zones, nil
+}
+
+func (db *zoneMockDb) UpdateZone(ctx context.Context, z zone.Zone) error {
+	if _, exist := db.zones[z.ID]; !exist {
+		return zone.ErrZoneNotFound
+	}
+
+	db.zones[z.ID] = z
+
+	return nil
+}
+
+func (db *zoneMockDb) DeleteZone(ctx context.Context, id int64) error {
+	if _, exist := db.zones[id]; !exist {
+		return zone.ErrZoneNotFound
+	}
+
+	delete(db.zones, id)
+
+	return nil
+}
+
+func (db *zoneMockDb) AddZoneDriver(ctx context.Context, zoneID, userID int64) error {
+	if userID < 1 || userID > 3 {
+		return zone.ErrDriverNotFound
+	}
+
+	db.drivers[zoneID] = append(db.drivers[zoneID], userID)
+
+	return nil
+}
+
+func (db *zoneMockDb) RemoveZoneDriver(ctx context.Context, zoneID, userID int64) error {
+	for i, id := range db.drivers[zoneID] {
+		if id == userID {
+			db.drivers[zoneID] = append(db.drivers[zoneID][:i], db.drivers[zoneID][i+1:]...)
+			return nil
+		}
+	}
+
+	return zone.ErrZoneDriverNotFound
+}
+
+func (db zoneMockDb) GetZoneDrivers(ctx context.Context, zoneID int64) ([]int64, error) {
+	return db.drivers[zoneID], nil
+}
+
+func (db zoneMockDb) GetDriverZones(ctx context.Context, userID int64) ([]int64, error) {
+	var zoneIDs []int64
+	for zoneID, userIDs := range db.drivers {
+		for _, id := range userIDs {
+			if id == userID {
+				zoneIDs = append(zoneIDs, zoneID)
+			}
+		}
+	}
+
+	return zoneIDs, nil
+}
+
+var zoneArea = []travel.Point{
+	{Lat: -35, Lng: -59},
+	{Lat: -34, Lng: -59},
+	{Lat: -34, Lng: -58},
+	{Lat: -35, Lng: -58},
+}
+
+func Test_createZone(t *testing.T) {
+	testscases := map[string]struct {
+		zoneStorage    ZonesStorage
+		body           map[string]interface{}
+		want           zone.Zone
+		wantError      error
+		statusExpected int
+	}{
+		"successful created zone": {
+			zoneStorage: zone.NewZoneStorage(newZoneMockDB()),
+			body: map[string]interface{}{
+				"name": "buenos aires",
+				"area": zoneArea,
+			},
+			want:           zone.Zone{ID: 1, Name: "buenos aires", Area: zoneArea},
+			statusExpected: http.StatusCreated,
+		},
+
+		"failure due to invalid request: no area": {
+			zoneStorage: zone.NewZoneStorage(newZoneMockDB()),
+			body: map[string]interface{}{
+				"name": "buenos aires",
+			},
+			wantError:      errors.New("invalid_request - there was an error with fields: area"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to invalid area": {
+			zoneStorage: zone.NewZoneStorage(newZoneMockDB()),
+			body: map[string]interface{}{
+				"name": "buenos aires",
+				"area": zoneArea[:2],
+			},
+			wantError:      errors.New("invalid_zone - the zone area should be a polygon of 3 to 100 valid vertices"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to storage error": {
+			zoneStorage: zone.NewZoneStorage(newZoneMockDB().onCreate(errors.New("mocked save error"))),
+			body: map[string]interface{}{
+				"name": "buenos aires",
+				"area": zoneArea,
+			},
+			wantError:      errors.New("storage_failure - an error ocurred trying to save zone"),
+			statusExpected: http.StatusInternalServerError,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+
+			handler := ZoneHandler{
+				Zones: tc.zoneStorage,
+			}
+			handler.Create(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := zone.Zone{}
+
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want.ID, response.ID)
+				assert.Equal(t, tc.want.Name, response.Name)
+				assert.Equal(t, tc.want.Area, response.Area)
+			}
+		})
+	}
+}
+
+func Test_getAndListZones(t *testing.T) {
+	storage := zone.NewZoneStorage(newZoneMockDB(zone.Zone{ID: 1, Name: "buenos aires", Area: zoneArea}))
+	handler := ZoneHandler{
+		Zones: storage,
+	}
+
+	testscases := map[string]struct {
+		urlParams      gin.Params
+		wantError      error
+		statusExpected int
+	}{
+		"successful get zone": {
+			urlParams:      gin.Params{{Key: "id", Value: "1"}},
+			statusExpected: http.StatusOK,
+		},
+
+		"failure due to invalid request: no id": {
+			wantError:      errors.New("invalid_request - the request has not a zone id to get"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to non existent zone": {
+			urlParams:      gin.Params{{Key: "id", Value: "2"}},
+			wantError:      errors.New("not_found_zone - not founded the zone to get"),
+			statusExpected: http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Params = tc.urlParams
+
+			handler.Get(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err := json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := zone.Zone{}
+
+				err := json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, "buenos aires", response.Name)
+				assert.Equal(t, zoneArea, response.Area)
+			}
+		})
+	}
+
+	t.Run("successful list zones", func(t *testing.T) {
+		w := httptest.NewRecorder()
+
+		c, _ := gin.CreateTestContext(w)
+
+		handler.List(c)
+
+		assert.Equal(t, http.StatusOK, w.Code)
+
+		var response struct {
+			Result []zone.Zone `json:"result"`
+		}
+		err := json.Unmarshal(w.Body.Bytes(), &response)
+		assert.Nil(t, err)
+
+		if assert.Len(t, response.Result, 1) {
+			assert.Equal(t, int64(1), response.Result[0].ID)
+		}
+	})
+}
+
+func Test_editAndDeleteZone(t *testing.T) {
+	db := newZoneMockDB(zone.Zone{ID: 1, Name: "buenos aires", Area: zoneArea})
+	handler := ZoneHandler{
+		Zones: zone.NewZoneStorage(db),
+	}
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	c.Request = &http.Request{
+		Header: make(http.Header),
+	}
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	err := mockJson(c, http.MethodPut, map[string]interface{}{"name": "caba", "area": zoneArea[1:]})
+	assert.Nil(t, err)
+
+	handler.Edit(c)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+	assert.Equal(t, "caba", db.zones[1].Name)
+	assert.Equal(t, zoneArea[1:], db.zones[1].Area)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	handler.Delete(c)
+	c.Writer.WriteHeaderNow()
+
+	assert.Equal(t, http.StatusNoContent, w.Code)
+	assert.Empty(t, db.zones)
+
+	w = httptest.NewRecorder()
+	c, _ = gin.CreateTestContext(w)
+	c.Params = gin.Params{{Key: "id", Value: "1"}}
+
+	handler.Delete(c)
+
+	assert.Equal(t, http.StatusNotFound, w.Code)
+}
+
+func Test_zoneDrivers(t *testing.T) {
+	db := newZoneMockDB(zone.Zone{ID: 1, Name: "buenos aires", Area: zoneArea})
+	handler := ZoneHandler{
+		Zones: zone.NewZoneStorage(db),
+	}
+
+	testscases := map[string]struct {
+		urlParams      gin.Params
+		body           map[string]interface{}
+		want           zone.ZoneDrivers
+		wantError      error
+		statusExpected int
+	}{
+		"successful add zone driver": {
+			urlParams:      gin.Params{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{"user_id": 2},
+			want:           zone.ZoneDrivers{ZoneID: 1, UserIDs: []int64{2}},
+			statusExpected: http.StatusCreated,
+		},
+
+		"failure due to invalid request: no user": {
+			urlParams:      gin.Params{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{},
+			wantError:      errors.New("invalid_request - there was an error with fields: user_id"),
+			statusExpected: http.StatusUnprocessableEntity,
+		},
+
+		"failure due to user not driver": {
+			urlParams:      gin.Params{{Key: "id", Value: "1"}},
+			body:           map[string]interface{}{"user_id": 10},
+			wantError:      errors.New("invalid_user - the user to register on the zone should be a driver"),
+			statusExpected: http.StatusBadRequest,
+		},
+
+		"failure due to non existent zone": {
+			urlParams:      gin.Params{{Key: "id", Value: "2"}},
+			body:           map[string]interface{}{"user_id": 2},
+			wantError:      errors.New("not_found_zone - not founded the zone to get"),
+			statusExpected: http.StatusNotFound,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			db.drivers = make(map[int64][]int64)
+
+			w := httptest.NewRecorder()
+
+			c, _ := gin.CreateTestContext(w)
+			c.Request = &http.Request{
+				Header: make(http.Header),
+			}
+			c.Params = tc.urlParams
+
+			err := mockJson(c, http.MethodPost, tc.body)
+			assert.Nil(t, err)
+
+			handler.AddDriver(c)
+
+			assert.Equal(t, tc.statusExpected, w.Code)
+
+			if tc.wantError != nil {
+				var apiErr apiError
+				err = json.Unmarshal(w.Body.Bytes(), &apiErr)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.wantError.Error(), apiErr.Error())
+			} else {
+				response := zone.ZoneDrivers{}
+
+				err = json.Unmarshal(w.Body.Bytes(), &response)
+				assert.Nil(t, err)
+
+				assert.Equal(t, tc.want, response)
+			}
+		})
+	}
+
+	t.Run("successful remove zone driver", func(t *testing.T) {
+		db.drivers = map[int64][]int64{1: {2}}
+
+		w := httptest.NewRecorder()
+		c, _ := gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: "1"}, {Key: "user_id", Value: "2"}}
+
+		handler.RemoveDriver(c)
+		c.Writer.WriteHeaderNow()
+
+		assert.Equal(t, http.StatusNoContent, w.Code)
+		assert.Empty(t, db.drivers[1])
+
+		w = httptest.NewRecorder()
+		c, _ = gin.CreateTestContext(w)
+		c.Params = gin.Params{{Key: "id", Value: "1"}, {Key: "user_id", Value: "2"}}
+
+		handler.RemoveDriver(c)
+
+		assert.Equal(t, http.StatusNotFound, w.Code)
+	})
+}
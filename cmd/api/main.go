@@ -1,31 +1,194 @@
 package main
 
 import (
+	"context"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/nicocarolo/space-drivers/cmd/api/handlers"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/authorization"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	appconfig "github.com/nicocarolo/space-drivers/internal/platform/config"
+	"github.com/nicocarolo/space-drivers/internal/platform/filestore"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/lock"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
 	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"github.com/nicocarolo/space-drivers/internal/platform/secrets"
+	"github.com/nicocarolo/space-drivers/internal/platform/tracing"
+	"github.com/nicocarolo/space-drivers/internal/simulation"
+	"github.com/nicocarolo/space-drivers/internal/team"
 	"github.com/nicocarolo/space-drivers/internal/travel"
 	"github.com/nicocarolo/space-drivers/internal/user"
+	"github.com/nicocarolo/space-drivers/internal/vehicle"
+	"github.com/nicocarolo/space-drivers/internal/zone"
+	"io"
 	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
 	"time"
 )
 
+// defaultRulesFile is the authorization rules file used when AUTHORIZATION_RULES_FILE is not configured
+const defaultRulesFile = "config/authorization_rules.json"
+
+// defaultMessagesFile is the file with the translated descriptions of the errors used when MESSAGES_FILE is not
+// configured
+const defaultMessagesFile = "config/messages.json"
+
+// defaultShutdownTimeout is the time the in-flight requests and background jobs have to finish on shutdown when
+// SHUTDOWN_TIMEOUT is not configured
+const defaultShutdownTimeout = 30 * time.Second
+
+// publicRoutes are the routes which do not authorize the requests, so they have no authorization rules
+var publicRoutes = []string{
+	"GET /ping",
+	"GET /.well-known/jwks.json",
+	"GET /metrics",
+	"POST /v1/invitations/:token/accept",
+	"POST /v1/login",
+	"POST /v1/login/2fa",
+	"POST /v1/token/refresh",
+	"GET /v1/track/:token",
+}
+
 // Config for api
 type Config struct {
-	userHandler   handlers.UserHandler
-	travelHandler handlers.TravelHandler
-	authHandler   handlers.AuthHandler
+	userHandler    handlers.UserHandler
+	travelHandler  handlers.TravelHandler
+	authHandler    handlers.AuthHandler
+	zoneHandler    handlers.ZoneHandler
+	vehicleHandler handlers.VehicleHandler
+	teamHandler    handlers.TeamHandler
 
+	authorizationHandler handlers.AuthorizationHandler
+	auditHandler         handlers.AuditHandler
+	logHandler           handlers.LogHandler
+
+	// rules are the authorization rules configured on start, ruler checks them and the ones managed at runtime
+	rules handlers.Rules
 	ruler handlers.Ruler
+
+	// messages translate the descriptions of the errors to the language of the requests
+	messages handlers.Messages
+
+	// events record the security events, like the accesses denied by ruler
+	events audit.EventStorage
+
+	travels travel.TravelStorage
+	users   user.UserStorage
+
+	// secrets keep the secrets got from the provider configured, and are refreshed by a worker
+	secrets *secrets.Cache
+
+	// collector keeps the metrics of the requests and the workers, the prometheus one exposes them on /metrics
+	collector metrics.Collector
+
+	// spans export the spans of the traces to an OpenTelemetry collector, it is nil when it is not configured
+	spans *tracing.OTLPExporter
+
+	// databases are the connections of the repositories by name, their stats are reported by a worker and they are
+	// closed once the api is shut down
+	databases map[string]database
+}
+
+// database is the pool of db connections of a repository
+type database interface {
+	io.Closer
+	metrics.DBStatser
 }
 
 func main() {
-	setApi(getConfig())
+	config := getConfig()
+	seedAdmin(config)
+
+	// the background jobs are stopped once the in-flight requests finished, so they can still use them
+	workersCtx, stopWorkers := context.WithCancel(context.Background())
+	workers := startWorkers(workersCtx, config)
+	runApi(shutdownContext(), setApi(config))
+
+	stopWorkers()
+	shutdown(config, workers)
+}
+
+// shutdownContext return a context cancelled when the api receives SIGTERM or SIGINT
+func shutdownContext() context.Context {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGTERM, os.Interrupt)
+	go func() {
+		sig := <-signals
+		log.Info(ctx, "shutting down the api", log.String("signal", sig.String()))
+		cancel()
+	}()
+
+	return ctx
+}
+
+// shutdown wait the background jobs to stop, up to SHUTDOWN_TIMEOUT, and close the db connections
+func shutdown(config Config, workers *sync.WaitGroup) {
+	ctx := context.Background()
+
+	stopped := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(stopped)
+	}()
+
+	select {
+	case <-stopped:
+	case <-time.After(appconfig.Duration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)):
+		log.Error(ctx, "the background jobs did not stop before the shutdown timeout")
+	}
+
+	for name, db := range config.databases {
+		if err := db.Close(); err != nil {
+			log.Error(ctx, "there was an error closing a db connection", log.String("repository", name), log.Err(err))
+		}
+	}
 }
 
 // getConfig return api configuration with handlers
 func getConfig() Config {
+	if err := log.SetLevel(appconfig.String("LOG_LEVEL", log.DefaultLevel)); err != nil {
+		panic(fmt.Errorf("cannot set LOG_LEVEL: %w", err))
+	}
+	log.SetSampling(int(appconfig.Int("LOG_SAMPLING_INITIAL", log.DefaultSamplingInitial)),
+		int(appconfig.Int("LOG_SAMPLING_THEREAFTER", log.DefaultSamplingThereafter)))
+	log.SetLimitInterval(appconfig.Duration("LOG_LIMIT_INTERVAL", log.DefaultLimitInterval))
+	if path := appconfig.String("LOG_FILE", ""); path != "" {
+		err := log.SetFile(path, appconfig.Int("LOG_FILE_MAX_SIZE_MB", log.DefaultFileMaxSize/(1024*1024))*1024*1024,
+			appconfig.Duration("LOG_FILE_MAX_AGE", log.DefaultFileMaxAge),
+			int(appconfig.Int("LOG_FILE_MAX_BACKUPS", log.DefaultFileMaxBackups)))
+		if err != nil {
+			panic(fmt.Errorf("cannot set LOG_FILE: %w", err))
+		}
+	}
+	if path := appconfig.String("AUDIT_LOG_FILE", ""); path != "" {
+		err := auditlog.SetFile(path, 0, appconfig.Duration("AUDIT_LOG_FILE_MAX_AGE", auditlog.DefaultFileMaxAge),
+			int(appconfig.Int("AUDIT_LOG_FILE_MAX_BACKUPS", auditlog.DefaultFileMaxBackups)))
+		if err != nil {
+			panic(fmt.Errorf("cannot set AUDIT_LOG_FILE: %w", err))
+		}
+	}
+
+	secretCache := secrets.NewCache(secretProvider())
+	appconfig.SetSecretProvider(secretCache)
+
+	spans := spanExporter()
+	if spans != nil {
+		tracing.DefaultExporter = spans
+		tracing.SampleRatio = appconfig.Float("TRACING_SAMPLE_RATIO", tracing.SampleRatio)
+	}
+
+	if err := jwt.CheckKeys(); err != nil {
+		panic(fmt.Errorf("cannot load jwt keys: %w", err))
+	}
+
 	userStorage, err := user.NewRepository()
 	if err != nil {
 		panic(err)
@@ -36,84 +199,529 @@ func getConfig() Config {
 		panic(err)
 	}
 
+	zoneStorage, err := zone.NewRepository()
+	if err != nil {
+		panic(err)
+	}
+	zones := zone.NewZoneStorage(zoneStorage)
+
+	vehicleStorage, err := vehicle.NewRepository()
+	if err != nil {
+		panic(err)
+	}
+	vehicles := vehicle.NewVehicleStorage(vehicleStorage)
+
+	teamStorage, err := team.NewRepository()
+	if err != nil {
+		panic(err)
+	}
+	teams := team.NewTeamStorage(teamStorage)
+
+	auditStorage, err := audit.NewRepository()
+	if err != nil {
+		panic(err)
+	}
+	events := audit.NewEventStorage(auditStorage)
+
+	travels := travel.NewTravelStorage(travelStorage, travel.WithPricing(travel.Pricing{
+		BaseFare:        appconfig.Float("PRICING_BASE_FARE", travel.DefaultPricing.BaseFare),
+		PerKm:           appconfig.Float("PRICING_PER_KM", travel.DefaultPricing.PerKm),
+		AverageSpeedKmh: appconfig.Float("PRICING_AVERAGE_SPEED_KMH", travel.DefaultPricing.AverageSpeedKmh),
+	}), travel.WithOfferTimeout(appconfig.Duration("TRAVELS_OFFER_TIMEOUT", travel.DefaultOfferTimeout)),
+		travel.WithAttachmentStore(attachmentStore()),
+		travel.WithQueueSize(int(appconfig.Int("TRAVELS_QUEUE_SIZE", travel.DefaultQueueSize))),
+		travel.WithZoneChecker(zones, travel.ZonePolicy(appconfig.String("TRAVELS_ZONE_POLICY", string(travel.ZonePolicyFlag)))),
+		travel.WithVehicleFinder(vehicles),
+		travel.WithTeamFinder(teams),
+		travel.WithTracking(appconfig.String("TRACKING_LINK_URL", ""),
+			appconfig.Duration("TRACKING_TTL", travel.DefaultTrackingTTL)),
+		travel.WithLock(distributedLock(travelStorage)),
+		// the travels and the users are dated with the clock the tokens are generated and validated with
+		travel.WithClock(jwt.Clock))
+
+	userOptions := []user.UserStorageOption{
+		// the cache is shared, so the users changed by any storage are invalidated for all of them
+		user.WithCache(user.NewCache(int(appconfig.Int("USERS_CACHE_SIZE", 0)),
+			appconfig.Duration("USERS_CACHE_TTL", time.Minute))),
+		user.WithTwoFactor(appconfig.String("TWO_FACTOR_ISSUER", user.DefaultTwoFactorIssuer),
+			appconfig.List("TWO_FACTOR_ROLES")...),
+		user.WithDriverAvailability(appconfig.List("DRIVERS_ROLES"), appconfig.List("DRIVERS_BUSY_STATUSES")),
+		user.WithInvitations(appconfig.String("INVITATIONS_LINK_URL", ""),
+			appconfig.Duration("INVITATIONS_TTL", user.DefaultInvitationTTL)),
+		user.WithBcryptCost(int(appconfig.Int("PASSWORD_BCRYPT_COST", int64(user.DefaultBcryptCost)))),
+		user.WithRefreshTokenTTL(appconfig.Duration("REFRESH_TOKEN_TTL", user.DefaultRefreshTokenTTL)),
+		user.WithImpersonationTTL(appconfig.Duration("IMPERSONATION_TTL", user.DefaultImpersonationTTL)),
+		user.WithRenewalWindow(appconfig.Duration("TOKEN_RENEWAL_WINDOW", user.DefaultRenewalWindow)),
+		user.WithSecurityAuditor(events),
+		user.WithClock(jwt.Clock),
+		// the throttle is shared, so the failed logins on any storage are counted together
+		user.WithLoginThrottle(user.NewLoginThrottle(user.LoginThrottleConfig{
+			MaxFailures:   int(appconfig.Int("LOGIN_MAX_FAILURES", int64(user.DefaultLoginThrottle.MaxFailures))),
+			Backoff:       appconfig.Duration("LOGIN_BACKOFF", user.DefaultLoginThrottle.Backoff),
+			MaxBackoff:    appconfig.Duration("LOGIN_MAX_BACKOFF", user.DefaultLoginThrottle.MaxBackoff),
+			IPMaxFailures: int(appconfig.Int("LOGIN_IP_MAX_FAILURES", int64(user.DefaultLoginThrottle.IPMaxFailures))),
+			IPBan:         appconfig.Duration("LOGIN_IP_BAN", user.DefaultLoginThrottle.IPBan),
+			Window:        appconfig.Duration("LOGIN_FAILURES_WINDOW", user.DefaultLoginThrottle.Window),
+		})),
+	}
+
 	userHandler := handlers.UserHandler{
-		Users: user.NewUserStorage(userStorage),
+		Users:   user.NewUserStorage(userStorage, append(userOptions, user.WithVehicleFinder(vehicles))...),
+		Travels: travels,
 	}
 
 	travelHandler := handlers.TravelHandler{
-		Users:   user.NewUserStorage(userStorage),
-		Travels: travel.NewTravelStorage(travelStorage),
+		Users:   user.NewUserStorage(userStorage, userOptions...),
+		Travels: travels,
+	}
+
+	zoneHandler := handlers.ZoneHandler{
+		Zones: zones,
+	}
+
+	vehicleHandler := handlers.VehicleHandler{
+		Vehicles: vehicles,
+	}
+
+	teamHandler := handlers.TeamHandler{
+		Teams: teams,
 	}
 
 	authHandler := handlers.AuthHandler{
-		Users: user.NewUserStorage(userStorage),
+		Users: user.NewUserStorage(userStorage, userOptions...),
+	}
+
+	rules, err := handlers.LoadRules(appconfig.String("AUTHORIZATION_RULES_FILE", defaultRulesFile))
+	if err != nil {
+		panic(fmt.Errorf("cannot load authorization rules: %w", err))
 	}
 
-	rules := handlers.NewRoleControl()
+	messages, err := handlers.LoadMessages(appconfig.String("MESSAGES_FILE", defaultMessagesFile))
+	if err != nil {
+		panic(fmt.Errorf("cannot load messages: %w", err))
+	}
+
+	authorizationStorage, err := authorization.NewRepository()
+	if err != nil {
+		panic(err)
+	}
+	storedRules := authorization.NewRuleStorage(authorizationStorage,
+		authorization.WithCacheTTL(appconfig.Duration("AUTHORIZATION_RULES_CACHE_TTL", authorization.DefaultCacheTTL)))
 
 	return Config{
-		userHandler:   userHandler,
-		travelHandler: travelHandler,
-		authHandler:   authHandler,
-		ruler:         rules,
+		userHandler:    userHandler,
+		travelHandler:  travelHandler,
+		authHandler:    authHandler,
+		zoneHandler:    zoneHandler,
+		vehicleHandler: vehicleHandler,
+		teamHandler:    teamHandler,
+		authorizationHandler: handlers.AuthorizationHandler{
+			Rules: storedRules,
+		},
+		auditHandler: handlers.AuditHandler{
+			Events: events,
+		},
+		rules:     rules,
+		ruler:     handlers.StoredRules{Rules: rules, Stored: storedRules},
+		messages:  messages,
+		events:    events,
+		travels:   travels,
+		users:     user.NewUserStorage(userStorage, userOptions...),
+		secrets:   secretCache,
+		collector: metricsCollector(),
+		spans:     spans,
+		databases: map[string]database{
+			"user":          userStorage,
+			"travel":        travelStorage,
+			"zone":          zoneStorage,
+			"vehicle":       vehicleStorage,
+			"team":          teamStorage,
+			"audit":         auditStorage,
+			"authorization": authorizationStorage,
+		},
 	}
 }
 
-// setApi configure api on gin router and run
-func setApi(config Config) {
-	router := gin.Default()
+// attachmentStore return the store configured to save travel attachments, on the local disk by default or on a s3
+// bucket
+func attachmentStore() filestore.Store {
+	if appconfig.String("ATTACHMENTS_STORE", "local") == "s3" {
+		return filestore.NewS3Store(appconfig.String("ATTACHMENTS_S3_BUCKET", ""),
+			appconfig.String("ATTACHMENTS_S3_REGION", "us-east-1"),
+			appconfig.String("AWS_ACCESS_KEY_ID", ""),
+			appconfig.Secret("AWS_SECRET_ACCESS_KEY", ""))
+	}
 
-	router.Use(gin.CustomRecovery(panicRecover))
+	return filestore.NewLocalStore(appconfig.String("ATTACHMENTS_DIR", "attachments"))
+}
+
+// distributedLock return the lock shared by the instances of the api configured on LOCK_BACKEND: redis, mysql (the
+// named locks of the travels db), local (of this instance only) or none (default, every instance runs the jobs)
+func distributedLock(travelStorage travel.SqlRepository) lock.Lock {
+	switch appconfig.String("LOCK_BACKEND", "none") {
+	case "redis":
+		return lock.NewRedis(appconfig.String("REDIS_ADDR", "redis:6379"), appconfig.Secret("REDIS_PASSWORD", ""),
+			appconfig.Int("REDIS_DB", 0))
+	case "mysql":
+		return travelStorage.Lock()
+	case "local":
+		return lock.NewLocal()
+	}
+
+	return nil
+}
+
+// secretProvider return the provider of the secrets configured on SECRETS_PROVIDER: env (default), file, vault or aws
+func secretProvider() secrets.SecretProvider {
+	switch appconfig.String("SECRETS_PROVIDER", "env") {
+	case "file":
+		return secrets.NewFileProvider(appconfig.String("SECRETS_DIR", "/run/secrets"))
+	case "vault":
+		return secrets.NewVaultProvider(appconfig.String("VAULT_ADDR", ""), appconfig.String("VAULT_TOKEN", ""),
+			appconfig.String("SECRETS_VAULT_PATH", "secret/data/space-drivers"))
+	case "aws":
+		return secrets.NewAWSProvider(appconfig.String("SECRETS_AWS_SECRET_ID", "space-drivers"),
+			appconfig.String("SECRETS_AWS_REGION", "us-east-1"),
+			appconfig.String("AWS_ACCESS_KEY_ID", ""),
+			appconfig.String("AWS_SECRET_ACCESS_KEY", ""),
+			appconfig.String("AWS_SESSION_TOKEN", ""))
+	}
+
+	return secrets.EnvProvider{}
+}
+
+// metricsCollector return the collector of the metrics configured on METRICS_COLLECTOR: prometheus (default) or none.
+// The latency of the endpoints is observed with metrics.LatencyBuckets, and any histogram with the buckets configured
+// for its metric on METRICS_BUCKETS
+func metricsCollector() metrics.Collector {
+	switch appconfig.String("METRICS_COLLECTOR", "prometheus") {
+	case "none":
+		return metrics.NewNoop()
+	}
+
+	buckets, err := metrics.ParseBuckets(appconfig.List("METRICS_BUCKETS"))
+	if err != nil {
+		panic(fmt.Errorf("cannot set METRICS_BUCKETS: %w", err))
+	}
+
+	prometheus := metrics.NewPrometheus()
+	prometheus.SetBuckets(latencyEndpointMetric, metrics.LatencyBuckets...)
+	for name, bounds := range buckets {
+		prometheus.SetBuckets(name, bounds...)
+	}
+
+	return prometheus
+}
+
+// spanExporter return the exporter of the spans to the OpenTelemetry collector on OTEL_EXPORTER_OTLP_ENDPOINT (or the
+// traces endpoint on OTEL_EXPORTER_OTLP_TRACES_ENDPOINT), nil when none is configured
+func spanExporter() *tracing.OTLPExporter {
+	endpoint := appconfig.String("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT", "")
+	if endpoint == "" {
+		base := appconfig.String("OTEL_EXPORTER_OTLP_ENDPOINT", "")
+		if base == "" {
+			return nil
+		}
+		endpoint = strings.TrimSuffix(base, "/") + "/v1/traces"
+	}
+
+	// headers are key=value pairs, as the api key of the collector
+	headers := make(map[string]string)
+	for _, header := range appconfig.SecretList("OTEL_EXPORTER_OTLP_HEADERS") {
+		pair := strings.SplitN(header, "=", 2)
+		if len(pair) == 2 {
+			headers[strings.TrimSpace(pair[0])] = strings.TrimSpace(pair[1])
+		}
+	}
+
+	return tracing.NewOTLPExporter(endpoint, appconfig.String("OTEL_SERVICE_NAME", "space-drivers"), headers)
+}
+
+// seedAdmin create the first admin with ADMIN_EMAIL and ADMIN_PASSWORD settings when there are no users, so a new
+// deployment can login to create the other users
+func seedAdmin(config Config) {
+	email := appconfig.String("ADMIN_EMAIL", "")
+	if email == "" {
+		return
+	}
+
+	if _, err := config.users.SeedAdmin(context.Background(), email, appconfig.Secret("ADMIN_PASSWORD", "")); err != nil {
+		panic(fmt.Errorf("cannot seed admin: %w", err))
+	}
+}
+
+// startWorkers run the api background jobs until ctx is done, the wait group returned waits them to stop
+func startWorkers(ctx context.Context, config Config) *sync.WaitGroup {
+	ctx = metrics.WithCollector(ctx, config.collector)
+
+	var workers sync.WaitGroup
+	run := func(job func()) {
+		workers.Add(1)
+		go func() {
+			defer workers.Done()
+			job()
+		}()
+	}
+
+	pools := make(map[string]metrics.DBStatser, len(config.databases))
+	for name, db := range config.databases {
+		pools[name] = db
+	}
+	runtimeInterval := appconfig.Duration("RUNTIME_METRICS_INTERVAL", 15*time.Second)
+	run(func() { metrics.ReportRuntimeEvery(ctx, runtimeInterval, pools) })
+
+	secretsInterval := appconfig.Duration("SECRETS_REFRESH_INTERVAL", 5*time.Minute)
+	run(func() { config.secrets.RefreshEvery(ctx, secretsInterval) })
+	if config.spans != nil {
+		exportInterval := appconfig.Duration("TRACING_EXPORT_INTERVAL", 5*time.Second)
+		run(func() { config.spans.ExportEvery(ctx, exportInterval) })
+	}
+
+	countInterval := appconfig.Duration("TRAVELS_COUNT_INTERVAL", time.Minute)
+	run(func() { config.travels.ReportStatusCount(ctx, countInterval) })
+
+	expireInterval := appconfig.Duration("TRAVELS_EXPIRE_INTERVAL", 10*time.Minute)
+	pendingMaxAge := appconfig.Duration("TRAVELS_PENDING_MAX_AGE", 24*time.Hour)
+	run(func() { config.travels.ExpirePendingEvery(ctx, expireInterval, pendingMaxAge) })
+
+	offerInterval := appconfig.Duration("TRAVELS_OFFER_CHECK_INTERVAL", time.Minute)
+	run(func() { config.travels.ExpireOffersEvery(ctx, offerInterval) })
+
+	overdueInterval := appconfig.Duration("TRAVELS_OVERDUE_INTERVAL", time.Minute)
+	run(func() { config.travels.CheckOverdueEvery(ctx, overdueInterval) })
+
+	archiveInterval := appconfig.Duration("TRAVELS_ARCHIVE_INTERVAL", time.Hour)
+	archiveRetention := appconfig.Duration("TRAVELS_ARCHIVE_RETENTION", 30*24*time.Hour)
+	run(func() { config.travels.ArchiveEvery(ctx, archiveInterval, archiveRetention) })
+
+	// synthetic drivers take and complete the travels on staging environments and demos
+	if appconfig.Bool("SIMULATION", false) {
+		simulator := simulation.NewSimulator(config.travels, config.users,
+			simulation.WithDrivers(int(appconfig.Int("SIMULATION_DRIVERS", simulation.DefaultDrivers))),
+			simulation.WithTravelDuration(appconfig.Duration("SIMULATION_TRAVEL_DURATION", simulation.DefaultTravelDuration)))
+		stepInterval := appconfig.Duration("SIMULATION_STEP_INTERVAL", 10*time.Second)
+		run(func() { simulator.RunEvery(ctx, stepInterval) })
+	}
+
+	return &workers
+}
+
+// setApi configure api on gin router
+func setApi(config Config) http.Handler {
+	// gin.Default plaintext access log is replaced by the structured one of AccessLog
+	router := gin.New()
+	// the client ip (used to throttle the logins and on the security events) is only taken from the X-Forwarded-For
+	// header when the request comes from a trusted proxy, none by default
+	if err := router.SetTrustedProxies(appconfig.List("TRUSTED_PROXIES")); err != nil {
+		panic(fmt.Errorf("cannot set trusted proxies: %w", err))
+	}
+
+	router.Use(handlers.Recovery())
+	router.Use(handlers.RequestID())
+	router.Use(handlers.Localize(config.messages))
+	router.Use(handlers.ContextLogger())
+	router.Use(handlers.AccessLog())
+	// the bodies are only logged for the routes configured, to troubleshoot the integrations of the clients
+	if routes := appconfig.List("DEBUG_BODY_LOG_ROUTES"); len(routes) > 0 {
+		router.Use(handlers.BodyLog(routes...))
+	}
+	router.Use(traceRequest())
+	router.Use(collect(config.collector))
 	router.Use(trace())
+	router.Use(handlers.RequestClient())
 
 	router.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{
 			"message": "pong",
 		})
 	})
+	router.GET("/.well-known/jwks.json", config.authHandler.JWKS)
+	if prometheus, ok := config.collector.(*metrics.Prometheus); ok {
+		router.GET("/metrics", gin.WrapH(prometheus.Handler()))
+	}
+
+	// the rules added at runtime are checked against every route, registered below
+	config.authorizationHandler.Routes = router.Routes
+
+	router.PUT("/admin/log-level", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.logHandler.UpdateLevel)
+
 	v1 := router.Group("/v1")
 
-	v1.GET("/users/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler), config.userHandler.Get)
-	v1.POST("/users", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler), config.userHandler.Create)
-	v1.GET("/users/drivers", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler), config.userHandler.GetDrivers)
+	v1.GET("/users", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.userHandler.List)
+	v1.GET("/users/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveUserUUID(config.users), config.userHandler.Get)
+	v1.POST("/users", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.userHandler.Create)
+	v1.PUT("/users/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveUserUUID(config.users), config.userHandler.Edit)
+	v1.DELETE("/users/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveUserUUID(config.users), config.userHandler.Delete)
+	v1.POST("/users/:id/password", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveUserUUID(config.users), config.userHandler.ChangePassword)
+	v1.PUT("/users/:id/status", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveUserUUID(config.users), config.userHandler.ChangeStatus)
+	v1.GET("/users/:id/travels", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveUserUUID(config.users), config.travelHandler.GetByUser)
+	v1.GET("/users/:id/queue", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveUserUUID(config.users), config.travelHandler.GetQueue)
+	v1.GET("/users/:id/earnings", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveUserUUID(config.users), config.travelHandler.Earnings)
+	v1.GET("/users/:id/export", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveUserUUID(config.users), config.userHandler.ExportPersonalData)
+	v1.DELETE("/users/:id/personal-data", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveUserUUID(config.users), config.userHandler.ErasePersonalData)
+	v1.POST("/users/:id/impersonate", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveUserUUID(config.users), config.userHandler.Impersonate)
+	v1.GET("/users/drivers", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.userHandler.GetDrivers)
+
+	v1.POST("/invitations", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.userHandler.Invite)
+	v1.POST("/invitations/:token/accept", config.userHandler.AcceptInvitation)
+
+	v1.GET("/travels", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.travelHandler.List)
+	v1.GET("/travels/export", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.travelHandler.Export)
+	v1.GET("/travels/stats", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.travelHandler.Stats)
+	v1.GET("/travels/heatmap", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.travelHandler.Heatmap)
+	v1.GET("/travels/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Get)
+	v1.PUT("/travels/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Edit)
+	v1.PUT("/travels/batch/status", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.travelHandler.BatchStatus)
+	v1.POST("/travels", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.travelHandler.Create)
+	v1.POST("/travels/quote", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.travelHandler.Quote)
+	v1.POST("/travels/:id/rating", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Rate)
+	v1.POST("/travels/:id/attachments", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Attach)
+	v1.POST("/travels/:id/locations", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.ReportLocation)
+	v1.GET("/travels/:id/locations", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Trace)
+	v1.POST("/travels/:id/tracking", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.ShareTracking)
+	v1.POST("/travels/:id/reassign", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Reassign)
+	v1.POST("/travels/:id/offer", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Offer)
+	v1.POST("/travels/:id/queue", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Enqueue)
+	v1.DELETE("/travels/:id/queue", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Dequeue)
+	v1.POST("/travels/:id/accept", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Accept)
+	v1.POST("/travels/:id/reject", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Reject)
+	v1.DELETE("/travels/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Delete)
+	v1.POST("/travels/:id/restore", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), handlers.ResolveTravelUUID(config.travels), config.travelHandler.Restore)
+
+	v1.GET("/drivers/me/travel", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.travelHandler.GetCurrent)
+	v1.GET("/me", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.userHandler.Me)
+	v1.GET("/me/preferences", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.userHandler.GetPreferences)
+	v1.PATCH("/me/preferences", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.userHandler.UpdatePreferences)
+	v1.GET("/me/sessions", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.userHandler.ListSessions)
+	v1.DELETE("/me/sessions/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.userHandler.RevokeSession)
+	v1.POST("/me/2fa", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.userHandler.EnrollTwoFactor)
+	v1.POST("/me/2fa/verify", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.userHandler.ConfirmTwoFactor)
 
-	v1.GET("/travels/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler), config.travelHandler.Get)
-	v1.PUT("/travels/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler), config.travelHandler.Edit)
-	v1.POST("/travels", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler), config.travelHandler.Create)
+	v1.GET("/zones", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.zoneHandler.List)
+	v1.POST("/zones", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.zoneHandler.Create)
+	v1.GET("/zones/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.zoneHandler.Get)
+	v1.PUT("/zones/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.zoneHandler.Edit)
+	v1.DELETE("/zones/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.zoneHandler.Delete)
+	v1.GET("/zones/:id/drivers", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.zoneHandler.Drivers)
+	v1.POST("/zones/:id/drivers", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.zoneHandler.AddDriver)
+	v1.DELETE("/zones/:id/drivers/:user_id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.zoneHandler.RemoveDriver)
+
+	v1.GET("/vehicles", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.vehicleHandler.List)
+	v1.POST("/vehicles", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.vehicleHandler.Create)
+	v1.GET("/vehicles/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.vehicleHandler.Get)
+	v1.PUT("/vehicles/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.vehicleHandler.Edit)
+	v1.DELETE("/vehicles/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.vehicleHandler.Delete)
+	v1.PUT("/vehicles/:id/driver", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.vehicleHandler.AssignDriver)
+	v1.DELETE("/vehicles/:id/driver", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.vehicleHandler.UnassignDriver)
+
+	v1.GET("/teams", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.teamHandler.List)
+	v1.POST("/teams", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.teamHandler.Create)
+	v1.GET("/teams/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.teamHandler.Get)
+	v1.PUT("/teams/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.teamHandler.Edit)
+	v1.DELETE("/teams/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.teamHandler.Delete)
+	v1.GET("/teams/:id/members", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.teamHandler.Members)
+	v1.POST("/teams/:id/members", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.teamHandler.AddMember)
+	v1.DELETE("/teams/:id/members/:user_id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.teamHandler.RemoveMember)
+
+	v1.GET("/authorization/rules", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.authorizationHandler.ListRules)
+	v1.POST("/authorization/rules", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.authorizationHandler.CreateRule)
+	v1.DELETE("/authorization/rules/:id", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.authorizationHandler.DeleteRule)
+
+	v1.GET("/audit/events", handlers.AuthenticateRequest(), handlers.AuthorizeRequest(config.ruler, config.events), handlers.RenewToken(config.users), config.auditHandler.List)
 
 	v1.POST("/login", config.authHandler.Login)
+	v1.POST("/login/2fa", config.authHandler.LoginTwoFactor)
+	v1.POST("/token/refresh", config.authHandler.Refresh)
+	v1.GET("/track/:token", config.travelHandler.Track)
 
-	err := router.Run(":8080")
-	if err != nil {
-		panic("cannot run router")
+	if err := config.rules.Validate(router.Routes(), publicRoutes...); err != nil {
+		panic(fmt.Errorf("the authorization rules do not match the routes: %w", err))
 	}
+
+	return router
 }
 
-// panicRecover
-func panicRecover(c *gin.Context, err interface{}) {
-	c.AbortWithStatusJSON(http.StatusInternalServerError, gin.H{
-		"code":   "unexpected_error",
-		"detail": err,
-	})
+// runApi serve the api until ctx is done, then it stops accepting connections and waits the in-flight requests up to
+// SHUTDOWN_TIMEOUT
+func runApi(ctx context.Context, router http.Handler) {
+	server := &http.Server{Addr: ":8080", Handler: router}
+
+	failed := make(chan error, 1)
+	go func() {
+		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			failed <- err
+		}
+	}()
+
+	select {
+	case err := <-failed:
+		panic(fmt.Errorf("cannot run router: %w", err))
+	case <-ctx.Done():
+	}
+
+	shutdownCtx, cancel := context.WithTimeout(context.Background(),
+		appconfig.Duration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout))
+	defer cancel()
+
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		log.Error(shutdownCtx, "there were requests in-flight when the shutdown timeout expired", log.Err(err))
+	}
 }
 
-// trace metric for endpoint time elapsed and http status code count
+// traceRequest start the span of the request, continuing the trace of the caller when it sends a traceparent header, and
+// store it on context so the spans of the queries are its children
+func traceRequest() gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		parent := tracing.Extract(ctx, ctx.Request.Header)
+		_, span := tracing.Start(parent, tracing.KindServer, ctx.Request.Method+" "+ctx.FullPath(), []string{
+			"http.method", ctx.Request.Method,
+			"http.route", ctx.FullPath(),
+			"http.request_id", ctx.GetString(log.RequestIDKey),
+		})
+		ctx.Set(tracing.SpanKey, span)
+
+		ctx.Next()
+
+		status := ctx.Writer.Status()
+		span.SetAttributes("http.status_code", fmt.Sprintf("%d", status))
+		if status >= http.StatusInternalServerError {
+			span.Fail(http.StatusText(status))
+		}
+		span.End()
+	}
+}
+
+// collect store the collector on context, so the metrics traced while the request is handled are collected by it
+func collect(collector metrics.Collector) gin.HandlerFunc {
+	return func(ctx *gin.Context) {
+		ctx.Set(metrics.CollectorKey, collector)
+	}
+}
+
+const (
+	latencyEndpointMetric = "application.space.api.latency"
+	countEndpointMetric   = "application.space.api.count"
+
+	// timeEndpointMetric is the time of the endpoints before it was observed as latencyEndpointMetric, it is still
+	// emitted so the dashboards and alerts on it can be moved to the new one. Deprecated: remove it once they are moved
+	timeEndpointMetric = "application.space.api.time"
+)
+
+// trace metric for endpoint latency histogram and http status code count
 func trace() gin.HandlerFunc {
 	return func(ctx *gin.Context) {
-		const (
-			timeEndpointMetric  = "application.space.api.time"
-			countEndpointMetric = "application.space.api.count"
-		)
 		start := time.Now()
 
 		ctx.Next()
 
-		// track time
+		// track latency
 		elapsed := time.Since(start)
-		metrics.Timing(ctx, timeEndpointMetric, elapsed, []string{
+		tags := []string{
 			"endpoint", ctx.FullPath(),
 			"http_status_code", fmt.Sprintf("%d", ctx.Writer.Status()),
-		})
+		}
+		metrics.Latency(ctx, latencyEndpointMetric, elapsed, tags)
+		metrics.Timing(ctx, timeEndpointMetric, elapsed, tags)
 
 		// track occurrences
 		metrics.Inc(ctx, countEndpointMetric, []string{
@@ -1,33 +1,129 @@
 use space_drivers;
 
+-- locations are stored as points where x is the longitude and y the latitude
 create table travels
 (
-    id      int auto_increment,
-    user_id int         null,
-    `from`  varchar(50) not null,
-    `to`    varchar(50) not null,
-    status  varchar(15) not null,
+    id         int auto_increment,
+    -- public id of the travel, exposed on the api instead of the auto increment id
+    uuid       char(36)    not null,
+    user_id    int         null,
+    `from`     point       not null,
+    `to`       point       not null,
+    status     varchar(15) not null,
+    created_at datetime    not null default CURRENT_TIMESTAMP,
+    deleted_at datetime    null,
+    -- optional date the travel should be ready by
+    deadline   datetime    null,
+    -- until when the driver can accept an offered travel
+    offer_expires_at datetime null,
+    -- the travel was created starting or ending outside the operating zones
+    outside_zones    tinyint(1) not null default 0,
+    -- position of a queued travel on the queue of its driver, starting at 1
+    queue_position   int        null,
+    -- when the travel was set in process and ready, with the estimated and actual minutes between both
+    started_at        datetime  null,
+    completed_at      datetime  null,
+    estimated_minutes int       null,
+    actual_minutes    double    null,
+    -- low, normal or high, pending travels are listed and taken by priority and then by age
+    priority          varchar(10) not null default 'normal',
+    -- optional altitude in meters of the locations, spatial points are two dimensional
+    from_altitude     double    null,
+    to_altitude       double    null,
     constraint travel_id_uindex
-        unique (id)
-);
+        unique (id),
+    constraint travels_uuid_uindex
+        unique (uuid)
+) engine = InnoDB;
 
 create index travels_status_index
     on travels (status);
 
+create index travels_created_at_index
+    on travels (created_at);
+
+create index travels_deleted_at_index
+    on travels (deleted_at);
+
+create index travels_deadline_index
+    on travels (deadline);
+
+create index travels_status_priority_index
+    on travels (status, priority, created_at);
+
+create spatial index travels_from_index
+    on travels (`from`);
+
 create index travels_user_id_index
     on travels (user_id);
 
+-- the earnings of a driver are the travels it completed on a range
+create index travels_user_id_completed_at_index
+    on travels (user_id, completed_at);
+
 alter table travels
     add primary key (id);
 
+-- ready and cancelled travels are moved here by the archive job to keep travels table small, tags, events and
+-- ratings keep referencing the travel id
+create table travels_archive
+(
+    id               int         not null,
+    uuid             char(36)    not null,
+    user_id          int         null,
+    `from`           point       not null,
+    `to`             point       not null,
+    status           varchar(15) not null,
+    created_at       datetime    not null,
+    deleted_at       datetime    null,
+    deadline         datetime    null,
+    offer_expires_at datetime    null,
+    outside_zones    tinyint(1)  not null default 0,
+    queue_position   int         null,
+    started_at        datetime   null,
+    completed_at      datetime   null,
+    estimated_minutes int        null,
+    actual_minutes    double     null,
+    priority          varchar(10) not null default 'normal',
+    from_altitude     double     null,
+    to_altitude       double     null,
+    archived_at      datetime    not null default CURRENT_TIMESTAMP,
+    constraint travels_archive_pk
+        primary key (id),
+    constraint travels_archive_uuid_uindex
+        unique (uuid)
+) engine = InnoDB;
+
+create index travels_archive_user_id_index
+    on travels_archive (user_id);
+
 create table users
 (
     id       int auto_increment,
+    -- public id of the user, exposed on the api instead of the auto increment id
+    uuid     char(36)     not null,
     email    varchar(50)  not null,
     password varchar(100) not null,
     role     varchar(10)  not null,
+    -- profile to contact the user, every field is optional
+    name           varchar(100) not null default '',
+    phone          varchar(30)  not null default '',
+    license_number varchar(30)  not null default '',
+    -- suspended users cannot login nor be assigned to travels
+    active         tinyint(1)   not null default 1,
+    status_reason  varchar(255) not null default '',
+    -- two factor authentication, enabled once the user verifies a code of the secret
+    totp_secret        varchar(64) not null default '',
+    two_factor_enabled tinyint(1)  not null default 0,
+    created_at     datetime     not null default CURRENT_TIMESTAMP,
+    -- the date of the last change of the user, including its password and deletion
+    updated_at     datetime     not null default CURRENT_TIMESTAMP,
+    -- deleted users are kept but cannot login nor be found
+    deleted_at datetime   null,
     constraint users_email_uindex
         unique (email),
+    constraint users_uuid_uindex
+        unique (uuid),
     constraint users_id_uindex
         unique (id)
 );
@@ -38,6 +134,250 @@ create index users_role_index
 alter table users
     add primary key (id);
 
+-- settings of each user by key (as notification settings, locale or units), shared between its devices
+create table user_preferences
+(
+    user_id    int          not null,
+    `key`      varchar(50)  not null,
+    value      varchar(255) not null,
+    updated_at datetime     not null default CURRENT_TIMESTAMP,
+    constraint user_preferences_pk
+        primary key (user_id, `key`)
+) engine = InnoDB;
+
+create table ratings
+(
+    id        int auto_increment,
+    travel_id int          not null,
+    user_id   int          not null,
+    score     tinyint      not null,
+    comment   varchar(255) null,
+    constraint ratings_id_uindex
+        unique (id),
+    constraint ratings_travel_id_uindex
+        unique (travel_id)
+);
+
+create index ratings_user_id_index
+    on ratings (user_id);
+
+alter table ratings
+    add primary key (id);
+
+-- free-form labels to group travels (by campaign, client, shift...)
+create table travel_tags
+(
+    travel_id int         not null,
+    tag       varchar(30) not null,
+    constraint travel_tags_pk
+        primary key (travel_id, tag)
+);
+
+create index travel_tags_tag_index
+    on travel_tags (tag);
+
+-- travel events record what happened to a travel outside its regular update flow (as expiration)
+create table travel_events
+(
+    id         int auto_increment,
+    travel_id  int          not null,
+    type       varchar(20)  not null,
+    detail     varchar(255) null,
+    created_at datetime     not null default CURRENT_TIMESTAMP,
+    constraint travel_events_id_uindex
+        unique (id)
+);
+
+create index travel_events_travel_id_index
+    on travel_events (travel_id);
+
+alter table travel_events
+    add primary key (id);
+
+
+-- proofs of delivery (photos or signatures) uploaded for travels, files are saved on the attachments store
+create table travel_attachments
+(
+    id           int auto_increment,
+    travel_id    int          not null,
+    user_id      int          not null,
+    kind         varchar(15)  not null,
+    content_type varchar(50)  not null,
+    size         int          not null,
+    storage_key  varchar(255) not null,
+    created_at   datetime     not null default CURRENT_TIMESTAMP,
+    constraint travel_attachments_id_uindex
+        unique (id)
+);
+
+create index travel_attachments_travel_id_index
+    on travel_attachments (travel_id);
+
+alter table travel_attachments
+    add primary key (id);
+
+
+-- locations reported by drivers while the travel is in process, to replay its route
+create table travel_locations
+(
+    id          int auto_increment,
+    travel_id   int      not null,
+    user_id     int      not null,
+    location    point    not null,
+    -- optional altitude in meters of the location
+    altitude    double   null,
+    recorded_at datetime not null,
+    constraint travel_locations_id_uindex
+        unique (id)
+);
+
+create index travel_locations_travel_id_index
+    on travel_locations (travel_id, recorded_at);
+
+-- the personal data of a driver includes the locations it reported
+create index travel_locations_user_id_index
+    on travel_locations (user_id);
+
+alter table travel_locations
+    add primary key (id);
+
+
+-- operating zones, the areas where travels can start and end (x is the longitude and y the latitude)
+create table zones
+(
+    id         int auto_increment,
+    name       varchar(50) not null,
+    area       polygon     not null,
+    created_at datetime    not null default CURRENT_TIMESTAMP,
+    constraint zones_id_uindex
+        unique (id)
+) engine = InnoDB;
+
+alter table zones
+    add primary key (id);
+
+-- drivers registered on each zone, only them can be assigned to the travels starting inside it
+create table zone_drivers
+(
+    zone_id int not null,
+    user_id int not null,
+    constraint zone_drivers_pk
+        primary key (zone_id, user_id)
+) engine = InnoDB;
+
+create index zone_drivers_user_id_index
+    on zone_drivers (user_id);
+
+-- vehicles of the fleet, each one can be assigned to a single driver
+create table vehicles
+(
+    id         int auto_increment primary key,
+    plate      varchar(15) not null,
+    capacity   int         not null,
+    class      varchar(10) not null,
+    user_id    int         null,
+    created_at datetime    not null,
+    constraint vehicles_plate_uindex
+        unique (plate),
+    constraint vehicles_user_id_uindex
+        unique (user_id)
+) engine = InnoDB;
+
+-- teams of drivers and dispatchers, the dispatchers of a team only see the travels of its drivers
+create table teams
+(
+    id         int auto_increment primary key,
+    name       varchar(50) not null,
+    created_at datetime    not null default CURRENT_TIMESTAMP
+) engine = InnoDB;
+
+create table team_members
+(
+    team_id int not null,
+    user_id int not null,
+    constraint team_members_pk
+        primary key (team_id, user_id)
+) engine = InnoDB;
+
+create index team_members_user_id_index
+    on team_members (user_id);
+
+-- sessions opened by the logins of the users, they last while their refresh tokens can be used, with the scope of
+-- their tokens (empty when they are not restricted)
+create table sessions
+(
+    id           int auto_increment primary key,
+    user_id      int          not null,
+    ip           varchar(45)  not null default '',
+    user_agent   varchar(255) not null default '',
+    scope        varchar(30)  not null default '',
+    created_at   datetime     not null,
+    last_used_at datetime     not null,
+    expires_at   datetime     not null,
+    revoked_at   datetime     null
+) engine = InnoDB;
+
+create index sessions_user_id_index
+    on sessions (user_id);
+
+-- refresh tokens of the sessions, only their hash is stored and each one is replaced by a new one on use
+create table refresh_tokens
+(
+    id         int auto_increment primary key,
+    user_id    int      not null,
+    session_id int      null,
+    token_hash char(64) not null,
+    expires_at datetime not null,
+    created_at datetime not null,
+    revoked_at datetime null,
+    constraint refresh_tokens_token_hash_uindex
+        unique (token_hash)
+) engine = InnoDB;
+
+create index refresh_tokens_user_id_index
+    on refresh_tokens (user_id);
+
+create index refresh_tokens_session_id_index
+    on refresh_tokens (session_id);
+
+-- authorization rules managed at runtime, added to the ones configured on start
+create table authorization_rules
+(
+    id         int auto_increment primary key,
+    method     varchar(10)  not null,
+    path       varchar(255) not null,
+    permission varchar(50)  not null,
+    created_at datetime     not null,
+    constraint authorization_rules_uindex
+        unique (method, path, permission)
+) engine = InnoDB;
+
+-- security events: logins, token refreshes and revocations and accesses denied, with the ip and user agent
+create table security_events
+(
+    id         int auto_increment primary key,
+    type       varchar(30)  not null,
+    user_id    int          null,
+    email      varchar(255) not null default '',
+    ip         varchar(45)  not null default '',
+    user_agent varchar(255) not null default '',
+    detail     varchar(255) not null default '',
+    created_at datetime     not null
+) engine = InnoDB;
+
+create index security_events_type_index
+    on security_events (type, created_at);
+
+create index security_events_user_id_index
+    on security_events (user_id, created_at);
+
+-- ids (jti) of the one-time tokens already used (invitations and two factor challenges), kept until they expire
+create table consumed_tokens
+(
+    jti         char(32) not null primary key,
+    expires_at  datetime not null,
+    consumed_at datetime not null
+) engine = InnoDB;
 
--- create a first admin with password hola1234 to be able to create more users
-INSERT INTO users (email, password, role) VALUES ('nico.carolo@hotmail.com', '$2a$10$0XNkz7egiyAPQbAEHvRtiOSIO/13.7ke0glVTZqkOC7gOl5BP6Ele', 'admin');
+create index consumed_tokens_expires_at_index
+    on consumed_tokens (expires_at);
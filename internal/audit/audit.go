@@ -0,0 +1,195 @@
+package audit
+
+import (
+	"context"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"time"
+)
+
+// types of the security events
+const (
+	EventLogin              = "login"
+	EventLoginFailed        = "login_failed"
+	EventTokenRefresh       = "token_refresh"
+	EventTokenRefreshFailed = "token_refresh_failed"
+	EventTokenRevoked       = "token_revoked"
+	EventAccessDenied       = "access_denied"
+	EventTokenReplay        = "token_replay"
+	EventImpersonation      = "impersonation"
+)
+
+// ClientKey is the context key of the Client who sent the request, the events recorded with that context are
+// filled with it
+const ClientKey = "audit_client"
+
+var (
+	ErrInvalidEventType = code_error.Error{Code: "invalid_search", Detail: "the event type should be login, login_failed, token_refresh, token_refresh_failed, token_revoked, access_denied, token_replay or impersonation"}
+	ErrInvalidDateRange = code_error.Error{Code: "invalid_search", Detail: "the from date should be before the to date"}
+	ErrStorageGet       = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to get security events"}
+)
+
+var eventTypes = map[string]bool{
+	EventLogin:              true,
+	EventLoginFailed:        true,
+	EventTokenRefresh:       true,
+	EventTokenRefreshFailed: true,
+	EventTokenRevoked:       true,
+	EventAccessDenied:       true,
+	EventTokenReplay:        true,
+	EventImpersonation:      true,
+}
+
+// Client is the ip and user agent who sent a request
+type Client struct {
+	IP        string
+	UserAgent string
+}
+
+// Event is a security event: a login, a token refresh or revocation, an access denied to a user, the replay of a
+// one-time token or an impersonation. UserID is the actor, it is empty when it is unknown (e.g. a login with an
+// unknown email)
+type Event struct {
+	ID        int64     `json:"id"`
+	Type      string    `json:"type"`
+	UserID    int64     `json:"user_id,omitempty"`
+	Email     string    `json:"email,omitempty"`
+	IP        string    `json:"ip"`
+	UserAgent string    `json:"user_agent"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type Search struct {
+	eventType string
+	userID    int64
+	from      time.Time
+	to        time.Time
+	offset    int64
+	limit     int64
+}
+
+type SearchOption func(s *Search)
+
+// WithType filter the events on the ones of the received type
+func WithType(eventType string) SearchOption {
+	return func(s *Search) {
+		s.eventType = eventType
+	}
+}
+
+// WithUserID filter the events on the ones of the user with the received id
+func WithUserID(userID int64) SearchOption {
+	return func(s *Search) {
+		s.userID = userID
+	}
+}
+
+// WithFrom filter the events on the ones recorded since the received date
+func WithFrom(from time.Time) SearchOption {
+	return func(s *Search) {
+		s.from = from
+	}
+}
+
+// WithTo filter the events on the ones recorded before the received date
+func WithTo(to time.Time) SearchOption {
+	return func(s *Search) {
+		s.to = to
+	}
+}
+
+func WithOffset(offset int64) SearchOption {
+	return func(s *Search) {
+		s.offset = offset
+	}
+}
+
+func WithLimit(limit int64) SearchOption {
+	return func(s *Search) {
+		s.limit = limit
+	}
+}
+
+type Metadata struct {
+	Total   int64
+	Pending int64
+}
+
+type EventStorage struct {
+	repository repository
+}
+
+// NewEventStorage will create and return an EventStorage with the received repository
+func NewEventStorage(repository repository) EventStorage {
+	return EventStorage{
+		repository: repository,
+	}
+}
+
+// Record will log the event on the audit log and store it on repository, filled with the Client on context. An event
+// which cannot be stored is only logged, so it does not fail the action audited
+func (eventStorage EventStorage) Record(ctx context.Context, event Event) {
+	if client, ok := ctx.Value(ClientKey).(Client); ok {
+		event.IP = client.IP
+		event.UserAgent = client.UserAgent
+	}
+	event.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	auditlog.Log(ctx, "security event",
+		log.String("type", event.Type),
+		log.Int64("user_id", event.UserID),
+		log.String("email", event.Email),
+		log.String("ip", event.IP),
+		log.String("user_agent", event.UserAgent),
+		log.String("detail", event.Detail))
+
+	if _, err := eventStorage.repository.SaveEvent(ctx, event); err != nil {
+		log.Error(ctx, "there was an error saving security event", log.String("type", event.Type), log.Err(err))
+	}
+}
+
+// Search the events by type, user and date with pagination, the most recent first
+func (eventStorage EventStorage) Search(ctx context.Context, opt ...SearchOption) ([]Event, Metadata, error) {
+	// default search options
+	search := Search{
+		offset: 0,
+		limit:  20,
+	}
+
+	// apply options
+	for _, option := range opt {
+		option(&search)
+	}
+
+	if search.eventType != "" && !eventTypes[search.eventType] {
+		log.Info(ctx, "invalid check on search events: invalid type", log.String("type", search.eventType))
+		return nil, Metadata{}, ErrInvalidEventType
+	}
+
+	if !search.from.IsZero() && !search.to.IsZero() && !search.from.Before(search.to) {
+		log.Info(ctx, "invalid check on search events: invalid date range")
+		return nil, Metadata{}, ErrInvalidDateRange
+	}
+
+	events, total, err := eventStorage.repository.GetEvents(ctx, search)
+	if err != nil {
+		log.Error(ctx, "there was an error getting events on search", log.Err(err))
+		return nil, Metadata{}, ErrStorageGet
+	}
+
+	metadata := Metadata{
+		Total:   total,
+		Pending: total - search.limit - search.offset,
+	}
+	if metadata.Pending < 0 {
+		metadata.Pending = 0
+	}
+
+	if events == nil {
+		events = []Event{}
+	}
+
+	return events, metadata, nil
+}
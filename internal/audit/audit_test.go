@@ -0,0 +1,110 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// mockDb a 'db' to use on EventStorage test with the capabilities to mock errors on save/get action
+type mockDb struct {
+	events []Event
+
+	saveError error
+	getError  error
+}
+
+func (db *mockDb) SaveEvent(ctx context.Context, event Event) (Event, error) {
+	if db.saveError != nil {
+		return Event{}, db.saveError
+	}
+
+	event.ID = int64(len(db.events) + 1)
+	db.events = append(db.events, event)
+
+	return event, nil
+}
+
+func (db *mockDb) GetEvents(ctx context.Context, search Search) ([]Event, int64, error) {
+	if db.getError != nil {
+		return nil, 0, db.getError
+	}
+
+	var found []Event
+	for i := len(db.events) - 1; i >= 0; i-- {
+		event := db.events[i]
+		if search.eventType != "" && event.Type != search.eventType {
+			continue
+		}
+		if search.userID != 0 && event.UserID != search.userID {
+			continue
+		}
+		found = append(found, event)
+	}
+
+	total := int64(len(found))
+	if search.offset >= total {
+		return nil, total, nil
+	}
+	end := search.offset + search.limit
+	if end > total {
+		end = total
+	}
+
+	return found[search.offset:end], total, nil
+}
+
+func Test_recordEvent(t *testing.T) {
+	db := &mockDb{}
+	storage := NewEventStorage(db)
+
+	ctx := context.WithValue(context.Background(), ClientKey, Client{IP: "10.0.0.1", UserAgent: "curl/7.68.0"})
+	storage.Record(ctx, Event{Type: EventLogin, UserID: 1, Email: "anEmail@asa.com"})
+
+	// an event without client on context
+	storage.Record(context.Background(), Event{Type: EventLoginFailed, Email: "other@asa.com"})
+
+	assert.Len(t, db.events, 2)
+	assert.Equal(t, "10.0.0.1", db.events[0].IP)
+	assert.Equal(t, "curl/7.68.0", db.events[0].UserAgent)
+	assert.False(t, db.events[0].CreatedAt.IsZero())
+	assert.Empty(t, db.events[1].IP)
+
+	// an event which cannot be stored is only logged
+	db.saveError = errors.New("mock error")
+	storage.Record(ctx, Event{Type: EventLogin, UserID: 1})
+	assert.Len(t, db.events, 2)
+}
+
+func Test_searchEvents(t *testing.T) {
+	db := &mockDb{}
+	storage := NewEventStorage(db)
+	for i := 0; i < 3; i++ {
+		storage.Record(context.Background(), Event{Type: EventLogin, UserID: 1})
+	}
+	storage.Record(context.Background(), Event{Type: EventAccessDenied, UserID: 2})
+
+	events, meta, err := storage.Search(context.Background(), WithType(EventLogin), WithLimit(2))
+	assert.Nil(t, err)
+	assert.Len(t, events, 2)
+	assert.Equal(t, Metadata{Total: 3, Pending: 1}, meta)
+	assert.Equal(t, int64(3), events[0].ID)
+
+	events, meta, err = storage.Search(context.Background(), WithUserID(2))
+	assert.Nil(t, err)
+	assert.Equal(t, EventAccessDenied, events[0].Type)
+	assert.Equal(t, Metadata{Total: 1}, meta)
+
+	_, _, err = storage.Search(context.Background(), WithType("logout"))
+	assert.Equal(t, ErrInvalidEventType.Error(), err.Error())
+
+	now := time.Now()
+	_, _, err = storage.Search(context.Background(), WithFrom(now), WithTo(now.Add(-time.Hour)))
+	assert.Equal(t, ErrInvalidDateRange.Error(), err.Error())
+
+	db.getError = errors.New("mock error")
+	_, _, err = storage.Search(context.Background())
+	assert.Equal(t, ErrStorageGet.Error(), err.Error())
+}
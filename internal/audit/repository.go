@@ -0,0 +1,166 @@
+package audit
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/platform/config"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	dbnameDefault = "space_drivers"
+
+	timeMetricName   = "application.space.repository.time"
+	entityMetricName = "security_event"
+)
+
+type repository interface {
+	SaveEvent(ctx context.Context, event Event) (Event, error)
+	GetEvents(ctx context.Context, search Search) ([]Event, int64, error)
+}
+
+// SqlRepository sql client wrapper for security event model
+type SqlRepository struct {
+	db *sql.DB
+}
+
+// NewRepository creates and return an SqlRepository
+func NewRepository() (SqlRepository, error) {
+	dbname := os.Getenv("DB_NAME")
+	dbuser := os.Getenv("DB_USER")
+	dbpass := config.Secret("DB_PASSWORD", "")
+	dbimage := os.Getenv("DB_IMAGE_NAME")
+	scope := os.Getenv("SCOPE")
+
+	if dbname == "" {
+		dbname = dbnameDefault
+	}
+	if dbuser == "" || dbpass == "" || dbimage == "" {
+		return SqlRepository{}, fmt.Errorf("cannot initialize audit repository: the following settings " +
+			"(DB_USER, DB_PASSWORD, DB_IMAGE_NAME) are invalid")
+	}
+
+	dataSourceConnection := fmt.Sprintf("%s:%s@/%s?parseTime=true", dbuser, dbpass, dbname)
+	if scope != "" {
+		dataSourceConnection = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?parseTime=true", dbuser, dbpass, dbimage, dbname)
+	}
+	db, err := sql.Open("mysql", dataSourceConnection)
+	if err != nil {
+		return SqlRepository{}, err
+	}
+
+	return SqlRepository{
+		db: db,
+	}, nil
+}
+
+// Close the connections to the db, once the repository is not used anymore
+func (sqlDb SqlRepository) Close() error {
+	return sqlDb.db.Close()
+}
+
+// Stats return the stats of the connections to the db, as the open and in use ones
+func (sqlDb SqlRepository) Stats() sql.DBStats {
+	return sqlDb.db.Stats()
+}
+
+// SaveEvent will store an Event on sql table, events without user are stored with a null user
+func (sqlDb SqlRepository) SaveEvent(ctx context.Context, event Event) (Event, error) {
+	var userID sql.NullInt64
+	if event.UserID != 0 {
+		userID = sql.NullInt64{Int64: event.UserID, Valid: true}
+	}
+
+	trackTime := trackElapsed(ctx, entityMetricName, "insert")
+	result, err := sqlDb.db.ExecContext(ctx, "INSERT INTO security_events(type, user_id, email, ip, user_agent, "+
+		"detail, created_at) VALUES(?, ?, ?, ?, ?, ?, ?)", event.Type, userID, event.Email, event.IP, event.UserAgent,
+		event.Detail, event.CreatedAt)
+	trackTime(err == nil)
+	if err != nil {
+		return Event{}, err
+	}
+
+	event.ID, err = result.LastInsertId()
+	if err != nil {
+		return Event{}, err
+	}
+
+	return event, nil
+}
+
+// GetEvents will get the events of the search from table, the most recent first, and the total of them without
+// pagination
+func (sqlDb SqlRepository) GetEvents(ctx context.Context, search Search) ([]Event, int64, error) {
+	condition := "1 = 1"
+	var args []interface{}
+	if search.eventType != "" {
+		condition += " AND type = ?"
+		args = append(args, search.eventType)
+	}
+	if search.userID != 0 {
+		condition += " AND user_id = ?"
+		args = append(args, search.userID)
+	}
+	if !search.from.IsZero() {
+		condition += " AND created_at >= ?"
+		args = append(args, search.from)
+	}
+	if !search.to.IsZero() {
+		condition += " AND created_at < ?"
+		args = append(args, search.to)
+	}
+
+	trackTime := trackElapsed(ctx, entityMetricName, "select_by_search")
+	rows, err := sqlDb.db.QueryContext(ctx, "SELECT id, type, user_id, email, ip, user_agent, detail, created_at "+
+		"FROM security_events WHERE "+condition+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, search.limit, search.offset)...)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var events []Event
+	for rows.Next() {
+		var event Event
+		var userID sql.NullInt64
+		err := rows.Scan(&event.ID, &event.Type, &userID, &event.Email, &event.IP, &event.UserAgent, &event.Detail,
+			&event.CreatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+		event.UserID = userID.Int64
+
+		events = append(events, event)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	var total int64
+	trackTime = trackElapsed(ctx, entityMetricName, "count_by_search")
+	err = sqlDb.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM security_events WHERE "+condition, args...).
+		Scan(&total)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return events, total, nil
+}
+
+func trackElapsed(ctx context.Context, entity, action string) func(success bool) {
+	start := time.Now()
+	return func(success bool) {
+		metrics.Timing(ctx, timeMetricName, time.Since(start),
+			[]string{
+				"result", strconv.FormatBool(success),
+				"action", action,
+				"entity", entity})
+	}
+}
@@ -0,0 +1,201 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/user"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultCacheTTL is how long the stored rules are cached when no other duration is configured
+const DefaultCacheTTL = time.Minute
+
+// AnyMethod is the method of the rules which match every method
+const AnyMethod = "*"
+
+var (
+	ErrInvalidRuleMethod     = code_error.Error{Code: "invalid_rule", Detail: "the rule method should be GET, POST, PUT, PATCH, DELETE or *"}
+	ErrInvalidRulePath       = code_error.Error{Code: "invalid_rule", Detail: "the rule path should start with /"}
+	ErrInvalidRulePermission = code_error.Error{Code: "invalid_rule", Detail: "the rule permission is unknown"}
+	ErrRuleAlreadyExists     = code_error.Error{Code: "rule_already_exists", Detail: "there is already a rule with the received method, path and permission"}
+	ErrNotFoundRule          = code_error.Error{Code: "not_found_rule", Detail: "not founded the rule to get"}
+	ErrStorageSave           = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to save rule"}
+	ErrStorageGet            = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to get rules"}
+	ErrStorageDelete         = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to delete rule"}
+)
+
+// methods are the http methods accepted on rules
+var methods = map[string]bool{
+	AnyMethod:         true,
+	http.MethodGet:    true,
+	http.MethodPost:   true,
+	http.MethodPut:    true,
+	http.MethodPatch:  true,
+	http.MethodDelete: true,
+}
+
+// Rule is an authorization rule managed at runtime: the permission accepted to access a path (as it is registered on
+// the router, e.g. /v1/users/:id) with a method. They are added to the rules configured on start
+type Rule struct {
+	ID         int64     `json:"id"`
+	Method     string    `json:"method" binding:"required"`
+	Path       string    `json:"path" binding:"required"`
+	Permission string    `json:"permission" binding:"required"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+type RuleStorage struct {
+	repository repository
+	cache      *cache
+}
+
+type RuleStorageOption func(*RuleStorage)
+
+// cache has the stored rules until they expire, it is shared by the copies of a RuleStorage
+type cache struct {
+	mu        sync.Mutex
+	ttl       time.Duration
+	rules     []Rule
+	expiresAt time.Time
+}
+
+// WithCacheTTL will change how long the stored rules are cached, rules changed by another instance of the application
+// are seen once they expire
+func WithCacheTTL(ttl time.Duration) RuleStorageOption {
+	return func(rst *RuleStorage) {
+		if ttl > 0 {
+			rst.cache.ttl = ttl
+		}
+	}
+}
+
+// NewRuleStorage will create and return a RuleStorage with the received repository and options, by default the stored
+// rules are cached for DefaultCacheTTL
+func NewRuleStorage(repository repository, opts ...RuleStorageOption) RuleStorage {
+	rst := RuleStorage{
+		repository: repository,
+		cache:      &cache{ttl: DefaultCacheTTL},
+	}
+
+	for _, opt := range opts {
+		opt(&rst)
+	}
+
+	return rst
+}
+
+// Save will validate and store a Rule on repository and return it, the cached rules are invalidated
+func (ruleStorage RuleStorage) Save(ctx context.Context, rule Rule) (Rule, error) {
+	if err := validateRule(ctx, rule); err != nil {
+		return Rule{}, err
+	}
+
+	rule.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	rule, err := ruleStorage.repository.SaveRule(ctx, rule)
+	if err != nil {
+		log.Error(ctx, "there was an error saving rule", log.Err(err))
+		if errors.Is(err, ErrRuleDuplicated) {
+			return Rule{}, ErrRuleAlreadyExists
+		}
+		return Rule{}, ErrStorageSave
+	}
+	ruleStorage.invalidate()
+
+	logAudit(ctx, "authorization rule added", rule)
+
+	return rule, nil
+}
+
+// List return all the stored rules ordered by id, from the cache while it is not expired
+func (ruleStorage RuleStorage) List(ctx context.Context) ([]Rule, error) {
+	ruleStorage.cache.mu.Lock()
+	defer ruleStorage.cache.mu.Unlock()
+
+	if time.Now().Before(ruleStorage.cache.expiresAt) {
+		return ruleStorage.cache.rules, nil
+	}
+
+	rules, err := ruleStorage.repository.GetRules(ctx)
+	if err != nil {
+		log.Error(ctx, "there was an error getting rules", log.Err(err))
+		return nil, ErrStorageGet
+	}
+
+	ruleStorage.cache.rules = rules
+	ruleStorage.cache.expiresAt = time.Now().Add(ruleStorage.cache.ttl)
+
+	return rules, nil
+}
+
+// Delete will remove the rule with the received id from repository, the cached rules are invalidated
+func (ruleStorage RuleStorage) Delete(ctx context.Context, id int64) error {
+	rule, err := ruleStorage.repository.GetRule(ctx, id)
+	if err != nil {
+		log.Error(ctx, "there was an error getting rule to delete", log.Int64("rule_id", id), log.Err(err))
+		if errors.Is(err, ErrRuleNotFound) {
+			return ErrNotFoundRule
+		}
+		return ErrStorageGet
+	}
+
+	if err := ruleStorage.repository.DeleteRule(ctx, id); err != nil {
+		log.Error(ctx, "there was an error deleting rule", log.Int64("rule_id", id), log.Err(err))
+		if errors.Is(err, ErrRuleNotFound) {
+			return ErrNotFoundRule
+		}
+		return ErrStorageDelete
+	}
+	ruleStorage.invalidate()
+
+	logAudit(ctx, "authorization rule removed", rule)
+
+	return nil
+}
+
+// invalidate remove the cached rules, so they are got again from repository
+func (ruleStorage RuleStorage) invalidate() {
+	ruleStorage.cache.mu.Lock()
+	defer ruleStorage.cache.mu.Unlock()
+
+	ruleStorage.cache.rules = nil
+	ruleStorage.cache.expiresAt = time.Time{}
+}
+
+// logAudit log the change of the rule with the user logged in who did it
+func logAudit(ctx context.Context, msg string, rule Rule) {
+	userLogged, _ := ctx.Value("user_on_call").(jwt.Claims)
+	auditlog.Log(ctx, msg,
+		log.Int64("rule_id", rule.ID),
+		log.String("method", rule.Method),
+		log.String("path", rule.Path),
+		log.String("permission", rule.Permission),
+		log.Int64("logged_user_id", userLogged.UserID))
+}
+
+// validateRule check the rule method, path and permission
+func validateRule(ctx context.Context, rule Rule) error {
+	if !methods[rule.Method] {
+		log.Info(ctx, "invalid check on rule: invalid method", log.String("method", rule.Method))
+		return ErrInvalidRuleMethod
+	}
+
+	if !strings.HasPrefix(rule.Path, "/") {
+		log.Info(ctx, "invalid check on rule: invalid path", log.String("path", rule.Path))
+		return ErrInvalidRulePath
+	}
+
+	if !user.ValidPermission(rule.Permission) {
+		log.Info(ctx, "invalid check on rule: unknown permission", log.String("permission", rule.Permission))
+		return ErrInvalidRulePermission
+	}
+
+	return nil
+}
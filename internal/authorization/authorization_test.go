@@ -0,0 +1,178 @@
+package authorization
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+// mockDb a 'db' to use on RuleStorage test with the capabilities to mock errors on save/get action, it counts the
+// rules got to check the cache
+type mockDb struct {
+	idCount int64
+	rules   map[int64]Rule
+	gets    int
+
+	saveError error
+	getError  error
+}
+
+func newMockDB() *mockDb {
+	return &mockDb{
+		idCount: 1,
+		rules:   make(map[int64]Rule),
+	}
+}
+
+func (db *mockDb) SaveRule(ctx context.Context, rule Rule) (Rule, error) {
+	if db.saveError != nil {
+		return Rule{}, db.saveError
+	}
+
+	for _, stored := range db.rules {
+		if stored.Method == rule.Method && stored.Path == rule.Path && stored.Permission == rule.Permission {
+			return Rule{}, ErrRuleDuplicated
+		}
+	}
+
+	rule.ID = db.idCount
+	db.rules[rule.ID] = rule
+
+	db.idCount++
+
+	return rule, nil
+}
+
+func (db *mockDb) GetRule(ctx context.Context, id int64) (Rule, error) {
+	if db.getError != nil {
+		return Rule{}, db.getError
+	}
+
+	rule, exist := db.rules[id]
+	if !exist {
+		return Rule{}, ErrRuleNotFound
+	}
+
+	return rule, nil
+}
+
+func (db *mockDb) GetRules(ctx context.Context) ([]Rule, error) {
+	db.gets++
+	if db.getError != nil {
+		return nil, db.getError
+	}
+
+	var rules []Rule
+	for id := int64(1); id < db.idCount; id++ {
+		if rule, exist := db.rules[id]; exist {
+			rules = append(rules, rule)
+		}
+	}
+
+	return rules, nil
+}
+
+func (db *mockDb) DeleteRule(ctx context.Context, id int64) error {
+	if _, exist := db.rules[id]; !exist {
+		return ErrRuleNotFound
+	}
+
+	delete(db.rules, id)
+	return nil
+}
+
+func Test_saveRule(t *testing.T) {
+	tests := map[string]struct {
+		db        *mockDb
+		rule      Rule
+		wantError error
+	}{
+		"successful saved rule": {
+			db:   newMockDB(),
+			rule: Rule{Method: "GET", Path: "/v1/travels/*", Permission: "driver:read"},
+		},
+
+		"successful saved rule of every method": {
+			db:   newMockDB(),
+			rule: Rule{Method: AnyMethod, Path: "/v1/zones", Permission: "travel:write"},
+		},
+
+		"failure due to invalid method": {
+			db:        newMockDB(),
+			rule:      Rule{Method: "get", Path: "/v1/travels", Permission: "driver:read"},
+			wantError: ErrInvalidRuleMethod,
+		},
+
+		"failure due to invalid path": {
+			db:        newMockDB(),
+			rule:      Rule{Method: "GET", Path: "v1/travels", Permission: "driver:read"},
+			wantError: ErrInvalidRulePath,
+		},
+
+		"failure due to unknown permission": {
+			db:        newMockDB(),
+			rule:      Rule{Method: "GET", Path: "/v1/travels", Permission: "travels:read"},
+			wantError: ErrInvalidRulePermission,
+		},
+
+		"failure due to storage error": {
+			db:        &mockDb{idCount: 1, rules: map[int64]Rule{}, saveError: errors.New("mock error")},
+			rule:      Rule{Method: "GET", Path: "/v1/travels", Permission: "driver:read"},
+			wantError: ErrStorageSave,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			rule, err := NewRuleStorage(tc.db).Save(context.Background(), tc.rule)
+			if tc.wantError != nil {
+				assert.Equal(t, tc.wantError.Error(), err.Error())
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.NotZero(t, rule.ID)
+			assert.False(t, rule.CreatedAt.IsZero())
+			assert.Equal(t, tc.rule.Path, rule.Path)
+		})
+	}
+}
+
+func Test_rulesCache(t *testing.T) {
+	db := newMockDB()
+	storage := NewRuleStorage(db)
+
+	rule, err := storage.Save(context.Background(), Rule{Method: "GET", Path: "/v1/travels", Permission: "driver:read"})
+	assert.Nil(t, err)
+
+	_, err = storage.Save(context.Background(), Rule{Method: "GET", Path: "/v1/travels", Permission: "driver:read"})
+	assert.Equal(t, ErrRuleAlreadyExists.Error(), err.Error())
+
+	// the rules are got once while they are cached
+	for i := 0; i < 3; i++ {
+		rules, err := storage.List(context.Background())
+		assert.Nil(t, err)
+		assert.Equal(t, []Rule{rule}, rules)
+	}
+	assert.Equal(t, 1, db.gets)
+
+	// removing a rule invalidates the cache
+	err = storage.Delete(context.Background(), rule.ID)
+	assert.Nil(t, err)
+
+	rules, err := storage.List(context.Background())
+	assert.Nil(t, err)
+	assert.Empty(t, rules)
+	assert.Equal(t, 2, db.gets)
+
+	err = storage.Delete(context.Background(), rule.ID)
+	assert.Equal(t, ErrNotFoundRule.Error(), err.Error())
+
+	// the rules are not cached when they cannot be got
+	db.getError = errors.New("mock error")
+	_, _ = storage.Save(context.Background(), Rule{Method: "GET", Path: "/v1/users", Permission: "driver:read"})
+
+	_, err = storage.List(context.Background())
+	assert.Equal(t, ErrStorageGet.Error(), err.Error())
+}
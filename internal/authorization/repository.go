@@ -0,0 +1,179 @@
+package authorization
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/nicocarolo/space-drivers/internal/platform/config"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	dbnameDefault = "space_drivers"
+
+	timeMetricName   = "application.space.repository.time"
+	entityMetricName = "authorization_rule"
+
+	// mysqlDuplicateEntry is the mysql error number of a unique key violation
+	mysqlDuplicateEntry = 1062
+)
+
+var (
+	ErrRuleNotFound   = errors.New("not founded rule")
+	ErrRuleDuplicated = errors.New("there is already a rule with the method, path and permission")
+)
+
+type repository interface {
+	SaveRule(ctx context.Context, rule Rule) (Rule, error)
+	GetRule(ctx context.Context, id int64) (Rule, error)
+	GetRules(ctx context.Context) ([]Rule, error)
+	DeleteRule(ctx context.Context, id int64) error
+}
+
+// SqlRepository sql client wrapper for rule model
+type SqlRepository struct {
+	db *sql.DB
+}
+
+// NewRepository creates and return an SqlRepository
+func NewRepository() (SqlRepository, error) {
+	dbname := os.Getenv("DB_NAME")
+	dbuser := os.Getenv("DB_USER")
+	dbpass := config.Secret("DB_PASSWORD", "")
+	dbimage := os.Getenv("DB_IMAGE_NAME")
+	scope := os.Getenv("SCOPE")
+
+	if dbname == "" {
+		dbname = dbnameDefault
+	}
+	if dbuser == "" || dbpass == "" || dbimage == "" {
+		return SqlRepository{}, fmt.Errorf("cannot initialize authorization repository: the following settings " +
+			"(DB_USER, DB_PASSWORD, DB_IMAGE_NAME) are invalid")
+	}
+
+	dataSourceConnection := fmt.Sprintf("%s:%s@/%s?parseTime=true", dbuser, dbpass, dbname)
+	if scope != "" {
+		dataSourceConnection = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?parseTime=true", dbuser, dbpass, dbimage, dbname)
+	}
+	db, err := sql.Open("mysql", dataSourceConnection)
+	if err != nil {
+		return SqlRepository{}, err
+	}
+
+	return SqlRepository{
+		db: db,
+	}, nil
+}
+
+// Close the connections to the db, once the repository is not used anymore
+func (sqlDb SqlRepository) Close() error {
+	return sqlDb.db.Close()
+}
+
+// Stats return the stats of the connections to the db, as the open and in use ones
+func (sqlDb SqlRepository) Stats() sql.DBStats {
+	return sqlDb.db.Stats()
+}
+
+// SaveRule will store a Rule on sql table, it return ErrRuleDuplicated if there is already a rule with the same
+// method, path and permission
+func (sqlDb SqlRepository) SaveRule(ctx context.Context, rule Rule) (Rule, error) {
+	trackTime := trackElapsed(ctx, entityMetricName, "insert")
+	result, err := sqlDb.db.ExecContext(ctx, "INSERT INTO authorization_rules(method, path, permission, created_at) "+
+		"VALUES(?, ?, ?, ?)", rule.Method, rule.Path, rule.Permission, rule.CreatedAt)
+	trackTime(err == nil)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+			return Rule{}, ErrRuleDuplicated
+		}
+		return Rule{}, err
+	}
+
+	rule.ID, err = result.LastInsertId()
+	if err != nil {
+		return Rule{}, err
+	}
+
+	return rule, nil
+}
+
+// GetRule will get the Rule who has the received id from table
+func (sqlDb SqlRepository) GetRule(ctx context.Context, id int64) (Rule, error) {
+	var rule Rule
+	trackTime := trackElapsed(ctx, entityMetricName, "select")
+	err := sqlDb.db.QueryRowContext(ctx, "SELECT id, method, path, permission, created_at FROM authorization_rules "+
+		"WHERE id = ?", id).
+		Scan(&rule.ID, &rule.Method, &rule.Path, &rule.Permission, &rule.CreatedAt)
+	trackTime(err == nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Rule{}, ErrRuleNotFound
+		}
+		return Rule{}, err
+	}
+
+	return rule, nil
+}
+
+// GetRules will get all the rules from table ordered by id
+func (sqlDb SqlRepository) GetRules(ctx context.Context) ([]Rule, error) {
+	trackTime := trackElapsed(ctx, entityMetricName, "select_all")
+	rows, err := sqlDb.db.QueryContext(ctx, "SELECT id, method, path, permission, created_at "+
+		"FROM authorization_rules ORDER BY id")
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var rules []Rule
+	for rows.Next() {
+		var rule Rule
+		if err := rows.Scan(&rule.ID, &rule.Method, &rule.Path, &rule.Permission, &rule.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		rules = append(rules, rule)
+	}
+
+	return rules, rows.Err()
+}
+
+// DeleteRule will remove the rule with the received id from table
+func (sqlDb SqlRepository) DeleteRule(ctx context.Context, id int64) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "delete")
+	result, err := sqlDb.db.ExecContext(ctx, "DELETE FROM authorization_rules WHERE id = ?", id)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrRuleNotFound
+	}
+
+	return nil
+}
+
+func trackElapsed(ctx context.Context, entity, action string) func(success bool) {
+	start := time.Now()
+	return func(success bool) {
+		metrics.Timing(ctx, timeMetricName, time.Since(start),
+			[]string{
+				"result", strconv.FormatBool(success),
+				"action", action,
+				"entity", entity})
+	}
+}
@@ -0,0 +1,57 @@
+package audit
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"os"
+	"time"
+)
+
+// DefaultFileMaxAge and DefaultFileMaxBackups are the rotation of the audit log file when no other is configured: a
+// file a day, kept for a year, as the audit lines are kept longer than the application ones
+const (
+	DefaultFileMaxAge     = 24 * time.Hour
+	DefaultFileMaxBackups = 365
+)
+
+// DefaultLogger is the logger of the audit lines, it writes on stdout until SetFile is called. Its lines are never
+// sampled nor filtered by the level of the application logs
+var DefaultLogger = log.NewUnsampled(os.Stdout)
+
+// Log write an audit line of a security or business event (as a user status change, a travel reassignment or an
+// access denied) with the audit sink, with the id of the request and the user logged in (and its impersonator and the
+// id of its token) on context, so the tokens seen on the sensitive actions are recorded. The lines have "log": "audit",
+// so they can be told apart from the application ones on stdout
+func Log(ctx context.Context, msg string, fields ...log.Field) {
+	fields = append([]log.Field{log.String("log", "audit")}, fields...)
+
+	if requestID, ok := ctx.Value(log.RequestIDKey).(string); ok && requestID != "" {
+		fields = append(fields, log.String("request_id", requestID))
+	}
+
+	if claims, ok := ctx.Value("user_on_call").(jwt.Claims); ok {
+		fields = append(fields, log.Int64("actor_id", claims.UserID))
+		if claims.ID != "" {
+			fields = append(fields, log.String("actor_token_id", claims.ID))
+		}
+		if claims.ImpersonatorID != 0 {
+			fields = append(fields, log.Int64("actor_impersonator_id", claims.ImpersonatorID))
+		}
+	}
+
+	DefaultLogger.Info(msg, fields...)
+}
+
+// SetFile write the audit lines on the file of the path instead of stdout, rotated once it has maxSize bytes (0 does
+// not rotate by size) or once it is maxAge old, keeping the last maxBackups rotated files
+func SetFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) error {
+	file, err := log.OpenFile(path, maxSize, maxAge, maxBackups)
+	if err != nil {
+		return err
+	}
+
+	DefaultLogger = log.NewUnsampled(file)
+
+	return nil
+}
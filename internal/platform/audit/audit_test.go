@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_log(t *testing.T) {
+	testscases := map[string]struct {
+		ctx  context.Context
+		want map[string]interface{}
+	}{
+		"successful line without request": {
+			ctx: context.Background(),
+			want: map[string]interface{}{
+				"log":     "audit",
+				"user_id": float64(2),
+			},
+		},
+		"successful line with request id, actor and token id": {
+			ctx: context.WithValue(context.WithValue(context.Background(), log.RequestIDKey, "a-request-id"),
+				"user_on_call", jwt.Claims{ID: "a-token-id", UserID: 1}),
+			want: map[string]interface{}{
+				"log":            "audit",
+				"user_id":        float64(2),
+				"request_id":     "a-request-id",
+				"actor_id":       float64(1),
+				"actor_token_id": "a-token-id",
+			},
+		},
+		"successful line with impersonator": {
+			ctx: context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, ImpersonatorID: 3}),
+			want: map[string]interface{}{
+				"log":                   "audit",
+				"user_id":               float64(2),
+				"actor_id":              float64(1),
+				"actor_impersonator_id": float64(3),
+			},
+		},
+	}
+
+	defer func(previous log.Logger) { DefaultLogger = previous }(DefaultLogger)
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			DefaultLogger = log.NewUnsampled(&buf)
+
+			Log(tc.ctx, "user deleted", log.Int64("user_id", 2))
+
+			var line map[string]interface{}
+			assert.Nil(t, json.Unmarshal(buf.Bytes(), &line))
+			assert.Equal(t, "user deleted", line["msg"])
+			assert.Equal(t, "INFO", line["level"])
+			for _, field := range []string{"msg", "level", "ts"} {
+				delete(line, field)
+			}
+			assert.Equal(t, tc.want, line)
+		})
+	}
+}
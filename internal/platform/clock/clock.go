@@ -0,0 +1,55 @@
+package clock
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock tells the current time, it is injected to the logic which depends on time (as the expiration of the tokens
+// and the travels) so the tests can set the time instead of waiting it
+type Clock interface {
+	Now() time.Time
+}
+
+// System is the clock of the system, used by default
+type System struct{}
+
+// Now return the current time of the system
+func (System) Now() time.Time {
+	return time.Now()
+}
+
+// Fake is a clock which time only changes when it is set or advanced, to test the logic which depends on time
+type Fake struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewFake return a Fake clock stopped on the received time
+func NewFake(now time.Time) *Fake {
+	return &Fake{now: now}
+}
+
+// Now return the time of the clock
+func (f *Fake) Now() time.Time {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.now
+}
+
+// Set the time of the clock
+func (f *Fake) Set(now time.Time) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = now
+}
+
+// Advance the time of the clock by the received duration
+func (f *Fake) Advance(d time.Duration) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.now = f.now.Add(d)
+}
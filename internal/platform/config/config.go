@@ -0,0 +1,107 @@
+package config
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/secrets"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// String return the value of the setting (environment variable) with the received key, or def if it is not
+// configured
+func String(key, def string) string {
+	value := os.Getenv(key)
+	if value == "" {
+		return def
+	}
+
+	return value
+}
+
+// Int return the setting with the received key as an integer, or def if it is not configured or invalid
+func Int(key string, def int64) int64 {
+	value, err := strconv.ParseInt(os.Getenv(key), 10, 64)
+	if err != nil {
+		return def
+	}
+
+	return value
+}
+
+// Bool return the setting with the received key as a boolean, or def if it is not configured or invalid
+func Bool(key string, def bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+
+	return value
+}
+
+// List return the setting with the received key as a comma separated list, without empty values. It is empty if the
+// setting is not configured
+func List(key string) []string {
+	return splitList(os.Getenv(key))
+}
+
+// splitList return the values of a comma separated list, without empty values
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+
+	return values
+}
+
+// Duration return the setting with the received key as a duration (as 1m30s), or def if it is not configured
+// or invalid
+func Duration(key string, def time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+
+	return value
+}
+
+// Float return the setting with the received key as a float, or def if it is not configured or invalid
+func Float(key string, def float64) float64 {
+	value, err := strconv.ParseFloat(os.Getenv(key), 64)
+	if err != nil {
+		return def
+	}
+
+	return value
+}
+
+// secretProvider is the provider of the secrets got with Secret, they are got from the environment when it is nil
+var secretProvider secrets.SecretProvider
+
+// SetSecretProvider change the provider of the secrets got with Secret, it should be set on start before any secret
+// is got
+func SetSecretProvider(provider secrets.SecretProvider) {
+	secretProvider = provider
+}
+
+// Secret return the secret with the received key from the secret provider, or from the setting with the key if the
+// provider does not have it (so the secrets can be moved to the provider one by one), or def if it is not configured
+func Secret(key, def string) string {
+	if secretProvider != nil {
+		value, err := secretProvider.Secret(context.Background(), key)
+		if err == nil {
+			return value
+		}
+	}
+
+	return String(key, def)
+}
+
+// SecretList return the secret with the received key (see Secret) as a comma separated list, without empty values
+func SecretList(key string) []string {
+	return splitList(Secret(key, ""))
+}
@@ -0,0 +1,28 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"strings"
+)
+
+// Store saves files (as attachments) by key, keys are slash separated paths as travels/1/photo.jpg
+type Store interface {
+	// Put store the content with the received key, replacing the file if it already exists
+	Put(ctx context.Context, key string, content []byte, contentType string) error
+}
+
+// validateKey check the key is a relative path without empty nor parent segments
+func validateKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") {
+		return fmt.Errorf("invalid file key %q", key)
+	}
+
+	for _, segment := range strings.Split(key, "/") {
+		if segment == "" || segment == "." || segment == ".." {
+			return fmt.Errorf("invalid file key %q", key)
+		}
+	}
+
+	return nil
+}
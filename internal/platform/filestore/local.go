@@ -0,0 +1,34 @@
+package filestore
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+)
+
+// LocalStore is a Store that saves the files on a directory of the local disk
+type LocalStore struct {
+	dir string
+}
+
+// NewLocalStore creates and return a LocalStore saving the files under the received directory
+func NewLocalStore(dir string) LocalStore {
+	return LocalStore{
+		dir: dir,
+	}
+}
+
+// Put write the content on the file of the key under the store directory, creating its parent directories
+func (store LocalStore) Put(ctx context.Context, key string, content []byte, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	path := filepath.Join(store.dir, filepath.FromSlash(key))
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, content, 0644)
+}
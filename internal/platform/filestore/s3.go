@@ -0,0 +1,85 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/platform/sigv4"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const s3Service = "s3"
+
+// S3Store is a Store that saves the files as objects of an Amazon S3 bucket, requests are signed with AWS
+// signature version 4
+type S3Store struct {
+	bucket          string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewS3Store creates and return a S3Store saving the files on the received bucket, using the received credentials
+func NewS3Store(bucket, region, accessKeyID, secretAccessKey string) S3Store {
+	return S3Store{
+		bucket:          bucket,
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		client:          &http.Client{Timeout: 30 * time.Second},
+		now:             time.Now,
+	}
+}
+
+// Put upload the content as the object with the received key
+func (store S3Store) Put(ctx context.Context, key string, content []byte, contentType string) error {
+	if err := validateKey(key); err != nil {
+		return err
+	}
+
+	host := fmt.Sprintf("%s.s3.%s.amazonaws.com", store.bucket, store.region)
+	path := objectPath(key)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPut, "https://"+host+path, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", contentType)
+	req.Header.Set("X-Amz-Content-Sha256", sigv4.PayloadHash(content))
+	sigv4.Sign(req, content, s3Service, store.region, sigv4.Credentials{
+		AccessKeyID:     store.accessKeyID,
+		SecretAccessKey: store.secretAccessKey,
+	}, store.now())
+
+	resp, err := store.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return fmt.Errorf("s3 put object %s failed with status %d: %s", key, resp.StatusCode, body)
+	}
+
+	return nil
+}
+
+// objectPath return the uri encoded path of the object with the received key
+func objectPath(key string) string {
+	segments := strings.Split(key, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+
+	return "/" + strings.Join(segments, "/")
+}
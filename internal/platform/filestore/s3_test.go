@@ -0,0 +1,68 @@
+package filestore
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/sigv4"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// roundTripFunc is an http.RoundTripper answering the requests with a func, instead of sending them to S3
+type roundTripFunc func(req *http.Request) (*http.Response, error)
+
+func (f roundTripFunc) RoundTrip(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+func Test_s3Put(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+
+	var received *http.Request
+	var receivedBody []byte
+	status := http.StatusOK
+	store := NewS3Store("a-bucket", "sa-east-1", "AKIDEXAMPLE", "a-secret")
+	store.now = func() time.Time { return now }
+	store.client = &http.Client{Transport: roundTripFunc(func(req *http.Request) (*http.Response, error) {
+		received = req
+		receivedBody, _ = ioutil.ReadAll(req.Body)
+		return &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(strings.NewReader("<Error><Code>AccessDenied</Code></Error>")),
+		}, nil
+	})}
+
+	err := store.Put(context.Background(), "travels/1/a photo.jpg", []byte("a-photo"), "image/jpeg")
+	assert.Nil(t, err)
+
+	assert.Equal(t, http.MethodPut, received.Method)
+	assert.Equal(t, "https://a-bucket.s3.sa-east-1.amazonaws.com/travels/1/a%20photo.jpg", received.URL.String())
+	assert.Equal(t, "a-photo", string(receivedBody))
+	assert.Equal(t, "image/jpeg", received.Header.Get("Content-Type"))
+	assert.Equal(t, sigv4.PayloadHash([]byte("a-photo")), received.Header.Get("X-Amz-Content-Sha256"))
+	assert.Equal(t, "20220301T100000Z", received.Header.Get("X-Amz-Date"))
+
+	// the request is signed with the same signature of an equal request signed by the AWS signer
+	expected, _ := http.NewRequest(http.MethodPut, received.URL.String(), nil)
+	expected.Header.Set("Content-Type", "image/jpeg")
+	expected.Header.Set("X-Amz-Content-Sha256", sigv4.PayloadHash([]byte("a-photo")))
+	sigv4.Sign(expected, []byte("a-photo"), "s3", "sa-east-1",
+		sigv4.Credentials{AccessKeyID: "AKIDEXAMPLE", SecretAccessKey: "a-secret"}, now)
+	assert.Equal(t, expected.Header.Get("Authorization"), received.Header.Get("Authorization"))
+	assert.True(t, strings.HasPrefix(received.Header.Get("Authorization"),
+		"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20220301/sa-east-1/s3/aws4_request, "+
+			"SignedHeaders=content-type;host;x-amz-content-sha256;x-amz-date, Signature="))
+
+	status = http.StatusForbidden
+	err = store.Put(context.Background(), "travels/1/a photo.jpg", []byte("a-photo"), "image/jpeg")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "status 403")
+
+	received = nil
+	err = store.Put(context.Background(), "../travels/1/a photo.jpg", []byte("a-photo"), "image/jpeg")
+	assert.NotNil(t, err)
+	assert.Nil(t, received)
+}
@@ -0,0 +1,80 @@
+package geo
+
+import "math"
+
+// EarthRadiusKm is the mean radius of the earth used on distance calculations
+const EarthRadiusKm = 6371.0
+
+// Coordinate is a location on the earth surface given by its latitude and longitude, in degrees
+type Coordinate struct {
+	Lat float64
+	Lng float64
+}
+
+// DistanceKm return the great-circle distance in kilometers between two coordinates (haversine formula)
+func DistanceKm(from, to Coordinate) float64 {
+	lat1 := toRadians(from.Lat)
+	lat2 := toRadians(to.Lat)
+	deltaLat := toRadians(to.Lat - from.Lat)
+	deltaLng := toRadians(to.Lng - from.Lng)
+
+	a := math.Sin(deltaLat/2)*math.Sin(deltaLat/2) +
+		math.Cos(lat1)*math.Cos(lat2)*math.Sin(deltaLng/2)*math.Sin(deltaLng/2)
+
+	return EarthRadiusKm * 2 * math.Atan2(math.Sqrt(a), math.Sqrt(1-a))
+}
+
+// Bearing return the initial bearing in degrees, on [0, 360), to follow from a coordinate to reach the other one
+// by the great-circle: 0 is north, 90 east, 180 south and 270 west
+func Bearing(from, to Coordinate) float64 {
+	lat1 := toRadians(from.Lat)
+	lat2 := toRadians(to.Lat)
+	deltaLng := toRadians(to.Lng - from.Lng)
+
+	y := math.Sin(deltaLng) * math.Cos(lat2)
+	x := math.Cos(lat1)*math.Sin(lat2) - math.Sin(lat1)*math.Cos(lat2)*math.Cos(deltaLng)
+
+	return math.Mod(toDegrees(math.Atan2(y, x))+360, 360)
+}
+
+// BoundingBox return the south-west and north-east corners of the box that contains every coordinate within the
+// received radius from the center. The box is clamped to valid coordinates instead of wrapping around the poles or
+// the antimeridian, and it has every longitude when the radius reaches a pole
+func BoundingBox(center Coordinate, radiusKm float64) (Coordinate, Coordinate) {
+	deltaLat := toDegrees(radiusKm / EarthRadiusKm)
+
+	southWest := Coordinate{Lat: math.Max(-90, center.Lat-deltaLat), Lng: -180}
+	northEast := Coordinate{Lat: math.Min(90, center.Lat+deltaLat), Lng: 180}
+	if southWest.Lat == -90 || northEast.Lat == 90 {
+		return southWest, northEast
+	}
+
+	deltaLng := toDegrees(radiusKm / (EarthRadiusKm * math.Cos(toRadians(center.Lat))))
+	southWest.Lng = math.Max(-180, center.Lng-deltaLng)
+	northEast.Lng = math.Min(180, center.Lng+deltaLng)
+
+	return southWest, northEast
+}
+
+// PolygonContains return if the coordinate is inside the polygon given by its vertices, closed from the last vertex
+// to the first one (ray casting algorithm). Coordinates on the border may be considered outside
+func PolygonContains(polygon []Coordinate, point Coordinate) bool {
+	inside := false
+	for i, j := 0, len(polygon)-1; i < len(polygon); j, i = i, i+1 {
+		a, b := polygon[i], polygon[j]
+		if (a.Lat > point.Lat) != (b.Lat > point.Lat) &&
+			point.Lng < (b.Lng-a.Lng)*(point.Lat-a.Lat)/(b.Lat-a.Lat)+a.Lng {
+			inside = !inside
+		}
+	}
+
+	return inside
+}
+
+func toRadians(degrees float64) float64 {
+	return degrees * math.Pi / 180
+}
+
+func toDegrees(radians float64) float64 {
+	return radians * 180 / math.Pi
+}
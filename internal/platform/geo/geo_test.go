@@ -0,0 +1,245 @@
+package geo
+
+import (
+	"github.com/stretchr/testify/assert"
+	"math"
+	"testing"
+)
+
+// degreeKm is the great-circle distance of a degree of latitude, or of longitude on the equator
+const degreeKm = EarthRadiusKm * math.Pi / 180
+
+func Test_distanceKm(t *testing.T) {
+	testscases := map[string]struct {
+		from Coordinate
+		to   Coordinate
+		want float64
+	}{
+		"same coordinate": {
+			from: Coordinate{Lat: -34.6037, Lng: -58.3816},
+			to:   Coordinate{Lat: -34.6037, Lng: -58.3816},
+			want: 0,
+		},
+		"a degree of latitude": {
+			from: Coordinate{Lat: 10, Lng: 20},
+			to:   Coordinate{Lat: 11, Lng: 20},
+			want: degreeKm,
+		},
+		"a degree of longitude on the equator": {
+			from: Coordinate{Lat: 0, Lng: 0},
+			to:   Coordinate{Lat: 0, Lng: 1},
+			want: degreeKm,
+		},
+		"a degree of longitude across the antimeridian": {
+			from: Coordinate{Lat: 0, Lng: 179.5},
+			to:   Coordinate{Lat: 0, Lng: -179.5},
+			want: degreeKm,
+		},
+		"pole to pole": {
+			from: Coordinate{Lat: 90, Lng: 0},
+			to:   Coordinate{Lat: -90, Lng: 0},
+			want: 180 * degreeKm,
+		},
+		"antipodal coordinates on the equator": {
+			from: Coordinate{Lat: 0, Lng: 0},
+			to:   Coordinate{Lat: 0, Lng: 180},
+			want: 180 * degreeKm,
+		},
+		"london to paris": {
+			from: Coordinate{Lat: 51.5074, Lng: -0.1278},
+			to:   Coordinate{Lat: 48.8566, Lng: 2.3522},
+			want: 343.5,
+		},
+		"buenos aires to montevideo": {
+			from: Coordinate{Lat: -34.6037, Lng: -58.3816},
+			to:   Coordinate{Lat: -34.9011, Lng: -56.1645},
+			want: 205.2,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			assert.InDelta(t, tc.want, DistanceKm(tc.from, tc.to), 0.5)
+			// the distance is the same on both directions
+			assert.InDelta(t, DistanceKm(tc.from, tc.to), DistanceKm(tc.to, tc.from), 1e-9)
+		})
+	}
+}
+
+func Test_bearing(t *testing.T) {
+	testscases := map[string]struct {
+		from Coordinate
+		to   Coordinate
+		want float64
+	}{
+		"north": {
+			from: Coordinate{Lat: 0, Lng: 0},
+			to:   Coordinate{Lat: 1, Lng: 0},
+			want: 0,
+		},
+		"east": {
+			from: Coordinate{Lat: 0, Lng: 0},
+			to:   Coordinate{Lat: 0, Lng: 1},
+			want: 90,
+		},
+		"south": {
+			from: Coordinate{Lat: 0, Lng: 0},
+			to:   Coordinate{Lat: -1, Lng: 0},
+			want: 180,
+		},
+		"west": {
+			from: Coordinate{Lat: 0, Lng: 0},
+			to:   Coordinate{Lat: 0, Lng: -1},
+			want: 270,
+		},
+		"east across the antimeridian": {
+			from: Coordinate{Lat: 0, Lng: 179.5},
+			to:   Coordinate{Lat: 0, Lng: -179.5},
+			want: 90,
+		},
+		"west across the antimeridian": {
+			from: Coordinate{Lat: 0, Lng: -179.5},
+			to:   Coordinate{Lat: 0, Lng: 179.5},
+			want: 270,
+		},
+		"london to paris": {
+			from: Coordinate{Lat: 51.5074, Lng: -0.1278},
+			to:   Coordinate{Lat: 48.8566, Lng: 2.3522},
+			want: 148.1,
+		},
+		"paris to london": {
+			from: Coordinate{Lat: 48.8566, Lng: 2.3522},
+			to:   Coordinate{Lat: 51.5074, Lng: -0.1278},
+			want: 330.0,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			bearing := Bearing(tc.from, tc.to)
+			assert.InDelta(t, tc.want, bearing, 0.1)
+			assert.True(t, bearing >= 0 && bearing < 360, bearing)
+		})
+	}
+}
+
+func Test_boundingBox(t *testing.T) {
+	testscases := map[string]struct {
+		center        Coordinate
+		radiusKm      float64
+		wantSouthWest Coordinate
+		wantNorthEast Coordinate
+	}{
+		"on the equator": {
+			center:        Coordinate{Lat: 0, Lng: 0},
+			radiusKm:      degreeKm,
+			wantSouthWest: Coordinate{Lat: -1, Lng: -1},
+			wantNorthEast: Coordinate{Lat: 1, Lng: 1},
+		},
+		"wider in longitude far from the equator": {
+			center:        Coordinate{Lat: 60, Lng: 10},
+			radiusKm:      degreeKm,
+			wantSouthWest: Coordinate{Lat: 59, Lng: 8},
+			wantNorthEast: Coordinate{Lat: 61, Lng: 12},
+		},
+		"clamped to the antimeridian on the east": {
+			center:        Coordinate{Lat: 0, Lng: 179.5},
+			radiusKm:      degreeKm,
+			wantSouthWest: Coordinate{Lat: -1, Lng: 178.5},
+			wantNorthEast: Coordinate{Lat: 1, Lng: 180},
+		},
+		"clamped to the antimeridian on the west": {
+			center:        Coordinate{Lat: 0, Lng: -179.5},
+			radiusKm:      degreeKm,
+			wantSouthWest: Coordinate{Lat: -1, Lng: -180},
+			wantNorthEast: Coordinate{Lat: 1, Lng: -178.5},
+		},
+		"every longitude reaching the north pole": {
+			center:        Coordinate{Lat: 89.5, Lng: 0},
+			radiusKm:      degreeKm,
+			wantSouthWest: Coordinate{Lat: 88.5, Lng: -180},
+			wantNorthEast: Coordinate{Lat: 90, Lng: 180},
+		},
+		"wider in longitude near the north pole": {
+			center:        Coordinate{Lat: 85, Lng: 0},
+			radiusKm:      degreeKm,
+			wantSouthWest: Coordinate{Lat: 84, Lng: -11.47},
+			wantNorthEast: Coordinate{Lat: 86, Lng: 11.47},
+		},
+		"every longitude on the north pole": {
+			center:        Coordinate{Lat: 90, Lng: 45},
+			radiusKm:      degreeKm,
+			wantSouthWest: Coordinate{Lat: 89, Lng: -180},
+			wantNorthEast: Coordinate{Lat: 90, Lng: 180},
+		},
+		"every longitude on the south pole": {
+			center:        Coordinate{Lat: -90, Lng: 0},
+			radiusKm:      degreeKm,
+			wantSouthWest: Coordinate{Lat: -90, Lng: -180},
+			wantNorthEast: Coordinate{Lat: -89, Lng: 180},
+		},
+		"radius bigger than the earth": {
+			center:        Coordinate{Lat: 10, Lng: 10},
+			radiusKm:      200 * degreeKm,
+			wantSouthWest: Coordinate{Lat: -90, Lng: -180},
+			wantNorthEast: Coordinate{Lat: 90, Lng: 180},
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			southWest, northEast := BoundingBox(tc.center, tc.radiusKm)
+
+			assert.InDelta(t, tc.wantSouthWest.Lat, southWest.Lat, 0.01)
+			assert.InDelta(t, tc.wantSouthWest.Lng, southWest.Lng, 0.01)
+			assert.InDelta(t, tc.wantNorthEast.Lat, northEast.Lat, 0.01)
+			assert.InDelta(t, tc.wantNorthEast.Lng, northEast.Lng, 0.01)
+		})
+	}
+}
+
+func Test_polygonContains(t *testing.T) {
+	square := []Coordinate{{Lat: 0, Lng: 0}, {Lat: 0, Lng: 10}, {Lat: 10, Lng: 10}, {Lat: 10, Lng: 0}}
+	// a square with a notch on its east border: the coordinates between lat 4 and 6 east of lng 5 are outside
+	notched := []Coordinate{
+		{Lat: 0, Lng: 0}, {Lat: 0, Lng: 10}, {Lat: 4, Lng: 10}, {Lat: 5, Lng: 5}, {Lat: 6, Lng: 10},
+		{Lat: 10, Lng: 10}, {Lat: 10, Lng: 0},
+	}
+
+	testscases := map[string]struct {
+		polygon []Coordinate
+		point   Coordinate
+		want    bool
+	}{
+		"inside":                  {polygon: square, point: Coordinate{Lat: 5, Lng: 5}, want: true},
+		"outside":                 {polygon: square, point: Coordinate{Lat: 5, Lng: 15}, want: false},
+		"outside on the lat":      {polygon: square, point: Coordinate{Lat: -5, Lng: 5}, want: false},
+		"inside the notched":      {polygon: notched, point: Coordinate{Lat: 2, Lng: 8}, want: true},
+		"outside on the notch":    {polygon: notched, point: Coordinate{Lat: 5, Lng: 8}, want: false},
+		"inside beside the notch": {polygon: notched, point: Coordinate{Lat: 5, Lng: 4}, want: true},
+		// the south and west borders are inside and the north and east ones outside, so a coordinate on the
+		// border of two adjacent polygons is inside only one of them
+		"on the west edge":            {polygon: square, point: Coordinate{Lat: 5, Lng: 0}, want: true},
+		"on the south edge":           {polygon: square, point: Coordinate{Lat: 0, Lng: 5}, want: true},
+		"on the east edge":            {polygon: square, point: Coordinate{Lat: 5, Lng: 10}, want: false},
+		"on the north edge":           {polygon: square, point: Coordinate{Lat: 10, Lng: 5}, want: false},
+		"on the south-west vertex":    {polygon: square, point: Coordinate{Lat: 0, Lng: 0}, want: true},
+		"on the north-east vertex":    {polygon: square, point: Coordinate{Lat: 10, Lng: 10}, want: false},
+		"on the lat of a vertex":      {polygon: notched, point: Coordinate{Lat: 5, Lng: 2}, want: true},
+		"on the notch vertex":         {polygon: notched, point: Coordinate{Lat: 5, Lng: 5}, want: false},
+		"without vertices":            {polygon: nil, point: Coordinate{Lat: 0, Lng: 0}, want: false},
+		"with less than three vertex": {polygon: square[:2], point: Coordinate{Lat: 0, Lng: 5}, want: false},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, PolygonContains(tc.polygon, tc.point))
+		})
+	}
+
+	// a coordinate on the shared border of two adjacent polygons is inside only one of them
+	east := []Coordinate{{Lat: 0, Lng: 10}, {Lat: 0, Lng: 20}, {Lat: 10, Lng: 20}, {Lat: 10, Lng: 10}}
+	for _, point := range []Coordinate{{Lat: 5, Lng: 10}, {Lat: 0, Lng: 10}} {
+		assert.NotEqual(t, PolygonContains(square, point), PolygonContains(east, point), point)
+	}
+}
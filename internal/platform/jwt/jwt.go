@@ -1,10 +1,15 @@
 package jwt
 
 import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
-	"os"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nicocarolo/space-drivers/internal/platform/clock"
+	"github.com/nicocarolo/space-drivers/internal/platform/config"
+	"github.com/nicocarolo/space-drivers/internal/platform/tracing"
 	"strings"
 	"time"
 )
@@ -14,32 +19,236 @@ var (
 	ErrInvalidToken  = errors.New("the received token is invalid")
 	ErrTokenExpired  = errors.New("the received token is expired")
 	ErrInvalidClaims = errors.New("cannot parse claims")
+
+	ErrTokenNotValidYet = errors.New("the received token is not valid yet")
 )
 
+// DefaultLeeway is the leeway used when JWT_LEEWAY is not configured
+const DefaultLeeway = 5 * time.Second
+
+// Clock is the time the tokens are generated and validated with, the tests can replace it to expire the tokens
+var Clock clock.Clock = clock.System{}
+
+// validMethods are the signing methods of the tokens accepted, the ones the keys sign with (see keys)
+var validMethods = []string{
+	jwt.SigningMethodHS256.Alg(),
+	jwt.SigningMethodRS256.Alg(),
+	jwt.SigningMethodEdDSA.Alg(),
+}
+
+// ClaimError is a claim of a token which is missing or has an invalid value. Err is ErrTokenExpired for the expired
+// tokens, ErrTokenNotValidYet for the tokens used before they are valid, and ErrInvalidClaims for the rest
+type ClaimError struct {
+	Claim string
+	Err   error
+}
+
+func (e *ClaimError) Error() string {
+	return fmt.Sprintf("%s : invalid %s claim", e.Err.Error(), e.Claim)
+}
+
+func (e *ClaimError) Unwrap() error {
+	return e.Err
+}
+
 const (
 	expKey    = "exp"
 	iatKey    = "iat"
+	nbfKey    = "nbf"
+	issKey    = "iss"
+	audKey    = "aud"
+	jtiKey    = "jti"
 	userIDKey = "user_id"
 	roleKey   = "role"
 
-	secretKey = "JWT_SECRET"
+	permissionsKey = "permissions"
+
+	emailKey   = "email"
+	purposeKey = "purpose"
+
+	// impersonatorKey is the id of the user who impersonates the user of the token
+	impersonatorKey = "impersonator_id"
+	// scopeKey is the scope which restricts the endpoints the token can access
+	scopeKey = "scope"
+	// sessionKey is the id of the session (opened by a login) the token was issued to
+	sessionKey = "sid"
+
+	// purposeInvitation is the purpose of the invitation tokens, tokens with a purpose cannot authenticate users
+	purposeInvitation = "invitation"
+	// purposeTracking is the purpose of the tokens of the public tracking links of a travel
+	purposeTracking = "tracking"
+
+	travelIDKey = "travel_id"
+
+	// kidHeader is the header with the id of the key which signed the token
+	kidHeader = "kid"
+
+	// tokenIDSize is the random bytes of the token ids
+	tokenIDSize = 16
+
+	// leewayKey is the clock skew tolerated when the time claims (exp, nbf and iat) are validated
+	leewayKey = "JWT_LEEWAY"
+	// issuerKey and audienceKey are the iss and aud of the generated tokens, the tokens validated must have them
+	// when they are configured, so the tokens of an environment cannot be used on another one
+	issuerKey   = "JWT_ISSUER"
+	audienceKey = "JWT_AUDIENCE"
 )
 
-// GenerateToken will return a jwt generated token with an expiration date, to the user id and with the role received
-func GenerateToken(userid int64, role string) (string, error) {
-	secret := os.Getenv(secretKey)
-	if secret == "" {
-		return "", fmt.Errorf("cannot create token: the jwt secret is not configured")
+// GenerateToken will return a jwt generated token with an expiration date, to the user id and with the email, role
+// and permissions received, so the services which receive it do not need to get the user
+func GenerateToken(userid int64, email, role string, permissions []string) (string, error) {
+	return GenerateScopedToken(userid, email, role, "", permissions)
+}
+
+// GenerateScopedToken will return a jwt token as GenerateToken restricted to the received scope, a token without
+// scope is not restricted
+func GenerateScopedToken(userid int64, email, role, scope string, permissions []string) (string, error) {
+	return GenerateSessionToken(userid, email, role, scope, permissions, 0)
+}
+
+// GenerateSessionToken will return a jwt token as GenerateScopedToken issued to the session with the received id, so
+// the token can be checked against its session. A session id of 0 is not added to the token
+func GenerateSessionToken(userid int64, email, role, scope string, permissions []string,
+	sessionID int64) (string, error) {
+	id, err := newTokenID()
+	if err != nil {
+		return "", fmt.Errorf("cannot create token: %w", err)
 	}
+
 	claims := jwt.MapClaims{
-		expKey:    time.Now().Add(time.Minute * 20).Unix(),
-		iatKey:    time.Now().Unix(),
+		expKey:    Clock.Now().Add(time.Minute * 20).Unix(),
+		iatKey:    Clock.Now().Unix(),
+		jtiKey:    id,
 		userIDKey: userid,
+		emailKey:  email,
 		roleKey:   role,
+
+		permissionsKey: permissions,
+	}
+	if scope != "" {
+		claims[scopeKey] = scope
+	}
+	if sessionID != 0 {
+		claims[sessionKey] = sessionID
+	}
+
+	t, err := sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("cannot create token: %w", err)
+	}
+
+	return t, nil
+}
+
+// GenerateImpersonation will return a jwt token as GenerateToken to the impersonated user, which expires at the
+// received time and carries the id of the impersonator, so the actions done with it can be audited
+func GenerateImpersonation(userid int64, email, role string, permissions []string, impersonatorID int64,
+	expiresAt time.Time) (string, error) {
+	id, err := newTokenID()
+	if err != nil {
+		return "", fmt.Errorf("cannot create impersonation: %w", err)
+	}
+
+	claims := jwt.MapClaims{
+		expKey:          expiresAt.Unix(),
+		iatKey:          Clock.Now().Unix(),
+		jtiKey:          id,
+		userIDKey:       userid,
+		emailKey:        email,
+		roleKey:         role,
+		impersonatorKey: impersonatorID,
+
+		permissionsKey: permissions,
+	}
+
+	t, err := sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("cannot create impersonation: %w", err)
+	}
+
+	return t, nil
+}
+
+// GenerateInvitation will return a jwt token inviting the email to register with the role, which expires at the
+// received time. Invitation tokens cannot be used to authenticate users
+func GenerateInvitation(email, role string, expiresAt time.Time) (string, error) {
+	id, err := newTokenID()
+	if err != nil {
+		return "", fmt.Errorf("cannot create invitation: %w", err)
+	}
+
+	claims := jwt.MapClaims{
+		expKey:     expiresAt.Unix(),
+		iatKey:     Clock.Now().Unix(),
+		jtiKey:     id,
+		emailKey:   email,
+		roleKey:    role,
+		purposeKey: purposeInvitation,
+	}
+
+	t, err := sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("cannot create invitation: %w", err)
+	}
+
+	return t, nil
+}
+
+// GenerateTracking will return a jwt token to track the travel with the received id, which expires at the received
+// time, so it expires with the tracking link shared. Tracking tokens cannot be used to authenticate users
+func GenerateTracking(travelID int64, expiresAt time.Time) (string, error) {
+	id, err := newTokenID()
+	if err != nil {
+		return "", fmt.Errorf("cannot create tracking: %w", err)
+	}
+
+	claims := jwt.MapClaims{
+		expKey:      expiresAt.Unix(),
+		iatKey:      Clock.Now().Unix(),
+		jtiKey:      id,
+		travelIDKey: travelID,
+		purposeKey:  purposeTracking,
+	}
+
+	t, err := sign(claims)
+	if err != nil {
+		return "", fmt.Errorf("cannot create tracking: %w", err)
+	}
+
+	return t, nil
+}
+
+// newTokenID return a random id to the jti claim, so the one-time tokens can be consumed by id
+func newTokenID() (string, error) {
+	b := make([]byte, tokenIDSize)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("%w : %s", ErrGenerateToken, err.Error())
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	t, err := token.SignedString([]byte(secret))
+	return hex.EncodeToString(b), nil
+}
+
+// sign return the token with the claims signed by the current signing key (see signingKey), with its id on the kid
+// header, and the issuer and audience configured
+func sign(claims jwt.MapClaims) (string, error) {
+	k, err := signingKey()
+	if err != nil {
+		return "", err
+	}
+
+	if issuer := config.String(issuerKey, ""); issuer != "" {
+		claims[issKey] = issuer
+	}
+	if audience := config.String(audienceKey, ""); audience != "" {
+		claims[audKey] = audience
+	}
+
+	token := jwt.NewWithClaims(k.method, claims)
+	if k.id != "" {
+		token.Header[kidHeader] = k.id
+	}
+
+	t, err := token.SignedString(k.signKey)
 	if err != nil {
 		return "", fmt.Errorf("%w : %s", ErrGenerateToken, err.Error())
 	}
@@ -47,49 +256,257 @@ func GenerateToken(userid int64, role string) (string, error) {
 	return t, nil
 }
 
-//ValidateToken validate the received token
-func ValidateToken(token string) (*jwt.Token, error) {
-	secret := os.Getenv(secretKey)
-	if secret == "" {
-		return nil, fmt.Errorf("cannot validate token: the jwt secret is not configured")
+//ValidateToken validate the received token: its signature, that its algorithm is an accepted one and its time claims
+//with the leeway on JWT_LEEWAY, and its issuer and audience if JWT_ISSUER and JWT_AUDIENCE are configured. The claims
+//errors are ClaimError
+func ValidateToken(ctx context.Context, token string) (*jwt.Token, error) {
+	_, span := tracing.Start(ctx, tracing.KindInternal, "jwt.validate", nil)
+	defer span.End()
+
+	parsed, err := validateToken(token)
+	if err != nil {
+		span.Fail(err.Error())
+		return nil, err
 	}
 
-	//2nd arg function return secret key after checking if the signing method is HMAC and returned key is used by 'Parse' to decode the token)
-	parsedToken, err := jwt.Parse(token, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+	span.SetAttributes("jwt.alg", parsed.Method.Alg())
+	return parsed, nil
+}
+
+func validateToken(token string) (*jwt.Token, error) {
+	active, err := keys()
+	if err != nil {
+		return nil, fmt.Errorf("cannot validate token: %w", err)
+	}
+	if len(active) == 0 {
+		return nil, fmt.Errorf("cannot validate token: %w", errSecretNotConfigured)
+	}
+
+	//2nd arg function return the key to validate the token after checking it was signed with the method of its key (by kid), so a public key cannot be used as an HMAC secret
+	options := []jwt.ParserOption{
+		jwt.WithValidMethods(validMethods),
+		jwt.WithLeeway(config.Duration(leewayKey, DefaultLeeway)),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+		jwt.WithTimeFunc(Clock.Now),
+	}
+	if issuer := config.String(issuerKey, ""); issuer != "" {
+		options = append(options, jwt.WithIssuer(issuer))
+	}
+	if audience := config.String(audienceKey, ""); audience != "" {
+		options = append(options, jwt.WithAudience(audience))
+	}
+
+	parser := jwt.NewParser(options...)
+	parsedToken, err := parser.Parse(token, func(token *jwt.Token) (interface{}, error) {
+		// tokens without kid were signed with JWT_SECRET
+		kid, _ := token.Header[kidHeader].(string)
+		k, ok := active[kid]
+		if !ok {
+			return nil, fmt.Errorf("unknown signing key: %s", kid)
+		}
+
+		if token.Method.Alg() != k.method.Alg() {
 			//nil secret key
 			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
 		}
-		return []byte(secret), nil
+		return k.verifyKey, nil
 	})
 
 	if err != nil {
-		if strings.Contains(err.Error(), "expired") {
-			return nil, ErrTokenExpired
-		}
-		return nil, fmt.Errorf("%w : %s", ErrInvalidToken, err.Error())
+		return nil, validationError(parsedToken, err)
 	}
 
 	return parsedToken, nil
 }
 
+// missingClaim return the first required claim which the token does not have: exp, and iss and aud when JWT_ISSUER
+// and JWT_AUDIENCE are configured. It return false when it cannot find which one is missing
+func missingClaim(token *jwt.Token) (string, bool) {
+	if token == nil {
+		return "", false
+	}
+
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok {
+		return "", false
+	}
+
+	if exp, err := claims.GetExpirationTime(); err == nil && exp == nil {
+		return expKey, true
+	}
+	if config.String(issuerKey, "") != "" {
+		if iss, err := claims.GetIssuer(); err == nil && iss == "" {
+			return issKey, true
+		}
+	}
+	if config.String(audienceKey, "") != "" {
+		// an audience of empty values is missing too
+		aud, err := claims.GetAudience()
+		if err == nil && strings.Join(aud, "") == "" {
+			return audKey, true
+		}
+	}
+
+	return "", false
+}
+
+// validationError return the error of the package to an error of the jwt library validating the token
+func validationError(token *jwt.Token, err error) error {
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return &ClaimError{Claim: expKey, Err: ErrTokenExpired}
+	case errors.Is(err, jwt.ErrTokenNotValidYet):
+		return &ClaimError{Claim: nbfKey, Err: ErrTokenNotValidYet}
+	case errors.Is(err, jwt.ErrTokenUsedBeforeIssued):
+		return &ClaimError{Claim: iatKey, Err: ErrTokenNotValidYet}
+	case errors.Is(err, jwt.ErrTokenInvalidIssuer):
+		return &ClaimError{Claim: issKey, Err: ErrInvalidClaims}
+	case errors.Is(err, jwt.ErrTokenInvalidAudience):
+		return &ClaimError{Claim: audKey, Err: ErrInvalidClaims}
+	case errors.Is(err, jwt.ErrTokenRequiredClaimMissing):
+		if claim, ok := missingClaim(token); ok {
+			return &ClaimError{Claim: claim, Err: ErrInvalidClaims}
+		}
+		return fmt.Errorf("%w : %s", ErrInvalidClaims, err.Error())
+	case errors.Is(err, jwt.ErrTokenInvalidClaims):
+		return fmt.Errorf("%w : %s", ErrInvalidClaims, err.Error())
+	}
+
+	return fmt.Errorf("%w : %s", ErrInvalidToken, err.Error())
+}
+
 type Claims struct {
-	Iat        int64
-	Expiration int64
-	UserID     int64
-	Role       string
+	// ID is the unique id of the token (jti), tokens generated before it was added have no id
+	ID          string
+	Iat         int64
+	Expiration  int64
+	UserID      int64
+	Email       string
+	Role        string
+	Permissions []string
+
+	// ImpersonatorID is the user who impersonates the user of the token, it is empty on the tokens of the user
+	ImpersonatorID int64
+	// Scope restricts the endpoints the token can access, it is empty on the tokens without restriction
+	Scope string
+	// SessionID is the session the token was issued to, it is empty on the tokens issued out of a session (as
+	// impersonations and two factor challenges)
+	SessionID int64
 }
 
-// GetClaims return claims from token
+// GetClaims return claims from token, tokens with a purpose (as invitations) have no user claims. A missing or invalid
+// user claim is a ClaimError
 func GetClaims(token *jwt.Token) (Claims, error) {
-	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
+	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid && claims[purposeKey] == nil {
+		iat, ok := claims[iatKey].(float64)
+		if !ok {
+			return Claims{}, &ClaimError{Claim: iatKey, Err: ErrInvalidClaims}
+		}
+		expiration, ok := claims[expKey].(float64)
+		if !ok {
+			return Claims{}, &ClaimError{Claim: expKey, Err: ErrInvalidClaims}
+		}
+		userID, ok := claims[userIDKey].(float64)
+		if !ok {
+			return Claims{}, &ClaimError{Claim: userIDKey, Err: ErrInvalidClaims}
+		}
+		role, ok := claims[roleKey].(string)
+		if !ok {
+			return Claims{}, &ClaimError{Claim: roleKey, Err: ErrInvalidClaims}
+		}
+
+		// tokens generated before the permissions were added to them have no permissions
+		var permissions []string
+		if values, ok := claims[permissionsKey].([]interface{}); ok {
+			for _, value := range values {
+				if permission, ok := value.(string); ok {
+					permissions = append(permissions, permission)
+				}
+			}
+		}
+
+		// tokens generated before the email was added to them have no email
+		email, _ := claims[emailKey].(string)
+		id, _ := claims[jtiKey].(string)
+		impersonator, _ := claims[impersonatorKey].(float64)
+		scope, _ := claims[scopeKey].(string)
+		sessionID, _ := claims[sessionKey].(float64)
+
 		return Claims{
-			Iat:        int64(claims[iatKey].(float64)),
-			Expiration: int64(claims[expKey].(float64)),
-			UserID:     int64(claims[userIDKey].(float64)),
-			Role:       claims[roleKey].(string),
+			ID:          id,
+			Iat:         int64(iat),
+			Expiration:  int64(expiration),
+			UserID:      int64(userID),
+			Email:       email,
+			Role:        role,
+			Permissions: permissions,
+
+			ImpersonatorID: int64(impersonator),
+			Scope:          scope,
+			SessionID:      int64(sessionID),
 		}, nil
 	}
 
 	return Claims{}, ErrInvalidClaims
 }
+
+// Invitation is the data of an invitation token: the email invited to register with the role
+type Invitation struct {
+	// ID is the unique id of the invitation (jti), invitations generated before it was added have no id
+	ID         string
+	Email      string
+	Role       string
+	Expiration int64
+}
+
+// GetInvitation return the invitation from token, ErrInvalidClaims if it is not an invitation token
+func GetInvitation(token *jwt.Token) (Invitation, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims[purposeKey] != purposeInvitation {
+		return Invitation{}, ErrInvalidClaims
+	}
+
+	email, _ := claims[emailKey].(string)
+	role, _ := claims[roleKey].(string)
+	expiration, _ := claims[expKey].(float64)
+	id, _ := claims[jtiKey].(string)
+	if email == "" || role == "" {
+		return Invitation{}, ErrInvalidClaims
+	}
+
+	return Invitation{
+		ID:         id,
+		Email:      email,
+		Role:       role,
+		Expiration: int64(expiration),
+	}, nil
+}
+
+// Tracking is the data of a tracking token: the travel which can be tracked with it
+type Tracking struct {
+	ID         string
+	TravelID   int64
+	Expiration int64
+}
+
+// GetTracking return the tracking from token, ErrInvalidClaims if it is not a tracking token
+func GetTracking(token *jwt.Token) (Tracking, error) {
+	claims, ok := token.Claims.(jwt.MapClaims)
+	if !ok || !token.Valid || claims[purposeKey] != purposeTracking {
+		return Tracking{}, ErrInvalidClaims
+	}
+
+	travelID, ok := claims[travelIDKey].(float64)
+	if !ok || travelID <= 0 {
+		return Tracking{}, &ClaimError{Claim: travelIDKey, Err: ErrInvalidClaims}
+	}
+	expiration, _ := claims[expKey].(float64)
+	id, _ := claims[jtiKey].(string)
+
+	return Tracking{
+		ID:         id,
+		TravelID:   int64(travelID),
+		Expiration: int64(expiration),
+	}, nil
+}
@@ -0,0 +1,261 @@
+package jwt
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nicocarolo/space-drivers/internal/platform/clock"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+const testSecret = "a-secret"
+
+// setEnv set the settings, unsetting them once the test ends
+func setEnv(t *testing.T, settings map[string]string) {
+	for key, value := range settings {
+		_ = os.Setenv(key, value)
+	}
+
+	t.Cleanup(func() {
+		for key := range settings {
+			_ = os.Unsetenv(key)
+		}
+	})
+}
+
+// signed return the claims signed with the method and key received, with the kid header when it is not empty
+func signed(t *testing.T, method jwt.SigningMethod, signKey interface{}, kid string, claims jwt.MapClaims) string {
+	token := jwt.NewWithClaims(method, claims)
+	if kid != "" {
+		token.Header[kidHeader] = kid
+	}
+
+	s, err := token.SignedString(signKey)
+	assert.Nil(t, err)
+
+	return s
+}
+
+func Test_validateToken(t *testing.T) {
+	now := time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC)
+	defer func(previous clock.Clock) { Clock = previous }(Clock)
+	Clock = clock.NewFake(now)
+
+	// an RSA key, so its public key can be used as an HMAC secret on a forged token
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	assert.Nil(t, err)
+	der, err := x509.MarshalPKCS8PrivateKey(rsaKey)
+	assert.Nil(t, err)
+	rsaPath := filepath.Join(t.TempDir(), "rsa.pem")
+	assert.Nil(t, ioutil.WriteFile(rsaPath, pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}), 0600))
+	publicDer, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	assert.Nil(t, err)
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDer})
+
+	setEnv(t, map[string]string{
+		secretKey:      testSecret,
+		privateKeysKey: "rsa:" + rsaPath,
+	})
+
+	// claims return valid claims with the changes received, a nil value removes the claim
+	claims := func(changes jwt.MapClaims) jwt.MapClaims {
+		c := jwt.MapClaims{
+			expKey:    now.Add(time.Hour).Unix(),
+			iatKey:    now.Unix(),
+			issKey:    "space-drivers",
+			audKey:    "space-drivers-api",
+			userIDKey: 1,
+		}
+		for claim, value := range changes {
+			if value == nil {
+				delete(c, claim)
+				continue
+			}
+			c[claim] = value
+		}
+
+		return c
+	}
+	hmac := func(changes jwt.MapClaims) string {
+		return signed(t, jwt.SigningMethodHS256, []byte(testSecret), "", claims(changes))
+	}
+
+	testscases := map[string]struct {
+		token     string
+		settings  map[string]string
+		wantError error
+		// wantErrorIs is the error of the package of the errors which are not a ClaimError
+		wantErrorIs error
+	}{
+		"successful token": {
+			token: hmac(nil),
+		},
+		"successful token signed with a private key": {
+			token: signed(t, jwt.SigningMethodRS256, rsaKey, "rsa", claims(nil)),
+		},
+		"successful expired token in the leeway": {
+			token: hmac(jwt.MapClaims{expKey: now.Add(-3 * time.Second).Unix()}),
+		},
+		"successful issuer and audience configured": {
+			token:    hmac(nil),
+			settings: map[string]string{issuerKey: "space-drivers", audienceKey: "space-drivers-api"},
+		},
+		"error expired token": {
+			token:     hmac(jwt.MapClaims{expKey: now.Add(-time.Minute).Unix()}),
+			wantError: &ClaimError{Claim: expKey, Err: ErrTokenExpired},
+		},
+		"error expired token out of the leeway configured": {
+			token:     hmac(jwt.MapClaims{expKey: now.Add(-3 * time.Second).Unix()}),
+			settings:  map[string]string{leewayKey: "1s"},
+			wantError: &ClaimError{Claim: expKey, Err: ErrTokenExpired},
+		},
+		"error token not valid yet": {
+			token:     hmac(jwt.MapClaims{nbfKey: now.Add(time.Minute).Unix()}),
+			wantError: &ClaimError{Claim: nbfKey, Err: ErrTokenNotValidYet},
+		},
+		"error token issued in the future": {
+			token:     hmac(jwt.MapClaims{iatKey: now.Add(time.Minute).Unix()}),
+			wantError: &ClaimError{Claim: iatKey, Err: ErrTokenNotValidYet},
+		},
+		"error wrong issuer": {
+			token:     hmac(jwt.MapClaims{issKey: "another-environment"}),
+			settings:  map[string]string{issuerKey: "space-drivers"},
+			wantError: &ClaimError{Claim: issKey, Err: ErrInvalidClaims},
+		},
+		"error wrong audience": {
+			token:     hmac(jwt.MapClaims{audKey: "another-api"}),
+			settings:  map[string]string{audienceKey: "space-drivers-api"},
+			wantError: &ClaimError{Claim: audKey, Err: ErrInvalidClaims},
+		},
+		"error missing exp": {
+			token:     hmac(jwt.MapClaims{expKey: nil}),
+			wantError: &ClaimError{Claim: expKey, Err: ErrInvalidClaims},
+		},
+		"error missing iss": {
+			token:     hmac(jwt.MapClaims{issKey: nil}),
+			settings:  map[string]string{issuerKey: "space-drivers"},
+			wantError: &ClaimError{Claim: issKey, Err: ErrInvalidClaims},
+		},
+		"error missing aud": {
+			token:     hmac(jwt.MapClaims{audKey: nil}),
+			settings:  map[string]string{issuerKey: "space-drivers", audienceKey: "space-drivers-api"},
+			wantError: &ClaimError{Claim: audKey, Err: ErrInvalidClaims},
+		},
+		"error empty aud": {
+			token:     hmac(jwt.MapClaims{audKey: []string{""}}),
+			settings:  map[string]string{audienceKey: "space-drivers-api"},
+			wantError: &ClaimError{Claim: audKey, Err: ErrInvalidClaims},
+		},
+		"error alg none": {
+			token:       signed(t, jwt.SigningMethodNone, jwt.UnsafeAllowNoneSignatureType, "", claims(nil)),
+			wantErrorIs: ErrInvalidToken,
+		},
+		"error public key used as an HMAC secret": {
+			token:       signed(t, jwt.SigningMethodHS256, publicPEM, "rsa", claims(nil)),
+			wantErrorIs: ErrInvalidToken,
+		},
+		"error unknown kid": {
+			token:       signed(t, jwt.SigningMethodHS256, []byte(testSecret), "unknown", claims(nil)),
+			wantErrorIs: ErrInvalidToken,
+		},
+		"error wrong secret": {
+			token:       signed(t, jwt.SigningMethodHS256, []byte("another-secret"), "", claims(nil)),
+			wantErrorIs: ErrInvalidToken,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			setEnv(t, tc.settings)
+
+			token, err := ValidateToken(context.Background(), tc.token)
+
+			switch {
+			case tc.wantError != nil:
+				assert.Nil(t, token)
+				assert.Equal(t, tc.wantError, err)
+			case tc.wantErrorIs != nil:
+				assert.Nil(t, token)
+				assert.True(t, errors.Is(err, tc.wantErrorIs), err)
+
+				var claimErr *ClaimError
+				assert.False(t, errors.As(err, &claimErr))
+			default:
+				assert.Nil(t, err)
+				assert.True(t, token.Valid)
+			}
+		})
+	}
+}
+
+func Test_validationError(t *testing.T) {
+	testscases := map[string]struct {
+		err       error
+		wantError error
+	}{
+		"expired": {
+			err:       jwt.ErrTokenExpired,
+			wantError: &ClaimError{Claim: expKey, Err: ErrTokenExpired},
+		},
+		"not valid yet": {
+			err:       jwt.ErrTokenNotValidYet,
+			wantError: &ClaimError{Claim: nbfKey, Err: ErrTokenNotValidYet},
+		},
+		"used before issued": {
+			err:       jwt.ErrTokenUsedBeforeIssued,
+			wantError: &ClaimError{Claim: iatKey, Err: ErrTokenNotValidYet},
+		},
+		"invalid issuer": {
+			err:       jwt.ErrTokenInvalidIssuer,
+			wantError: &ClaimError{Claim: issKey, Err: ErrInvalidClaims},
+		},
+		"invalid audience": {
+			err:       jwt.ErrTokenInvalidAudience,
+			wantError: &ClaimError{Claim: audKey, Err: ErrInvalidClaims},
+		},
+		// without the token the missing claim cannot be found, it is not reported as exp
+		"required claim missing without token": {
+			err:       jwt.ErrTokenRequiredClaimMissing,
+			wantError: ErrInvalidClaims,
+		},
+		"invalid claims": {
+			err:       jwt.ErrTokenInvalidClaims,
+			wantError: ErrInvalidClaims,
+		},
+		"invalid signature": {
+			err:       jwt.ErrTokenSignatureInvalid,
+			wantError: ErrInvalidToken,
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			err := validationError(nil, tc.err)
+
+			var claimErr *ClaimError
+			if errors.As(tc.wantError, &claimErr) {
+				assert.Equal(t, tc.wantError, err)
+				return
+			}
+
+			assert.True(t, errors.Is(err, tc.wantError), err)
+			assert.False(t, errors.As(err, &claimErr))
+		})
+	}
+}
+
+func Test_claimError(t *testing.T) {
+	err := &ClaimError{Claim: expKey, Err: ErrTokenExpired}
+
+	assert.Equal(t, "the received token is expired : invalid exp claim", err.Error())
+	assert.True(t, errors.Is(err, ErrTokenExpired))
+}
@@ -0,0 +1,202 @@
+package jwt
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/nicocarolo/space-drivers/internal/platform/config"
+	"io/ioutil"
+	"math/big"
+	"sort"
+	"strings"
+	"sync"
+)
+
+const (
+	secretKey       = "JWT_SECRET"
+	keysKey         = "JWT_KEYS"
+	privateKeysKey  = "JWT_PRIVATE_KEYS"
+	signingKeyIDKey = "JWT_KEY_ID"
+)
+
+var errSecretNotConfigured = errors.New("the jwt secret is not configured")
+
+// key is an active key to sign and validate tokens
+type key struct {
+	id     string
+	method jwt.SigningMethod
+	// signKey and verifyKey are the same secret for HMAC keys, and the private and public key for RSA and Ed25519 keys
+	signKey   interface{}
+	verifyKey interface{}
+}
+
+// privateKeys are the keys already loaded by the path of their file, so they are read once
+var privateKeys sync.Map
+
+// keys return the active keys by key id: the secrets on JWT_KEYS (comma separated kid:secret) and the one on
+// JWT_SECRET, without key id, sign with HS256. The private keys on JWT_PRIVATE_KEYS (comma separated kid:path of
+// a PEM file) sign with RS256 if they are RSA keys or EdDSA if they are Ed25519 keys.
+// Every active key is accepted to validate tokens, so a new key can be added (and used to sign) while the tokens
+// signed with the previous one are still valid, and the previous one removed once they expire. JWT_KEYS and JWT_SECRET
+// are got from the secret provider (see config.Secret), so the rotated secrets are used without a restart
+func keys() (map[string]key, error) {
+	keys := make(map[string]key)
+	if secret := config.Secret(secretKey, ""); secret != "" {
+		keys[""] = key{method: jwt.SigningMethodHS256, signKey: []byte(secret), verifyKey: []byte(secret)}
+	}
+
+	for _, value := range config.SecretList(keysKey) {
+		if kid, secret, ok := splitKey(value); ok {
+			keys[kid] = key{id: kid, method: jwt.SigningMethodHS256, signKey: []byte(secret), verifyKey: []byte(secret)}
+		}
+	}
+
+	for _, value := range config.List(privateKeysKey) {
+		kid, path, ok := splitKey(value)
+		if !ok {
+			continue
+		}
+
+		k, err := loadPrivateKey(path)
+		if err != nil {
+			return nil, fmt.Errorf("cannot load jwt key %s: %w", kid, err)
+		}
+
+		k.id = kid
+		keys[kid] = k
+	}
+
+	return keys, nil
+}
+
+// signingKey return the key to sign new tokens, the one on JWT_KEY_ID or the JWT_SECRET if it is not configured
+func signingKey() (key, error) {
+	active, err := keys()
+	if err != nil {
+		return key{}, err
+	}
+
+	kid := config.String(signingKeyIDKey, "")
+	k, ok := active[kid]
+	if !ok {
+		if kid == "" {
+			return key{}, errSecretNotConfigured
+		}
+		return key{}, fmt.Errorf("the jwt signing key %s is not configured", kid)
+	}
+
+	return k, nil
+}
+
+// CheckKeys return an error if the keys are not configured, or they cannot be loaded
+func CheckKeys() error {
+	_, err := signingKey()
+	return err
+}
+
+// splitKey return the id and value of a kid:value configured key
+func splitKey(value string) (string, string, bool) {
+	parts := strings.SplitN(value, ":", 2)
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return "", "", false
+	}
+
+	return parts[0], parts[1], true
+}
+
+// loadPrivateKey return the RSA (PKCS #1 or #8) or Ed25519 (PKCS #8) key on the PEM file of the path
+func loadPrivateKey(path string) (key, error) {
+	if k, ok := privateKeys.Load(path); ok {
+		return k.(key), nil
+	}
+
+	content, err := ioutil.ReadFile(path)
+	if err != nil {
+		return key{}, err
+	}
+
+	block, _ := pem.Decode(content)
+	if block == nil {
+		return key{}, errors.New("the file has no PEM key")
+	}
+
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return key{}, err
+		}
+	}
+
+	var k key
+	switch private := parsed.(type) {
+	case *rsa.PrivateKey:
+		k = key{method: jwt.SigningMethodRS256, signKey: private, verifyKey: &private.PublicKey}
+	case ed25519.PrivateKey:
+		k = key{method: jwt.SigningMethodEdDSA, signKey: private, verifyKey: private.Public()}
+	default:
+		return key{}, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	privateKeys.Store(path, k)
+
+	return k, nil
+}
+
+// JSONWebKey is the public key of an asymmetric signing key (RFC 7517)
+type JSONWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	// N and E are the modulus and exponent of RSA keys
+	N string `json:"n,omitempty"`
+	E string `json:"e,omitempty"`
+	// Crv and X are the curve and public key of Ed25519 keys
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet is a set of public keys (JWKS)
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// PublicKeys return the public keys of the active asymmetric keys sorted by kid, so other services can validate the
+// tokens signed with them without sharing a secret. HMAC keys are not returned
+func PublicKeys() (JSONWebKeySet, error) {
+	active, err := keys()
+	if err != nil {
+		return JSONWebKeySet{}, err
+	}
+
+	set := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, k := range active {
+		webKey := JSONWebKey{Kid: k.id, Use: "sig", Alg: k.method.Alg()}
+		switch public := k.verifyKey.(type) {
+		case *rsa.PublicKey:
+			webKey.Kty = "RSA"
+			webKey.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			webKey.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			webKey.Kty = "OKP"
+			webKey.Crv = "Ed25519"
+			webKey.X = base64.RawURLEncoding.EncodeToString(public)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, webKey)
+	}
+
+	sort.Slice(set.Keys, func(i, j int) bool {
+		return set.Keys[i].Kid < set.Keys[j].Kid
+	})
+
+	return set, nil
+}
@@ -0,0 +1,51 @@
+package lock
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Local is a Lock of a single instance of the api, the locks are kept in memory. It is safe for concurrent use
+type Local struct {
+	mu    sync.Mutex
+	locks map[string]localLock
+}
+
+type localLock struct {
+	token     string
+	expiresAt time.Time
+}
+
+// NewLocal creates and return a Local lock
+func NewLocal() *Local {
+	return &Local{locks: make(map[string]localLock)}
+}
+
+func (l *Local) Acquire(_ context.Context, key string, ttl time.Duration) (Release, error) {
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	if held, ok := l.locks[key]; ok && now.Before(held.expiresAt) {
+		return nil, ErrLocked
+	}
+	l.locks[key] = localLock{token: token, expiresAt: now.Add(ttl)}
+
+	return func() error {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+
+		// the lock could have expired and been taken by another caller
+		if held, ok := l.locks[key]; ok && held.token == token {
+			delete(l.locks, key)
+		}
+
+		return nil
+	}, nil
+}
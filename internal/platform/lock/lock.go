@@ -0,0 +1,33 @@
+package lock
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"time"
+)
+
+// ErrLocked is returned when the lock of a key is held by another caller (as another instance of the api)
+var ErrLocked = errors.New("the lock is held by another caller")
+
+// Lock takes locks by key shared by every instance of the api, so only one of them runs a scheduled job or assigns a
+// given travel at a time
+type Lock interface {
+	// Acquire take the lock of the key without waiting for it, it return ErrLocked when another caller holds it. The
+	// lock is held until the returned Release is called or, if the instance dies, until ttl passes
+	Acquire(ctx context.Context, key string, ttl time.Duration) (Release, error)
+}
+
+// Release free a lock taken with Acquire, so other callers can take it
+type Release func() error
+
+// newToken return a random token to identify the holder of a lock, so only it can release the lock
+func newToken() (string, error) {
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(token), nil
+}
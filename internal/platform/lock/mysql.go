@@ -0,0 +1,77 @@
+package lock
+
+import (
+	"context"
+	"crypto/sha1"
+	"database/sql"
+	"database/sql/driver"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// mysqlMaxName is the longest name of a MySQL lock, longer keys are hashed
+const mysqlMaxName = 64
+
+// MySQL is a Lock with the named locks of MySQL (GET_LOCK), shared by every instance of the api using the same
+// database. A MySQL lock belongs to the connection which took it, so each lock holds a connection of the pool until
+// it is released, and it is released by MySQL as soon as the connection is lost (as when the instance dies), so the
+// ttl is not used
+type MySQL struct {
+	db *sql.DB
+}
+
+// NewMySQL creates and return a MySQL lock taking the locks with the connections of the received pool
+func NewMySQL(db *sql.DB) MySQL {
+	return MySQL{db: db}
+}
+
+func (m MySQL) Acquire(ctx context.Context, key string, _ time.Duration) (Release, error) {
+	conn, err := m.db.Conn(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	name := mysqlLockName(key)
+
+	// a timeout of 0 does not wait for the lock, the result is 1 when it is taken and 0 when another connection has it
+	var acquired sql.NullInt64
+	if err := conn.QueryRowContext(ctx, "SELECT GET_LOCK(?, 0)", name).Scan(&acquired); err != nil {
+		_ = conn.Close()
+		return nil, err
+	}
+	if !acquired.Valid {
+		_ = conn.Close()
+		return nil, errors.New("cannot get mysql lock " + name)
+	}
+	if acquired.Int64 != 1 {
+		_ = conn.Close()
+		return nil, ErrLocked
+	}
+
+	return func() error {
+		// closing the conn returns the connection to the pool, with the lock still held by its session. If RELEASE_LOCK
+		// fails the connection is discarded instead, so MySQL releases the lock when the connection is closed
+		defer conn.Close()
+
+		_, err := conn.ExecContext(context.Background(), "SELECT RELEASE_LOCK(?)", name)
+		if err != nil {
+			_ = conn.Raw(func(interface{}) error {
+				return driver.ErrBadConn
+			})
+		}
+		return err
+	}, nil
+}
+
+// mysqlLockName return the name of the MySQL lock of the key, the keys too long for MySQL are hashed
+func mysqlLockName(key string) string {
+	name := "space-drivers:" + key
+	if len(name) <= mysqlMaxName {
+		return name
+	}
+
+	sum := sha1.Sum([]byte(key))
+	return fmt.Sprintf("space-drivers:%s", hex.EncodeToString(sum[:]))
+}
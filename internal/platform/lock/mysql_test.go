@@ -0,0 +1,163 @@
+package lock
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// mysqlServer is a fake MySQL server with the named locks used by the lock, a lock belongs to the connection which
+// took it and it is released when the connection is closed
+type mysqlServer struct {
+	mu    sync.Mutex
+	locks map[string]*mysqlConn
+	// failRelease makes RELEASE_LOCK fail
+	failRelease bool
+	closed      int
+}
+
+func newMySQLServer() *mysqlServer {
+	return &mysqlServer{locks: make(map[string]*mysqlConn)}
+}
+
+func (s *mysqlServer) Connect(ctx context.Context) (driver.Conn, error) {
+	return &mysqlConn{server: s}, nil
+}
+
+func (s *mysqlServer) Driver() driver.Driver {
+	return nil
+}
+
+type mysqlConn struct {
+	server *mysqlServer
+}
+
+func (c *mysqlConn) Prepare(query string) (driver.Stmt, error) {
+	return nil, errors.New("prepared statements are not supported")
+}
+
+func (c *mysqlConn) Begin() (driver.Tx, error) {
+	return nil, errors.New("transactions are not supported")
+}
+
+func (c *mysqlConn) Close() error {
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	c.server.closed++
+	for name, holder := range c.server.locks {
+		if holder == c {
+			delete(c.server.locks, name)
+		}
+	}
+
+	return nil
+}
+
+func (c *mysqlConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if query != "SELECT GET_LOCK(?, 0)" {
+		return nil, errors.New("unexpected query " + query)
+	}
+
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	name := args[0].Value.(string)
+	if holder, held := c.server.locks[name]; held && holder != c {
+		return &mysqlRows{value: 0}, nil
+	}
+	c.server.locks[name] = c
+
+	return &mysqlRows{value: 1}, nil
+}
+
+func (c *mysqlConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if query != "SELECT RELEASE_LOCK(?)" {
+		return nil, errors.New("unexpected query " + query)
+	}
+
+	c.server.mu.Lock()
+	defer c.server.mu.Unlock()
+
+	if c.server.failRelease {
+		return nil, errors.New("lost connection to MySQL server during query")
+	}
+	name := args[0].Value.(string)
+	if c.server.locks[name] == c {
+		delete(c.server.locks, name)
+	}
+
+	return driver.RowsAffected(0), nil
+}
+
+// mysqlRows is the single row of a GET_LOCK
+type mysqlRows struct {
+	value int64
+	read  bool
+}
+
+func (r *mysqlRows) Columns() []string {
+	return []string{"GET_LOCK"}
+}
+
+func (r *mysqlRows) Close() error {
+	return nil
+}
+
+func (r *mysqlRows) Next(dest []driver.Value) error {
+	if r.read {
+		return io.EOF
+	}
+	r.read = true
+	dest[0] = r.value
+
+	return nil
+}
+
+func Test_mysqlLockName(t *testing.T) {
+	assert.Equal(t, "space-drivers:travels.jobs.archive", mysqlLockName("travels.jobs.archive"))
+
+	// the keys too long for MySQL are hashed, each one to a different name
+	long := "travels.assignment." + strings.Repeat("1", mysqlMaxName)
+	name := mysqlLockName(long)
+	assert.LessOrEqual(t, len(name), mysqlMaxName)
+	assert.True(t, strings.HasPrefix(name, "space-drivers:"))
+	assert.Equal(t, name, mysqlLockName(long))
+	assert.NotEqual(t, name, mysqlLockName(long+"2"))
+}
+
+func Test_mysqlAcquire(t *testing.T) {
+	server := newMySQLServer()
+	db := sql.OpenDB(server)
+	defer db.Close()
+	m := NewMySQL(db)
+
+	release, err := m.Acquire(context.Background(), "travels.jobs.archive", time.Minute)
+	assert.Nil(t, err)
+	assert.Len(t, server.locks, 1)
+
+	// the lock cannot be taken while it is held, by another connection
+	_, err = m.Acquire(context.Background(), "travels.jobs.archive", time.Minute)
+	assert.Equal(t, ErrLocked, err)
+
+	// it is released and its connection goes back to the pool
+	assert.Nil(t, release())
+	assert.Empty(t, server.locks)
+	assert.Equal(t, 0, server.closed)
+
+	release, err = m.Acquire(context.Background(), "travels.jobs.archive", time.Minute)
+	assert.Nil(t, err)
+
+	// when it cannot be released its connection is closed, which releases it
+	server.failRelease = true
+	assert.NotNil(t, release())
+	assert.Empty(t, server.locks)
+	assert.Equal(t, 1, server.closed)
+}
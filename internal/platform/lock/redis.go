@@ -0,0 +1,158 @@
+package lock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// redisTimeout is how long a command sent to Redis can take when the context has no deadline
+const redisTimeout = 5 * time.Second
+
+// redisRelease delete the key only if it still has the token of the holder, so a lock which expired and was taken
+// by another caller is not released
+const redisRelease = `if redis.call("get", KEYS[1]) == ARGV[1] then return redis.call("del", KEYS[1]) else return 0 end`
+
+// Redis is a Lock with the keys of a Redis server, shared by every instance of the api using the same server. A lock
+// is a key set only if it does not exist (SET NX) with the ttl as expiration, so it is released by Redis when its
+// holder dies
+type Redis struct {
+	addr     string
+	password string
+	db       int64
+	dial     func(ctx context.Context, network, address string) (net.Conn, error)
+}
+
+// NewRedis creates and return a Redis lock with the server on addr (as redis:6379), authenticated with the password
+// when it is not empty, and using the received database
+func NewRedis(addr, password string, db int64) Redis {
+	return Redis{
+		addr:     addr,
+		password: password,
+		db:       db,
+		dial:     (&net.Dialer{Timeout: redisTimeout}).DialContext,
+	}
+}
+
+func (r Redis) Acquire(ctx context.Context, key string, ttl time.Duration) (Release, error) {
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid ttl %s of redis lock %s: it should be positive", ttl, key)
+	}
+
+	token, err := newToken()
+	if err != nil {
+		return nil, err
+	}
+
+	key = "space-drivers:lock:" + key
+	reply, err := r.do(ctx, "SET", key, token, "NX", "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	if err != nil {
+		return nil, err
+	}
+	// the reply is nil when the key already exists
+	if reply == nil {
+		return nil, ErrLocked
+	}
+
+	return func() error {
+		_, err := r.do(context.Background(), "EVAL", redisRelease, "1", key, token)
+		return err
+	}, nil
+}
+
+// do send the command on a new connection to the server and return its reply: a string, an int64 or nil
+func (r Redis) do(ctx context.Context, args ...string) (interface{}, error) {
+	conn, err := r.dial(ctx, "tcp", r.addr)
+	if err != nil {
+		return nil, err
+	}
+	defer conn.Close()
+
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(redisTimeout)
+	}
+	if err := conn.SetDeadline(deadline); err != nil {
+		return nil, err
+	}
+
+	var commands [][]string
+	if r.password != "" {
+		commands = append(commands, []string{"AUTH", r.password})
+	}
+	if r.db != 0 {
+		commands = append(commands, []string{"SELECT", strconv.FormatInt(r.db, 10)})
+	}
+	commands = append(commands, args)
+
+	// the commands are pipelined, the reply of the last one is the one of the received command
+	writer := bufio.NewWriter(conn)
+	for _, command := range commands {
+		writeRedisCommand(writer, command)
+	}
+	if err := writer.Flush(); err != nil {
+		return nil, err
+	}
+
+	reader := bufio.NewReader(conn)
+	var reply interface{}
+	for range commands {
+		if reply, err = readRedisReply(reader); err != nil {
+			return nil, err
+		}
+	}
+
+	return reply, nil
+}
+
+// writeRedisCommand write the command as an array of bulk strings of the Redis protocol (RESP)
+func writeRedisCommand(w *bufio.Writer, args []string) {
+	fmt.Fprintf(w, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(w, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+}
+
+// readRedisReply read a reply of the Redis protocol (RESP): the simple and bulk strings are returned as string, the
+// integers as int64, the nil bulk strings as nil and the errors as error. Arrays are not used by the lock commands
+func readRedisReply(r *bufio.Reader) (interface{}, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	line = strings.TrimSuffix(line, "\r\n")
+	if line == "" {
+		return nil, errors.New("invalid empty redis reply")
+	}
+
+	switch line[0] {
+	case '+':
+		return line[1:], nil
+	case '-':
+		return nil, fmt.Errorf("redis error: %s", line[1:])
+	case ':':
+		return strconv.ParseInt(line[1:], 10, 64)
+	case '$':
+		size, err := strconv.Atoi(line[1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid redis bulk string size %s", line[1:])
+		}
+		if size < 0 {
+			return nil, nil
+		}
+
+		bulk := make([]byte, size+2)
+		if _, err := io.ReadFull(r, bulk); err != nil {
+			return nil, err
+		}
+		return string(bulk[:size]), nil
+	}
+
+	return nil, fmt.Errorf("unsupported redis reply %q", line)
+}
@@ -0,0 +1,199 @@
+package lock
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"github.com/stretchr/testify/assert"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// redisServer is a fake Redis server with the commands used by the lock, it serves each connection on one side of a
+// net.Pipe
+type redisServer struct {
+	mu       sync.Mutex
+	keys     map[string]string
+	commands [][]string
+}
+
+func newRedisServer() *redisServer {
+	return &redisServer{keys: make(map[string]string)}
+}
+
+func (s *redisServer) dial(ctx context.Context, network, address string) (net.Conn, error) {
+	client, server := net.Pipe()
+	go s.serve(server)
+
+	return client, nil
+}
+
+func (s *redisServer) serve(conn net.Conn) {
+	defer conn.Close()
+
+	reader := bufio.NewReader(conn)
+	for {
+		command, err := readRedisCommand(reader)
+		if err != nil {
+			return
+		}
+
+		if _, err := io.WriteString(conn, s.reply(command)); err != nil {
+			return
+		}
+	}
+}
+
+func (s *redisServer) reply(command []string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.commands = append(s.commands, command)
+	switch strings.ToUpper(command[0]) {
+	case "AUTH", "SELECT":
+		return "+OK\r\n"
+	case "SET":
+		if _, exist := s.keys[command[1]]; exist {
+			return "$-1\r\n"
+		}
+		s.keys[command[1]] = command[2]
+		return "+OK\r\n"
+	case "EVAL":
+		// the release script: the key is deleted only if it has the token
+		if s.keys[command[3]] != command[4] {
+			return ":0\r\n"
+		}
+		delete(s.keys, command[3])
+		return ":1\r\n"
+	}
+
+	return "-ERR unknown command\r\n"
+}
+
+// readRedisCommand read a command sent as an array of bulk strings
+func readRedisCommand(r *bufio.Reader) ([]string, error) {
+	line, err := r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	size, err := strconv.Atoi(strings.TrimSuffix(line, "\r\n")[1:])
+	if err != nil {
+		return nil, err
+	}
+
+	command := make([]string, size)
+	for i := range command {
+		arg, err := readRedisReply(r)
+		if err != nil {
+			return nil, err
+		}
+		command[i] = arg.(string)
+	}
+
+	return command, nil
+}
+
+func Test_readRedisReply(t *testing.T) {
+	testscases := map[string]struct {
+		reply     string
+		want      interface{}
+		wantError error
+	}{
+		"simple string": {
+			reply: "+OK\r\n",
+			want:  "OK",
+		},
+		"integer": {
+			reply: ":1\r\n",
+			want:  int64(1),
+		},
+		"bulk string": {
+			reply: "$5\r\nhello\r\n",
+			want:  "hello",
+		},
+		"empty bulk string": {
+			reply: "$0\r\n\r\n",
+			want:  "",
+		},
+		"nil bulk string": {
+			reply: "$-1\r\n",
+			want:  nil,
+		},
+		"error": {
+			reply:     "-ERR wrong number of arguments\r\n",
+			wantError: errors.New("redis error: ERR wrong number of arguments"),
+		},
+		"invalid empty reply": {
+			reply:     "\r\n",
+			wantError: errors.New("invalid empty redis reply"),
+		},
+		"invalid bulk string size": {
+			reply:     "$a\r\n",
+			wantError: errors.New("invalid redis bulk string size a"),
+		},
+		"truncated bulk string": {
+			reply:     "$5\r\nhel",
+			wantError: io.ErrUnexpectedEOF,
+		},
+		"unsupported array": {
+			reply:     "*1\r\n$2\r\nOK\r\n",
+			wantError: fmt.Errorf("unsupported redis reply %q", "*1"),
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			reply, err := readRedisReply(bufio.NewReader(strings.NewReader(tc.reply)))
+
+			if tc.wantError != nil {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.wantError.Error(), err.Error())
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, reply)
+		})
+	}
+}
+
+func Test_redisAcquire(t *testing.T) {
+	server := newRedisServer()
+	r := NewRedis("redis:6379", "a-password", 2)
+	r.dial = server.dial
+
+	release, err := r.Acquire(context.Background(), "travels.jobs.archive", time.Minute)
+	assert.Nil(t, err)
+
+	// the commands are authenticated on the database configured, and the key expires after the ttl
+	key := "space-drivers:lock:travels.jobs.archive"
+	if assert.Len(t, server.commands, 3) {
+		assert.Equal(t, []string{"AUTH", "a-password"}, server.commands[0])
+		assert.Equal(t, []string{"SELECT", "2"}, server.commands[1])
+		assert.Equal(t, []string{"SET", key, server.keys[key], "NX", "PX", "60000"}, server.commands[2])
+	}
+
+	// the lock cannot be taken while it is held
+	_, err = r.Acquire(context.Background(), "travels.jobs.archive", time.Minute)
+	assert.Equal(t, ErrLocked, err)
+
+	// and it can once it is released
+	assert.Nil(t, release())
+	assert.Empty(t, server.keys)
+
+	release, err = r.Acquire(context.Background(), "travels.jobs.archive", time.Minute)
+	assert.Nil(t, err)
+
+	// a lock which expired and was taken by another caller is not released
+	server.keys[key] = "another-token"
+	assert.Nil(t, release())
+	assert.Equal(t, "another-token", server.keys[key])
+
+	_, err = r.Acquire(context.Background(), "travels.jobs.archive", 0)
+	assert.NotNil(t, err)
+}
@@ -1,6 +1,9 @@
 package log
 
-import "go.uber.org/zap"
+import (
+	"go.uber.org/zap"
+	"time"
+)
 
 type Field = zap.Field
 
@@ -18,3 +21,15 @@ func Err(err error) Field {
 func Int64(key string, val int64) Field {
 	return zap.Int64(key, val)
 }
+
+func Float64(key string, val float64) Field {
+	return zap.Float64(key, val)
+}
+
+func Int(key string, val int) Field {
+	return zap.Int(key, val)
+}
+
+func Duration(key string, val time.Duration) Field {
+	return zap.Duration(key, val)
+}
@@ -0,0 +1,196 @@
+package log
+
+import (
+	"fmt"
+	"go.uber.org/zap"
+	"io"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultFileMaxSize, DefaultFileMaxAge and DefaultFileMaxBackups are the rotation of the log file when no other is
+// configured: it is rotated once it has 100MB or once it is a day old, and the last 7 rotated files are kept
+const (
+	DefaultFileMaxSize    = 100 * 1024 * 1024
+	DefaultFileMaxAge     = 24 * time.Hour
+	DefaultFileMaxBackups = 7
+)
+
+// fileSinkScheme is the scheme of the zap sink of the log file, so it is written along with stdout
+const fileSinkScheme = "rotating"
+
+// backupTimeFormat is the suffix of the rotated files, sortable so the oldest ones are removed first
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+// file is where the lines are written besides stdout, it is nil when they are only written on stdout
+var file *rotatingFile
+
+func init() {
+	_ = zap.RegisterSink(fileSinkScheme, func(*url.URL) (zap.Sink, error) {
+		if file == nil {
+			return nil, fmt.Errorf("there is no log file")
+		}
+
+		return file, nil
+	})
+}
+
+// SetFile write the lines on the file of the path too, besides stdout, for the deployments without a log shipper.
+// The file is rotated once it has maxSize bytes or once it is maxAge old (0 does not rotate by that), renamed with the
+// time of the rotation as suffix (as api.log.2022-03-01T10-00-00.000), and only the last maxBackups rotated files are
+// kept. DefaultLogger is built again with it
+func SetFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) error {
+	rotating, err := openRotatingFile(path, maxSize, maxAge, maxBackups)
+	if err != nil {
+		return err
+	}
+
+	file = rotating
+	DefaultLogger = nil
+
+	return nil
+}
+
+// OpenFile return the file of the path rotated by size and age as the one of SetFile, to write the lines of another
+// logger (as the audit one) on it
+func OpenFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (io.WriteCloser, error) {
+	return openRotatingFile(path, maxSize, maxAge, maxBackups)
+}
+
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, maxBackups int) (*rotatingFile, error) {
+	rotating := &rotatingFile{path: path, maxSize: maxSize, maxAge: maxAge, maxBackups: maxBackups}
+	if err := rotating.open(); err != nil {
+		return nil, fmt.Errorf("cannot open log file %s: %w", path, err)
+	}
+
+	return rotating, nil
+}
+
+// rotatingFile is a log file rotated by size and age. It is safe for concurrent use
+type rotatingFile struct {
+	mu         sync.Mutex
+	path       string
+	maxSize    int64
+	maxAge     time.Duration
+	maxBackups int
+
+	current  *os.File
+	size     int64
+	openedAt time.Time
+}
+
+func (f *rotatingFile) Write(line []byte) (int, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	tooBig := f.maxSize > 0 && f.size > 0 && f.size+int64(len(line)) > f.maxSize
+	tooOld := f.maxAge > 0 && time.Since(f.openedAt) >= f.maxAge
+	if tooBig || tooOld {
+		if err := f.rotate(); err != nil {
+			return 0, err
+		}
+	}
+
+	n, err := f.current.Write(line)
+	f.size += int64(n)
+
+	return n, err
+}
+
+func (f *rotatingFile) Sync() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.current.Sync()
+}
+
+func (f *rotatingFile) Close() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.current.Close()
+}
+
+// open the file of the path, appending to it if it exists. Its age is counted from its last change, so a file
+// already old is rotated on the first line written
+func (f *rotatingFile) open() error {
+	if err := os.MkdirAll(filepath.Dir(f.path), 0755); err != nil {
+		return err
+	}
+
+	current, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+
+	info, err := current.Stat()
+	if err != nil {
+		_ = current.Close()
+		return err
+	}
+
+	f.current, f.size, f.openedAt = current, info.Size(), time.Now()
+	if info.Size() > 0 {
+		f.openedAt = info.ModTime()
+	}
+
+	return nil
+}
+
+// rotate rename the current file with the time as suffix, open a new one and remove the oldest rotated files
+func (f *rotatingFile) rotate() error {
+	if err := f.current.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Rename(f.path, f.path+"."+time.Now().Format(backupTimeFormat)); err != nil {
+		return err
+	}
+
+	if err := f.open(); err != nil {
+		return err
+	}
+
+	backups, err := f.backups()
+	if err != nil || len(backups) <= f.maxBackups {
+		return nil
+	}
+
+	sort.Strings(backups)
+	for _, backup := range backups[:len(backups)-f.maxBackups] {
+		_ = os.Remove(backup)
+	}
+
+	return nil
+}
+
+// backups return the paths of the rotated files of the path, only the ones with a rotation time as suffix so other
+// files beside it (as api.log.gz or the ones of another api.log.audit) are never removed
+func (f *rotatingFile) backups() ([]string, error) {
+	files, err := ioutil.ReadDir(filepath.Dir(f.path))
+	if err != nil {
+		return nil, err
+	}
+
+	prefix := filepath.Base(f.path) + "."
+	var backups []string
+	for _, info := range files {
+		suffix := strings.TrimPrefix(info.Name(), prefix)
+		if info.IsDir() || suffix == info.Name() {
+			continue
+		}
+		if _, err := time.Parse(backupTimeFormat, suffix); err != nil {
+			continue
+		}
+
+		backups = append(backups, filepath.Join(filepath.Dir(f.path), info.Name()))
+	}
+
+	return backups, nil
+}
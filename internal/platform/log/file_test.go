@@ -0,0 +1,126 @@
+package log
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+)
+
+// readDir return the names of the files on the directory and their content
+func readDir(t *testing.T, dir string) map[string]string {
+	files, err := ioutil.ReadDir(dir)
+	assert.Nil(t, err)
+
+	contents := make(map[string]string)
+	for _, info := range files {
+		content, err := ioutil.ReadFile(filepath.Join(dir, info.Name()))
+		assert.Nil(t, err)
+		contents[info.Name()] = string(content)
+	}
+
+	return contents
+}
+
+// backupContents return the contents of the rotated files on the directory, from the oldest one
+func backupContents(t *testing.T, dir string) []string {
+	backups, err := filepath.Glob(filepath.Join(dir, "api.log.*"))
+	assert.Nil(t, err)
+	sort.Strings(backups)
+
+	var contents []string
+	for _, backup := range backups {
+		content, err := ioutil.ReadFile(backup)
+		assert.Nil(t, err)
+		contents = append(contents, string(content))
+	}
+
+	return contents
+}
+
+func Test_rotatingFileSize(t *testing.T) {
+	dir := t.TempDir()
+	f, err := openRotatingFile(filepath.Join(dir, "api.log"), 10, 0, 3)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	// a line which does not fit is written on a new file, even a line bigger than the file on an empty one
+	_, err = f.Write([]byte("line 1\n"))
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("line 2\n"))
+	assert.Nil(t, err)
+
+	files := readDir(t, dir)
+	assert.Len(t, files, 2)
+	assert.Equal(t, "line 2\n", files["api.log"])
+	assert.Equal(t, []string{"line 1\n"}, backupContents(t, dir))
+
+	time.Sleep(2 * time.Millisecond)
+	_, err = f.Write([]byte("a line bigger than the file\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, "a line bigger than the file\n", readDir(t, dir)["api.log"])
+	assert.Equal(t, []string{"line 1\n", "line 2\n"}, backupContents(t, dir))
+}
+
+func Test_rotatingFileAge(t *testing.T) {
+	dir := t.TempDir()
+	f, err := openRotatingFile(filepath.Join(dir, "api.log"), 0, time.Hour, 3)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	_, err = f.Write([]byte("line 1\n"))
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("line 2\n"))
+	assert.Nil(t, err)
+	assert.Len(t, readDir(t, dir), 1)
+
+	// once the file is older than the max age the next line is written on a new one
+	f.openedAt = time.Now().Add(-time.Hour)
+	_, err = f.Write([]byte("line 3\n"))
+	assert.Nil(t, err)
+
+	assert.Equal(t, "line 3\n", readDir(t, dir)["api.log"])
+	assert.Equal(t, []string{"line 1\nline 2\n"}, backupContents(t, dir))
+}
+
+func Test_rotatingFileBackups(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"api.log.2022-03-01T10-00-00.000": "oldest",
+		"api.log.2022-03-02T10-00-00.000": "old",
+		"api.log.2022-03-03T10-00-00.000": "newest",
+		// files beside the log which are not its rotated files
+		"api.log.gz":                            "compressed",
+		"api.log.audit":                         "audit",
+		"api.log.audit.2022-03-01T10-00-00.000": "audit rotated",
+	}
+	for name, content := range files {
+		assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, name), []byte(content), 0644))
+	}
+
+	f, err := openRotatingFile(filepath.Join(dir, "api.log"), 10, 0, 2)
+	assert.Nil(t, err)
+	defer f.Close()
+
+	_, err = f.Write([]byte("line 1\n"))
+	assert.Nil(t, err)
+	_, err = f.Write([]byte("line 2\n"))
+	assert.Nil(t, err)
+
+	// only the last two rotated files are kept
+	got := readDir(t, dir)
+	assert.Len(t, got, 6)
+	assert.Equal(t, "line 2\n", got["api.log"])
+	assert.NotContains(t, got, "api.log.2022-03-01T10-00-00.000")
+	assert.NotContains(t, got, "api.log.2022-03-02T10-00-00.000")
+	assert.Equal(t, "newest", got["api.log.2022-03-03T10-00-00.000"])
+	assert.Equal(t, "compressed", got["api.log.gz"])
+	assert.Equal(t, "audit", got["api.log.audit"])
+	assert.Equal(t, "audit rotated", got["api.log.audit.2022-03-01T10-00-00.000"])
+
+	backups, err := f.backups()
+	assert.Nil(t, err)
+	assert.Len(t, backups, 2)
+}
@@ -0,0 +1,82 @@
+package log
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultLimitInterval is how often a limited message is written when no other interval is configured
+const DefaultLimitInterval = time.Second
+
+// limiter of the messages of the hot paths, as the validation failures
+var limiter = &messageLimiter{every: DefaultLimitInterval, messages: make(map[string]*limitedMessage)}
+
+// messageLimiter write each message at most once per interval, counting the ones suppressed meanwhile. It is safe for
+// concurrent use
+type messageLimiter struct {
+	mu       sync.Mutex
+	every    time.Duration
+	messages map[string]*limitedMessage
+}
+
+type limitedMessage struct {
+	last       time.Time
+	suppressed int64
+}
+
+// SetLimitInterval change how often a limited message is written
+func SetLimitInterval(every time.Duration) {
+	limiter.mu.Lock()
+	defer limiter.mu.Unlock()
+
+	limiter.every = every
+}
+
+// ErrorLimited logs a message at ErrorLevel at most once per limit interval, so the hot paths (as the validation
+// failures) cannot flood the logs under attack or retry storms. The line written has the quantity of lines
+// suppressed since the previous one
+func ErrorLimited(ctx context.Context, msg string, fields ...Field) {
+	if suppressed, ok := limiter.allow(msg); ok {
+		Error(ctx, msg, withSuppressed(fields, suppressed)...)
+	}
+}
+
+// InfoLimited logs a message at InfoLevel at most once per limit interval, as ErrorLimited
+func InfoLimited(ctx context.Context, msg string, fields ...Field) {
+	if suppressed, ok := limiter.allow(msg); ok {
+		Info(ctx, msg, withSuppressed(fields, suppressed)...)
+	}
+}
+
+// allow return if the message can be written now, and how many times it was suppressed since it was last written
+func (l *messageLimiter) allow(msg string) (int64, bool) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := time.Now()
+	message, ok := l.messages[msg]
+	if !ok {
+		l.messages[msg] = &limitedMessage{last: now}
+		return 0, true
+	}
+
+	if now.Sub(message.last) < l.every {
+		message.suppressed++
+		return 0, false
+	}
+
+	suppressed := message.suppressed
+	message.last = now
+	message.suppressed = 0
+
+	return suppressed, true
+}
+
+func withSuppressed(fields []Field, suppressed int64) []Field {
+	if suppressed == 0 {
+		return fields
+	}
+
+	return append(fields, Int64("suppressed", suppressed))
+}
@@ -0,0 +1,63 @@
+package log
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+// recordedLine is a line written by a recordLogger
+type recordedLine struct {
+	level  string
+	msg    string
+	fields []Field
+}
+
+// recordLogger is a Logger keeping the lines written
+type recordLogger struct {
+	lines []recordedLine
+}
+
+func (l *recordLogger) Error(msg string, fields ...Field) {
+	l.lines = append(l.lines, recordedLine{level: "error", msg: msg, fields: fields})
+}
+
+func (l *recordLogger) Info(msg string, fields ...Field) {
+	l.lines = append(l.lines, recordedLine{level: "info", msg: msg, fields: fields})
+}
+
+func Test_errorLimited(t *testing.T) {
+	defer func(previous *messageLimiter) { limiter = previous }(limiter)
+	limiter = &messageLimiter{every: DefaultLimitInterval, messages: make(map[string]*limitedMessage)}
+	SetLimitInterval(time.Hour)
+
+	recorder := &recordLogger{}
+	ctx := context.WithValue(context.Background(), LoggerKey, Logger(recorder))
+	msg := "there was an error validating the travel on limit test"
+
+	// only the first line of the interval is written
+	for i := 0; i < 3; i++ {
+		ErrorLimited(ctx, msg, String("field", "value"))
+	}
+	if assert.Len(t, recorder.lines, 1) {
+		assert.Equal(t, recordedLine{level: "error", msg: msg, fields: []Field{String("field", "value")}},
+			recorder.lines[0])
+	}
+
+	// another message is limited on its own
+	InfoLimited(ctx, msg+" with info")
+	assert.Len(t, recorder.lines, 2)
+
+	// once the interval passed the next line is written with the quantity of lines suppressed
+	limiter.mu.Lock()
+	limiter.messages[msg].last = time.Now().Add(-time.Hour)
+	limiter.mu.Unlock()
+
+	ErrorLimited(ctx, msg, String("field", "value"))
+	ErrorLimited(ctx, msg, String("field", "value"))
+	if assert.Len(t, recorder.lines, 3) {
+		assert.Equal(t, recordedLine{level: "error", msg: msg,
+			fields: []Field{String("field", "value"), Int64("suppressed", 2)}}, recorder.lines[2])
+	}
+}
@@ -2,8 +2,11 @@ package log
 
 import (
 	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/tracing"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"io"
 )
 
 type Logger interface {
@@ -23,18 +26,78 @@ type logger struct {
 
 var DefaultLogger Logger
 
+// DefaultLevel is the level of the logs when no other is configured
+const DefaultLevel = "info"
+
+var ErrInvalidLevel = errors.New("the level should be debug, info, warn or error")
+
+// level is the minimum level of the lines written, it can be changed at runtime by SetLevel
+var level = zap.NewAtomicLevelAt(zapcore.InfoLevel)
+
+// DefaultSamplingInitial and DefaultSamplingThereafter are the sampling of the identical lines when no other is
+// configured: the first 100 lines with the same level and message of each second are written, and then every 100th
+const (
+	DefaultSamplingInitial    = 100
+	DefaultSamplingThereafter = 100
+)
+
+// sampling of the lines of DefaultLogger, it is nil when the lines are not sampled
+var sampling = &zap.SamplingConfig{Initial: DefaultSamplingInitial, Thereafter: DefaultSamplingThereafter}
+
+// RequestIDKey is the context key of the id of the request, a string so it can be set on gin contexts
+const RequestIDKey = "request_id"
+
 func Error(ctx context.Context, msg string, fields ...Field) {
-	getLogger(ctx).Error(msg, fields...)
+	getLogger(ctx).Error(msg, withContext(ctx, fields)...)
 }
 
 func Info(ctx context.Context, msg string, fields ...Field) {
-	getLogger(ctx).Info(msg, fields...)
+	getLogger(ctx).Info(msg, withContext(ctx, fields)...)
+}
+
+// withContext add the ids of the current span of the context to the fields, so the log lines can be found from the
+// traces
+func withContext(ctx context.Context, fields []Field) []Field {
+	if span := tracing.FromContext(ctx); span != nil {
+		fields = append(fields, String("trace_id", span.TraceID()), String("span_id", span.SpanID()))
+	}
+
+	return fields
 }
 
-type logCtxKey struct{}
+// LoggerKey is the context key of the logger of the request, a string so it can be set on gin contexts
+const LoggerKey = "logger"
+
+// With return a logger which writes the received fields on every line, as the correlation fields of a request
+func With(l Logger, fields ...Field) Logger {
+	if zapLogger, ok := l.(*logger); ok {
+		return &logger{Logger: zapLogger.With(fields...)}
+	}
+
+	return fieldsLogger{Logger: l, fields: fields}
+}
+
+// fieldsLogger add its fields to the lines of a Logger which is not a zap one
+type fieldsLogger struct {
+	Logger
+	fields []Field
+}
+
+func (l fieldsLogger) Error(msg string, fields ...Field) {
+	l.Logger.Error(msg, append(append([]Field{}, l.fields...), fields...)...)
+}
+
+func (l fieldsLogger) Info(msg string, fields ...Field) {
+	l.Logger.Info(msg, append(append([]Field{}, l.fields...), fields...)...)
+}
+
+// FromContext return the logger of the context, DefaultLogger when there is none
+func FromContext(ctx context.Context) Logger {
+	return getLogger(ctx)
+}
 
 func getLogger(ctx context.Context) Logger {
-	l, ok := ctx.Value(logCtxKey{}).(Logger)
+	l, ok := ctx.Value(LoggerKey).(Logger)
 	if ok {
 		return l
 	}
@@ -54,15 +117,68 @@ func getLogger(ctx context.Context) Logger {
 	return DefaultLogger
 }
 
-func getZapConfig() zap.Config {
+// SetLevel change the minimum level of the lines written (debug, info, warn or error), the loggers already built
+// use it too
+func SetLevel(name string) error {
+	var l zapcore.Level
+	if err := l.UnmarshalText([]byte(name)); err != nil || l < zapcore.DebugLevel || l > zapcore.ErrorLevel {
+		return ErrInvalidLevel
+	}
+
+	level.SetLevel(l)
+	return nil
+}
+
+// SetSampling change how many lines with the same level and message are written each second: the first initial ones
+// and then every thereafter-th. An initial of 0 writes every line. DefaultLogger is built again with it
+func SetSampling(initial, thereafter int) {
+	sampling = nil
+	if initial > 0 {
+		if thereafter <= 0 {
+			thereafter = DefaultSamplingThereafter
+		}
+		sampling = &zap.SamplingConfig{Initial: initial, Thereafter: thereafter}
+	}
+
+	DefaultLogger = nil
+}
+
+// Level return the minimum level of the lines written
+func Level() string {
+	return level.Level().String()
+}
+
+// NewUnsampled return a JSON logger which writes every line of info level and above on w, whatever the level and
+// sampling of DefaultLogger are, for the lines which cannot be lost (as the audit ones)
+func NewUnsampled(w io.Writer) Logger {
+	core := zapcore.NewCore(zapcore.NewJSONEncoder(getEncoderConfig()), zapcore.Lock(zapcore.AddSync(w)),
+		zapcore.InfoLevel)
+
+	return &logger{Logger: zap.New(core)}
+}
+
+func getEncoderConfig() zapcore.EncoderConfig {
 	encoderConfig := zap.NewProductionEncoderConfig()
 	encoderConfig.EncodeTime = zapcore.ISO8601TimeEncoder
 	encoderConfig.EncodeLevel = zapcore.CapitalLevelEncoder
+
+	return encoderConfig
+}
+
+func getZapConfig() zap.Config {
+	encoderConfig := getEncoderConfig()
+
+	outputs := []string{"stdout"}
+	if file != nil {
+		outputs = append(outputs, fileSinkScheme+":")
+	}
+
 	return zap.Config{
 		Encoding:          "json",
 		EncoderConfig:     encoderConfig,
-		Level:             zap.NewAtomicLevelAt(zapcore.DebugLevel),
-		OutputPaths:       []string{"stdout"},
+		Level:             level,
+		Sampling:          sampling,
+		OutputPaths:       outputs,
 		DisableStacktrace: true,
 		DisableCaller:     true,
 	}
@@ -0,0 +1,64 @@
+package log
+
+import (
+	"bytes"
+	"github.com/stretchr/testify/assert"
+	"go.uber.org/zap"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// memorySink is a zap sink keeping the lines written, to read the lines of the loggers built from getZapConfig
+type memorySink struct {
+	bytes.Buffer
+}
+
+func (s *memorySink) Sync() error  { return nil }
+func (s *memorySink) Close() error { return nil }
+
+var memory = &memorySink{}
+
+func init() {
+	_ = zap.RegisterSink("memory", func(*url.URL) (zap.Sink, error) {
+		return memory, nil
+	})
+}
+
+func Test_sampling(t *testing.T) {
+	defer SetSampling(DefaultSamplingInitial, DefaultSamplingThereafter)
+	memory.Reset()
+
+	// the first 2 identical lines are written and then every 3rd
+	SetSampling(2, 3)
+	config := getZapConfig()
+	config.OutputPaths = []string{"memory:"}
+	l, err := config.Build()
+	assert.Nil(t, err)
+
+	for i := 0; i < 8; i++ {
+		l.Error("there was an error validating the travel")
+	}
+	l.Error("there was an error getting the user")
+	l.Info("there was an error validating the travel")
+
+	lines := strings.Split(strings.TrimSpace(memory.String()), "\n")
+	assert.Len(t, lines, 6)
+	// the 1st, 2nd, 5th and 8th errors and the info line, which has another level
+	assert.Equal(t, 5, strings.Count(memory.String(), "there was an error validating the travel"))
+	assert.Equal(t, 1, strings.Count(memory.String(), "there was an error getting the user"))
+	assert.Equal(t, 1, strings.Count(memory.String(), `"level":"INFO"`))
+
+	// without sampling every line is written
+	memory.Reset()
+	SetSampling(0, 0)
+	config = getZapConfig()
+	config.OutputPaths = []string{"memory:"}
+	l, err = config.Build()
+	assert.Nil(t, err)
+
+	for i := 0; i < 8; i++ {
+		l.Error("there was an error validating the travel")
+	}
+	assert.Equal(t, 8, strings.Count(memory.String(), "there was an error validating the travel"))
+}
@@ -0,0 +1,53 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LatencyBuckets are the upper bounds (in seconds) of the buckets of the latency histograms, finer under a second so
+// the p95 and p99 of the requests can be computed with them
+var LatencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.075, 0.1, 0.15, 0.2, 0.3, 0.5, 0.75, 1, 1.5, 2.5, 5, 10}
+
+// Latency observe the duration on the histogram of the metric, in seconds. Unlike Timing it is always a histogram,
+// so its percentiles (as p95 or p99) can be computed from its buckets
+func Latency(ctx context.Context, name string, value time.Duration, tags []string) {
+	Histogram(ctx, name, value.Seconds(), tags)
+}
+
+// Since observe the time elapsed since start on the latency histogram of the metric, see Latency
+func Since(ctx context.Context, name string, start time.Time, tags []string) {
+	Latency(ctx, name, time.Since(start), tags)
+}
+
+// ParseBuckets return the buckets of the histograms by metric name of the received settings, each one a metric name
+// with the upper bounds of its buckets separated by spaces, as application.space.api.latency=0.05 0.1 0.5 1
+func ParseBuckets(settings []string) (map[string][]float64, error) {
+	buckets := make(map[string][]float64, len(settings))
+	for _, setting := range settings {
+		parts := strings.SplitN(setting, "=", 2)
+		name := strings.TrimSpace(parts[0])
+		if len(parts) != 2 || name == "" {
+			return nil, fmt.Errorf("invalid buckets %s: they should be a metric name with its buckets, as "+
+				"application.space.api.latency=0.05 0.1 0.5 1", setting)
+		}
+
+		bounds := strings.Fields(parts[1])
+		if len(bounds) == 0 {
+			return nil, fmt.Errorf("invalid buckets of %s: there are no buckets", name)
+		}
+
+		for _, bound := range bounds {
+			value, err := strconv.ParseFloat(bound, 64)
+			if err != nil {
+				return nil, fmt.Errorf("invalid bucket %s of %s: it should be a number", bound, name)
+			}
+			buckets[name] = append(buckets[name], value)
+		}
+	}
+
+	return buckets, nil
+}
@@ -0,0 +1,61 @@
+package metrics
+
+import (
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_parseBuckets(t *testing.T) {
+	testscases := map[string]struct {
+		settings  []string
+		want      map[string][]float64
+		wantError error
+	}{
+		"successful without settings": {
+			want: map[string][]float64{},
+		},
+		"successful buckets of two metrics": {
+			settings: []string{
+				"application.space.api.latency=0.05 0.1 0.5 1",
+				" application.space.travel.distance =  1  10 100 ",
+			},
+			want: map[string][]float64{
+				"application.space.api.latency":     {0.05, 0.1, 0.5, 1},
+				"application.space.travel.distance": {1, 10, 100},
+			},
+		},
+		"invalid without buckets": {
+			settings: []string{"application.space.api.latency"},
+			wantError: errors.New("invalid buckets application.space.api.latency: they should be a metric name " +
+				"with its buckets, as application.space.api.latency=0.05 0.1 0.5 1"),
+		},
+		"invalid without name": {
+			settings: []string{" =0.05 0.1"},
+			wantError: errors.New("invalid buckets  =0.05 0.1: they should be a metric name with its buckets, as " +
+				"application.space.api.latency=0.05 0.1 0.5 1"),
+		},
+		"invalid empty buckets": {
+			settings:  []string{"application.space.api.latency= "},
+			wantError: errors.New("invalid buckets of application.space.api.latency: there are no buckets"),
+		},
+		"invalid bucket which is not a number": {
+			settings:  []string{"application.space.api.latency=0.05 fast 1"},
+			wantError: errors.New("invalid bucket fast of application.space.api.latency: it should be a number"),
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			buckets, err := ParseBuckets(tc.settings)
+
+			if tc.wantError != nil {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.wantError.Error(), err.Error())
+				return
+			}
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, buckets)
+		})
+	}
+}
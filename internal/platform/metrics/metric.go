@@ -5,7 +5,11 @@ import (
 	"time"
 )
 
-var DefaultTracer = client{}
+// noop discard the metrics traced with a context without collector
+var noop Collector = client{}
+
+// CollectorKey is the context key of the Collector of the requests, a string so it can be set on gin contexts
+const CollectorKey = "metrics_collector"
 
 func Inc(ctx context.Context, name string, tags []string) {
 	getClient(ctx).Inc(name, tags)
@@ -29,13 +33,22 @@ func Histogram(ctx context.Context, name string, value float64, tags []string) {
 
 type collectorCtxKey struct{}
 
+// WithCollector return a copy of the context with the received collector, the metrics traced with it are collected
+// by it
+func WithCollector(ctx context.Context, collector Collector) context.Context {
+	return context.WithValue(ctx, collectorCtxKey{}, collector)
+}
+
 func getClient(ctx context.Context) Collector {
-	// it should exist a middleware where the collector is inyected into context, then application can trace without
-	// using DefaultTracer
-	l, ok := ctx.Value(collectorCtxKey{}).(Collector)
-	if ok {
+	// the collector is inyected into context by WithCollector (as the workers) or by a middleware with CollectorKey (as
+	// the requests), the metrics traced without it are discarded
+	if l, ok := ctx.Value(collectorCtxKey{}).(Collector); ok {
+		return l
+	}
+
+	if l, ok := ctx.Value(CollectorKey).(Collector); ok {
 		return l
 	}
 
-	return DefaultTracer
+	return noop
 }
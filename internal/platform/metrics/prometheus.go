@@ -0,0 +1,282 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultBuckets are the upper bounds of the histogram buckets when no others are configured, the timings are
+// observed in seconds
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+const (
+	typeCounter   = "counter"
+	typeGauge     = "gauge"
+	typeHistogram = "histogram"
+)
+
+// Prometheus is a Collector that keeps the metrics in memory and exposes them on the Prometheus text format. The
+// names are converted to Prometheus names (application.space.api.count as application_space_api_count) and the tags
+// (key, value pairs) to labels: Inc and Count are counters (with the _total suffix), Gauge are gauges, and Timing
+// (in seconds, with the _seconds suffix) and Histogram are histograms. The histograms have the buckets set for their
+// metric with SetBuckets, or the default ones. It is safe for concurrent use
+type Prometheus struct {
+	mu       sync.Mutex
+	buckets  []float64
+	families map[string]*family
+	// metricBuckets are the buckets set for the histograms of each metric, by the name of the metric
+	metricBuckets map[string][]float64
+}
+
+// family are the series of a metric by their labels
+type family struct {
+	metricType string
+	series     map[string]*series
+	// buckets are the upper bounds of the buckets of the series, only of histograms
+	buckets []float64
+}
+
+type series struct {
+	labels string
+	value  float64
+	// counts are the observations of each bucket (not cumulative) and sum their sum, only of histograms
+	counts []uint64
+	count  uint64
+	sum    float64
+}
+
+// NewPrometheus creates and return a Prometheus collector whose histograms have the received buckets, or
+// DefaultBuckets if none is received
+func NewPrometheus(buckets ...float64) *Prometheus {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+
+	return &Prometheus{
+		buckets:       sortBuckets(buckets),
+		families:      make(map[string]*family),
+		metricBuckets: make(map[string][]float64),
+	}
+}
+
+// SetBuckets change the buckets of the histograms of the metric with the received name (as
+// application.space.api.latency), its Timing and Histogram observations. It should be set on start, as the series
+// already observed keep their buckets
+func (p *Prometheus) SetBuckets(name string, buckets ...float64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(buckets) == 0 {
+		delete(p.metricBuckets, name)
+		return
+	}
+
+	p.metricBuckets[name] = sortBuckets(buckets)
+}
+
+// sortBuckets return a sorted copy of the buckets, so the received ones can still be changed by the caller
+func sortBuckets(buckets []float64) []float64 {
+	sorted := append([]float64(nil), buckets...)
+	sort.Float64s(sorted)
+
+	return sorted
+}
+
+func (p *Prometheus) Inc(name string, tags []string) {
+	p.Count(name, 1, tags)
+}
+
+func (p *Prometheus) Count(name string, value int64, tags []string) {
+	p.with(metricName(name)+"_total", typeCounter, tags, func(_ *family, s *series) {
+		s.value += float64(value)
+	})
+}
+
+func (p *Prometheus) Gauge(name string, value float64, tags []string) {
+	p.with(metricName(name), typeGauge, tags, func(_ *family, s *series) {
+		s.value = value
+	})
+}
+
+func (p *Prometheus) Timing(name string, value time.Duration, tags []string) {
+	p.observe(name, metricName(name)+"_seconds", value.Seconds(), tags)
+}
+
+func (p *Prometheus) Histogram(name string, value float64, tags []string) {
+	p.observe(name, metricName(name), value, tags)
+}
+
+// observe add the value to the histogram of the metric, with the buckets of the metric name as it was received
+func (p *Prometheus) observe(name, histogramName string, value float64, tags []string) {
+	p.with(histogramName, typeHistogram, tags, func(f *family, s *series) {
+		if f.buckets == nil {
+			f.buckets = p.buckets
+			if buckets, ok := p.metricBuckets[name]; ok {
+				f.buckets = buckets
+			}
+		}
+		if s.counts == nil {
+			s.counts = make([]uint64, len(f.buckets))
+		}
+		for i, bound := range f.buckets {
+			if value <= bound {
+				s.counts[i]++
+				break
+			}
+		}
+		s.count++
+		s.sum += value
+	})
+}
+
+// with run update on the series of the metric with the labels of the tags, a metric already collected with another
+// type is ignored
+func (p *Prometheus) with(name, metricType string, tags []string, update func(f *family, s *series)) {
+	labels := formatLabels(tags)
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	f, ok := p.families[name]
+	if !ok {
+		f = &family{metricType: metricType, series: make(map[string]*series)}
+		p.families[name] = f
+	}
+	if f.metricType != metricType {
+		return
+	}
+
+	s, ok := f.series[labels]
+	if !ok {
+		s = &series{labels: labels}
+		f.series[labels] = s
+	}
+
+	update(f, s)
+}
+
+// Handler return the http handler which answers the metrics collected on the Prometheus text format, sorted by name
+// and labels
+func (p *Prometheus) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+
+		out := bufio.NewWriter(w)
+		p.write(out)
+		_ = out.Flush()
+	})
+}
+
+func (p *Prometheus) write(out *bufio.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	names := make([]string, 0, len(p.families))
+	for name := range p.families {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		f := p.families[name]
+		fmt.Fprintf(out, "# TYPE %s %s\n", name, f.metricType)
+
+		keys := make([]string, 0, len(f.series))
+		for key := range f.series {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			s := f.series[key]
+			if f.metricType != typeHistogram {
+				fmt.Fprintf(out, "%s%s %s\n", name, wrapLabels(s.labels), formatValue(s.value))
+				continue
+			}
+
+			var cumulative uint64
+			for i, bound := range f.buckets {
+				cumulative += s.counts[i]
+				fmt.Fprintf(out, "%s_bucket%s %d\n", name,
+					wrapLabels(joinLabels(s.labels, `le="`+formatValue(bound)+`"`)), cumulative)
+			}
+			fmt.Fprintf(out, "%s_bucket%s %d\n", name, wrapLabels(joinLabels(s.labels, `le="+Inf"`)), s.count)
+			fmt.Fprintf(out, "%s_sum%s %s\n", name, wrapLabels(s.labels), formatValue(s.sum))
+			fmt.Fprintf(out, "%s_count%s %d\n", name, wrapLabels(s.labels), s.count)
+		}
+	}
+}
+
+// metricName return the Prometheus name of a metric, the characters which are not letters, digits, _ nor : are
+// replaced with _
+func metricName(name string) string {
+	return sanitize(name, true)
+}
+
+// formatLabels return the labels of the tags (key, value pairs) sorted by key, as key="value" comma separated
+func formatLabels(tags []string) string {
+	labels := make([]string, 0, len(tags)/2)
+	for i := 0; i+1 < len(tags); i += 2 {
+		labels = append(labels, sanitize(tags[i], false)+`="`+escapeLabel(tags[i+1])+`"`)
+	}
+	sort.Strings(labels)
+
+	return strings.Join(labels, ",")
+}
+
+func joinLabels(labels, label string) string {
+	if labels == "" {
+		return label
+	}
+
+	return labels + "," + label
+}
+
+func wrapLabels(labels string) string {
+	if labels == "" {
+		return ""
+	}
+
+	return "{" + labels + "}"
+}
+
+// sanitize replace the characters which are not valid on Prometheus names with _, colons are only valid on metric
+// names and a name cannot start with a digit
+func sanitize(name string, allowColon bool) string {
+	var b strings.Builder
+	for i, r := range name {
+		valid := r == '_' || (r >= 'a' && r <= 'z') || (r >= 'A' && r <= 'Z') || (r >= '0' && r <= '9' && i > 0) ||
+			(r == ':' && allowColon)
+		if valid {
+			b.WriteRune(r)
+		} else {
+			b.WriteRune('_')
+		}
+	}
+
+	return b.String()
+}
+
+func escapeLabel(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return strings.ReplaceAll(value, `"`, `\"`)
+}
+
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	}
+
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
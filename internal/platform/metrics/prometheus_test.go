@@ -0,0 +1,102 @@
+package metrics
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func Test_prometheusHandler(t *testing.T) {
+	p := NewPrometheus(0.5, 0.125, 0.25)
+
+	p.Inc("application.space.api.count", []string{"status", "200", "endpoint", "/travels"})
+	p.Count("application.space.api.count", 3, []string{"endpoint", "/travels", "status", "200"})
+	p.Inc("application.space.api.count", []string{"endpoint", "/users", "status", "500"})
+	p.Inc("application.space.jobs.count", nil)
+	p.Gauge("application.space.workers", 2, []string{"worker", "archive"})
+	p.Gauge("application.space.workers", 3, []string{"worker", "archive"})
+	p.Timing("application.space.api.time", 250*time.Millisecond, []string{"endpoint", "/travels"})
+	p.Timing("application.space.api.time", 125*time.Millisecond, []string{"endpoint", "/travels"})
+	p.Histogram("application.space.travel.distance", 200, nil)
+
+	// the names and labels are converted to valid ones and the label values escaped
+	p.Inc("1st-metric", []string{"user.role", "a \"quoted\"\nrole"})
+
+	// a metric already collected with another type is ignored
+	p.Gauge("application.space.api.count.total", 1, nil)
+
+	rec := httptest.NewRecorder()
+	p.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "text/plain; version=0.0.4; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `# TYPE _st_metric_total counter
+_st_metric_total{user_role="a \"quoted\"\nrole"} 1
+# TYPE application_space_api_count_total counter
+application_space_api_count_total{endpoint="/travels",status="200"} 4
+application_space_api_count_total{endpoint="/users",status="500"} 1
+# TYPE application_space_api_time_seconds histogram
+application_space_api_time_seconds_bucket{endpoint="/travels",le="0.125"} 1
+application_space_api_time_seconds_bucket{endpoint="/travels",le="0.25"} 2
+application_space_api_time_seconds_bucket{endpoint="/travels",le="0.5"} 2
+application_space_api_time_seconds_bucket{endpoint="/travels",le="+Inf"} 2
+application_space_api_time_seconds_sum{endpoint="/travels"} 0.375
+application_space_api_time_seconds_count{endpoint="/travels"} 2
+# TYPE application_space_jobs_count_total counter
+application_space_jobs_count_total 1
+# TYPE application_space_travel_distance histogram
+application_space_travel_distance_bucket{le="0.125"} 0
+application_space_travel_distance_bucket{le="0.25"} 0
+application_space_travel_distance_bucket{le="0.5"} 0
+application_space_travel_distance_bucket{le="+Inf"} 1
+application_space_travel_distance_sum 200
+application_space_travel_distance_count 1
+# TYPE application_space_workers gauge
+application_space_workers{worker="archive"} 3
+`, rec.Body.String())
+}
+
+func Test_prometheusBuckets(t *testing.T) {
+	p := NewPrometheus(1, 2)
+
+	// the buckets are set by the name of the metric as received, sorted and copied
+	latency := []float64{0.5, 0.1}
+	p.SetBuckets("application.space.api.latency", latency...)
+	latency[0] = 10
+	p.SetBuckets("application.space.api.time", 0.25)
+	p.SetBuckets("application.space.api.time")
+
+	p.Histogram("application.space.api.latency", 0.2, nil)
+	p.Timing("application.space.api.time", 1500*time.Millisecond, nil)
+	p.Histogram("application.space.travel.distance", 3, nil)
+
+	rec := httptest.NewRecorder()
+	p.Handler().ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/metrics", nil))
+
+	assert.Equal(t, `# TYPE application_space_api_latency histogram
+application_space_api_latency_bucket{le="0.1"} 0
+application_space_api_latency_bucket{le="0.5"} 1
+application_space_api_latency_bucket{le="+Inf"} 1
+application_space_api_latency_sum 0.2
+application_space_api_latency_count 1
+# TYPE application_space_api_time_seconds histogram
+application_space_api_time_seconds_bucket{le="1"} 0
+application_space_api_time_seconds_bucket{le="2"} 1
+application_space_api_time_seconds_bucket{le="+Inf"} 1
+application_space_api_time_seconds_sum 1.5
+application_space_api_time_seconds_count 1
+# TYPE application_space_travel_distance histogram
+application_space_travel_distance_bucket{le="1"} 0
+application_space_travel_distance_bucket{le="2"} 0
+application_space_travel_distance_bucket{le="+Inf"} 1
+application_space_travel_distance_sum 3
+application_space_travel_distance_count 1
+`, rec.Body.String())
+
+	// the series already observed keep their buckets
+	p.SetBuckets("application.space.travel.distance", 5)
+	p.Histogram("application.space.travel.distance", 3, []string{"zone", "mars"})
+	assert.Equal(t, []float64{1, 2}, p.families["application_space_travel_distance"].buckets)
+}
@@ -0,0 +1,83 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"runtime"
+	"sort"
+	"time"
+)
+
+const (
+	goroutinesMetric    = "application.space.runtime.goroutines"
+	heapMetric          = "application.space.runtime.heap_bytes"
+	gcCountMetric       = "application.space.runtime.gc_count"
+	gcPauseMetric       = "application.space.runtime.gc_pause"
+	dbConnectionsMetric = "application.space.db.connections"
+	dbWaitsMetric       = "application.space.db.waits"
+)
+
+// DBStatser is a pool of db connections which stats are reported by ReportRuntimeEvery, as a sql.DB
+type DBStatser interface {
+	Stats() sql.DBStats
+}
+
+// ReportRuntimeEvery emit the runtime metrics every interval, until the context is done: the goroutines, the heap
+// (allocated, in use and obtained from the system), the garbage collections and their pause since the previous
+// report, and the connections of each db pool (open, in use and idle) with the connections waited for. It is meant
+// to be run on its own goroutine
+func ReportRuntimeEvery(ctx context.Context, interval time.Duration, pools map[string]DBStatser) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	reporter := runtimeReporter{pools: pools, waits: make(map[string]int64, len(pools))}
+	for {
+		reporter.report(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// runtimeReporter keep the counters of the previous report, so the counts reported are the ones since it
+type runtimeReporter struct {
+	pools map[string]DBStatser
+
+	numGC      uint32
+	pauseTotal uint64
+	waits      map[string]int64
+}
+
+func (r *runtimeReporter) report(ctx context.Context) {
+	Gauge(ctx, goroutinesMetric, float64(runtime.NumGoroutine()), nil)
+
+	var mem runtime.MemStats
+	runtime.ReadMemStats(&mem)
+	Gauge(ctx, heapMetric, float64(mem.HeapAlloc), []string{"kind", "alloc"})
+	Gauge(ctx, heapMetric, float64(mem.HeapInuse), []string{"kind", "in_use"})
+	Gauge(ctx, heapMetric, float64(mem.HeapSys), []string{"kind", "sys"})
+
+	Count(ctx, gcCountMetric, int64(mem.NumGC-r.numGC), nil)
+	Timing(ctx, gcPauseMetric, time.Duration(mem.PauseTotalNs-r.pauseTotal), nil)
+	r.numGC, r.pauseTotal = mem.NumGC, mem.PauseTotalNs
+
+	// sorted, so the metrics are reported on the same order every time
+	names := make([]string, 0, len(r.pools))
+	for name := range r.pools {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		stats := r.pools[name].Stats()
+		Gauge(ctx, dbConnectionsMetric, float64(stats.OpenConnections), []string{"repository", name, "state", "open"})
+		Gauge(ctx, dbConnectionsMetric, float64(stats.InUse), []string{"repository", name, "state", "in_use"})
+		Gauge(ctx, dbConnectionsMetric, float64(stats.Idle), []string{"repository", name, "state", "idle"})
+
+		Count(ctx, dbWaitsMetric, stats.WaitCount-r.waits[name], []string{"repository", name})
+		r.waits[name] = stats.WaitCount
+	}
+}
@@ -0,0 +1,106 @@
+package secrets
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/platform/sigv4"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	awsService     = "secretsmanager"
+	awsTarget      = "secretsmanager.GetSecretValue"
+	awsContentType = "application/x-amz-json-1.1"
+)
+
+// AWSProvider is a SecretProvider that gets the secrets from the keys of a JSON secret of AWS Secrets Manager,
+// requests are signed with AWS signature version 4
+type AWSProvider struct {
+	secretID        string
+	region          string
+	accessKeyID     string
+	secretAccessKey string
+	// sessionToken is the token of temporary credentials, it is empty for the credentials of an user
+	sessionToken string
+
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewAWSProvider creates and return an AWSProvider getting the secrets from the keys of the secret with the received
+// id (name or ARN), using the received credentials
+func NewAWSProvider(secretID, region, accessKeyID, secretAccessKey, sessionToken string) AWSProvider {
+	return AWSProvider{
+		secretID:        secretID,
+		region:          region,
+		accessKeyID:     accessKeyID,
+		secretAccessKey: secretAccessKey,
+		sessionToken:    sessionToken,
+		client:          &http.Client{Timeout: 10 * time.Second},
+		now:             time.Now,
+	}
+}
+
+// Secret return the key with the received name of the JSON secret
+func (provider AWSProvider) Secret(ctx context.Context, name string) (string, error) {
+	content, err := json.Marshal(map[string]string{"SecretId": provider.secretID})
+	if err != nil {
+		return "", err
+	}
+
+	host := fmt.Sprintf("%s.%s.amazonaws.com", awsService, provider.region)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, "https://"+host+"/", bytes.NewReader(content))
+	if err != nil {
+		return "", err
+	}
+
+	req.Header.Set("Content-Type", awsContentType)
+	req.Header.Set("X-Amz-Target", awsTarget)
+	sigv4.Sign(req, content, awsService, provider.region, sigv4.Credentials{
+		AccessKeyID:     provider.accessKeyID,
+		SecretAccessKey: provider.secretAccessKey,
+		SessionToken:    provider.sessionToken,
+	}, provider.now())
+
+	resp, err := provider.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		if strings.Contains(string(body), "ResourceNotFoundException") {
+			return "", ErrSecretNotFound
+		}
+		return "", fmt.Errorf("aws get secret %s failed with status %d: %s", provider.secretID, resp.StatusCode, body)
+	}
+
+	var secret struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := json.Unmarshal(body, &secret); err != nil {
+		return "", fmt.Errorf("cannot decode aws secret %s: %w", provider.secretID, err)
+	}
+
+	var values map[string]string
+	if err := json.Unmarshal([]byte(secret.SecretString), &values); err != nil {
+		return "", fmt.Errorf("the aws secret %s is not a JSON object of strings: %w", provider.secretID, err)
+	}
+
+	value, ok := values[name]
+	if !ok || value == "" {
+		return "", ErrSecretNotFound
+	}
+
+	return value, nil
+}
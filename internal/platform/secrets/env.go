@@ -0,0 +1,19 @@
+package secrets
+
+import (
+	"context"
+	"os"
+)
+
+// EnvProvider is a SecretProvider that gets the secrets from the environment variables with their name
+type EnvProvider struct{}
+
+// Secret return the environment variable with the received name, ErrSecretNotFound if it is not configured
+func (provider EnvProvider) Secret(ctx context.Context, name string) (string, error) {
+	value := os.Getenv(name)
+	if value == "" {
+		return "", ErrSecretNotFound
+	}
+
+	return value, nil
+}
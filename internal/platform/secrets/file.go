@@ -0,0 +1,44 @@
+package secrets
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// FileProvider is a SecretProvider that gets each secret from the file with its name on a directory, as the secrets
+// mounted by docker or kubernetes
+type FileProvider struct {
+	dir string
+}
+
+// NewFileProvider creates and return a FileProvider getting the secrets from the files of the received directory
+func NewFileProvider(dir string) FileProvider {
+	return FileProvider{
+		dir: dir,
+	}
+}
+
+// Secret return the content of the file with the received name, without surrounding spaces and new lines
+func (provider FileProvider) Secret(ctx context.Context, name string) (string, error) {
+	if name == "" || strings.ContainsAny(name, `/\`) {
+		return "", ErrSecretNotFound
+	}
+
+	content, err := ioutil.ReadFile(filepath.Join(provider.dir, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", ErrSecretNotFound
+		}
+		return "", err
+	}
+
+	value := strings.TrimSpace(string(content))
+	if value == "" {
+		return "", ErrSecretNotFound
+	}
+
+	return value, nil
+}
@@ -0,0 +1,115 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"sync"
+	"time"
+)
+
+const refreshMetricName = "application.space.secrets.refresh"
+
+var ErrSecretNotFound = errors.New("the secret is not found")
+
+// SecretProvider get the secrets (as the jwt keys and the db password) by name from where they are stored
+type SecretProvider interface {
+	// Secret return the secret with the received name, ErrSecretNotFound if the provider does not have it
+	Secret(ctx context.Context, name string) (string, error)
+}
+
+// Cache is a SecretProvider that keeps the secrets got from another provider, so they are not got on every use, and
+// refresh them with RefreshEvery. The secrets which the provider does not have are kept too. It is safe for
+// concurrent use
+type Cache struct {
+	mu       sync.RWMutex
+	provider SecretProvider
+	values   map[string]cachedSecret
+}
+
+type cachedSecret struct {
+	value string
+	found bool
+}
+
+// NewCache creates and return a Cache of the secrets of the received provider
+func NewCache(provider SecretProvider) *Cache {
+	return &Cache{
+		provider: provider,
+		values:   make(map[string]cachedSecret),
+	}
+}
+
+// Secret return the secret with the received name from the cache, or from the provider the first time it is got
+func (c *Cache) Secret(ctx context.Context, name string) (string, error) {
+	c.mu.RLock()
+	cached, ok := c.values[name]
+	c.mu.RUnlock()
+	if !ok {
+		var err error
+		cached, err = c.get(ctx, name)
+		if err != nil {
+			log.Error(ctx, "there was an error getting secret", log.String("name", name), log.Err(err))
+			return "", err
+		}
+	}
+
+	if !cached.found {
+		return "", ErrSecretNotFound
+	}
+
+	return cached.value, nil
+}
+
+// get the secret with the received name from the provider and keep it, the errors other than ErrSecretNotFound are
+// not kept so it is got again on its next use
+func (c *Cache) get(ctx context.Context, name string) (cachedSecret, error) {
+	value, err := c.provider.Secret(ctx, name)
+	if err != nil && !errors.Is(err, ErrSecretNotFound) {
+		return cachedSecret{}, err
+	}
+
+	cached := cachedSecret{value: value, found: err == nil}
+	c.mu.Lock()
+	c.values[name] = cached
+	c.mu.Unlock()
+
+	return cached, nil
+}
+
+// RefreshEvery get again the cached secrets from the provider each interval until the context is done, so the
+// secrets rotated on the provider are used without a restart
+func (c *Cache) RefreshEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			c.refresh(ctx)
+		}
+	}
+}
+
+// refresh get again the cached secrets, a secret which cannot be got keeps its previous value
+func (c *Cache) refresh(ctx context.Context) {
+	c.mu.RLock()
+	names := make([]string, 0, len(c.values))
+	for name := range c.values {
+		names = append(names, name)
+	}
+	c.mu.RUnlock()
+
+	for _, name := range names {
+		if _, err := c.get(ctx, name); err != nil {
+			log.Error(ctx, "there was an error refreshing secret", log.String("name", name), log.Err(err))
+			metrics.Inc(ctx, refreshMetricName, []string{"result", "error"})
+			continue
+		}
+
+		metrics.Inc(ctx, refreshMetricName, []string{"result", "success"})
+	}
+}
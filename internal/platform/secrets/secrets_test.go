@@ -0,0 +1,214 @@
+package secrets
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_envProvider(t *testing.T) {
+	_ = os.Setenv("SECRETS_TEST_JWT_SECRET", "a-secret")
+	defer os.Unsetenv("SECRETS_TEST_JWT_SECRET")
+
+	value, err := EnvProvider{}.Secret(context.Background(), "SECRETS_TEST_JWT_SECRET")
+	assert.Nil(t, err)
+	assert.Equal(t, "a-secret", value)
+
+	_, err = EnvProvider{}.Secret(context.Background(), "SECRETS_TEST_NOT_CONFIGURED")
+	assert.Equal(t, ErrSecretNotFound, err)
+}
+
+func Test_fileProvider(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "DB_PASSWORD"), []byte(" a-password\n"), 0600))
+	assert.Nil(t, ioutil.WriteFile(filepath.Join(dir, "EMPTY"), []byte("\n"), 0600))
+	provider := NewFileProvider(dir)
+
+	testscases := map[string]struct {
+		name      string
+		want      string
+		wantError error
+	}{
+		"successful secret without surrounding spaces": {name: "DB_PASSWORD", want: "a-password"},
+		"not found missing file":                       {name: "JWT_SECRET", wantError: ErrSecretNotFound},
+		"not found empty file":                         {name: "EMPTY", wantError: ErrSecretNotFound},
+		"not found name with a path":                   {name: "../DB_PASSWORD", wantError: ErrSecretNotFound},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			value, err := provider.Secret(context.Background(), tc.name)
+			assert.Equal(t, tc.wantError, err)
+			assert.Equal(t, tc.want, value)
+		})
+	}
+}
+
+func Test_vaultProvider(t *testing.T) {
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/v1/secret/data/space-drivers", r.URL.Path)
+		if r.Header.Get("X-Vault-Token") != "a-token" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(`{"data": {"data": {"DB_PASSWORD": "a-password"}}}`))
+	}))
+	defer server.Close()
+
+	provider := NewVaultProvider(server.URL+"/", "a-token", "/secret/data/space-drivers/")
+
+	value, err := provider.Secret(context.Background(), "DB_PASSWORD")
+	assert.Nil(t, err)
+	assert.Equal(t, "a-password", value)
+
+	_, err = provider.Secret(context.Background(), "JWT_SECRET")
+	assert.Equal(t, ErrSecretNotFound, err)
+
+	status = http.StatusNotFound
+	_, err = provider.Secret(context.Background(), "DB_PASSWORD")
+	assert.Equal(t, ErrSecretNotFound, err)
+
+	_, err = NewVaultProvider(server.URL, "another-token", "secret/data/space-drivers").
+		Secret(context.Background(), "DB_PASSWORD")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "status 403")
+}
+
+func Test_awsProvider(t *testing.T) {
+	response := `{"SecretString": "{\"DB_PASSWORD\": \"a-password\"}"}`
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		assert.Equal(t, `{"SecretId":"space-drivers"}`, string(body))
+		assert.Equal(t, "secretsmanager.us-east-1.amazonaws.com", r.Host)
+		assert.Equal(t, "secretsmanager.GetSecretValue", r.Header.Get("X-Amz-Target"))
+		assert.Equal(t, "a-session-token", r.Header.Get("X-Amz-Security-Token"))
+		assert.True(t, strings.HasPrefix(r.Header.Get("Authorization"),
+			"AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20220301/us-east-1/secretsmanager/aws4_request, "+
+				"SignedHeaders=content-type;host;x-amz-date;x-amz-security-token;x-amz-target, Signature="))
+
+		w.WriteHeader(status)
+		_, _ = w.Write([]byte(response))
+	}))
+	defer server.Close()
+
+	// the requests to secrets manager are sent to the test server
+	serverURL, _ := url.Parse(server.URL)
+	provider := NewAWSProvider("space-drivers", "us-east-1", "AKIDEXAMPLE", "a-secret", "a-session-token")
+	provider.now = func() time.Time { return time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC) }
+	provider.client = &http.Client{Transport: rewriteTransport{url: serverURL, transport: http.DefaultTransport}}
+
+	value, err := provider.Secret(context.Background(), "DB_PASSWORD")
+	assert.Nil(t, err)
+	assert.Equal(t, "a-password", value)
+
+	_, err = provider.Secret(context.Background(), "JWT_SECRET")
+	assert.Equal(t, ErrSecretNotFound, err)
+
+	response = `{"SecretString": "not a JSON object"}`
+	_, err = provider.Secret(context.Background(), "DB_PASSWORD")
+	assert.NotNil(t, err)
+
+	status = http.StatusBadRequest
+	response = `{"__type": "ResourceNotFoundException"}`
+	_, err = provider.Secret(context.Background(), "DB_PASSWORD")
+	assert.Equal(t, ErrSecretNotFound, err)
+
+	response = `{"__type": "AccessDeniedException"}`
+	_, err = provider.Secret(context.Background(), "DB_PASSWORD")
+	assert.NotNil(t, err)
+	assert.Contains(t, err.Error(), "status 400")
+}
+
+// rewriteTransport send the requests to the url instead of their host, keeping their host header
+type rewriteTransport struct {
+	url       *url.URL
+	transport http.RoundTripper
+}
+
+func (r rewriteTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	req = req.Clone(req.Context())
+	req.Host = req.URL.Host
+	req.URL.Scheme = r.url.Scheme
+	req.URL.Host = r.url.Host
+
+	return r.transport.RoundTrip(req)
+}
+
+// countProvider is a SecretProvider with the secrets of its map, counting the secrets got
+type countProvider struct {
+	values map[string]string
+	err    error
+	gets   int
+}
+
+func (provider *countProvider) Secret(ctx context.Context, name string) (string, error) {
+	provider.gets++
+	if provider.err != nil {
+		return "", provider.err
+	}
+
+	value, ok := provider.values[name]
+	if !ok {
+		return "", ErrSecretNotFound
+	}
+
+	return value, nil
+}
+
+func Test_cache(t *testing.T) {
+	provider := &countProvider{values: map[string]string{"DB_PASSWORD": "a-password"}}
+	cache := NewCache(provider)
+
+	// the secrets, found or not, are got from the provider once
+	for i := 0; i < 2; i++ {
+		value, err := cache.Secret(context.Background(), "DB_PASSWORD")
+		assert.Nil(t, err)
+		assert.Equal(t, "a-password", value)
+
+		_, err = cache.Secret(context.Background(), "JWT_SECRET")
+		assert.Equal(t, ErrSecretNotFound, err)
+	}
+	assert.Equal(t, 2, provider.gets)
+
+	// the refresh gets the secrets rotated
+	provider.values["DB_PASSWORD"] = "a-rotated-password"
+	provider.values["JWT_SECRET"] = "a-secret"
+	cache.refresh(context.Background())
+
+	value, err := cache.Secret(context.Background(), "DB_PASSWORD")
+	assert.Nil(t, err)
+	assert.Equal(t, "a-rotated-password", value)
+	value, err = cache.Secret(context.Background(), "JWT_SECRET")
+	assert.Nil(t, err)
+	assert.Equal(t, "a-secret", value)
+
+	// a secret which cannot be refreshed keeps its value
+	provider.err = errors.New("mocked provider error")
+	cache.refresh(context.Background())
+
+	value, err = cache.Secret(context.Background(), "DB_PASSWORD")
+	assert.Nil(t, err)
+	assert.Equal(t, "a-rotated-password", value)
+
+	// and the errors are not kept, the secret is got again on its next use
+	_, err = cache.Secret(context.Background(), "ZONES_API_KEY")
+	assert.NotNil(t, err)
+	provider.err = nil
+	provider.values["ZONES_API_KEY"] = "a-key"
+	value, err = cache.Secret(context.Background(), "ZONES_API_KEY")
+	assert.Nil(t, err)
+	assert.Equal(t, "a-key", value)
+}
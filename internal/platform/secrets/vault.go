@@ -0,0 +1,72 @@
+package secrets
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// VaultProvider is a SecretProvider that gets the secrets from the fields of a secret of a HashiCorp Vault KV
+// version 2 engine, authenticated with a token
+type VaultProvider struct {
+	address string
+	token   string
+	path    string
+
+	client *http.Client
+}
+
+// NewVaultProvider creates and return a VaultProvider getting the secrets from the Vault on the received address, as
+// the fields of the secret on the path (as secret/data/space-drivers)
+func NewVaultProvider(address, token, path string) VaultProvider {
+	return VaultProvider{
+		address: strings.TrimSuffix(address, "/"),
+		token:   token,
+		path:    strings.Trim(path, "/"),
+		client:  &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Secret return the field with the received name of the Vault secret
+func (provider VaultProvider) Secret(ctx context.Context, name string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, provider.address+"/v1/"+provider.path, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("X-Vault-Token", provider.token)
+
+	resp, err := provider.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return "", ErrSecretNotFound
+	}
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("vault read secret %s failed with status %d: %s", provider.path, resp.StatusCode, body)
+	}
+
+	var secret struct {
+		Data struct {
+			Data map[string]string `json:"data"`
+		} `json:"data"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&secret); err != nil {
+		return "", fmt.Errorf("cannot decode vault secret %s: %w", provider.path, err)
+	}
+
+	value, ok := secret.Data.Data[name]
+	if !ok || value == "" {
+		return "", ErrSecretNotFound
+	}
+
+	return value, nil
+}
@@ -0,0 +1,137 @@
+package sigv4
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	dateLayout    = "20060102"
+	timeLayout    = "20060102T150405Z"
+	signAlgorithm = "AWS4-HMAC-SHA256"
+)
+
+// Credentials are the AWS credentials which sign the requests
+type Credentials struct {
+	AccessKeyID     string
+	SecretAccessKey string
+	// SessionToken is the token of temporary credentials, it is empty for the credentials of an user
+	SessionToken string
+}
+
+// Sign add to the request the headers of AWS signature version 4 for the service on the region, at the received
+// time. The host and every header already set on the request are signed, so the headers to sign (as Content-Type) are
+// set before. The path is signed as it is escaped, without escaping it again as the services other than S3 expect
+func Sign(req *http.Request, payload []byte, service, region string, credentials Credentials, now time.Time) {
+	now = now.UTC()
+	amzDate := now.Format(timeLayout)
+
+	req.Header.Set("X-Amz-Date", amzDate)
+	if credentials.SessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", credentials.SessionToken)
+	}
+
+	signedHeaders, canonicalHeaders := canonicalHeaders(req)
+	canonicalRequest := strings.Join([]string{
+		req.Method, canonicalPath(req.URL), canonicalQuery(req.URL), canonicalHeaders, signedHeaders,
+		PayloadHash(payload),
+	}, "\n")
+
+	scope := strings.Join([]string{now.Format(dateLayout), region, service, "aws4_request"}, "/")
+	stringToSign := strings.Join([]string{signAlgorithm, amzDate, scope, PayloadHash([]byte(canonicalRequest))}, "\n")
+
+	signingKey := hmacSHA256([]byte("AWS4"+credentials.SecretAccessKey), now.Format(dateLayout))
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, service)
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	signature := hex.EncodeToString(hmacSHA256(signingKey, stringToSign))
+
+	req.Header.Set("Authorization", fmt.Sprintf("%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		signAlgorithm, credentials.AccessKeyID, scope, signedHeaders, signature))
+}
+
+// PayloadHash return the hex encoded SHA256 of the payload, as the X-Amz-Content-Sha256 header of S3 requests
+func PayloadHash(payload []byte) string {
+	sum := sha256.Sum256(payload)
+	return hex.EncodeToString(sum[:])
+}
+
+// canonicalHeaders return the names of the signed headers and the canonical headers: the host and the headers of
+// the request, lowercase and sorted by name, with their values trimmed
+func canonicalHeaders(req *http.Request) (string, string) {
+	host := req.Host
+	if host == "" {
+		host = req.URL.Host
+	}
+
+	values := map[string]string{"host": host}
+	for name, headerValues := range req.Header {
+		trimmed := make([]string, len(headerValues))
+		for i, value := range headerValues {
+			trimmed[i] = strings.Join(strings.Fields(value), " ")
+		}
+		values[strings.ToLower(name)] = strings.Join(trimmed, ",")
+	}
+
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var canonical strings.Builder
+	for _, name := range names {
+		canonical.WriteString(name + ":" + values[name] + "\n")
+	}
+
+	return strings.Join(names, ";"), canonical.String()
+}
+
+// canonicalPath return the escaped path of the url, / when it is empty
+func canonicalPath(u *url.URL) string {
+	path := u.EscapedPath()
+	if path == "" {
+		return "/"
+	}
+
+	return path
+}
+
+// canonicalQuery return the query of the url with its parameters sorted by name and value, escaped as AWS expects
+func canonicalQuery(u *url.URL) string {
+	query := u.Query()
+	names := make([]string, 0, len(query))
+	for name := range query {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var params []string
+	for _, name := range names {
+		values := query[name]
+		sort.Strings(values)
+		for _, value := range values {
+			params = append(params, escape(name)+"="+escape(value))
+		}
+	}
+
+	return strings.Join(params, "&")
+}
+
+// escape return the value escaped as AWS expects: every byte but the unreserved characters, with spaces as %20
+func escape(value string) string {
+	return strings.ReplaceAll(url.QueryEscape(value), "+", "%20")
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
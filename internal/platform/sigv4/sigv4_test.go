@@ -0,0 +1,94 @@
+package sigv4
+
+import (
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// the requests and signatures of the AWS signature version 4 test suite, signed on 2015-08-30T12:36:00Z with its
+// example credentials
+func Test_sign(t *testing.T) {
+	credentials := Credentials{
+		AccessKeyID:     "AKIDEXAMPLE",
+		SecretAccessKey: "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY",
+	}
+	now := time.Date(2015, 8, 30, 12, 36, 0, 0, time.UTC)
+
+	testscases := map[string]struct {
+		method  string
+		url     string
+		headers map[string]string
+		service string
+		want    string
+	}{
+		"get vanilla": {
+			method:  http.MethodGet,
+			url:     "https://example.amazonaws.com/",
+			service: "service",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, " +
+				"Signature=5fa00fa31553b73ebf1942676e86291e8372ff2a2260956d9b8aae1d763fbf31",
+		},
+		"post vanilla": {
+			method:  http.MethodPost,
+			url:     "https://example.amazonaws.com/",
+			service: "service",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, " +
+				"Signature=5da7c1a2acd57cee7505fc6676e4e544621c30862966e37dddb68e92efbe5d6b",
+		},
+		"get vanilla with the query parameters sorted": {
+			method:  http.MethodGet,
+			url:     "https://example.amazonaws.com/?Param2=value2&Param1=value1",
+			service: "service",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/service/aws4_request, " +
+				"SignedHeaders=host;x-amz-date, " +
+				"Signature=b97d918cfa904a5beff61c982a1b6f458b799221646efd99d3219ec94cdf2500",
+		},
+		"iam list users with content type": {
+			method:  http.MethodGet,
+			url:     "https://iam.amazonaws.com/?Action=ListUsers&Version=2010-05-08",
+			headers: map[string]string{"Content-Type": "application/x-www-form-urlencoded; charset=utf-8"},
+			service: "iam",
+			want: "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/20150830/us-east-1/iam/aws4_request, " +
+				"SignedHeaders=content-type;host;x-amz-date, " +
+				"Signature=5d672d79c15b13162d9279b0855cfba6789a8edb4c82c400e06b5924a6f2b5d7",
+		},
+	}
+
+	for name, tc := range testscases {
+		t.Run(name, func(t *testing.T) {
+			req, err := http.NewRequest(tc.method, tc.url, nil)
+			assert.Nil(t, err)
+			for header, value := range tc.headers {
+				req.Header.Set(header, value)
+			}
+
+			Sign(req, nil, tc.service, "us-east-1", credentials, now)
+
+			assert.Equal(t, "20150830T123600Z", req.Header.Get("X-Amz-Date"))
+			assert.Equal(t, tc.want, req.Header.Get("Authorization"))
+		})
+	}
+}
+
+func Test_signSessionToken(t *testing.T) {
+	req, err := http.NewRequest(http.MethodPost, "https://secretsmanager.us-east-1.amazonaws.com/", nil)
+	assert.Nil(t, err)
+
+	Sign(req, []byte(`{}`), "secretsmanager", "us-east-1", Credentials{AccessKeyID: "AKIDEXAMPLE",
+		SecretAccessKey: "a-secret", SessionToken: "a-session-token"}, time.Now())
+
+	// the token of temporary credentials is sent and signed
+	assert.Equal(t, "a-session-token", req.Header.Get("X-Amz-Security-Token"))
+	assert.True(t, strings.Contains(req.Header.Get("Authorization"),
+		"SignedHeaders=host;x-amz-date;x-amz-security-token,"))
+}
+
+func Test_payloadHash(t *testing.T) {
+	assert.Equal(t, "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855", PayloadHash(nil))
+	assert.Equal(t, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", PayloadHash([]byte("hello")))
+}
@@ -0,0 +1,100 @@
+package totp
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"crypto/subtle"
+	"encoding/base32"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"strings"
+	"time"
+)
+
+const (
+	// Digits of the generated codes
+	Digits = 6
+	// Period is how long each code is valid
+	Period = 30 * time.Second
+
+	// secretSize is the bytes of the generated secrets (160 bits, as recommended for HMAC-SHA1)
+	secretSize = 20
+	// skew is how many periods before and after the current one are accepted, to tolerate clock drift
+	skew = 1
+)
+
+var ErrInvalidSecret = errors.New("the totp secret is not a valid base32 string")
+
+var encoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateSecret return a random secret encoded as base32 (without padding), as authenticator apps expect it
+func GenerateSecret() (string, error) {
+	secret := make([]byte, secretSize)
+	if _, err := rand.Read(secret); err != nil {
+		return "", err
+	}
+
+	return encoding.EncodeToString(secret), nil
+}
+
+// Code return the time based one time password (RFC 6238, HMAC-SHA1) of the secret at the received time
+func Code(secret string, t time.Time) (string, error) {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil {
+		return "", ErrInvalidSecret
+	}
+
+	return code(key, uint64(t.Unix())/uint64(Period.Seconds())), nil
+}
+
+// Validate return if the code is the one of the secret at the received time, or at the period before or after it
+func Validate(secret, passcode string, t time.Time) bool {
+	key, err := encoding.DecodeString(strings.ToUpper(strings.TrimSpace(secret)))
+	if err != nil || len(passcode) != Digits {
+		return false
+	}
+
+	counter := uint64(t.Unix()) / uint64(Period.Seconds())
+	for delta := -skew; delta <= skew; delta++ {
+		expected := code(key, counter+uint64(delta))
+		if subtle.ConstantTimeCompare([]byte(expected), []byte(passcode)) == 1 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// ProvisioningURI return the otpauth uri of the secret for the account, authenticator apps enroll it by scanning it
+// as a QR code
+func ProvisioningURI(issuer, account, secret string) string {
+	values := url.Values{}
+	values.Set("secret", secret)
+	values.Set("issuer", issuer)
+	values.Set("algorithm", "SHA1")
+	values.Set("digits", fmt.Sprint(Digits))
+	values.Set("period", fmt.Sprint(int(Period.Seconds())))
+
+	// spaces are escaped as %20 instead of +, since some apps show the + on the issuer
+	label := url.PathEscape(issuer + ":" + account)
+	return fmt.Sprintf("otpauth://totp/%s?%s", label, strings.ReplaceAll(values.Encode(), "+", "%20"))
+}
+
+// code return the HOTP (RFC 4226) of the key for the counter
+func code(key []byte, counter uint64) string {
+	message := make([]byte, 8)
+	binary.BigEndian.PutUint64(message, counter)
+
+	mac := hmac.New(sha1.New, key)
+	mac.Write(message)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+
+	return fmt.Sprintf("%0*d", Digits, value%uint32(math.Pow10(Digits)))
+}
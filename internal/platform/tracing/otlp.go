@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const exportMetricName = "application.space.tracing.exports"
+
+// DefaultMaxQueue is the number of spans kept until they are exported when no other is configured, the spans ended
+// while the queue is full are dropped
+const DefaultMaxQueue = 2048
+
+// OTLPExporter is an Exporter that sends the spans to an OpenTelemetry collector with the OTLP/HTTP protocol (JSON
+// encoded). The spans are queued and sent in batches by ExportEvery. It is safe for concurrent use
+type OTLPExporter struct {
+	endpoint string
+	headers  map[string]string
+	service  string
+	maxQueue int
+
+	mu    sync.Mutex
+	queue []SpanData
+	// dropped are the spans ended while the queue was full since the last batch
+	dropped int64
+
+	client *http.Client
+}
+
+// NewOTLPExporter creates and return an OTLPExporter sending the spans of the received service to the traces endpoint
+// of the collector (as http://localhost:4318/v1/traces) with the received headers
+func NewOTLPExporter(endpoint, service string, headers map[string]string) *OTLPExporter {
+	return &OTLPExporter{
+		endpoint: endpoint,
+		headers:  headers,
+		service:  service,
+		maxQueue: DefaultMaxQueue,
+		client:   &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Export queue the span to be sent on the next batch
+func (e *OTLPExporter) Export(span SpanData) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if len(e.queue) >= e.maxQueue {
+		e.dropped++
+		return
+	}
+
+	e.queue = append(e.queue, span)
+}
+
+// ExportEvery send the queued spans each interval until the context is done, when it sends the last ones
+func (e *OTLPExporter) ExportEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			e.flush(context.Background())
+			return
+		case <-ticker.C:
+			e.flush(ctx)
+		}
+	}
+}
+
+// flush send the queued spans, they are dropped when the collector cannot receive them
+func (e *OTLPExporter) flush(ctx context.Context) {
+	e.mu.Lock()
+	spans := e.queue
+	dropped := e.dropped
+	e.queue = nil
+	e.dropped = 0
+	e.mu.Unlock()
+
+	if dropped > 0 {
+		metrics.Count(ctx, exportMetricName, dropped, []string{"result", "dropped"})
+	}
+
+	if len(spans) == 0 {
+		return
+	}
+
+	if err := e.send(ctx, spans); err != nil {
+		metrics.Count(ctx, exportMetricName, int64(len(spans)), []string{"result", "error"})
+		return
+	}
+
+	metrics.Count(ctx, exportMetricName, int64(len(spans)), []string{"result", "success"})
+}
+
+func (e *OTLPExporter) send(ctx context.Context, spans []SpanData) error {
+	content, err := json.Marshal(e.request(spans))
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, e.endpoint, bytes.NewReader(content))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for name, value := range e.headers {
+		req.Header.Set(name, value)
+	}
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	defer resp.Body.Close()
+	_, _ = io.Copy(ioutil.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("otlp export failed with status %d", resp.StatusCode)
+	}
+
+	return nil
+}
+
+// otlp JSON messages, see opentelemetry-proto trace/v1/trace.proto
+type (
+	otlpRequest struct {
+		ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+	}
+
+	otlpResourceSpans struct {
+		Resource   otlpResource     `json:"resource"`
+		ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes"`
+	}
+
+	otlpScopeSpans struct {
+		Scope otlpScope  `json:"scope"`
+		Spans []otlpSpan `json:"spans"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpSpan struct {
+		TraceID           string          `json:"traceId"`
+		SpanID            string          `json:"spanId"`
+		ParentSpanID      string          `json:"parentSpanId,omitempty"`
+		Name              string          `json:"name"`
+		Kind              Kind            `json:"kind"`
+		StartTimeUnixNano string          `json:"startTimeUnixNano"`
+		EndTimeUnixNano   string          `json:"endTimeUnixNano"`
+		Attributes        []otlpAttribute `json:"attributes,omitempty"`
+		Status            otlpStatus      `json:"status"`
+	}
+
+	otlpAttribute struct {
+		Key   string    `json:"key"`
+		Value otlpValue `json:"value"`
+	}
+
+	otlpValue struct {
+		StringValue string `json:"stringValue"`
+	}
+
+	otlpStatus struct {
+		// Code is 0 for unset and 2 for error
+		Code    int    `json:"code"`
+		Message string `json:"message,omitempty"`
+	}
+)
+
+func (e *OTLPExporter) request(spans []SpanData) otlpRequest {
+	exported := make([]otlpSpan, 0, len(spans))
+	for _, span := range spans {
+		var status otlpStatus
+		if span.Failed {
+			status = otlpStatus{Code: 2, Message: span.Message}
+		}
+
+		exported = append(exported, otlpSpan{
+			TraceID:           span.TraceID,
+			SpanID:            span.SpanID,
+			ParentSpanID:      span.ParentSpanID,
+			Name:              span.Name,
+			Kind:              span.Kind,
+			StartTimeUnixNano: strconv.FormatInt(span.Start.UnixNano(), 10),
+			EndTimeUnixNano:   strconv.FormatInt(span.End.UnixNano(), 10),
+			Attributes:        attributes(span.Attributes),
+			Status:            status,
+		})
+	}
+
+	return otlpRequest{
+		ResourceSpans: []otlpResourceSpans{{
+			Resource:   otlpResource{Attributes: attributes([]string{"service.name", e.service})},
+			ScopeSpans: []otlpScopeSpans{{Scope: otlpScope{Name: e.service}, Spans: exported}},
+		}},
+	}
+}
+
+func attributes(pairs []string) []otlpAttribute {
+	result := make([]otlpAttribute, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		result = append(result, otlpAttribute{Key: pairs[i], Value: otlpValue{StringValue: pairs[i+1]}})
+	}
+
+	return result
+}
@@ -0,0 +1,219 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	mathrand "math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SpanKey is the context key of the current span, a string so it can be set on gin contexts
+const SpanKey = "trace_span"
+
+// traceparentHeader is the header of the W3C trace context propagation
+const traceparentHeader = "traceparent"
+
+// DefaultExporter is where the spans ended are exported, they are not exported when it is nil
+var DefaultExporter Exporter
+
+// SampleRatio is the ratio of the traces started by the application which are exported, the traces started by
+// another service keep its decision
+var SampleRatio = 1.0
+
+// Kind is the role of the span in the trace, with the values of OpenTelemetry
+type Kind int
+
+const (
+	KindInternal Kind = 1
+	KindServer   Kind = 2
+	KindClient   Kind = 3
+)
+
+// Exporter send the spans ended to a tracing backend
+type Exporter interface {
+	Export(span SpanData)
+}
+
+// SpanData is a span ended, as it is exported
+type SpanData struct {
+	TraceID      string
+	SpanID       string
+	ParentSpanID string
+	Name         string
+	Kind         Kind
+	Start        time.Time
+	End          time.Time
+	// Attributes are key, value pairs
+	Attributes []string
+	Failed     bool
+	Message    string
+}
+
+// Span is an operation of a trace, as a request or a query. It is safe for concurrent use
+type Span struct {
+	mu       sync.Mutex
+	traceID  [16]byte
+	spanID   [8]byte
+	parentID [8]byte
+	sampled  bool
+	// remote spans are the parents received from another service, they are not ended here
+	remote bool
+
+	name       string
+	kind       Kind
+	start      time.Time
+	attributes []string
+	failed     bool
+	message    string
+	ended      bool
+}
+
+// Start a span child of the span on context, or a new trace if there is none, and return a copy of the context with
+// it. The attributes are key, value pairs
+func Start(ctx context.Context, kind Kind, name string, attributes []string) (context.Context, *Span) {
+	span := &Span{
+		name:       name,
+		kind:       kind,
+		start:      time.Now(),
+		attributes: append([]string(nil), attributes...),
+	}
+	_, _ = rand.Read(span.spanID[:])
+
+	if parent := FromContext(ctx); parent != nil {
+		span.traceID = parent.traceID
+		span.parentID = parent.spanID
+		span.sampled = parent.sampled
+	} else {
+		_, _ = rand.Read(span.traceID[:])
+		span.sampled = mathrand.Float64() < SampleRatio
+	}
+
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	return context.WithValue(ctx, SpanKey, span), span
+}
+
+// FromContext return the current span of the context, nil if there is none
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+
+	span, _ := ctx.Value(SpanKey).(*Span)
+	return span
+}
+
+// Extract return a copy of the context with the parent span of the received traceparent header, so the spans started
+// with it continue the trace of the service which called. The context is returned as it is when the header is
+// missing or invalid
+func Extract(ctx context.Context, header http.Header) context.Context {
+	// version-trace id-parent id-flags
+	parts := strings.Split(strings.TrimSpace(header.Get(traceparentHeader)), "-")
+	if len(parts) != 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[3]) != 2 {
+		return ctx
+	}
+
+	parent := &Span{remote: true}
+	if !decodeID(parts[1], parent.traceID[:]) || !decodeID(parts[2], parent.spanID[:]) {
+		return ctx
+	}
+
+	flags, err := hex.DecodeString(parts[3])
+	if err != nil {
+		return ctx
+	}
+	parent.sampled = flags[0]&0x01 == 0x01
+
+	return context.WithValue(ctx, SpanKey, parent)
+}
+
+// decodeID decode the hex id into dst, an id with zeros only is invalid
+func decodeID(id string, dst []byte) bool {
+	if len(id) != hex.EncodedLen(len(dst)) {
+		return false
+	}
+	if _, err := hex.Decode(dst, []byte(id)); err != nil {
+		return false
+	}
+
+	for _, b := range dst {
+		if b != 0 {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TraceID return the hex id of the trace of the span
+func (s *Span) TraceID() string {
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SpanID return the hex id of the span
+func (s *Span) SpanID() string {
+	return hex.EncodeToString(s.spanID[:])
+}
+
+// Traceparent return the traceparent header to propagate the span to another service
+func (s *Span) Traceparent() string {
+	flags := "00"
+	if s.sampled {
+		flags = "01"
+	}
+
+	return "00-" + s.TraceID() + "-" + s.SpanID() + "-" + flags
+}
+
+// SetAttributes add the key, value pairs to the attributes of the span
+func (s *Span) SetAttributes(attributes ...string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.attributes = append(s.attributes, attributes...)
+}
+
+// Fail set the status of the span as failed, with the description of the failure
+func (s *Span) Fail(description string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.failed = true
+	s.message = description
+}
+
+// End the span and export it if its trace is sampled, the calls after the first one do nothing
+func (s *Span) End() {
+	s.mu.Lock()
+	if s.ended || s.remote {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+
+	data := SpanData{
+		TraceID:    s.TraceID(),
+		SpanID:     s.SpanID(),
+		Name:       s.name,
+		Kind:       s.kind,
+		Start:      s.start,
+		End:        time.Now(),
+		Attributes: s.attributes,
+		Failed:     s.failed,
+		Message:    s.message,
+	}
+	if s.parentID != [8]byte{} {
+		data.ParentSpanID = hex.EncodeToString(s.parentID[:])
+	}
+	s.mu.Unlock()
+
+	if s.sampled && DefaultExporter != nil {
+		DefaultExporter.Export(data)
+	}
+}
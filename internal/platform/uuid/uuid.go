@@ -0,0 +1,29 @@
+package uuid
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"regexp"
+)
+
+var format = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{4}-[0-9a-f]{12}$`)
+
+// New return a random (version 4, RFC 4122) uuid on its canonical lowercase form
+func New() (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+
+	s := hex.EncodeToString(b)
+
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:], nil
+}
+
+// Valid return if the received string is a uuid on its canonical lowercase form
+func Valid(s string) bool {
+	return format.MatchString(s)
+}
@@ -0,0 +1,293 @@
+package simulation
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"github.com/nicocarolo/space-drivers/internal/travel"
+	"github.com/nicocarolo/space-drivers/internal/user"
+	"strings"
+	"time"
+)
+
+const (
+	// DefaultDrivers is the quantity of synthetic drivers when none is configured
+	DefaultDrivers = 5
+	// DefaultTravelDuration is the time a synthetic driver takes to complete a travel when none is configured
+	DefaultTravelDuration = time.Minute
+
+	// driversDomain is the email domain of the synthetic drivers, used to tell them apart from the real ones
+	driversDomain = "simulation.space-drivers"
+
+	// usersPageSize is the page size used to find the synthetic drivers already created and the free ones
+	usersPageSize = 100
+	// pendingPageSize is the max quantity of pending travels read on each step
+	pendingPageSize = 100
+
+	simulationMetric = "application.space.simulation.transitions"
+)
+
+type TravelStorage interface {
+	Search(ctx context.Context, opt ...travel.SearchOption) ([]travel.Travel, travel.Metadata, error)
+	Update(ctx context.Context, travel travel.Travel) (travel.Travel, error)
+}
+
+type UserStorage interface {
+	Save(ctx context.Context, user user.User) (user.SecuredUser, error)
+	Search(ctx context.Context, opt ...user.SearchOption) ([]user.SecuredUser, user.Metadata, error)
+}
+
+// Simulator runs synthetic drivers that take the pending travels and complete them after the travel duration, so
+// the travels flow end to end without real drivers. It is not safe for concurrent use, the steps should be run
+// one at a time (see RunEvery)
+type Simulator struct {
+	travels TravelStorage
+	users   UserStorage
+
+	drivers        int
+	travelDuration time.Duration
+
+	// driverIDs are the ids of the synthetic drivers
+	driverIDs map[int64]bool
+	// startedAt is when each travel was taken by a synthetic driver
+	startedAt map[int64]time.Time
+}
+
+type SimulatorOption func(sim *Simulator)
+
+// WithDrivers set the quantity of synthetic drivers
+func WithDrivers(drivers int) SimulatorOption {
+	return func(sim *Simulator) {
+		sim.drivers = drivers
+	}
+}
+
+// WithTravelDuration set the time a synthetic driver takes to complete a travel
+func WithTravelDuration(duration time.Duration) SimulatorOption {
+	return func(sim *Simulator) {
+		sim.travelDuration = duration
+	}
+}
+
+// NewSimulator will create and return a Simulator with the received storages, DefaultDrivers and
+// DefaultTravelDuration unless other options are received
+func NewSimulator(travels TravelStorage, users UserStorage, opts ...SimulatorOption) *Simulator {
+	sim := &Simulator{
+		travels:        travels,
+		users:          users,
+		drivers:        DefaultDrivers,
+		travelDuration: DefaultTravelDuration,
+		driverIDs:      make(map[int64]bool),
+		startedAt:      make(map[int64]time.Time),
+	}
+
+	for _, opt := range opts {
+		opt(sim)
+	}
+
+	return sim
+}
+
+// driverEmail return the email of the synthetic driver with the received number
+func driverEmail(number int) string {
+	return fmt.Sprintf("driver-%d@%s", number, driversDomain)
+}
+
+// CreateDrivers create the synthetic drivers that do not exist yet, with a random password so nobody can log in
+// with them. It return the ids of every synthetic driver
+func (sim *Simulator) CreateDrivers(ctx context.Context) ([]int64, error) {
+	existing := make(map[string]int64)
+	for offset := int64(0); ; offset += usersPageSize {
+		users, meta, err := sim.users.Search(ctx, user.WithLimit(usersPageSize), user.WithOffset(offset))
+		if err != nil {
+			log.Error(ctx, "there was an error searching simulation drivers", log.Err(err))
+			return nil, err
+		}
+
+		for _, u := range users {
+			if strings.HasSuffix(u.Email, "@"+driversDomain) {
+				existing[u.Email] = u.ID
+			}
+		}
+
+		if meta.Pending == 0 {
+			break
+		}
+	}
+
+	ids := make([]int64, 0, sim.drivers)
+	for number := 1; number <= sim.drivers; number++ {
+		email := driverEmail(number)
+		if id, ok := existing[email]; ok {
+			ids = append(ids, id)
+			continue
+		}
+
+		password, err := randomPassword()
+		if err != nil {
+			return nil, err
+		}
+
+		created, err := sim.users.Save(ctx, user.User{
+			SecuredUser: user.SecuredUser{Email: email, Role: user.RoleDriver},
+			Password:    password,
+		})
+		if err != nil {
+			log.Error(ctx, "there was an error creating simulation driver", log.String("email", email), log.Err(err))
+			return nil, err
+		}
+
+		log.Info(ctx, "simulation driver created", log.Int64("user_id", created.ID), log.String("email", email))
+		ids = append(ids, created.ID)
+	}
+
+	for _, id := range ids {
+		sim.driverIDs[id] = true
+	}
+
+	return ids, nil
+}
+
+// Step progress the travels of the simulation: the in process travels of the synthetic drivers that lasted the
+// travel duration are set ready, then the free synthetic drivers take the pending travels without user by priority
+// and then by age. It return the quantity of travels progressed, a travel that cannot be progressed is logged and
+// skipped
+func (sim *Simulator) Step(ctx context.Context) (int, error) {
+	// the simulation acts as an admin, who can assign and complete any travel
+	ctx = context.WithValue(ctx, "user_on_call", jwt.Claims{Role: user.RoleAdmin, Permissions: user.RolePermissions(user.RoleAdmin)})
+	now := time.Now().UTC()
+
+	progressed := 0
+	for driverID := range sim.driverIDs {
+		inProcess, _, err := sim.travels.Search(ctx, travel.WithUser(driverID),
+			travel.WithStatus(travel.StatusInProcess))
+		if err != nil {
+			log.Error(ctx, "there was an error searching simulation travels in process",
+				log.Int64("user_id", driverID), log.Err(err))
+			metrics.Inc(ctx, simulationMetric, []string{"result", "false"})
+			return progressed, err
+		}
+
+		for _, trv := range inProcess {
+			// travels found in process after a restart start their duration now
+			startedAt, ok := sim.startedAt[trv.ID]
+			if !ok {
+				sim.startedAt[trv.ID] = now
+				continue
+			}
+
+			if now.Sub(startedAt) < sim.travelDuration {
+				continue
+			}
+
+			trv.Status = travel.StatusReady
+			if sim.update(ctx, trv) {
+				delete(sim.startedAt, trv.ID)
+				progressed++
+			}
+		}
+	}
+
+	var drivers []int64
+	for offset := int64(0); ; offset += usersPageSize {
+		free, meta, err := sim.users.Search(ctx, user.WithStatus(user.StatusSearchFree),
+			user.WithLimit(usersPageSize), user.WithOffset(offset))
+		if err != nil {
+			log.Error(ctx, "there was an error searching simulation free drivers", log.Err(err))
+			metrics.Inc(ctx, simulationMetric, []string{"result", "false"})
+			return progressed, err
+		}
+
+		for _, driver := range free {
+			if sim.driverIDs[driver.ID] {
+				drivers = append(drivers, driver.ID)
+			}
+		}
+
+		if meta.Pending == 0 {
+			break
+		}
+	}
+
+	if len(drivers) > 0 {
+		pending, _, err := sim.travels.Search(ctx, travel.WithStatus(travel.StatusPending),
+			travel.WithPriorityOrder(), travel.WithLimit(pendingPageSize))
+		if err != nil {
+			log.Error(ctx, "there was an error searching simulation pending travels", log.Err(err))
+			metrics.Inc(ctx, simulationMetric, []string{"result", "false"})
+			return progressed, err
+		}
+
+		for _, trv := range pending {
+			if len(drivers) == 0 {
+				break
+			}
+			if trv.UserID != 0 {
+				continue
+			}
+
+			trv.UserID = drivers[0]
+			trv.Status = travel.StatusInProcess
+			if sim.update(ctx, trv) {
+				sim.startedAt[trv.ID] = now
+				drivers = drivers[1:]
+				progressed++
+			}
+		}
+	}
+
+	metrics.Count(ctx, simulationMetric, int64(progressed), []string{"result", "true"})
+
+	return progressed, nil
+}
+
+// update store the travel progressed by the simulation, it return false if it could not be stored
+func (sim *Simulator) update(ctx context.Context, trv travel.Travel) bool {
+	if _, err := sim.travels.Update(ctx, trv); err != nil {
+		log.Info(ctx, "simulation could not progress travel",
+			log.Int64("travel_id", trv.ID),
+			log.Int64("user_id", trv.UserID),
+			log.String("travel_status", string(trv.Status)),
+			log.Err(err))
+		return false
+	}
+
+	return true
+}
+
+// RunEvery create the synthetic drivers and run a Step every interval, until the context is done. It is meant to
+// be run on its own goroutine
+func (sim *Simulator) RunEvery(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		// errors are already logged and measured, the next run will retry
+		if len(sim.driverIDs) == 0 {
+			_, _ = sim.CreateDrivers(ctx)
+		}
+		if len(sim.driverIDs) > 0 {
+			_, _ = sim.Step(ctx)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// randomPassword return a random password of 32 hex characters
+func randomPassword() (string, error) {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(buf), nil
+}
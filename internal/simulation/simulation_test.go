@@ -0,0 +1,210 @@
+package simulation
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/travel"
+	"github.com/nicocarolo/space-drivers/internal/user"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+	"time"
+)
+
+// mockTravels a travel storage keeping the travels on memory, the updates of the travels on rejected are failed
+type mockTravels struct {
+	travels  map[int64]travel.Travel
+	rejected map[int64]bool
+
+	searchError error
+}
+
+func (m *mockTravels) Search(ctx context.Context, opt ...travel.SearchOption) ([]travel.Travel, travel.Metadata, error) {
+	if m.searchError != nil {
+		return nil, travel.Metadata{}, m.searchError
+	}
+
+	var search travel.Search
+	for _, option := range opt {
+		option(&search)
+	}
+
+	var travels []travel.Travel
+	for _, trv := range m.travels {
+		if search.UserID != 0 && trv.UserID != search.UserID {
+			continue
+		}
+		if len(search.Status) > 0 && trv.Status != search.Status[0] {
+			continue
+		}
+
+		travels = append(travels, trv)
+	}
+
+	sort.Slice(travels, func(i, j int) bool {
+		// high priority travels go first, the rest keep the id order
+		if search.ByPriority && (travels[i].Priority == travel.PriorityHigh) != (travels[j].Priority == travel.PriorityHigh) {
+			return travels[i].Priority == travel.PriorityHigh
+		}
+		return travels[i].ID < travels[j].ID
+	})
+
+	return travels, travel.Metadata{Total: int64(len(travels))}, nil
+}
+
+func (m *mockTravels) Update(ctx context.Context, trv travel.Travel) (travel.Travel, error) {
+	if claims, ok := ctx.Value("user_on_call").(jwt.Claims); !ok || claims.Role != user.RoleAdmin {
+		return travel.Travel{}, travel.ErrInvalidUserAccess
+	}
+
+	if m.rejected[trv.ID] {
+		return travel.Travel{}, travel.ErrDriverNotEligible
+	}
+
+	m.travels[trv.ID] = trv
+
+	return trv, nil
+}
+
+// mockUsers a user storage keeping the users on memory, a driver is free if it has no in process travel
+type mockUsers struct {
+	users   []user.SecuredUser
+	travels *mockTravels
+}
+
+func (m *mockUsers) Save(ctx context.Context, u user.User) (user.SecuredUser, error) {
+	u.ID = int64(len(m.users) + 1)
+	m.users = append(m.users, u.SecuredUser)
+
+	return u.SecuredUser, nil
+}
+
+func (m *mockUsers) Search(ctx context.Context, opt ...user.SearchOption) ([]user.SecuredUser, user.Metadata, error) {
+	busy := make(map[int64]bool)
+	for _, trv := range m.travels.travels {
+		if trv.Status == travel.StatusInProcess {
+			busy[trv.UserID] = true
+		}
+	}
+
+	var users []user.SecuredUser
+	for _, u := range m.users {
+		if !busy[u.ID] {
+			users = append(users, u)
+		}
+	}
+
+	return users, user.Metadata{Total: int64(len(users))}, nil
+}
+
+func Test_createDrivers(t *testing.T) {
+	users := &mockUsers{
+		users: []user.SecuredUser{
+			{ID: 1, Email: "admin@hotmail.com", Role: user.RoleAdmin},
+			{ID: 2, Email: "driver-1@simulation.space-drivers", Role: user.RoleDriver},
+		},
+		travels: &mockTravels{},
+	}
+
+	sim := NewSimulator(users.travels, users, WithDrivers(3))
+	ids, err := sim.CreateDrivers(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2, 3, 4}, ids)
+	if assert.Len(t, users.users, 4) {
+		assert.Equal(t, "driver-2@simulation.space-drivers", users.users[2].Email)
+		assert.Equal(t, "driver-3@simulation.space-drivers", users.users[3].Email)
+		assert.Equal(t, user.RoleDriver, users.users[3].Role)
+	}
+
+	// the drivers are created only once
+	ids, err = sim.CreateDrivers(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2, 3, 4}, ids)
+	assert.Len(t, users.users, 4)
+}
+
+func Test_simulationStep(t *testing.T) {
+	travels := &mockTravels{
+		travels: map[int64]travel.Travel{
+			1: {ID: 1, Status: travel.StatusPending},
+			2: {ID: 2, Status: travel.StatusPending, UserID: 1},
+			3: {ID: 3, Status: travel.StatusPending},
+			4: {ID: 4, Status: travel.StatusPending},
+			5: {ID: 5, Status: travel.StatusPending},
+		},
+		rejected: map[int64]bool{3: true},
+	}
+	users := &mockUsers{
+		users:   []user.SecuredUser{{ID: 1, Email: "driver@hotmail.com", Role: user.RoleDriver}},
+		travels: travels,
+	}
+
+	sim := NewSimulator(travels, users, WithDrivers(2), WithTravelDuration(time.Hour))
+	_, err := sim.CreateDrivers(context.Background())
+	assert.Nil(t, err)
+
+	// the synthetic drivers take the oldest pending travels without user, skipping the ones that cannot be taken
+	progressed, err := sim.Step(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, progressed)
+	assert.Equal(t, travel.Travel{ID: 1, Status: travel.StatusInProcess, UserID: 2}, travels.travels[1])
+	assert.Equal(t, travel.Travel{ID: 2, Status: travel.StatusPending, UserID: 1}, travels.travels[2])
+	assert.Equal(t, travel.Travel{ID: 3, Status: travel.StatusPending}, travels.travels[3])
+	assert.Equal(t, travel.Travel{ID: 4, Status: travel.StatusInProcess, UserID: 3}, travels.travels[4])
+	assert.Equal(t, travel.Travel{ID: 5, Status: travel.StatusPending}, travels.travels[5])
+
+	// the travels are not ready until the travel duration passes
+	progressed, err = sim.Step(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 0, progressed)
+
+	sim.startedAt[1] = time.Now().Add(-2 * time.Hour)
+	progressed, err = sim.Step(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 2, progressed)
+	assert.Equal(t, travel.Status(travel.StatusReady), travels.travels[1].Status)
+	assert.Equal(t, travel.Travel{ID: 5, Status: travel.StatusInProcess, UserID: 2}, travels.travels[5])
+	assert.Equal(t, travel.Status(travel.StatusInProcess), travels.travels[4].Status)
+}
+
+func Test_simulationStepByPriority(t *testing.T) {
+	travels := &mockTravels{
+		travels: map[int64]travel.Travel{
+			1: {ID: 1, Status: travel.StatusPending, Priority: travel.PriorityNormal},
+			2: {ID: 2, Status: travel.StatusPending, Priority: travel.PriorityHigh},
+		},
+	}
+	users := &mockUsers{travels: travels}
+
+	sim := NewSimulator(travels, users, WithDrivers(1))
+	_, err := sim.CreateDrivers(context.Background())
+	assert.Nil(t, err)
+
+	// the high priority travel is taken before the older one
+	progressed, err := sim.Step(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, 1, progressed)
+	assert.Equal(t, travel.Status(travel.StatusInProcess), travels.travels[2].Status)
+	assert.Equal(t, travel.Status(travel.StatusPending), travels.travels[1].Status)
+}
+
+func Test_simulationStepFailure(t *testing.T) {
+	travels := &mockTravels{searchError: errors.New("mocked search error")}
+	users := &mockUsers{travels: &mockTravels{}}
+
+	sim := NewSimulator(travels, users, WithDrivers(1))
+	_, err := sim.CreateDrivers(context.Background())
+	assert.Nil(t, err)
+
+	progressed, err := sim.Step(context.Background())
+
+	assert.NotNil(t, err)
+	assert.Equal(t, 0, progressed)
+}
@@ -0,0 +1,87 @@
+package team
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+)
+
+var (
+	ErrInvalidTeamMember  = code_error.Error{Code: "invalid_user", Detail: "the user to add to the team should be a driver or a dispatcher"}
+	ErrNotFoundTeamMember = code_error.Error{Code: "not_found_team_member", Detail: "the user is not a member of the team"}
+)
+
+// TeamMembers is the team membership, the drivers and dispatchers of the team
+type TeamMembers struct {
+	TeamID  int64   `json:"team_id"`
+	UserIDs []int64 `json:"user_ids"`
+}
+
+// AddMember add the driver or dispatcher with the received user id to the team, adding it twice has no effect. A
+// user can be a member of several teams
+func (teamStorage TeamStorage) AddMember(ctx context.Context, id int64, userID int64) error {
+	if _, err := teamStorage.Get(ctx, id); err != nil {
+		return err
+	}
+
+	if err := teamStorage.repository.AddTeamMember(ctx, id, userID); err != nil {
+		if errors.Is(err, ErrMemberNotFound) {
+			log.Info(ctx, "invalid check on add team member: the user is not a driver or a dispatcher",
+				log.Int64("team_id", id),
+				log.Int64("user_id", userID))
+			return ErrInvalidTeamMember
+		}
+
+		log.Error(ctx, "there was an error adding team member", log.Int64("team_id", id),
+			log.Int64("user_id", userID), log.Err(err))
+		return ErrStorageSave
+	}
+
+	return nil
+}
+
+// RemoveMember remove the user with the received user id from the team
+func (teamStorage TeamStorage) RemoveMember(ctx context.Context, id int64, userID int64) error {
+	if err := teamStorage.repository.RemoveTeamMember(ctx, id, userID); err != nil {
+		if errors.Is(err, ErrTeamMemberNotFound) {
+			return ErrNotFoundTeamMember
+		}
+
+		log.Error(ctx, "there was an error removing team member", log.Int64("team_id", id),
+			log.Int64("user_id", userID), log.Err(err))
+		return ErrStorageDelete
+	}
+
+	return nil
+}
+
+// Members return the members of the team with the received id
+func (teamStorage TeamStorage) Members(ctx context.Context, id int64) (TeamMembers, error) {
+	if _, err := teamStorage.Get(ctx, id); err != nil {
+		return TeamMembers{}, err
+	}
+
+	userIDs, err := teamStorage.repository.GetTeamMembers(ctx, id)
+	if err != nil {
+		log.Error(ctx, "there was an error getting team members", log.Int64("team_id", id), log.Err(err))
+		return TeamMembers{}, ErrStorageGet
+	}
+
+	if userIDs == nil {
+		userIDs = []int64{}
+	}
+
+	return TeamMembers{TeamID: id, UserIDs: userIDs}, nil
+}
+
+// UserTeams return the ids of the teams where the user with the received id is a member, ordered by id
+func (teamStorage TeamStorage) UserTeams(ctx context.Context, userID int64) ([]int64, error) {
+	teamIDs, err := teamStorage.repository.GetUserTeams(ctx, userID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting user teams", log.Int64("user_id", userID), log.Err(err))
+		return nil, ErrStorageGet
+	}
+
+	return teamIDs, nil
+}
@@ -0,0 +1,289 @@
+package team
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/nicocarolo/space-drivers/internal/platform/config"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"os"
+	"strconv"
+	"time"
+)
+
+const (
+	dbnameDefault = "space_drivers"
+
+	timeMetricName   = "application.space.repository.time"
+	entityMetricName = "team"
+)
+
+var (
+	ErrTeamNotFound       = errors.New("not founded team")
+	ErrMemberNotFound     = errors.New("not founded driver or dispatcher")
+	ErrTeamMemberNotFound = errors.New("not founded team member")
+)
+
+type repository interface {
+	SaveTeam(ctx context.Context, team Team) (Team, error)
+	GetTeam(ctx context.Context, id int64) (Team, error)
+	GetTeams(ctx context.Context) ([]Team, error)
+	UpdateTeam(ctx context.Context, team Team) error
+	DeleteTeam(ctx context.Context, id int64) error
+
+	AddTeamMember(ctx context.Context, teamID, userID int64) error
+	RemoveTeamMember(ctx context.Context, teamID, userID int64) error
+	GetTeamMembers(ctx context.Context, teamID int64) ([]int64, error)
+	GetUserTeams(ctx context.Context, userID int64) ([]int64, error)
+}
+
+// SqlRepository sql client wrapper for team model
+type SqlRepository struct {
+	db *sql.DB
+}
+
+// NewRepository creates and return an SqlRepository
+func NewRepository() (SqlRepository, error) {
+	dbname := os.Getenv("DB_NAME")
+	dbuser := os.Getenv("DB_USER")
+	dbpass := config.Secret("DB_PASSWORD", "")
+	dbimage := os.Getenv("DB_IMAGE_NAME")
+	scope := os.Getenv("SCOPE")
+
+	if dbname == "" {
+		dbname = dbnameDefault
+	}
+	if dbuser == "" || dbpass == "" || dbimage == "" {
+		return SqlRepository{}, fmt.Errorf("cannot initialize team repository: the following settings " +
+			"(DB_USER, DB_PASSWORD, DB_IMAGE_NAME) are invalid")
+	}
+
+	dataSourceConnection := fmt.Sprintf("%s:%s@/%s?parseTime=true", dbuser, dbpass, dbname)
+	if scope != "" {
+		dataSourceConnection = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?parseTime=true", dbuser, dbpass, dbimage, dbname)
+	}
+	db, err := sql.Open("mysql", dataSourceConnection)
+	if err != nil {
+		return SqlRepository{}, err
+	}
+
+	return SqlRepository{
+		db: db,
+	}, nil
+}
+
+// Close the connections to the db, once the repository is not used anymore
+func (sqlDb SqlRepository) Close() error {
+	return sqlDb.db.Close()
+}
+
+// Stats return the stats of the connections to the db, as the open and in use ones
+func (sqlDb SqlRepository) Stats() sql.DBStats {
+	return sqlDb.db.Stats()
+}
+
+// SaveTeam will store a Team on sql table
+func (sqlDb SqlRepository) SaveTeam(ctx context.Context, team Team) (Team, error) {
+	q, err := sqlDb.db.Prepare("INSERT INTO teams(name, created_at) VALUES(?, ?)")
+	if err != nil {
+		return Team{}, err
+	}
+
+	defer q.Close()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "insert")
+	result, err := q.ExecContext(ctx, team.Name, team.CreatedAt)
+	trackTime(err == nil)
+	if err != nil {
+		return Team{}, err
+	}
+
+	team.ID, err = result.LastInsertId()
+	if err != nil {
+		return Team{}, err
+	}
+
+	return team, nil
+}
+
+// GetTeam will get the Team who has the received id from table
+func (sqlDb SqlRepository) GetTeam(ctx context.Context, id int64) (Team, error) {
+	var team Team
+	trackTime := trackElapsed(ctx, entityMetricName, "select")
+	err := sqlDb.db.QueryRowContext(ctx, "SELECT id, name, created_at FROM teams WHERE id = ?", id).
+		Scan(&team.ID, &team.Name, &team.CreatedAt)
+	trackTime(err == nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Team{}, ErrTeamNotFound
+		}
+		return Team{}, err
+	}
+
+	return team, nil
+}
+
+// GetTeams will get all the teams from table ordered by id
+func (sqlDb SqlRepository) GetTeams(ctx context.Context) ([]Team, error) {
+	trackTime := trackElapsed(ctx, entityMetricName, "select_all")
+	rows, err := sqlDb.db.QueryContext(ctx, "SELECT id, name, created_at FROM teams ORDER BY id")
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var teams []Team
+	for rows.Next() {
+		var team Team
+		if err := rows.Scan(&team.ID, &team.Name, &team.CreatedAt); err != nil {
+			return nil, err
+		}
+
+		teams = append(teams, team)
+	}
+
+	return teams, rows.Err()
+}
+
+// UpdateTeam will store the name of the received team
+func (sqlDb SqlRepository) UpdateTeam(ctx context.Context, team Team) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "update")
+	result, err := sqlDb.db.ExecContext(ctx, "UPDATE teams SET name = ? WHERE id = ?", team.Name, team.ID)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	// the name may not change, the team is checked to exist before updating it
+	if affected == 0 {
+		if _, err := sqlDb.GetTeam(ctx, team.ID); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// DeleteTeam will remove the team with the received id from table, with its members
+func (sqlDb SqlRepository) DeleteTeam(ctx context.Context, id int64) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "delete")
+	result, err := sqlDb.db.ExecContext(ctx, "DELETE teams, team_members FROM teams "+
+		"LEFT JOIN team_members ON team_members.team_id = teams.id WHERE teams.id = ?", id)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrTeamNotFound
+	}
+
+	return nil
+}
+
+// AddTeamMember will add the user with the received id to the team, it return ErrMemberNotFound if the user does
+// not exist or it is not a driver or a dispatcher
+func (sqlDb SqlRepository) AddTeamMember(ctx context.Context, teamID, userID int64) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "select_member")
+	var members int64
+	err := sqlDb.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE id = ? "+
+		"AND role IN ('driver', 'dispatcher') AND deleted_at IS NULL", userID).Scan(&members)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	if members == 0 {
+		return ErrMemberNotFound
+	}
+
+	trackTime = trackElapsed(ctx, entityMetricName, "insert_member")
+	_, err = sqlDb.db.ExecContext(ctx, "INSERT IGNORE INTO team_members(team_id, user_id) VALUES(?, ?)",
+		teamID, userID)
+	trackTime(err == nil)
+
+	return err
+}
+
+// RemoveTeamMember will remove the user with the received id from the team
+func (sqlDb SqlRepository) RemoveTeamMember(ctx context.Context, teamID, userID int64) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "delete_member")
+	result, err := sqlDb.db.ExecContext(ctx, "DELETE FROM team_members WHERE team_id = ? AND user_id = ?",
+		teamID, userID)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrTeamMemberNotFound
+	}
+
+	return nil
+}
+
+// GetTeamMembers will get the user ids of the members of the team ordered by id
+func (sqlDb SqlRepository) GetTeamMembers(ctx context.Context, teamID int64) ([]int64, error) {
+	return sqlDb.selectIDs(ctx, "select_members",
+		"SELECT user_id FROM team_members WHERE team_id = ? ORDER BY user_id", teamID)
+}
+
+// GetUserTeams will get the ids of the teams where the user is a member ordered by id
+func (sqlDb SqlRepository) GetUserTeams(ctx context.Context, userID int64) ([]int64, error) {
+	return sqlDb.selectIDs(ctx, "select_user_teams",
+		"SELECT team_id FROM team_members WHERE user_id = ? ORDER BY team_id", userID)
+}
+
+// selectIDs run a query selecting a single id column
+func (sqlDb SqlRepository) selectIDs(ctx context.Context, action, query string, args ...interface{}) ([]int64, error) {
+	trackTime := trackElapsed(ctx, entityMetricName, action)
+	rows, err := sqlDb.db.QueryContext(ctx, query, args...)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+func trackElapsed(ctx context.Context, entity, action string) func(success bool) {
+	start := time.Now()
+	return func(success bool) {
+		metrics.Timing(ctx, timeMetricName, time.Since(start),
+			[]string{
+				"result", strconv.FormatBool(success),
+				"action", action,
+				"entity", entity})
+	}
+}
@@ -0,0 +1,132 @@
+package team
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"strings"
+	"time"
+)
+
+const maxTeamNameLength = 50
+
+var (
+	ErrInvalidTeamName = code_error.Error{Code: "invalid_team", Detail: "the team name should have between 1 and 50 characters"}
+	ErrNotFoundTeam    = code_error.Error{Code: "not_found_team", Detail: "not founded the team to get"}
+	ErrStorageSave     = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to save team"}
+	ErrStorageGet      = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to get team"}
+	ErrStorageUpdate   = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to update team"}
+	ErrStorageDelete   = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to delete team"}
+)
+
+// Team is a group of drivers and dispatchers to partition the fleet of large operations, the dispatchers of a team
+// only see the travels of its drivers
+type Team struct {
+	ID        int64     `json:"id"`
+	Name      string    `json:"name" binding:"required"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type TeamStorage struct {
+	repository repository
+}
+
+// NewTeamStorage will create and return a TeamStorage with the received repository
+func NewTeamStorage(repository repository) TeamStorage {
+	return TeamStorage{
+		repository: repository,
+	}
+}
+
+// Save will store a Team on repository and return it
+func (teamStorage TeamStorage) Save(ctx context.Context, team Team) (Team, error) {
+	team, err := normalizeTeam(ctx, team)
+	if err != nil {
+		return Team{}, err
+	}
+
+	team.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	team, err = teamStorage.repository.SaveTeam(ctx, team)
+	if err != nil {
+		log.Error(ctx, "there was an error saving team", log.Err(err))
+		return Team{}, ErrStorageSave
+	}
+
+	return team, nil
+}
+
+// Get and return the Team from repository with the received id
+func (teamStorage TeamStorage) Get(ctx context.Context, id int64) (Team, error) {
+	team, err := teamStorage.repository.GetTeam(ctx, id)
+	if err != nil {
+		log.Error(ctx, "there was an error getting team", log.Int64("team_id", id), log.Err(err))
+		if errors.Is(err, ErrTeamNotFound) {
+			return Team{}, ErrNotFoundTeam
+		}
+		return Team{}, ErrStorageGet
+	}
+
+	return team, nil
+}
+
+// List return all the teams on repository ordered by id
+func (teamStorage TeamStorage) List(ctx context.Context) ([]Team, error) {
+	teams, err := teamStorage.repository.GetTeams(ctx)
+	if err != nil {
+		log.Error(ctx, "there was an error getting teams", log.Err(err))
+		return nil, ErrStorageGet
+	}
+
+	return teams, nil
+}
+
+// Update will replace the name of the team with the received id
+func (teamStorage TeamStorage) Update(ctx context.Context, team Team) (Team, error) {
+	team, err := normalizeTeam(ctx, team)
+	if err != nil {
+		return Team{}, err
+	}
+
+	current, err := teamStorage.Get(ctx, team.ID)
+	if err != nil {
+		return Team{}, err
+	}
+
+	current.Name = team.Name
+
+	if err := teamStorage.repository.UpdateTeam(ctx, current); err != nil {
+		log.Error(ctx, "there was an error updating team", log.Int64("team_id", team.ID), log.Err(err))
+		if errors.Is(err, ErrTeamNotFound) {
+			return Team{}, ErrNotFoundTeam
+		}
+		return Team{}, ErrStorageUpdate
+	}
+
+	return current, nil
+}
+
+// Delete will remove the team with the received id from repository, with its members
+func (teamStorage TeamStorage) Delete(ctx context.Context, id int64) error {
+	if err := teamStorage.repository.DeleteTeam(ctx, id); err != nil {
+		log.Error(ctx, "there was an error deleting team", log.Int64("team_id", id), log.Err(err))
+		if errors.Is(err, ErrTeamNotFound) {
+			return ErrNotFoundTeam
+		}
+		return ErrStorageDelete
+	}
+
+	return nil
+}
+
+// normalizeTeam validate the team name, trimming its spaces
+func normalizeTeam(ctx context.Context, team Team) (Team, error) {
+	team.Name = strings.TrimSpace(team.Name)
+	if team.Name == "" || len(team.Name) > maxTeamNameLength {
+		log.Info(ctx, "invalid check on team: invalid name", log.String("team_name", team.Name))
+		return Team{}, ErrInvalidTeamName
+	}
+
+	return team, nil
+}
@@ -0,0 +1,288 @@
+package team
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+// mockDb a 'db' to use on TeamStorage test with the capabilities to mock errors on save/get action
+type mockDb struct {
+	idCount int64
+	teams   map[int64]Team
+	// members are the user ids by team id, users from 1 to 3 are drivers and 4 is a dispatcher, the others are
+	// admins or do not exist
+	members map[int64][]int64
+
+	saveError error
+	getError  error
+}
+
+func newMockDB() *mockDb {
+	return &mockDb{
+		idCount: 1,
+		teams:   make(map[int64]Team),
+		members: make(map[int64][]int64),
+	}
+}
+
+func newMockDBFromMap(teams map[int64]Team) *mockDb {
+	return &mockDb{
+		idCount: int64(len(teams) + 1),
+		teams:   teams,
+		members: make(map[int64][]int64),
+	}
+}
+
+func (db *mockDb) onCreate(err error) *mockDb {
+	db.saveError = err
+
+	return db
+}
+
+func (db *mockDb) onGet(err error) *mockDb {
+	db.getError = err
+
+	return db
+}
+
+func (db *mockDb) SaveTeam(ctx context.Context, team Team) (Team, error) {
+	if db.saveError != nil {
+		return Team{}, db.saveError
+	}
+
+	team.ID = db.idCount
+	db.teams[team.ID] = team
+
+	db.idCount++
+
+	return team, nil
+}
+
+func (db mockDb) GetTeam(ctx context.Context, id int64) (Team, error) {
+	if db.getError != nil {
+		return Team{}, db.getError
+	}
+
+	team, exist := db.teams[id]
+	if !exist {
+		return Team{}, ErrTeamNotFound
+	}
+
+	return team, nil
+}
+
+func (db mockDb) GetTeams(ctx context.Context) ([]Team, error) {
+	if db.getError != nil {
+		return nil, db.getError
+	}
+
+	var teams []Team
+	for _, team := range db.teams {
+		teams = append(teams, team)
+	}
+
+	sort.Slice(teams, func(i, j int) bool { return teams[i].ID < teams[j].ID })
+
+	return teams, nil
+}
+
+func (db *mockDb) UpdateTeam(ctx context.Context, team Team) error {
+	if _, exist := db.teams[team.ID]; !exist {
+		return ErrTeamNotFound
+	}
+
+	db.teams[team.ID] = team
+
+	return nil
+}
+
+func (db *mockDb) DeleteTeam(ctx context.Context, id int64) error {
+	if _, exist := db.teams[id]; !exist {
+		return ErrTeamNotFound
+	}
+
+	delete(db.teams, id)
+	delete(db.members, id)
+
+	return nil
+}
+
+func (db *mockDb) AddTeamMember(ctx context.Context, teamID, userID int64) error {
+	if userID < 1 || userID > 4 {
+		return ErrMemberNotFound
+	}
+
+	for _, id := range db.members[teamID] {
+		if id == userID {
+			return nil
+		}
+	}
+
+	db.members[teamID] = append(db.members[teamID], userID)
+
+	return nil
+}
+
+func (db *mockDb) RemoveTeamMember(ctx context.Context, teamID, userID int64) error {
+	for i, id := range db.members[teamID] {
+		if id == userID {
+			db.members[teamID] = append(db.members[teamID][:i], db.members[teamID][i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrTeamMemberNotFound
+}
+
+func (db mockDb) GetTeamMembers(ctx context.Context, teamID int64) ([]int64, error) {
+	if db.getError != nil {
+		return nil, db.getError
+	}
+
+	return db.members[teamID], nil
+}
+
+func (db mockDb) GetUserTeams(ctx context.Context, userID int64) ([]int64, error) {
+	if db.getError != nil {
+		return nil, db.getError
+	}
+
+	var teamIDs []int64
+	for teamID, userIDs := range db.members {
+		for _, id := range userIDs {
+			if id == userID {
+				teamIDs = append(teamIDs, teamID)
+			}
+		}
+	}
+
+	sort.Slice(teamIDs, func(i, j int) bool { return teamIDs[i] < teamIDs[j] })
+
+	return teamIDs, nil
+}
+
+func Test_saveTeam(t *testing.T) {
+	tests := map[string]struct {
+		db       repository
+		team     Team
+		want     string
+		expected error
+	}{
+		"successful save team": {
+			db:   newMockDB(),
+			team: Team{Name: "north"},
+			want: "north",
+		},
+
+		"successful save team trimming name": {
+			db:   newMockDB(),
+			team: Team{Name: "  south "},
+			want: "south",
+		},
+
+		"error on save team: empty name": {
+			db:       newMockDB(),
+			team:     Team{Name: " "},
+			expected: ErrInvalidTeamName,
+		},
+
+		"error on save team: too long name": {
+			db:       newMockDB(),
+			team:     Team{Name: "a team name with more than fifty characters on it..."},
+			expected: ErrInvalidTeamName,
+		},
+
+		"db failure on save team": {
+			db:       newMockDB().onCreate(errors.New("mocked save error")),
+			team:     Team{Name: "north"},
+			expected: ErrStorageSave,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			teamStorage := NewTeamStorage(tc.db)
+			result, err := teamStorage.Save(context.Background(), tc.team)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Greater(t, result.ID, int64(0))
+				assert.Equal(t, tc.want, result.Name)
+				assert.False(t, result.CreatedAt.IsZero())
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_updateAndDeleteTeam(t *testing.T) {
+	db := newMockDBFromMap(map[int64]Team{1: {ID: 1, Name: "north"}})
+	db.members[1] = []int64{1, 2}
+	teamStorage := NewTeamStorage(db)
+
+	result, err := teamStorage.Update(context.Background(), Team{ID: 1, Name: "north east"})
+
+	assert.Nil(t, err)
+	assert.Equal(t, Team{ID: 1, Name: "north east"}, result)
+	assert.Equal(t, result, db.teams[1])
+
+	_, err = teamStorage.Update(context.Background(), Team{ID: 2, Name: "south"})
+	assert.Equal(t, ErrNotFoundTeam.Error(), err.Error())
+
+	assert.Nil(t, teamStorage.Delete(context.Background(), 1))
+	assert.Empty(t, db.teams)
+	assert.Empty(t, db.members)
+
+	err = teamStorage.Delete(context.Background(), 1)
+	assert.Equal(t, ErrNotFoundTeam.Error(), err.Error())
+}
+
+func Test_teamMembers(t *testing.T) {
+	db := newMockDBFromMap(map[int64]Team{1: {ID: 1, Name: "north"}, 2: {ID: 2, Name: "south"}})
+	teamStorage := NewTeamStorage(db)
+	ctx := context.Background()
+
+	assert.Nil(t, teamStorage.AddMember(ctx, 1, 2))
+	// adding twice has no effect
+	assert.Nil(t, teamStorage.AddMember(ctx, 1, 2))
+	assert.Nil(t, teamStorage.AddMember(ctx, 1, 4))
+	assert.Nil(t, teamStorage.AddMember(ctx, 2, 4))
+
+	members, err := teamStorage.Members(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, TeamMembers{TeamID: 1, UserIDs: []int64{2, 4}}, members)
+
+	teams, err := teamStorage.UserTeams(ctx, 4)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 2}, teams)
+
+	err = teamStorage.AddMember(ctx, 1, 10)
+	assert.Equal(t, ErrInvalidTeamMember.Error(), err.Error())
+
+	err = teamStorage.AddMember(ctx, 3, 1)
+	assert.Equal(t, ErrNotFoundTeam.Error(), err.Error())
+
+	_, err = teamStorage.Members(ctx, 3)
+	assert.Equal(t, ErrNotFoundTeam.Error(), err.Error())
+
+	assert.Nil(t, teamStorage.RemoveMember(ctx, 1, 4))
+
+	err = teamStorage.RemoveMember(ctx, 1, 4)
+	assert.Equal(t, ErrNotFoundTeamMember.Error(), err.Error())
+
+	members, err = teamStorage.Members(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2}, members.UserIDs)
+
+	members, err = teamStorage.Members(ctx, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{4}, members.UserIDs)
+
+	_, err = NewTeamStorage(newMockDB().onGet(errors.New("mocked get error"))).UserTeams(ctx, 4)
+	assert.Equal(t, ErrStorageGet.Error(), err.Error())
+}
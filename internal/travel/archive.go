@@ -0,0 +1,37 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"time"
+)
+
+const travelsArchivedMetric = "application.space.travels.archived"
+
+// Archive move the ready and cancelled travels created more than retention ago to the archive, where they can
+// still be got by id. It return the ids of the archived travels
+func (travelStorage TravelStorage) Archive(ctx context.Context, retention time.Duration) ([]int64, error) {
+	ids, err := travelStorage.repository.ArchiveTravels(ctx, travelStorage.clock.Now().UTC().Add(-retention))
+	if err != nil {
+		log.Error(ctx, "there was an error archiving travels", log.Err(err))
+		metrics.Inc(ctx, travelsArchivedMetric, []string{"result", "false"})
+		return nil, ErrStorageUpdate
+	}
+
+	if len(ids) > 0 {
+		log.Info(ctx, "travels archived", log.Int64("travels_count", int64(len(ids))))
+	}
+	metrics.Count(ctx, travelsArchivedMetric, int64(len(ids)), []string{"result", "true"})
+
+	return ids, nil
+}
+
+// ArchiveEvery run Archive every interval, until the context is done. It is meant to be run on its own goroutine. With
+// a lock set (see WithLock) it only runs on one instance of the api
+func (travelStorage TravelStorage) ArchiveEvery(ctx context.Context, interval, retention time.Duration) {
+	travelStorage.runEvery(ctx, "archive", interval, func() {
+		// errors are already logged and measured, the next run will retry
+		_, _ = travelStorage.Archive(ctx, retention)
+	})
+}
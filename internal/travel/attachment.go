@@ -0,0 +1,138 @@
+package travel
+
+import (
+	"context"
+	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/filestore"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/user"
+	"net/http"
+	"time"
+)
+
+// MaxAttachmentSize is the biggest attachment file accepted, in bytes
+const MaxAttachmentSize = 5 << 20
+
+type AttachmentKind string
+
+const (
+	// AttachmentPhoto is a photo of the delivered travel
+	AttachmentPhoto AttachmentKind = "photo"
+	// AttachmentSignature is the signature of who received the travel
+	AttachmentSignature AttachmentKind = "signature"
+)
+
+// attachmentExtensions are the accepted attachment content types with the extension used to store them
+var attachmentExtensions = map[string]string{
+	"image/png":  "png",
+	"image/jpeg": "jpg",
+}
+
+var (
+	ErrInvalidAttachmentKind = code_error.Error{Code: "invalid_attachment", Detail: "the attachment kind should be photo or signature"}
+	ErrInvalidAttachmentFile = code_error.Error{Code: "invalid_attachment", Detail: "the attachment should be a png or jpeg image of up to 5 MB"}
+	ErrInvalidStatusToAttach = code_error.Error{Code: "invalid_status", Detail: "only in process or ready travels can have attachments"}
+	ErrStorageSaveAttachment = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to save travel attachment"}
+)
+
+// Attachment is the metadata of a proof of delivery (photo or signature) uploaded for a travel, the file is saved
+// on the attachments store with the attachment key
+type Attachment struct {
+	ID          int64          `json:"id"`
+	TravelID    int64          `json:"travel_id"`
+	UserID      int64          `json:"user_id"`
+	Kind        AttachmentKind `json:"kind"`
+	ContentType string         `json:"content_type"`
+	Size        int64          `json:"size"`
+	Key         string         `json:"key"`
+	CreatedAt   time.Time      `json:"created_at"`
+}
+
+// WithAttachmentStore set the store where the attachment files are saved, without it attachments cannot be saved
+func WithAttachmentStore(store filestore.Store) TravelStorageOption {
+	return func(tst *TravelStorage) {
+		tst.attachments = store
+	}
+}
+
+// Attach will save the received content as an attachment of the travel with the received id. Only the driver
+// assigned to the travel (or an admin) can attach files, while it is in process or once it is ready
+func (travelStorage TravelStorage) Attach(ctx context.Context, travelID int64, kind AttachmentKind,
+	content []byte) (Attachment, error) {
+	if kind != AttachmentPhoto && kind != AttachmentSignature {
+		log.Info(ctx, "invalid check on attach travel file: invalid kind",
+			log.Int64("travel_id", travelID),
+			log.String("attachment_kind", string(kind)))
+		return Attachment{}, ErrInvalidAttachmentKind
+	}
+
+	contentType := http.DetectContentType(content)
+	extension, ok := attachmentExtensions[contentType]
+	if !ok || len(content) > MaxAttachmentSize {
+		log.Info(ctx, "invalid check on attach travel file: invalid file",
+			log.Int64("travel_id", travelID),
+			log.String("attachment_content_type", contentType),
+			log.Int64("attachment_size", int64(len(content))))
+		return Attachment{}, ErrInvalidAttachmentFile
+	}
+
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims",
+			log.Int64("travel_id", travelID))
+		return Attachment{}, ErrInvalidUserClaims
+	}
+
+	travel, err := travelStorage.Get(ctx, travelID)
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	if travel.Status != StatusInProcess && travel.Status != StatusReady {
+		log.Info(ctx, "invalid check on attach travel file: travel is not in process nor ready",
+			log.Int64("travel_id", travelID),
+			log.String("travel_status", string(travel.Status)))
+		return Attachment{}, ErrInvalidStatusToAttach
+	}
+
+	if !user.ClaimsPermissions(userLogged).Has(user.PermissionTravelAdmin) && userLogged.UserID != travel.UserID {
+		log.Info(ctx, "invalid check on attach travel file: the user logged in is not the travel driver",
+			log.Int64("travel_id", travelID),
+			log.Int64("travel_user_id", travel.UserID),
+			log.Int64("logged_user_id", userLogged.UserID))
+		return Attachment{}, ErrInvalidUserAccess
+	}
+
+	if travelStorage.attachments == nil {
+		log.Error(ctx, "there is no attachments store configured", log.Int64("travel_id", travelID))
+		return Attachment{}, ErrStorageSaveAttachment
+	}
+
+	now := travelStorage.clock.Now().UTC()
+	attachment := Attachment{
+		TravelID:    travel.ID,
+		UserID:      userLogged.UserID,
+		Kind:        kind,
+		ContentType: contentType,
+		Size:        int64(len(content)),
+		Key:         fmt.Sprintf("travels/%d/%s-%d.%s", travel.ID, kind, now.UnixNano(), extension),
+		CreatedAt:   now.Truncate(time.Second),
+	}
+
+	if err := travelStorage.attachments.Put(ctx, attachment.Key, content, contentType); err != nil {
+		log.Error(ctx, "there was an error while saving travel attachment file", log.Int64("travel_id", travelID),
+			log.String("attachment_key", attachment.Key), log.Err(err))
+		return Attachment{}, ErrStorageSaveAttachment
+	}
+
+	saved, err := travelStorage.repository.SaveAttachment(ctx, attachment)
+	if err != nil {
+		log.Error(ctx, "there was an error while saving travel attachment", log.Int64("travel_id", travelID),
+			log.String("attachment_key", attachment.Key), log.Err(err))
+		return Attachment{}, ErrStorageSaveAttachment
+	}
+
+	return saved, nil
+}
@@ -0,0 +1,125 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/user"
+)
+
+// maxBatchSize is the max quantity of travels updated on a batch
+const maxBatchSize = 100
+
+var (
+	ErrInvalidBatchSize      = code_error.Error{Code: "invalid_batch", Detail: "the batch should have between 1 and 100 travel ids"}
+	ErrInvalidStatusToCancel = code_error.Error{Code: "invalid_status", Detail: "only pending or in process travels can be cancelled"}
+)
+
+// BatchResult is the result of updating one of the travels of a batch, Err is nil if the travel was updated
+type BatchResult struct {
+	ID     int64
+	Travel Travel
+	Err    error
+}
+
+// UpdateStatus will change the status of the travel with the received id keeping the rest of it, with the same
+// validations of Update. A travel can also be cancelled if it is pending or in process
+func (travelStorage TravelStorage) UpdateStatus(ctx context.Context, id int64, status Status) (Travel, error) {
+	validate := travelStorage.validateTravelUpdate
+	if status == StatusCancelled {
+		validate = validateTravelCancel
+	}
+
+	var travel Travel
+	var validationErr error
+	found := false
+	completed := false
+
+	err := travelStorage.repository.EditTravel(ctx, id, func(current Travel) (Travel, []Event, error) {
+		found = true
+
+		if current.DeletedAt != nil {
+			validationErr = ErrNotFoundTravel
+			return Travel{}, nil, validationErr
+		}
+
+		travel = current
+		travel.Status = status
+
+		if validationErr = travelStorage.validateUpdate(ctx, current, travel, validate); validationErr != nil {
+			return Travel{}, nil, validationErr
+		}
+
+		completed = current.Status != StatusReady && travel.Status == StatusReady
+		travel = travelStorage.recordDuration(current, travel)
+
+		return travel, nil, nil
+	})
+	if err != nil {
+		if validationErr != nil {
+			return Travel{}, validationErr
+		}
+
+		log.Error(ctx, "there was an error while updating travel status", log.Int64("travel_id", id), log.Err(err))
+		return Travel{}, mapEditError(err, found)
+	}
+
+	if completed {
+		travelStorage.measureDuration(ctx, travel)
+	}
+
+	return travel, nil
+}
+
+// BatchUpdateStatus will change the status of every travel with the received ids (see UpdateStatus), each travel
+// is updated on its own so a failure does not stop the rest. It return a result for each different id, in the
+// received order
+func (travelStorage TravelStorage) BatchUpdateStatus(ctx context.Context, ids []int64, status Status) ([]BatchResult, error) {
+	if len(ids) == 0 || len(ids) > maxBatchSize {
+		log.Info(ctx, "invalid check on batch update travel status: invalid batch size",
+			log.Int64("batch_size", int64(len(ids))))
+		return nil, ErrInvalidBatchSize
+	}
+
+	if !isValidStatus(status) {
+		log.Info(ctx, "invalid check on batch update travel status: invalid status",
+			log.String("travel_status", string(status)))
+		return nil, ErrInvalidStatusToEdit
+	}
+
+	results := make([]BatchResult, 0, len(ids))
+	updated := make(map[int64]bool, len(ids))
+	for _, id := range ids {
+		if updated[id] {
+			continue
+		}
+		updated[id] = true
+
+		travel, err := travelStorage.UpdateStatus(ctx, id, status)
+		results = append(results, BatchResult{ID: id, Travel: travel, Err: err})
+	}
+
+	return results, nil
+}
+
+// validateTravelCancel business validation on cancel travel
+func validateTravelCancel(ctx context.Context, travel Travel, changes Travel, userLogged jwt.Claims) error {
+	// only admins can cancel travels
+	if !user.ClaimsPermissions(userLogged).Has(user.PermissionTravelAdmin) {
+		log.Info(ctx, "invalid check on cancel travel: the user logged in is not an admin",
+			log.Int64("travel_id", travel.ID),
+			log.Int64("logged_user_id", userLogged.UserID),
+			log.String("logged_role", userLogged.Role))
+		return ErrInvalidUserAccess
+	}
+
+	if travel.Status != StatusPending && travel.Status != StatusInProcess {
+		log.Info(ctx, "invalid check on cancel travel: travel is not pending nor in process",
+			log.Int64("travel_id", travel.ID),
+			log.String("travel_status", string(travel.Status)))
+		return ErrInvalidStatusToCancel
+	}
+
+	return nil
+}
@@ -0,0 +1,85 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"time"
+)
+
+var (
+	ErrInvalidStatusToDelete = code_error.Error{Code: "invalid_status", Detail: "in process and queued travels cannot be deleted"}
+	ErrNotDeletedTravel      = code_error.Error{Code: "not_deleted_travel", Detail: "the travel to restore is not deleted"}
+)
+
+// Delete will soft delete the travel with the received id, it is kept on repository but skipped by default on
+// gets and searches. In process and queued travels cannot be deleted
+func (travelStorage TravelStorage) Delete(ctx context.Context, id int64) error {
+	var validationErr error
+	found := false
+
+	err := travelStorage.repository.EditTravel(ctx, id, func(current Travel) (Travel, []Event, error) {
+		found = true
+
+		if current.DeletedAt != nil {
+			validationErr = ErrNotFoundTravel
+			return Travel{}, nil, validationErr
+		}
+
+		if current.Status == StatusInProcess || current.Status == StatusQueued {
+			log.Info(ctx, "invalid check on delete travel: travel is in process or queued",
+				log.Int64("travel_id", id),
+				log.String("travel_status", string(current.Status)))
+			validationErr = ErrInvalidStatusToDelete
+			return Travel{}, nil, validationErr
+		}
+
+		deletedAt := travelStorage.clock.Now().UTC().Truncate(time.Second)
+		current.DeletedAt = &deletedAt
+
+		return current, nil, nil
+	})
+	if err != nil {
+		if validationErr != nil {
+			return validationErr
+		}
+
+		log.Error(ctx, "there was an error while deleting travel", log.Int64("travel_id", id), log.Err(err))
+		return mapEditError(err, found)
+	}
+
+	return nil
+}
+
+// Restore will undo the soft delete of the travel with the received id and return it
+func (travelStorage TravelStorage) Restore(ctx context.Context, id int64) (Travel, error) {
+	var travel Travel
+	var validationErr error
+	found := false
+
+	err := travelStorage.repository.EditTravel(ctx, id, func(current Travel) (Travel, []Event, error) {
+		found = true
+
+		if current.DeletedAt == nil {
+			log.Info(ctx, "invalid check on restore travel: travel is not deleted",
+				log.Int64("travel_id", id))
+			validationErr = ErrNotDeletedTravel
+			return Travel{}, nil, validationErr
+		}
+
+		travel = current
+		travel.DeletedAt = nil
+
+		return travel, nil, nil
+	})
+	if err != nil {
+		if validationErr != nil {
+			return Travel{}, validationErr
+		}
+
+		log.Error(ctx, "there was an error while restoring travel", log.Int64("travel_id", id), log.Err(err))
+		return Travel{}, mapEditError(err, found)
+	}
+
+	return travel, nil
+}
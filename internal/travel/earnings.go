@@ -0,0 +1,166 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"time"
+)
+
+const (
+	// DefaultEarningsDays is the quantity of days of the earnings when no range is received
+	DefaultEarningsDays = 30
+	maxEarningsDays     = 366
+)
+
+// EarningsPeriod is the period used to total the earnings of a driver
+type EarningsPeriod string
+
+const (
+	EarningsPeriodDay  EarningsPeriod = "day"
+	EarningsPeriodWeek EarningsPeriod = "week"
+)
+
+var (
+	ErrInvalidEarningsPeriod = code_error.Error{Code: "invalid_period", Detail: "the earnings period should be day or week"}
+	ErrInvalidEarningsRange  = code_error.Error{Code: "invalid_range", Detail: "the earnings range should be of up to 366 days"}
+	ErrInvalidUserEarnings   = code_error.Error{Code: "invalid_user_access", Detail: "the user logged in cannot get the earnings of another user"}
+)
+
+// EarningsQuery are the parameters of the earnings of a driver, zero values are replaced by the defaults
+type EarningsQuery struct {
+	// From is the date (inclusive) of the first completed travels, by default DefaultEarningsDays before To
+	From time.Time
+	// To is the date (exclusive) of the last completed travels, by default the start of tomorrow (UTC)
+	To time.Time
+	// Period is how the earnings are totaled, by default EarningsPeriodDay
+	Period EarningsPeriod
+}
+
+// Earnings is the fare of the travels completed by a driver on a range of dates, totaled by period
+type Earnings struct {
+	UserID  int64            `json:"user_id"`
+	From    time.Time        `json:"from"`
+	To      time.Time        `json:"to"`
+	Period  EarningsPeriod   `json:"period"`
+	Travels int64            `json:"travels"`
+	Total   float64          `json:"total"`
+	Periods []PeriodEarnings `json:"periods"`
+}
+
+// PeriodEarnings is the quantity and the fare of the travels completed on a period, formatted as its start date
+// (weeks start on monday)
+type PeriodEarnings struct {
+	Start   string  `json:"start"`
+	Travels int64   `json:"travels"`
+	Total   float64 `json:"total"`
+}
+
+// Earnings return the fare of the ready travels completed by the user on the query range, totaled by period. The fare
+// of each travel is quoted with the fare engine (see Pricing), every period of the range is returned even if it has
+// no travels. Archived travels are not included. The earnings of a driver out of the teams of the user logged in are
+// not found (see WithTeamFinder)
+func (travelStorage TravelStorage) Earnings(ctx context.Context, userID int64, query EarningsQuery) (Earnings, error) {
+	if query.Period == "" {
+		query.Period = EarningsPeriodDay
+	}
+	if query.To.IsZero() {
+		query.To = startOfDay(travelStorage.clock.Now().UTC()).AddDate(0, 0, 1)
+	}
+	if query.From.IsZero() {
+		query.From = query.To.AddDate(0, 0, -DefaultEarningsDays)
+	}
+
+	if query.Period != EarningsPeriodDay && query.Period != EarningsPeriodWeek {
+		log.Info(ctx, "invalid check on driver earnings: invalid period", log.String("period", string(query.Period)))
+		return Earnings{}, ErrInvalidEarningsPeriod
+	}
+
+	if !query.From.Before(query.To) || query.To.Sub(query.From) > maxEarningsDays*24*time.Hour {
+		log.Info(ctx, "invalid check on driver earnings: invalid range",
+			log.String("from", query.From.Format(time.RFC3339)),
+			log.String("to", query.To.Format(time.RFC3339)))
+		return Earnings{}, ErrInvalidEarningsRange
+	}
+
+	if err := travelStorage.checkDriverTeam(ctx, userID); err != nil {
+		return Earnings{}, err
+	}
+
+	earnings := Earnings{
+		UserID: userID,
+		From:   query.From,
+		To:     query.To,
+		Period: query.Period,
+	}
+
+	// every period is returned, even the ones without travels
+	index := make(map[string]int)
+	for start := periodStart(query.From, query.Period); start.Before(query.To); start = nextPeriod(start, query.Period) {
+		date := start.Format(statsDayLayout)
+		index[date] = len(earnings.Periods)
+		earnings.Periods = append(earnings.Periods, PeriodEarnings{Start: date})
+	}
+
+	search := Search{
+		UserID:        userID,
+		Status:        []Status{StatusReady},
+		CompletedFrom: query.From,
+		CompletedTo:   query.To,
+	}
+	err := travelStorage.repository.IterateTravels(ctx, search, func(travel Travel) error {
+		if travel.CompletedAt == nil {
+			return nil
+		}
+		i, ok := index[periodStart(*travel.CompletedAt, query.Period).Format(statsDayLayout)]
+		if !ok {
+			return nil
+		}
+
+		fare := travelStorage.pricing.Estimate(travel.From, travel.To).Fare
+		period := &earnings.Periods[i]
+		period.Travels++
+		period.Total += fare
+		earnings.Travels++
+		earnings.Total += fare
+
+		return nil
+	})
+	if err != nil {
+		log.Error(ctx, "there was an error getting travels on driver earnings", log.Int64("user_id", userID),
+			log.Err(err))
+		return Earnings{}, ErrStorageGet
+	}
+
+	earnings.Total = roundCents(earnings.Total)
+	for i := range earnings.Periods {
+		earnings.Periods[i].Total = roundCents(earnings.Periods[i].Total)
+	}
+
+	return earnings, nil
+}
+
+// startOfDay return the start of the day (on its location) of the received date
+func startOfDay(date time.Time) time.Time {
+	return time.Date(date.Year(), date.Month(), date.Day(), 0, 0, 0, 0, date.Location())
+}
+
+// periodStart return the start of the day or of the week (on monday) of the received date
+func periodStart(date time.Time, period EarningsPeriod) time.Time {
+	day := startOfDay(date.UTC())
+	if period == EarningsPeriodWeek {
+		// sunday is the last day of the week
+		return day.AddDate(0, 0, -((int(day.Weekday()) + 6) % 7))
+	}
+
+	return day
+}
+
+// nextPeriod return the start of the period after the one starting on the received date
+func nextPeriod(start time.Time, period EarningsPeriod) time.Time {
+	if period == EarningsPeriodWeek {
+		return start.AddDate(0, 0, 7)
+	}
+
+	return start.AddDate(0, 0, 1)
+}
@@ -0,0 +1,41 @@
+package travel
+
+import "time"
+
+type EventType string
+
+const (
+	// EventExpired is recorded when a pending travel is cancelled for being pending for too long
+	EventExpired EventType = "expired"
+	// EventReassigned is recorded when an in process travel is reassigned, the detail is the reason
+	EventReassigned EventType = "reassigned"
+	// EventStatusChanged is recorded every time the status of a travel changes, the detail is the status left
+	EventStatusChanged EventType = "status_changed"
+	// EventOffered is recorded when a travel is offered to a driver, the detail is the user id of the driver
+	EventOffered EventType = "offered"
+	// EventOfferAccepted is recorded when the driver accepts the offered travel, the detail is its user id
+	EventOfferAccepted EventType = "offer_accepted"
+	// EventOfferRejected is recorded when the driver rejects the offered travel, the detail is its user id
+	EventOfferRejected EventType = "offer_rejected"
+	// EventOfferExpired is recorded when the driver does not answer the offer in time, the detail is its user id
+	EventOfferExpired EventType = "offer_expired"
+	// EventOverdue is recorded once when an in process travel exceeds its deadline, the detail is the deadline
+	EventOverdue EventType = "overdue"
+	// EventQueued is recorded when a travel is queued to a driver, the detail is the user id of the driver
+	EventQueued EventType = "queued"
+	// EventDequeued is recorded when a travel is removed from the queue of a driver, the detail is its user id
+	EventDequeued EventType = "dequeued"
+	// EventPromoted is recorded when a queued travel is set in process because its driver left the in process
+	// travel, the detail is the id of the travel left
+	EventPromoted EventType = "promoted"
+)
+
+// Event is a record of something that happened to a travel outside its regular update flow, it is stored on the
+// travel events table
+type Event struct {
+	ID        int64     `json:"id"`
+	TravelID  int64     `json:"travel_id"`
+	Type      EventType `json:"type"`
+	Detail    string    `json:"detail,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,41 @@
+package travel
+
+import (
+	"context"
+	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"time"
+)
+
+const travelsExpiredMetric = "application.space.travels.expired"
+
+// ExpirePending cancel the pending travels created more than maxAge ago, recording an EventExpired for each one.
+// It return the ids of the cancelled travels
+func (travelStorage TravelStorage) ExpirePending(ctx context.Context, maxAge time.Duration) ([]int64, error) {
+	createdBefore := travelStorage.clock.Now().UTC().Add(-maxAge)
+
+	ids, err := travelStorage.repository.ExpirePending(ctx, createdBefore,
+		fmt.Sprintf("the travel was pending for more than %s", maxAge))
+	if err != nil {
+		log.Error(ctx, "there was an error expiring pending travels", log.Err(err))
+		metrics.Inc(ctx, travelsExpiredMetric, []string{"result", "false"})
+		return nil, ErrStorageUpdate
+	}
+
+	if len(ids) > 0 {
+		log.Info(ctx, "pending travels expired", log.Int64("travels_count", int64(len(ids))))
+	}
+	metrics.Count(ctx, travelsExpiredMetric, int64(len(ids)), []string{"result", "true"})
+
+	return ids, nil
+}
+
+// ExpirePendingEvery run ExpirePending every interval, until the context is done. It is meant to be run on its own
+// goroutine. With a lock set (see WithLock) it only runs on one instance of the api
+func (travelStorage TravelStorage) ExpirePendingEvery(ctx context.Context, interval, maxAge time.Duration) {
+	travelStorage.runEvery(ctx, "expire_pending", interval, func() {
+		// errors are already logged and measured, the next run will retry
+		_, _ = travelStorage.ExpirePending(ctx, maxAge)
+	})
+}
@@ -0,0 +1,127 @@
+package travel
+
+import (
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"strings"
+)
+
+// MaxGeohashPrecision is the longest geohash encoded, cells of a few centimeters
+const MaxGeohashPrecision = 12
+
+// geohashBase32 is the alphabet of the geohash characters, each one encodes 5 bits
+const geohashBase32 = "0123456789bcdefghjkmnpqrstuvwxyz"
+
+var ErrInvalidGeohash = code_error.Error{Code: "invalid_geohash", Detail: "the geohash should have 1 to 12 base32 characters"}
+
+// Geohash encode the point as a geohash of the received length (clamped to [1, MaxGeohashPrecision]), the same
+// value the ST_GeoHash sql function returns. Points on the same cell share the geohash, so it can be used to bucket
+// locations
+func (p Point) Geohash(precision int) string {
+	if precision < 1 {
+		precision = 1
+	}
+	if precision > MaxGeohashPrecision {
+		precision = MaxGeohashPrecision
+	}
+
+	latRange, lngRange := [2]float64{-90, 90}, [2]float64{-180, 180}
+
+	hash := make([]byte, 0, precision)
+	even, bit, index := true, 0, 0
+	for len(hash) < precision {
+		value, bounds := p.Lat, &latRange
+		if even {
+			value, bounds = p.Lng, &lngRange
+		}
+
+		mid := (bounds[0] + bounds[1]) / 2
+		index <<= 1
+		if value >= mid {
+			index |= 1
+			bounds[0] = mid
+		} else {
+			bounds[1] = mid
+		}
+
+		even = !even
+		if bit++; bit == 5 {
+			hash = append(hash, geohashBase32[index])
+			bit, index = 0, 0
+		}
+	}
+
+	return string(hash)
+}
+
+// GeohashBounds return the south-west and north-east corners of the cell of the received geohash, it return
+// ErrInvalidGeohash if the geohash is empty, too long or has characters out of the geohash alphabet
+func GeohashBounds(hash string) (Point, Point, error) {
+	hash = strings.ToLower(hash)
+	if hash == "" || len(hash) > MaxGeohashPrecision {
+		return Point{}, Point{}, ErrInvalidGeohash
+	}
+
+	latRange, lngRange := [2]float64{-90, 90}, [2]float64{-180, 180}
+
+	even := true
+	for _, char := range hash {
+		index := strings.IndexRune(geohashBase32, char)
+		if index == -1 {
+			return Point{}, Point{}, ErrInvalidGeohash
+		}
+
+		for mask := 16; mask > 0; mask >>= 1 {
+			bounds := &latRange
+			if even {
+				bounds = &lngRange
+			}
+
+			mid := (bounds[0] + bounds[1]) / 2
+			if index&mask != 0 {
+				bounds[0] = mid
+			} else {
+				bounds[1] = mid
+			}
+
+			even = !even
+		}
+	}
+
+	return Point{Lat: latRange[0], Lng: lngRange[0]}, Point{Lat: latRange[1], Lng: lngRange[1]}, nil
+}
+
+// GeohashNeighbors return the geohashes of the cells around the received one, clockwise from the north: north,
+// north-east, east, south-east, south, south-west, west and north-west. The cells wrap around the antimeridian and
+// there are no cells beyond the poles, so cells on the poles have fewer neighbors
+func GeohashNeighbors(hash string) ([]string, error) {
+	southWest, northEast, err := GeohashBounds(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	height := northEast.Lat - southWest.Lat
+	width := northEast.Lng - southWest.Lng
+	center := Point{Lat: southWest.Lat + height/2, Lng: southWest.Lng + width/2}
+
+	directions := [][2]float64{{1, 0}, {1, 1}, {0, 1}, {-1, 1}, {-1, 0}, {-1, -1}, {0, -1}, {1, -1}}
+
+	neighbors := make([]string, 0, len(directions))
+	for _, direction := range directions {
+		lat := center.Lat + direction[0]*height
+		if lat > 90 || lat < -90 {
+			continue
+		}
+
+		lng := center.Lng + direction[1]*width
+		if lng > 180 {
+			lng -= 360
+		}
+		if lng < -180 {
+			lng += 360
+		}
+
+		neighbors = append(neighbors, Point{Lat: lat, Lng: lng}.Geohash(len(hash)))
+	}
+
+	return neighbors, nil
+}
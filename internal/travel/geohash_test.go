@@ -0,0 +1,60 @@
+package travel
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_PointGeohash(t *testing.T) {
+	p := Point{Lat: 57.64911, Lng: 10.40744}
+
+	assert.Equal(t, "u4pruydqqvj", p.Geohash(11))
+	assert.Equal(t, "u4pru", p.Geohash(5))
+	assert.Equal(t, "u", p.Geohash(0))
+	assert.Len(t, p.Geohash(20), MaxGeohashPrecision)
+
+	// every point of a cell has the same geohash
+	southWest, northEast, err := GeohashBounds("u4pru")
+	assert.Nil(t, err)
+	assert.Equal(t, "u4pru", southWest.Geohash(5))
+	center := Point{Lat: (southWest.Lat + northEast.Lat) / 2, Lng: (southWest.Lng + northEast.Lng) / 2}
+	assert.Equal(t, "u4pru", center.Geohash(5))
+	assert.True(t, southWest.Lat <= p.Lat && p.Lat < northEast.Lat)
+	assert.True(t, southWest.Lng <= p.Lng && p.Lng < northEast.Lng)
+}
+
+func Test_GeohashBounds(t *testing.T) {
+	southWest, northEast, err := GeohashBounds("EZS42")
+
+	assert.Nil(t, err)
+	assert.InDelta(t, 42.583, southWest.Lat, 0.001)
+	assert.InDelta(t, -5.625, southWest.Lng, 0.001)
+	assert.InDelta(t, 42.627, northEast.Lat, 0.001)
+	assert.InDelta(t, -5.581, northEast.Lng, 0.001)
+
+	for _, hash := range []string{"", "ezs4a", "u4pruydqqvjxy"} {
+		_, _, err := GeohashBounds(hash)
+		assert.Equal(t, ErrInvalidGeohash, err, hash)
+	}
+}
+
+func Test_GeohashNeighbors(t *testing.T) {
+	neighbors, err := GeohashNeighbors("ezs42")
+
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"ezs48", "ezs49", "ezs43", "ezs41", "ezs40", "ezefp", "ezefr", "ezefx"}, neighbors)
+
+	// the cells wrap around the antimeridian
+	neighbors, err = GeohashNeighbors("2")
+	assert.Nil(t, err)
+	assert.Contains(t, neighbors, "r")
+	assert.Contains(t, neighbors, "x")
+
+	// there are no cells beyond the poles
+	neighbors, err = GeohashNeighbors("b")
+	assert.Nil(t, err)
+	assert.Len(t, neighbors, 5)
+
+	_, err = GeohashNeighbors("ezs4a")
+	assert.Equal(t, ErrInvalidGeohash, err)
+}
@@ -0,0 +1,65 @@
+package travel
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// geoJSONPointType is the type of a GeoJSON point geometry
+const geoJSONPointType = "Point"
+
+// GeoJSONPoint is a GeoJSON point geometry (RFC 7946), its coordinates are the longitude, the latitude and the
+// optional altitude (in that order)
+type GeoJSONPoint struct {
+	Type        string    `json:"type"`
+	Coordinates []float64 `json:"coordinates"`
+}
+
+// GeoJSON return the point as a GeoJSON point geometry
+func (p Point) GeoJSON() GeoJSONPoint {
+	coordinates := []float64{p.Lng, p.Lat}
+	if p.Altitude != nil {
+		coordinates = append(coordinates, *p.Altitude)
+	}
+
+	return GeoJSONPoint{
+		Type:        geoJSONPointType,
+		Coordinates: coordinates,
+	}
+}
+
+// UnmarshalJSON read a point from its json object ({"latitude": 1, "longitude": 2, "altitude": 3}) or from a
+// GeoJSON point geometry ({"type": "Point", "coordinates": [2, 1, 3]}), the altitude is optional on both
+func (p *Point) UnmarshalJSON(data []byte) error {
+	var value struct {
+		Lat         float64   `json:"latitude"`
+		Lng         float64   `json:"longitude"`
+		Altitude    *float64  `json:"altitude"`
+		Type        *string   `json:"type"`
+		Coordinates []float64 `json:"coordinates"`
+	}
+	if err := json.Unmarshal(data, &value); err != nil {
+		return err
+	}
+
+	if value.Type == nil {
+		p.Lat = value.Lat
+		p.Lng = value.Lng
+		p.Altitude = value.Altitude
+		return nil
+	}
+
+	if *value.Type != geoJSONPointType || len(value.Coordinates) < 2 || len(value.Coordinates) > 3 {
+		return fmt.Errorf("invalid GeoJSON point: it should have type Point and two or three coordinates")
+	}
+
+	p.Lng = value.Coordinates[0]
+	p.Lat = value.Coordinates[1]
+	p.Altitude = nil
+	if len(value.Coordinates) == 3 {
+		altitude := value.Coordinates[2]
+		p.Altitude = &altitude
+	}
+
+	return nil
+}
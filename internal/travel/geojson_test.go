@@ -0,0 +1,86 @@
+package travel
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_PointGeoJSON(t *testing.T) {
+	p := Point{Lat: -34.6037, Lng: -58.3816}
+
+	data, err := json.Marshal(p.GeoJSON())
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"type": "Point", "coordinates": [-58.3816, -34.6037]}`, string(data))
+
+	altitude := 400.5
+	p.Altitude = &altitude
+
+	data, err = json.Marshal(p.GeoJSON())
+	assert.Nil(t, err)
+	assert.JSONEq(t, `{"type": "Point", "coordinates": [-58.3816, -34.6037, 400.5]}`, string(data))
+}
+
+func Test_PointUnmarshalJSON(t *testing.T) {
+	altitude := 400.5
+
+	tests := map[string]struct {
+		data     string
+		want     Point
+		hasError bool
+	}{
+		"successful unmarshal point": {
+			data: `{"latitude": -34.6037, "longitude": -58.3816}`,
+			want: Point{Lat: -34.6037, Lng: -58.3816},
+		},
+
+		"successful unmarshal GeoJSON point": {
+			data: `{"type": "Point", "coordinates": [-58.3816, -34.6037]}`,
+			want: Point{Lat: -34.6037, Lng: -58.3816},
+		},
+
+		"successful unmarshal point with altitude": {
+			data: `{"latitude": -34.6037, "longitude": -58.3816, "altitude": 400.5}`,
+			want: Point{Lat: -34.6037, Lng: -58.3816, Altitude: &altitude},
+		},
+
+		"successful unmarshal GeoJSON point with altitude": {
+			data: `{"type": "Point", "coordinates": [-58.3816, -34.6037, 400.5]}`,
+			want: Point{Lat: -34.6037, Lng: -58.3816, Altitude: &altitude},
+		},
+
+		"error on unmarshal GeoJSON point: too many coordinates": {
+			data:     `{"type": "Point", "coordinates": [-58.3816, -34.6037, 400.5, 1]}`,
+			hasError: true,
+		},
+
+		"error on unmarshal GeoJSON point: not a point": {
+			data:     `{"type": "LineString", "coordinates": [[-58.3816, -34.6037], [-56.1645, -34.9011]]}`,
+			hasError: true,
+		},
+
+		"error on unmarshal GeoJSON point: missing coordinates": {
+			data:     `{"type": "Point", "coordinates": [-58.3816]}`,
+			hasError: true,
+		},
+
+		"error on unmarshal point: invalid json": {
+			data:     `{"latitude": "south"}`,
+			hasError: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var p Point
+			err := json.Unmarshal([]byte(tc.data), &p)
+
+			if tc.hasError {
+				assert.NotNil(t, err)
+			} else {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, p)
+			}
+		})
+	}
+}
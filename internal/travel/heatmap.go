@@ -0,0 +1,114 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"time"
+)
+
+const (
+	// DefaultHeatmapPrecision is the length of the geohash cells used when none is received (cells of ~5 km)
+	DefaultHeatmapPrecision = 5
+	maxHeatmapPrecision     = 8
+
+	// DefaultHeatmapDays is the quantity of days of the heatmap when no range is received
+	DefaultHeatmapDays = 7
+	maxHeatmapDays     = 90
+)
+
+// HeatmapWindow is the time window used to bucket the travels of a heatmap by their creation date
+type HeatmapWindow string
+
+const (
+	HeatmapWindowHour HeatmapWindow = "hour"
+	HeatmapWindowDay  HeatmapWindow = "day"
+)
+
+var (
+	ErrInvalidHeatmapPrecision = code_error.Error{Code: "invalid_precision", Detail: "the heatmap precision should be between 1 and 8"}
+	ErrInvalidHeatmapWindow    = code_error.Error{Code: "invalid_window", Detail: "the heatmap window should be hour or day"}
+	ErrInvalidHeatmapRange     = code_error.Error{Code: "invalid_range", Detail: "the heatmap range should be of up to 90 days"}
+)
+
+// HeatmapQuery are the parameters of a heatmap, zero values are replaced by the defaults
+type HeatmapQuery struct {
+	// From is the date (inclusive) of the first travels, by default DefaultHeatmapDays before To
+	From time.Time
+	// To is the date (exclusive) of the last travels, by default now
+	To time.Time
+	// Precision is the length of the geohash cells
+	Precision int
+	// Window is the time bucket, by default HeatmapWindowHour
+	Window HeatmapWindow
+}
+
+// Heatmap is the quantity of travels starting (pickups) and ending (dropoffs) on each geohash cell and time window
+type Heatmap struct {
+	From      time.Time     `json:"from"`
+	To        time.Time     `json:"to"`
+	Precision int           `json:"precision"`
+	Window    HeatmapWindow `json:"window"`
+	Cells     []HeatmapCell `json:"cells"`
+}
+
+// HeatmapCell is the quantity of pickups and dropoffs on a geohash cell during a time window, the window is
+// formatted as its start date
+type HeatmapCell struct {
+	Geohash  string `json:"geohash"`
+	Window   string `json:"window"`
+	Pickups  int64  `json:"pickups"`
+	Dropoffs int64  `json:"dropoffs"`
+}
+
+// Heatmap return the pickups and dropoffs of the not deleted travels created on the query range, aggregated by
+// geohash cell and time window. Only the cells with travels are returned, ordered by window and geohash
+func (travelStorage TravelStorage) Heatmap(ctx context.Context, query HeatmapQuery) (Heatmap, error) {
+	if query.Precision == 0 {
+		query.Precision = DefaultHeatmapPrecision
+	}
+	if query.Window == "" {
+		query.Window = HeatmapWindowHour
+	}
+	if query.To.IsZero() {
+		query.To = travelStorage.clock.Now().UTC().Truncate(time.Second)
+	}
+	if query.From.IsZero() {
+		query.From = query.To.AddDate(0, 0, -DefaultHeatmapDays)
+	}
+
+	if query.Precision < 1 || query.Precision > maxHeatmapPrecision {
+		log.Info(ctx, "invalid check on travel heatmap: invalid precision", log.Int64("precision", int64(query.Precision)))
+		return Heatmap{}, ErrInvalidHeatmapPrecision
+	}
+
+	if query.Window != HeatmapWindowHour && query.Window != HeatmapWindowDay {
+		log.Info(ctx, "invalid check on travel heatmap: invalid window", log.String("window", string(query.Window)))
+		return Heatmap{}, ErrInvalidHeatmapWindow
+	}
+
+	if !query.From.Before(query.To) || query.To.Sub(query.From) > maxHeatmapDays*24*time.Hour {
+		log.Info(ctx, "invalid check on travel heatmap: invalid range",
+			log.String("from", query.From.Format(time.RFC3339)),
+			log.String("to", query.To.Format(time.RFC3339)))
+		return Heatmap{}, ErrInvalidHeatmapRange
+	}
+
+	cells, err := travelStorage.repository.Heatmap(ctx, query)
+	if err != nil {
+		log.Error(ctx, "there was an error getting travels heatmap", log.Err(err))
+		return Heatmap{}, ErrStorageGet
+	}
+
+	if cells == nil {
+		cells = []HeatmapCell{}
+	}
+
+	return Heatmap{
+		From:      query.From,
+		To:        query.To,
+		Precision: query.Precision,
+		Window:    query.Window,
+		Cells:     cells,
+	}, nil
+}
@@ -0,0 +1,100 @@
+package travel
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/lock"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"strconv"
+	"time"
+)
+
+// assignmentLockTTL is how long the assignment of a travel stays locked if the instance assigning it dies
+const assignmentLockTTL = 30 * time.Second
+
+// WithLock set the lock shared by every instance of the api, so only one of them runs each scheduled job (expire
+// pending travels and offers, check overdue travels and archive) and assigns a given travel at a time. Without it
+// every instance runs the jobs
+func WithLock(l lock.Lock) TravelStorageOption {
+	return func(tst *TravelStorage) {
+		tst.locker = l
+	}
+}
+
+// lockAssignment take the lock of the assignment of the travel with the received id, it return
+// ErrTravelUpdateConflict when another request (of any instance) is assigning it. The returned func releases it.
+// When the lock cannot be taken for another reason (as the lock server being down) the travel is assigned anyway, as
+// its edition on repository is still locked
+func (travelStorage TravelStorage) lockAssignment(ctx context.Context, id int64) (func(), error) {
+	noop := func() {}
+	if travelStorage.locker == nil {
+		return noop, nil
+	}
+
+	key := "travels.assignment." + strconv.FormatInt(id, 10)
+	release, err := travelStorage.locker.Acquire(ctx, key, assignmentLockTTL)
+	if err != nil {
+		if errors.Is(err, lock.ErrLocked) {
+			log.Info(ctx, "invalid check on assign travel: the travel is being assigned by another request",
+				log.Int64("travel_id", id))
+			return nil, ErrTravelUpdateConflict
+		}
+
+		log.Error(ctx, "there was an error locking travel assignment", log.Int64("travel_id", id), log.Err(err))
+		return noop, nil
+	}
+
+	return func() {
+		if err := release(); err != nil {
+			log.Error(ctx, "there was an error releasing travel assignment lock", log.Int64("travel_id", id),
+				log.Err(err))
+		}
+	}, nil
+}
+
+// runEvery run the job every interval, until the context is done. With a lock configured the job only runs on the
+// instance holding its lock: the lock is kept until the next run, so the job runs once per interval whatever the
+// instances are, and it expires after two intervals if the instance holding it dies
+func (travelStorage TravelStorage) runEvery(ctx context.Context, job string, interval time.Duration, run func()) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var release lock.Release
+	defer func() {
+		travelStorage.releaseJob(ctx, job, release)
+	}()
+
+	for {
+		if travelStorage.locker == nil {
+			run()
+		} else {
+			travelStorage.releaseJob(ctx, job, release)
+
+			var err error
+			release, err = travelStorage.locker.Acquire(ctx, "travels.jobs."+job, 2*interval)
+			switch {
+			case err == nil:
+				run()
+			case !errors.Is(err, lock.ErrLocked):
+				// the next run will retry
+				log.Error(ctx, "there was an error locking travel job", log.String("job", job), log.Err(err))
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (travelStorage TravelStorage) releaseJob(ctx context.Context, job string, release lock.Release) {
+	if release == nil {
+		return
+	}
+
+	if err := release(); err != nil {
+		log.Error(ctx, "there was an error releasing travel job lock", log.String("job", job), log.Err(err))
+	}
+}
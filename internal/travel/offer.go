@@ -0,0 +1,218 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"strconv"
+	"time"
+)
+
+// DefaultOfferTimeout is the time a driver has to answer an offer when none is configured
+const DefaultOfferTimeout = 5 * time.Minute
+
+const travelsOffersExpiredMetric = "application.space.travels.offers_expired"
+
+var (
+	ErrInvalidStatusToOffer  = code_error.Error{Code: "invalid_status", Detail: "only pending travels without user can be offered"}
+	ErrInvalidStatusToAnswer = code_error.Error{Code: "invalid_status", Detail: "the travel has no offer to answer"}
+	ErrInvalidOfferUser      = code_error.Error{Code: "invalid_user_access", Detail: "the travel was offered to another user"}
+	ErrOfferExpired          = code_error.Error{Code: "offer_expired", Detail: "the offer has expired"}
+)
+
+// Offer is the proposal of a pending travel to a driver, who has to accept or reject it
+type Offer struct {
+	UserID int64 `json:"user_id" binding:"required"`
+}
+
+// WithOfferTimeout set the time a driver has to answer an offer before the travel goes back to pending
+func WithOfferTimeout(timeout time.Duration) TravelStorageOption {
+	return func(tst *TravelStorage) {
+		tst.offerTimeout = timeout
+	}
+}
+
+// Offer will offer the pending travel (without user) with the received id to the driver of the offer, recording an
+// EventOffered. The driver cannot have another active travel and has until the offer timeout to answer it
+func (travelStorage TravelStorage) Offer(ctx context.Context, id int64, offer Offer) (Travel, error) {
+	return travelStorage.editOffer(ctx, id, "offer", func(current Travel) (Travel, EventType, error) {
+		if current.Status != StatusPending || current.UserID != 0 {
+			log.Info(ctx, "invalid check on offer travel: travel is not pending or is assigned",
+				log.Int64("travel_id", id),
+				log.Int64("travel_user_id", current.UserID),
+				log.String("travel_status", string(current.Status)))
+			return Travel{}, "", ErrInvalidStatusToOffer
+		}
+
+		if err := travelStorage.checkDriverZone(ctx, current.From, offer.UserID); err != nil {
+			return Travel{}, "", err
+		}
+
+		expiresAt := travelStorage.clock.Now().UTC().Add(travelStorage.offerTimeout).Truncate(time.Second)
+
+		travel := current
+		travel.Status = StatusOffered
+		travel.UserID = offer.UserID
+		travel.OfferExpiresAt = &expiresAt
+
+		return travel, EventOffered, nil
+	})
+}
+
+// Accept will assign the offered travel with the received id to the driver logged in (who should be the one it
+// was offered to), the travel goes back to pending with the driver assigned
+func (travelStorage TravelStorage) Accept(ctx context.Context, id int64) (Travel, error) {
+	return travelStorage.editOffer(ctx, id, "accept", func(current Travel) (Travel, EventType, error) {
+		if err := validateOfferAnswer(ctx, current); err != nil {
+			return Travel{}, "", err
+		}
+
+		if !travelStorage.clock.Now().UTC().Before(*current.OfferExpiresAt) {
+			log.Info(ctx, "invalid check on accept travel: the offer expired",
+				log.Int64("travel_id", id),
+				log.String("offer_expires_at", current.OfferExpiresAt.Format(time.RFC3339)))
+			return Travel{}, "", ErrOfferExpired
+		}
+
+		travel := current
+		travel.Status = StatusPending
+		travel.OfferExpiresAt = nil
+
+		return travel, EventOfferAccepted, nil
+	})
+}
+
+// Reject will send the offered travel with the received id back to pending without user, only the driver it was
+// offered to can reject it
+func (travelStorage TravelStorage) Reject(ctx context.Context, id int64) (Travel, error) {
+	return travelStorage.editOffer(ctx, id, "reject", func(current Travel) (Travel, EventType, error) {
+		if err := validateOfferAnswer(ctx, current); err != nil {
+			return Travel{}, "", err
+		}
+
+		travel := current
+		travel.Status = StatusPending
+		travel.UserID = 0
+		travel.OfferExpiresAt = nil
+
+		return travel, EventOfferRejected, nil
+	})
+}
+
+// editOffer edit the travel with the received id applying the offer action, which return the edited travel and
+// the type of the event to record (with the offered user id as detail)
+func (travelStorage TravelStorage) editOffer(ctx context.Context, id int64, action string,
+	apply func(current Travel) (Travel, EventType, error)) (Travel, error) {
+	var travel Travel
+	var validationErr error
+	found := false
+
+	unlock, lockErr := travelStorage.lockAssignment(ctx, id)
+	if lockErr != nil {
+		return Travel{}, lockErr
+	}
+	defer unlock()
+
+	err := travelStorage.repository.EditTravel(ctx, id, func(current Travel) (Travel, []Event, error) {
+		found = true
+
+		if current.DeletedAt != nil {
+			validationErr = ErrNotFoundTravel
+			return Travel{}, nil, validationErr
+		}
+
+		if validationErr = travelStorage.checkTeam(ctx, current); validationErr != nil {
+			return Travel{}, nil, validationErr
+		}
+
+		var eventType EventType
+		travel, eventType, validationErr = apply(current)
+		if validationErr != nil {
+			return Travel{}, nil, validationErr
+		}
+
+		offeredUserID := travel.UserID
+		if offeredUserID == 0 {
+			offeredUserID = current.UserID
+		}
+
+		event := Event{
+			TravelID:  id,
+			Type:      eventType,
+			Detail:    strconv.FormatInt(offeredUserID, 10),
+			CreatedAt: travelStorage.clock.Now().UTC().Truncate(time.Second),
+		}
+
+		return travel, []Event{event}, nil
+	})
+	if err != nil {
+		if validationErr != nil {
+			return Travel{}, validationErr
+		}
+
+		log.Error(ctx, "there was an error while editing travel offer", log.Int64("travel_id", id),
+			log.String("action", action), log.Err(err))
+		return Travel{}, mapEditError(err, found)
+	}
+
+	return travel, nil
+}
+
+// validateOfferAnswer business validation on accept or reject an offered travel, only the driver it was offered
+// to can answer it
+func validateOfferAnswer(ctx context.Context, travel Travel) error {
+	if travel.Status != StatusOffered {
+		log.Info(ctx, "invalid check on answer travel offer: travel is not offered",
+			log.Int64("travel_id", travel.ID),
+			log.String("travel_status", string(travel.Status)))
+		return ErrInvalidStatusToAnswer
+	}
+
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims",
+			log.Int64("travel_user_id", travel.UserID),
+			log.Int64("travel_id", travel.ID),
+		)
+		return ErrInvalidUserClaims
+	}
+
+	if userLogged.UserID != travel.UserID {
+		log.Info(ctx, "invalid check on answer travel offer: the travel was offered to another user",
+			log.Int64("travel_id", travel.ID),
+			log.Int64("travel_user_id", travel.UserID),
+			log.Int64("logged_user_id", userLogged.UserID))
+		return ErrInvalidOfferUser
+	}
+
+	return nil
+}
+
+// ExpireOffers send back to pending (without user) the offered travels not answered in time, recording an
+// EventOfferExpired for each one. It return the ids of the travels sent back to pending
+func (travelStorage TravelStorage) ExpireOffers(ctx context.Context) ([]int64, error) {
+	ids, err := travelStorage.repository.ExpireOffers(ctx, travelStorage.clock.Now().UTC())
+	if err != nil {
+		log.Error(ctx, "there was an error expiring travel offers", log.Err(err))
+		metrics.Inc(ctx, travelsOffersExpiredMetric, []string{"result", "false"})
+		return nil, ErrStorageUpdate
+	}
+
+	if len(ids) > 0 {
+		log.Info(ctx, "travel offers expired", log.Int64("travels_count", int64(len(ids))))
+	}
+	metrics.Count(ctx, travelsOffersExpiredMetric, int64(len(ids)), []string{"result", "true"})
+
+	return ids, nil
+}
+
+// ExpireOffersEvery run ExpireOffers every interval, until the context is done. It is meant to be run on its own
+// goroutine. With a lock set (see WithLock) it only runs on one instance of the api
+func (travelStorage TravelStorage) ExpireOffersEvery(ctx context.Context, interval time.Duration) {
+	travelStorage.runEvery(ctx, "expire_offers", interval, func() {
+		// errors are already logged and measured, the next run will retry
+		_, _ = travelStorage.ExpireOffers(ctx)
+	})
+}
@@ -0,0 +1,37 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"time"
+)
+
+const travelsOverdueMetric = "application.space.travels.overdue"
+
+// CheckOverdue record an EventOverdue for the in process travels that exceeded their deadline (once per travel).
+// It return the ids of the travels found overdue on this run
+func (travelStorage TravelStorage) CheckOverdue(ctx context.Context) ([]int64, error) {
+	ids, err := travelStorage.repository.MarkOverdue(ctx, travelStorage.clock.Now().UTC())
+	if err != nil {
+		log.Error(ctx, "there was an error checking overdue travels", log.Err(err))
+		metrics.Inc(ctx, travelsOverdueMetric, []string{"result", "false"})
+		return nil, ErrStorageUpdate
+	}
+
+	if len(ids) > 0 {
+		log.Info(ctx, "travels exceeded their deadline", log.Int64("travels_count", int64(len(ids))))
+	}
+	metrics.Count(ctx, travelsOverdueMetric, int64(len(ids)), []string{"result", "true"})
+
+	return ids, nil
+}
+
+// CheckOverdueEvery run CheckOverdue every interval, until the context is done. It is meant to be run on its own
+// goroutine. With a lock set (see WithLock) it only runs on one instance of the api
+func (travelStorage TravelStorage) CheckOverdueEvery(ctx context.Context, interval time.Duration) {
+	travelStorage.runEvery(ctx, "check_overdue", interval, func() {
+		// errors are already logged and measured, the next run will retry
+		_, _ = travelStorage.CheckOverdue(ctx)
+	})
+}
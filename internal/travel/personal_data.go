@@ -0,0 +1,44 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+)
+
+var (
+	ErrStorageErase = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to erase travels personal data"}
+)
+
+// PersonalData is the data of the travels related to a user: its travels (including the deleted and archived ones),
+// the locations it reported, the ratings it received and the events of its travels or offers, as its audit
+type PersonalData struct {
+	Travels   []Travel     `json:"travels"`
+	Locations []TracePoint `json:"locations"`
+	Ratings   []Rating     `json:"ratings"`
+	// Events are exported as the audit of the user
+	Events []Event `json:"audit"`
+}
+
+// PersonalData return the data of the travels related to the user with the received id, to export it
+func (travelStorage TravelStorage) PersonalData(ctx context.Context, userID int64) (PersonalData, error) {
+	data, err := travelStorage.repository.GetPersonalData(ctx, userID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting travels personal data", log.Int64("user_id", userID), log.Err(err))
+		return PersonalData{}, ErrStorageGet
+	}
+
+	return data, nil
+}
+
+// ErasePersonalData will delete the locations reported by the user with the received id and the comments of the
+// ratings it received. Its travels, attachments and rating scores are kept, so the travel statistics and earnings
+// do not change
+func (travelStorage TravelStorage) ErasePersonalData(ctx context.Context, userID int64) error {
+	if err := travelStorage.repository.ErasePersonalData(ctx, userID); err != nil {
+		log.Error(ctx, "there was an error erasing travels personal data", log.Int64("user_id", userID), log.Err(err))
+		return ErrStorageErase
+	}
+
+	return nil
+}
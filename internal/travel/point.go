@@ -1,14 +1,55 @@
 package travel
 
 import (
+	"database/sql/driver"
+	"errors"
 	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/geo"
+	"math"
 	"strconv"
 	"strings"
 )
 
+var ErrInvalidCoordinates = code_error.Error{Code: "invalid_coordinates", Detail: "the latitude should be between -90 and 90 and the longitude between -180 and 180"}
+
+// ErrInvalidPointValue is returned when a point cannot be parsed from its text or stored representation
+var ErrInvalidPointValue = errors.New("invalid point value")
+
 type Point struct {
 	Lat float64 `json:"latitude" binding:"required"`
 	Lng float64 `json:"longitude" binding:"required"`
+
+	// Altitude is the optional height in meters above the sea level, it is kept apart from the spatial columns
+	Altitude *float64 `json:"altitude,omitempty"`
+}
+
+// Valid return if the latitude is on [-90, 90], the longitude on [-180, 180] and the altitude (if any) is a finite
+// number
+func (p Point) Valid() bool {
+	if p.Altitude != nil && (math.IsNaN(*p.Altitude) || math.IsInf(*p.Altitude, 0)) {
+		return false
+	}
+
+	return p.Lat >= -90 && p.Lat <= 90 && p.Lng >= -180 && p.Lng <= 180
+}
+
+// altitudeKm return the altitude of the point in kilometers, a point without altitude is on the sea level
+func (p Point) altitudeKm() float64 {
+	if p.Altitude == nil {
+		return 0
+	}
+
+	return *p.Altitude / 1000
+}
+
+// sameAltitude return true if both points have no altitude or have the same one
+func (p Point) sameAltitude(other Point) bool {
+	if p.Altitude == nil || other.Altitude == nil {
+		return p.Altitude == nil && other.Altitude == nil
+	}
+
+	return *p.Altitude == *other.Altitude
 }
 
 func (p Point) String() string {
@@ -18,18 +59,94 @@ func (p Point) String() string {
 	return fmt.Sprintf("%s, %s", lat, lng)
 }
 
-func (p *Point) FromString(value string) (err error) {
-	split := strings.Split(value, ", ")
+// FromString parse a point from the "latitude, longitude" representation returned by String, it return an error
+// wrapping ErrInvalidPointValue if the value is malformed
+func (p *Point) FromString(value string) error {
+	split := strings.Split(value, ",")
+	if len(split) != 2 {
+		return fmt.Errorf("%w: %q is not a latitude and a longitude", ErrInvalidPointValue, value)
+	}
+
+	return p.parseCoordinates(value, split[0], split[1])
+}
+
+// Value return the well-known text representation of the point, POINT(longitude latitude), so it can be stored on
+// a spatial column with ST_GeomFromText. Spatial columns are two dimensional, the altitude is stored on its own column
+func (p Point) Value() (driver.Value, error) {
+	return fmt.Sprintf("POINT(%s %s)",
+		strconv.FormatFloat(p.Lng, 'g', -1, 64),
+		strconv.FormatFloat(p.Lat, 'g', -1, 64)), nil
+}
+
+// Scan read the point from its well-known text representation, POINT(longitude latitude), as it is selected from
+// a spatial column with ST_AsText. It return an error wrapping ErrInvalidPointValue if the value is malformed
+func (p *Point) Scan(src interface{}) error {
+	var value string
+	switch src := src.(type) {
+	case string:
+		value = src
+	case []byte:
+		value = string(src)
+	default:
+		return fmt.Errorf("%w: cannot scan %T", ErrInvalidPointValue, src)
+	}
+
+	text := strings.ToUpper(strings.TrimSpace(value))
+	if !strings.HasPrefix(text, "POINT(") || !strings.HasSuffix(text, ")") {
+		return fmt.Errorf("%w: %q is not a well-known text point", ErrInvalidPointValue, value)
+	}
 
-	p.Lat, err = strconv.ParseFloat(split[0], 64)
-	if err != nil {
-		return err
+	coordinates := strings.Fields(strings.TrimSuffix(strings.TrimPrefix(text, "POINT("), ")"))
+	if len(coordinates) != 2 {
+		return fmt.Errorf("%w: %q is not a well-known text point", ErrInvalidPointValue, value)
 	}
 
-	p.Lng, err = strconv.ParseFloat(split[1], 64)
-	if err != nil {
-		return err
+	return p.parseCoordinates(value, coordinates[1], coordinates[0])
+}
+
+// parseCoordinates set the latitude and longitude of the point parsed from the received texts, the point is not
+// changed if any of them is not a number
+func (p *Point) parseCoordinates(value, latText, lngText string) error {
+	lat, errLat := strconv.ParseFloat(strings.TrimSpace(latText), 64)
+	lng, errLng := strconv.ParseFloat(strings.TrimSpace(lngText), 64)
+	if errLat != nil || errLng != nil {
+		return fmt.Errorf("%w: %q has invalid coordinates", ErrInvalidPointValue, value)
 	}
 
+	p.Lat = lat
+	p.Lng = lng
+
 	return nil
 }
+
+// DistanceKm return the great-circle distance in kilometers between two points (haversine formula), when any of
+// them has altitude the difference of altitude is added as the third dimension (a point without altitude is on the
+// sea level)
+func (p Point) DistanceKm(other Point) float64 {
+	surfaceKm := geo.DistanceKm(p.Coordinate(), other.Coordinate())
+	if p.Altitude == nil && other.Altitude == nil {
+		return surfaceKm
+	}
+
+	return math.Hypot(surfaceKm, other.altitudeKm()-p.altitudeKm())
+}
+
+// Bearing return the initial bearing in degrees, on [0, 360), to follow from p to reach the other point: 0 is
+// north, 90 east, 180 south and 270 west
+func (p Point) Bearing(other Point) float64 {
+	return geo.Bearing(p.Coordinate(), other.Coordinate())
+}
+
+// BoundingBox return the south-west and north-east corners of the box that contains every point within the
+// received radius from p. The box is clamped to valid coordinates instead of wrapping around the poles or the
+// antimeridian
+func (p Point) BoundingBox(radiusKm float64) (Point, Point) {
+	southWest, northEast := geo.BoundingBox(p.Coordinate(), radiusKm)
+
+	return Point{Lat: southWest.Lat, Lng: southWest.Lng}, Point{Lat: northEast.Lat, Lng: northEast.Lng}
+}
+
+// Coordinate return the latitude and longitude of the point, without its altitude
+func (p Point) Coordinate() geo.Coordinate {
+	return geo.Coordinate{Lat: p.Lat, Lng: p.Lng}
+}
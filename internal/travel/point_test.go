@@ -1,6 +1,8 @@
 package travel
 
 import (
+	"errors"
+	"math"
 	"github.com/stretchr/testify/assert"
 	"testing"
 )
@@ -19,3 +21,146 @@ func Test_Point(t *testing.T) {
 	assert.Equal(t, p.Lat, newPoint.Lat)
 	assert.Equal(t, p.Lng, newPoint.Lng)
 }
+
+func Test_PointFromStringMalformed(t *testing.T) {
+	for _, value := range []string{"", "-34.6", "-34.6, -58.3, 1", "lat, -58.3", "-34.6, lng"} {
+		newPoint := Point{Lat: 1, Lng: 2}
+		err := newPoint.FromString(value)
+
+		assert.True(t, errors.Is(err, ErrInvalidPointValue), value)
+		assert.Equal(t, Point{Lat: 1, Lng: 2}, newPoint, value)
+	}
+}
+
+func Test_PointValueScan(t *testing.T) {
+	p := Point{Lat: -34.6037, Lng: -58.3816}
+
+	value, err := p.Value()
+	assert.Nil(t, err)
+	assert.Equal(t, "POINT(-58.3816 -34.6037)", value)
+
+	tests := map[string]struct {
+		src      interface{}
+		want     Point
+		expected error
+	}{
+		"successful scan from text": {
+			src:  "POINT(-58.3816 -34.6037)",
+			want: p,
+		},
+
+		"successful scan from bytes": {
+			src:  []byte(" point( -58.3816  -34.6037 ) "),
+			want: p,
+		},
+
+		"error on scan: null value": {
+			src:      nil,
+			expected: ErrInvalidPointValue,
+		},
+
+		"error on scan: not a point": {
+			src:      "LINESTRING(1 2, 3 4)",
+			expected: ErrInvalidPointValue,
+		},
+
+		"error on scan: missing coordinate": {
+			src:      "POINT(-58.3816)",
+			expected: ErrInvalidPointValue,
+		},
+
+		"error on scan: invalid coordinate": {
+			src:      "POINT(-58.3816 lat)",
+			expected: ErrInvalidPointValue,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var scanned Point
+			err := scanned.Scan(tc.src)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, scanned)
+			} else {
+				assert.True(t, errors.Is(err, tc.expected))
+				assert.Equal(t, Point{}, scanned)
+			}
+		})
+	}
+}
+
+func Test_PointDistance(t *testing.T) {
+	buenosAires := Point{Lat: -34.6037, Lng: -58.3816}
+	montevideo := Point{Lat: -34.9011, Lng: -56.1645}
+
+	assert.InDelta(t, 205.4, buenosAires.DistanceKm(montevideo), 0.5)
+	assert.InDelta(t, buenosAires.DistanceKm(montevideo), montevideo.DistanceKm(buenosAires), 0.0001)
+	assert.Equal(t, float64(0), buenosAires.DistanceKm(buenosAires))
+}
+
+func Test_PointDistance3D(t *testing.T) {
+	altitude := 400000.0
+	ground := Point{Lat: 0, Lng: 0}
+	orbit := Point{Lat: 0, Lng: 0, Altitude: &altitude}
+
+	// the difference of altitude is added as the third dimension, a point without altitude is on the sea level
+	assert.InDelta(t, 400, ground.DistanceKm(orbit), 0.0001)
+	assert.InDelta(t, 400, orbit.DistanceKm(ground), 0.0001)
+	assert.Equal(t, float64(0), orbit.DistanceKm(orbit))
+
+	east := Point{Lat: 0, Lng: 1, Altitude: &altitude}
+	surface := Point{Lat: 0, Lng: 0}.DistanceKm(Point{Lat: 0, Lng: 1})
+	assert.InDelta(t, surface, orbit.DistanceKm(east), 0.0001)
+	assert.InDelta(t, math.Hypot(surface, 400), ground.DistanceKm(east), 0.0001)
+
+	nan := math.NaN()
+	assert.False(t, Point{Lat: 0, Lng: 0, Altitude: &nan}.Valid())
+	assert.True(t, orbit.Valid())
+}
+
+func Test_PointBearing(t *testing.T) {
+	origin := Point{Lat: 0, Lng: 0}
+
+	assert.InDelta(t, 0, origin.Bearing(Point{Lat: 1, Lng: 0}), 0.0001)
+	assert.InDelta(t, 90, origin.Bearing(Point{Lat: 0, Lng: 1}), 0.0001)
+	assert.InDelta(t, 180, origin.Bearing(Point{Lat: -1, Lng: 0}), 0.0001)
+	assert.InDelta(t, 270, origin.Bearing(Point{Lat: 0, Lng: -1}), 0.0001)
+
+	// from Buenos Aires Montevideo is to the east, a little to the south
+	buenosAires := Point{Lat: -34.6037, Lng: -58.3816}
+	montevideo := Point{Lat: -34.9011, Lng: -56.1645}
+	assert.InDelta(t, 99.9, buenosAires.Bearing(montevideo), 0.1)
+}
+
+func Test_PointBoundingBox(t *testing.T) {
+	p := Point{Lat: -34.6037, Lng: -58.3816}
+
+	southWest, northEast := p.BoundingBox(10)
+
+	assert.Less(t, southWest.Lat, p.Lat)
+	assert.Less(t, southWest.Lng, p.Lng)
+	assert.Greater(t, northEast.Lat, p.Lat)
+	assert.Greater(t, northEast.Lng, p.Lng)
+
+	// the box sides are at the radius distance from the center
+	assert.InDelta(t, 10, p.DistanceKm(Point{Lat: northEast.Lat, Lng: p.Lng}), 0.01)
+	assert.InDelta(t, 10, p.DistanceKm(Point{Lat: p.Lat, Lng: northEast.Lng}), 0.01)
+
+	// near the pole the box is clamped to valid coordinates
+	southWest, northEast = Point{Lat: 89.99, Lng: 0}.BoundingBox(100)
+	assert.Equal(t, float64(90), northEast.Lat)
+	assert.Equal(t, float64(-180), southWest.Lng)
+	assert.Equal(t, float64(180), northEast.Lng)
+}
+
+func Test_PointValid(t *testing.T) {
+	assert.True(t, Point{Lat: -34.6037, Lng: -58.3816}.Valid())
+	assert.True(t, Point{Lat: 90, Lng: -180}.Valid())
+	assert.True(t, Point{Lat: -90, Lng: 180}.Valid())
+	assert.False(t, Point{Lat: 90.1, Lng: 0}.Valid())
+	assert.False(t, Point{Lat: -90.1, Lng: 0}.Valid())
+	assert.False(t, Point{Lat: 0, Lng: 180.1}.Valid())
+	assert.False(t, Point{Lat: 0, Lng: -180.1}.Valid())
+}
@@ -0,0 +1,60 @@
+package travel
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Pricing is the fare engine used to estimate travels, the fare is the base fare plus a price for each kilometer
+// and the duration is estimated with an average speed
+type Pricing struct {
+	BaseFare        float64
+	PerKm           float64
+	AverageSpeedKmh float64
+}
+
+// DefaultPricing is the Pricing used when no other is configured on TravelStorage
+var DefaultPricing = Pricing{
+	BaseFare:        100,
+	PerKm:           25,
+	AverageSpeedKmh: 40,
+}
+
+// Quote is the estimation of a travel between two locations
+type Quote struct {
+	From              Point   `json:"from"`
+	To                Point   `json:"to"`
+	DistanceKm        float64 `json:"distance_km"`
+	EstimatedDuration int64   `json:"estimated_duration_minutes"`
+	Fare              float64 `json:"fare"`
+}
+
+// Estimate return the Quote for a travel between the received locations
+func (p Pricing) Estimate(from, to Point) Quote {
+	distance := from.DistanceKm(to)
+
+	var duration time.Duration
+	if p.AverageSpeedKmh > 0 {
+		duration = time.Duration(distance / p.AverageSpeedKmh * float64(time.Hour))
+	}
+
+	return Quote{
+		From:              from,
+		To:                to,
+		DistanceKm:        roundCents(distance),
+		EstimatedDuration: int64(math.Ceil(duration.Minutes())),
+		Fare:              roundCents(p.BaseFare + p.PerKm*distance),
+	}
+}
+
+// Quote return the estimated distance, duration and fare of a travel between the received locations without
+// storing anything
+func (travelStorage TravelStorage) Quote(ctx context.Context, from, to Point) Quote {
+	return travelStorage.pricing.Estimate(from, to)
+}
+
+// roundCents round the received value to two decimals
+func roundCents(value float64) float64 {
+	return math.Round(value*100) / 100
+}
@@ -0,0 +1,72 @@
+package travel
+
+import (
+	"context"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_quoteTravel(t *testing.T) {
+	tests := map[string]struct {
+		opts []TravelStorageOption
+		from Point
+		to   Point
+		want Quote
+	}{
+		"successful quote with default pricing": {
+			from: Point{Lat: 0, Lng: 0},
+			to:   Point{Lat: 0, Lng: 1},
+			want: Quote{
+				From:              Point{Lat: 0, Lng: 0},
+				To:                Point{Lat: 0, Lng: 1},
+				DistanceKm:        111.19,
+				EstimatedDuration: 167,
+				Fare:              2879.87,
+			},
+		},
+
+		"successful quote with custom pricing": {
+			opts: []TravelStorageOption{WithPricing(Pricing{BaseFare: 10, PerKm: 1, AverageSpeedKmh: 60})},
+			from: Point{Lat: 0, Lng: 0},
+			to:   Point{Lat: 0, Lng: 1},
+			want: Quote{
+				From:              Point{Lat: 0, Lng: 0},
+				To:                Point{Lat: 0, Lng: 1},
+				DistanceKm:        111.19,
+				EstimatedDuration: 112,
+				Fare:              121.19,
+			},
+		},
+
+		"successful quote on same location": {
+			from: Point{Lat: -34.6037, Lng: -58.3816},
+			to:   Point{Lat: -34.6037, Lng: -58.3816},
+			want: Quote{
+				From: Point{Lat: -34.6037, Lng: -58.3816},
+				To:   Point{Lat: -34.6037, Lng: -58.3816},
+				Fare: DefaultPricing.BaseFare,
+			},
+		},
+
+		"quote without average speed has no duration": {
+			opts: []TravelStorageOption{WithPricing(Pricing{BaseFare: 10, PerKm: 1})},
+			from: Point{Lat: 0, Lng: 0},
+			to:   Point{Lat: 0, Lng: 1},
+			want: Quote{
+				From:       Point{Lat: 0, Lng: 0},
+				To:         Point{Lat: 0, Lng: 1},
+				DistanceKm: 111.19,
+				Fare:       121.19,
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(newMockDB(), tc.opts...)
+			result := travelStorage.Quote(context.Background(), tc.from, tc.to)
+
+			assert.Equal(t, tc.want, result)
+		})
+	}
+}
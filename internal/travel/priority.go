@@ -0,0 +1,64 @@
+package travel
+
+import (
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"strings"
+)
+
+// Priority of a travel, pending travels are listed and taken by priority and then by age
+type Priority string
+
+const (
+	PriorityLow    Priority = "low"
+	PriorityNormal Priority = "normal"
+	PriorityHigh   Priority = "high"
+)
+
+var ErrInvalidPriority = code_error.Error{Code: "invalid_priority", Detail: "the priority should be low, normal or high"}
+
+// priorityRank is the order of each priority when travels are ordered by priority, high first
+var priorityRank = map[Priority]int{
+	PriorityHigh:   0,
+	PriorityNormal: 1,
+	PriorityLow:    2,
+}
+
+// rank return the order of the priority when travels are ordered by priority, an unknown priority is ranked as
+// normal
+func (priority Priority) rank() int {
+	if rank, ok := priorityRank[priority]; ok {
+		return rank
+	}
+
+	return priorityRank[PriorityNormal]
+}
+
+// normalizePriority return the received priority trimmed and lowercase, an empty priority is kept empty. If the
+// priority is not low, normal or high then ErrInvalidPriority is returned
+func normalizePriority(priority Priority) (Priority, error) {
+	if priority == "" {
+		return "", nil
+	}
+
+	priority = Priority(strings.ToLower(strings.TrimSpace(string(priority))))
+	if _, ok := priorityRank[priority]; !ok {
+		return "", ErrInvalidPriority
+	}
+
+	return priority, nil
+}
+
+// higherPriority return true if the first travel should be taken before the second one: the one with the higher
+// priority, or the oldest one if both have the same priority
+func higherPriority(first, second Travel) bool {
+	firstRank, secondRank := first.Priority.rank(), second.Priority.rank()
+	if firstRank != secondRank {
+		return firstRank < secondRank
+	}
+
+	if !first.CreatedAt.Equal(second.CreatedAt) {
+		return first.CreatedAt.Before(second.CreatedAt)
+	}
+
+	return first.ID < second.ID
+}
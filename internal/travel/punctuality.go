@@ -0,0 +1,72 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"strconv"
+	"time"
+)
+
+const travelsDurationMetric = "application.space.travels.duration_delta"
+
+// Punctuality is a summary of the actual against the estimated duration of the ready travels
+type Punctuality struct {
+	// Completed is the quantity of ready travels with a measured duration, OnTime the ones that took up to their
+	// estimated duration
+	Completed int64 `json:"completed"`
+	OnTime    int64 `json:"on_time"`
+	// AverageDelayMinutes is the average of the actual minus the estimated duration, negative when the travels are
+	// faster than estimated
+	AverageDelayMinutes float64 `json:"average_delay_minutes"`
+}
+
+// recordDuration return the edited travel with its start or its completion recorded: a travel set in process
+// starts now, and a travel set ready is completed now with its estimated and actual duration (only if it has a
+// start). Travels sent back to pending lose their start
+func (travelStorage TravelStorage) recordDuration(current, travel Travel) Travel {
+	if travel.Status == current.Status {
+		return travel
+	}
+
+	now := travelStorage.clock.Now().UTC().Truncate(time.Second)
+	switch travel.Status {
+	case StatusInProcess:
+		travel.StartedAt = &now
+	case StatusPending:
+		travel.StartedAt = nil
+	case StatusReady:
+		travel.CompletedAt = &now
+		if travel.StartedAt != nil {
+			estimated := travelStorage.pricing.Estimate(travel.From, travel.To).EstimatedDuration
+			actual := roundCents(now.Sub(*travel.StartedAt).Minutes())
+			travel.EstimatedMinutes = &estimated
+			travel.ActualMinutes = &actual
+		}
+	}
+
+	return travel
+}
+
+// measureDuration report the actual minus the estimated duration of the completed travel, tagged by the zone where
+// it starts and its driver
+func (travelStorage TravelStorage) measureDuration(ctx context.Context, travel Travel) {
+	if travel.EstimatedMinutes == nil || travel.ActualMinutes == nil {
+		return
+	}
+
+	zoneTag := "none"
+	if travelStorage.zones != nil {
+		zoneID, err := travelStorage.zones.Locate(ctx, travel.From)
+		if err != nil {
+			log.Error(ctx, "there was an error locating travel zone", log.Int64("travel_id", travel.ID), log.Err(err))
+			zoneTag = "unknown"
+		} else if zoneID != 0 {
+			zoneTag = strconv.FormatInt(zoneID, 10)
+		}
+	}
+
+	delay := *travel.ActualMinutes - float64(*travel.EstimatedMinutes)
+	metrics.Histogram(ctx, travelsDurationMetric, delay,
+		[]string{"zone", zoneTag, "driver", strconv.FormatInt(travel.UserID, 10)})
+}
@@ -0,0 +1,197 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"strconv"
+	"time"
+)
+
+// DefaultQueueSize is the max quantity of travels queued to a driver when none is configured
+const DefaultQueueSize = 3
+
+var (
+	ErrInvalidStatusToQueue   = code_error.Error{Code: "invalid_status", Detail: "only pending travels without user can be queued"}
+	ErrInvalidStatusToDequeue = code_error.Error{Code: "invalid_status", Detail: "the travel is not queued"}
+	ErrDriverNotInProcess     = code_error.Error{Code: "driver_not_in_process", Detail: "only drivers with an in process travel can have queued travels"}
+	ErrQueueFull              = code_error.Error{Code: "queue_full", Detail: "the driver queue is full"}
+)
+
+// QueueAssignment is the driver a pending travel is queued to, it is set in process once the driver leaves its in
+// process travel and the travels queued before it
+type QueueAssignment struct {
+	UserID int64 `json:"user_id" binding:"required"`
+}
+
+// WithQueueSize set the max quantity of travels queued to a driver
+func WithQueueSize(size int) TravelStorageOption {
+	return func(tst *TravelStorage) {
+		tst.queueSize = size
+	}
+}
+
+// Enqueue will queue the pending travel (without user) with the received id to the driver of the assignment,
+// recording an EventQueued. The driver should have an in process travel and less travels queued than the queue size
+func (travelStorage TravelStorage) Enqueue(ctx context.Context, id int64, assignment QueueAssignment) (Travel, error) {
+	var travel Travel
+	var validationErr error
+	found := false
+
+	unlock, lockErr := travelStorage.lockAssignment(ctx, id)
+	if lockErr != nil {
+		return Travel{}, lockErr
+	}
+	defer unlock()
+
+	err := travelStorage.repository.QueueTravel(ctx, id, assignment.UserID,
+		func(current Travel, assigned []Travel) (Travel, []Event, error) {
+			found = true
+
+			if current.DeletedAt != nil {
+				validationErr = ErrNotFoundTravel
+				return Travel{}, nil, validationErr
+			}
+
+			if validationErr = travelStorage.checkTeam(ctx, current); validationErr != nil {
+				return Travel{}, nil, validationErr
+			}
+
+			if current.Status != StatusPending || current.UserID != 0 {
+				log.Info(ctx, "invalid check on queue travel: travel is not pending or is assigned",
+					log.Int64("travel_id", id),
+					log.Int64("travel_user_id", current.UserID),
+					log.String("travel_status", string(current.Status)))
+				validationErr = ErrInvalidStatusToQueue
+				return Travel{}, nil, validationErr
+			}
+
+			inProcess := false
+			queued := 0
+			for _, trv := range assigned {
+				switch trv.Status {
+				case StatusInProcess:
+					inProcess = true
+				case StatusQueued:
+					queued++
+				}
+			}
+
+			if !inProcess {
+				log.Info(ctx, "invalid check on queue travel: the driver has no in process travel",
+					log.Int64("travel_id", id),
+					log.Int64("user_id", assignment.UserID))
+				validationErr = ErrDriverNotInProcess
+				return Travel{}, nil, validationErr
+			}
+
+			if queued >= travelStorage.queueSize {
+				log.Info(ctx, "invalid check on queue travel: the driver queue is full",
+					log.Int64("travel_id", id),
+					log.Int64("user_id", assignment.UserID),
+					log.Int64("queued", int64(queued)))
+				validationErr = ErrQueueFull
+				return Travel{}, nil, validationErr
+			}
+
+			if validationErr = travelStorage.checkDriverZone(ctx, current.From, assignment.UserID); validationErr != nil {
+				return Travel{}, nil, validationErr
+			}
+
+			position := queued + 1
+
+			travel = current
+			travel.Status = StatusQueued
+			travel.UserID = assignment.UserID
+			travel.QueuePosition = &position
+
+			event := Event{
+				TravelID:  id,
+				Type:      EventQueued,
+				Detail:    strconv.FormatInt(assignment.UserID, 10),
+				CreatedAt: travelStorage.clock.Now().UTC().Truncate(time.Second),
+			}
+
+			return travel, []Event{event}, nil
+		})
+	if err != nil {
+		if validationErr != nil {
+			return Travel{}, validationErr
+		}
+
+		log.Error(ctx, "there was an error while queueing travel", log.Int64("travel_id", id),
+			log.Int64("user_id", assignment.UserID), log.Err(err))
+		return Travel{}, mapEditError(err, found)
+	}
+
+	return travel, nil
+}
+
+// Dequeue will remove the queued travel with the received id from the queue of its driver, recording an
+// EventDequeued. The travel goes back to pending without user and the travels queued behind it move forward
+func (travelStorage TravelStorage) Dequeue(ctx context.Context, id int64) (Travel, error) {
+	var travel Travel
+	var validationErr error
+	found := false
+
+	err := travelStorage.repository.EditTravel(ctx, id, func(current Travel) (Travel, []Event, error) {
+		found = true
+
+		if current.DeletedAt != nil {
+			validationErr = ErrNotFoundTravel
+			return Travel{}, nil, validationErr
+		}
+
+		if validationErr = travelStorage.checkTeam(ctx, current); validationErr != nil {
+			return Travel{}, nil, validationErr
+		}
+
+		if current.Status != StatusQueued {
+			log.Info(ctx, "invalid check on dequeue travel: travel is not queued",
+				log.Int64("travel_id", id),
+				log.String("travel_status", string(current.Status)))
+			validationErr = ErrInvalidStatusToDequeue
+			return Travel{}, nil, validationErr
+		}
+
+		travel = current
+		travel.Status = StatusPending
+		travel.UserID = 0
+		travel.QueuePosition = nil
+
+		event := Event{
+			TravelID:  id,
+			Type:      EventDequeued,
+			Detail:    strconv.FormatInt(current.UserID, 10),
+			CreatedAt: travelStorage.clock.Now().UTC().Truncate(time.Second),
+		}
+
+		return travel, []Event{event}, nil
+	})
+	if err != nil {
+		if validationErr != nil {
+			return Travel{}, validationErr
+		}
+
+		log.Error(ctx, "there was an error while dequeueing travel", log.Int64("travel_id", id), log.Err(err))
+		return Travel{}, mapEditError(err, found)
+	}
+
+	return travel, nil
+}
+
+// Queue return the travels queued to the received user, ordered by their queue position. The queue of a driver out of
+// the teams of the user logged in is not found (see WithTeamFinder)
+func (travelStorage TravelStorage) Queue(ctx context.Context, userID int64) ([]Travel, error) {
+	if err := travelStorage.checkDriverTeam(ctx, userID); err != nil {
+		return nil, err
+	}
+
+	travels, err := travelStorage.repository.GetQueue(ctx, userID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting travels queue", log.Int64("user_id", userID), log.Err(err))
+		return nil, ErrStorageGet
+	}
+
+	return travels, nil
+}
@@ -0,0 +1,65 @@
+package travel
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+)
+
+const (
+	minRatingScore = 1
+	maxRatingScore = 5
+)
+
+var (
+	ErrInvalidRatingScore  = code_error.Error{Code: "invalid_rating", Detail: "the rating score should be between 1 and 5"}
+	ErrInvalidStatusToRate = code_error.Error{Code: "invalid_status", Detail: "only ready travels can be rated"}
+	ErrTravelAlreadyRated  = code_error.Error{Code: "already_rated", Detail: "the travel was already rated"}
+	ErrStorageSaveRating   = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to save travel rating"}
+)
+
+// Rating is the score (from 1 to 5) given to a travel once it is completed, it is attributed to the user who
+// made the travel
+type Rating struct {
+	TravelID int64  `json:"travel_id"`
+	UserID   int64  `json:"user_id"`
+	Score    int    `json:"score" binding:"required"`
+	Comment  string `json:"comment"`
+}
+
+// Rate will store a rating for the travel with the received id. Only ready travels can be rated and only once.
+func (travelStorage TravelStorage) Rate(ctx context.Context, travelID int64, rating Rating) (Rating, error) {
+	if rating.Score < minRatingScore || rating.Score > maxRatingScore {
+		log.Info(ctx, "invalid check on rate travel: invalid score",
+			log.Int64("travel_id", travelID),
+			log.Int64("score", int64(rating.Score)))
+		return Rating{}, ErrInvalidRatingScore
+	}
+
+	travel, err := travelStorage.Get(ctx, travelID)
+	if err != nil {
+		return Rating{}, err
+	}
+
+	if travel.Status != StatusReady {
+		log.Info(ctx, "invalid check on rate travel: travel is not ready",
+			log.Int64("travel_id", travelID),
+			log.String("travel_status", string(travel.Status)))
+		return Rating{}, ErrInvalidStatusToRate
+	}
+
+	rating.TravelID = travel.ID
+	rating.UserID = travel.UserID
+
+	err = travelStorage.repository.SaveRating(ctx, rating)
+	if err != nil {
+		log.Error(ctx, "there was an error while saving travel rating", log.Int64("travel_id", travelID), log.Err(err))
+		if errors.Is(err, ErrRatingDuplicated) {
+			return Rating{}, ErrTravelAlreadyRated
+		}
+		return Rating{}, ErrStorageSaveRating
+	}
+
+	return rating, nil
+}
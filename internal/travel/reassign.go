@@ -0,0 +1,102 @@
+package travel
+
+import (
+	"context"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"time"
+)
+
+var (
+	ErrInvalidStatusToReassign = code_error.Error{Code: "invalid_status", Detail: "only in process travels can be reassigned"}
+	ErrInvalidReassignUser     = code_error.Error{Code: "invalid_user", Detail: "the travel is already assigned to the received user"}
+)
+
+// Reassignment is the change of the user assigned to an in process travel. Without user id the travel goes
+// back to pending, otherwise it continues in process with the new user
+type Reassignment struct {
+	UserID int64  `json:"user_id"`
+	Reason string `json:"reason" binding:"required"`
+}
+
+// Reassign will change the user of the in process travel with the received id, recording an EventReassigned with
+// the reason. The new user cannot have another active travel
+func (travelStorage TravelStorage) Reassign(ctx context.Context, id int64, reassignment Reassignment) (Travel, error) {
+	var travel Travel
+	var validationErr error
+	var previousUserID int64
+	found := false
+
+	unlock, lockErr := travelStorage.lockAssignment(ctx, id)
+	if lockErr != nil {
+		return Travel{}, lockErr
+	}
+	defer unlock()
+
+	err := travelStorage.repository.EditTravel(ctx, id, func(current Travel) (Travel, []Event, error) {
+		found = true
+
+		if current.DeletedAt != nil {
+			validationErr = ErrNotFoundTravel
+			return Travel{}, nil, validationErr
+		}
+
+		if validationErr = travelStorage.checkTeam(ctx, current); validationErr != nil {
+			return Travel{}, nil, validationErr
+		}
+
+		if current.Status != StatusInProcess {
+			log.Info(ctx, "invalid check on reassign travel: travel is not in process",
+				log.Int64("travel_id", id),
+				log.String("travel_status", string(current.Status)))
+			validationErr = ErrInvalidStatusToReassign
+			return Travel{}, nil, validationErr
+		}
+
+		if reassignment.UserID == current.UserID {
+			log.Info(ctx, "invalid check on reassign travel: travel already assigned to user",
+				log.Int64("travel_id", id),
+				log.Int64("travel_user_id", current.UserID))
+			validationErr = ErrInvalidReassignUser
+			return Travel{}, nil, validationErr
+		}
+
+		if validationErr = travelStorage.checkDriverZone(ctx, current.From, reassignment.UserID); validationErr != nil {
+			return Travel{}, nil, validationErr
+		}
+
+		previousUserID = current.UserID
+		travel = current
+		travel.UserID = reassignment.UserID
+		if reassignment.UserID == 0 {
+			travel.Status = StatusPending
+		}
+		travel = travelStorage.recordDuration(current, travel)
+
+		event := Event{
+			TravelID:  id,
+			Type:      EventReassigned,
+			Detail:    reassignment.Reason,
+			CreatedAt: travelStorage.clock.Now().UTC().Truncate(time.Second),
+		}
+
+		return travel, []Event{event}, nil
+	})
+	if err != nil {
+		if validationErr != nil {
+			return Travel{}, validationErr
+		}
+
+		log.Error(ctx, "there was an error while reassigning travel", log.Int64("travel_id", id), log.Err(err))
+		return Travel{}, mapEditError(err, found)
+	}
+
+	auditlog.Log(ctx, "travel reassigned",
+		log.Int64("travel_id", id),
+		log.Int64("previous_user_id", previousUserID),
+		log.Int64("user_id", reassignment.UserID),
+		log.String("reason", reassignment.Reason))
+
+	return travel, nil
+}
@@ -5,10 +5,15 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/nicocarolo/space-drivers/internal/platform/config"
+	"github.com/nicocarolo/space-drivers/internal/platform/lock"
 	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"github.com/nicocarolo/space-drivers/internal/platform/tracing"
+	"github.com/nicocarolo/space-drivers/internal/platform/uuid"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -20,16 +25,54 @@ const (
 )
 
 var (
-	ErrTravelNotFound         = errors.New("not founded travel")
-	ErrTravelNotFoundOnUpdate = errors.New("not founded travel on update")
-	ErrInvalidFromLocation    = errors.New("invalid 'from' location")
-	ErrInvalidToLocation      = errors.New("invalid 'to' location")
+	ErrTravelNotFound   = errors.New("not founded travel")
+	ErrRatingDuplicated = errors.New("the travel already has a rating")
+	ErrDriverBusy       = errors.New("the driver is assigned to another active travel")
+	ErrTravelLocked     = errors.New("the travel could not be locked due to a concurrent update")
 )
 
+// mysql error numbers handled by the repository
+const (
+	mysqlDuplicateEntry   = 1062
+	mysqlLockWaitTimeout  = 1205
+	mysqlDeadlockDetected = 1213
+)
+
+// travelColumns are the columns selected to read a travel with scanTravel, locations are stored as spatial
+// points where x is the longitude and y the latitude (read as well-known text, see Point.Scan), and tags are
+// concatenated from travel_tags table
+const travelColumns = "id, uuid, status, ST_AsText(`from`), ST_AsText(`to`), user_id, created_at, " +
+	"deleted_at, deadline, offer_expires_at, outside_zones, queue_position, started_at, completed_at, estimated_minutes, " +
+	"actual_minutes, priority, from_altitude, to_altitude, (SELECT GROUP_CONCAT(tag ORDER BY tag SEPARATOR ',') FROM travel_tags " +
+	"WHERE travel_tags.travel_id = travels.id)"
+
 type repository interface {
 	SaveTravel(ctx context.Context, travel Travel) (Travel, error)
-	EditTravel(ctx context.Context, travel Travel) error
-	GetTravel(ctx context.Context, id int64) (Travel, error)
+	EditTravel(ctx context.Context, id int64, edit func(current Travel) (Travel, []Event, error)) error
+	QueueTravel(ctx context.Context, id, userID int64, edit func(current Travel, assigned []Travel) (Travel, []Event, error)) error
+	GetQueue(ctx context.Context, userID int64) ([]Travel, error)
+	GetTravel(ctx context.Context, id int64, includeDeleted bool) (Travel, error)
+	GetTravelByUser(ctx context.Context, userID int64, status ...Status) (Travel, error)
+	SearchTravels(ctx context.Context, search Search) ([]Travel, int64, error)
+	IterateTravels(ctx context.Context, search Search, fn func(Travel) error) error
+	SaveRating(ctx context.Context, rating Rating) error
+	CountByStatus(ctx context.Context) (map[Status]int64, error)
+	AverageTimeInStatus(ctx context.Context) (map[Status]time.Duration, error)
+	CountCreatedByDay(ctx context.Context, from time.Time) (map[string]int64, error)
+	Punctuality(ctx context.Context) (Punctuality, error)
+	Heatmap(ctx context.Context, query HeatmapQuery) ([]HeatmapCell, error)
+	ExpirePending(ctx context.Context, createdBefore time.Time, detail string) ([]int64, error)
+	ExpireOffers(ctx context.Context, expiredBefore time.Time) ([]int64, error)
+	MarkOverdue(ctx context.Context, now time.Time) ([]int64, error)
+	ArchiveTravels(ctx context.Context, createdBefore time.Time) ([]int64, error)
+	GetArchivedTravel(ctx context.Context, id int64, includeDeleted bool) (Travel, error)
+	GetTravelIDByUUID(ctx context.Context, publicID string) (int64, error)
+	SaveAttachment(ctx context.Context, attachment Attachment) (Attachment, error)
+	GetAttachments(ctx context.Context, travelID int64) ([]Attachment, error)
+	SaveTracePoint(ctx context.Context, point TracePoint) (TracePoint, error)
+	GetTrace(ctx context.Context, travelID int64) ([]TracePoint, error)
+	GetPersonalData(ctx context.Context, userID int64) (PersonalData, error)
+	ErasePersonalData(ctx context.Context, userID int64) error
 }
 
 // SqlRepository sql client wrapper for user model
@@ -41,7 +84,7 @@ type SqlRepository struct {
 func NewRepository() (SqlRepository, error) {
 	dbname := os.Getenv("DB_NAME")
 	dbuser := os.Getenv("DB_USER")
-	dbpass := os.Getenv("DB_PASSWORD")
+	dbpass := config.Secret("DB_PASSWORD", "")
 	dbimage := os.Getenv("DB_IMAGE_NAME")
 	scope := os.Getenv("SCOPE")
 
@@ -53,9 +96,9 @@ func NewRepository() (SqlRepository, error) {
 			"(DB_USER, DB_PASSWORD, DB_IMAGE_NAME) are invalid")
 	}
 
-	dataSourceConnection := fmt.Sprintf("%s:%s@/%s", dbuser, dbpass, dbname)
+	dataSourceConnection := fmt.Sprintf("%s:%s@/%s?parseTime=true", dbuser, dbpass, dbname)
 	if scope != "" {
-		dataSourceConnection = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s", dbuser, dbpass, dbimage, dbname)
+		dataSourceConnection = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?parseTime=true", dbuser, dbpass, dbimage, dbname)
 	}
 	db, err := sql.Open("mysql", dataSourceConnection)
 	if err != nil {
@@ -67,20 +110,48 @@ func NewRepository() (SqlRepository, error) {
 	}, nil
 }
 
-// SaveUser will store a User on sql table
+// Close the connections to the db, once the repository is not used anymore
+func (sqlDb SqlRepository) Close() error {
+	return sqlDb.db.Close()
+}
+
+// Stats return the stats of the connections to the db, as the open and in use ones
+func (sqlDb SqlRepository) Stats() sql.DBStats {
+	return sqlDb.db.Stats()
+}
+
+// Lock return a lock with the named locks of the db, shared by every instance of the api using it
+func (sqlDb SqlRepository) Lock() lock.MySQL {
+	return lock.NewMySQL(sqlDb.db)
+}
+
+// SaveTravel will store a Travel on sql table with a new uuid
 func (sqlDb SqlRepository) SaveTravel(ctx context.Context, travel Travel) (Travel, error) {
-	q, err := sqlDb.db.Prepare("INSERT INTO travels(status, `from`, `to`, user_id) VALUES(?, ?, ?, ?)")
+	var err error
+	travel.UUID, err = uuid.New()
+	if err != nil {
+		return Travel{}, err
+	}
+
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
 	if err != nil {
 		return Travel{}, err
 	}
 
+	// rollback has no effect once the transaction is committed
+	defer tx.Rollback()
+
 	var userID interface{}
 	if travel.UserID != 0 {
 		userID = travel.UserID
 	}
 
 	trackTime := trackElapsed(ctx, entityMetricName, "insert")
-	result, err := q.Exec(travel.Status, travel.From.String(), travel.To.String(), userID)
+	result, err := tx.ExecContext(ctx, "INSERT INTO travels(uuid, status, `from`, `to`, user_id, created_at, "+
+		"deadline, outside_zones, priority, from_altitude, to_altitude) VALUES(?, ?, ST_GeomFromText(?), "+
+		"ST_GeomFromText(?), ?, ?, ?, ?, ?, ?, ?)",
+		travel.UUID, travel.Status, travel.From, travel.To, userID, travel.CreatedAt, travel.Deadline,
+		travel.OutsideZones, travel.Priority, travel.From.Altitude, travel.To.Altitude)
 	trackTime(err == nil)
 	if err != nil {
 		return Travel{}, err
@@ -91,38 +162,292 @@ func (sqlDb SqlRepository) SaveTravel(ctx context.Context, travel Travel) (Trave
 		return Travel{}, err
 	}
 
+	if err := insertTags(ctx, tx, travel.ID, travel.Tags); err != nil {
+		return Travel{}, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return Travel{}, err
+	}
+
 	return travel, nil
 }
 
-// SaveUser will store a User on sql table
-func (sqlDb SqlRepository) EditTravel(ctx context.Context, travel Travel) error {
-	q, err := sqlDb.db.Prepare("UPDATE travels SET status = ?, `from` = ?, `to` = ?, user_id = ? WHERE id = ?")
+// EditTravel will lock the travel with the received id (even if it is deleted) and store the result of calling
+// edit with it (and the travel events it returns, plus an EventStatusChanged if the status changed), all inside a
+// transaction so concurrent edits of the same travel are serialized. If the edited travel is assigned to a new user
+// (or restored), that user cannot have another active (pending, offered or in process) travel, otherwise
+// ErrDriverBusy is returned. The queue of the driver is kept as updateTravel describes
+func (sqlDb SqlRepository) EditTravel(ctx context.Context, id int64,
+	edit func(current Travel) (Travel, []Event, error)) error {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	trackTime := trackElapsed(ctx, entityMetricName, "update")
-	result, err := q.Exec(travel.Status, travel.From.String(), travel.To.String(), travel.UserID, travel.ID)
+	// rollback has no effect once the transaction is committed
+	defer tx.Rollback()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "select_for_update")
+	current, err := scanTravel(tx.QueryRowContext(ctx,
+		"SELECT "+travelColumns+" FROM travels WHERE id = ? FOR UPDATE", id))
 	trackTime(err == nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTravelNotFound
+		}
+		return lockError(err)
+	}
+
+	travel, events, err := edit(current)
+	if err != nil {
+		return err
+	}
+
+	restored := current.DeletedAt != nil && travel.DeletedAt == nil
+	if travel.UserID != 0 && (travel.UserID != current.UserID || restored) {
+		// locking the user travels also blocks other transactions trying to assign the same user
+		trackTime = trackElapsed(ctx, entityMetricName, "select_busy_driver")
+		var activeID int64
+		err = tx.QueryRowContext(ctx, "SELECT id FROM travels WHERE user_id = ? AND id <> ? AND status IN (?, ?, ?) "+
+			"AND deleted_at IS NULL LIMIT 1 FOR UPDATE", travel.UserID, current.ID, StatusPending, StatusOffered,
+			StatusInProcess).Scan(&activeID)
+		trackTime(err == nil || errors.Is(err, sql.ErrNoRows))
+		if err == nil {
+			return ErrDriverBusy
+		}
+		if !errors.Is(err, sql.ErrNoRows) {
+			return lockError(err)
+		}
+	}
+
+	if err := updateTravel(ctx, tx, current, travel, events); err != nil {
+		return err
+	}
+
+	return lockError(tx.Commit())
+}
+
+// QueueTravel will lock the travel with the received id and the in process and queued travels of the received user
+// (ordered by queue position), and store the result of calling edit with them as EditTravel does. Locking the user
+// travels serializes the concurrent changes of its queue
+func (sqlDb SqlRepository) QueueTravel(ctx context.Context, id, userID int64,
+	edit func(current Travel, assigned []Travel) (Travel, []Event, error)) error {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
 	if err != nil {
 		return err
 	}
 
-	affected, err := result.RowsAffected()
+	// rollback has no effect once the transaction is committed
+	defer tx.Rollback()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "select_for_update")
+	current, err := scanTravel(tx.QueryRowContext(ctx,
+		"SELECT "+travelColumns+" FROM travels WHERE id = ? FOR UPDATE", id))
+	trackTime(err == nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrTravelNotFound
+		}
+		return lockError(err)
+	}
+
+	trackTime = trackElapsed(ctx, entityMetricName, "select_queue_for_update")
+	rows, err := tx.QueryContext(ctx, "SELECT "+travelColumns+" FROM travels WHERE user_id = ? AND id <> ? "+
+		"AND status IN (?, ?) AND deleted_at IS NULL ORDER BY queue_position, id FOR UPDATE",
+		userID, current.ID, StatusInProcess, StatusQueued)
+	trackTime(err == nil)
+	if err != nil {
+		return lockError(err)
+	}
+
+	var assigned []Travel
+	for rows.Next() {
+		travel, err := scanTravel(rows)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+
+		assigned = append(assigned, travel)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return lockError(err)
+	}
+
+	travel, events, err := edit(current, assigned)
 	if err != nil {
 		return err
 	}
 
-	if affected != 1 {
-		return ErrTravelNotFoundOnUpdate
+	if err := updateTravel(ctx, tx, current, travel, events); err != nil {
+		return err
+	}
+
+	return lockError(tx.Commit())
+}
+
+// updateTravel store the edited travel (and the travel events, plus an EventStatusChanged if the status changed)
+// using the received transaction. When a driver leaves its in process travel its first queued travel is promoted
+// to in process, and when a travel leaves the queue the travels behind it move forward
+func updateTravel(ctx context.Context, tx *sql.Tx, current, travel Travel, events []Event) error {
+	var userID interface{}
+	if travel.UserID != 0 {
+		userID = travel.UserID
+	}
+
+	trackTime := trackElapsed(ctx, entityMetricName, "update")
+	_, err := tx.ExecContext(ctx, "UPDATE travels SET status = ?, `from` = ST_GeomFromText(?), "+
+		"`to` = ST_GeomFromText(?), user_id = ?, deleted_at = ?, deadline = ?, offer_expires_at = ?, "+
+		"queue_position = ?, started_at = ?, completed_at = ?, estimated_minutes = ?, actual_minutes = ?, "+
+		"priority = ?, from_altitude = ?, to_altitude = ? WHERE id = ?",
+		travel.Status, travel.From, travel.To, userID, travel.DeletedAt, travel.Deadline,
+		travel.OfferExpiresAt, travel.QueuePosition, travel.StartedAt, travel.CompletedAt, travel.EstimatedMinutes,
+		travel.ActualMinutes, travel.Priority, travel.From.Altitude, travel.To.Altitude, current.ID)
+	trackTime(err == nil)
+	if err != nil {
+		return lockError(err)
+	}
+
+	if !equalTags(current.Tags, travel.Tags) {
+		trackTime = trackElapsed(ctx, "travel_tag", "delete")
+		_, err = tx.ExecContext(ctx, "DELETE FROM travel_tags WHERE travel_id = ?", current.ID)
+		trackTime(err == nil)
+		if err != nil {
+			return lockError(err)
+		}
+
+		if err := insertTags(ctx, tx, current.ID, travel.Tags); err != nil {
+			return lockError(err)
+		}
+	}
+
+	if travel.Status != current.Status {
+		events = append(events, Event{
+			TravelID:  current.ID,
+			Type:      EventStatusChanged,
+			Detail:    string(current.Status),
+			CreatedAt: time.Now().UTC().Truncate(time.Second),
+		})
+	}
+
+	if len(events) > 0 {
+		if err := insertEvents(ctx, tx, events); err != nil {
+			return err
+		}
+	}
+
+	if current.Status == StatusQueued && travel.Status != StatusQueued && current.QueuePosition != nil {
+		trackTime = trackElapsed(ctx, entityMetricName, "update_queue")
+		_, err = tx.ExecContext(ctx, "UPDATE travels SET queue_position = queue_position - 1 WHERE user_id = ? "+
+			"AND status = ? AND queue_position > ?", current.UserID, StatusQueued, *current.QueuePosition)
+		trackTime(err == nil)
+		if err != nil {
+			return lockError(err)
+		}
+	}
+
+	leftInProcess := current.Status == StatusInProcess &&
+		(travel.Status != StatusInProcess || travel.UserID != current.UserID)
+	if leftInProcess && current.UserID != 0 {
+		return promoteQueued(ctx, tx, current.UserID, current.ID)
 	}
 
 	return nil
 }
 
-// GetUser will get a User who has the received id from table
-func (sqlDb SqlRepository) GetTravel(ctx context.Context, id int64) (Travel, error) {
-	queryStatement := fmt.Sprintf("SELECT id, status, `from`, `to`, user_id FROM travels WHERE id = ?")
+// promoteQueued set in process (starting now) the first queued travel of the received user, recording an
+// EventPromoted with the id of the travel it left, and move forward the rest of its queue. Nothing is done if the
+// user has no queue
+func promoteQueued(ctx context.Context, tx *sql.Tx, userID, leftID int64) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "select_queued")
+	var nextID int64
+	err := tx.QueryRowContext(ctx, "SELECT id FROM travels WHERE user_id = ? AND status = ? AND deleted_at IS NULL "+
+		"ORDER BY queue_position, id LIMIT 1 FOR UPDATE", userID, StatusQueued).Scan(&nextID)
+	trackTime(err == nil || errors.Is(err, sql.ErrNoRows))
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return lockError(err)
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+
+	trackTime = trackElapsed(ctx, entityMetricName, "update_promoted")
+	_, err = tx.ExecContext(ctx, "UPDATE travels SET status = ?, queue_position = NULL, started_at = ? WHERE id = ?",
+		StatusInProcess, now, nextID)
+	trackTime(err == nil)
+	if err != nil {
+		return lockError(err)
+	}
+
+	trackTime = trackElapsed(ctx, entityMetricName, "update_queue")
+	_, err = tx.ExecContext(ctx, "UPDATE travels SET queue_position = queue_position - 1 WHERE user_id = ? "+
+		"AND status = ?", userID, StatusQueued)
+	trackTime(err == nil)
+	if err != nil {
+		return lockError(err)
+	}
+
+	return insertEvents(ctx, tx, []Event{
+		{TravelID: nextID, Type: EventPromoted, Detail: strconv.FormatInt(leftID, 10), CreatedAt: now},
+		{TravelID: nextID, Type: EventStatusChanged, Detail: string(StatusQueued), CreatedAt: now},
+	})
+}
+
+// lockError return ErrTravelLocked if the received error is due to a lock wait timeout or a deadlock, otherwise
+// the same error is returned
+func lockError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) &&
+		(mysqlErr.Number == mysqlLockWaitTimeout || mysqlErr.Number == mysqlDeadlockDetected) {
+		return ErrTravelLocked
+	}
+
+	return err
+}
+
+// GetTravel will get the travel who has the received id from table, deleted travels are only returned if
+// includeDeleted is true
+func (sqlDb SqlRepository) GetTravel(ctx context.Context, id int64, includeDeleted bool) (Travel, error) {
+	return sqlDb.selectTravel(ctx, "travels", "select", id, includeDeleted)
+}
+
+// GetArchivedTravel will get the travel who has the received id from the archive table, deleted travels are only
+// returned if includeDeleted is true
+func (sqlDb SqlRepository) GetArchivedTravel(ctx context.Context, id int64, includeDeleted bool) (Travel, error) {
+	// the archive is aliased as travels so travelColumns can be reused
+	return sqlDb.selectTravel(ctx, "travels_archive AS travels", "select_archived", id, includeDeleted)
+}
+
+// GetTravelIDByUUID will get the id of the travel who has the received uuid, looking on the archive table if it is
+// not on travels table
+func (sqlDb SqlRepository) GetTravelIDByUUID(ctx context.Context, publicID string) (int64, error) {
+	var id int64
+	trackTime := trackElapsed(ctx, entityMetricName, "select_by_uuid")
+	err := sqlDb.db.QueryRowContext(ctx, "SELECT id FROM travels WHERE uuid = ? "+
+		"UNION ALL SELECT id FROM travels_archive WHERE uuid = ? LIMIT 1", publicID, publicID).Scan(&id)
+	trackTime(err == nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrTravelNotFound
+		}
+		return 0, err
+	}
+
+	return id, nil
+}
+
+// selectTravel get the travel who has the received id from the received table
+func (sqlDb SqlRepository) selectTravel(ctx context.Context, table, action string, id int64,
+	includeDeleted bool) (Travel, error) {
+	queryStatement := fmt.Sprintf("SELECT %s FROM %s WHERE id = ?", travelColumns, table)
+	if !includeDeleted {
+		queryStatement += " AND deleted_at IS NULL"
+	}
 
 	query, err := sqlDb.db.Prepare(queryStatement)
 	if err != nil {
@@ -131,14 +456,10 @@ func (sqlDb SqlRepository) GetTravel(ctx context.Context, id int64) (Travel, err
 
 	defer query.Close()
 
-	trackTime := trackElapsed(ctx, entityMetricName, "select")
+	trackTime := trackElapsed(ctx, entityMetricName, action)
 	newRecord := query.QueryRowContext(ctx, id)
 
-	var travel Travel
-	var from string
-	var to string
-	var userID sql.NullInt64
-	err = newRecord.Scan(&travel.ID, &travel.Status, &from, &to, &userID)
+	travel, err := scanTravel(newRecord)
 	trackTime(err == nil)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -147,30 +468,1138 @@ func (sqlDb SqlRepository) GetTravel(ctx context.Context, id int64) (Travel, err
 		return Travel{}, err
 	}
 
-	if userID.Valid {
-		travel.UserID = userID.Int64
-	}
+	return travel, nil
+}
+
+// GetTravelByUser will get the travel assigned to the received user id that has one of the received status.
+// If more than one travel match, the order of the received status is used as priority
+func (sqlDb SqlRepository) GetTravelByUser(ctx context.Context, userID int64, status ...Status) (Travel, error) {
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(status)), ", ")
+	queryStatement := fmt.Sprintf("SELECT %s FROM travels WHERE user_id = ? AND status IN (%s) "+
+		"AND deleted_at IS NULL ORDER BY FIELD(status, %s), id LIMIT 1", travelColumns, placeholders, placeholders)
 
-	err = travel.From.FromString(from)
+	query, err := sqlDb.db.Prepare(queryStatement)
 	if err != nil {
-		return Travel{}, ErrInvalidFromLocation
+		return Travel{}, err
 	}
 
-	err = travel.To.FromString(to)
+	defer query.Close()
+
+	// status are bound twice: on the filter and on the ordering
+	args := []interface{}{userID}
+	for i := 0; i < 2; i++ {
+		for _, s := range status {
+			args = append(args, s)
+		}
+	}
+
+	trackTime := trackElapsed(ctx, entityMetricName, "select_by_user")
+	newRecord := query.QueryRowContext(ctx, args...)
+
+	travel, err := scanTravel(newRecord)
+	trackTime(err == nil)
 	if err != nil {
-		return Travel{}, ErrInvalidToLocation
+		if errors.Is(err, sql.ErrNoRows) {
+			return Travel{}, ErrTravelNotFound
+		}
+		return Travel{}, err
 	}
 
 	return travel, nil
 }
 
-func trackElapsed(ctx context.Context, entity, action string) func(success bool) {
-	start := time.Now()
-	return func(success bool) {
-		metrics.Timing(ctx, timeMetricName, time.Since(start),
-			[]string{
-				"result", strconv.FormatBool(success),
-				"action", action,
-				"entity", entity})
+// GetQueue will get the queued travels of the received user id, ordered by their queue position
+func (sqlDb SqlRepository) GetQueue(ctx context.Context, userID int64) ([]Travel, error) {
+	trackTime := trackElapsed(ctx, entityMetricName, "select_queue")
+	rows, err := sqlDb.db.QueryContext(ctx, "SELECT "+travelColumns+" FROM travels WHERE user_id = ? AND status = ? "+
+		"AND deleted_at IS NULL ORDER BY queue_position, id", userID, StatusQueued)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var travels []Travel
+	for rows.Next() {
+		travel, err := scanTravel(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		travels = append(travels, travel)
+	}
+
+	return travels, rows.Err()
+}
+
+// SearchTravels will get the travels matching the search filters with pagination, and the total quantity of
+// travels that match the filters
+func (sqlDb SqlRepository) SearchTravels(ctx context.Context, search Search) ([]Travel, int64, error) {
+	where, args := searchConditions(search)
+	order, orderArgs := searchOrder(search)
+
+	queryStatement := "SELECT " + travelColumns + " FROM travels" + where + order + " LIMIT ? OFFSET ?"
+
+	query, err := sqlDb.db.Prepare(queryStatement)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer query.Close()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "select_search")
+	queryArgs := append(append(append([]interface{}{}, args...), orderArgs...), search.Limit, search.Offset)
+	rows, err := query.QueryContext(ctx, queryArgs...)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var travels []Travel
+	for rows.Next() {
+		travel, err := scanTravel(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		travels = append(travels, travel)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	countQuery, err := sqlDb.db.Prepare("SELECT COUNT(*) FROM travels" + where)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer countQuery.Close()
+
+	trackTime = trackElapsed(ctx, entityMetricName, "select_count")
+	var count int64
+	err = countQuery.QueryRowContext(ctx, args...).Scan(&count)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return travels, count, nil
+}
+
+// IterateTravels will call fn with every travel matching the search filters (ignoring pagination), reading
+// them one by one from a cursor so the whole result is never loaded in memory. If fn return an error the
+// iteration stops and the error is returned
+func (sqlDb SqlRepository) IterateTravels(ctx context.Context, search Search, fn func(Travel) error) error {
+	where, args := searchConditions(search)
+	order, orderArgs := searchOrder(search)
+
+	query, err := sqlDb.db.Prepare("SELECT " + travelColumns + " FROM travels" + where + order)
+	if err != nil {
+		return err
+	}
+
+	defer query.Close()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "select_iterate")
+	rows, err := query.QueryContext(ctx, append(append([]interface{}{}, args...), orderArgs...)...)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		travel, err := scanTravel(rows)
+		if err != nil {
+			return err
+		}
+
+		if err := fn(travel); err != nil {
+			return err
+		}
+	}
+
+	return rows.Err()
+}
+
+// CountByStatus will get the quantity of not deleted travels grouped by status
+func (sqlDb SqlRepository) CountByStatus(ctx context.Context) (map[Status]int64, error) {
+	query, err := sqlDb.db.Prepare("SELECT status, COUNT(*) FROM travels WHERE deleted_at IS NULL GROUP BY status")
+	if err != nil {
+		return nil, err
+	}
+
+	defer query.Close()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "count_by_status")
+	rows, err := query.QueryContext(ctx)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	counts := make(map[Status]int64)
+	for rows.Next() {
+		var status Status
+		var count int64
+		if err := rows.Scan(&status, &count); err != nil {
+			return nil, err
+		}
+
+		counts[status] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// AverageTimeInStatus will get the average time the not deleted travels stayed on each status before changing
+// it. Each stay starts on the previous status change of the travel (or its creation) and ends on the status
+// change event that left it, so the status never left are not returned
+func (sqlDb SqlRepository) AverageTimeInStatus(ctx context.Context) (map[Status]time.Duration, error) {
+	query, err := sqlDb.db.Prepare("SELECT e.detail, AVG(TIMESTAMPDIFF(SECOND, COALESCE((SELECT MAX(p.created_at) " +
+		"FROM travel_events p WHERE p.travel_id = e.travel_id AND p.type = e.type AND p.id < e.id), t.created_at), " +
+		"e.created_at)) FROM travel_events e JOIN travels t ON t.id = e.travel_id " +
+		"WHERE e.type = ? AND t.deleted_at IS NULL GROUP BY e.detail")
+	if err != nil {
+		return nil, err
+	}
+
+	defer query.Close()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "average_time_in_status")
+	rows, err := query.QueryContext(ctx, EventStatusChanged)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	averages := make(map[Status]time.Duration)
+	for rows.Next() {
+		var status Status
+		var seconds float64
+		if err := rows.Scan(&status, &seconds); err != nil {
+			return nil, err
+		}
+
+		averages[status] = time.Duration(seconds * float64(time.Second))
+	}
+
+	return averages, rows.Err()
+}
+
+// CountCreatedByDay will get the quantity of not deleted travels created from the received date grouped by
+// creation day (formatted as yyyy-mm-dd), the days without travels are not returned
+func (sqlDb SqlRepository) CountCreatedByDay(ctx context.Context, from time.Time) (map[string]int64, error) {
+	query, err := sqlDb.db.Prepare("SELECT DATE_FORMAT(created_at, '%Y-%m-%d') AS day, COUNT(*) FROM travels " +
+		"WHERE created_at >= ? AND deleted_at IS NULL GROUP BY day")
+	if err != nil {
+		return nil, err
+	}
+
+	defer query.Close()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "count_created_by_day")
+	rows, err := query.QueryContext(ctx, from)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	counts := make(map[string]int64)
+	for rows.Next() {
+		var day string
+		var count int64
+		if err := rows.Scan(&day, &count); err != nil {
+			return nil, err
+		}
+
+		counts[day] = count
+	}
+
+	return counts, rows.Err()
+}
+
+// Punctuality will summarize the actual against the estimated duration of the not deleted ready travels that have
+// both measured
+func (sqlDb SqlRepository) Punctuality(ctx context.Context) (Punctuality, error) {
+	query, err := sqlDb.db.Prepare("SELECT COUNT(*), COALESCE(SUM(actual_minutes <= estimated_minutes), 0), " +
+		"COALESCE(AVG(actual_minutes - estimated_minutes), 0) FROM travels WHERE status = ? AND deleted_at IS NULL " +
+		"AND actual_minutes IS NOT NULL AND estimated_minutes IS NOT NULL")
+	if err != nil {
+		return Punctuality{}, err
+	}
+
+	defer query.Close()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "punctuality")
+	var punctuality Punctuality
+	err = query.QueryRowContext(ctx, StatusReady).Scan(&punctuality.Completed, &punctuality.OnTime,
+		&punctuality.AverageDelayMinutes)
+	trackTime(err == nil)
+	if err != nil {
+		return Punctuality{}, err
+	}
+
+	return punctuality, nil
+}
+
+// heatmapWindowFormats are the date formats that truncate a date to the start of each heatmap window
+var heatmapWindowFormats = map[HeatmapWindow]string{
+	HeatmapWindowHour: "%Y-%m-%dT%H:00:00Z",
+	HeatmapWindowDay:  "%Y-%m-%dT00:00:00Z",
+}
+
+// Heatmap will count the pickups (from) and dropoffs (to) of the not deleted travels created on the query range,
+// grouped by the geohash of the location and the window of the creation date
+func (sqlDb SqlRepository) Heatmap(ctx context.Context, query HeatmapQuery) ([]HeatmapCell, error) {
+	windowFormat, ok := heatmapWindowFormats[query.Window]
+	if !ok {
+		return nil, fmt.Errorf("invalid heatmap window %q", query.Window)
+	}
+
+	statement, err := sqlDb.db.Prepare("SELECT cell, time_window, SUM(kind = 'pickup'), SUM(kind = 'dropoff') FROM (" +
+		"SELECT 'pickup' AS kind, ST_GeoHash(`from`, ?) AS cell, DATE_FORMAT(created_at, ?) AS time_window " +
+		"FROM travels WHERE deleted_at IS NULL AND created_at >= ? AND created_at < ? " +
+		"UNION ALL " +
+		"SELECT 'dropoff' AS kind, ST_GeoHash(`to`, ?) AS cell, DATE_FORMAT(created_at, ?) AS time_window " +
+		"FROM travels WHERE deleted_at IS NULL AND created_at >= ? AND created_at < ?" +
+		") locations GROUP BY time_window, cell ORDER BY time_window, cell")
+	if err != nil {
+		return nil, err
+	}
+
+	defer statement.Close()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "heatmap")
+	rows, err := statement.QueryContext(ctx,
+		query.Precision, windowFormat, query.From, query.To,
+		query.Precision, windowFormat, query.From, query.To)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var cells []HeatmapCell
+	for rows.Next() {
+		var cell HeatmapCell
+		if err := rows.Scan(&cell.Geohash, &cell.Window, &cell.Pickups, &cell.Dropoffs); err != nil {
+			return nil, err
+		}
+
+		cells = append(cells, cell)
+	}
+
+	return cells, rows.Err()
+}
+
+// expireBatchSize is the max quantity of travels handled on each call to the background jobs (expiration, overdue
+// and archive)
+const expireBatchSize = 500
+
+// ExpirePending will cancel the pending travels created before the received date (up to expireBatchSize travels)
+// and store an EventExpired with the received detail and an EventStatusChanged for each one, all inside a
+// transaction. It return the ids
+// of the cancelled travels
+func (sqlDb SqlRepository) ExpirePending(ctx context.Context, createdBefore time.Time, detail string) ([]int64, error) {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// rollback has no effect once the transaction is committed
+	defer tx.Rollback()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "select_expired")
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM travels WHERE status = ? AND created_at < ? "+
+		"AND deleted_at IS NULL ORDER BY id LIMIT ? FOR UPDATE", StatusPending, createdBefore, expireBatchSize)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, tx.Commit()
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := []interface{}{StatusCancelled}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	trackTime = trackElapsed(ctx, entityMetricName, "update_expired")
+	_, err = tx.ExecContext(ctx, "UPDATE travels SET status = ? WHERE id IN ("+placeholders+")", args...)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now().UTC().Truncate(time.Second)
+	events := make([]Event, 0, 2*len(ids))
+	for _, id := range ids {
+		events = append(events,
+			Event{TravelID: id, Type: EventExpired, Detail: detail, CreatedAt: now},
+			Event{TravelID: id, Type: EventStatusChanged, Detail: string(StatusPending), CreatedAt: now})
+	}
+
+	if err := insertEvents(ctx, tx, events); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// ExpireOffers will send back to pending (without user) the offered travels whose offer expired before the
+// received date (up to expireBatchSize travels) and store an EventOfferExpired and an EventStatusChanged for each
+// one, all inside a transaction. It return the ids of the travels sent back to pending
+func (sqlDb SqlRepository) ExpireOffers(ctx context.Context, expiredBefore time.Time) ([]int64, error) {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// rollback has no effect once the transaction is committed
+	defer tx.Rollback()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "select_expired_offers")
+	rows, err := tx.QueryContext(ctx, "SELECT id, user_id FROM travels WHERE status = ? AND offer_expires_at < ? "+
+		"AND deleted_at IS NULL ORDER BY id LIMIT ? FOR UPDATE", StatusOffered, expiredBefore, expireBatchSize)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	var events []Event
+	now := time.Now().UTC().Truncate(time.Second)
+	for rows.Next() {
+		var id int64
+		var userID sql.NullInt64
+		if err := rows.Scan(&id, &userID); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		ids = append(ids, id)
+		events = append(events,
+			Event{TravelID: id, Type: EventOfferExpired, Detail: strconv.FormatInt(userID.Int64, 10), CreatedAt: now},
+			Event{TravelID: id, Type: EventStatusChanged, Detail: string(StatusOffered), CreatedAt: now})
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, tx.Commit()
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := []interface{}{StatusPending}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	trackTime = trackElapsed(ctx, entityMetricName, "update_expired_offers")
+	_, err = tx.ExecContext(ctx, "UPDATE travels SET status = ?, user_id = NULL, offer_expires_at = NULL "+
+		"WHERE id IN ("+placeholders+")", args...)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := insertEvents(ctx, tx, events); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// MarkOverdue will store an EventOverdue for the in process travels whose deadline passed before the received date
+// and do not have one yet (up to expireBatchSize travels), all inside a transaction. It return the ids of the
+// travels marked as overdue
+func (sqlDb SqlRepository) MarkOverdue(ctx context.Context, now time.Time) ([]int64, error) {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// rollback has no effect once the transaction is committed
+	defer tx.Rollback()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "select_overdue")
+	rows, err := tx.QueryContext(ctx, "SELECT id, deadline FROM travels WHERE status = ? AND deadline < ? "+
+		"AND deleted_at IS NULL AND NOT EXISTS (SELECT 1 FROM travel_events WHERE travel_events.travel_id = travels.id "+
+		"AND travel_events.type = ?) ORDER BY id LIMIT ? FOR UPDATE",
+		StatusInProcess, now, EventOverdue, expireBatchSize)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	var events []Event
+	createdAt := now.UTC().Truncate(time.Second)
+	for rows.Next() {
+		var id int64
+		var deadline time.Time
+		if err := rows.Scan(&id, &deadline); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		ids = append(ids, id)
+		events = append(events,
+			Event{TravelID: id, Type: EventOverdue, Detail: deadline.Format(time.RFC3339), CreatedAt: createdAt})
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, tx.Commit()
+	}
+
+	if err := insertEvents(ctx, tx, events); err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// ArchiveTravels will move the ready and cancelled travels created before the received date (up to expireBatchSize
+// travels) from travels to travels_archive table, all inside a transaction. Tags, events and ratings are kept as
+// they reference the travel id. It return the ids of the archived travels
+func (sqlDb SqlRepository) ArchiveTravels(ctx context.Context, createdBefore time.Time) ([]int64, error) {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	// rollback has no effect once the transaction is committed
+	defer tx.Rollback()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "select_to_archive")
+	rows, err := tx.QueryContext(ctx, "SELECT id FROM travels WHERE status IN (?, ?) AND created_at < ? "+
+		"ORDER BY id LIMIT ? FOR UPDATE", StatusReady, StatusCancelled, createdBefore, expireBatchSize)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	if len(ids) == 0 {
+		return nil, tx.Commit()
+	}
+
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(ids)), ", ")
+	args := []interface{}{time.Now().UTC().Truncate(time.Second)}
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	trackTime = trackElapsed(ctx, "travel_archive", "insert")
+	_, err = tx.ExecContext(ctx, "INSERT INTO travels_archive(id, uuid, user_id, `from`, `to`, status, created_at, "+
+		"deleted_at, deadline, offer_expires_at, outside_zones, queue_position, started_at, completed_at, "+
+		"estimated_minutes, actual_minutes, priority, from_altitude, to_altitude, archived_at) SELECT id, uuid, user_id, "+
+		"`from`, `to`, status, created_at, deleted_at, deadline, offer_expires_at, outside_zones, queue_position, "+
+		"started_at, completed_at, estimated_minutes, actual_minutes, priority, from_altitude, to_altitude, ? FROM travels WHERE id IN ("+placeholders+")", args...)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	trackTime = trackElapsed(ctx, entityMetricName, "delete_archived")
+	_, err = tx.ExecContext(ctx, "DELETE FROM travels WHERE id IN ("+placeholders+")", args[1:]...)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return nil, err
+	}
+
+	return ids, nil
+}
+
+// insertEvents store the received travel events on sql table using the received transaction
+func insertEvents(ctx context.Context, tx *sql.Tx, events []Event) error {
+	values := strings.TrimSuffix(strings.Repeat("(?, ?, ?, ?), ", len(events)), ", ")
+	var args []interface{}
+	for _, event := range events {
+		args = append(args, event.TravelID, event.Type, event.Detail, event.CreatedAt)
+	}
+
+	trackTime := trackElapsed(ctx, "travel_event", "insert")
+	_, err := tx.ExecContext(ctx, "INSERT INTO travel_events(travel_id, type, detail, created_at) VALUES "+values,
+		args...)
+	trackTime(err == nil)
+
+	return err
+}
+
+// insertTags store the received tags of a travel on sql table using the received transaction
+func insertTags(ctx context.Context, tx *sql.Tx, travelID int64, tags []string) error {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	values := strings.TrimSuffix(strings.Repeat("(?, ?), ", len(tags)), ", ")
+	var args []interface{}
+	for _, tag := range tags {
+		args = append(args, travelID, tag)
+	}
+
+	trackTime := trackElapsed(ctx, "travel_tag", "insert")
+	_, err := tx.ExecContext(ctx, "INSERT INTO travel_tags(travel_id, tag) VALUES "+values, args...)
+	trackTime(err == nil)
+
+	return err
+}
+
+// equalTags return if both lists have the same tags in the same order
+func equalTags(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+
+	return true
+}
+
+// searchConditions build the where clause (with its arguments) to filter travels by the received search
+func searchConditions(search Search) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+
+	if !search.IncludeDeleted {
+		conditions = append(conditions, "deleted_at IS NULL")
+	}
+
+	if search.UserID != 0 {
+		conditions = append(conditions, "user_id = ?")
+		args = append(args, search.UserID)
+	}
+
+	if search.TeamID != 0 {
+		conditions = append(conditions, "user_id IN (SELECT user_id FROM team_members WHERE team_id = ?)")
+		args = append(args, search.TeamID)
+	}
+
+	if len(search.VisibleTeams) > 0 {
+		conditions = append(conditions, fmt.Sprintf("(user_id IS NULL OR user_id IN "+
+			"(SELECT user_id FROM team_members WHERE team_id IN (%s)))",
+			strings.TrimSuffix(strings.Repeat("?, ", len(search.VisibleTeams)), ", ")))
+		for _, teamID := range search.VisibleTeams {
+			args = append(args, teamID)
+		}
+	}
+
+	if search.Tag != "" {
+		conditions = append(conditions,
+			"EXISTS (SELECT 1 FROM travel_tags WHERE travel_tags.travel_id = travels.id AND travel_tags.tag = ?)")
+		args = append(args, search.Tag)
+	}
+
+	if len(search.Status) > 0 {
+		conditions = append(conditions,
+			fmt.Sprintf("status IN (%s)", strings.TrimSuffix(strings.Repeat("?, ", len(search.Status)), ", ")))
+		for _, status := range search.Status {
+			args = append(args, status)
+		}
+	}
+
+	if !search.CreatedFrom.IsZero() {
+		conditions = append(conditions, "created_at >= ?")
+		args = append(args, search.CreatedFrom)
+	}
+
+	if !search.CreatedTo.IsZero() {
+		conditions = append(conditions, "created_at < ?")
+		args = append(args, search.CreatedTo)
+	}
+
+	if !search.CompletedFrom.IsZero() {
+		conditions = append(conditions, "completed_at >= ?")
+		args = append(args, search.CompletedFrom)
+	}
+
+	if !search.CompletedTo.IsZero() {
+		conditions = append(conditions, "completed_at < ?")
+		args = append(args, search.CompletedTo)
+	}
+
+	if !search.OverdueAt.IsZero() {
+		conditions = append(conditions, "status = ?", "deadline < ?")
+		args = append(args, StatusInProcess, search.OverdueAt)
+	}
+
+	if search.Near != nil {
+		// the bounding box filter use the spatial index, then the exact distance is checked
+		southWest, northEast := search.Near.BoundingBox(search.RadiusKm)
+		conditions = append(conditions, "MBRContains(ST_GeomFromText(?), `from`)",
+			"ST_Distance_Sphere(`from`, ST_GeomFromText(?)) <= ?")
+		args = append(args, boxWKT(southWest, northEast), *search.Near, search.RadiusKm*1000)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// searchOrder build the order clause (with its arguments) for the received search, by default travels are
+// ordered by id
+func searchOrder(search Search) (string, []interface{}) {
+	if search.ByPriority {
+		return " ORDER BY FIELD(priority, ?, ?, ?), created_at, id",
+			[]interface{}{PriorityHigh, PriorityNormal, PriorityLow}
+	}
+
+	if search.Near != nil {
+		return " ORDER BY ST_Distance_Sphere(`from`, ST_GeomFromText(?)), id", []interface{}{*search.Near}
+	}
+
+	return " ORDER BY id", nil
+}
+
+// SaveRating will store a travel Rating on sql table, a travel can only have one rating
+func (sqlDb SqlRepository) SaveRating(ctx context.Context, rating Rating) error {
+	q, err := sqlDb.db.Prepare("INSERT INTO ratings(travel_id, user_id, score, comment) VALUES(?, ?, ?, ?)")
+	if err != nil {
+		return err
+	}
+
+	defer q.Close()
+
+	trackTime := trackElapsed(ctx, "rating", "insert")
+	_, err = q.ExecContext(ctx, rating.TravelID, rating.UserID, rating.Score, rating.Comment)
+	trackTime(err == nil)
+	if err != nil {
+		var mysqlErr *mysql.MySQLError
+		if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+			return ErrRatingDuplicated
+		}
+		return err
+	}
+
+	return nil
+}
+
+// SaveAttachment will store the metadata of a travel Attachment on sql table
+func (sqlDb SqlRepository) SaveAttachment(ctx context.Context, attachment Attachment) (Attachment, error) {
+	q, err := sqlDb.db.Prepare("INSERT INTO travel_attachments(travel_id, user_id, kind, content_type, size, " +
+		"storage_key, created_at) VALUES(?, ?, ?, ?, ?, ?, ?)")
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	defer q.Close()
+
+	trackTime := trackElapsed(ctx, "travel_attachment", "insert")
+	result, err := q.ExecContext(ctx, attachment.TravelID, attachment.UserID, attachment.Kind,
+		attachment.ContentType, attachment.Size, attachment.Key, attachment.CreatedAt)
+	trackTime(err == nil)
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	attachment.ID, err = result.LastInsertId()
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	return attachment, nil
+}
+
+// GetAttachments will get the attachments of the travel with the received id, ordered by creation
+func (sqlDb SqlRepository) GetAttachments(ctx context.Context, travelID int64) ([]Attachment, error) {
+	trackTime := trackElapsed(ctx, "travel_attachment", "select")
+	rows, err := sqlDb.db.QueryContext(ctx, "SELECT id, travel_id, user_id, kind, content_type, size, storage_key, "+
+		"created_at FROM travel_attachments WHERE travel_id = ? ORDER BY id", travelID)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		var attachment Attachment
+		err := rows.Scan(&attachment.ID, &attachment.TravelID, &attachment.UserID, &attachment.Kind,
+			&attachment.ContentType, &attachment.Size, &attachment.Key, &attachment.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		attachments = append(attachments, attachment)
+	}
+
+	return attachments, rows.Err()
+}
+
+// SaveTracePoint will store a location of a travel trace on sql table
+func (sqlDb SqlRepository) SaveTracePoint(ctx context.Context, point TracePoint) (TracePoint, error) {
+	q, err := sqlDb.db.Prepare("INSERT INTO travel_locations(travel_id, user_id, location, altitude, recorded_at) " +
+		"VALUES(?, ?, ST_GeomFromText(?), ?, ?)")
+	if err != nil {
+		return TracePoint{}, err
+	}
+
+	defer q.Close()
+
+	trackTime := trackElapsed(ctx, "travel_location", "insert")
+	result, err := q.ExecContext(ctx, point.TravelID, point.UserID, point.Location, point.Location.Altitude,
+		point.RecordedAt)
+	trackTime(err == nil)
+	if err != nil {
+		return TracePoint{}, err
+	}
+
+	point.ID, err = result.LastInsertId()
+	if err != nil {
+		return TracePoint{}, err
+	}
+
+	return point, nil
+}
+
+// GetTrace will get the locations reported for the travel with the received id, ordered by their record date
+func (sqlDb SqlRepository) GetTrace(ctx context.Context, travelID int64) ([]TracePoint, error) {
+	trackTime := trackElapsed(ctx, "travel_location", "select")
+	rows, err := sqlDb.db.QueryContext(ctx, "SELECT id, travel_id, user_id, ST_AsText(location), "+
+		"altitude, recorded_at FROM travel_locations WHERE travel_id = ? ORDER BY recorded_at, id", travelID)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	return scanTrace(rows)
+}
+
+// scanTrace read the locations of the rows selected with its id, travel id, user id, location, altitude and record
+// date
+func scanTrace(rows *sql.Rows) ([]TracePoint, error) {
+	var trace []TracePoint
+	for rows.Next() {
+		var point TracePoint
+		var altitude sql.NullFloat64
+		err := rows.Scan(&point.ID, &point.TravelID, &point.UserID, &point.Location, &altitude, &point.RecordedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		if altitude.Valid {
+			point.Location.Altitude = &altitude.Float64
+		}
+
+		trace = append(trace, point)
+	}
+
+	return trace, rows.Err()
+}
+
+// personalDataEvents are the events whose detail is the user id of the driver, recorded on travels which may not be
+// assigned to it
+var personalDataEvents = []EventType{EventOffered, EventOfferAccepted, EventOfferRejected, EventOfferExpired,
+	EventQueued, EventDequeued}
+
+// GetPersonalData will get the travels (deleted and archived too) of the user with the received id, the locations
+// it reported, its ratings and the events of its travels and of the offers and queues where it was the driver
+func (sqlDb SqlRepository) GetPersonalData(ctx context.Context, userID int64) (PersonalData, error) {
+	var data PersonalData
+
+	// the archive is aliased as travels so travelColumns can be reused
+	for _, table := range []string{"travels", "travels_archive AS travels"} {
+		trackTime := trackElapsed(ctx, entityMetricName, "select_personal_data")
+		rows, err := sqlDb.db.QueryContext(ctx, "SELECT "+travelColumns+" FROM "+table+" WHERE user_id = ? "+
+			"ORDER BY id", userID)
+		trackTime(err == nil)
+		if err != nil {
+			return PersonalData{}, err
+		}
+
+		for rows.Next() {
+			travel, err := scanTravel(rows)
+			if err != nil {
+				rows.Close()
+				return PersonalData{}, err
+			}
+
+			data.Travels = append(data.Travels, travel)
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return PersonalData{}, err
+		}
+	}
+
+	trackTime := trackElapsed(ctx, "travel_location", "select_personal_data")
+	rows, err := sqlDb.db.QueryContext(ctx, "SELECT id, travel_id, user_id, ST_AsText(location), altitude, "+
+		"recorded_at FROM travel_locations WHERE user_id = ? ORDER BY recorded_at, id", userID)
+	trackTime(err == nil)
+	if err != nil {
+		return PersonalData{}, err
+	}
+
+	data.Locations, err = scanTrace(rows)
+	rows.Close()
+	if err != nil {
+		return PersonalData{}, err
+	}
+
+	trackTime = trackElapsed(ctx, "rating", "select_personal_data")
+	rows, err = sqlDb.db.QueryContext(ctx, "SELECT travel_id, user_id, score, comment FROM ratings "+
+		"WHERE user_id = ? ORDER BY travel_id", userID)
+	trackTime(err == nil)
+	if err != nil {
+		return PersonalData{}, err
+	}
+
+	for rows.Next() {
+		var rating Rating
+		var comment sql.NullString
+		if err := rows.Scan(&rating.TravelID, &rating.UserID, &rating.Score, &comment); err != nil {
+			rows.Close()
+			return PersonalData{}, err
+		}
+
+		rating.Comment = comment.String
+		data.Ratings = append(data.Ratings, rating)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return PersonalData{}, err
+	}
+
+	args := []interface{}{userID, userID}
+	for _, eventType := range personalDataEvents {
+		args = append(args, eventType)
+	}
+	args = append(args, strconv.FormatInt(userID, 10))
+
+	trackTime = trackElapsed(ctx, "travel_event", "select_personal_data")
+	rows, err = sqlDb.db.QueryContext(ctx, "SELECT id, travel_id, type, detail, created_at FROM travel_events "+
+		"WHERE travel_id IN (SELECT id FROM travels WHERE user_id = ? UNION SELECT id FROM travels_archive "+
+		"WHERE user_id = ?) OR (type IN (?"+strings.Repeat(", ?", len(personalDataEvents)-1)+") AND detail = ?) "+
+		"ORDER BY created_at, id", args...)
+	trackTime(err == nil)
+	if err != nil {
+		return PersonalData{}, err
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var event Event
+		var detail sql.NullString
+		if err := rows.Scan(&event.ID, &event.TravelID, &event.Type, &detail, &event.CreatedAt); err != nil {
+			return PersonalData{}, err
+		}
+
+		event.Detail = detail.String
+		data.Events = append(data.Events, event)
+	}
+
+	return data, rows.Err()
+}
+
+// ErasePersonalData will delete the locations reported by the user with the received id and the comments of its
+// ratings, in a single transaction
+func (sqlDb SqlRepository) ErasePersonalData(ctx context.Context, userID int64) error {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	trackTime := trackElapsed(ctx, "travel_location", "delete_personal_data")
+	_, err = tx.ExecContext(ctx, "DELETE FROM travel_locations WHERE user_id = ?", userID)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	trackTime = trackElapsed(ctx, "rating", "erase_personal_data")
+	_, err = tx.ExecContext(ctx, "UPDATE ratings SET comment = NULL WHERE user_id = ?", userID)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// rowScanner is the scan capability shared by sql.Row and sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanTravel read a travel from a row selected with travelColumns
+func scanTravel(row rowScanner) (Travel, error) {
+	var travel Travel
+	var userID sql.NullInt64
+	var deletedAt, deadline, offerExpiresAt, startedAt, completedAt sql.NullTime
+	var queuePosition, estimatedMinutes sql.NullInt64
+	var actualMinutes, fromAltitude, toAltitude sql.NullFloat64
+	var tags sql.NullString
+	err := row.Scan(&travel.ID, &travel.UUID, &travel.Status, &travel.From, &travel.To, &userID, &travel.CreatedAt, &deletedAt,
+		&deadline, &offerExpiresAt, &travel.OutsideZones, &queuePosition, &startedAt, &completedAt, &estimatedMinutes,
+		&actualMinutes, &travel.Priority, &fromAltitude, &toAltitude, &tags)
+	if err != nil {
+		return Travel{}, err
+	}
+
+	if userID.Valid {
+		travel.UserID = userID.Int64
+	}
+
+	if deletedAt.Valid {
+		travel.DeletedAt = &deletedAt.Time
+	}
+
+	if deadline.Valid {
+		travel.Deadline = &deadline.Time
+	}
+
+	if offerExpiresAt.Valid {
+		travel.OfferExpiresAt = &offerExpiresAt.Time
+	}
+
+	if queuePosition.Valid {
+		position := int(queuePosition.Int64)
+		travel.QueuePosition = &position
+	}
+
+	if startedAt.Valid {
+		travel.StartedAt = &startedAt.Time
+	}
+
+	if completedAt.Valid {
+		travel.CompletedAt = &completedAt.Time
+	}
+
+	if estimatedMinutes.Valid {
+		travel.EstimatedMinutes = &estimatedMinutes.Int64
+	}
+
+	if actualMinutes.Valid {
+		travel.ActualMinutes = &actualMinutes.Float64
+	}
+
+	if fromAltitude.Valid {
+		travel.From.Altitude = &fromAltitude.Float64
+	}
+
+	if toAltitude.Valid {
+		travel.To.Altitude = &toAltitude.Float64
+	}
+
+	if tags.Valid && tags.String != "" {
+		travel.Tags = strings.Split(tags.String, ",")
+	}
+
+	return travel, nil
+}
+
+// boxWKT return the well-known text representation of the rectangle with the received corners
+func boxWKT(southWest, northEast Point) string {
+	swLat := strconv.FormatFloat(southWest.Lat, 'g', -1, 64)
+	swLng := strconv.FormatFloat(southWest.Lng, 'g', -1, 64)
+	neLat := strconv.FormatFloat(northEast.Lat, 'g', -1, 64)
+	neLng := strconv.FormatFloat(northEast.Lng, 'g', -1, 64)
+
+	return fmt.Sprintf("POLYGON((%[1]s %[2]s, %[3]s %[2]s, %[3]s %[4]s, %[1]s %[4]s, %[1]s %[2]s))",
+		swLng, swLat, neLng, neLat)
+}
+
+// trackElapsed trace the time of a query as a metric and a span of the trace of the context
+func trackElapsed(ctx context.Context, entity, action string) func(success bool) {
+	start := time.Now()
+	_, span := tracing.Start(ctx, tracing.KindClient, action+" "+entity, []string{
+		"db.system", "mysql",
+		"db.operation", action,
+		"db.sql.table", entity})
+	return func(success bool) {
+		metrics.Timing(ctx, timeMetricName, time.Since(start),
+			[]string{
+				"result", strconv.FormatBool(success),
+				"action", action,
+				"entity", entity})
+
+		if !success {
+			span.Fail("the query failed")
+		}
+		span.End()
 	}
 }
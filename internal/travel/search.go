@@ -0,0 +1,236 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"time"
+)
+
+var (
+	ErrInvalidStatusToSearch     = code_error.Error{Code: "invalid_status", Detail: "invalid status received to search"}
+	ErrInvalidUserSearch         = code_error.Error{Code: "invalid_user_access", Detail: "the user logged in cannot search travels of another user"}
+	ErrInvalidUserSearchStatus   = code_error.Error{Code: "invalid_user_access", Detail: "the user logged in can only search pending travels"}
+	ErrInvalidUserIncludeDeleted = code_error.Error{Code: "invalid_user_access", Detail: "only admin users can include deleted travels"}
+	ErrInvalidSearchRadius       = code_error.Error{Code: "invalid_radius", Detail: "the search radius should be greater than 0 and at most 500 km"}
+)
+
+// maxSearchRadiusKm is the biggest radius accepted to search travels near a location
+const maxSearchRadiusKm = 500
+
+// Search holds the filters and pagination used to search travels on repository
+type Search struct {
+	UserID int64
+	Status []Status
+	Tag    string
+	Offset int64
+	Limit  int64
+
+	// TeamID filter the travels assigned to the members of the team
+	TeamID int64
+
+	// VisibleTeams filter the travels without driver or assigned to the members of any of the teams, it is the
+	// visibility of the dispatchers members of teams (see WithTeamFinder)
+	VisibleTeams []int64
+
+	// CreatedFrom and CreatedTo filter the travels created on [CreatedFrom, CreatedTo)
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+
+	// CompletedFrom and CompletedTo filter the travels completed (set ready) on [CompletedFrom, CompletedTo)
+	CompletedFrom time.Time
+	CompletedTo   time.Time
+
+	// Near filter the travels starting within RadiusKm of the point, ordered by distance
+	Near     *Point
+	RadiusKm float64
+
+	// ByPriority order the travels by priority (high first) and then by age, instead of by distance or id
+	ByPriority bool
+
+	// OverdueAt filter the in process travels whose deadline passed before it
+	OverdueAt time.Time
+	// overdue set OverdueAt to the current time of the clock of the storage searching (see WithOverdue)
+	overdue bool
+
+	// IncludeDeleted also return the soft deleted travels
+	IncludeDeleted bool
+}
+
+type SearchOption func(s *Search)
+
+// WithUser filter the travels assigned to the received user id
+func WithUser(userID int64) SearchOption {
+	return func(s *Search) {
+		s.UserID = userID
+	}
+}
+
+// WithStatus filter the travels on any of the received status
+func WithStatus(status ...Status) SearchOption {
+	return func(s *Search) {
+		s.Status = append(s.Status, status...)
+	}
+}
+
+// WithTag filter the travels labeled with the received tag
+func WithTag(tag string) SearchOption {
+	return func(s *Search) {
+		s.Tag = NormalizeTag(tag)
+	}
+}
+
+// WithTeam filter the travels assigned to the members of the team with the received id
+func WithTeam(teamID int64) SearchOption {
+	return func(s *Search) {
+		s.TeamID = teamID
+	}
+}
+
+// WithNear filter the travels that start within the received radius (in kilometers) from the point
+func WithNear(point Point, radiusKm float64) SearchOption {
+	return func(s *Search) {
+		s.Near = &point
+		s.RadiusKm = radiusKm
+	}
+}
+
+// WithCreatedBetween filter the travels created from (inclusive) and to (exclusive) the received dates, a zero
+// date is not used as filter
+func WithCreatedBetween(from, to time.Time) SearchOption {
+	return func(s *Search) {
+		s.CreatedFrom = from
+		s.CreatedTo = to
+	}
+}
+
+// WithDeleted include the soft deleted travels on the search
+func WithDeleted() SearchOption {
+	return func(s *Search) {
+		s.IncludeDeleted = true
+	}
+}
+
+// WithOverdue filter the in process travels whose deadline already passed
+func WithOverdue() SearchOption {
+	return func(s *Search) {
+		s.overdue = true
+	}
+}
+
+// WithPriorityOrder order the travels by priority, high first, and then by age, oldest first
+func WithPriorityOrder() SearchOption {
+	return func(s *Search) {
+		s.ByPriority = true
+	}
+}
+
+func WithOffset(offset int64) SearchOption {
+	return func(s *Search) {
+		s.Offset = offset
+	}
+}
+
+func WithLimit(limit int64) SearchOption {
+	return func(s *Search) {
+		s.Limit = limit
+	}
+}
+
+type Metadata struct {
+	Total   int64
+	Pending int64
+}
+
+// Search travels on repository applying the received options, by default the first 20 travels are returned
+func (travelStorage TravelStorage) Search(ctx context.Context, opt ...SearchOption) ([]Travel, Metadata, error) {
+	// default search options
+	search := Search{
+		Offset: 0,
+		Limit:  20,
+	}
+
+	// apply options
+	for _, option := range opt {
+		option(&search)
+	}
+	if search.overdue {
+		search.OverdueAt = travelStorage.clock.Now().UTC()
+	}
+
+	if err := validateSearch(ctx, search); err != nil {
+		return nil, Metadata{}, err
+	}
+
+	search, err := travelStorage.teamScope(ctx, search)
+	if err != nil {
+		return nil, Metadata{}, err
+	}
+
+	travels, total, err := travelStorage.repository.SearchTravels(ctx, search)
+	if err != nil {
+		log.Error(ctx, "there was an error searching travels", log.Err(err))
+		return nil, Metadata{}, ErrStorageGet
+	}
+
+	metadata := Metadata{
+		Total:   total,
+		Pending: total - search.Limit - search.Offset,
+	}
+	if metadata.Pending < 0 {
+		metadata.Pending = 0
+	}
+
+	return travels, metadata, nil
+}
+
+// Each call fn with every travel matching the received options (pagination is ignored), without loading all of
+// them in memory. The iteration stops on the first error returned by fn
+func (travelStorage TravelStorage) Each(ctx context.Context, fn func(Travel) error, opt ...SearchOption) error {
+	var search Search
+	for _, option := range opt {
+		option(&search)
+	}
+
+	if err := validateSearch(ctx, search); err != nil {
+		return err
+	}
+
+	search, err := travelStorage.teamScope(ctx, search)
+	if err != nil {
+		return err
+	}
+
+	err = travelStorage.repository.IterateTravels(ctx, search, fn)
+	if err != nil {
+		log.Error(ctx, "there was an error iterating travels", log.Err(err))
+		return ErrStorageGet
+	}
+
+	return nil
+}
+
+// validateSearch business validation on search filters
+func validateSearch(ctx context.Context, search Search) error {
+	for _, status := range search.Status {
+		if !isValidStatus(status) {
+			log.Info(ctx, "invalid check on search travel: invalid status",
+				log.String("travel_status", string(status)))
+			return ErrInvalidStatusToSearch
+		}
+	}
+
+	if search.Near != nil && !search.Near.Valid() {
+		log.Info(ctx, "invalid check on search travel: invalid near coordinates",
+			log.String("near", search.Near.String()))
+		return ErrInvalidCoordinates
+	}
+
+	if search.Near != nil && (search.RadiusKm <= 0 || search.RadiusKm > maxSearchRadiusKm) {
+		log.Info(ctx, "invalid check on search travel: invalid radius",
+			log.Float64("radius_km", search.RadiusKm))
+		return ErrInvalidSearchRadius
+	}
+
+	return nil
+}
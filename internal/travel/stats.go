@@ -0,0 +1,91 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"math"
+	"time"
+)
+
+const (
+	// DefaultStatsDays is the quantity of days used for the travels created per day when none is received
+	DefaultStatsDays = 7
+	maxStatsDays     = 90
+
+	statsDayLayout = "2006-01-02"
+)
+
+var ErrInvalidStatsDays = code_error.Error{Code: "invalid_days", Detail: "the stats days should be between 1 and 90"}
+
+// Stats is a summary of the not deleted travels
+type Stats struct {
+	// CountByStatus is the quantity of travels on each status
+	CountByStatus map[Status]int64 `json:"count_by_status"`
+	// AverageMinutesInStatus is the average time the travels stayed on each status before leaving it
+	AverageMinutesInStatus map[Status]float64 `json:"average_minutes_in_status"`
+	// CreatedPerDay is the quantity of travels created on each of the last days, from the oldest to today
+	CreatedPerDay []DayCount `json:"created_per_day"`
+	// Punctuality is the actual against the estimated duration of the ready travels
+	Punctuality Punctuality `json:"punctuality"`
+}
+
+// DayCount is a quantity of travels on a day formatted as yyyy-mm-dd
+type DayCount struct {
+	Date  string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+// Stats return a summary of the travels, with the travels created per day for the last received days (including
+// today, on UTC)
+func (travelStorage TravelStorage) Stats(ctx context.Context, days int) (Stats, error) {
+	if days < 1 || days > maxStatsDays {
+		log.Info(ctx, "invalid check on travel stats: invalid days", log.Int64("days", int64(days)))
+		return Stats{}, ErrInvalidStatsDays
+	}
+
+	counts, err := travelStorage.CountByStatus(ctx)
+	if err != nil {
+		return Stats{}, err
+	}
+
+	averages, err := travelStorage.repository.AverageTimeInStatus(ctx)
+	if err != nil {
+		log.Error(ctx, "there was an error getting average time in status of travels", log.Err(err))
+		return Stats{}, ErrStorageGet
+	}
+
+	now := travelStorage.clock.Now().UTC()
+	from := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC).AddDate(0, 0, 1-days)
+	created, err := travelStorage.repository.CountCreatedByDay(ctx, from)
+	if err != nil {
+		log.Error(ctx, "there was an error counting travels created by day", log.Err(err))
+		return Stats{}, ErrStorageGet
+	}
+
+	punctuality, err := travelStorage.repository.Punctuality(ctx)
+	if err != nil {
+		log.Error(ctx, "there was an error getting travels punctuality", log.Err(err))
+		return Stats{}, ErrStorageGet
+	}
+	punctuality.AverageDelayMinutes = roundCents(punctuality.AverageDelayMinutes)
+
+	stats := Stats{
+		CountByStatus:          counts,
+		Punctuality:            punctuality,
+		AverageMinutesInStatus: make(map[Status]float64, len(averages)),
+		CreatedPerDay:          make([]DayCount, 0, days),
+	}
+
+	for status, average := range averages {
+		stats.AverageMinutesInStatus[status] = math.Round(average.Minutes()*100) / 100
+	}
+
+	// every day is returned, even the ones without travels
+	for day := from; day.Before(now); day = day.AddDate(0, 0, 1) {
+		date := day.Format(statsDayLayout)
+		stats.CreatedPerDay = append(stats.CreatedPerDay, DayCount{Date: date, Count: created[date]})
+	}
+
+	return stats, nil
+}
@@ -0,0 +1,54 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"time"
+)
+
+const travelsCountMetric = "application.space.travels.count"
+
+// CountByStatus return the quantity of travels on each status
+func (travelStorage TravelStorage) CountByStatus(ctx context.Context) (map[Status]int64, error) {
+	counts, err := travelStorage.repository.CountByStatus(ctx)
+	if err != nil {
+		log.Error(ctx, "there was an error counting travels by status", log.Err(err))
+		return nil, ErrStorageGet
+	}
+
+	result := make(map[Status]int64, len(travelStatus))
+	for _, status := range travelStatus {
+		result[status] = counts[status]
+	}
+
+	return result, nil
+}
+
+// ReportStatusCount emit a gauge with the quantity of travels on each status every interval, until the context
+// is done. It is meant to be run on its own goroutine
+func (travelStorage TravelStorage) ReportStatusCount(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		travelStorage.reportStatusCount(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (travelStorage TravelStorage) reportStatusCount(ctx context.Context) {
+	counts, err := travelStorage.CountByStatus(ctx)
+	if err != nil {
+		return
+	}
+
+	for status, count := range counts {
+		metrics.Gauge(ctx, travelsCountMetric, float64(count), []string{"status", string(status)})
+	}
+}
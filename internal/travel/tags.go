@@ -0,0 +1,49 @@
+package travel
+
+import (
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const maxTravelTags = 10
+
+var ErrInvalidTags = code_error.Error{Code: "invalid_tags", Detail: "a travel can have up to 10 tags of 1 to 30 letters, numbers, '-' or '_'"}
+
+var tagPattern = regexp.MustCompile(`^[a-z0-9_-]{1,30}$`)
+
+// normalizeTags return the received tags trimmed, lowercase, sorted and without duplicates. If any tag is invalid
+// or there are too many tags then ErrInvalidTags is returned. A nil list is kept as nil
+func normalizeTags(tags []string) ([]string, error) {
+	if tags == nil {
+		return nil, nil
+	}
+
+	seen := make(map[string]bool, len(tags))
+	normalized := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = NormalizeTag(tag)
+		if !tagPattern.MatchString(tag) {
+			return nil, ErrInvalidTags
+		}
+
+		if !seen[tag] {
+			seen[tag] = true
+			normalized = append(normalized, tag)
+		}
+	}
+
+	if len(normalized) > maxTravelTags {
+		return nil, ErrInvalidTags
+	}
+
+	sort.Strings(normalized)
+
+	return normalized, nil
+}
+
+// NormalizeTag return the received tag as it is stored, trimmed and lowercase
+func NormalizeTag(tag string) string {
+	return strings.ToLower(strings.TrimSpace(tag))
+}
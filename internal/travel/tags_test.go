@@ -0,0 +1,116 @@
+package travel
+
+import (
+	"context"
+	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func Test_normalizeTags(t *testing.T) {
+	tooMany := make([]string, 0, maxTravelTags+1)
+	for i := 0; i <= maxTravelTags; i++ {
+		tooMany = append(tooMany, fmt.Sprintf("tag%d", i))
+	}
+
+	tests := map[string]struct {
+		tags     []string
+		want     []string
+		expected error
+	}{
+		"nil tags are kept": {
+			tags: nil,
+			want: nil,
+		},
+
+		"empty tags are kept": {
+			tags: []string{},
+			want: []string{},
+		},
+
+		"tags are trimmed, lowercase, sorted and without duplicates": {
+			tags: []string{" VIP", "shift_2", "vip", "client-a"},
+			want: []string{"client-a", "shift_2", "vip"},
+		},
+
+		"invalid tag": {
+			tags:     []string{"vip", "a tag"},
+			expected: ErrInvalidTags,
+		},
+
+		"empty tag": {
+			tags:     []string{""},
+			expected: ErrInvalidTags,
+		},
+
+		"too many tags": {
+			tags:     tooMany,
+			expected: ErrInvalidTags,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := normalizeTags(tc.tags)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+			} else {
+				assert.Equal(t, tc.expected, err)
+			}
+		})
+	}
+}
+
+func Test_travelTags(t *testing.T) {
+	ctx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: "admin"})
+	db := newMockDB()
+	travelStorage := NewTravelStorage(db)
+
+	vip, err := travelStorage.Save(ctx, Travel{
+		From: Point{Lat: 1, Lng: 2},
+		To:   Point{Lat: 3, Lng: 4},
+		Tags: []string{"VIP", "campaign-x"},
+	})
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"campaign-x", "vip"}, vip.Tags)
+
+	_, err = travelStorage.Save(ctx, Travel{
+		From: Point{Lat: 1, Lng: 2},
+		To:   Point{Lat: 3, Lng: 4},
+	})
+	assert.Nil(t, err)
+
+	_, err = travelStorage.Save(ctx, Travel{
+		From: Point{Lat: 1, Lng: 2},
+		To:   Point{Lat: 3, Lng: 4},
+		Tags: []string{"not valid"},
+	})
+	assert.Equal(t, ErrInvalidTags, err)
+
+	// search by tag
+	travels, _, err := travelStorage.Search(ctx, WithTag(" Vip "))
+	assert.Nil(t, err)
+	if assert.Len(t, travels, 1) {
+		assert.Equal(t, vip.ID, travels[0].ID)
+	}
+
+	// tags are kept when they are not received on update
+	update := vip
+	update.Tags = nil
+	updated, err := travelStorage.Update(ctx, update)
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"campaign-x", "vip"}, updated.Tags)
+
+	// tags are replaced when they are received on update
+	update.Tags = []string{}
+	updated, err = travelStorage.Update(ctx, update)
+	assert.Nil(t, err)
+	assert.Empty(t, updated.Tags)
+
+	travels, _, err = travelStorage.Search(ctx, WithTag("vip"))
+	assert.Nil(t, err)
+	assert.Empty(t, travels)
+}
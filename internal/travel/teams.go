@@ -0,0 +1,127 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/user"
+)
+
+// TeamFinder return the teams where a user is a member
+type TeamFinder interface {
+	UserTeams(ctx context.Context, userID int64) ([]int64, error)
+}
+
+// WithTeamFinder scope the travels of the dispatchers members of teams: they only find, get and edit the travels
+// without driver and the ones assigned to the members of their teams. Dispatchers without teams see every travel
+func WithTeamFinder(finder TeamFinder) TravelStorageOption {
+	return func(tst *TravelStorage) {
+		tst.teams = finder
+	}
+}
+
+// teamScope return the search limited to the teams of the user logged in, when it can read every travel without
+// administering them (a dispatcher) and it is a member of any team. Searches without user logged in, or without team
+// finder, are returned as received
+func (travelStorage TravelStorage) teamScope(ctx context.Context, search Search) (Search, error) {
+	teamIDs, err := travelStorage.visibleTeams(ctx)
+	if err != nil {
+		return Search{}, err
+	}
+
+	search.VisibleTeams = teamIDs
+
+	return search, nil
+}
+
+// checkTeam return ErrNotFoundTravel when the travel is not visible to the user logged in: it is assigned to a driver
+// who is not a member of any of the teams of the user (see teamScope)
+func (travelStorage TravelStorage) checkTeam(ctx context.Context, travel Travel) error {
+	if travel.UserID == 0 {
+		return nil
+	}
+
+	visible, err := travelStorage.driverVisible(ctx, travel.UserID)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		log.Info(ctx, "invalid check on travel: the travel is assigned out of the teams of the user logged in",
+			log.Int64("travel_id", travel.ID), log.Int64("user_id", travel.UserID))
+		return ErrNotFoundTravel
+	}
+
+	return nil
+}
+
+// checkDriverTeam return ErrNotFoundTravel when the travels of the driver (as its queue or earnings) are not visible
+// to the user logged in: the driver is not a member of any of the teams of the user (see teamScope)
+func (travelStorage TravelStorage) checkDriverTeam(ctx context.Context, userID int64) error {
+	visible, err := travelStorage.driverVisible(ctx, userID)
+	if err != nil {
+		return err
+	}
+	if !visible {
+		log.Info(ctx, "invalid check on driver travels: the driver is out of the teams of the user logged in",
+			log.Int64("user_id", userID))
+		return ErrNotFoundTravel
+	}
+
+	return nil
+}
+
+// driverVisible return if the travels of the driver are visible to the user logged in: it sees every travel, or the
+// driver is a member of any of its teams
+func (travelStorage TravelStorage) driverVisible(ctx context.Context, userID int64) (bool, error) {
+	teamIDs, err := travelStorage.visibleTeams(ctx)
+	if err != nil {
+		return false, err
+	}
+	if len(teamIDs) == 0 {
+		return true, nil
+	}
+
+	driverTeamIDs, err := travelStorage.teams.UserTeams(ctx, userID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting teams of the travel driver", log.Int64("user_id", userID),
+			log.Err(err))
+		return false, ErrStorageGet
+	}
+
+	for _, driverTeamID := range driverTeamIDs {
+		for _, teamID := range teamIDs {
+			if driverTeamID == teamID {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// visibleTeams return the teams of the user logged in when its travels are limited to them (see teamScope), or nil
+// when it sees every travel
+func (travelStorage TravelStorage) visibleTeams(ctx context.Context) ([]int64, error) {
+	if travelStorage.teams == nil {
+		return nil, nil
+	}
+
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		return nil, nil
+	}
+
+	permissions := user.ClaimsPermissions(userLogged)
+	if !permissions.Has(user.PermissionTravelRead) || permissions.Has(user.PermissionTravelAdmin) {
+		return nil, nil
+	}
+
+	teamIDs, err := travelStorage.teams.UserTeams(ctx, userLogged.UserID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting teams of the user logged in on travels",
+			log.Int64("logged_user_id", userLogged.UserID), log.Err(err))
+		return nil, ErrStorageGet
+	}
+
+	return teamIDs, nil
+}
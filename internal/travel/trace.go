@@ -0,0 +1,106 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"time"
+)
+
+var (
+	ErrInvalidStatusToTrace = code_error.Error{Code: "invalid_status", Detail: "only in process travels can report locations"}
+	ErrInvalidTraceDate     = code_error.Error{Code: "invalid_recorded_at", Detail: "the location cannot be recorded on a future date"}
+	ErrStorageSaveLocation  = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to save travel location"}
+)
+
+// traceClockSkew is the time a reported location date can be ahead of the server clock
+const traceClockSkew = time.Minute
+
+// TracePoint is a location reported by the driver while the travel is in process, the trace of a travel is the
+// route it followed
+type TracePoint struct {
+	ID         int64     `json:"id"`
+	TravelID   int64     `json:"travel_id"`
+	UserID     int64     `json:"user_id"`
+	Location   Point     `json:"location" binding:"required"`
+	RecordedAt time.Time `json:"recorded_at"`
+}
+
+// ReportLocation will store the received location on the trace of the travel with the received id. Only the
+// driver assigned to the in process travel can report locations, when the record date is not received it is now
+func (travelStorage TravelStorage) ReportLocation(ctx context.Context, travelID int64, point TracePoint) (TracePoint, error) {
+	if !point.Location.Valid() {
+		log.Info(ctx, "invalid check on report travel location: invalid coordinates",
+			log.Int64("travel_id", travelID),
+			log.String("location", point.Location.String()))
+		return TracePoint{}, ErrInvalidCoordinates
+	}
+
+	now := travelStorage.clock.Now().UTC()
+	if point.RecordedAt.IsZero() {
+		point.RecordedAt = now
+	}
+	if point.RecordedAt.After(now.Add(traceClockSkew)) {
+		log.Info(ctx, "invalid check on report travel location: future record date",
+			log.Int64("travel_id", travelID),
+			log.String("recorded_at", point.RecordedAt.Format(time.RFC3339)))
+		return TracePoint{}, ErrInvalidTraceDate
+	}
+
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims",
+			log.Int64("travel_id", travelID))
+		return TracePoint{}, ErrInvalidUserClaims
+	}
+
+	travel, err := travelStorage.Get(ctx, travelID)
+	if err != nil {
+		return TracePoint{}, err
+	}
+
+	if travel.Status != StatusInProcess {
+		log.Info(ctx, "invalid check on report travel location: travel is not in process",
+			log.Int64("travel_id", travelID),
+			log.String("travel_status", string(travel.Status)))
+		return TracePoint{}, ErrInvalidStatusToTrace
+	}
+
+	if userLogged.UserID != travel.UserID {
+		log.Info(ctx, "invalid check on report travel location: the user logged in is not the travel driver",
+			log.Int64("travel_id", travelID),
+			log.Int64("travel_user_id", travel.UserID),
+			log.Int64("logged_user_id", userLogged.UserID))
+		return TracePoint{}, ErrInvalidUserAccess
+	}
+
+	point.TravelID = travel.ID
+	point.UserID = travel.UserID
+	point.RecordedAt = point.RecordedAt.UTC().Truncate(time.Second)
+
+	saved, err := travelStorage.repository.SaveTracePoint(ctx, point)
+	if err != nil {
+		log.Error(ctx, "there was an error while saving travel location", log.Int64("travel_id", travelID),
+			log.Err(err))
+		return TracePoint{}, ErrStorageSaveLocation
+	}
+
+	return saved, nil
+}
+
+// Trace return the locations reported for the travel with the received id, ordered by their record date
+func (travelStorage TravelStorage) Trace(ctx context.Context, travelID int64) ([]TracePoint, error) {
+	travel, err := travelStorage.Get(ctx, travelID)
+	if err != nil {
+		return nil, err
+	}
+
+	trace, err := travelStorage.repository.GetTrace(ctx, travel.ID)
+	if err != nil {
+		log.Error(ctx, "there was an error while getting travel trace", log.Int64("travel_id", travelID), log.Err(err))
+		return nil, ErrStorageGet
+	}
+
+	return trace, nil
+}
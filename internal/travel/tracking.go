@@ -0,0 +1,157 @@
+package travel
+
+import (
+	"context"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"strings"
+	"time"
+)
+
+// DefaultTrackingTTL is how long a tracking link can be used when no other duration is configured
+const DefaultTrackingTTL = 24 * time.Hour
+
+var (
+	ErrInvalidTracking      = code_error.Error{Code: "invalid_tracking", Detail: "the tracking link received is invalid or expired"}
+	ErrInvalidStatusToTrack = code_error.Error{Code: "invalid_status", Detail: "ready and cancelled travels cannot be tracked"}
+	ErrGenerateTracking     = code_error.Error{Code: "tracking_failure", Detail: "an error ocurred trying to generate the tracking link"}
+)
+
+// TrackingLink is a signed link to track a travel without a user, to share it with the customer. It expires, and it
+// can only be used to see the TrackingView of the travel
+type TrackingLink struct {
+	Token     string    `json:"token"`
+	Link      string    `json:"link,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// TrackingView is the read-only view of a travel on its tracking link, without the data of its driver
+type TrackingView struct {
+	UUID        string     `json:"uuid"`
+	Status      Status     `json:"status"`
+	From        Point      `json:"from"`
+	To          Point      `json:"to"`
+	Deadline    *time.Time `json:"deadline,omitempty"`
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	// Location is the last location reported by the driver and LocationAt its date, only while the travel is in
+	// process
+	Location   *Point     `json:"location,omitempty"`
+	LocationAt *time.Time `json:"location_recorded_at,omitempty"`
+
+	// ExpiresAt is when the tracking link cannot be used anymore
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+type trackingConfig struct {
+	ttl time.Duration
+	// linkURL is the url of the page to track the travels, the token is appended to it
+	linkURL string
+}
+
+// WithTracking will change how long the tracking links can be used and the url of the page to track the travels,
+// the tracking links are returned with a link to it when it is received
+func WithTracking(linkURL string, ttl time.Duration) TravelStorageOption {
+	return func(tst *TravelStorage) {
+		tst.tracking.linkURL = linkURL
+		if ttl > 0 {
+			tst.tracking.ttl = ttl
+		}
+	}
+}
+
+// ShareTracking will generate a signed tracking link of the travel with the received id, so its customer can see
+// its status and location without a user. Ready and cancelled travels cannot be tracked, and every tracking link
+// shared is logged on the audit log
+func (travelStorage TravelStorage) ShareTracking(ctx context.Context, id int64) (TrackingLink, error) {
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims on share travel tracking",
+			log.Int64("travel_id", id))
+		return TrackingLink{}, ErrInvalidUserClaims
+	}
+
+	travel, err := travelStorage.Get(ctx, id)
+	if err != nil {
+		return TrackingLink{}, err
+	}
+
+	if travel.Status == StatusReady || travel.Status == StatusCancelled {
+		log.Info(ctx, "invalid check on share travel tracking: invalid travel status",
+			log.Int64("travel_id", id),
+			log.String("travel_status", string(travel.Status)))
+		return TrackingLink{}, ErrInvalidStatusToTrack
+	}
+
+	link := TrackingLink{
+		ExpiresAt: travelStorage.clock.Now().UTC().Add(travelStorage.tracking.ttl).Truncate(time.Second),
+	}
+	link.Token, err = jwt.GenerateTracking(travel.ID, link.ExpiresAt)
+	if err != nil {
+		log.Error(ctx, "there was an error generating tracking token", log.Int64("travel_id", id), log.Err(err))
+		return TrackingLink{}, ErrGenerateTracking
+	}
+
+	if travelStorage.tracking.linkURL != "" {
+		link.Link = strings.TrimSuffix(travelStorage.tracking.linkURL, "/") + "/" + link.Token
+	}
+
+	auditlog.Log(ctx, "travel tracking shared",
+		log.Int64("travel_id", travel.ID),
+		log.Int64("logged_user_id", userLogged.UserID),
+		log.String("expires_at", link.ExpiresAt.Format(time.RFC3339)))
+
+	return link, nil
+}
+
+// Track return the view of the travel of the received tracking token, with the last location reported by its driver
+// while it is in process
+func (travelStorage TravelStorage) Track(ctx context.Context, token string) (TrackingView, error) {
+	parsed, err := jwt.ValidateToken(ctx, token)
+	if err != nil {
+		log.Info(ctx, "invalid check on track travel: invalid token", log.Err(err))
+		return TrackingView{}, ErrInvalidTracking
+	}
+
+	tracking, err := jwt.GetTracking(parsed)
+	if err != nil {
+		log.Info(ctx, "invalid check on track travel: the token is not a tracking token", log.Err(err))
+		return TrackingView{}, ErrInvalidTracking
+	}
+
+	travel, err := travelStorage.Get(ctx, tracking.TravelID)
+	if err != nil {
+		return TrackingView{}, err
+	}
+
+	view := TrackingView{
+		UUID:        travel.UUID,
+		Status:      travel.Status,
+		From:        travel.From,
+		To:          travel.To,
+		Deadline:    travel.Deadline,
+		StartedAt:   travel.StartedAt,
+		CompletedAt: travel.CompletedAt,
+		ExpiresAt:   time.Unix(tracking.Expiration, 0).UTC(),
+	}
+
+	if travel.Status == StatusInProcess {
+		trace, err := travelStorage.repository.GetTrace(ctx, travel.ID)
+		if err != nil {
+			log.Error(ctx, "there was an error while getting travel trace on track travel",
+				log.Int64("travel_id", travel.ID), log.Err(err))
+			return TrackingView{}, ErrStorageGet
+		}
+
+		if len(trace) > 0 {
+			last := trace[len(trace)-1]
+			view.Location = &last.Location
+			view.LocationAt = &last.RecordedAt
+		}
+	}
+
+	return view, nil
+}
@@ -3,10 +3,15 @@ package travel
 import (
 	"context"
 	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/clock"
 	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/filestore"
 	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/lock"
 	"github.com/nicocarolo/space-drivers/internal/platform/log"
 	"github.com/nicocarolo/space-drivers/internal/user"
+	"github.com/nicocarolo/space-drivers/internal/vehicle"
+	"time"
 )
 
 type Status string
@@ -15,10 +20,16 @@ const (
 	StatusPending   = "pending"
 	StatusInProcess = "in_process"
 	StatusReady     = "ready"
+	StatusCancelled = "cancelled"
+	StatusOffered   = "offered"
+	StatusQueued    = "queued"
 )
 
 var travelFlow = []Status{StatusPending, StatusInProcess, StatusReady}
 
+// travelStatus are all the status a travel can have, cancelled, offered and queued are out of the update flow
+var travelStatus = []Status{StatusPending, StatusInProcess, StatusReady, StatusCancelled, StatusOffered, StatusQueued}
+
 var (
 	ErrStorageSave                 = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to save travel"}
 	ErrStorageUpdate               = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to update travel"}
@@ -29,32 +40,152 @@ var (
 	ErrInvalidUser                 = code_error.Error{Code: "invalid_user", Detail: "invalid user while performing update"}
 	ErrInvalidUserClaims           = code_error.Error{Code: "invalid_user_access", Detail: "cannot identify user logged in"}
 	ErrInvalidUserAccess           = code_error.Error{Code: "invalid_user_access", Detail: "the user logged in cannot perform this action, he is not the owner of the travel or it is not an admin"}
+	ErrDriverAlreadyAssigned       = code_error.Error{Code: "driver_not_available", Detail: "the user is already assigned to another pending or in process travel"}
+	ErrTravelUpdateConflict        = code_error.Error{Code: "update_conflict", Detail: "the travel is being updated by another request, try again"}
+	ErrInvalidDeadline             = code_error.Error{Code: "invalid_deadline", Detail: "the deadline should be a future date"}
 )
 
 type Travel struct {
-	ID     int64  `json:"id"`
-	Status Status `json:"status"`
-	From   Point  `json:"from" binding:"required"`
-	To     Point  `json:"to" binding:"required"`
-	UserID int64  `json:"user_id"`
+	ID int64 `json:"id"`
+	// UUID is the public id of the travel, generated on save, it is also accepted instead of the id on the urls
+	UUID      string     `json:"uuid"`
+	Status    Status     `json:"status"`
+	From      Point      `json:"from" binding:"required"`
+	To        Point      `json:"to" binding:"required"`
+	UserID    int64      `json:"user_id"`
+	Tags      []string   `json:"tags,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	DeletedAt *time.Time `json:"deleted_at,omitempty"`
+
+	// Deadline is the optional date the travel should be ready by
+	Deadline *time.Time `json:"deadline,omitempty"`
+
+	// Priority is low, normal or high, travels are created with normal priority unless other is received
+	Priority Priority `json:"priority,omitempty"`
+
+	// OfferExpiresAt is the date until the offered driver can accept the travel (only on offered travels)
+	OfferExpiresAt *time.Time `json:"offer_expires_at,omitempty"`
+
+	// OutsideZones is true when the travel was created starting or ending outside the operating zones
+	OutsideZones bool `json:"outside_zones,omitempty"`
+
+	// QueuePosition is the position of the travel on the queue of its driver, starting at 1 (only on queued travels)
+	QueuePosition *int `json:"queue_position,omitempty"`
+
+	// StartedAt is the date the travel was set in process, and CompletedAt the date it was set ready
+	StartedAt   *time.Time `json:"started_at,omitempty"`
+	CompletedAt *time.Time `json:"completed_at,omitempty"`
+
+	// EstimatedMinutes and ActualMinutes are the estimated duration of the travel (see Pricing) and the time it
+	// was in process, both are set once the travel is ready
+	EstimatedMinutes *int64   `json:"estimated_duration_minutes,omitempty"`
+	ActualMinutes    *float64 `json:"actual_duration_minutes,omitempty"`
+
+	// Attachments are the proofs of delivery uploaded for the travel (only when it is got by id)
+	Attachments []Attachment `json:"attachments,omitempty"`
+
+	// Vehicle is the vehicle of the assigned driver (only when it is got by id or as current travel)
+	Vehicle *vehicle.Vehicle `json:"vehicle,omitempty"`
 }
 
 type TravelStorage struct {
-	repository repository
+	repository       repository
+	pricing          Pricing
+	updateValidators []UpdateValidator
+	offerTimeout     time.Duration
+	attachments      filestore.Store
+	zones            ZoneChecker
+	zonePolicy       ZonePolicy
+	vehicles         VehicleFinder
+	teams            TeamFinder
+	queueSize        int
+	tracking         trackingConfig
+	clock            clock.Clock
+	locker           lock.Lock
 }
 
-// NewTravelStorage will create and return a TravelStorage with the received repository
-func NewTravelStorage(repository repository) TravelStorage {
-	defaultUserStorage := TravelStorage{
-		repository: repository,
+// UpdateValidator is a business validation run on travel updates after the built-in ones, it receives the stored
+// travel, the changes and the logged in user. Returning a code_error.Error allows the api to answer it as a bad
+// request, any other error is answered as an internal error
+type UpdateValidator func(ctx context.Context, current, changes Travel, userLogged jwt.Claims) error
+
+// TravelStorageOption type to change TravelStorage configuration
+type TravelStorageOption func(tst *TravelStorage)
+
+// WithPricing set the fare engine used to quote travels
+func WithPricing(pricing Pricing) TravelStorageOption {
+	return func(tst *TravelStorage) {
+		tst.pricing = pricing
 	}
+}
 
-	return defaultUserStorage
+// WithClock set the clock the travels are dated and expired with, the tests can set a clock.Fake to control the time
+func WithClock(c clock.Clock) TravelStorageOption {
+	return func(tst *TravelStorage) {
+		tst.clock = c
+	}
 }
 
-// Get and return the travel with the received id from repository
+// WithUpdateValidator append a validation to run on every travel update, validators run in the order they were
+// added and the first error stops the update
+func WithUpdateValidator(validator UpdateValidator) TravelStorageOption {
+	return func(tst *TravelStorage) {
+		tst.updateValidators = append(tst.updateValidators, validator)
+	}
+}
+
+// NewTravelStorage will create and return a TravelStorage with the received repository and applying the options
+// Default options are:
+//   - DefaultPricing to quote travels
+//   - tracking links valid for DefaultTrackingTTL, without link
+//   - the clock of the system
+func NewTravelStorage(repository repository, opts ...TravelStorageOption) TravelStorage {
+	defaultTravelStorage := TravelStorage{
+		repository:   repository,
+		pricing:      DefaultPricing,
+		offerTimeout: DefaultOfferTimeout,
+		queueSize:    DefaultQueueSize,
+		tracking:     trackingConfig{ttl: DefaultTrackingTTL},
+		clock:        clock.System{},
+	}
+
+	for _, opt := range opts {
+		opt(&defaultTravelStorage)
+	}
+
+	return defaultTravelStorage
+}
+
+// Get and return the travel with the received id from repository, deleted travels are not found
 func (travelStorage TravelStorage) Get(ctx context.Context, id int64) (Travel, error) {
-	travel, err := travelStorage.repository.GetTravel(ctx, id)
+	return travelStorage.get(ctx, id, false)
+}
+
+// GetIncludingDeleted return the travel with the received id from repository even if it was deleted
+func (travelStorage TravelStorage) GetIncludingDeleted(ctx context.Context, id int64) (Travel, error) {
+	return travelStorage.get(ctx, id, true)
+}
+
+// IDByUUID return the id of the travel (even if it is deleted or archived) with the received public uuid
+func (travelStorage TravelStorage) IDByUUID(ctx context.Context, publicID string) (int64, error) {
+	id, err := travelStorage.repository.GetTravelIDByUUID(ctx, publicID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting travel id by uuid", log.String("uuid", publicID), log.Err(err))
+		if errors.Is(err, ErrTravelNotFound) {
+			return 0, ErrNotFoundTravel
+		}
+		return 0, ErrStorageGet
+	}
+
+	return id, nil
+}
+
+// get return the travel with the received id, if it is not found then it is searched on the archive
+func (travelStorage TravelStorage) get(ctx context.Context, id int64, includeDeleted bool) (Travel, error) {
+	travel, err := travelStorage.repository.GetTravel(ctx, id, includeDeleted)
+	if errors.Is(err, ErrTravelNotFound) {
+		travel, err = travelStorage.repository.GetArchivedTravel(ctx, id, includeDeleted)
+	}
 	if err != nil {
 		log.Error(ctx, "there was an error while getting travel", log.Err(err))
 		if errors.Is(err, ErrTravelNotFound) {
@@ -63,13 +194,88 @@ func (travelStorage TravelStorage) Get(ctx context.Context, id int64) (Travel, e
 		return Travel{}, ErrStorageGet
 	}
 
-	return travel, nil
+	if err := travelStorage.checkTeam(ctx, travel); err != nil {
+		return Travel{}, err
+	}
+
+	travel.Attachments, err = travelStorage.repository.GetAttachments(ctx, travel.ID)
+	if err != nil {
+		log.Error(ctx, "there was an error while getting travel attachments", log.Int64("travel_id", id), log.Err(err))
+		return Travel{}, ErrStorageGet
+	}
+
+	return travelStorage.withVehicle(ctx, travel)
+}
+
+// GetCurrent return the travel the received user is currently assigned to, that is the travel in process, the
+// first pending one or the one offered to the user. If the user has no active travel then ErrNotFoundTravel is
+// returned
+func (travelStorage TravelStorage) GetCurrent(ctx context.Context, userID int64) (Travel, error) {
+	travel, err := travelStorage.repository.GetTravelByUser(ctx, userID, StatusInProcess, StatusPending, StatusOffered)
+	if err != nil {
+		if errors.Is(err, ErrTravelNotFound) {
+			return Travel{}, ErrNotFoundTravel
+		}
+		log.Error(ctx, "there was an error while getting current travel", log.Int64("user_id", userID), log.Err(err))
+		return Travel{}, ErrStorageGet
+	}
+
+	return travelStorage.withVehicle(ctx, travel)
 }
 
 // Save will store an User on repository and return it.
 func (travelStorage TravelStorage) Save(ctx context.Context, travel Travel) (Travel, error) {
+	if !travel.From.Valid() || !travel.To.Valid() {
+		log.Info(ctx, "invalid check on save travel: invalid coordinates",
+			log.String("travel_from", travel.From.String()),
+			log.String("travel_to", travel.To.String()))
+		return Travel{}, ErrInvalidCoordinates
+	}
+
+	tags, err := normalizeTags(travel.Tags)
+	if err != nil {
+		log.Info(ctx, "invalid check on save travel: invalid tags")
+		return Travel{}, err
+	}
+
+	priority, err := normalizePriority(travel.Priority)
+	if err != nil {
+		log.Info(ctx, "invalid check on save travel: invalid priority",
+			log.String("travel_priority", string(travel.Priority)))
+		return Travel{}, err
+	}
+	if priority == "" {
+		priority = PriorityNormal
+	}
+
+	travel.Tags = tags
+	travel.Priority = priority
 	travel.Status = StatusPending
-	travel, err := travelStorage.repository.SaveTravel(ctx, travel)
+	travel.Attachments = nil
+	travel.Vehicle = nil
+	travel.CreatedAt = travelStorage.clock.Now().UTC().Truncate(time.Second)
+
+	if travel.Deadline != nil {
+		deadline := travel.Deadline.UTC().Truncate(time.Second)
+		if !deadline.After(travel.CreatedAt) {
+			log.Info(ctx, "invalid check on save travel: deadline is not a future date",
+				log.String("travel_deadline", deadline.Format(time.RFC3339)))
+			return Travel{}, ErrInvalidDeadline
+		}
+		travel.Deadline = &deadline
+	}
+
+	inside, err := travelStorage.checkZones(ctx, travel)
+	if err != nil {
+		return Travel{}, err
+	}
+	travel.OutsideZones = !inside
+
+	if err := travelStorage.checkDriverZone(ctx, travel.From, travel.UserID); err != nil {
+		return Travel{}, err
+	}
+
+	travel, err = travelStorage.repository.SaveTravel(ctx, travel)
 	if err != nil {
 		log.Error(ctx, "there was an error while saving travel", log.Err(err))
 		return Travel{}, ErrStorageSave
@@ -78,40 +284,172 @@ func (travelStorage TravelStorage) Save(ctx context.Context, travel Travel) (Tra
 	return travel, nil
 }
 
-// Update will update a stored travel on repository if the update satisfy validations and return it.
+// Update will update a stored travel on repository if the update satisfy validations and return it. The travel is
+// locked while it is validated and stored, and the updates which change its user take the lock of its assignment too,
+// so concurrent requests (of any instance) cannot assign it twice.
 func (travelStorage TravelStorage) Update(ctx context.Context, newTravel Travel) (Travel, error) {
-	travel, err := travelStorage.Get(ctx, newTravel.ID)
+	if !newTravel.From.Valid() || !newTravel.To.Valid() {
+		log.Info(ctx, "invalid check on update travel: invalid coordinates",
+			log.Int64("travel_id", newTravel.ID),
+			log.String("travel_from", newTravel.From.String()),
+			log.String("travel_to", newTravel.To.String()))
+		return Travel{}, ErrInvalidCoordinates
+	}
+
+	tags, err := normalizeTags(newTravel.Tags)
 	if err != nil {
-		log.Error(ctx, "there was an error while getting travel on update", log.Int64("travel_id", travel.ID), log.Err(err))
+		log.Info(ctx, "invalid check on update travel: invalid tags", log.Int64("travel_id", newTravel.ID))
 		return Travel{}, err
 	}
 
+	priority, err := normalizePriority(newTravel.Priority)
+	if err != nil {
+		log.Info(ctx, "invalid check on update travel: invalid priority",
+			log.Int64("travel_id", newTravel.ID),
+			log.String("travel_priority", string(newTravel.Priority)))
+		return Travel{}, err
+	}
+	newTravel.Priority = priority
+
+	var travel Travel
+	var validationErr error
+	found := false
+	completed := false
+
+	// the updates which keep the user of the travel do not assign it, so they are only serialized by the lock of the
+	// travel on repository
+	assigning := true
+	if stored, err := travelStorage.repository.GetTravel(ctx, newTravel.ID, false); err == nil &&
+		stored.UserID == newTravel.UserID {
+		assigning = false
+	}
+	if assigning {
+		unlock, lockErr := travelStorage.lockAssignment(ctx, newTravel.ID)
+		if lockErr != nil {
+			return Travel{}, lockErr
+		}
+		defer unlock()
+	}
+
+	err = travelStorage.repository.EditTravel(ctx, newTravel.ID, func(current Travel) (Travel, []Event, error) {
+		found = true
+
+		if current.DeletedAt != nil {
+			validationErr = ErrNotFoundTravel
+			return Travel{}, nil, validationErr
+		}
+
+		if validationErr = travelStorage.checkTeam(ctx, current); validationErr != nil {
+			return Travel{}, nil, validationErr
+		}
+
+		// the travel was assigned by another request since it was read
+		if !assigning && current.UserID != newTravel.UserID {
+			validationErr = ErrTravelUpdateConflict
+			return Travel{}, nil, validationErr
+		}
+
+		validationErr = travelStorage.validateUpdate(ctx, current, newTravel, travelStorage.validateTravelUpdate)
+		if validationErr != nil {
+			return Travel{}, nil, validationErr
+		}
+
+		travel = current
+		travel.Status = newTravel.Status
+		travel.UserID = newTravel.UserID
+		travel.From = newTravel.From
+		travel.To = newTravel.To
+		// tags, deadline and priority are only replaced when they are received
+		if tags != nil {
+			travel.Tags = tags
+		}
+		if priority != "" {
+			travel.Priority = priority
+		}
+		if newTravel.Deadline != nil {
+			deadline := newTravel.Deadline.UTC().Truncate(time.Second)
+			travel.Deadline = &deadline
+		}
+
+		completed = current.Status != StatusReady && travel.Status == StatusReady
+		travel = travelStorage.recordDuration(current, travel)
+
+		return travel, nil, nil
+	})
+	if err != nil {
+		if validationErr != nil {
+			return Travel{}, validationErr
+		}
+
+		log.Error(ctx, "there was an error while updating travel", log.Int64("travel_id", newTravel.ID), log.Err(err))
+		return Travel{}, mapEditError(err, found)
+	}
+
+	if completed {
+		travelStorage.measureDuration(ctx, travel)
+	}
+
+	return travel, nil
+}
+
+// validateUpdate run the received built-in validation and then the custom update validators, with the claims of
+// the user logged in. A new user assigned should be eligible on the zone where the travel starts
+func (travelStorage TravelStorage) validateUpdate(ctx context.Context, current, changes Travel,
+	validate func(ctx context.Context, travel Travel, changes Travel, userLogged jwt.Claims) error) error {
 	// get user logged to check if he can change this travel
 	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
 	if !ok {
 		log.Info(ctx, "there was an error trying to access to user logged in claims",
-			log.Int64("travel_user_id", travel.UserID),
-			log.Int64("travel_id", travel.ID),
+			log.Int64("travel_user_id", current.UserID),
+			log.Int64("travel_id", current.ID),
 		)
-		return Travel{}, ErrInvalidUserClaims
+		return ErrInvalidUserClaims
 	}
 
-	if err := validateTravelUpdate(ctx, travel, newTravel, userLogged); err != nil {
-		return Travel{}, err
+	if err := validate(ctx, current, changes, userLogged); err != nil {
+		return err
 	}
 
-	travel.Status = newTravel.Status
-	travel.UserID = newTravel.UserID
-	travel.From = newTravel.From
-	travel.To = newTravel.To
+	for _, validator := range travelStorage.updateValidators {
+		if err := validator(ctx, current, changes, userLogged); err != nil {
+			log.Info(ctx, "invalid check on update travel: rejected by custom validation",
+				log.Int64("travel_id", current.ID),
+				log.Err(err))
+			return err
+		}
+	}
 
-	err = travelStorage.repository.EditTravel(ctx, travel)
-	if err != nil {
-		log.Error(ctx, "there was an error while updating travel", log.Int64("travel_id", travel.ID), log.Err(err))
-		return Travel{}, ErrStorageUpdate
+	if changes.UserID != current.UserID {
+		return travelStorage.checkDriverZone(ctx, changes.From, changes.UserID)
 	}
 
-	return travel, nil
+	return nil
+}
+
+// mapEditError return the business error for an error returned by the repository on EditTravel, found indicates
+// if the travel was read before the error
+func mapEditError(err error, found bool) error {
+	switch {
+	case errors.Is(err, ErrTravelNotFound):
+		return ErrNotFoundTravel
+	case errors.Is(err, ErrDriverBusy):
+		return ErrDriverAlreadyAssigned
+	case errors.Is(err, ErrTravelLocked):
+		return ErrTravelUpdateConflict
+	case !found:
+		return ErrStorageGet
+	}
+	return ErrStorageUpdate
+}
+
+// isValidStatus return if the received status is one of the travel status
+func isValidStatus(e Status) bool {
+	for _, a := range travelStatus {
+		if a == e {
+			return true
+		}
+	}
+	return false
 }
 
 func findStatusInFlow(e Status) int {
@@ -124,12 +462,14 @@ func findStatusInFlow(e Status) int {
 }
 
 // validateTravelUpdate business validation on update travel
-func validateTravelUpdate(ctx context.Context, travel Travel, changes Travel, userLogged jwt.Claims) error {
+func (travelStorage TravelStorage) validateTravelUpdate(ctx context.Context, travel Travel, changes Travel,
+	userLogged jwt.Claims) error {
 	isPending := travel.Status == StatusPending
 	isChangeToPending := changes.Status == StatusPending
 
 	changedLocation := travel.From.Lat != changes.From.Lat || travel.From.Lng != changes.From.Lng ||
-		travel.To.Lat != changes.To.Lat || travel.To.Lng != changes.To.Lng
+		travel.To.Lat != changes.To.Lat || travel.To.Lng != changes.To.Lng ||
+		!travel.From.sameAltitude(changes.From) || !travel.To.sameAltitude(changes.To)
 
 	changedUserID := changes.UserID != travel.UserID
 
@@ -138,8 +478,10 @@ func validateTravelUpdate(ctx context.Context, travel Travel, changes Travel, us
 
 	changedStatus := newStatusIndex != currentlyStatusIndex
 
-	// if the authenticated user is not the owner of the travel nor an admin then it cannot update the travel
-	if travel.UserID != userLogged.UserID && userLogged.Role != user.RoleAdmin {
+	canWriteTravels := user.ClaimsPermissions(userLogged).Has(user.PermissionTravelWrite)
+
+	// if the authenticated user is not the owner of the travel nor can write any travel then it cannot update it
+	if travel.UserID != userLogged.UserID && !canWriteTravels {
 		log.Info(ctx, "there was an invalid check with user id on travel to update and user who is logged in",
 			log.Int64("travel_id", travel.ID),
 			log.Int64("travel_user_id", travel.UserID),
@@ -149,8 +491,8 @@ func validateTravelUpdate(ctx context.Context, travel Travel, changes Travel, us
 		return ErrInvalidUserAccess
 	}
 
-	// the user id assigned to the travel is changed but the role from the user authenticated is not admin
-	if changedUserID && travel.UserID != 0 && userLogged.Role != user.RoleAdmin {
+	// the user id assigned to the travel is changed but the user authenticated cannot write any travel
+	if changedUserID && travel.UserID != 0 && !canWriteTravels {
 		log.Info(ctx, "there was an invalid check with user id on travel to update and user who is logged in: cannot change user id on travel with driver role",
 			log.Int64("travel_id", travel.ID),
 			log.Int64("travel_user_id", travel.UserID),
@@ -160,6 +502,37 @@ func validateTravelUpdate(ctx context.Context, travel Travel, changes Travel, us
 		return ErrInvalidUserAccess
 	}
 
+	// only users who can write any travel can change its priority (an empty priority keeps the current one)
+	if changes.Priority != "" && changes.Priority != travel.Priority && !canWriteTravels {
+		log.Info(ctx, "invalid check on update travel: the user logged in cannot change the travel priority",
+			log.Int64("travel_id", travel.ID),
+			log.Int64("logged_user_id", userLogged.UserID),
+			log.String("logged_role", userLogged.Role),
+			log.String("travel_priority", string(changes.Priority)))
+		return ErrInvalidUserAccess
+	}
+
+	// cancelled travels are out of the update flow
+	if travel.Status == StatusCancelled {
+		log.Info(ctx, "invalid check on update travel: travel is cancelled",
+			log.Int64("travel_id", changes.ID))
+		return ErrInvalidStatusToEdit
+	}
+
+	// offered travels wait for the answer of the driver
+	if travel.Status == StatusOffered {
+		log.Info(ctx, "invalid check on update travel: travel is offered",
+			log.Int64("travel_id", changes.ID))
+		return ErrInvalidStatusToEdit
+	}
+
+	// queued travels wait for the driver to complete its in process travel
+	if travel.Status == StatusQueued {
+		log.Info(ctx, "invalid check on update travel: travel is queued",
+			log.Int64("travel_id", changes.ID))
+		return ErrInvalidStatusToEdit
+	}
+
 	// validate there is no change in location if status on travel is not pending
 	if changedLocation && !isPending {
 		log.Info(ctx, "invalid check on update travel: modifying locations when travel is not pending",
@@ -212,5 +585,14 @@ func validateTravelUpdate(ctx context.Context, travel Travel, changes Travel, us
 		return ErrInvalidStatusToEdit
 	}
 
+	// a new deadline should be a future date (the current one can be received again even if it passed)
+	if changes.Deadline != nil && (travel.Deadline == nil || !travel.Deadline.Equal(*changes.Deadline)) &&
+		!changes.Deadline.After(travelStorage.clock.Now()) {
+		log.Info(ctx, "invalid check on update travel: deadline is not a future date",
+			log.Int64("travel_id", changes.ID),
+			log.String("travel_deadline", changes.Deadline.Format(time.RFC3339)))
+		return ErrInvalidDeadline
+	}
+
 	return nil
 }
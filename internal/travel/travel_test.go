@@ -4,9 +4,17 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/platform/clock"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
 	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/lock"
+	"github.com/nicocarolo/space-drivers/internal/vehicle"
 	"github.com/stretchr/testify/assert"
+	"os"
+	"sort"
+	"strconv"
 	"testing"
+	"time"
 )
 
 // mockDb a 'db' to use on TravelStorage test with the capabilities to mock errors on create/get/update action
@@ -14,9 +22,19 @@ type mockDb struct {
 	idCount int64
 	travels map[int64]Travel
 
-	saveError   error
-	getError    map[int64]error
-	updateError map[int64]error
+	saveError      error
+	getError       map[int64]error
+	getByUserError map[int64]error
+	updateError    map[int64]error
+	searchError    error
+	ratingError    error
+	expireError    error
+
+	ratings     map[int64]Rating
+	events      []Event
+	archived    map[int64]Travel
+	attachments []Attachment
+	trace       []TracePoint
 }
 
 func (db *mockDb) onCreate(err error) *mockDb {
@@ -31,6 +49,30 @@ func (db *mockDb) onGet(id int64, err error) *mockDb {
 	return db
 }
 
+func (db *mockDb) onGetByUser(userID int64, err error) *mockDb {
+	db.getByUserError[userID] = err
+
+	return db
+}
+
+func (db *mockDb) onSearch(err error) *mockDb {
+	db.searchError = err
+
+	return db
+}
+
+func (db *mockDb) onRate(err error) *mockDb {
+	db.ratingError = err
+
+	return db
+}
+
+func (db *mockDb) onExpire(err error) *mockDb {
+	db.expireError = err
+
+	return db
+}
+
 func (db *mockDb) onUpdate(id int64, err error) *mockDb {
 	db.updateError[id] = err
 
@@ -45,6 +87,7 @@ func (db *mockDb) SaveTravel(ctx context.Context, travel Travel) (Travel, error)
 	}
 
 	travel.ID = db.idCount
+	travel.UUID = fmt.Sprintf("00000000-0000-4000-8000-%012d", travel.ID)
 	db.travels[travel.ID] = travel
 
 	db.idCount++
@@ -52,630 +95,4324 @@ func (db *mockDb) SaveTravel(ctx context.Context, travel Travel) (Travel, error)
 	return travel, nil
 }
 
-func (db mockDb) GetTravel(ctx context.Context, id int64) (Travel, error) {
+func (db mockDb) GetTravel(ctx context.Context, id int64, includeDeleted bool) (Travel, error) {
 	if err, ok := db.getError[id]; ok {
 		return Travel{}, err
 	}
 
 	travel, exist := db.travels[id]
 	if !exist {
+		if _, archived := db.archived[id]; archived {
+			return Travel{}, ErrTravelNotFound
+		}
 		return Travel{}, fmt.Errorf("not found travel")
 	}
 
+	if travel.DeletedAt != nil && !includeDeleted {
+		return Travel{}, ErrTravelNotFound
+	}
+
 	return travel, nil
 }
 
-func (db *mockDb) EditTravel(ctx context.Context, newTravel Travel) error {
-	if err, ok := db.updateError[newTravel.ID]; ok {
-		return err
-	}
-	_, exist := db.travels[newTravel.ID]
-	if !exist {
-		return fmt.Errorf("not found travel")
+func (db mockDb) GetArchivedTravel(ctx context.Context, id int64, includeDeleted bool) (Travel, error) {
+	travel, exist := db.archived[id]
+	if !exist || (travel.DeletedAt != nil && !includeDeleted) {
+		return Travel{}, ErrTravelNotFound
 	}
 
-	db.travels[newTravel.ID] = newTravel
-
-	return nil
+	return travel, nil
 }
 
-func newMockDB() *mockDb {
-	return &mockDb{
-		idCount: 1,
-		travels: make(map[int64]Travel),
-
-		getError:    make(map[int64]error),
-		updateError: make(map[int64]error),
+func (db mockDb) GetTravelIDByUUID(ctx context.Context, publicID string) (int64, error) {
+	for _, travels := range []map[int64]Travel{db.travels, db.archived} {
+		for _, travel := range travels {
+			if travel.UUID == publicID {
+				return travel.ID, nil
+			}
+		}
 	}
+
+	return 0, ErrTravelNotFound
 }
 
-func newMockDBFromMap(travels map[int64]Travel) *mockDb {
-	return &mockDb{
-		idCount: 1,
-		travels: travels,
+func (db mockDb) GetTravelByUser(ctx context.Context, userID int64, status ...Status) (Travel, error) {
+	if err, ok := db.getByUserError[userID]; ok {
+		return Travel{}, err
+	}
 
-		getError:    make(map[int64]error),
-		updateError: make(map[int64]error),
+	for _, s := range status {
+		for _, travel := range db.travels {
+			if travel.UserID == userID && travel.Status == s && travel.DeletedAt == nil {
+				return travel, nil
+			}
+		}
 	}
+
+	return Travel{}, ErrTravelNotFound
 }
 
-func Test_createTravel(t *testing.T) {
-	tests := map[string]struct {
-		db       repository
-		trv      Travel
-		expected error
-	}{
-		"successful travel save": {
-			db: newMockDB(),
-			trv: Travel{
-				From: Point{
-					Lat: -1,
-					Lng: -10,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				UserID: 121386719,
-			},
-		},
+func (db mockDb) SearchTravels(ctx context.Context, search Search) ([]Travel, int64, error) {
+	if db.searchError != nil {
+		return nil, 0, db.searchError
+	}
 
-		"successful travel save without user id": {
-			db: newMockDB(),
-			trv: Travel{
-				From: Point{
-					Lat: -1,
-					Lng: -10,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-			},
-		},
+	var found []Travel
+	for _, travel := range db.travels {
+		if travel.DeletedAt != nil && !search.IncludeDeleted {
+			continue
+		}
 
-		"successful travel save with status": {
-			db: newMockDB(),
-			trv: Travel{
-				From: Point{
-					Lat: -1,
-					Lng: -10,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: "an status",
-			},
-		},
+		if search.UserID != 0 && travel.UserID != search.UserID {
+			continue
+		}
 
-		"db failure on travel save": {
-			db: newMockDB().onCreate(fmt.Errorf("mock db save error")),
-			trv: Travel{
-				From: Point{
-					Lat: -1,
-					Lng: -10,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-			},
-			expected: ErrStorageSave,
-		},
-	}
+		if search.TeamID != 0 && !mockTeamMember(travel.UserID, search.TeamID) {
+			continue
+		}
 
-	for name, tc := range tests {
-		t.Run(name, func(t *testing.T) {
-			travelStorage := NewTravelStorage(tc.db)
-			result, err := travelStorage.Save(context.Background(), tc.trv)
+		if len(search.VisibleTeams) > 0 && travel.UserID != 0 && !mockTeamMember(travel.UserID, search.VisibleTeams...) {
+			continue
+		}
 
-			if tc.expected == nil {
-				assert.Nil(t, err)
-				assert.NotNil(t, result)
+		if search.Tag != "" && !hasTag(travel, search.Tag) {
+			continue
+		}
 
-				assert.Equal(t, StatusPending, string(result.Status))
-				assert.Equal(t, tc.trv.From.Lat, result.From.Lat)
-				assert.Equal(t, tc.trv.From.Lng, result.From.Lng)
-				assert.Equal(t, tc.trv.To.Lat, result.To.Lat)
-				assert.Equal(t, tc.trv.To.Lng, result.To.Lng)
-				assert.Equal(t, tc.trv.UserID, result.UserID)
-				assert.Greater(t, result.ID, int64(0))
-			} else {
-				assert.NotNil(t, err)
-				assert.Equal(t, tc.expected.Error(), err.Error())
+		matchStatus := len(search.Status) == 0
+		for _, status := range search.Status {
+			if travel.Status == status {
+				matchStatus = true
 			}
-		})
-	}
-}
+		}
 
-func Test_getTravel(t *testing.T) {
-	dbWithUser := newMockDBFromMap(map[int64]Travel{
-		1: Travel{
-			ID: 1,
-			From: Point{
-				Lat: -1,
-				Lng: -10,
-			},
-			To: Point{
-				Lat: 2,
-				Lng: 20,
-			},
-		},
-		2: Travel{
-			ID: 2,
-			From: Point{
-				Lat: -1,
-				Lng: -10,
-			},
-			To: Point{
-				Lat: 2,
-				Lng: 20,
-			},
-			Status: StatusReady,
-			UserID: 23456789,
-		},
-	})
+		if !search.CreatedFrom.IsZero() && travel.CreatedAt.Before(search.CreatedFrom) {
+			continue
+		}
 
-	tests := map[string]struct {
-		db       repository
-		id       int64
-		want     Travel
-		expected error
-	}{
-		"successful travel get": {
-			db: dbWithUser,
-			id: 1,
-			want: Travel{
-				From: Point{
-					Lat: -1,
-					Lng: -10,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-			},
-		},
+		if !search.CreatedTo.IsZero() && !travel.CreatedAt.Before(search.CreatedTo) {
+			continue
+		}
 
-		"successful travel with status and user get": {
-			db: dbWithUser,
-			id: 2,
-			want: Travel{
-				From: Point{
-					Lat: -1,
-					Lng: -10,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusReady,
-				UserID: 23456789,
-			},
-		},
+		if !search.CompletedFrom.IsZero() && (travel.CompletedAt == nil || travel.CompletedAt.Before(search.CompletedFrom)) {
+			continue
+		}
 
-		"db failure travel not found": {
-			db:       newMockDB().onGet(22, ErrTravelNotFound),
-			id:       22,
-			expected: ErrNotFoundTravel,
-		},
+		if !search.CompletedTo.IsZero() && (travel.CompletedAt == nil || !travel.CompletedAt.Before(search.CompletedTo)) {
+			continue
+		}
 
-		"db failure user get": {
-			db:       newMockDB().onGet(22, errors.New("mocked get error")),
-			id:       22,
-			expected: ErrStorageGet,
-		},
+		if !search.OverdueAt.IsZero() && (travel.Status != StatusInProcess || travel.Deadline == nil ||
+			!travel.Deadline.Before(search.OverdueAt)) {
+			continue
+		}
+
+		if search.Near != nil && search.Near.DistanceKm(travel.From) > search.RadiusKm {
+			continue
+		}
+
+		if matchStatus {
+			found = append(found, travel)
+		}
 	}
 
-	for name, tc := range tests {
-		t.Run(name, func(t *testing.T) {
-			travelStorage := NewTravelStorage(tc.db)
-			result, err := travelStorage.Get(context.Background(), tc.id)
+	sort.Slice(found, func(i, j int) bool {
+		if search.ByPriority {
+			return higherPriority(found[i], found[j])
+		}
+		if search.Near != nil {
+			return search.Near.DistanceKm(found[i].From) < search.Near.DistanceKm(found[j].From)
+		}
+		return found[i].ID < found[j].ID
+	})
 
-			if tc.expected == nil {
-				assert.Nil(t, err)
-				assert.NotNil(t, result)
+	total := int64(len(found))
+	if search.Offset >= total {
+		return nil, total, nil
+	}
 
-				assert.Equal(t, tc.want.Status, result.Status)
-				assert.Equal(t, tc.want.From.Lat, result.From.Lat)
-				assert.Equal(t, tc.want.From.Lng, result.From.Lng)
-				assert.Equal(t, tc.want.To.Lat, result.To.Lat)
-				assert.Equal(t, tc.want.To.Lng, result.To.Lng)
-				assert.Equal(t, tc.want.UserID, result.UserID)
-				assert.Greater(t, result.ID, int64(0))
-			} else {
-				assert.NotNil(t, err)
-				assert.Equal(t, tc.expected.Error(), err.Error())
-			}
-		})
+	top := total
+	if search.Offset+search.Limit < top {
+		top = search.Offset + search.Limit
 	}
+
+	return found[search.Offset:top], total, nil
 }
 
-func Test_updateTravel(t *testing.T) {
-	newTravel := func(id int64, fromLat, fromLng, toLat, toLng float64, status Status, userID int64) Travel {
-		return Travel{
-			ID:     id,
-			Status: status,
-			From: Point{
-				Lat: fromLat,
-				Lng: fromLng,
-			},
-			To: Point{
-				Lat: toLat,
-				Lng: toLng,
-			},
-			UserID: userID,
-		}
+func (db mockDb) IterateTravels(ctx context.Context, search Search, fn func(Travel) error) error {
+	search.Offset = 0
+	search.Limit = int64(len(db.travels))
+
+	found, _, err := db.SearchTravels(ctx, search)
+	if err != nil {
+		return err
 	}
 
+	for _, travel := range found {
+		if err := fn(travel); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (db mockDb) CountByStatus(ctx context.Context) (map[Status]int64, error) {
+	if db.searchError != nil {
+		return nil, db.searchError
+	}
+
+	counts := make(map[Status]int64)
+	for _, travel := range db.travels {
+		if travel.DeletedAt == nil {
+			counts[travel.Status]++
+		}
+	}
+
+	return counts, nil
+}
+
+func (db *mockDb) ExpirePending(ctx context.Context, createdBefore time.Time, detail string) ([]int64, error) {
+	if db.expireError != nil {
+		return nil, db.expireError
+	}
+
+	var ids []int64
+	for id, travel := range db.travels {
+		if travel.Status == StatusPending && travel.CreatedAt.Before(createdBefore) && travel.DeletedAt == nil {
+			travel.Status = StatusCancelled
+			db.travels[id] = travel
+			db.events = append(db.events, Event{TravelID: id, Type: EventExpired, Detail: detail},
+				Event{TravelID: id, Type: EventStatusChanged, Detail: string(StatusPending), CreatedAt: time.Now()})
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+func (db mockDb) AverageTimeInStatus(ctx context.Context) (map[Status]time.Duration, error) {
+	if db.searchError != nil {
+		return nil, db.searchError
+	}
+
+	changedAt := make(map[int64]time.Time)
+	totals := make(map[Status]time.Duration)
+	stays := make(map[Status]int64)
+	for _, event := range db.events {
+		trv, exist := db.travels[event.TravelID]
+		if event.Type != EventStatusChanged || !exist || trv.DeletedAt != nil {
+			continue
+		}
+
+		since, ok := changedAt[event.TravelID]
+		if !ok {
+			since = trv.CreatedAt
+		}
+		changedAt[event.TravelID] = event.CreatedAt
+
+		totals[Status(event.Detail)] += event.CreatedAt.Sub(since)
+		stays[Status(event.Detail)]++
+	}
+
+	averages := make(map[Status]time.Duration)
+	for status, total := range totals {
+		averages[status] = total / time.Duration(stays[status])
+	}
+
+	return averages, nil
+}
+
+func (db mockDb) CountCreatedByDay(ctx context.Context, from time.Time) (map[string]int64, error) {
+	if db.searchError != nil {
+		return nil, db.searchError
+	}
+
+	counts := make(map[string]int64)
+	for _, trv := range db.travels {
+		if trv.DeletedAt == nil && !trv.CreatedAt.Before(from) {
+			counts[trv.CreatedAt.Format("2006-01-02")]++
+		}
+	}
+
+	return counts, nil
+}
+
+func (db mockDb) Punctuality(ctx context.Context) (Punctuality, error) {
+	if db.searchError != nil {
+		return Punctuality{}, db.searchError
+	}
+
+	var punctuality Punctuality
+	var delay float64
+	for _, trv := range db.travels {
+		if trv.DeletedAt != nil || trv.Status != StatusReady || trv.ActualMinutes == nil || trv.EstimatedMinutes == nil {
+			continue
+		}
+
+		punctuality.Completed++
+		if *trv.ActualMinutes <= float64(*trv.EstimatedMinutes) {
+			punctuality.OnTime++
+		}
+		delay += *trv.ActualMinutes - float64(*trv.EstimatedMinutes)
+	}
+
+	if punctuality.Completed > 0 {
+		punctuality.AverageDelayMinutes = delay / float64(punctuality.Completed)
+	}
+
+	return punctuality, nil
+}
+
+func (db mockDb) Heatmap(ctx context.Context, query HeatmapQuery) ([]HeatmapCell, error) {
+	if db.searchError != nil {
+		return nil, db.searchError
+	}
+
+	layout := "2006-01-02T15:00:00Z"
+	if query.Window == HeatmapWindowDay {
+		layout = "2006-01-02T00:00:00Z"
+	}
+
+	byCell := make(map[[2]string]*HeatmapCell)
+	var cells []HeatmapCell
+	count := func(point Point, window string, pickup bool) {
+		key := [2]string{window, point.Geohash(query.Precision)}
+		cell, ok := byCell[key]
+		if !ok {
+			cell = &HeatmapCell{Geohash: key[1], Window: window}
+			byCell[key] = cell
+		}
+		if pickup {
+			cell.Pickups++
+		} else {
+			cell.Dropoffs++
+		}
+	}
+
+	for _, trv := range db.travels {
+		if trv.DeletedAt == nil && !trv.CreatedAt.Before(query.From) && trv.CreatedAt.Before(query.To) {
+			window := trv.CreatedAt.Format(layout)
+			count(trv.From, window, true)
+			count(trv.To, window, false)
+		}
+	}
+
+	for _, cell := range byCell {
+		cells = append(cells, *cell)
+	}
+	sort.Slice(cells, func(i, j int) bool {
+		if cells[i].Window != cells[j].Window {
+			return cells[i].Window < cells[j].Window
+		}
+		return cells[i].Geohash < cells[j].Geohash
+	})
+
+	return cells, nil
+}
+
+func (db *mockDb) ExpireOffers(ctx context.Context, expiredBefore time.Time) ([]int64, error) {
+	var ids []int64
+	for id, travel := range db.travels {
+		if travel.Status == StatusOffered && travel.OfferExpiresAt.Before(expiredBefore) && travel.DeletedAt == nil {
+			db.events = append(db.events,
+				Event{TravelID: id, Type: EventOfferExpired, Detail: strconv.FormatInt(travel.UserID, 10)},
+				Event{TravelID: id, Type: EventStatusChanged, Detail: string(StatusOffered), CreatedAt: time.Now()})
+			travel.Status = StatusPending
+			travel.UserID = 0
+			travel.OfferExpiresAt = nil
+			db.travels[id] = travel
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+func (db *mockDb) MarkOverdue(ctx context.Context, now time.Time) ([]int64, error) {
+	marked := make(map[int64]bool)
+	for _, event := range eventsOfType(db.events, EventOverdue) {
+		marked[event.TravelID] = true
+	}
+
+	var ids []int64
+	for id, travel := range db.travels {
+		if travel.Status == StatusInProcess && travel.Deadline != nil && travel.Deadline.Before(now) &&
+			travel.DeletedAt == nil && !marked[id] {
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	for _, id := range ids {
+		db.events = append(db.events,
+			Event{TravelID: id, Type: EventOverdue, Detail: db.travels[id].Deadline.Format(time.RFC3339)})
+	}
+
+	return ids, nil
+}
+
+func (db *mockDb) ArchiveTravels(ctx context.Context, createdBefore time.Time) ([]int64, error) {
+	if db.expireError != nil {
+		return nil, db.expireError
+	}
+
+	var ids []int64
+	for id, travel := range db.travels {
+		if (travel.Status == StatusReady || travel.Status == StatusCancelled) && travel.CreatedAt.Before(createdBefore) {
+			db.archived[id] = travel
+			delete(db.travels, id)
+			ids = append(ids, id)
+		}
+	}
+
+	sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+
+	return ids, nil
+}
+
+func (db *mockDb) SaveAttachment(ctx context.Context, attachment Attachment) (Attachment, error) {
+	if db.saveError != nil {
+		return Attachment{}, db.saveError
+	}
+
+	attachment.ID = int64(len(db.attachments) + 1)
+	db.attachments = append(db.attachments, attachment)
+
+	return attachment, nil
+}
+
+func (db mockDb) GetAttachments(ctx context.Context, travelID int64) ([]Attachment, error) {
+	var attachments []Attachment
+	for _, attachment := range db.attachments {
+		if attachment.TravelID == travelID {
+			attachments = append(attachments, attachment)
+		}
+	}
+
+	return attachments, nil
+}
+
+func (db *mockDb) SaveTracePoint(ctx context.Context, point TracePoint) (TracePoint, error) {
+	if db.saveError != nil {
+		return TracePoint{}, db.saveError
+	}
+
+	point.ID = int64(len(db.trace) + 1)
+	db.trace = append(db.trace, point)
+
+	return point, nil
+}
+
+func (db mockDb) GetTrace(ctx context.Context, travelID int64) ([]TracePoint, error) {
+	var trace []TracePoint
+	for _, point := range db.trace {
+		if point.TravelID == travelID {
+			trace = append(trace, point)
+		}
+	}
+
+	sort.SliceStable(trace, func(i, j int) bool { return trace[i].RecordedAt.Before(trace[j].RecordedAt) })
+
+	return trace, nil
+}
+
+func (db mockDb) GetPersonalData(ctx context.Context, userID int64) (PersonalData, error) {
+	if db.searchError != nil {
+		return PersonalData{}, db.searchError
+	}
+
+	var data PersonalData
+	for _, t := range db.travels {
+		if t.UserID == userID {
+			data.Travels = append(data.Travels, t)
+		}
+	}
+	for _, t := range db.archived {
+		if t.UserID == userID {
+			data.Travels = append(data.Travels, t)
+		}
+	}
+	sort.Slice(data.Travels, func(i, j int) bool { return data.Travels[i].ID < data.Travels[j].ID })
+
+	for _, point := range db.trace {
+		if point.UserID == userID {
+			data.Locations = append(data.Locations, point)
+		}
+	}
+	for _, rating := range db.ratings {
+		if rating.UserID == userID {
+			data.Ratings = append(data.Ratings, rating)
+		}
+	}
+	for _, event := range db.events {
+		for _, t := range data.Travels {
+			if event.TravelID == t.ID {
+				data.Events = append(data.Events, event)
+				break
+			}
+		}
+	}
+
+	return data, nil
+}
+
+func (db *mockDb) ErasePersonalData(ctx context.Context, userID int64) error {
+	var trace []TracePoint
+	for _, point := range db.trace {
+		if point.UserID != userID {
+			trace = append(trace, point)
+		}
+	}
+	db.trace = trace
+
+	for travelID, rating := range db.ratings {
+		if rating.UserID == userID {
+			rating.Comment = ""
+			db.ratings[travelID] = rating
+		}
+	}
+
+	return nil
+}
+
+func (db *mockDb) SaveRating(ctx context.Context, rating Rating) error {
+	if db.ratingError != nil {
+		return db.ratingError
+	}
+
+	if _, exist := db.ratings[rating.TravelID]; exist {
+		return ErrRatingDuplicated
+	}
+
+	db.ratings[rating.TravelID] = rating
+
+	return nil
+}
+
+func (db *mockDb) EditTravel(ctx context.Context, id int64, edit func(current Travel) (Travel, []Event, error)) error {
+	if err, ok := db.getError[id]; ok {
+		return err
+	}
+	current, exist := db.travels[id]
+	if !exist {
+		return fmt.Errorf("not found travel")
+	}
+
+	newTravel, events, err := edit(current)
+	if err != nil {
+		return err
+	}
+
+	if err, ok := db.updateError[id]; ok {
+		return err
+	}
+
+	restored := current.DeletedAt != nil && newTravel.DeletedAt == nil
+	if newTravel.UserID != 0 && (newTravel.UserID != current.UserID || restored) {
+		for travelID, trv := range db.travels {
+			if travelID != id && trv.UserID == newTravel.UserID && trv.DeletedAt == nil &&
+				(trv.Status == StatusPending || trv.Status == StatusOffered || trv.Status == StatusInProcess) {
+				return ErrDriverBusy
+			}
+		}
+	}
+
+	db.store(current, newTravel, events)
+
+	return nil
+}
+
+func (db *mockDb) QueueTravel(ctx context.Context, id, userID int64, edit func(current Travel, assigned []Travel) (Travel, []Event, error)) error {
+	if err, ok := db.getError[id]; ok {
+		return err
+	}
+	current, exist := db.travels[id]
+	if !exist {
+		return fmt.Errorf("not found travel")
+	}
+
+	var assigned []Travel
+	for travelID, trv := range db.travels {
+		if travelID != id && trv.UserID == userID && trv.DeletedAt == nil &&
+			(trv.Status == StatusInProcess || trv.Status == StatusQueued) {
+			assigned = append(assigned, trv)
+		}
+	}
+
+	newTravel, events, err := edit(current, assigned)
+	if err != nil {
+		return err
+	}
+
+	if err, ok := db.updateError[id]; ok {
+		return err
+	}
+
+	db.store(current, newTravel, events)
+
+	return nil
+}
+
+// store keep the edited travel and its events as the repository does, moving forward the queue of the driver
+// when a travel leaves it and promoting its first queued travel when the driver leaves the in process one
+func (db *mockDb) store(current, newTravel Travel, events []Event) {
+	now := time.Now().UTC().Truncate(time.Second)
+	if newTravel.Status != current.Status {
+		events = append(events, Event{TravelID: current.ID, Type: EventStatusChanged, Detail: string(current.Status),
+			CreatedAt: now})
+	}
+
+	db.travels[current.ID] = newTravel
+	db.events = append(db.events, events...)
+
+	if current.Status == StatusQueued && newTravel.Status != StatusQueued {
+		db.moveQueue(current.UserID, *current.QueuePosition)
+	}
+
+	if current.Status == StatusInProcess && current.UserID != 0 &&
+		(newTravel.Status != StatusInProcess || newTravel.UserID != current.UserID) {
+		for id, trv := range db.travels {
+			if trv.UserID == current.UserID && trv.Status == StatusQueued && *trv.QueuePosition == 1 {
+				trv.Status = StatusInProcess
+				trv.QueuePosition = nil
+				trv.StartedAt = &now
+				db.travels[id] = trv
+				db.moveQueue(current.UserID, 1)
+				db.events = append(db.events,
+					Event{TravelID: id, Type: EventPromoted, Detail: strconv.FormatInt(current.ID, 10), CreatedAt: now},
+					Event{TravelID: id, Type: EventStatusChanged, Detail: string(StatusQueued), CreatedAt: now})
+				break
+			}
+		}
+	}
+}
+
+// moveQueue move forward the travels queued to the user behind the received position
+func (db *mockDb) moveQueue(userID int64, position int) {
+	for id, trv := range db.travels {
+		if trv.UserID == userID && trv.Status == StatusQueued && *trv.QueuePosition > position {
+			moved := *trv.QueuePosition - 1
+			trv.QueuePosition = &moved
+			db.travels[id] = trv
+		}
+	}
+}
+
+func (db mockDb) GetQueue(ctx context.Context, userID int64) ([]Travel, error) {
+	if err, ok := db.getByUserError[userID]; ok {
+		return nil, err
+	}
+
+	var queue []Travel
+	for _, trv := range db.travels {
+		if trv.UserID == userID && trv.Status == StatusQueued && trv.DeletedAt == nil {
+			queue = append(queue, trv)
+		}
+	}
+
+	sort.Slice(queue, func(i, j int) bool { return *queue[i].QueuePosition < *queue[j].QueuePosition })
+
+	return queue, nil
+}
+
+// eventsOfType return the received events of the received type keeping their order
+func eventsOfType(events []Event, eventType EventType) []Event {
+	var found []Event
+	for _, event := range events {
+		if event.Type == eventType {
+			found = append(found, event)
+		}
+	}
+
+	return found
+}
+
+func newMockDB() *mockDb {
+	return &mockDb{
+		idCount: 1,
+		travels: make(map[int64]Travel),
+
+		getError:       make(map[int64]error),
+		getByUserError: make(map[int64]error),
+		updateError:    make(map[int64]error),
+
+		ratings:  make(map[int64]Rating),
+		archived: make(map[int64]Travel),
+	}
+}
+
+func newMockDBFromMap(travels map[int64]Travel) *mockDb {
+	return &mockDb{
+		idCount: 1,
+		travels: travels,
+
+		getError:       make(map[int64]error),
+		getByUserError: make(map[int64]error),
+		updateError:    make(map[int64]error),
+
+		ratings:  make(map[int64]Rating),
+		archived: make(map[int64]Travel),
+	}
+}
+
+func Test_createTravel(t *testing.T) {
+	tests := map[string]struct {
+		db       repository
+		trv      Travel
+		expected error
+	}{
+		"successful travel save": {
+			db: newMockDB(),
+			trv: Travel{
+				From: Point{
+					Lat: -1,
+					Lng: -10,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				UserID: 121386719,
+			},
+		},
+
+		"successful travel save without user id": {
+			db: newMockDB(),
+			trv: Travel{
+				From: Point{
+					Lat: -1,
+					Lng: -10,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+			},
+		},
+
+		"successful travel save with status": {
+			db: newMockDB(),
+			trv: Travel{
+				From: Point{
+					Lat: -1,
+					Lng: -10,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: "an status",
+			},
+		},
+
+		"error on travel save: invalid coordinates": {
+			db: newMockDB(),
+			trv: Travel{
+				From: Point{
+					Lat: -91,
+					Lng: -10,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+			},
+			expected: ErrInvalidCoordinates,
+		},
+
+		"db failure on travel save": {
+			db: newMockDB().onCreate(fmt.Errorf("mock db save error")),
+			trv: Travel{
+				From: Point{
+					Lat: -1,
+					Lng: -10,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+			},
+			expected: ErrStorageSave,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			result, err := travelStorage.Save(context.Background(), tc.trv)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.NotNil(t, result)
+
+				assert.Equal(t, StatusPending, string(result.Status))
+				assert.Equal(t, tc.trv.From.Lat, result.From.Lat)
+				assert.Equal(t, tc.trv.From.Lng, result.From.Lng)
+				assert.Equal(t, tc.trv.To.Lat, result.To.Lat)
+				assert.Equal(t, tc.trv.To.Lng, result.To.Lng)
+				assert.Equal(t, tc.trv.UserID, result.UserID)
+				assert.Greater(t, result.ID, int64(0))
+				assert.False(t, result.CreatedAt.IsZero())
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_getTravel(t *testing.T) {
+	dbWithUser := newMockDBFromMap(map[int64]Travel{
+		1: Travel{
+			ID: 1,
+			From: Point{
+				Lat: -1,
+				Lng: -10,
+			},
+			To: Point{
+				Lat: 2,
+				Lng: 20,
+			},
+		},
+		2: Travel{
+			ID: 2,
+			From: Point{
+				Lat: -1,
+				Lng: -10,
+			},
+			To: Point{
+				Lat: 2,
+				Lng: 20,
+			},
+			Status: StatusReady,
+			UserID: 23456789,
+		},
+	})
+
+	tests := map[string]struct {
+		db       repository
+		id       int64
+		want     Travel
+		expected error
+	}{
+		"successful travel get": {
+			db: dbWithUser,
+			id: 1,
+			want: Travel{
+				From: Point{
+					Lat: -1,
+					Lng: -10,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+			},
+		},
+
+		"successful travel with status and user get": {
+			db: dbWithUser,
+			id: 2,
+			want: Travel{
+				From: Point{
+					Lat: -1,
+					Lng: -10,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusReady,
+				UserID: 23456789,
+			},
+		},
+
+		"db failure travel not found": {
+			db:       newMockDB().onGet(22, ErrTravelNotFound),
+			id:       22,
+			expected: ErrNotFoundTravel,
+		},
+
+		"db failure user get": {
+			db:       newMockDB().onGet(22, errors.New("mocked get error")),
+			id:       22,
+			expected: ErrStorageGet,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			result, err := travelStorage.Get(context.Background(), tc.id)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.NotNil(t, result)
+
+				assert.Equal(t, tc.want.Status, result.Status)
+				assert.Equal(t, tc.want.From.Lat, result.From.Lat)
+				assert.Equal(t, tc.want.From.Lng, result.From.Lng)
+				assert.Equal(t, tc.want.To.Lat, result.To.Lat)
+				assert.Equal(t, tc.want.To.Lng, result.To.Lng)
+				assert.Equal(t, tc.want.UserID, result.UserID)
+				assert.Greater(t, result.ID, int64(0))
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_travelIDByUUID(t *testing.T) {
+	db := newMockDB()
+	db.archived[7] = Travel{ID: 7, UUID: "7c9e6679-7425-40de-944b-e07fc1f90ae7"}
+	travelStorage := NewTravelStorage(db)
+
+	created, err := travelStorage.Save(context.Background(), Travel{
+		From: Point{Lat: -1, Lng: -10},
+		To:   Point{Lat: 2, Lng: 20},
+	})
+	assert.Nil(t, err)
+	assert.NotEmpty(t, created.UUID)
+
+	id, err := travelStorage.IDByUUID(context.Background(), created.UUID)
+	assert.Nil(t, err)
+	assert.Equal(t, created.ID, id)
+
+	// archived travels are found too
+	id, err = travelStorage.IDByUUID(context.Background(), "7c9e6679-7425-40de-944b-e07fc1f90ae7")
+	assert.Nil(t, err)
+	assert.Equal(t, int64(7), id)
+
+	_, err = travelStorage.IDByUUID(context.Background(), "6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+	assert.Equal(t, ErrNotFoundTravel.Error(), err.Error())
+}
+
+func Test_getCurrentTravel(t *testing.T) {
+	newTravel := func(id int64, status Status, userID int64) Travel {
+		return Travel{
+			ID:     id,
+			Status: status,
+			From: Point{
+				Lat: -1,
+				Lng: -10,
+			},
+			To: Point{
+				Lat: 2,
+				Lng: 20,
+			},
+			UserID: userID,
+		}
+	}
+
+	tests := map[string]struct {
+		db       repository
+		userID   int64
+		want     Travel
+		expected error
+	}{
+		"successful get current travel: pending": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: newTravel(1, StatusReady, 10),
+				2: newTravel(2, StatusPending, 10),
+			}),
+			userID: 10,
+			want:   newTravel(2, StatusPending, 10),
+		},
+
+		"successful get current travel: in process before pending": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: newTravel(1, StatusPending, 10),
+				2: newTravel(2, StatusInProcess, 10),
+			}),
+			userID: 10,
+			want:   newTravel(2, StatusInProcess, 10),
+		},
+
+		"failure get current travel: driver is free": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: newTravel(1, StatusReady, 10),
+				2: newTravel(2, StatusPending, 11),
+			}),
+			userID:   10,
+			expected: ErrNotFoundTravel,
+		},
+
+		"db failure get current travel": {
+			db:       newMockDB().onGetByUser(10, errors.New("mocked get error")),
+			userID:   10,
+			expected: ErrStorageGet,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			result, err := travelStorage.GetCurrent(context.Background(), tc.userID)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_searchTravel(t *testing.T) {
+	newTravel := func(id int64, status Status, userID int64) Travel {
+		return Travel{
+			ID:     id,
+			Status: status,
+			From: Point{
+				Lat: -1,
+				Lng: -10,
+			},
+			To: Point{
+				Lat: 2,
+				Lng: 20,
+			},
+			UserID: userID,
+		}
+	}
+
+	searchDeadline := time.Now().UTC().Add(-time.Hour)
+	db := newMockDBFromMap(map[int64]Travel{
+		1: newTravel(1, StatusReady, 10),
+		2: newTravel(2, StatusPending, 10),
+		3: newTravel(3, StatusReady, 10),
+		4: newTravel(4, StatusPending, 11),
+	})
+
+	tests := map[string]struct {
+		db       repository
+		options  []SearchOption
+		want     []Travel
+		wantMeta Metadata
+		expected error
+	}{
+		"successful search travels by user": {
+			db:       db,
+			options:  []SearchOption{WithUser(10)},
+			want:     []Travel{newTravel(1, StatusReady, 10), newTravel(2, StatusPending, 10), newTravel(3, StatusReady, 10)},
+			wantMeta: Metadata{Total: 3, Pending: 0},
+		},
+
+		"successful search travels by user and status": {
+			db:       db,
+			options:  []SearchOption{WithUser(10), WithStatus(StatusReady)},
+			want:     []Travel{newTravel(1, StatusReady, 10), newTravel(3, StatusReady, 10)},
+			wantMeta: Metadata{Total: 2, Pending: 0},
+		},
+
+		"successful search travels by user with pagination": {
+			db:       db,
+			options:  []SearchOption{WithUser(10), WithLimit(1), WithOffset(1)},
+			want:     []Travel{newTravel(2, StatusPending, 10)},
+			wantMeta: Metadata{Total: 3, Pending: 1},
+		},
+
+		"successful search travels near a location": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: Travel{ID: 1, Status: StatusPending, From: Point{Lat: -34.60, Lng: -58.38}},
+				2: Travel{ID: 2, Status: StatusPending, From: Point{Lat: -34.62, Lng: -58.40}},
+				3: Travel{ID: 3, Status: StatusPending, From: Point{Lat: -34.90, Lng: -56.16}},
+			}),
+			options: []SearchOption{WithNear(Point{Lat: -34.621, Lng: -58.401}, 10)},
+			want: []Travel{
+				{ID: 2, Status: StatusPending, From: Point{Lat: -34.62, Lng: -58.40}},
+				{ID: 1, Status: StatusPending, From: Point{Lat: -34.60, Lng: -58.38}},
+			},
+			wantMeta: Metadata{Total: 2, Pending: 0},
+		},
+
+		"successful search overdue travels": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: Travel{ID: 1, Status: StatusInProcess, Deadline: &searchDeadline},
+				2: Travel{ID: 2, Status: StatusPending, Deadline: &searchDeadline},
+				3: Travel{ID: 3, Status: StatusInProcess},
+			}),
+			options:  []SearchOption{WithOverdue()},
+			want:     []Travel{{ID: 1, Status: StatusInProcess, Deadline: &searchDeadline}},
+			wantMeta: Metadata{Total: 1, Pending: 0},
+		},
+
+		"failure search travels: invalid radius": {
+			db:       db,
+			options:  []SearchOption{WithNear(Point{Lat: -34.6, Lng: -58.4}, 0)},
+			expected: ErrInvalidSearchRadius,
+		},
+
+		"failure search travels: invalid status": {
+			db:       db,
+			options:  []SearchOption{WithStatus("unknown")},
+			expected: ErrInvalidStatusToSearch,
+		},
+
+		"db failure search travels": {
+			db:       newMockDB().onSearch(errors.New("mocked search error")),
+			options:  []SearchOption{WithUser(10)},
+			expected: ErrStorageGet,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			result, meta, err := travelStorage.Search(context.Background(), tc.options...)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+				assert.Equal(t, tc.wantMeta, meta)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_eachTravel(t *testing.T) {
+	newTravel := func(id int64, status Status, createdAt time.Time) Travel {
+		return Travel{
+			ID:        id,
+			Status:    status,
+			CreatedAt: createdAt,
+		}
+	}
+
+	day := time.Date(2021, 12, 10, 0, 0, 0, 0, time.UTC)
+	db := newMockDBFromMap(map[int64]Travel{
+		1: newTravel(1, StatusReady, day.Add(-time.Hour)),
+		2: newTravel(2, StatusReady, day.Add(time.Hour)),
+		3: newTravel(3, StatusPending, day.Add(2*time.Hour)),
+		4: newTravel(4, StatusReady, day.AddDate(0, 0, 1)),
+	})
+
+	tests := map[string]struct {
+		db       repository
+		options  []SearchOption
+		fnError  error
+		want     []int64
+		expected error
+	}{
+		"successful iterate all travels": {
+			db:   db,
+			want: []int64{1, 2, 3, 4},
+		},
+
+		"successful iterate travels by status and creation date": {
+			db:      db,
+			options: []SearchOption{WithStatus(StatusReady), WithCreatedBetween(day, day.AddDate(0, 0, 1))},
+			want:    []int64{2},
+		},
+
+		"failure iterate travels: invalid status": {
+			db:       db,
+			options:  []SearchOption{WithStatus("unknown")},
+			expected: ErrInvalidStatusToSearch,
+		},
+
+		"failure iterate travels: error on fn": {
+			db:       db,
+			fnError:  errors.New("mocked fn error"),
+			want:     []int64{1},
+			expected: ErrStorageGet,
+		},
+
+		"db failure iterate travels": {
+			db:       newMockDB().onSearch(errors.New("mocked search error")),
+			expected: ErrStorageGet,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+
+			var ids []int64
+			err := travelStorage.Each(context.Background(), func(travel Travel) error {
+				ids = append(ids, travel.ID)
+				return tc.fnError
+			}, tc.options...)
+
+			assert.Equal(t, tc.want, ids)
+			if tc.expected == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_countTravelsByStatus(t *testing.T) {
+	tests := map[string]struct {
+		db       repository
+		want     map[Status]int64
+		expected error
+	}{
+		"successful count travels by status": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: Travel{ID: 1, Status: StatusPending},
+				2: Travel{ID: 2, Status: StatusPending},
+				3: Travel{ID: 3, Status: StatusReady},
+			}),
+			want: map[Status]int64{
+				StatusPending:   2,
+				StatusInProcess: 0,
+				StatusReady:     1,
+				StatusCancelled: 0,
+				StatusOffered:   0,
+				StatusQueued:    0,
+			},
+		},
+
+		"db failure count travels by status": {
+			db:       newMockDB().onSearch(errors.New("mocked count error")),
+			expected: ErrStorageGet,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			result, err := travelStorage.CountByStatus(context.Background())
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_travelStats(t *testing.T) {
+	now := time.Now().UTC()
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	day := func(daysAgo int) string {
+		return today.AddDate(0, 0, -daysAgo).Format("2006-01-02")
+	}
+
+	newDB := func() *mockDb {
+		db := newMockDBFromMap(map[int64]Travel{
+			1: {ID: 1, Status: StatusReady, CreatedAt: today.AddDate(0, 0, -2)},
+			2: {ID: 2, Status: StatusInProcess, CreatedAt: today.AddDate(0, 0, -2)},
+			3: {ID: 3, Status: StatusPending, CreatedAt: today},
+			4: {ID: 4, Status: StatusPending, CreatedAt: today.AddDate(0, 0, -10)},
+		})
+		db.events = []Event{
+			{TravelID: 1, Type: EventStatusChanged, Detail: string(StatusPending), CreatedAt: today.AddDate(0, 0, -2).Add(10 * time.Minute)},
+			{TravelID: 1, Type: EventReassigned, Detail: "the driver is sick", CreatedAt: today.AddDate(0, 0, -2).Add(20 * time.Minute)},
+			{TravelID: 1, Type: EventStatusChanged, Detail: string(StatusInProcess), CreatedAt: today.AddDate(0, 0, -2).Add(70 * time.Minute)},
+			{TravelID: 2, Type: EventStatusChanged, Detail: string(StatusPending), CreatedAt: today.AddDate(0, 0, -2).Add(20 * time.Minute)},
+		}
+		return db
+	}
+
+	tests := map[string]struct {
+		db       repository
+		days     int
+		want     Stats
+		expected error
+	}{
+		"successful travel stats": {
+			db:   newDB(),
+			days: 3,
+			want: Stats{
+				CountByStatus: map[Status]int64{
+					StatusPending:   2,
+					StatusInProcess: 1,
+					StatusReady:     1,
+					StatusCancelled: 0,
+					StatusOffered:   0,
+					StatusQueued:    0,
+				},
+				AverageMinutesInStatus: map[Status]float64{
+					StatusPending:   15,
+					StatusInProcess: 60,
+				},
+				CreatedPerDay: []DayCount{
+					{Date: day(2), Count: 2},
+					{Date: day(1), Count: 0},
+					{Date: day(0), Count: 1},
+				},
+			},
+		},
+
+		"error on travel stats: invalid days": {
+			db:       newDB(),
+			days:     0,
+			expected: ErrInvalidStatsDays,
+		},
+
+		"error on travel stats: too many days": {
+			db:       newDB(),
+			days:     91,
+			expected: ErrInvalidStatsDays,
+		},
+
+		"db failure travel stats": {
+			db:       newDB().onSearch(errors.New("mocked stats error")),
+			days:     7,
+			expected: ErrStorageGet,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			result, err := travelStorage.Stats(context.Background(), tc.days)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_travelHeatmap(t *testing.T) {
+	day := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	buenosAires := Point{Lat: -34.6037, Lng: -58.3816}
+	laPlata := Point{Lat: -34.9214, Lng: -57.9545}
+	db := newMockDBFromMap(map[int64]Travel{
+		1: {ID: 1, From: buenosAires, To: laPlata, CreatedAt: day.Add(10*time.Hour + 5*time.Minute)},
+		2: {ID: 2, From: buenosAires, To: buenosAires, CreatedAt: day.Add(10*time.Hour + 40*time.Minute)},
+		3: {ID: 3, From: laPlata, To: buenosAires, CreatedAt: day.Add(12 * time.Hour)},
+		4: {ID: 4, From: laPlata, To: buenosAires, CreatedAt: day.Add(12 * time.Hour), DeletedAt: &day},
+		5: {ID: 5, From: laPlata, To: buenosAires, CreatedAt: day.AddDate(0, 0, 2)},
+	})
+
+	tests := map[string]struct {
+		db       *mockDb
+		query    HeatmapQuery
+		want     []HeatmapCell
+		expected error
+	}{
+		"successful heatmap by hour": {
+			db:    db,
+			query: HeatmapQuery{From: day, To: day.AddDate(0, 0, 1)},
+			want: []HeatmapCell{
+				{Geohash: "69y7p", Window: "2021-12-01T10:00:00Z", Pickups: 2, Dropoffs: 1},
+				{Geohash: "69yc3", Window: "2021-12-01T10:00:00Z", Pickups: 0, Dropoffs: 1},
+				{Geohash: "69y7p", Window: "2021-12-01T12:00:00Z", Pickups: 0, Dropoffs: 1},
+				{Geohash: "69yc3", Window: "2021-12-01T12:00:00Z", Pickups: 1, Dropoffs: 0},
+			},
+		},
+
+		"successful heatmap by day with precision": {
+			db:    db,
+			query: HeatmapQuery{From: day, To: day.AddDate(0, 0, 3), Precision: 3, Window: HeatmapWindowDay},
+			want: []HeatmapCell{
+				{Geohash: "69y", Window: "2021-12-01T00:00:00Z", Pickups: 3, Dropoffs: 3},
+				{Geohash: "69y", Window: "2021-12-03T00:00:00Z", Pickups: 1, Dropoffs: 1},
+			},
+		},
+
+		"successful heatmap without travels": {
+			db:    db,
+			query: HeatmapQuery{From: day.AddDate(0, 1, 0), To: day.AddDate(0, 1, 1)},
+			want:  []HeatmapCell{},
+		},
+
+		"error on heatmap: invalid precision": {
+			db:       db,
+			query:    HeatmapQuery{Precision: 9},
+			expected: ErrInvalidHeatmapPrecision,
+		},
+
+		"error on heatmap: invalid window": {
+			db:       db,
+			query:    HeatmapQuery{Window: "week"},
+			expected: ErrInvalidHeatmapWindow,
+		},
+
+		"error on heatmap: range too long": {
+			db:       db,
+			query:    HeatmapQuery{From: day, To: day.AddDate(0, 6, 0)},
+			expected: ErrInvalidHeatmapRange,
+		},
+
+		"error on heatmap: from after to": {
+			db:       db,
+			query:    HeatmapQuery{From: day.AddDate(0, 0, 1), To: day},
+			expected: ErrInvalidHeatmapRange,
+		},
+
+		"db failure on heatmap": {
+			db:       newMockDB().onSearch(errors.New("mocked db error")),
+			query:    HeatmapQuery{},
+			expected: ErrStorageGet,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := NewTravelStorage(tc.db).Heatmap(context.Background(), tc.query)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result.Cells)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+
+	t.Run("successful heatmap defaults", func(t *testing.T) {
+		result, err := NewTravelStorage(newMockDB()).Heatmap(context.Background(), HeatmapQuery{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, DefaultHeatmapPrecision, result.Precision)
+		assert.Equal(t, HeatmapWindowHour, result.Window)
+		assert.WithinDuration(t, time.Now(), result.To, 2*time.Second)
+		assert.Equal(t, result.To.AddDate(0, 0, -DefaultHeatmapDays), result.From)
+	})
+}
+
+func Test_driverEarnings(t *testing.T) {
+	day := time.Date(2021, 12, 1, 0, 0, 0, 0, time.UTC)
+	completedAt := func(date time.Time) *time.Time { return &date }
+	// travels starting and ending on the same location only have the base fare (100 on the default pricing)
+	point := Point{Lat: -34.6037, Lng: -58.3816}
+	db := newMockDBFromMap(map[int64]Travel{
+		1: {ID: 1, Status: StatusReady, UserID: 5, From: point, To: point,
+			CompletedAt: completedAt(day.Add(10 * time.Hour))},
+		2: {ID: 2, Status: StatusReady, UserID: 5, From: point, To: point,
+			CompletedAt: completedAt(day.Add(33 * time.Hour))},
+		3: {ID: 3, Status: StatusReady, UserID: 5, From: point, To: point,
+			CompletedAt: completedAt(day.AddDate(0, 0, 7))},
+		4: {ID: 4, Status: StatusInProcess, UserID: 5, From: point, To: point},
+		5: {ID: 5, Status: StatusReady, UserID: 6, From: point, To: point,
+			CompletedAt: completedAt(day.Add(10 * time.Hour))},
+		6: {ID: 6, Status: StatusReady, UserID: 5, From: point, To: point,
+			CompletedAt: completedAt(day.AddDate(0, 0, -10))},
+	})
+
+	tests := map[string]struct {
+		db          *mockDb
+		query       EarningsQuery
+		wantTravels int64
+		wantTotal   float64
+		want        []PeriodEarnings
+		expected    error
+	}{
+		"successful earnings by day": {
+			db:          db,
+			query:       EarningsQuery{From: day, To: day.AddDate(0, 0, 3)},
+			wantTravels: 2,
+			wantTotal:   200,
+			want: []PeriodEarnings{
+				{Start: "2021-12-01", Travels: 1, Total: 100},
+				{Start: "2021-12-02", Travels: 1, Total: 100},
+				{Start: "2021-12-03", Travels: 0, Total: 0},
+			},
+		},
+
+		"successful earnings by week": {
+			db:          db,
+			query:       EarningsQuery{From: day, To: day.AddDate(0, 0, 10), Period: EarningsPeriodWeek},
+			wantTravels: 3,
+			wantTotal:   300,
+			want: []PeriodEarnings{
+				{Start: "2021-11-29", Travels: 2, Total: 200},
+				{Start: "2021-12-06", Travels: 1, Total: 100},
+			},
+		},
+
+		"error on earnings: invalid period": {
+			db:       db,
+			query:    EarningsQuery{Period: "month"},
+			expected: ErrInvalidEarningsPeriod,
+		},
+
+		"error on earnings: range too long": {
+			db:       db,
+			query:    EarningsQuery{From: day, To: day.AddDate(2, 0, 0)},
+			expected: ErrInvalidEarningsRange,
+		},
+
+		"error on earnings: from after to": {
+			db:       db,
+			query:    EarningsQuery{From: day.AddDate(0, 0, 1), To: day},
+			expected: ErrInvalidEarningsRange,
+		},
+
+		"db failure on earnings": {
+			db:       newMockDB().onSearch(errors.New("mocked db error")),
+			query:    EarningsQuery{},
+			expected: ErrStorageGet,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := NewTravelStorage(tc.db).Earnings(context.Background(), 5, tc.query)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, int64(5), result.UserID)
+				assert.Equal(t, tc.wantTravels, result.Travels)
+				assert.Equal(t, tc.wantTotal, result.Total)
+				assert.Equal(t, tc.want, result.Periods)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+
+	t.Run("successful earnings defaults", func(t *testing.T) {
+		result, err := NewTravelStorage(newMockDB()).Earnings(context.Background(), 5, EarningsQuery{})
+
+		assert.Nil(t, err)
+		assert.Equal(t, EarningsPeriodDay, result.Period)
+		assert.Equal(t, result.To.AddDate(0, 0, -DefaultEarningsDays), result.From)
+		assert.Len(t, result.Periods, DefaultEarningsDays)
+	})
+}
+
+func Test_travelDuration(t *testing.T) {
+	now := clock.NewFake(time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC))
+	halfHourAgo := now.Now().Add(-30 * time.Minute)
+	db := newMockDBFromMap(map[int64]Travel{
+		1: {ID: 1, Status: StatusPending, UserID: 5, From: Point{Lat: 0, Lng: 0}, To: Point{Lat: 0, Lng: 0.1}},
+		2: {ID: 2, Status: StatusInProcess, UserID: 6, From: Point{Lat: 0, Lng: 0}, To: Point{Lat: 0, Lng: 0.1},
+			StartedAt: &halfHourAgo},
+		3: {ID: 3, Status: StatusInProcess, UserID: 7},
+	})
+	travelStorage := NewTravelStorage(db, WithZoneChecker(mockZoneChecker{drivers: []int64{5, 6, 7}}, ZonePolicyFlag),
+		WithClock(now))
+	ctx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: "admin"})
+
+	// a travel set in process starts now
+	started, err := travelStorage.UpdateStatus(ctx, 1, StatusInProcess)
+	assert.Nil(t, err)
+	if assert.NotNil(t, started.StartedAt) {
+		assert.Equal(t, now.Now(), *started.StartedAt)
+	}
+	assert.Nil(t, started.CompletedAt)
+
+	// a ready travel stores its estimated and actual duration (11.12 km at 40 km/h are 17 minutes)
+	completed, err := travelStorage.UpdateStatus(ctx, 2, StatusReady)
+	assert.Nil(t, err)
+	assert.NotNil(t, completed.CompletedAt)
+	if assert.NotNil(t, completed.EstimatedMinutes) && assert.NotNil(t, completed.ActualMinutes) {
+		assert.Equal(t, int64(17), *completed.EstimatedMinutes)
+		assert.Equal(t, float64(30), *completed.ActualMinutes)
+	}
+	assert.Equal(t, completed, db.travels[2])
+
+	// travels started before the durations were recorded are completed without them
+	completed, err = travelStorage.UpdateStatus(ctx, 3, StatusReady)
+	assert.Nil(t, err)
+	assert.NotNil(t, completed.CompletedAt)
+	assert.Nil(t, completed.EstimatedMinutes)
+	assert.Nil(t, completed.ActualMinutes)
+
+	stats, err := travelStorage.Stats(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), stats.Punctuality.Completed)
+	assert.Equal(t, int64(0), stats.Punctuality.OnTime)
+	assert.InDelta(t, 13, stats.Punctuality.AverageDelayMinutes, 0.1)
+}
+
+func Test_expirePendingTravels(t *testing.T) {
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	recent := time.Now().UTC().Add(-time.Hour)
+
+	tests := map[string]struct {
+		db       *mockDb
+		want     []int64
+		expected error
+	}{
+		"successful expire of old pending travels": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: Travel{ID: 1, Status: StatusPending, CreatedAt: old},
+				2: Travel{ID: 2, Status: StatusPending, CreatedAt: recent},
+				3: Travel{ID: 3, Status: StatusInProcess, UserID: 1, CreatedAt: old},
+				4: Travel{ID: 4, Status: StatusPending, UserID: 2, CreatedAt: old},
+			}),
+			want: []int64{1, 4},
+		},
+
+		"successful expire without old pending travels": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: Travel{ID: 1, Status: StatusPending, CreatedAt: recent},
+			}),
+		},
+
+		"db failure expire pending travels": {
+			db:       newMockDB().onExpire(errors.New("mocked expire error")),
+			expected: ErrStorageUpdate,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			result, err := travelStorage.ExpirePending(context.Background(), 24*time.Hour)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+				events := eventsOfType(tc.db.events, EventExpired)
+				assert.Len(t, events, len(tc.want))
+				assert.Len(t, eventsOfType(tc.db.events, EventStatusChanged), len(tc.want))
+				for i, id := range tc.want {
+					assert.Equal(t, StatusCancelled, string(tc.db.travels[id].Status))
+					assert.Equal(t, "the travel was pending for more than 24h0m0s", events[i].Detail)
+				}
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_updateTravel(t *testing.T) {
+	newTravel := func(id int64, fromLat, fromLng, toLat, toLng float64, status Status, userID int64) Travel {
+		return Travel{
+			ID:     id,
+			Status: status,
+			From: Point{
+				Lat: fromLat,
+				Lng: fromLng,
+			},
+			To: Point{
+				Lat: toLat,
+				Lng: toLng,
+			},
+			UserID: userID,
+		}
+	}
+
+	tests := map[string]struct {
+		db         repository
+		userLogged *jwt.Claims
+		trv        Travel
+		expected   error
+	}{
+		"successful travel update: change locations in pending": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusPending, 0)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -12,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 22,
+					Lng: 20,
+				},
+				Status: StatusPending,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+		},
+
+		"successful travel update: change user id in pending status by admin": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusPending, 0)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 1234,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+		},
+
+		"successful travel update: change user id assigned on travel in pending status by admin": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusPending, 2)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 1234,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+		},
+
+		"failure travel update: cannot change user id in pending status from a travel without user by driver": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusPending, 0)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 1,
+			},
+			expected: errors.New("invalid_user_access - the user logged in cannot perform this action, he is not the owner of the travel or it is not an admin"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "driver",
+			},
+		},
+
+		"failure travel update: cannot change user id in pending status even if the user logged in is the owner": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusPending, 1)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 2,
+			},
+			expected: errors.New("invalid_user_access - the user logged in cannot perform this action, he is not the owner of the travel or it is not an admin"),
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "driver",
+			},
+		},
+
+		"successful travel update: change user id in pending status by dispatcher": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusPending, 1)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 2,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 3,
+				Role:   "dispatcher",
+			},
+		},
+
+		"failure travel update: not user logged in": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusPending, 0)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 1234,
+			},
+			expected: ErrInvalidUserClaims,
+		},
+
+		"failure travel update: invalid user logged in": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusPending, 0)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 1234,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "driver",
+			},
+			expected: ErrInvalidUserAccess,
+		},
+
+		"failure travel update: change initial status without user on db travel": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusPending, 0)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusInProcess,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			expected: ErrInvalidUser,
+		},
+
+		"failure travel update: change locations in no pending status": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusInProcess, 0)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: 60,
+					Lng: 2,
+				},
+				To: Point{
+					Lat: -10,
+					Lng: -33,
+				},
+				Status: StatusInProcess,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			expected: ErrInvalidStatusToEditLocation,
+		},
+
+		"failure travel update: change user id in no pending status": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusInProcess, 12312312)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusInProcess,
+				UserID: 123,
+			},
+			expected: ErrInvalidUser,
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+		},
+
+		"failure travel update: no user id in no pending status": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusInProcess, 12312312)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusInProcess,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			expected: ErrInvalidUser,
+		},
+
+		"failure travel update: no status": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusPending, 0)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			expected: ErrInvalidStatusToEdit,
+		},
+
+		"failure travel update: pending to ready": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusPending, 0)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusReady,
+				UserID: 1231,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			expected: ErrInvalidStatusToEdit,
+		},
+
+		"failure travel update: in process to pending": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusInProcess, 1231)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 1231,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			expected: ErrInvalidStatusToEdit,
+		},
+
+		"db not found travel get": {
+			db: newMockDB().onGet(22, ErrTravelNotFound),
+			trv: Travel{
+				ID: 22,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 1231,
+			},
+			expected: ErrNotFoundTravel,
+		},
+
+		"failure updating a cancelled travel": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusCancelled, 0)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			expected: ErrInvalidStatusToEdit,
+		},
+
+		"failure assigning a user with another active travel": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: newTravel(1, -10, 70, 2, 20, StatusPending, 0),
+				2: newTravel(2, -10, 70, 2, 20, StatusInProcess, 1234),
+			}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 1234,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			expected: ErrDriverAlreadyAssigned,
+		},
+
+		"failure due to concurrent travel update": {
+			db: newMockDBFromMap(map[int64]Travel{22: newTravel(22, -10, 70, 2, 20, StatusPending, 0)}).
+				onUpdate(22, ErrTravelLocked),
+			trv: Travel{
+				ID: 22,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 1234,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			expected: ErrTravelUpdateConflict,
+		},
+
+		"error on travel update: offered travel": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusOffered, 3)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 3,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			expected: ErrInvalidStatusToEdit,
+		},
+
+		"error on travel update: invalid coordinates": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -10, 70, 2, 20, StatusPending, 0)}),
+			trv: Travel{
+				ID: 1,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 200,
+				},
+				Status: StatusPending,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			expected: ErrInvalidCoordinates,
+		},
+
+		"db failure travel update": {
+			db: newMockDBFromMap(map[int64]Travel{22: newTravel(22, -10, 70, 2, 20, StatusPending, 0)}).
+				onUpdate(22, errors.New("mocked db error")),
+			trv: Travel{
+				ID: 22,
+				From: Point{
+					Lat: -10,
+					Lng: 70,
+				},
+				To: Point{
+					Lat: 2,
+					Lng: 20,
+				},
+				Status: StatusPending,
+				UserID: 1234,
+			},
+			userLogged: &jwt.Claims{
+				UserID: 1,
+				Role:   "admin",
+			},
+			expected: ErrStorageUpdate,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			ctx := context.Background()
+			if tc.userLogged != nil {
+				ctx = context.WithValue(ctx, "user_on_call", *tc.userLogged)
+			}
+			result, err := travelStorage.Update(ctx, tc.trv)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.NotNil(t, result)
+
+				assert.Equal(t, tc.trv.Status, result.Status)
+				assert.Equal(t, tc.trv.From.Lat, result.From.Lat)
+				assert.Equal(t, tc.trv.From.Lng, result.From.Lng)
+				assert.Equal(t, tc.trv.To.Lat, result.To.Lat)
+				assert.Equal(t, tc.trv.To.Lng, result.To.Lng)
+				assert.Equal(t, tc.trv.UserID, result.UserID)
+				assert.Greater(t, result.ID, int64(0))
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_updateTravelAssignmentLock(t *testing.T) {
+	locker := lock.NewLocal()
+	// the travel is being assigned by another request
+	_, err := locker.Acquire(context.Background(), "travels.assignment.1", time.Minute)
+	assert.Nil(t, err)
+
+	db := newMockDBFromMap(map[int64]Travel{1: {ID: 1, Status: StatusPending, From: Point{Lat: -10, Lng: 70},
+		To: Point{Lat: 2, Lng: 20}}})
+	travelStorage := NewTravelStorage(db, WithLock(locker))
+	ctx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: "admin"})
+
+	// an update which keeps the user of the travel does not take the lock of its assignment
+	result, err := travelStorage.Update(ctx, Travel{ID: 1, Status: StatusPending, From: Point{Lat: -10, Lng: 70},
+		To: Point{Lat: 3, Lng: 20}})
+	assert.Nil(t, err)
+	assert.Equal(t, float64(3), result.To.Lat)
+
+	// an update which assigns the travel waits for the other request
+	_, err = travelStorage.Update(ctx, Travel{ID: 1, Status: StatusPending, UserID: 1234,
+		From: Point{Lat: -10, Lng: 70}, To: Point{Lat: 3, Lng: 20}})
+	assert.NotNil(t, err)
+	assert.Equal(t, ErrTravelUpdateConflict.Error(), err.Error())
+	assert.Equal(t, int64(0), db.travels[1].UserID)
+}
+
+func Test_updateTravelWithValidators(t *testing.T) {
+	errTooFar := code_error.Error{Code: "travel_too_far", Detail: "the travel is too far for the driver"}
+	maxLatitude := func(lat float64) UpdateValidator {
+		return func(ctx context.Context, current, changes Travel, userLogged jwt.Claims) error {
+			if changes.To.Lat > lat {
+				return errTooFar
+			}
+			return nil
+		}
+	}
+
+	tests := map[string]struct {
+		validators []UpdateValidator
+		trv        Travel
+		expected   error
+	}{
+		"successful travel update: accepted by validators": {
+			validators: []UpdateValidator{maxLatitude(50), maxLatitude(30)},
+			trv:        Travel{ID: 1, Status: StatusPending, From: Point{Lat: -10, Lng: 70}, To: Point{Lat: 25, Lng: 20}},
+		},
+
+		"error on travel update: rejected by validator": {
+			validators: []UpdateValidator{maxLatitude(50), maxLatitude(10)},
+			trv:        Travel{ID: 1, Status: StatusPending, From: Point{Lat: -10, Lng: 70}, To: Point{Lat: 25, Lng: 20}},
+			expected:   errTooFar,
+		},
+
+		"error on travel update: built-in validations run before validators": {
+			validators: []UpdateValidator{maxLatitude(10)},
+			trv:        Travel{ID: 1, Status: "unknown", From: Point{Lat: -10, Lng: 70}, To: Point{Lat: 25, Lng: 20}},
+			expected:   ErrInvalidStatusToEdit,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := newMockDBFromMap(map[int64]Travel{1: {
+				ID:     1,
+				Status: StatusPending,
+				From:   Point{Lat: -10, Lng: 70},
+				To:     Point{Lat: 2, Lng: 20},
+			}})
+
+			var opts []TravelStorageOption
+			for _, validator := range tc.validators {
+				opts = append(opts, WithUpdateValidator(validator))
+			}
+			travelStorage := NewTravelStorage(db, opts...)
+
+			ctx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: "admin"})
+			result, err := travelStorage.Update(ctx, tc.trv)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.trv.To.Lat, result.To.Lat)
+				assert.Equal(t, tc.trv.To.Lat, db.travels[1].To.Lat)
+			} else {
+				assert.Equal(t, tc.expected, err)
+				assert.Equal(t, float64(2), db.travels[1].To.Lat)
+			}
+		})
+	}
+}
+
+func Test_batchUpdateTravelStatus(t *testing.T) {
+	newDB := func() *mockDb {
+		return newMockDBFromMap(map[int64]Travel{
+			1: {ID: 1, Status: StatusInProcess, UserID: 2},
+			2: {ID: 2, Status: StatusPending},
+			3: {ID: 3, Status: StatusReady, UserID: 3},
+		})
+	}
+
+	tests := map[string]struct {
+		db         *mockDb
+		userLogged *jwt.Claims
+		ids        []int64
+		status     Status
+		want       []BatchResult
+		expected   error
+	}{
+		"successful batch update status: ready": {
+			db:         newDB(),
+			userLogged: &jwt.Claims{UserID: 1, Role: "admin"},
+			ids:        []int64{1, 2, 1},
+			status:     StatusReady,
+			want: []BatchResult{
+				{ID: 1, Travel: Travel{ID: 1, Status: StatusReady, UserID: 2}},
+				{ID: 2, Err: ErrInvalidUser},
+			},
+		},
+
+		"successful batch update status: cancelled": {
+			db:         newDB(),
+			userLogged: &jwt.Claims{UserID: 1, Role: "admin"},
+			ids:        []int64{2, 3},
+			status:     StatusCancelled,
+			want: []BatchResult{
+				{ID: 2, Travel: Travel{ID: 2, Status: StatusCancelled}},
+				{ID: 3, Err: ErrInvalidStatusToCancel},
+			},
+		},
+
+		"successful batch update status: cancelled only by admins": {
+			db:         newDB(),
+			userLogged: &jwt.Claims{UserID: 2, Role: "driver"},
+			ids:        []int64{1},
+			status:     StatusCancelled,
+			want: []BatchResult{
+				{ID: 1, Err: ErrInvalidUserAccess},
+			},
+		},
+
+		"successful batch update status: no user logged in": {
+			db:     newDB(),
+			ids:    []int64{1},
+			status: StatusReady,
+			want: []BatchResult{
+				{ID: 1, Err: ErrInvalidUserClaims},
+			},
+		},
+
+		"error on batch update status: empty batch": {
+			db:       newDB(),
+			status:   StatusReady,
+			expected: ErrInvalidBatchSize,
+		},
+
+		"error on batch update status: batch too big": {
+			db:       newDB(),
+			ids:      make([]int64, 101),
+			status:   StatusReady,
+			expected: ErrInvalidBatchSize,
+		},
+
+		"error on batch update status: invalid status": {
+			db:       newDB(),
+			ids:      []int64{1},
+			status:   "finished",
+			expected: ErrInvalidStatusToEdit,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			ctx := context.Background()
+			if tc.userLogged != nil {
+				ctx = context.WithValue(ctx, "user_on_call", *tc.userLogged)
+			}
+			result, err := travelStorage.BatchUpdateStatus(ctx, tc.ids, tc.status)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				// the completion date is set when the travels are ready
+				for i := range result {
+					if result[i].Err == nil && result[i].Travel.Status == StatusReady {
+						assert.NotNil(t, result[i].Travel.CompletedAt)
+						result[i].Travel.CompletedAt = nil
+					}
+				}
+				assert.Equal(t, tc.want, result)
+				for _, r := range tc.want {
+					if r.Err == nil {
+						assert.Equal(t, tc.status, tc.db.travels[r.ID].Status)
+					} else {
+						assert.NotEqual(t, tc.status, tc.db.travels[r.ID].Status)
+					}
+				}
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_rateTravel(t *testing.T) {
+	newTravel := func(id int64, status Status, userID int64) Travel {
+		return Travel{
+			ID:     id,
+			Status: status,
+			From: Point{
+				Lat: -1,
+				Lng: -10,
+			},
+			To: Point{
+				Lat: 2,
+				Lng: 20,
+			},
+			UserID: userID,
+		}
+	}
+
+	ratedDb := newMockDBFromMap(map[int64]Travel{1: newTravel(1, StatusReady, 10)})
+	ratedDb.ratings[1] = Rating{TravelID: 1, UserID: 10, Score: 3}
+
+	tests := map[string]struct {
+		db       repository
+		travelID int64
+		rating   Rating
+		want     Rating
+		expected error
+	}{
+		"successful travel rate": {
+			db:       newMockDBFromMap(map[int64]Travel{1: newTravel(1, StatusReady, 10)}),
+			travelID: 1,
+			rating:   Rating{Score: 5, Comment: "great travel"},
+			want:     Rating{TravelID: 1, UserID: 10, Score: 5, Comment: "great travel"},
+		},
+
+		"failure travel rate: score lower than 1": {
+			db:       newMockDBFromMap(map[int64]Travel{1: newTravel(1, StatusReady, 10)}),
+			travelID: 1,
+			rating:   Rating{Score: 0},
+			expected: ErrInvalidRatingScore,
+		},
+
+		"failure travel rate: score greater than 5": {
+			db:       newMockDBFromMap(map[int64]Travel{1: newTravel(1, StatusReady, 10)}),
+			travelID: 1,
+			rating:   Rating{Score: 6},
+			expected: ErrInvalidRatingScore,
+		},
+
+		"failure travel rate: travel is not ready": {
+			db:       newMockDBFromMap(map[int64]Travel{1: newTravel(1, StatusInProcess, 10)}),
+			travelID: 1,
+			rating:   Rating{Score: 4},
+			expected: ErrInvalidStatusToRate,
+		},
+
+		"failure travel rate: travel not found": {
+			db:       newMockDB().onGet(1, ErrTravelNotFound),
+			travelID: 1,
+			rating:   Rating{Score: 4},
+			expected: ErrNotFoundTravel,
+		},
+
+		"failure travel rate: already rated": {
+			db:       ratedDb,
+			travelID: 1,
+			rating:   Rating{Score: 4},
+			expected: ErrTravelAlreadyRated,
+		},
+
+		"db failure travel rate": {
+			db:       newMockDBFromMap(map[int64]Travel{1: newTravel(1, StatusReady, 10)}).onRate(errors.New("mocked rate error")),
+			travelID: 1,
+			rating:   Rating{Score: 4},
+			expected: ErrStorageSaveRating,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			result, err := travelStorage.Rate(context.Background(), tc.travelID, tc.rating)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_reassignTravel(t *testing.T) {
+	newTravel := func(id int64, status Status, userID int64) Travel {
+		return Travel{
+			ID:     id,
+			Status: status,
+			From:   Point{Lat: 1, Lng: 2},
+			To:     Point{Lat: -1, Lng: -2},
+			UserID: userID,
+		}
+	}
+
+	tests := map[string]struct {
+		db           *mockDb
+		id           int64
+		reassignment Reassignment
+		want         Travel
+		expected     error
+	}{
+		"successful reassign to another user": {
+			db:           newMockDBFromMap(map[int64]Travel{1: newTravel(1, StatusInProcess, 1)}),
+			id:           1,
+			reassignment: Reassignment{UserID: 2, Reason: "the car broke down"},
+			want:         newTravel(1, StatusInProcess, 2),
+		},
+
+		"successful reassign back to pending": {
+			db:           newMockDBFromMap(map[int64]Travel{1: newTravel(1, StatusInProcess, 1)}),
+			id:           1,
+			reassignment: Reassignment{Reason: "the driver is sick"},
+			want:         newTravel(1, StatusPending, 0),
+		},
+
+		"failure reassign a pending travel": {
+			db:           newMockDBFromMap(map[int64]Travel{1: newTravel(1, StatusPending, 1)}),
+			id:           1,
+			reassignment: Reassignment{UserID: 2, Reason: "the car broke down"},
+			expected:     ErrInvalidStatusToReassign,
+		},
+
+		"failure reassign to the same user": {
+			db:           newMockDBFromMap(map[int64]Travel{1: newTravel(1, StatusInProcess, 1)}),
+			id:           1,
+			reassignment: Reassignment{UserID: 1, Reason: "the car broke down"},
+			expected:     ErrInvalidReassignUser,
+		},
+
+		"failure reassign to a user with another active travel": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: newTravel(1, StatusInProcess, 1),
+				2: newTravel(2, StatusPending, 2),
+			}),
+			id:           1,
+			reassignment: Reassignment{UserID: 2, Reason: "the car broke down"},
+			expected:     ErrDriverAlreadyAssigned,
+		},
+
+		"db not found travel": {
+			db:           newMockDB().onGet(22, ErrTravelNotFound),
+			id:           22,
+			reassignment: Reassignment{Reason: "the driver is sick"},
+			expected:     ErrNotFoundTravel,
+		},
+
+		"db failure reassign travel": {
+			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, StatusInProcess, 1)}).
+				onUpdate(1, errors.New("mocked db error")),
+			id:           1,
+			reassignment: Reassignment{Reason: "the driver is sick"},
+			expected:     ErrStorageUpdate,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			result, err := travelStorage.Reassign(context.Background(), tc.id, tc.reassignment)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+				assert.Equal(t, tc.want, tc.db.travels[tc.id])
+
+				events := eventsOfType(tc.db.events, EventReassigned)
+				if assert.Len(t, events, 1) {
+					assert.Equal(t, tc.id, events[0].TravelID)
+					assert.Equal(t, tc.reassignment.Reason, events[0].Detail)
+				}
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				assert.Empty(t, tc.db.events)
+			}
+		})
+	}
+}
+
+func Test_offerTravel(t *testing.T) {
+	tests := map[string]struct {
+		db *mockDb
+		id int64
+		// assigning when the travel is being assigned by another request
+		assigning bool
+		offer     Offer
+		expected  error
+	}{
+		"successful offer travel": {
+			db: newMockDBFromMap(map[int64]Travel{1: {ID: 1, Status: StatusPending}}),
+			id: 1,
+			offer: Offer{
+				UserID: 5,
+			},
+		},
+
+		"error on offer travel: travel already assigned": {
+			db:       newMockDBFromMap(map[int64]Travel{1: {ID: 1, Status: StatusPending, UserID: 3}}),
+			id:       1,
+			offer:    Offer{UserID: 5},
+			expected: ErrInvalidStatusToOffer,
+		},
+
+		"error on offer travel: travel not pending": {
+			db:       newMockDBFromMap(map[int64]Travel{1: {ID: 1, Status: StatusOffered, UserID: 3}}),
+			id:       1,
+			offer:    Offer{UserID: 5},
+			expected: ErrInvalidStatusToOffer,
+		},
+
+		"error on offer travel: driver with an offered travel": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: {ID: 1, Status: StatusPending},
+				2: {ID: 2, Status: StatusOffered, UserID: 5},
+			}),
+			id:       1,
+			offer:    Offer{UserID: 5},
+			expected: ErrDriverAlreadyAssigned,
+		},
+
+		"error on offer travel: deleted travel": {
+			db:       newMockDBFromMap(map[int64]Travel{1: {ID: 1, Status: StatusPending, DeletedAt: &time.Time{}}}),
+			id:       1,
+			offer:    Offer{UserID: 5},
+			expected: ErrNotFoundTravel,
+		},
+
+		"error on offer travel: travel being assigned by another request": {
+			db:        newMockDBFromMap(map[int64]Travel{1: {ID: 1, Status: StatusPending}}),
+			id:        1,
+			assigning: true,
+			offer:     Offer{UserID: 5},
+			expected:  ErrTravelUpdateConflict,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			locker := lock.NewLocal()
+			if tc.assigning {
+				_, err := locker.Acquire(context.Background(), "travels.assignment.1", time.Minute)
+				assert.Nil(t, err)
+			}
+
+			now := clock.NewFake(time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC))
+			travelStorage := NewTravelStorage(tc.db, WithOfferTimeout(time.Minute), WithClock(now), WithLock(locker))
+			result, err := travelStorage.Offer(context.Background(), tc.id, tc.offer)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, Status(StatusOffered), result.Status)
+				assert.Equal(t, tc.offer.UserID, result.UserID)
+				if assert.NotNil(t, result.OfferExpiresAt) {
+					assert.Equal(t, now.Now().Add(time.Minute), *result.OfferExpiresAt)
+				}
+				assert.Equal(t, result, tc.db.travels[tc.id])
+
+				events := eventsOfType(tc.db.events, EventOffered)
+				if assert.Len(t, events, 1) {
+					assert.Equal(t, "5", events[0].Detail)
+				}
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				assert.Empty(t, eventsOfType(tc.db.events, EventOffered))
+			}
+		})
+	}
+}
+
+func Test_travelJobLock(t *testing.T) {
+	locker := lock.NewLocal()
+	instances := []TravelStorage{
+		NewTravelStorage(newMockDBFromMap(nil), WithLock(locker)),
+		NewTravelStorage(newMockDBFromMap(nil), WithLock(locker)),
+	}
+	runs := make([]int, len(instances))
+
+	// an instance already stopped only runs the job once
+	stopped, stop := context.WithCancel(context.Background())
+	stop()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	instances[0].runEvery(ctx, "expire_offers", time.Hour, func() {
+		runs[0]++
+
+		// the other instance does not run the job while the first one holds its lock
+		instances[1].runEvery(stopped, "expire_offers", time.Hour, func() { runs[1]++ })
+		cancel()
+	})
+	assert.Equal(t, []int{1, 0}, runs)
+
+	// the lock is released once the first instance stops
+	instances[1].runEvery(stopped, "expire_offers", time.Hour, func() { runs[1]++ })
+	assert.Equal(t, []int{1, 1}, runs)
+}
+
+func Test_answerTravelOffer(t *testing.T) {
+	inAMinute := time.Now().UTC().Add(time.Minute)
+	aMinuteAgo := time.Now().UTC().Add(-time.Minute)
+	newDB := func(expiresAt time.Time) *mockDb {
+		return newMockDBFromMap(map[int64]Travel{
+			1: {ID: 1, Status: StatusOffered, UserID: 5, OfferExpiresAt: &expiresAt},
+			2: {ID: 2, Status: StatusPending, UserID: 5},
+		})
+	}
+
+	tests := map[string]struct {
+		db         *mockDb
+		accept     bool
+		id         int64
+		userLogged *jwt.Claims
+		want       Travel
+		wantEvent  EventType
+		expected   error
+	}{
+		"successful accept travel offer": {
+			db:         newDB(inAMinute),
+			accept:     true,
+			id:         1,
+			userLogged: &jwt.Claims{UserID: 5, Role: "driver"},
+			want:       Travel{ID: 1, Status: StatusPending, UserID: 5},
+			wantEvent:  EventOfferAccepted,
+		},
+
+		"successful reject travel offer": {
+			db:         newDB(inAMinute),
+			id:         1,
+			userLogged: &jwt.Claims{UserID: 5, Role: "driver"},
+			want:       Travel{ID: 1, Status: StatusPending},
+			wantEvent:  EventOfferRejected,
+		},
+
+		"successful reject expired travel offer": {
+			db:         newDB(aMinuteAgo),
+			id:         1,
+			userLogged: &jwt.Claims{UserID: 5, Role: "driver"},
+			want:       Travel{ID: 1, Status: StatusPending},
+			wantEvent:  EventOfferRejected,
+		},
+
+		"error on accept travel offer: offer expired": {
+			db:         newDB(aMinuteAgo),
+			accept:     true,
+			id:         1,
+			userLogged: &jwt.Claims{UserID: 5, Role: "driver"},
+			expected:   ErrOfferExpired,
+		},
+
+		"error on accept travel offer: offered to another driver": {
+			db:         newDB(inAMinute),
+			accept:     true,
+			id:         1,
+			userLogged: &jwt.Claims{UserID: 6, Role: "driver"},
+			expected:   ErrInvalidOfferUser,
+		},
+
+		"error on reject travel offer: offered to another driver": {
+			db:         newDB(inAMinute),
+			id:         1,
+			userLogged: &jwt.Claims{UserID: 6, Role: "driver"},
+			expected:   ErrInvalidOfferUser,
+		},
+
+		"error on accept travel offer: travel not offered": {
+			db:         newDB(inAMinute),
+			accept:     true,
+			id:         2,
+			userLogged: &jwt.Claims{UserID: 5, Role: "driver"},
+			expected:   ErrInvalidStatusToAnswer,
+		},
+
+		"error on accept travel offer: no user logged in": {
+			db:       newDB(inAMinute),
+			accept:   true,
+			id:       1,
+			expected: ErrInvalidUserClaims,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			ctx := context.Background()
+			if tc.userLogged != nil {
+				ctx = context.WithValue(ctx, "user_on_call", *tc.userLogged)
+			}
+
+			answer := travelStorage.Reject
+			if tc.accept {
+				answer = travelStorage.Accept
+			}
+			result, err := answer(ctx, tc.id)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+				assert.Equal(t, tc.want, tc.db.travels[tc.id])
+
+				events := eventsOfType(tc.db.events, tc.wantEvent)
+				if assert.Len(t, events, 1) {
+					assert.Equal(t, "5", events[0].Detail)
+				}
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				assert.Empty(t, tc.db.events)
+			}
+		})
+	}
+}
+
+func Test_enqueueTravel(t *testing.T) {
+	position := func(p int) *int { return &p }
+
+	tests := map[string]struct {
+		db       *mockDb
+		id       int64
+		size     int
+		expected error
+		position int
+	}{
+		"successful queue travel": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: {ID: 1, Status: StatusPending},
+				2: {ID: 2, Status: StatusInProcess, UserID: 5},
+				3: {ID: 3, Status: StatusQueued, UserID: 5, QueuePosition: position(1)},
+			}),
+			id:       1,
+			size:     2,
+			position: 2,
+		},
+
+		"error on queue travel: driver without in process travel": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: {ID: 1, Status: StatusPending},
+				2: {ID: 2, Status: StatusReady, UserID: 5},
+			}),
+			id:       1,
+			size:     2,
+			expected: ErrDriverNotInProcess,
+		},
+
+		"error on queue travel: queue full": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: {ID: 1, Status: StatusPending},
+				2: {ID: 2, Status: StatusInProcess, UserID: 5},
+				3: {ID: 3, Status: StatusQueued, UserID: 5, QueuePosition: position(1)},
+			}),
+			id:       1,
+			size:     1,
+			expected: ErrQueueFull,
+		},
+
+		"error on queue travel: travel already assigned": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: {ID: 1, Status: StatusPending, UserID: 3},
+				2: {ID: 2, Status: StatusInProcess, UserID: 5},
+			}),
+			id:       1,
+			size:     2,
+			expected: ErrInvalidStatusToQueue,
+		},
+
+		"error on queue travel: travel in process": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: {ID: 1, Status: StatusInProcess, UserID: 3},
+				2: {ID: 2, Status: StatusInProcess, UserID: 5},
+			}),
+			id:       1,
+			size:     2,
+			expected: ErrInvalidStatusToQueue,
+		},
+
+		"error on queue travel: deleted travel": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: {ID: 1, Status: StatusPending, DeletedAt: &time.Time{}},
+				2: {ID: 2, Status: StatusInProcess, UserID: 5},
+			}),
+			id:       1,
+			size:     2,
+			expected: ErrNotFoundTravel,
+		},
+
+		"error on queue travel: not found travel": {
+			db:       newMockDB().onGet(1, ErrTravelNotFound),
+			id:       1,
+			size:     2,
+			expected: ErrNotFoundTravel,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db, WithQueueSize(tc.size))
+			result, err := travelStorage.Enqueue(context.Background(), tc.id, QueueAssignment{UserID: 5})
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, Status(StatusQueued), result.Status)
+				assert.Equal(t, int64(5), result.UserID)
+				if assert.NotNil(t, result.QueuePosition) {
+					assert.Equal(t, tc.position, *result.QueuePosition)
+				}
+				assert.Equal(t, result, tc.db.travels[tc.id])
+
+				events := eventsOfType(tc.db.events, EventQueued)
+				if assert.Len(t, events, 1) {
+					assert.Equal(t, "5", events[0].Detail)
+				}
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				assert.Empty(t, eventsOfType(tc.db.events, EventQueued))
+			}
+		})
+	}
+}
+
+func Test_travelQueueFlow(t *testing.T) {
+	db := newMockDBFromMap(map[int64]Travel{
+		1: {ID: 1, Status: StatusInProcess, UserID: 5},
+		2: {ID: 2, Status: StatusPending},
+		3: {ID: 3, Status: StatusPending},
+		4: {ID: 4, Status: StatusPending},
+	})
+	travelStorage := NewTravelStorage(db)
+	ctx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: "admin"})
+
+	for _, id := range []int64{2, 3, 4} {
+		_, err := travelStorage.Enqueue(ctx, id, QueueAssignment{UserID: 5})
+		assert.Nil(t, err)
+	}
+
+	// queued travels are out of the update flow and cannot be deleted
+	_, err := travelStorage.UpdateStatus(ctx, 3, StatusInProcess)
+	assert.Equal(t, ErrInvalidStatusToEdit.Error(), err.Error())
+	err = travelStorage.Delete(ctx, 3)
+	assert.Equal(t, ErrInvalidStatusToDelete.Error(), err.Error())
+
+	// the travels behind a dequeued travel move forward
+	dequeued, err := travelStorage.Dequeue(ctx, 2)
+	assert.Nil(t, err)
+	assert.Equal(t, Travel{ID: 2, Status: StatusPending}, dequeued)
+
+	queue, err := travelStorage.Queue(ctx, 5)
+	assert.Nil(t, err)
+	if assert.Len(t, queue, 2) {
+		assert.Equal(t, int64(3), queue[0].ID)
+		assert.Equal(t, 1, *queue[0].QueuePosition)
+		assert.Equal(t, int64(4), queue[1].ID)
+		assert.Equal(t, 2, *queue[1].QueuePosition)
+	}
+
+	_, err = travelStorage.Dequeue(ctx, 2)
+	assert.Equal(t, ErrInvalidStatusToDequeue.Error(), err.Error())
+
+	// completing the in process travel promotes the first queued one
+	_, err = travelStorage.UpdateStatus(ctx, 1, StatusReady)
+	assert.Nil(t, err)
+
+	assert.Equal(t, Status(StatusInProcess), db.travels[3].Status)
+	assert.Nil(t, db.travels[3].QueuePosition)
+	assert.NotNil(t, db.travels[3].StartedAt)
+	if assert.NotNil(t, db.travels[4].QueuePosition) {
+		assert.Equal(t, 1, *db.travels[4].QueuePosition)
+	}
+
+	promoted := eventsOfType(db.events, EventPromoted)
+	if assert.Len(t, promoted, 1) {
+		assert.Equal(t, int64(3), promoted[0].TravelID)
+		assert.Equal(t, "1", promoted[0].Detail)
+	}
+
+	// cancelling the in process travel also promotes the next one
+	_, err = travelStorage.UpdateStatus(ctx, 3, StatusCancelled)
+	assert.Nil(t, err)
+
+	assert.Equal(t, Status(StatusInProcess), db.travels[4].Status)
+	assert.Nil(t, db.travels[4].QueuePosition)
+	assert.NotNil(t, db.travels[4].StartedAt)
+
+	queue, err = travelStorage.Queue(ctx, 5)
+	assert.Nil(t, err)
+	assert.Empty(t, queue)
+}
+
+func Test_expireTravelOffers(t *testing.T) {
+	inAMinute := time.Now().UTC().Add(time.Minute)
+	aMinuteAgo := time.Now().UTC().Add(-time.Minute)
+	db := newMockDBFromMap(map[int64]Travel{
+		1: {ID: 1, Status: StatusOffered, UserID: 5, OfferExpiresAt: &aMinuteAgo},
+		2: {ID: 2, Status: StatusOffered, UserID: 6, OfferExpiresAt: &inAMinute},
+		3: {ID: 3, Status: StatusPending},
+	})
+
+	travelStorage := NewTravelStorage(db)
+	ids, err := travelStorage.ExpireOffers(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1}, ids)
+	assert.Equal(t, Travel{ID: 1, Status: StatusPending}, db.travels[1])
+	assert.Equal(t, Status(StatusOffered), db.travels[2].Status)
+
+	events := eventsOfType(db.events, EventOfferExpired)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, int64(1), events[0].TravelID)
+		assert.Equal(t, "5", events[0].Detail)
+	}
+}
+
+func Test_travelOfferTimeout(t *testing.T) {
+	now := clock.NewFake(time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC))
+	db := newMockDBFromMap(map[int64]Travel{
+		1: {ID: 1, Status: StatusPending},
+		2: {ID: 2, Status: StatusPending},
+	})
+	travelStorage := NewTravelStorage(db, WithOfferTimeout(time.Minute), WithClock(now))
+	ctx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 5, Role: "driver"})
+
+	_, err := travelStorage.Offer(ctx, 1, Offer{UserID: 5})
+	assert.Nil(t, err)
+
+	// the offer can be accepted until its timeout
+	now.Advance(59 * time.Second)
+	ids, err := travelStorage.ExpireOffers(ctx)
+	assert.Nil(t, err)
+	assert.Empty(t, ids)
+	accepted, err := travelStorage.Accept(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, Travel{ID: 1, Status: StatusPending, UserID: 5}, accepted)
+
+	_, err = travelStorage.Offer(ctx, 2, Offer{UserID: 6})
+	assert.Nil(t, err)
+
+	// once it times out it cannot be accepted, and the expiration job sends it back to pending
+	now.Advance(time.Minute + time.Second)
+	_, err = travelStorage.Accept(context.WithValue(ctx, "user_on_call", jwt.Claims{UserID: 6, Role: "driver"}), 2)
+	assert.Equal(t, ErrOfferExpired, err)
+	ids, err = travelStorage.ExpireOffers(ctx)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2}, ids)
+	assert.Equal(t, Travel{ID: 2, Status: StatusPending}, db.travels[2])
+}
+
+func Test_travelDeadline(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	tomorrow := now.Add(24 * time.Hour)
+	yesterday := now.Add(-24 * time.Hour)
+	newTravel := func(deadline *time.Time) Travel {
+		return Travel{
+			ID:       1,
+			Status:   StatusPending,
+			From:     Point{Lat: -1, Lng: -10},
+			To:       Point{Lat: 2, Lng: 20},
+			Deadline: deadline,
+		}
+	}
+
+	tests := map[string]struct {
+		current  *Travel
+		trv      Travel
+		want     *time.Time
+		expected error
+	}{
+		"successful travel save with deadline": {
+			trv:  newTravel(&tomorrow),
+			want: &tomorrow,
+		},
+
+		"error on travel save: past deadline": {
+			trv:      newTravel(&yesterday),
+			expected: ErrInvalidDeadline,
+		},
+
+		"successful travel update: keep deadline when it is not received": {
+			current: &Travel{ID: 1, Status: StatusPending, Deadline: &yesterday},
+			trv:     newTravel(nil),
+			want:    &yesterday,
+		},
+
+		"successful travel update: receive the current deadline even if it passed": {
+			current: &Travel{ID: 1, Status: StatusPending, Deadline: &yesterday},
+			trv:     newTravel(&yesterday),
+			want:    &yesterday,
+		},
+
+		"successful travel update: change deadline": {
+			current: &Travel{ID: 1, Status: StatusPending, Deadline: &yesterday},
+			trv:     newTravel(&tomorrow),
+			want:    &tomorrow,
+		},
+
+		"error on travel update: past deadline": {
+			current:  &Travel{ID: 1, Status: StatusPending},
+			trv:      newTravel(&yesterday),
+			expected: ErrInvalidDeadline,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: "admin"})
+
+			var result Travel
+			var err error
+			if tc.current == nil {
+				result, err = NewTravelStorage(newMockDB()).Save(ctx, tc.trv)
+			} else {
+				db := newMockDBFromMap(map[int64]Travel{1: *tc.current})
+				result, err = NewTravelStorage(db).Update(ctx, tc.trv)
+			}
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result.Deadline)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_travelPriority(t *testing.T) {
+	newTravel := func(priority Priority) Travel {
+		return Travel{
+			ID:       1,
+			Status:   StatusPending,
+			From:     Point{Lat: -1, Lng: -10},
+			To:       Point{Lat: 2, Lng: 20},
+			Priority: priority,
+		}
+	}
+
+	tests := map[string]struct {
+		current  *Travel
+		trv      Travel
+		role     string
+		want     Priority
+		expected error
+	}{
+		"successful travel save: normal priority by default": {
+			trv:  newTravel(""),
+			want: PriorityNormal,
+		},
+
+		"successful travel save with priority": {
+			trv:  newTravel(" High "),
+			want: PriorityHigh,
+		},
+
+		"error on travel save: invalid priority": {
+			trv:      newTravel("urgent"),
+			expected: ErrInvalidPriority,
+		},
+
+		"successful travel update: keep priority when it is not received": {
+			current: &Travel{ID: 1, Status: StatusPending, Priority: PriorityLow},
+			trv:     newTravel(""),
+			want:    PriorityLow,
+		},
+
+		"successful travel update: change priority": {
+			current: &Travel{ID: 1, Status: StatusPending, Priority: PriorityLow},
+			trv:     newTravel(PriorityHigh),
+			want:    PriorityHigh,
+		},
+
+		"successful travel update: a driver receives the current priority": {
+			current: &Travel{ID: 1, Status: StatusPending, UserID: 1, Priority: PriorityLow},
+			trv:     Travel{ID: 1, Status: StatusPending, UserID: 1, Priority: PriorityLow},
+			role:    "driver",
+			want:    PriorityLow,
+		},
+
+		"error on travel update: a driver cannot change priority": {
+			current:  &Travel{ID: 1, Status: StatusPending, UserID: 1, Priority: PriorityLow},
+			trv:      Travel{ID: 1, Status: StatusPending, UserID: 1, Priority: PriorityHigh},
+			role:     "driver",
+			expected: ErrInvalidUserAccess,
+		},
+
+		"error on travel update: invalid priority": {
+			current:  &Travel{ID: 1, Status: StatusPending},
+			trv:      newTravel("urgent"),
+			expected: ErrInvalidPriority,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			role := tc.role
+			if role == "" {
+				role = "admin"
+			}
+			ctx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: role})
+
+			var result Travel
+			var err error
+			if tc.current == nil {
+				result, err = NewTravelStorage(newMockDB()).Save(ctx, tc.trv)
+			} else {
+				db := newMockDBFromMap(map[int64]Travel{1: *tc.current})
+				result, err = NewTravelStorage(db).Update(ctx, tc.trv)
+			}
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result.Priority)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_searchTravelsByPriority(t *testing.T) {
+	now := time.Now().UTC().Truncate(time.Second)
+	db := newMockDBFromMap(map[int64]Travel{
+		1: {ID: 1, Status: StatusPending, Priority: PriorityLow, CreatedAt: now.Add(-3 * time.Hour)},
+		2: {ID: 2, Status: StatusPending, Priority: PriorityNormal, CreatedAt: now.Add(-1 * time.Hour)},
+		3: {ID: 3, Status: StatusPending, Priority: PriorityHigh, CreatedAt: now},
+		4: {ID: 4, Status: StatusPending, Priority: PriorityNormal, CreatedAt: now.Add(-2 * time.Hour)},
+		5: {ID: 5, Status: StatusInProcess, Priority: PriorityHigh, CreatedAt: now, UserID: 1},
+	})
+
+	travels, _, err := NewTravelStorage(db).Search(context.Background(), WithStatus(StatusPending), WithPriorityOrder())
+
+	assert.Nil(t, err)
+	var ids []int64
+	for _, trv := range travels {
+		ids = append(ids, trv.ID)
+	}
+	assert.Equal(t, []int64{3, 4, 2, 1}, ids)
+}
+
+func Test_checkOverdueTravels(t *testing.T) {
+	inAnHour := time.Now().UTC().Add(time.Hour)
+	anHourAgo := time.Now().UTC().Add(-time.Hour)
+	db := newMockDBFromMap(map[int64]Travel{
+		1: {ID: 1, Status: StatusInProcess, UserID: 5, Deadline: &anHourAgo},
+		2: {ID: 2, Status: StatusInProcess, UserID: 6, Deadline: &inAnHour},
+		3: {ID: 3, Status: StatusReady, UserID: 7, Deadline: &anHourAgo},
+		4: {ID: 4, Status: StatusInProcess, UserID: 8},
+	})
+
+	travelStorage := NewTravelStorage(db)
+	ids, err := travelStorage.CheckOverdue(context.Background())
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1}, ids)
+
+	events := eventsOfType(db.events, EventOverdue)
+	if assert.Len(t, events, 1) {
+		assert.Equal(t, int64(1), events[0].TravelID)
+		assert.Equal(t, anHourAgo.Format(time.RFC3339), events[0].Detail)
+	}
+
+	// a travel is only reported once
+	ids, err = travelStorage.CheckOverdue(context.Background())
+
+	assert.Nil(t, err)
+	assert.Empty(t, ids)
+	assert.Len(t, eventsOfType(db.events, EventOverdue), 1)
+}
+
+func Test_archiveTravels(t *testing.T) {
+	old := time.Now().UTC().Add(-48 * time.Hour)
+	recent := time.Now().UTC()
+	db := newMockDBFromMap(map[int64]Travel{
+		1: {ID: 1, Status: StatusReady, CreatedAt: old},
+		2: {ID: 2, Status: StatusCancelled, CreatedAt: old},
+		3: {ID: 3, Status: StatusReady, CreatedAt: recent},
+		4: {ID: 4, Status: StatusInProcess, CreatedAt: old},
+	})
+
+	travelStorage := NewTravelStorage(db)
+	ids, err := travelStorage.Archive(context.Background(), 24*time.Hour)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{1, 2}, ids)
+	assert.Len(t, db.travels, 2)
+	assert.Len(t, db.archived, 2)
+
+	// archived travels are still found by id
+	result, err := travelStorage.Get(context.Background(), 1)
+
+	assert.Nil(t, err)
+	assert.Equal(t, Travel{ID: 1, Status: StatusReady, CreatedAt: old}, result)
+
+	_, err = NewTravelStorage(newMockDB().onExpire(errors.New("mocked archive error"))).
+		Archive(context.Background(), 24*time.Hour)
+
+	assert.NotNil(t, err)
+	assert.Equal(t, ErrStorageUpdate.Error(), err.Error())
+}
+
+// mockFileStore an attachments store keeping the files on memory
+type mockFileStore struct {
+	files map[string][]byte
+	err   error
+}
+
+func (store *mockFileStore) Put(ctx context.Context, key string, content []byte, contentType string) error {
+	if store.err != nil {
+		return store.err
+	}
+
+	store.files[key] = content
+
+	return nil
+}
+
+func Test_attachTravel(t *testing.T) {
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 100)...)
+	newDB := func() *mockDb {
+		return newMockDBFromMap(map[int64]Travel{
+			1: {ID: 1, Status: StatusInProcess, UserID: 5},
+			2: {ID: 2, Status: StatusReady, UserID: 5},
+			3: {ID: 3, Status: StatusPending, UserID: 5},
+		})
+	}
+	driver := &jwt.Claims{UserID: 5, Role: "driver"}
+
+	tests := map[string]struct {
+		db         *mockDb
+		store      *mockFileStore
+		id         int64
+		kind       AttachmentKind
+		content    []byte
+		userLogged *jwt.Claims
+		expected   error
+	}{
+		"successful attach photo by the travel driver": {
+			db:         newDB(),
+			store:      &mockFileStore{files: map[string][]byte{}},
+			id:         1,
+			kind:       AttachmentPhoto,
+			content:    png,
+			userLogged: driver,
+		},
+
+		"successful attach signature on ready travel by admin": {
+			db:         newDB(),
+			store:      &mockFileStore{files: map[string][]byte{}},
+			id:         2,
+			kind:       AttachmentSignature,
+			content:    png,
+			userLogged: &jwt.Claims{UserID: 1, Role: "admin"},
+		},
+
+		"error on attach: invalid kind": {
+			db:         newDB(),
+			store:      &mockFileStore{files: map[string][]byte{}},
+			id:         1,
+			kind:       "video",
+			content:    png,
+			userLogged: driver,
+			expected:   ErrInvalidAttachmentKind,
+		},
+
+		"error on attach: not an image": {
+			db:         newDB(),
+			store:      &mockFileStore{files: map[string][]byte{}},
+			id:         1,
+			kind:       AttachmentPhoto,
+			content:    []byte("a text file"),
+			userLogged: driver,
+			expected:   ErrInvalidAttachmentFile,
+		},
+
+		"error on attach: too big file": {
+			db:         newDB(),
+			store:      &mockFileStore{files: map[string][]byte{}},
+			id:         1,
+			kind:       AttachmentPhoto,
+			content:    append(png, make([]byte, MaxAttachmentSize)...),
+			userLogged: driver,
+			expected:   ErrInvalidAttachmentFile,
+		},
+
+		"error on attach: pending travel": {
+			db:         newDB(),
+			store:      &mockFileStore{files: map[string][]byte{}},
+			id:         3,
+			kind:       AttachmentPhoto,
+			content:    png,
+			userLogged: driver,
+			expected:   ErrInvalidStatusToAttach,
+		},
+
+		"error on attach: another driver": {
+			db:         newDB(),
+			store:      &mockFileStore{files: map[string][]byte{}},
+			id:         1,
+			kind:       AttachmentPhoto,
+			content:    png,
+			userLogged: &jwt.Claims{UserID: 6, Role: "driver"},
+			expected:   ErrInvalidUserAccess,
+		},
+
+		"error on attach: non user logged in": {
+			db:       newDB(),
+			store:    &mockFileStore{files: map[string][]byte{}},
+			id:       1,
+			kind:     AttachmentPhoto,
+			content:  png,
+			expected: ErrInvalidUserClaims,
+		},
+
+		"store failure on attach": {
+			db:         newDB(),
+			store:      &mockFileStore{files: map[string][]byte{}, err: errors.New("mocked store error")},
+			id:         1,
+			kind:       AttachmentPhoto,
+			content:    png,
+			userLogged: driver,
+			expected:   ErrStorageSaveAttachment,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db, WithAttachmentStore(tc.store))
+			ctx := context.Background()
+			if tc.userLogged != nil {
+				ctx = context.WithValue(ctx, "user_on_call", *tc.userLogged)
+			}
+			result, err := travelStorage.Attach(ctx, tc.id, tc.kind, tc.content)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, int64(1), result.ID)
+				assert.Equal(t, tc.id, result.TravelID)
+				assert.Equal(t, tc.userLogged.UserID, result.UserID)
+				assert.Equal(t, tc.kind, result.Kind)
+				assert.Equal(t, "image/png", result.ContentType)
+				assert.Equal(t, int64(len(tc.content)), result.Size)
+				assert.Equal(t, tc.content, tc.store.files[result.Key])
+
+				// the attachment metadata is returned with the travel
+				trv, err := travelStorage.Get(ctx, tc.id)
+				assert.Nil(t, err)
+				assert.Equal(t, []Attachment{result}, trv.Attachments)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				assert.Empty(t, tc.store.files)
+			}
+		})
+	}
+}
+
+func Test_reportTravelLocation(t *testing.T) {
+	newDB := func() *mockDb {
+		return newMockDBFromMap(map[int64]Travel{
+			1: {ID: 1, Status: StatusInProcess, UserID: 5},
+			2: {ID: 2, Status: StatusReady, UserID: 5},
+		})
+	}
+	driver := &jwt.Claims{UserID: 5, Role: "driver"}
+	recordedAt := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		db         *mockDb
+		id         int64
+		point      TracePoint
+		userLogged *jwt.Claims
+		want       TracePoint
+		expected   error
+	}{
+		"successful report location": {
+			db:         newDB(),
+			id:         1,
+			point:      TracePoint{Location: Point{Lat: -34.6, Lng: -58.4}, RecordedAt: recordedAt},
+			userLogged: driver,
+			want: TracePoint{ID: 1, TravelID: 1, UserID: 5, Location: Point{Lat: -34.6, Lng: -58.4},
+				RecordedAt: recordedAt},
+		},
+
+		"error on report location: invalid coordinates": {
+			db:         newDB(),
+			id:         1,
+			point:      TracePoint{Location: Point{Lat: -134.6, Lng: -58.4}},
+			userLogged: driver,
+			expected:   ErrInvalidCoordinates,
+		},
+
+		"error on report location: future date": {
+			db:         newDB(),
+			id:         1,
+			point:      TracePoint{Location: Point{Lat: -34.6, Lng: -58.4}, RecordedAt: time.Now().Add(time.Hour)},
+			userLogged: driver,
+			expected:   ErrInvalidTraceDate,
+		},
+
+		"error on report location: travel not in process": {
+			db:         newDB(),
+			id:         2,
+			point:      TracePoint{Location: Point{Lat: -34.6, Lng: -58.4}},
+			userLogged: driver,
+			expected:   ErrInvalidStatusToTrace,
+		},
+
+		"error on report location: another driver": {
+			db:         newDB(),
+			id:         1,
+			point:      TracePoint{Location: Point{Lat: -34.6, Lng: -58.4}},
+			userLogged: &jwt.Claims{UserID: 6, Role: "driver"},
+			expected:   ErrInvalidUserAccess,
+		},
+
+		"error on report location: non user logged in": {
+			db:       newDB(),
+			id:       1,
+			point:    TracePoint{Location: Point{Lat: -34.6, Lng: -58.4}},
+			expected: ErrInvalidUserClaims,
+		},
+
+		"db failure on report location": {
+			db:         newDB().onCreate(errors.New("mocked save error")),
+			id:         1,
+			point:      TracePoint{Location: Point{Lat: -34.6, Lng: -58.4}},
+			userLogged: driver,
+			expected:   ErrStorageSaveLocation,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			ctx := context.Background()
+			if tc.userLogged != nil {
+				ctx = context.WithValue(ctx, "user_on_call", *tc.userLogged)
+			}
+			result, err := travelStorage.ReportLocation(ctx, tc.id, tc.point)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				assert.Empty(t, tc.db.trace)
+			}
+		})
+	}
+}
+
+func Test_travelTrace(t *testing.T) {
+	first := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	db := newMockDBFromMap(map[int64]Travel{1: {ID: 1, Status: StatusReady, UserID: 5}})
+	db.trace = []TracePoint{
+		{ID: 1, TravelID: 1, UserID: 5, Location: Point{Lat: -34.61, Lng: -58.41}, RecordedAt: first.Add(time.Minute)},
+		{ID: 2, TravelID: 2, UserID: 6, Location: Point{Lat: -34.7, Lng: -58.5}, RecordedAt: first},
+		{ID: 3, TravelID: 1, UserID: 5, Location: Point{Lat: -34.6, Lng: -58.4}, RecordedAt: first},
+	}
+
+	travelStorage := NewTravelStorage(db)
+	trace, err := travelStorage.Trace(context.Background(), 1)
+
+	assert.Nil(t, err)
+	assert.Equal(t, []TracePoint{db.trace[2], db.trace[0]}, trace)
+
+	_, err = travelStorage.Trace(context.Background(), 3)
+
+	assert.NotNil(t, err)
+}
+
+func Test_travelTracking(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	first := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	db := newMockDBFromMap(map[int64]Travel{
+		1: {ID: 1, UUID: "a-uuid", Status: StatusInProcess, UserID: 5, From: Point{Lat: -34.6, Lng: -58.4},
+			To: Point{Lat: -34.5, Lng: -58.3}},
+		2: {ID: 2, Status: StatusReady, UserID: 5},
+	})
+	db.trace = []TracePoint{
+		{ID: 1, TravelID: 1, UserID: 5, Location: Point{Lat: -34.61, Lng: -58.41}, RecordedAt: first.Add(time.Minute)},
+		{ID: 2, TravelID: 1, UserID: 5, Location: Point{Lat: -34.6, Lng: -58.4}, RecordedAt: first},
+	}
+	db.getError[3] = ErrTravelNotFound
+	ctx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: "admin"})
+
+	travelStorage := NewTravelStorage(db, WithTracking("https://track.space-drivers.com/", time.Hour))
+
+	t.Run("successful tracking", func(t *testing.T) {
+		link, err := travelStorage.ShareTracking(ctx, 1)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, link.Token)
+		assert.Equal(t, "https://track.space-drivers.com/"+link.Token, link.Link)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), link.ExpiresAt, 2*time.Second)
+
+		view, err := travelStorage.Track(context.Background(), link.Token)
+		assert.Nil(t, err)
+		assert.Equal(t, "a-uuid", view.UUID)
+		assert.Equal(t, Status(StatusInProcess), view.Status)
+		assert.Equal(t, db.trace[0].Location, *view.Location)
+		assert.Equal(t, db.trace[0].RecordedAt, *view.LocationAt)
+		assert.Equal(t, link.ExpiresAt, view.ExpiresAt)
+	})
+
+	t.Run("successful tracking expired with the clock of the travels", func(t *testing.T) {
+		now := clock.NewFake(time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC))
+		previous := jwt.Clock
+		jwt.Clock = now
+		defer func() { jwt.Clock = previous }()
+
+		travelStorage := NewTravelStorage(db, WithTracking("", time.Hour), WithClock(now))
+		link, err := travelStorage.ShareTracking(ctx, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, now.Now().Add(time.Hour), link.ExpiresAt)
+
+		view, err := travelStorage.Track(context.Background(), link.Token)
+		assert.Nil(t, err)
+		assert.Equal(t, link.ExpiresAt, view.ExpiresAt)
+
+		now.Advance(2 * time.Hour)
+		_, err = travelStorage.Track(context.Background(), link.Token)
+		assert.Equal(t, ErrInvalidTracking, err)
+	})
+
+	t.Run("the location is not shown once the travel is not in process", func(t *testing.T) {
+		link, err := travelStorage.ShareTracking(ctx, 1)
+		assert.Nil(t, err)
+
+		db.travels[1] = Travel{ID: 1, UUID: "a-uuid", Status: StatusReady, UserID: 5}
+		defer func() {
+			db.travels[1] = Travel{ID: 1, UUID: "a-uuid", Status: StatusInProcess, UserID: 5}
+		}()
+
+		view, err := travelStorage.Track(context.Background(), link.Token)
+		assert.Nil(t, err)
+		assert.Equal(t, Status(StatusReady), view.Status)
+		assert.Nil(t, view.Location)
+	})
+
+	shareFailures := map[string]struct {
+		ctx      context.Context
+		id       int64
+		expected error
+	}{
+		"failure share tracking: ready travel":        {ctx: ctx, id: 2, expected: ErrInvalidStatusToTrack},
+		"failure share tracking: not founded travel":  {ctx: ctx, id: 3, expected: ErrNotFoundTravel},
+		"failure share tracking: without user logged": {ctx: context.Background(), id: 1, expected: ErrInvalidUserClaims},
+	}
+
+	for name, tt := range shareFailures {
+		t.Run(name, func(t *testing.T) {
+			_, err := travelStorage.ShareTracking(tt.ctx, tt.id)
+			assert.NotNil(t, err)
+			assert.Equal(t, tt.expected.Error(), err.Error())
+		})
+	}
+
+	userToken, err := jwt.GenerateToken(1, "admin@hotmail.com", "admin", nil)
+	assert.Nil(t, err)
+	expired, err := jwt.GenerateTracking(1, time.Now().Add(-time.Hour))
+	assert.Nil(t, err)
+
+	trackFailures := map[string]string{
+		"failure track: invalid token":        "an invalid token",
+		"failure track: expired token":        expired,
+		"failure track: not a tracking token": userToken,
+	}
+
+	for name, token := range trackFailures {
+		t.Run(name, func(t *testing.T) {
+			_, err := travelStorage.Track(context.Background(), token)
+			assert.NotNil(t, err)
+			assert.Equal(t, ErrInvalidTracking.Error(), err.Error())
+		})
+	}
+}
+
+// mockZoneChecker cover the locations with positive latitude, where only the drivers received are eligible, or
+// fail with the received error
+type mockZoneChecker struct {
+	drivers []int64
+	err     error
+}
+
+func (checker mockZoneChecker) Covers(ctx context.Context, point Point) (bool, error) {
+	if checker.err != nil {
+		return false, checker.err
+	}
+
+	return point.Lat > 0, nil
+}
+
+func (checker mockZoneChecker) Locate(ctx context.Context, point Point) (int64, error) {
+	if checker.err != nil {
+		return 0, checker.err
+	}
+
+	if point.Lat <= 0 {
+		return 0, nil
+	}
+
+	return 1, nil
+}
+
+func (checker mockZoneChecker) Eligible(ctx context.Context, point Point, userID int64) (bool, error) {
+	if checker.err != nil {
+		return false, checker.err
+	}
+
+	if point.Lat <= 0 {
+		return true, nil
+	}
+
+	for _, driver := range checker.drivers {
+		if driver == userID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func Test_createTravelInZones(t *testing.T) {
+	inside := Point{Lat: 1, Lng: 10}
+	outside := Point{Lat: -1, Lng: -10}
+
 	tests := map[string]struct {
-		db         repository
-		userLogged *jwt.Claims
-		trv        Travel
-		expected   error
+		checker      mockZoneChecker
+		policy       ZonePolicy
+		trv          Travel
+		outsideZones bool
+		expected     error
 	}{
-		"successful travel update: change locations in pending": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusPending, 0)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -120,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 22,
-					Lng: 20,
-				},
-				Status: StatusPending,
+		"successful travel save inside zones": {
+			policy: ZonePolicyReject,
+			trv:    Travel{Status: StatusPending, From: inside, To: inside},
+		},
+
+		"successful travel save flagged outside zones": {
+			policy:       ZonePolicyFlag,
+			trv:          Travel{Status: StatusPending, From: inside, To: outside},
+			outsideZones: true,
+		},
+
+		"error on travel save: rejected outside zones": {
+			policy:   ZonePolicyReject,
+			trv:      Travel{Status: StatusPending, From: outside, To: inside},
+			expected: ErrOutsideZones,
+		},
+
+		"error on travel save: zones check failure": {
+			checker:  mockZoneChecker{err: errors.New("mocked zones error")},
+			policy:   ZonePolicyFlag,
+			trv:      Travel{Status: StatusPending, From: inside, To: inside},
+			expected: ErrStorageSave,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := newMockDB()
+			travelStorage := NewTravelStorage(db, WithZoneChecker(tc.checker, tc.policy))
+			result, err := travelStorage.Save(context.Background(), tc.trv)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.outsideZones, result.OutsideZones)
+				assert.Equal(t, tc.outsideZones, db.travels[result.ID].OutsideZones)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				assert.Empty(t, db.travels)
+			}
+		})
+	}
+}
+
+func Test_travelDriverZone(t *testing.T) {
+	inside := Point{Lat: 1, Lng: 10}
+	outside := Point{Lat: -1, Lng: -10}
+	checker := mockZoneChecker{drivers: []int64{5}}
+
+	tests := map[string]struct {
+		travel   Travel
+		assign   func(travelStorage TravelStorage, ctx context.Context) (Travel, error)
+		expected error
+	}{
+		"successful offer to driver of the zone": {
+			travel: Travel{ID: 1, Status: StatusPending, From: inside, To: inside},
+			assign: func(travelStorage TravelStorage, ctx context.Context) (Travel, error) {
+				return travelStorage.Offer(ctx, 1, Offer{UserID: 5})
 			},
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+		},
+
+		"error on offer: driver of another zone": {
+			travel: Travel{ID: 1, Status: StatusPending, From: inside, To: inside},
+			assign: func(travelStorage TravelStorage, ctx context.Context) (Travel, error) {
+				return travelStorage.Offer(ctx, 1, Offer{UserID: 6})
 			},
+			expected: ErrDriverNotEligible,
 		},
 
-		"successful travel update: change user id in pending status by admin": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusPending, 0)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusPending,
-				UserID: 1234,
+		"successful offer outside zones to any driver": {
+			travel: Travel{ID: 1, Status: StatusPending, From: outside, To: inside},
+			assign: func(travelStorage TravelStorage, ctx context.Context) (Travel, error) {
+				return travelStorage.Offer(ctx, 1, Offer{UserID: 6})
 			},
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+		},
+
+		"error on reassign: driver of another zone": {
+			travel: Travel{ID: 1, Status: StatusInProcess, From: inside, To: inside, UserID: 5},
+			assign: func(travelStorage TravelStorage, ctx context.Context) (Travel, error) {
+				return travelStorage.Reassign(ctx, 1, Reassignment{UserID: 6, Reason: "the car broke down"})
 			},
+			expected: ErrDriverNotEligible,
 		},
 
-		"successful travel update: change user id assigned on travel in pending status by admin": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusPending, 2)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusPending,
-				UserID: 1234,
+		"successful reassign back to pending": {
+			travel: Travel{ID: 1, Status: StatusInProcess, From: inside, To: inside, UserID: 5},
+			assign: func(travelStorage TravelStorage, ctx context.Context) (Travel, error) {
+				return travelStorage.Reassign(ctx, 1, Reassignment{Reason: "the driver is sick"})
 			},
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+		},
+
+		"successful update assigning driver of the zone": {
+			travel: Travel{ID: 1, Status: StatusPending, From: inside, To: inside},
+			assign: func(travelStorage TravelStorage, ctx context.Context) (Travel, error) {
+				return travelStorage.Update(ctx, Travel{ID: 1, Status: StatusInProcess, From: inside, To: inside, UserID: 5})
 			},
 		},
 
-		"failure travel update: cannot change user id in pending status from a travel without user by driver": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusPending, 0)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusPending,
-				UserID: 1,
+		"error on update: assigning driver of another zone": {
+			travel: Travel{ID: 1, Status: StatusPending, From: inside, To: inside},
+			assign: func(travelStorage TravelStorage, ctx context.Context) (Travel, error) {
+				return travelStorage.Update(ctx, Travel{ID: 1, Status: StatusInProcess, From: inside, To: inside, UserID: 6})
 			},
-			expected: errors.New("invalid_user_access - the user logged in cannot perform this action, he is not the owner of the travel or it is not an admin"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "driver",
+			expected: ErrDriverNotEligible,
+		},
+
+		"error on save: driver of another zone": {
+			assign: func(travelStorage TravelStorage, ctx context.Context) (Travel, error) {
+				return travelStorage.Save(ctx, Travel{From: inside, To: inside, UserID: 6})
+			},
+			expected: ErrDriverNotEligible,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: "admin"})
+
+			db := newMockDB()
+			if tc.travel.ID != 0 {
+				db = newMockDBFromMap(map[int64]Travel{tc.travel.ID: tc.travel})
+			}
+
+			travelStorage := NewTravelStorage(db, WithZoneChecker(checker, ZonePolicyFlag))
+			_, err := tc.assign(travelStorage, ctx)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				if tc.travel.ID != 0 {
+					assert.Equal(t, tc.travel, db.travels[tc.travel.ID])
+				}
+			}
+		})
+	}
+}
+
+func Test_deleteTravel(t *testing.T) {
+	deletedAt := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		db       *mockDb
+		id       int64
+		expected error
+	}{
+		"successful delete pending travel": {
+			db: newMockDBFromMap(map[int64]Travel{1: Travel{ID: 1, Status: StatusPending}}),
+			id: 1,
+		},
+
+		"successful delete ready travel": {
+			db: newMockDBFromMap(map[int64]Travel{1: Travel{ID: 1, Status: StatusReady, UserID: 2}}),
+			id: 1,
+		},
+
+		"failure delete in process travel": {
+			db:       newMockDBFromMap(map[int64]Travel{1: Travel{ID: 1, Status: StatusInProcess, UserID: 2}}),
+			id:       1,
+			expected: ErrInvalidStatusToDelete,
+		},
+
+		"failure delete already deleted travel": {
+			db:       newMockDBFromMap(map[int64]Travel{1: Travel{ID: 1, Status: StatusPending, DeletedAt: &deletedAt}}),
+			id:       1,
+			expected: ErrNotFoundTravel,
+		},
+
+		"db failure delete travel": {
+			db: newMockDBFromMap(map[int64]Travel{1: Travel{ID: 1, Status: StatusPending}}).
+				onUpdate(1, errors.New("mocked db error")),
+			id:       1,
+			expected: ErrStorageUpdate,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			err := travelStorage.Delete(context.Background(), tc.id)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.NotNil(t, tc.db.travels[tc.id].DeletedAt)
+
+				// deleted travels are not found by default
+				_, err = travelStorage.Get(context.Background(), tc.id)
+				assert.Equal(t, ErrNotFoundTravel, err)
+
+				travel, err := travelStorage.GetIncludingDeleted(context.Background(), tc.id)
+				assert.Nil(t, err)
+				assert.Equal(t, tc.id, travel.ID)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_restoreTravel(t *testing.T) {
+	deletedAt := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+
+	tests := map[string]struct {
+		db       *mockDb
+		id       int64
+		expected error
+	}{
+		"successful restore travel": {
+			db: newMockDBFromMap(map[int64]Travel{1: Travel{ID: 1, Status: StatusReady, DeletedAt: &deletedAt}}),
+			id: 1,
+		},
+
+		"failure restore not deleted travel": {
+			db:       newMockDBFromMap(map[int64]Travel{1: Travel{ID: 1, Status: StatusPending}}),
+			id:       1,
+			expected: ErrNotDeletedTravel,
+		},
+
+		"failure restore travel of a busy user": {
+			db: newMockDBFromMap(map[int64]Travel{
+				1: Travel{ID: 1, Status: StatusPending, UserID: 2, DeletedAt: &deletedAt},
+				2: Travel{ID: 2, Status: StatusInProcess, UserID: 2},
+			}),
+			id:       1,
+			expected: ErrDriverAlreadyAssigned,
+		},
+
+		"db not found travel": {
+			db:       newMockDB().onGet(22, ErrTravelNotFound),
+			id:       22,
+			expected: ErrNotFoundTravel,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(tc.db)
+			result, err := travelStorage.Restore(context.Background(), tc.id)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Nil(t, result.DeletedAt)
+				assert.Nil(t, tc.db.travels[tc.id].DeletedAt)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func hasTag(travel Travel, tag string) bool {
+	for _, t := range travel.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// mockVehicleFinder return the vehicles of the drivers on its map
+type mockVehicleFinder struct {
+	vehicles map[int64]vehicle.Vehicle
+	err      error
+}
+
+func (finder mockVehicleFinder) ByDrivers(ctx context.Context, userIDs ...int64) (map[int64]vehicle.Vehicle, error) {
+	if finder.err != nil {
+		return nil, finder.err
+	}
+
+	vehicles := make(map[int64]vehicle.Vehicle)
+	for _, userID := range userIDs {
+		if v, ok := finder.vehicles[userID]; ok {
+			vehicles[userID] = v
+		}
+	}
+
+	return vehicles, nil
+}
+
+func Test_travelVehicle(t *testing.T) {
+	driverID := int64(5)
+	finder := mockVehicleFinder{
+		vehicles: map[int64]vehicle.Vehicle{
+			5: {ID: 1, Plate: "AB123CD", Capacity: 4, Class: vehicle.ClassEconomy, UserID: &driverID},
+		},
+	}
+
+	db := newMockDBFromMap(map[int64]Travel{
+		1: {ID: 1, Status: StatusInProcess, UserID: 5},
+		2: {ID: 2, Status: StatusInProcess, UserID: 6},
+		3: {ID: 3, Status: StatusPending},
+	})
+
+	tests := map[string]struct {
+		finder      VehicleFinder
+		id          int64
+		wantVehicle *vehicle.Vehicle
+		expected    error
+	}{
+		"travel with driver vehicle": {
+			finder: finder,
+			id:     1,
+			wantVehicle: &vehicle.Vehicle{
+				ID: 1, Plate: "AB123CD", Capacity: 4, Class: vehicle.ClassEconomy, UserID: &driverID,
 			},
 		},
 
-		"failure travel update: cannot change user id in pending status even if the user logged in is the owner": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusPending, 1)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusPending,
-				UserID: 2,
-			},
-			expected: errors.New("invalid_user_access - the user logged in cannot perform this action, he is not the owner of the travel or it is not an admin"),
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "driver",
-			},
+		"travel with driver without vehicle": {
+			finder: finder,
+			id:     2,
+		},
+
+		"travel without driver": {
+			finder: finder,
+			id:     3,
+		},
+
+		"failure getting vehicle": {
+			finder:   mockVehicleFinder{err: errors.New("mocked vehicle error")},
+			id:       1,
+			expected: ErrStorageGet,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			travelStorage := NewTravelStorage(db, WithVehicleFinder(tc.finder))
+			result, err := travelStorage.Get(context.Background(), tc.id)
+
+			if tc.expected != nil {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantVehicle, result.Vehicle)
+		})
+	}
+}
+
+// mockTeams are the members of the teams on the mocked travel searches: the users 5 and 6 are members of the team
+// 1, and the user 7 of the team 2
+var mockTeams = map[int64][]int64{1: {5, 6}, 2: {7}}
+
+// mockTeamMember return if the user is a member of any of the teams
+func mockTeamMember(userID int64, teamIDs ...int64) bool {
+	for _, teamID := range teamIDs {
+		for _, member := range mockTeams[teamID] {
+			if member == userID {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// mockTeamFinder return the teams of the users on its map
+type mockTeamFinder struct {
+	teams map[int64][]int64
+	err   error
+}
+
+func (finder mockTeamFinder) UserTeams(ctx context.Context, userID int64) ([]int64, error) {
+	if finder.err != nil {
+		return nil, finder.err
+	}
+
+	return finder.teams[userID], nil
+}
+
+func Test_searchTravelsByTeam(t *testing.T) {
+	db := newMockDBFromMap(map[int64]Travel{
+		1: {ID: 1, Status: StatusInProcess, UserID: 5},
+		2: {ID: 2, Status: StatusInProcess, UserID: 6},
+		3: {ID: 3, Status: StatusInProcess, UserID: 7},
+		4: {ID: 4, Status: StatusPending},
+	})
+	// the dispatcher 10 is a member of the team 1, the dispatcher 11 has no team
+	finder := mockTeamFinder{teams: map[int64][]int64{10: {1}}}
+
+	tests := map[string]struct {
+		finder   TeamFinder
+		claims   *jwt.Claims
+		options  []SearchOption
+		want     []int64
+		expected error
+	}{
+		"search by team": {
+			options: []SearchOption{WithTeam(1)},
+			want:    []int64{1, 2},
+		},
+
+		"dispatcher member of a team find the travels of the team and without driver": {
+			finder: finder,
+			claims: &jwt.Claims{UserID: 10, Role: "dispatcher"},
+			want:   []int64{1, 2, 4},
+		},
+
+		"dispatcher member of a team search by another team": {
+			finder:  finder,
+			claims:  &jwt.Claims{UserID: 10, Role: "dispatcher"},
+			options: []SearchOption{WithTeam(2)},
+			want:    nil,
+		},
+
+		"dispatcher without team find every travel": {
+			finder: finder,
+			claims: &jwt.Claims{UserID: 11, Role: "dispatcher"},
+			want:   []int64{1, 2, 3, 4},
+		},
+
+		"admin is not scoped by its teams": {
+			finder: mockTeamFinder{teams: map[int64][]int64{1: {2}}},
+			claims: &jwt.Claims{UserID: 1, Role: "admin"},
+			want:   []int64{1, 2, 3, 4},
+		},
+
+		"failure getting dispatcher teams": {
+			finder:   mockTeamFinder{err: errors.New("mocked team error")},
+			claims:   &jwt.Claims{UserID: 10, Role: "dispatcher"},
+			expected: ErrStorageGet,
 		},
+	}
 
-		"failure travel update: not user logged in": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusPending, 0)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusPending,
-				UserID: 1234,
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			var opts []TravelStorageOption
+			if tc.finder != nil {
+				opts = append(opts, WithTeamFinder(tc.finder))
+			}
+			travelStorage := NewTravelStorage(db, opts...)
+
+			ctx := context.Background()
+			if tc.claims != nil {
+				ctx = context.WithValue(ctx, "user_on_call", *tc.claims)
+			}
+			result, _, err := travelStorage.Search(ctx, tc.options...)
+
+			if tc.expected != nil {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				return
+			}
+
+			assert.Nil(t, err)
+			var ids []int64
+			for _, travel := range result {
+				ids = append(ids, travel.ID)
+			}
+			assert.Equal(t, tc.want, ids)
+		})
+	}
+}
+
+func Test_travelByTeam(t *testing.T) {
+	newDb := func() *mockDb {
+		return newMockDBFromMap(map[int64]Travel{
+			1: {ID: 1, Status: StatusInProcess, UserID: 5, From: Point{Lat: -10, Lng: 70}, To: Point{Lat: 2, Lng: 20}},
+			3: {ID: 3, Status: StatusInProcess, UserID: 7, From: Point{Lat: -10, Lng: 70}, To: Point{Lat: 2, Lng: 20}},
+			4: {ID: 4, Status: StatusPending, From: Point{Lat: -10, Lng: 70}, To: Point{Lat: 2, Lng: 20}},
+			5: {ID: 5, Status: StatusQueued, UserID: 7},
+		})
+	}
+	// the dispatcher 10 and the drivers 5 and 6 are members of the team 1, the driver 7 of the team 2
+	finder := mockTeamFinder{teams: map[int64][]int64{10: {1}, 5: {1}, 6: {1}, 7: {2}}}
+	dispatcher := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 10, Role: "dispatcher"})
+	admin := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: "admin"})
+
+	tests := map[string]struct {
+		ctx      context.Context
+		finder   TeamFinder
+		action   func(ctx context.Context, travelStorage TravelStorage) (Travel, error)
+		expected error
+	}{
+		"dispatcher get a travel of its team": {
+			ctx: dispatcher,
+			action: func(ctx context.Context, travelStorage TravelStorage) (Travel, error) {
+				return travelStorage.Get(ctx, 1)
 			},
-			expected: ErrInvalidUserClaims,
 		},
 
-		"failure travel update: invalid user logged in": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusPending, 0)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusPending,
-				UserID: 1234,
-			},
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "driver",
+		"dispatcher get a travel without driver": {
+			ctx: dispatcher,
+			action: func(ctx context.Context, travelStorage TravelStorage) (Travel, error) {
+				return travelStorage.Get(ctx, 4)
 			},
-			expected: ErrInvalidUserAccess,
 		},
 
-		"failure travel update: change initial status without user on db travel": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusPending, 0)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusInProcess,
-			},
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+		"admin get a travel of another team": {
+			ctx: admin,
+			action: func(ctx context.Context, travelStorage TravelStorage) (Travel, error) {
+				return travelStorage.Get(ctx, 3)
 			},
-			expected: ErrInvalidUser,
 		},
 
-		"failure travel update: change locations in no pending status": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusInProcess, 0)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: 60,
-					Lng: 2,
-				},
-				To: Point{
-					Lat: -100,
-					Lng: -33,
-				},
-				Status: StatusInProcess,
-			},
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+		"failure dispatcher get a travel of another team": {
+			ctx: dispatcher,
+			action: func(ctx context.Context, travelStorage TravelStorage) (Travel, error) {
+				return travelStorage.Get(ctx, 3)
 			},
-			expected: ErrInvalidStatusToEditLocation,
+			expected: ErrNotFoundTravel,
 		},
 
-		"failure travel update: change user id in no pending status": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusInProcess, 12312312)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusInProcess,
-				UserID: 123,
-			},
-			expected: ErrInvalidUser,
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+		"failure dispatcher update a travel of another team": {
+			ctx: dispatcher,
+			action: func(ctx context.Context, travelStorage TravelStorage) (Travel, error) {
+				return travelStorage.Update(ctx, Travel{ID: 3, Status: StatusInProcess, UserID: 7,
+					From: Point{Lat: -10, Lng: 70}, To: Point{Lat: 3, Lng: 20}})
 			},
+			expected: ErrNotFoundTravel,
 		},
 
-		"failure travel update: no user id in no pending status": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusInProcess, 12312312)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusInProcess,
-			},
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+		"failure dispatcher reassign a travel of another team": {
+			ctx: dispatcher,
+			action: func(ctx context.Context, travelStorage TravelStorage) (Travel, error) {
+				return travelStorage.Reassign(ctx, 3, Reassignment{UserID: 6, Reason: "a reason"})
 			},
-			expected: ErrInvalidUser,
+			expected: ErrNotFoundTravel,
 		},
 
-		"failure travel update: no status": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusPending, 0)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-			},
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+		"failure dispatcher dequeue a travel of another team": {
+			ctx: dispatcher,
+			action: func(ctx context.Context, travelStorage TravelStorage) (Travel, error) {
+				return travelStorage.Dequeue(ctx, 5)
 			},
-			expected: ErrInvalidStatusToEdit,
+			expected: ErrNotFoundTravel,
 		},
 
-		"failure travel update: pending to ready": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusPending, 0)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusReady,
-				UserID: 1231,
-			},
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+		"admin get the queue of a driver of another team": {
+			ctx: admin,
+			action: func(ctx context.Context, travelStorage TravelStorage) (Travel, error) {
+				queue, err := travelStorage.Queue(ctx, 7)
+				if err != nil || len(queue) == 0 {
+					return Travel{}, err
+				}
+				return queue[0], nil
 			},
-			expected: ErrInvalidStatusToEdit,
 		},
 
-		"failure travel update: in process to pending": {
-			db: newMockDBFromMap(map[int64]Travel{1: newTravel(1, -100, 70, 2, 20, StatusInProcess, 1231)}),
-			trv: Travel{
-				ID: 1,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusPending,
-				UserID: 1231,
+		"failure dispatcher get the queue of a driver of another team": {
+			ctx: dispatcher,
+			action: func(ctx context.Context, travelStorage TravelStorage) (Travel, error) {
+				_, err := travelStorage.Queue(ctx, 7)
+				return Travel{}, err
 			},
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+			expected: ErrNotFoundTravel,
+		},
+
+		"dispatcher get the earnings of a driver of its team": {
+			ctx: dispatcher,
+			action: func(ctx context.Context, travelStorage TravelStorage) (Travel, error) {
+				earnings, err := travelStorage.Earnings(ctx, 5, EarningsQuery{})
+				// the travels of the earnings are not returned, the result is the earnings of the driver
+				return Travel{ID: earnings.UserID}, err
 			},
-			expected: ErrInvalidStatusToEdit,
 		},
 
-		"db not found travel get": {
-			db: newMockDB().onGet(22, ErrTravelNotFound),
-			trv: Travel{
-				ID: 22,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusPending,
-				UserID: 1231,
+		"failure dispatcher get the earnings of a driver of another team": {
+			ctx: dispatcher,
+			action: func(ctx context.Context, travelStorage TravelStorage) (Travel, error) {
+				_, err := travelStorage.Earnings(ctx, 7, EarningsQuery{})
+				return Travel{}, err
 			},
 			expected: ErrNotFoundTravel,
 		},
 
-		"db failure travel update": {
-			db: newMockDBFromMap(map[int64]Travel{22: newTravel(22, -100, 70, 2, 20, StatusPending, 0)}).
-				onUpdate(22, errors.New("mocked db error")),
-			trv: Travel{
-				ID: 22,
-				From: Point{
-					Lat: -100,
-					Lng: 70,
-				},
-				To: Point{
-					Lat: 2,
-					Lng: 20,
-				},
-				Status: StatusPending,
-				UserID: 1234,
-			},
-			userLogged: &jwt.Claims{
-				UserID: 1,
-				Role:   "admin",
+		"failure getting driver teams": {
+			ctx:    dispatcher,
+			finder: mockTeamFinder{err: errors.New("mocked team error")},
+			action: func(ctx context.Context, travelStorage TravelStorage) (Travel, error) {
+				return travelStorage.Get(ctx, 1)
 			},
-			expected: ErrStorageUpdate,
+			expected: ErrStorageGet,
 		},
 	}
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			travelStorage := NewTravelStorage(tc.db)
-			ctx := context.Background()
-			if tc.userLogged != nil {
-				ctx = context.WithValue(ctx, "user_on_call", *tc.userLogged)
+			teams := tc.finder
+			if teams == nil {
+				teams = finder
 			}
-			result, err := travelStorage.Update(ctx, tc.trv)
+			db := newDb()
+			previous := db.travels[3]
 
-			if tc.expected == nil {
-				assert.Nil(t, err)
-				assert.NotNil(t, result)
+			result, err := tc.action(tc.ctx, NewTravelStorage(db, WithTeamFinder(teams)))
 
-				assert.Equal(t, tc.trv.Status, result.Status)
-				assert.Equal(t, tc.trv.From.Lat, result.From.Lat)
-				assert.Equal(t, tc.trv.From.Lng, result.From.Lng)
-				assert.Equal(t, tc.trv.To.Lat, result.To.Lat)
-				assert.Equal(t, tc.trv.To.Lng, result.To.Lng)
-				assert.Equal(t, tc.trv.UserID, result.UserID)
-				assert.Greater(t, result.ID, int64(0))
-			} else {
+			if tc.expected != nil {
 				assert.NotNil(t, err)
 				assert.Equal(t, tc.expected.Error(), err.Error())
+				assert.Equal(t, previous, db.travels[3])
+				return
 			}
+
+			assert.Nil(t, err)
+			assert.Greater(t, result.ID, int64(0))
+		})
+	}
+}
+
+func Test_personalData(t *testing.T) {
+	newDb := func() *mockDb {
+		db := newMockDBFromMap(map[int64]Travel{
+			1: {ID: 1, Status: StatusReady, UserID: 5},
+			2: {ID: 2, Status: StatusReady, UserID: 6},
 		})
+		db.archived[3] = Travel{ID: 3, Status: StatusReady, UserID: 5}
+		db.ratings[1] = Rating{TravelID: 1, UserID: 5, Score: 4, Comment: "a nice driver"}
+		db.ratings[2] = Rating{TravelID: 2, UserID: 6, Score: 2, Comment: "a late driver"}
+		db.events = []Event{
+			{ID: 1, TravelID: 1, Type: EventStatusChanged, Detail: "in_process"},
+			{ID: 2, TravelID: 2, Type: EventStatusChanged, Detail: "in_process"},
+		}
+		db.trace = []TracePoint{
+			{ID: 1, TravelID: 1, UserID: 5, Location: Point{Lat: -34.6, Lng: -58.4}},
+			{ID: 2, TravelID: 2, UserID: 6, Location: Point{Lat: -34.7, Lng: -58.5}},
+		}
+		return db
 	}
+
+	t.Run("export personal data of travels", func(t *testing.T) {
+		data, err := NewTravelStorage(newDb()).PersonalData(context.Background(), 5)
+		assert.Nil(t, err)
+
+		assert.Len(t, data.Travels, 2)
+		assert.Equal(t, int64(1), data.Travels[0].ID)
+		assert.Equal(t, int64(3), data.Travels[1].ID)
+		assert.Equal(t, []TracePoint{{ID: 1, TravelID: 1, UserID: 5, Location: Point{Lat: -34.6, Lng: -58.4}}},
+			data.Locations)
+		assert.Equal(t, []Rating{{TravelID: 1, UserID: 5, Score: 4, Comment: "a nice driver"}}, data.Ratings)
+		assert.Equal(t, []Event{{ID: 1, TravelID: 1, Type: EventStatusChanged, Detail: "in_process"}}, data.Events)
+	})
+
+	t.Run("failure export personal data of travels", func(t *testing.T) {
+		_, err := NewTravelStorage(newDb().onSearch(errors.New("mocked storage error"))).
+			PersonalData(context.Background(), 5)
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrStorageGet.Error(), err.Error())
+	})
+
+	t.Run("erase personal data of travels", func(t *testing.T) {
+		db := newDb()
+		err := NewTravelStorage(db).ErasePersonalData(context.Background(), 5)
+		assert.Nil(t, err)
+
+		// the travels and scores are kept, only the locations and comments of the user are erased
+		assert.Len(t, db.travels, 2)
+		assert.Equal(t, Rating{TravelID: 1, UserID: 5, Score: 4}, db.ratings[1])
+		assert.Equal(t, "a late driver", db.ratings[2].Comment)
+		assert.Len(t, db.trace, 1)
+		assert.Equal(t, int64(6), db.trace[0].UserID)
+	})
 }
@@ -0,0 +1,41 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/vehicle"
+)
+
+// VehicleFinder return the vehicles assigned to the drivers by user id
+type VehicleFinder interface {
+	ByDrivers(ctx context.Context, userIDs ...int64) (map[int64]vehicle.Vehicle, error)
+}
+
+// WithVehicleFinder fill the vehicle of the assigned driver on the travels got by id and on the current travel of
+// the drivers
+func WithVehicleFinder(finder VehicleFinder) TravelStorageOption {
+	return func(tst *TravelStorage) {
+		tst.vehicles = finder
+	}
+}
+
+// withVehicle return the travel with the vehicle of its driver, travels without driver or without vehicle finder are
+// returned as received
+func (travelStorage TravelStorage) withVehicle(ctx context.Context, travel Travel) (Travel, error) {
+	if travelStorage.vehicles == nil || travel.UserID == 0 {
+		return travel, nil
+	}
+
+	vehicles, err := travelStorage.vehicles.ByDrivers(ctx, travel.UserID)
+	if err != nil {
+		log.Error(ctx, "there was an error while getting travel vehicle", log.Int64("travel_id", travel.ID),
+			log.Err(err))
+		return Travel{}, ErrStorageGet
+	}
+
+	if v, ok := vehicles[travel.UserID]; ok {
+		travel.Vehicle = &v
+	}
+
+	return travel, nil
+}
@@ -0,0 +1,94 @@
+package travel
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+)
+
+// ZonePolicy is what is done with the travels created outside the operating zones
+type ZonePolicy string
+
+const (
+	// ZonePolicyFlag create the travel marking it as outside zones
+	ZonePolicyFlag ZonePolicy = "flag"
+	// ZonePolicyReject does not create the travel
+	ZonePolicyReject ZonePolicy = "reject"
+)
+
+var (
+	ErrOutsideZones      = code_error.Error{Code: "outside_zones", Detail: "the travel locations should be inside the operating zones"}
+	ErrDriverNotEligible = code_error.Error{Code: "driver_not_eligible", Detail: "the driver is not registered on the zone where the travel starts"}
+)
+
+// ZoneChecker tells if a location is inside the operating zones (and which one) and if a driver can be assigned to
+// the travels starting on it
+type ZoneChecker interface {
+	Covers(ctx context.Context, point Point) (bool, error)
+	Eligible(ctx context.Context, point Point, userID int64) (bool, error)
+	Locate(ctx context.Context, point Point) (int64, error)
+}
+
+// WithZoneChecker check the locations of the created travels are inside the operating zones, applying the policy
+// (ZonePolicyFlag by default) to the travels outside them. The drivers assigned to a travel should also be eligible
+// on the zone where it starts
+func WithZoneChecker(checker ZoneChecker, policy ZonePolicy) TravelStorageOption {
+	return func(tst *TravelStorage) {
+		tst.zones = checker
+		tst.zonePolicy = policy
+	}
+}
+
+// checkZones return if the travel starts and ends inside the operating zones, or ErrOutsideZones if it does not
+// and the policy is to reject it. Without zone checker every travel is inside
+func (travelStorage TravelStorage) checkZones(ctx context.Context, travel Travel) (bool, error) {
+	if travelStorage.zones == nil {
+		return true, nil
+	}
+
+	for _, point := range []Point{travel.From, travel.To} {
+		covered, err := travelStorage.zones.Covers(ctx, point)
+		if err != nil {
+			log.Error(ctx, "there was an error checking travel location zones", log.Err(err))
+			return false, ErrStorageSave
+		}
+
+		if covered {
+			continue
+		}
+
+		log.Info(ctx, "travel location outside operating zones",
+			log.String("location", point.String()),
+			log.String("zone_policy", string(travelStorage.zonePolicy)))
+		if travelStorage.zonePolicy == ZonePolicyReject {
+			return false, ErrOutsideZones
+		}
+
+		return false, nil
+	}
+
+	return true, nil
+}
+
+// checkDriverZone return ErrDriverNotEligible if the user cannot be assigned to a travel starting on the point.
+// Without zone checker or user every assignment is valid
+func (travelStorage TravelStorage) checkDriverZone(ctx context.Context, from Point, userID int64) error {
+	if travelStorage.zones == nil || userID == 0 {
+		return nil
+	}
+
+	eligible, err := travelStorage.zones.Eligible(ctx, from, userID)
+	if err != nil {
+		log.Error(ctx, "there was an error checking driver zones", log.Int64("user_id", userID), log.Err(err))
+		return ErrStorageGet
+	}
+
+	if !eligible {
+		log.Info(ctx, "invalid check on travel driver: driver not registered on the travel zone",
+			log.Int64("user_id", userID),
+			log.String("travel_from", from.String()))
+		return ErrDriverNotEligible
+	}
+
+	return nil
+}
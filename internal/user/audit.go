@@ -0,0 +1,33 @@
+package user
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+)
+
+// SecurityAuditor record the security events of the users: logins, token refreshes and revocations
+type SecurityAuditor interface {
+	Record(ctx context.Context, event audit.Event)
+}
+
+// WithSecurityAuditor record the logins, token refreshes and revocations of the users with the received auditor
+func WithSecurityAuditor(auditor SecurityAuditor) UserStorageOption {
+	return func(ust *UserStorage) {
+		ust.auditor = auditor
+	}
+}
+
+// audit record the event with the auditor on UserStorage, if it is configured
+func (userStorage UserStorage) audit(ctx context.Context, event audit.Event) {
+	if userStorage.auditor == nil {
+		return
+	}
+
+	userStorage.auditor.Record(ctx, event)
+}
+
+// requestClient return the client who sent the request on context, if any
+func requestClient(ctx context.Context) audit.Client {
+	client, _ := ctx.Value(audit.ClientKey).(audit.Client)
+	return client
+}
@@ -0,0 +1,29 @@
+package user
+
+// DefaultDriverAvailability is the availability of the travel states of this service: drivers are busy while they
+// have a pending, offered or in process travel
+var DefaultDriverAvailability = DriverAvailability{
+	Roles:        []string{RoleDriver},
+	BusyStatuses: []string{"pending", "offered", "in_process"},
+}
+
+// DriverAvailability is the criteria to search free and busy drivers: the users with any of the roles are drivers,
+// and they are busy while they have a travel with any of the busy statuses
+type DriverAvailability struct {
+	Roles        []string
+	BusyStatuses []string
+}
+
+// WithDriverAvailability will change the roles of the drivers and the travel statuses which make them busy on the free
+// and busy drivers search, so deployments with custom travel states get the correct availability. An empty list
+// keeps its default
+func WithDriverAvailability(roles []string, busyStatuses []string) UserStorageOption {
+	return func(ust *UserStorage) {
+		if len(roles) > 0 {
+			ust.availability.Roles = roles
+		}
+		if len(busyStatuses) > 0 {
+			ust.availability.BusyStatuses = busyStatuses
+		}
+	}
+}
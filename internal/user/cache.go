@@ -0,0 +1,130 @@
+package user
+
+import (
+	"container/list"
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"sync"
+	"time"
+)
+
+const cacheMetricName = "application.space.users.cache"
+
+// Cache is an in-memory LRU cache of the users got by id, each user expires after the ttl. It is safe for concurrent
+// use, so the same cache can be shared by every UserStorage to invalidate the users changed by any of them
+type Cache struct {
+	mu      sync.Mutex
+	size    int
+	ttl     time.Duration
+	entries map[int64]*list.Element
+	// order has the cached users from the most to the least recently used
+	order *list.List
+	now   func() time.Time
+}
+
+type cacheEntry struct {
+	user      User
+	expiresAt time.Time
+}
+
+// NewCache creates and return a Cache of up to size users which expire after the ttl
+func NewCache(size int, ttl time.Duration) *Cache {
+	return &Cache{
+		size:    size,
+		ttl:     ttl,
+		entries: make(map[int64]*list.Element),
+		order:   list.New(),
+		now:     time.Now,
+	}
+}
+
+// WithCache will read the users got by id through the received cache, the users are invalidated when they are
+// updated, suspended, deleted or change their password. A nil cache or one without size disables the cache
+func WithCache(cache *Cache) UserStorageOption {
+	return func(ust *UserStorage) {
+		if cache != nil && cache.size > 0 {
+			ust.cache = cache
+		}
+	}
+}
+
+// get return the cached user with the received id, if it is cached and not expired
+func (c *Cache) get(id int64) (User, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	element, ok := c.entries[id]
+	if !ok {
+		return User{}, false
+	}
+
+	entry := element.Value.(*cacheEntry)
+	if !c.now().Before(entry.expiresAt) {
+		c.order.Remove(element)
+		delete(c.entries, id)
+		return User{}, false
+	}
+
+	c.order.MoveToFront(element)
+	return entry.user, true
+}
+
+// set cache the received user, evicting the least recently used one if the cache is full
+func (c *Cache) set(user User) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	entry := &cacheEntry{user: user, expiresAt: c.now().Add(c.ttl)}
+	if element, ok := c.entries[user.ID]; ok {
+		element.Value = entry
+		c.order.MoveToFront(element)
+		return
+	}
+
+	c.entries[user.ID] = c.order.PushFront(entry)
+	if c.order.Len() > c.size {
+		oldest := c.order.Back()
+		c.order.Remove(oldest)
+		delete(c.entries, oldest.Value.(*cacheEntry).user.ID)
+	}
+}
+
+// invalidate remove the user with the received id from the cache
+func (c *Cache) invalidate(id int64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if element, ok := c.entries[id]; ok {
+		c.order.Remove(element)
+		delete(c.entries, id)
+	}
+}
+
+// getUser return the user with the received id from the cache, or from the repository if it is not cached (then it
+// is cached)
+func (userStorage UserStorage) getUser(ctx context.Context, id int64) (User, error) {
+	if userStorage.cache == nil {
+		return userStorage.repository.GetUser(ctx, id)
+	}
+
+	if user, ok := userStorage.cache.get(id); ok {
+		metrics.Inc(ctx, cacheMetricName, []string{"result", "hit"})
+		return user, nil
+	}
+
+	metrics.Inc(ctx, cacheMetricName, []string{"result", "miss"})
+	user, err := userStorage.repository.GetUser(ctx, id)
+	if err != nil {
+		return User{}, err
+	}
+
+	userStorage.cache.set(user)
+	return user, nil
+}
+
+// invalidateUser remove the user with the received id from the cache, if any
+func (userStorage UserStorage) invalidateUser(id int64) {
+	if userStorage.cache != nil {
+		userStorage.cache.invalidate(id)
+	}
+}
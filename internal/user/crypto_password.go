@@ -2,17 +2,55 @@ package user
 
 import "golang.org/x/crypto/bcrypt"
 
+// DefaultBcryptCost is the cost to encrypt the passwords with bcrypt when no other cost is configured
+const DefaultBcryptCost = bcrypt.DefaultCost
+
 type PasswordEncrypter interface {
 	Encrypt(pwd string) ([]byte, error)
 	Compare(encrypted, pwd string) error
 }
 
-type bcryptEncrypt struct{}
+// PasswordRehasher can be implemented by a PasswordEncrypter to tell when a stored password was encrypted with
+// older parameters (or another algorithm), so it is encrypted again when the user logs in
+type PasswordRehasher interface {
+	NeedsRehash(encrypted string) bool
+}
+
+// WithBcryptCost will encrypt the passwords with bcrypt using the received cost, costs outside the range accepted
+// by bcrypt use DefaultBcryptCost. Passwords stored with a lower cost are encrypted again on login
+func WithBcryptCost(cost int) UserStorageOption {
+	return func(ust *UserStorage) {
+		ust.passwordEncrypter = bcryptEncrypt{cost: cost}
+	}
+}
+
+type bcryptEncrypt struct {
+	cost int
+}
 
-func (bcryptEncrypt) Encrypt(pwd string) ([]byte, error) {
-	return bcrypt.GenerateFromPassword([]byte(pwd), bcrypt.DefaultCost)
+func (b bcryptEncrypt) Encrypt(pwd string) ([]byte, error) {
+	return bcrypt.GenerateFromPassword([]byte(pwd), b.currentCost())
 }
 
 func (bcryptEncrypt) Compare(encrypted, pwd string) error {
 	return bcrypt.CompareHashAndPassword([]byte(encrypted), []byte(pwd))
 }
+
+// NeedsRehash return true if the encrypted password is not a bcrypt hash or it has a lower cost than the current one
+func (b bcryptEncrypt) NeedsRehash(encrypted string) bool {
+	cost, err := bcrypt.Cost([]byte(encrypted))
+	if err != nil {
+		return true
+	}
+
+	return cost < b.currentCost()
+}
+
+// currentCost return the configured cost, or DefaultBcryptCost if it is not a valid one
+func (b bcryptEncrypt) currentCost() int {
+	if b.cost < bcrypt.MinCost || b.cost > bcrypt.MaxCost {
+		return DefaultBcryptCost
+	}
+
+	return b.cost
+}
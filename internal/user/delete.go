@@ -0,0 +1,38 @@
+package user
+
+import (
+	"context"
+	"errors"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"time"
+)
+
+var (
+	ErrStorageDelete        = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to delete user"}
+	ErrUserHasActiveTravels = code_error.Error{Code: "user_has_active_travels", Detail: "the user has pending, offered, queued or in process travels"}
+)
+
+// Delete will soft delete the user with the received id, a deleted user cannot login nor be got or searched. Users
+// with active travels (pending, offered, queued or in process) cannot be deleted
+func (userStorage UserStorage) Delete(ctx context.Context, id int64) error {
+	err := userStorage.repository.DeleteUser(ctx, id, time.Now().UTC().Truncate(time.Second))
+	userStorage.invalidateUser(id)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrNotFoundUser
+		}
+		if errors.Is(err, ErrUserActiveTravels) {
+			log.Info(ctx, "invalid check on delete user: the user has active travels", log.Int64("user_id", id))
+			return ErrUserHasActiveTravels
+		}
+
+		log.Error(ctx, "there was an error deleting user", log.Int64("user_id", id), log.Err(err))
+		return ErrStorageDelete
+	}
+
+	auditlog.Log(ctx, "user deleted", log.Int64("user_id", id))
+
+	return nil
+}
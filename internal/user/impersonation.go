@@ -0,0 +1,85 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"time"
+)
+
+// DefaultImpersonationTTL is how long an impersonation token is valid when no other duration is configured
+const DefaultImpersonationTTL = 10 * time.Minute
+
+var (
+	ErrInvalidImpersonation  = code_error.Error{Code: "invalid_impersonation", Detail: "only active drivers can be impersonated, and not while impersonating"}
+	ErrGenerateImpersonation = code_error.Error{Code: "impersonation_failure", Detail: "an error ocurred trying to generate the impersonation token"}
+)
+
+// Impersonation is a short-lived token to act as a driver, for support and debugging. It has no refresh token
+type Impersonation struct {
+	Token     string    `json:"token"`
+	UserID    int64     `json:"user_id"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// WithImpersonationTTL will change how long the impersonation tokens are valid
+func WithImpersonationTTL(ttl time.Duration) UserStorageOption {
+	return func(ust *UserStorage) {
+		if ttl > 0 {
+			ust.impersonationTTL = ttl
+		}
+	}
+}
+
+// Impersonate will generate a token for the user logged in to act as the driver with the received id, with the
+// driver permissions and the user logged in as its impersonator. Every impersonation is recorded as a security event
+func (userStorage UserStorage) Impersonate(ctx context.Context, id int64) (Impersonation, error) {
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims on impersonate user",
+			log.Int64("user_id", id))
+		return Impersonation{}, ErrInvalidUserClaims
+	}
+
+	if userLogged.ImpersonatorID != 0 {
+		log.Info(ctx, "invalid check on impersonate user: the user logged in is impersonated",
+			log.Int64("impersonator_id", userLogged.ImpersonatorID))
+		return Impersonation{}, ErrInvalidImpersonation
+	}
+
+	impersonated, err := userStorage.repository.GetUser(ctx, id)
+	if err != nil {
+		log.Error(ctx, "there was an error getting user on impersonate user", log.Int64("user_id", id), log.Err(err))
+		if errors.Is(err, ErrUserNotFound) {
+			return Impersonation{}, ErrNotFoundUser
+		}
+		return Impersonation{}, ErrStorageGet
+	}
+
+	if impersonated.Role != RoleDriver || !impersonated.Active {
+		log.Info(ctx, "invalid check on impersonate user: the user is not an active driver",
+			log.Int64("user_id", id), log.String("role", impersonated.Role))
+		return Impersonation{}, ErrInvalidImpersonation
+	}
+
+	expiresAt := userStorage.clock.Now().UTC().Add(userStorage.impersonationTTL).Truncate(time.Second)
+	token, err := jwt.GenerateImpersonation(impersonated.ID, impersonated.Email, impersonated.Role,
+		RolePermissions(impersonated.Role), userLogged.UserID, expiresAt)
+	if err != nil {
+		log.Error(ctx, "there was an error generating impersonation token", log.Err(err))
+		return Impersonation{}, ErrGenerateImpersonation
+	}
+
+	userStorage.audit(ctx, audit.Event{Type: audit.EventImpersonation, UserID: userLogged.UserID,
+		Email: userLogged.Email, Detail: fmt.Sprintf("as user %d (%s)", impersonated.ID, impersonated.Email)})
+
+	return Impersonation{
+		Token:     token,
+		UserID:    impersonated.ID,
+		ExpiresAt: expiresAt,
+	}, nil
+}
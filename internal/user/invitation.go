@@ -0,0 +1,152 @@
+package user
+
+import (
+	"context"
+	"errors"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"strings"
+	"time"
+)
+
+// DefaultInvitationTTL is how long an invitation can be accepted when no other duration is configured
+const DefaultInvitationTTL = 72 * time.Hour
+
+var (
+	ErrInvalidInvitation  = code_error.Error{Code: "invalid_invitation", Detail: "the invitation received is invalid or expired"}
+	ErrGenerateInvitation = code_error.Error{Code: "invitation_failure", Detail: "an error ocurred trying to generate the invitation"}
+)
+
+// Invitation invites an email to register as a user with a pre-assigned role. The invited person sets its password
+// accepting the invitation with its token, before it expires
+type Invitation struct {
+	Email     string    `json:"email" binding:"required"`
+	Role      string    `json:"role" binding:"required"`
+	Token     string    `json:"token,omitempty"`
+	Link      string    `json:"link,omitempty"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// InvitationAcceptance is the password and profile set by the invited person to complete its registration
+type InvitationAcceptance struct {
+	Password string `json:"password" binding:"required"`
+	Profile
+}
+
+type invitationConfig struct {
+	ttl time.Duration
+	// linkURL is the url of the page to accept the invitations, the token is appended to it
+	linkURL string
+}
+
+// WithInvitations will change how long the invitations can be accepted and the url of the page to accept them, the
+// invitations are returned with a link to it when it is received
+func WithInvitations(linkURL string, ttl time.Duration) UserStorageOption {
+	return func(ust *UserStorage) {
+		ust.invitations.linkURL = linkURL
+		if ttl > 0 {
+			ust.invitations.ttl = ttl
+		}
+	}
+}
+
+// Invite will generate a signed invitation for the email to register with the role, so admins do not need to know
+// the password of the users they create. The email cannot belong to a user already, and every invitation is logged
+// on the audit log
+func (userStorage UserStorage) Invite(ctx context.Context, invitation Invitation) (Invitation, error) {
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims on invite user")
+		return Invitation{}, ErrInvalidUserClaims
+	}
+
+	if !validEmail(invitation.Email) {
+		log.Info(ctx, "invalid check on invite user: invalid email", log.String("email", invitation.Email))
+		return Invitation{}, ErrInvalidEmail
+	}
+
+	if !validRole(invitation.Role) {
+		log.Info(ctx, "invalid check on invite user: invalid role", log.String("role", invitation.Role))
+		return Invitation{}, ErrInvalidRole
+	}
+
+	_, err := userStorage.repository.GetUserByEmail(ctx, invitation.Email)
+	if err == nil {
+		log.Info(ctx, "invalid check on invite user: the email belongs to a user", log.String("email", invitation.Email))
+		return Invitation{}, ErrEmailAlreadyExists
+	}
+	if !errors.Is(err, ErrUserNotFound) {
+		log.Error(ctx, "there was an error getting user by email on invite user", log.Err(err))
+		return Invitation{}, ErrStorageGet
+	}
+
+	invitation.ExpiresAt = userStorage.clock.Now().UTC().Add(userStorage.invitations.ttl).Truncate(time.Second)
+	invitation.Token, err = jwt.GenerateInvitation(invitation.Email, invitation.Role, invitation.ExpiresAt)
+	if err != nil {
+		log.Error(ctx, "there was an error generating invitation token", log.Err(err))
+		return Invitation{}, ErrGenerateInvitation
+	}
+
+	if userStorage.invitations.linkURL != "" {
+		invitation.Link = strings.TrimSuffix(userStorage.invitations.linkURL, "/") + "/" + invitation.Token
+	}
+
+	auditlog.Log(ctx, "user invited",
+		log.String("email", invitation.Email),
+		log.String("role", invitation.Role),
+		log.Int64("logged_user_id", userLogged.UserID))
+
+	return invitation, nil
+}
+
+// AcceptInvitation will complete the registration of an invited person: if the token is a valid invitation then the
+// user is created with the invited email and role, and the received password and profile. An invitation is accepted
+// once: it cannot be accepted again, nor once its email belongs to a user
+func (userStorage UserStorage) AcceptInvitation(ctx context.Context, token string,
+	acceptance InvitationAcceptance) (SecuredUser, error) {
+	parsed, err := jwt.ValidateToken(ctx, token)
+	if err != nil {
+		log.Info(ctx, "invalid check on accept invitation: invalid token", log.Err(err))
+		return SecuredUser{}, ErrInvalidInvitation
+	}
+
+	invitation, err := jwt.GetInvitation(parsed)
+	if err != nil {
+		log.Info(ctx, "invalid check on accept invitation: the token is not an invitation")
+		return SecuredUser{}, ErrInvalidInvitation
+	}
+
+	consumed, err := userStorage.consumeToken(ctx, "invitation", invitation.ID, invitation.Expiration,
+		invitation.Email)
+	if err != nil {
+		return SecuredUser{}, ErrStorageSave
+	}
+	if !consumed {
+		log.Info(ctx, "invalid check on accept invitation: the invitation was already accepted",
+			log.String("email", invitation.Email))
+		return SecuredUser{}, ErrInvalidInvitation
+	}
+
+	created, err := userStorage.Save(ctx, User{
+		SecuredUser: SecuredUser{
+			Email:   invitation.Email,
+			Role:    invitation.Role,
+			Profile: acceptance.Profile,
+		},
+		Password: acceptance.Password,
+	})
+	if err != nil {
+		// the invitation can be accepted again with a valid password and profile
+		userStorage.releaseToken(ctx, "invitation", invitation.ID)
+		return SecuredUser{}, err
+	}
+
+	auditlog.Log(ctx, "invitation accepted",
+		log.Int64("user_id", created.ID),
+		log.String("email", created.Email),
+		log.String("role", created.Role))
+
+	return created, nil
+}
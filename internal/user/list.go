@@ -0,0 +1,107 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+)
+
+// UserSort is the order of the listed users
+type UserSort string
+
+const (
+	SortByID        UserSort = "id"
+	SortByCreatedAt UserSort = "created_at"
+	SortByUpdatedAt UserSort = "updated_at"
+)
+
+var ErrInvalidSort = code_error.Error{Code: "invalid_sort", Detail: "the users can be sorted by id, created_at or updated_at"}
+
+// WithRole filter the listed users on the ones with the received role
+func WithRole(role string) SearchOption {
+	return func(s *Search) {
+		s.role = role
+	}
+}
+
+// WithSort sort the listed users by id or by recency (the most recently created or updated users first)
+func WithSort(sort UserSort) SearchOption {
+	return func(s *Search) {
+		s.sort = sort
+	}
+}
+
+// WithEmail filter the listed users on the one with the received email
+func WithEmail(email string) SearchOption {
+	return func(s *Search) {
+		s.email = email
+	}
+}
+
+// List users of any role (or only the ones of the role received with WithRole) with pagination, ordered by id. When
+// an email is received with WithEmail only the user with that email is listed, if any
+func (userStorage UserStorage) List(ctx context.Context, opt ...SearchOption) ([]SecuredUser, Metadata, error) {
+	// default search options
+	search := Search{
+		sort:   SortByID,
+		offset: 0,
+		limit:  20,
+	}
+
+	// apply options
+	for _, option := range opt {
+		option(&search)
+	}
+
+	if search.role != "" && !validRole(search.role) {
+		log.Info(ctx, "invalid check on list users: invalid role", log.String("role", search.role))
+		return nil, Metadata{}, ErrInvalidRole
+	}
+
+	if search.sort != SortByID && search.sort != SortByCreatedAt && search.sort != SortByUpdatedAt {
+		log.Info(ctx, "invalid check on list users: invalid sort", log.String("sort", string(search.sort)))
+		return nil, Metadata{}, ErrInvalidSort
+	}
+
+	if search.email != "" {
+		return userStorage.listByEmail(ctx, search)
+	}
+
+	users, total, err := userStorage.repository.GetByRole(ctx, search.role, search.sort, search.limit,
+		search.offset)
+	if err != nil {
+		log.Error(ctx, "there was an error getting users on list", log.String("role", search.role), log.Err(err))
+		return nil, Metadata{}, ErrStorageGet
+	}
+
+	metadata := Metadata{
+		Total:   total,
+		Pending: total - search.limit - search.offset,
+	}
+	if metadata.Pending < 0 {
+		metadata.Pending = 0
+	}
+
+	secUsers := make([]SecuredUser, 0, len(users))
+	for _, u := range users {
+		secUsers = append(secUsers, u.SecuredUser)
+	}
+
+	return secUsers, metadata, nil
+}
+
+// listByEmail list the user with the email of the search, filtered by the role of the search if it was received
+func (userStorage UserStorage) listByEmail(ctx context.Context, search Search) ([]SecuredUser, Metadata, error) {
+	u, err := userStorage.repository.GetUserByEmail(ctx, search.email)
+	if err != nil && !errors.Is(err, ErrUserNotFound) {
+		log.Error(ctx, "there was an error getting user by email on list", log.Err(err))
+		return nil, Metadata{}, ErrStorageGet
+	}
+
+	if err != nil || (search.role != "" && u.Role != search.role) {
+		return []SecuredUser{}, Metadata{}, nil
+	}
+
+	return []SecuredUser{u.SecuredUser}, Metadata{Total: 1}, nil
+}
@@ -0,0 +1,110 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+)
+
+var (
+	ErrInvalidCurrentPassword = code_error.Error{Code: "invalid_password", Detail: "the current password received is invalid"}
+	ErrInvalidPasswordAccess  = code_error.Error{Code: "invalid_user_access", Detail: "the user logged in can only change its own password, unless it is an admin"}
+)
+
+// PasswordChange is the change of the password of a user, the current password is required unless an admin
+// changes the password of another user
+type PasswordChange struct {
+	CurrentPassword string `json:"current_password"`
+	NewPassword     string `json:"new_password" binding:"required"`
+}
+
+// ChangePassword will replace the password of the user with the received id, the current password is compared
+// with the stored one and the new one is encrypted with passwordEncrypter on UserStorage. Only the user itself or
+// an admin can change it, admins do not need the current password of other users. The refresh tokens of the user
+// are revoked
+func (userStorage UserStorage) ChangePassword(ctx context.Context, id int64, change PasswordChange) error {
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims on change password",
+			log.Int64("user_id", id))
+		return ErrInvalidUserClaims
+	}
+
+	isOwner := userLogged.UserID == id
+	if !isOwner && !ClaimsPermissions(userLogged).Has(PermissionUserWrite) {
+		log.Info(ctx, "invalid check on change password: the user logged in cannot change another user password",
+			log.Int64("user_id", id),
+			log.Int64("logged_user_id", userLogged.UserID),
+			log.String("logged_role", userLogged.Role))
+		return ErrInvalidPasswordAccess
+	}
+
+	current, err := userStorage.repository.GetUser(ctx, id)
+	if err != nil {
+		log.Error(ctx, "there was an error getting user on change password", log.Int64("user_id", id), log.Err(err))
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrNotFoundUser
+		}
+		return ErrStorageGet
+	}
+
+	if isOwner {
+		if err := userStorage.passwordEncrypter.Compare(current.Password, change.CurrentPassword); err != nil {
+			log.Info(ctx, "invalid check on change password: invalid current password", log.Int64("user_id", id))
+			return ErrInvalidCurrentPassword
+		}
+	}
+
+	pwd, err := userStorage.passwordEncrypter.Encrypt(change.NewPassword)
+	if err != nil {
+		log.Error(ctx, "there was an error encrypting password on change password", log.Err(err))
+		return ErrInvalidPasswordToSave
+	}
+
+	err = userStorage.repository.UpdatePassword(ctx, id, string(pwd))
+	userStorage.invalidateUser(id)
+	if err != nil {
+		log.Error(ctx, "there was an error updating user password", log.Int64("user_id", id), log.Err(err))
+		return ErrStorageUpdate
+	}
+
+	// the sessions opened with the old password cannot be refreshed
+	if err := userStorage.repository.RevokeRefreshTokens(ctx, id); err != nil {
+		log.Error(ctx, "there was an error revoking refresh tokens on change password", log.Int64("user_id", id),
+			log.Err(err))
+		return ErrStorageUpdate
+	}
+	userStorage.audit(ctx, audit.Event{Type: audit.EventTokenRevoked, UserID: id, Detail: "password changed"})
+
+	return nil
+}
+
+// rehashPassword encrypt again and store the password of the user with the received id if passwordEncrypter on
+// UserStorage needs it (see PasswordRehasher). It is done on login, when the plain password is known, and its
+// failure is only logged so the login is not affected
+func (userStorage UserStorage) rehashPassword(ctx context.Context, id int64, encrypted, pwd string) {
+	rehasher, ok := userStorage.passwordEncrypter.(PasswordRehasher)
+	if !ok || !rehasher.NeedsRehash(encrypted) {
+		return
+	}
+
+	newPwd, err := userStorage.passwordEncrypter.Encrypt(pwd)
+	if err != nil {
+		log.Error(ctx, "there was an error encrypting password on rehash password", log.Int64("user_id", id),
+			log.Err(err))
+		return
+	}
+
+	err = userStorage.repository.UpdatePassword(ctx, id, string(newPwd))
+	userStorage.invalidateUser(id)
+	if err != nil {
+		log.Error(ctx, "there was an error updating user password on rehash password", log.Int64("user_id", id),
+			log.Err(err))
+		return
+	}
+
+	log.Info(ctx, "user password encrypted again with the current parameters", log.Int64("user_id", id))
+}
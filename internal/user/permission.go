@@ -0,0 +1,118 @@
+package user
+
+import "github.com/nicocarolo/space-drivers/internal/platform/jwt"
+
+// Permissions granted to the roles, the actions a user can perform are checked against them instead of its role
+const (
+	// PermissionUserRead get and list users, and export their personal data
+	PermissionUserRead = "user:read"
+	// PermissionUserWrite create (or invite), delete and edit any user, including its role and password, and erase its
+	// personal data
+	PermissionUserWrite = "user:write"
+	// PermissionProfileRead get the own user, preferences and sessions, and export its personal data
+	PermissionProfileRead = "profile:read"
+	// PermissionProfileWrite edit the own user, password and preferences, and revoke its sessions
+	PermissionProfileWrite = "profile:write"
+	// PermissionDriverRead search drivers
+	PermissionDriverRead = "driver:read"
+	// PermissionTravelRead search and get any travel, the travels of any user and their queues
+	PermissionTravelRead = "travel:read"
+	// PermissionTravelWrite create, quote, update and assign any travel
+	PermissionTravelWrite = "travel:write"
+	// PermissionTravelOwn work on the own travels: search pending travels, take, answer and report them, and get the
+	// own earnings
+	PermissionTravelOwn = "travel:own"
+	// PermissionTravelAdmin cancel, delete, restore, rate and attach files to any travel
+	PermissionTravelAdmin = "travel:admin"
+	// PermissionTravelReport export travels, their stats, heatmap and traces, and get the earnings of any driver
+	PermissionTravelReport = "travel:report"
+	// PermissionZoneWrite manage zones and their drivers
+	PermissionZoneWrite = "zone:write"
+	// PermissionVehicleWrite manage vehicles and their drivers
+	PermissionVehicleWrite = "vehicle:write"
+	// PermissionTeamWrite manage teams and their members
+	PermissionTeamWrite = "team:write"
+	// PermissionAuthorizationWrite manage the authorization rules
+	PermissionAuthorizationWrite = "authorization:write"
+	// PermissionAuditRead search the security events
+	PermissionAuditRead = "audit:read"
+	// PermissionUserImpersonate get a short-lived token to act as a driver
+	PermissionUserImpersonate = "user:impersonate"
+	// PermissionLogWrite change the level of the api logs
+	PermissionLogWrite = "log:write"
+
+	// PermissionTwoFactorEnroll enroll the own two factor authentication, granted (alone) on login to the users whose
+	// role requires two factor authentication and did not enroll it
+	PermissionTwoFactorEnroll = "2fa:enroll"
+	// PermissionTwoFactorChallenge send the two factor code to complete the login, granted (alone) to the challenge
+	// returned on login to the users with two factor authentication
+	PermissionTwoFactorChallenge = "2fa:challenge"
+
+	// PermissionAll access every resource, without checking the permissions accepted by its authorization rules
+	PermissionAll = "*"
+)
+
+// Permissions is the set of permissions of a user
+type Permissions []string
+
+// permissions are every known permission
+var permissions = Permissions{
+	PermissionUserRead, PermissionUserWrite, PermissionProfileRead, PermissionProfileWrite, PermissionDriverRead,
+	PermissionTravelRead, PermissionTravelWrite, PermissionTravelOwn, PermissionTravelAdmin, PermissionTravelReport,
+	PermissionZoneWrite, PermissionVehicleWrite, PermissionTeamWrite, PermissionAuthorizationWrite, PermissionAuditRead,
+	PermissionUserImpersonate, PermissionLogWrite, PermissionTwoFactorEnroll, PermissionTwoFactorChallenge,
+	PermissionAll,
+}
+
+// ValidPermission return if the permission is one of the known permissions
+func ValidPermission(permission string) bool {
+	return permissions.Has(permission)
+}
+
+// rolePermissions is the permission set of each role, a new role only needs its own entry
+var rolePermissions = map[string]Permissions{
+	RoleAdmin: {
+		PermissionUserRead, PermissionUserWrite, PermissionProfileRead, PermissionProfileWrite, PermissionDriverRead,
+		PermissionTravelRead, PermissionTravelWrite, PermissionTravelAdmin, PermissionTravelReport, PermissionZoneWrite,
+		PermissionVehicleWrite, PermissionTeamWrite, PermissionAuthorizationWrite, PermissionAuditRead,
+		PermissionUserImpersonate, PermissionLogWrite, PermissionAll,
+	},
+	RoleDispatcher: {
+		PermissionProfileRead, PermissionProfileWrite, PermissionDriverRead, PermissionTravelRead, PermissionTravelWrite,
+	},
+	RoleDriver: {
+		PermissionProfileRead, PermissionProfileWrite, PermissionTravelOwn,
+	},
+}
+
+// RolePermissions return the permissions granted to the role, an unknown role has no permissions
+func RolePermissions(role string) Permissions {
+	return rolePermissions[role]
+}
+
+// ClaimsPermissions return the permissions carried on the claims of the user logged in. Claims without permissions
+// (e.g. tokens generated before the permissions were added to them) get the ones of their role
+func ClaimsPermissions(claims jwt.Claims) Permissions {
+	if len(claims.Permissions) > 0 {
+		return claims.Permissions
+	}
+
+	return RolePermissions(claims.Role)
+}
+
+// Has return if the permission is on the set
+func (permissions Permissions) Has(permission string) bool {
+	for _, p := range permissions {
+		if p == permission {
+			return true
+		}
+	}
+
+	return false
+}
+
+// validRole return if the role is one of the known roles: admin, dispatcher or driver
+func validRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok
+}
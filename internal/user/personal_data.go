@@ -0,0 +1,60 @@
+package user
+
+import (
+	"context"
+	"errors"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"strconv"
+	"time"
+)
+
+var (
+	ErrStorageErase        = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to erase user personal data"}
+	ErrInvalidExportAccess = code_error.Error{Code: "invalid_user_access", Detail: "the user logged in can only export its own personal data, unless it is an admin"}
+)
+
+// ErasedStatusReason is the status reason of the users whose personal data was erased
+const ErasedStatusReason = "personal data erased"
+
+// ErasePersonalData will anonymize the user with the received id: its email is replaced by an anonymous one, its
+// password, profile and two factor secret are cleared, its preferences are deleted, and it is suspended and deleted.
+// Its id is kept, so its travels and their statistics do not change. Deleted users can be erased too, users with
+// active travels (pending, offered, queued or in process) cannot. Every erasure is logged on the audit log
+func (userStorage UserStorage) ErasePersonalData(ctx context.Context, id int64) error {
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims on erase user personal data",
+			log.Int64("user_id", id))
+		return ErrInvalidUserClaims
+	}
+
+	err := userStorage.repository.AnonymizeUser(ctx, id, time.Now().UTC().Truncate(time.Second))
+	userStorage.invalidateUser(id)
+	if err != nil {
+		if errors.Is(err, ErrUserNotFound) {
+			return ErrNotFoundUser
+		}
+		if errors.Is(err, ErrUserActiveTravels) {
+			log.Info(ctx, "invalid check on erase user personal data: the user has active travels",
+				log.Int64("user_id", id))
+			return ErrUserHasActiveTravels
+		}
+
+		log.Error(ctx, "there was an error erasing user personal data", log.Int64("user_id", id), log.Err(err))
+		return ErrStorageErase
+	}
+
+	auditlog.Log(ctx, "user personal data erased",
+		log.Int64("user_id", id),
+		log.Int64("logged_user_id", userLogged.UserID))
+
+	return nil
+}
+
+// anonymousEmail return the email of a user whose personal data was erased, unique by its id
+func anonymousEmail(id int64) string {
+	return "erased-" + strconv.FormatInt(id, 10) + "@space-drivers.invalid"
+}
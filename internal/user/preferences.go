@@ -0,0 +1,68 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"regexp"
+)
+
+const (
+	// MaxPreferences is the quantity of preferences a user can have
+	MaxPreferences     = 50
+	maxPreferenceValue = 255
+)
+
+var (
+	ErrInvalidPreferenceKey   = code_error.Error{Code: "invalid_preference", Detail: "the preference keys should have up to 50 lowercase letters, digits, '_', '-' or '.'"}
+	ErrInvalidPreferenceValue = code_error.Error{Code: "invalid_preference", Detail: "the preference values should have up to 255 characters"}
+	ErrTooManyPreferences     = code_error.Error{Code: "too_many_preferences", Detail: "a user can have up to 50 preferences"}
+	ErrStoragePreferences     = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to save user preferences"}
+)
+
+var preferenceKeyRegex = regexp.MustCompile(`^[a-z0-9_.-]{1,50}$`)
+
+// Preferences are the settings of a user by key (as notification settings, locale or units), kept on the api so
+// clients share them between devices
+type Preferences map[string]string
+
+// GetPreferences return the preferences of the user with the received id, an empty set if it has none
+func (userStorage UserStorage) GetPreferences(ctx context.Context, userID int64) (Preferences, error) {
+	preferences, err := userStorage.repository.GetPreferences(ctx, userID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting user preferences", log.Int64("user_id", userID), log.Err(err))
+		return nil, ErrStorageGet
+	}
+
+	return preferences, nil
+}
+
+// UpdatePreferences will merge the received preferences on the ones of the user with the received id and return the
+// result: received keys are set and an empty value removes its key, other keys are kept
+func (userStorage UserStorage) UpdatePreferences(ctx context.Context, userID int64, changes Preferences) (Preferences,
+	error) {
+	for key, value := range changes {
+		if !preferenceKeyRegex.MatchString(key) {
+			log.Info(ctx, "invalid check on update preferences: invalid key", log.String("key", key))
+			return nil, ErrInvalidPreferenceKey
+		}
+		if len(value) > maxPreferenceValue {
+			log.Info(ctx, "invalid check on update preferences: invalid value", log.String("key", key))
+			return nil, ErrInvalidPreferenceValue
+		}
+	}
+
+	preferences, err := userStorage.repository.UpdatePreferences(ctx, userID, changes, MaxPreferences)
+	if err != nil {
+		if errors.Is(err, ErrPreferencesLimit) {
+			log.Info(ctx, "invalid check on update preferences: too many preferences", log.Int64("user_id", userID))
+			return nil, ErrTooManyPreferences
+		}
+
+		log.Error(ctx, "there was an error updating user preferences", log.Int64("user_id", userID), log.Err(err))
+		return nil, ErrStoragePreferences
+	}
+
+	return preferences, nil
+}
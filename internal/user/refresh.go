@@ -0,0 +1,174 @@
+package user
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"time"
+)
+
+// DefaultRefreshTokenTTL is how long a refresh token can be used when no other duration is configured
+const DefaultRefreshTokenTTL = 30 * 24 * time.Hour
+
+// refreshTokenSize is the random bytes of the generated refresh tokens
+const refreshTokenSize = 32
+
+var (
+	ErrInvalidRefreshToken = code_error.Error{Code: "invalid_refresh_token", Detail: "the refresh token received is invalid or expired"}
+	ErrGenerateSession     = code_error.Error{Code: "session_failure", Detail: "an error ocurred trying to generate the session"}
+)
+
+// RefreshToken is a long lived token to get a new session without login again. Only the hash of the token is stored,
+// and it can be used once: a new refresh token replaces it on every use, on the same UserSession
+type RefreshToken struct {
+	UserID    int64
+	SessionID int64
+	TokenHash string
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+// WithRefreshTokenTTL will change how long the refresh tokens can be used
+func WithRefreshTokenTTL(ttl time.Duration) UserStorageOption {
+	return func(ust *UserStorage) {
+		if ttl > 0 {
+			ust.refreshTokenTTL = ttl
+		}
+	}
+}
+
+// Refresh return a new session to the user of the received refresh token, with a new refresh token which replaces
+// the received one and keeps the scope of its session. A refresh token already replaced revokes every refresh token of
+// its user, as it may have been stolen, and suspended or deleted users cannot refresh their session
+func (userStorage UserStorage) Refresh(ctx context.Context, refreshToken string) (Session, error) {
+	next, newRefreshToken, err := userStorage.newRefreshToken()
+	if err != nil {
+		log.Error(ctx, "there was an error generating refresh token on refresh session", log.Err(err))
+		return Session{}, ErrGenerateSession
+	}
+
+	rotated, err := userStorage.repository.RotateRefreshToken(ctx, hashRefreshToken(refreshToken), next)
+	userID := rotated.UserID
+	if err != nil {
+		if errors.Is(err, ErrRefreshTokenNotFound) {
+			log.Info(ctx, "invalid check on refresh session: invalid refresh token")
+			userStorage.audit(ctx, audit.Event{Type: audit.EventTokenRefreshFailed, Detail: "invalid refresh token"})
+			return Session{}, ErrInvalidRefreshToken
+		}
+		if errors.Is(err, ErrRefreshTokenReused) {
+			auditlog.Log(ctx, "refresh token reused, every refresh token of the user was revoked",
+				log.Int64("user_id", userID))
+			userStorage.audit(ctx, audit.Event{Type: audit.EventTokenRevoked, UserID: userID,
+				Detail: "refresh token reused"})
+			return Session{}, ErrInvalidRefreshToken
+		}
+		log.Error(ctx, "there was an error rotating refresh token on refresh session", log.Err(err))
+		return Session{}, ErrStorageGet
+	}
+
+	userGet, err := userStorage.repository.GetUser(ctx, userID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting user on refresh session", log.Int64("user_id", userID),
+			log.Err(err))
+		if errors.Is(err, ErrUserNotFound) {
+			return Session{}, ErrInvalidRefreshToken
+		}
+		return Session{}, ErrStorageGet
+	}
+
+	if !userGet.Active {
+		log.Info(ctx, "invalid check on refresh session: the user is suspended", log.Int64("user_id", userGet.ID))
+		userStorage.audit(ctx, audit.Event{Type: audit.EventTokenRefreshFailed, UserID: userGet.ID,
+			Email: userGet.Email, Detail: "suspended user"})
+		return Session{}, ErrSuspendedUser
+	}
+
+	token, err := jwt.GenerateSessionToken(userGet.ID, userGet.Email, userGet.Role, rotated.Scope,
+		RolePermissions(userGet.Role), rotated.ID)
+	if err != nil {
+		log.Error(ctx, "there was an error while generating token on refresh session", log.Err(err))
+		return Session{}, err
+	}
+	userStorage.audit(ctx, audit.Event{Type: audit.EventTokenRefresh, UserID: userGet.ID, Email: userGet.Email})
+
+	return Session{Token: token, RefreshToken: newRefreshToken}, nil
+}
+
+// session return a session with a token with every permission of the role of the user restricted to the scope, and a
+// new refresh token stored for it on a new UserSession with the client on context and the scope. The token is issued
+// to the UserSession, so it can only be renewed while the session is active. The login of the user is recorded as a
+// security event
+func (userStorage UserStorage) session(ctx context.Context, user User, scope string) (Session, error) {
+	stored, refreshToken, err := userStorage.newRefreshToken()
+	if err != nil {
+		log.Error(ctx, "there was an error generating refresh token on login user", log.Err(err))
+		return Session{}, ErrGenerateSession
+	}
+
+	client := requestClient(ctx)
+	userSession, err := userStorage.repository.SaveSession(ctx, UserSession{
+		UserID:     user.ID,
+		IP:         client.IP,
+		UserAgent:  client.UserAgent,
+		Scope:      scope,
+		CreatedAt:  stored.CreatedAt,
+		LastUsedAt: stored.CreatedAt,
+		ExpiresAt:  stored.ExpiresAt,
+	})
+	if err != nil {
+		log.Error(ctx, "there was an error saving session on login user", log.Int64("user_id", user.ID),
+			log.Err(err))
+		return Session{}, ErrStorageSave
+	}
+
+	token, err := jwt.GenerateSessionToken(user.ID, user.Email, user.Role, scope, RolePermissions(user.Role),
+		userSession.ID)
+	if err != nil {
+		log.Error(ctx, "there was an error while generating token on login user", log.Err(err))
+		return Session{}, err
+	}
+
+	stored.UserID = user.ID
+	stored.SessionID = userSession.ID
+	if err := userStorage.repository.SaveRefreshToken(ctx, stored); err != nil {
+		log.Error(ctx, "there was an error saving refresh token on login user", log.Int64("user_id", user.ID),
+			log.Err(err))
+		return Session{}, ErrStorageSave
+	}
+	userStorage.audit(ctx, audit.Event{Type: audit.EventLogin, UserID: user.ID, Email: user.Email})
+
+	return Session{Token: token, RefreshToken: refreshToken}, nil
+}
+
+// newRefreshToken generate a random refresh token, it return the token to store (without user) and the token to
+// answer
+func (userStorage UserStorage) newRefreshToken() (RefreshToken, string, error) {
+	b := make([]byte, refreshTokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return RefreshToken{}, "", err
+	}
+
+	token := base64.RawURLEncoding.EncodeToString(b)
+	createdAt := userStorage.clock.Now().UTC().Truncate(time.Second)
+
+	return RefreshToken{
+		TokenHash: hashRefreshToken(token),
+		ExpiresAt: createdAt.Add(userStorage.refreshTokenTTL),
+		CreatedAt: createdAt,
+	}, token, nil
+}
+
+// hashRefreshToken return the hash of a refresh token as it is stored, so a leaked table cannot be used to refresh
+// sessions
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
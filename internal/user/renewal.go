@@ -0,0 +1,104 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"time"
+)
+
+// DefaultRenewalWindow is how long before their expiration the tokens are renewed when no other window is configured
+const DefaultRenewalWindow = 5 * time.Minute
+
+const tokenRenewalsMetricName = "application.space.token.renewals"
+
+// WithRenewalWindow will change how long before their expiration the tokens are renewed, a window which is not
+// positive disables the renewal
+func WithRenewalWindow(window time.Duration) UserStorageOption {
+	return func(ust *UserStorage) {
+		ust.renewalWindow = window
+	}
+}
+
+// RenewToken return a new token to the user of the claims if its token expires within the renewal window, with the
+// current permissions of its role, the same scope and the same session, so the users do not lose their session while
+// they use the application. It return an empty token when the token is not renewed: it does not expire within the
+// window, it is an impersonation token, which cannot outlive its ttl, or it was not issued to a session with every
+// permission of the role (as the two factor challenge and enrollment tokens). Tokens of a revoked or expired session,
+// and of suspended or deleted users, cannot be renewed
+func (userStorage UserStorage) RenewToken(ctx context.Context, claims jwt.Claims) (string, error) {
+	if userStorage.renewalWindow <= 0 || claims.ImpersonatorID != 0 || claims.SessionID == 0 {
+		return "", nil
+	}
+
+	if time.Unix(claims.Expiration, 0).Sub(userStorage.clock.Now()) > userStorage.renewalWindow {
+		return "", nil
+	}
+
+	for _, permission := range RolePermissions(claims.Role) {
+		if !Permissions(claims.Permissions).Has(permission) {
+			return "", nil
+		}
+	}
+
+	active, err := userStorage.activeSession(ctx, claims.UserID, claims.SessionID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting sessions on renew token", log.Int64("user_id", claims.UserID),
+			log.Err(err))
+		return "", ErrStorageGet
+	}
+	if !active {
+		log.Info(ctx, "invalid check on renew token: the session is revoked or expired",
+			log.Int64("user_id", claims.UserID), log.Int64("session_id", claims.SessionID))
+		metrics.Inc(ctx, tokenRenewalsMetricName, []string{"result", "revoked"})
+		return "", ErrNotFoundSession
+	}
+
+	userGet, err := userStorage.getUser(ctx, claims.UserID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting user on renew token", log.Int64("user_id", claims.UserID),
+			log.Err(err))
+		if errors.Is(err, ErrUserNotFound) {
+			return "", ErrNotFoundUser
+		}
+		return "", ErrStorageGet
+	}
+
+	if !userGet.Active {
+		log.Info(ctx, "invalid check on renew token: the user is suspended", log.Int64("user_id", userGet.ID))
+		metrics.Inc(ctx, tokenRenewalsMetricName, []string{"result", "suspended"})
+		return "", ErrSuspendedUser
+	}
+
+	token, err := jwt.GenerateSessionToken(userGet.ID, userGet.Email, userGet.Role, claims.Scope,
+		RolePermissions(userGet.Role), claims.SessionID)
+	if err != nil {
+		log.Error(ctx, "there was an error while generating token on renew token", log.Err(err))
+		return "", ErrGenerateSession
+	}
+
+	metrics.Inc(ctx, tokenRenewalsMetricName, []string{"result", "renewed"})
+	userStorage.audit(ctx, audit.Event{Type: audit.EventTokenRefresh, UserID: userGet.ID, Email: userGet.Email,
+		Detail: "token renewed"})
+
+	return token, nil
+}
+
+// activeSession return if the user has the session with the received id, and it was not revoked nor expired
+func (userStorage UserStorage) activeSession(ctx context.Context, userID, sessionID int64) (bool, error) {
+	sessions, err := userStorage.repository.GetSessions(ctx, userID)
+	if err != nil {
+		return false, err
+	}
+
+	for _, session := range sessions {
+		if session.ID == sessionID {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
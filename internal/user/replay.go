@@ -0,0 +1,50 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"time"
+)
+
+const tokenReplaysMetricName = "application.space.token.replays"
+
+// consumeToken mark the one-time token (of the received kind) with the id as consumed until its expiration, so it
+// cannot be used again. It return false if the token was already consumed, recording the replay. The tokens generated
+// before they had an id cannot be consumed, they are accepted until they expire
+func (userStorage UserStorage) consumeToken(ctx context.Context, kind, id string, expiration int64,
+	email string) (bool, error) {
+	if id == "" {
+		log.Info(ctx, "one-time token without id accepted", log.String("kind", kind), log.String("email", email))
+		return true, nil
+	}
+
+	err := userStorage.repository.ConsumeToken(ctx, id, time.Unix(expiration, 0).UTC())
+	if err == nil {
+		return true, nil
+	}
+
+	if !errors.Is(err, ErrTokenConsumed) {
+		log.Error(ctx, "there was an error consuming one-time token", log.String("kind", kind), log.Err(err))
+		return false, err
+	}
+
+	metrics.Inc(ctx, tokenReplaysMetricName, []string{"kind", kind})
+	userStorage.audit(ctx, audit.Event{Type: audit.EventTokenReplay, Email: email, Detail: kind + " replayed"})
+
+	return false, nil
+}
+
+// releaseToken undo the consumption of the one-time token with the id, for the actions which failed after consuming
+// it so the token can be used again
+func (userStorage UserStorage) releaseToken(ctx context.Context, kind, id string) {
+	if id == "" {
+		return
+	}
+
+	if err := userStorage.repository.ReleaseToken(ctx, id); err != nil {
+		log.Error(ctx, "there was an error releasing one-time token", log.String("kind", kind), log.Err(err))
+	}
+}
@@ -5,10 +5,14 @@ import (
 	"database/sql"
 	"errors"
 	"fmt"
-	_ "github.com/go-sql-driver/mysql"
+	"github.com/go-sql-driver/mysql"
+	"github.com/nicocarolo/space-drivers/internal/platform/config"
 	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"github.com/nicocarolo/space-drivers/internal/platform/tracing"
+	"github.com/nicocarolo/space-drivers/internal/platform/uuid"
 	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -19,14 +23,49 @@ const (
 	entityMetricName = "user"
 )
 
-var ErrUserNotFound = errors.New("not founded user")
+var (
+	ErrUserNotFound      = errors.New("not founded user")
+	ErrUserActiveTravels = errors.New("the user has active travels")
+	ErrUserDuplicated    = errors.New("there is already a user with the email")
+	ErrPreferencesLimit  = errors.New("the user has more preferences than allowed")
+
+	ErrRefreshTokenNotFound = errors.New("not founded refresh token or it is expired")
+	ErrRefreshTokenReused   = errors.New("the refresh token was already used")
+	ErrSessionNotFound      = errors.New("not founded session")
+	ErrTokenConsumed        = errors.New("the one-time token was already consumed")
+)
+
+// mysqlDuplicateEntry is the mysql error number of a unique key violation
+const mysqlDuplicateEntry = 1062
 
 type repository interface {
 	SaveUser(ctx context.Context, user User) (User, error)
 	GetUser(ctx context.Context, id int64) (User, error)
 	GetUserByEmail(ctx context.Context, email string) (User, error)
-	GetFreeDrivers(ctx context.Context) ([]User, error)
-	GetPaginate(ctx context.Context, limit, offset int64) ([]User, int64, error)
+	GetUserIDByUUID(ctx context.Context, publicID string) (int64, error)
+	UpdateUser(ctx context.Context, user User) (User, error)
+	UpdateStatus(ctx context.Context, user User) (User, error)
+	UpdatePassword(ctx context.Context, id int64, password string) error
+	UpdateTwoFactor(ctx context.Context, id int64, secret string, enabled bool) error
+	DeleteUser(ctx context.Context, id int64, deletedAt time.Time) error
+	AnonymizeUser(ctx context.Context, id int64, erasedAt time.Time) error
+	CountUsers(ctx context.Context) (int64, error)
+	GetPreferences(ctx context.Context, userID int64) (Preferences, error)
+	UpdatePreferences(ctx context.Context, userID int64, changes Preferences, maxKeys int) (Preferences, error)
+	GetFreeDrivers(ctx context.Context, availability DriverAvailability, zoneID, teamID int64, minRating float64,
+		limit, offset int64) ([]User, int64, error)
+	GetBusyDrivers(ctx context.Context, availability DriverAvailability, teamID int64, minRating float64) ([]User,
+		error)
+	GetPaginate(ctx context.Context, teamID int64, minRating float64, limit, offset int64) ([]User, int64, error)
+	GetByRole(ctx context.Context, role string, sort UserSort, limit, offset int64) ([]User, int64, error)
+	SaveRefreshToken(ctx context.Context, token RefreshToken) error
+	RotateRefreshToken(ctx context.Context, tokenHash string, next RefreshToken) (UserSession, error)
+	RevokeRefreshTokens(ctx context.Context, userID int64) error
+	SaveSession(ctx context.Context, session UserSession) (UserSession, error)
+	GetSessions(ctx context.Context, userID int64) ([]UserSession, error)
+	RevokeSession(ctx context.Context, userID, id int64) error
+	ConsumeToken(ctx context.Context, id string, expiresAt time.Time) error
+	ReleaseToken(ctx context.Context, id string) error
 }
 
 // SqlRepository sql client wrapper for user model
@@ -38,7 +77,7 @@ type SqlRepository struct {
 func NewRepository() (SqlRepository, error) {
 	dbname := os.Getenv("DB_NAME")
 	dbuser := os.Getenv("DB_USER")
-	dbpass := os.Getenv("DB_PASSWORD")
+	dbpass := config.Secret("DB_PASSWORD", "")
 	dbimage := os.Getenv("DB_IMAGE_NAME")
 	scope := os.Getenv("SCOPE")
 
@@ -50,9 +89,9 @@ func NewRepository() (SqlRepository, error) {
 			"(DB_USER, DB_PASSWORD, DB_IMAGE_NAME) are invalid")
 	}
 
-	dataSourceConnection := fmt.Sprintf("%s:%s@/%s", dbuser, dbpass, dbname)
+	dataSourceConnection := fmt.Sprintf("%s:%s@/%s?parseTime=true", dbuser, dbpass, dbname)
 	if scope != "" {
-		dataSourceConnection = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s", dbuser, dbpass, dbimage, dbname)
+		dataSourceConnection = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?parseTime=true", dbuser, dbpass, dbimage, dbname)
 	}
 	db, err := sql.Open("mysql", dataSourceConnection)
 	if err != nil {
@@ -64,18 +103,40 @@ func NewRepository() (SqlRepository, error) {
 	}, nil
 }
 
-// SaveUser will store a User on sql table
+// Close the connections to the db, once the repository is not used anymore
+func (sqlDb SqlRepository) Close() error {
+	return sqlDb.db.Close()
+}
+
+// Stats return the stats of the connections to the db, as the open and in use ones
+func (sqlDb SqlRepository) Stats() sql.DBStats {
+	return sqlDb.db.Stats()
+}
+
+// SaveUser will store a User on sql table as active, with a new uuid and the current date as its creation and
+// modification date
 func (sqlDb SqlRepository) SaveUser(ctx context.Context, user User) (User, error) {
-	q, err := sqlDb.db.Prepare("INSERT INTO users(email, password, role) VALUES(?, ?, ?)")
+	q, err := sqlDb.db.Prepare("INSERT INTO users(uuid, email, password, role, name, phone, license_number, " +
+		"active, created_at, updated_at) VALUES(?, ?, ?, ?, ?, ?, ?, ?, ?, ?)")
 	if err != nil {
 		return User{}, err
 	}
 
+	user.UUID, err = uuid.New()
+	if err != nil {
+		return User{}, err
+	}
+
+	user.Active, user.StatusReason = true, ""
+	user.CreatedAt = now()
+	user.UpdatedAt = user.CreatedAt
+
 	trackTime := trackElapsed(ctx, entityMetricName, "insert")
-	result, err := q.Exec(user.Email, user.Password, user.Role)
+	result, err := q.Exec(user.UUID, user.Email, user.Password, user.Role, user.Name, user.Phone, user.LicenseNumber,
+		user.Active, user.CreatedAt, user.UpdatedAt)
 	trackTime(err == nil)
 	if err != nil {
-		return User{}, err
+		return User{}, duplicatedError(err)
 	}
 
 	defer q.Close()
@@ -88,9 +149,556 @@ func (sqlDb SqlRepository) SaveUser(ctx context.Context, user User) (User, error
 	return user, nil
 }
 
+// now return the current date as stored on the datetime columns
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Second)
+}
+
+// duplicatedError return ErrUserDuplicated if the received error is due to a unique key violation (the email is
+// unique), otherwise the same error is returned
+func duplicatedError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return ErrUserDuplicated
+	}
+
+	return err
+}
+
+// UpdateUser will change the email, role and profile of the User with its id on sql table, the password is kept.
+// It return the user with the current date as its modification date
+func (sqlDb SqlRepository) UpdateUser(ctx context.Context, user User) (User, error) {
+	q, err := sqlDb.db.Prepare("UPDATE users SET email = ?, role = ?, name = ?, phone = ?, license_number = ?, " +
+		"updated_at = ? WHERE id = ? AND deleted_at IS NULL")
+	if err != nil {
+		return User{}, err
+	}
+
+	defer q.Close()
+
+	user.UpdatedAt = now()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "update")
+	_, err = q.ExecContext(ctx, user.Email, user.Role, user.Name, user.Phone, user.LicenseNumber, user.UpdatedAt,
+		user.ID)
+	trackTime(err == nil)
+	if err != nil {
+		return User{}, duplicatedError(err)
+	}
+
+	return user, nil
+}
+
+// UpdateStatus will change the active flag and the status reason of the User with its id on sql table. It return
+// the user with the current date as its modification date
+func (sqlDb SqlRepository) UpdateStatus(ctx context.Context, user User) (User, error) {
+	q, err := sqlDb.db.Prepare("UPDATE users SET active = ?, status_reason = ?, updated_at = ? WHERE id = ? AND " +
+		"deleted_at IS NULL")
+	if err != nil {
+		return User{}, err
+	}
+
+	defer q.Close()
+
+	user.UpdatedAt = now()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "update_status")
+	_, err = q.ExecContext(ctx, user.Active, user.StatusReason, user.UpdatedAt, user.ID)
+	trackTime(err == nil)
+	if err != nil {
+		return User{}, err
+	}
+
+	return user, nil
+}
+
+// UpdatePassword will replace the (already encrypted) password of the User with the received id on sql table
+func (sqlDb SqlRepository) UpdatePassword(ctx context.Context, id int64, password string) error {
+	q, err := sqlDb.db.Prepare("UPDATE users SET password = ?, updated_at = ? WHERE id = ? AND deleted_at IS NULL")
+	if err != nil {
+		return err
+	}
+
+	defer q.Close()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "update_password")
+	_, err = q.ExecContext(ctx, password, now(), id)
+	trackTime(err == nil)
+
+	return err
+}
+
+// UpdateTwoFactor will replace the two factor secret of the User with the received id on sql table, and enable or
+// disable its two factor authentication
+func (sqlDb SqlRepository) UpdateTwoFactor(ctx context.Context, id int64, secret string, enabled bool) error {
+	q, err := sqlDb.db.Prepare("UPDATE users SET totp_secret = ?, two_factor_enabled = ?, updated_at = ? WHERE id = ? " +
+		"AND deleted_at IS NULL")
+	if err != nil {
+		return err
+	}
+
+	defer q.Close()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "update_two_factor")
+	_, err = q.ExecContext(ctx, secret, enabled, now(), id)
+	trackTime(err == nil)
+
+	return err
+}
+
+// DeleteUser will soft delete the User with the received id setting its deleted date, all inside a transaction.
+// It return ErrUserNotFound if the user does not exist or is already deleted, and ErrUserActiveTravels if it has
+// pending, offered, queued or in process travels
+func (sqlDb SqlRepository) DeleteUser(ctx context.Context, id int64, deletedAt time.Time) error {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var userID int64
+	trackTime := trackElapsed(ctx, entityMetricName, "select_for_delete")
+	err = tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = ? AND deleted_at IS NULL FOR UPDATE", id).
+		Scan(&userID)
+	trackTime(err == nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	var activeTravels int64
+	trackTime = trackElapsed(ctx, "travel", "select_active_count")
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM travels WHERE user_id = ? AND deleted_at IS NULL AND "+
+		"status IN ('pending', 'offered', 'queued', 'in_process')", id).Scan(&activeTravels)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	if activeTravels > 0 {
+		return ErrUserActiveTravels
+	}
+
+	trackTime = trackElapsed(ctx, entityMetricName, "delete")
+	_, err = tx.ExecContext(ctx, "UPDATE users SET deleted_at = ?, updated_at = ? WHERE id = ?", deletedAt,
+		deletedAt, id)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// AnonymizeUser will replace the email of the user with the received id by an anonymous one, clear its password,
+// profile and two factor secret, delete its preferences, and suspend and delete it (keeping its deletion date if it
+// was deleted), in a single transaction. If the user has active travels then it is not changed
+func (sqlDb SqlRepository) AnonymizeUser(ctx context.Context, id int64, erasedAt time.Time) error {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	var userID int64
+	trackTime := trackElapsed(ctx, entityMetricName, "select_for_anonymize")
+	err = tx.QueryRowContext(ctx, "SELECT id FROM users WHERE id = ? FOR UPDATE", id).Scan(&userID)
+	trackTime(err == nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrUserNotFound
+		}
+		return err
+	}
+
+	var activeTravels int64
+	trackTime = trackElapsed(ctx, "travel", "select_active_count")
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM travels WHERE user_id = ? AND deleted_at IS NULL AND "+
+		"status IN ('pending', 'offered', 'queued', 'in_process')", id).Scan(&activeTravels)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	if activeTravels > 0 {
+		return ErrUserActiveTravels
+	}
+
+	trackTime = trackElapsed(ctx, entityMetricName, "anonymize")
+	_, err = tx.ExecContext(ctx, "UPDATE users SET email = ?, password = '', name = '', phone = '', "+
+		"license_number = '', totp_secret = '', two_factor_enabled = 0, active = 0, status_reason = ?, "+
+		"deleted_at = COALESCE(deleted_at, ?), updated_at = ? WHERE id = ?", anonymousEmail(id), ErasedStatusReason,
+		erasedAt, erasedAt, id)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	trackTime = trackElapsed(ctx, "user_preference", "delete")
+	_, err = tx.ExecContext(ctx, "DELETE FROM user_preferences WHERE user_id = ?", id)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	trackTime = trackElapsed(ctx, "refresh_token", "delete")
+	_, err = tx.ExecContext(ctx, "DELETE FROM refresh_tokens WHERE user_id = ?", id)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SaveRefreshToken will store the hash of a refresh token of a user on sql table
+func (sqlDb SqlRepository) SaveRefreshToken(ctx context.Context, token RefreshToken) error {
+	trackTime := trackElapsed(ctx, "refresh_token", "insert")
+	_, err := sqlDb.db.ExecContext(ctx, "INSERT INTO refresh_tokens(user_id, session_id, token_hash, expires_at, "+
+		"created_at) VALUES(?, ?, ?, ?, ?)", token.UserID, nullableID(token.SessionID), token.TokenHash, token.ExpiresAt,
+		token.CreatedAt)
+	trackTime(err == nil)
+
+	return err
+}
+
+// RotateRefreshToken will revoke the refresh token with the received hash and store the next one to the same user,
+// returning its session (with the user id and scope), all inside a transaction so a token is used once. It return
+// ErrRefreshTokenNotFound if the token does not exist, it is expired or its session was revoked, and
+// ErrRefreshTokenReused (with the user id) if it was already revoked, revoking every refresh token and session of the
+// user. The next token keeps the session of the token, which is extended to the next token expiration
+func (sqlDb SqlRepository) RotateRefreshToken(ctx context.Context, tokenHash string, next RefreshToken) (UserSession,
+	error) {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return UserSession{}, err
+	}
+
+	// rollback has no effect once the transaction is committed
+	defer tx.Rollback()
+
+	var id, userID int64
+	var sessionID sql.NullInt64
+	var expiresAt time.Time
+	var revokedAt, sessionRevokedAt sql.NullTime
+	var scope sql.NullString
+	trackTime := trackElapsed(ctx, "refresh_token", "select_for_rotate")
+	err = tx.QueryRowContext(ctx, "SELECT rt.id, rt.user_id, rt.session_id, rt.expires_at, rt.revoked_at, "+
+		"s.revoked_at, s.scope FROM refresh_tokens rt LEFT JOIN sessions s ON s.id = rt.session_id "+
+		"WHERE rt.token_hash = ? FOR UPDATE", tokenHash).
+		Scan(&id, &userID, &sessionID, &expiresAt, &revokedAt, &sessionRevokedAt, &scope)
+	trackTime(err == nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return UserSession{}, ErrRefreshTokenNotFound
+		}
+		return UserSession{}, err
+	}
+
+	// the tokens of a revoked session are not reused, they were revoked with it
+	if sessionRevokedAt.Valid {
+		return UserSession{}, ErrRefreshTokenNotFound
+	}
+
+	if revokedAt.Valid {
+		if err := revokeUserTokens(ctx, tx, userID, next.CreatedAt); err != nil {
+			return UserSession{}, err
+		}
+
+		if err := tx.Commit(); err != nil {
+			return UserSession{}, err
+		}
+
+		return UserSession{UserID: userID}, ErrRefreshTokenReused
+	}
+
+	if !expiresAt.After(next.CreatedAt) {
+		return UserSession{}, ErrRefreshTokenNotFound
+	}
+
+	trackTime = trackElapsed(ctx, "refresh_token", "revoke")
+	_, err = tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE id = ?", next.CreatedAt, id)
+	trackTime(err == nil)
+	if err != nil {
+		return UserSession{}, err
+	}
+
+	trackTime = trackElapsed(ctx, "refresh_token", "insert")
+	_, err = tx.ExecContext(ctx, "INSERT INTO refresh_tokens(user_id, session_id, token_hash, expires_at, "+
+		"created_at) VALUES(?, ?, ?, ?, ?)", userID, sessionID, next.TokenHash, next.ExpiresAt, next.CreatedAt)
+	trackTime(err == nil)
+	if err != nil {
+		return UserSession{}, err
+	}
+
+	if sessionID.Valid {
+		trackTime = trackElapsed(ctx, "session", "update_last_used")
+		_, err = tx.ExecContext(ctx, "UPDATE sessions SET last_used_at = ?, expires_at = ? WHERE id = ?",
+			next.CreatedAt, next.ExpiresAt, sessionID.Int64)
+		trackTime(err == nil)
+		if err != nil {
+			return UserSession{}, err
+		}
+	}
+
+	return UserSession{ID: sessionID.Int64, UserID: userID, Scope: scope.String}, tx.Commit()
+}
+
+// RevokeRefreshTokens will revoke every refresh token and session of the user with the received id
+func (sqlDb SqlRepository) RevokeRefreshTokens(ctx context.Context, userID int64) error {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// rollback has no effect once the transaction is committed
+	defer tx.Rollback()
+
+	if err := revokeUserTokens(ctx, tx, userID, now()); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// revokeUserTokens will revoke every refresh token and session of the user with the received id on the transaction
+func revokeUserTokens(ctx context.Context, tx *sql.Tx, userID int64, revokedAt time.Time) error {
+	trackTime := trackElapsed(ctx, "refresh_token", "revoke_all")
+	_, err := tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE user_id = ? "+
+		"AND revoked_at IS NULL", revokedAt, userID)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	trackTime = trackElapsed(ctx, "session", "revoke_all")
+	_, err = tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE user_id = ? AND revoked_at IS NULL",
+		revokedAt, userID)
+	trackTime(err == nil)
+
+	return err
+}
+
+// SaveSession will store a UserSession on sql table and return it with its id
+func (sqlDb SqlRepository) SaveSession(ctx context.Context, session UserSession) (UserSession, error) {
+	trackTime := trackElapsed(ctx, "session", "insert")
+	result, err := sqlDb.db.ExecContext(ctx, "INSERT INTO sessions(user_id, ip, user_agent, scope, created_at, "+
+		"last_used_at, expires_at) VALUES(?, ?, ?, ?, ?, ?, ?)", session.UserID, session.IP, session.UserAgent,
+		session.Scope, session.CreatedAt, session.LastUsedAt, session.ExpiresAt)
+	trackTime(err == nil)
+	if err != nil {
+		return UserSession{}, err
+	}
+
+	session.ID, err = result.LastInsertId()
+	if err != nil {
+		return UserSession{}, err
+	}
+
+	return session, nil
+}
+
+// GetSessions will get the sessions of the user with the received id which were not revoked nor expired, the most
+// recently used first
+func (sqlDb SqlRepository) GetSessions(ctx context.Context, userID int64) ([]UserSession, error) {
+	trackTime := trackElapsed(ctx, "session", "select_by_user")
+	rows, err := sqlDb.db.QueryContext(ctx, "SELECT id, user_id, ip, user_agent, scope, created_at, last_used_at, "+
+		"expires_at FROM sessions WHERE user_id = ? AND revoked_at IS NULL AND expires_at > ? "+
+		"ORDER BY last_used_at DESC, id DESC", userID, now())
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var sessions []UserSession
+	for rows.Next() {
+		var session UserSession
+		err := rows.Scan(&session.ID, &session.UserID, &session.IP, &session.UserAgent, &session.Scope,
+			&session.CreatedAt, &session.LastUsedAt, &session.ExpiresAt)
+		if err != nil {
+			return nil, err
+		}
+
+		sessions = append(sessions, session)
+	}
+
+	return sessions, rows.Err()
+}
+
+// RevokeSession will revoke the session with the received id of the user and its refresh tokens, it return
+// ErrSessionNotFound if the user has no active session with that id
+func (sqlDb SqlRepository) RevokeSession(ctx context.Context, userID, id int64) error {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	// rollback has no effect once the transaction is committed
+	defer tx.Rollback()
+
+	revokedAt := now()
+	trackTime := trackElapsed(ctx, "session", "revoke")
+	result, err := tx.ExecContext(ctx, "UPDATE sessions SET revoked_at = ? WHERE id = ? AND user_id = ? "+
+		"AND revoked_at IS NULL", revokedAt, id, userID)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrSessionNotFound
+	}
+
+	trackTime = trackElapsed(ctx, "refresh_token", "revoke_by_session")
+	_, err = tx.ExecContext(ctx, "UPDATE refresh_tokens SET revoked_at = ? WHERE session_id = ? "+
+		"AND revoked_at IS NULL", revokedAt, id)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConsumeToken will store the id of a one-time token as consumed until it expires, it return ErrTokenConsumed if it
+// was already consumed. The consumed tokens already expired are removed, they cannot be replayed anymore
+func (sqlDb SqlRepository) ConsumeToken(ctx context.Context, id string, expiresAt time.Time) error {
+	trackTime := trackElapsed(ctx, "consumed_token", "delete_expired")
+	_, err := sqlDb.db.ExecContext(ctx, "DELETE FROM consumed_tokens WHERE expires_at < ?", now())
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	trackTime = trackElapsed(ctx, "consumed_token", "insert")
+	_, err = sqlDb.db.ExecContext(ctx, "INSERT INTO consumed_tokens(jti, expires_at, consumed_at) VALUES(?, ?, ?)",
+		id, expiresAt, now())
+	trackTime(err == nil)
+
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return ErrTokenConsumed
+	}
+
+	return err
+}
+
+// ReleaseToken will remove the id of a consumed one-time token, so it can be used again
+func (sqlDb SqlRepository) ReleaseToken(ctx context.Context, id string) error {
+	trackTime := trackElapsed(ctx, "consumed_token", "delete")
+	_, err := sqlDb.db.ExecContext(ctx, "DELETE FROM consumed_tokens WHERE jti = ?", id)
+	trackTime(err == nil)
+
+	return err
+}
+
+// nullableID return the id as a sql null value when it is empty
+func nullableID(id int64) sql.NullInt64 {
+	return sql.NullInt64{Int64: id, Valid: id != 0}
+}
+
+// CountUsers will get the quantity of users on table, including the deleted ones
+func (sqlDb SqlRepository) CountUsers(ctx context.Context) (int64, error) {
+	var count int64
+	trackTime := trackElapsed(ctx, entityMetricName, "count")
+	err := sqlDb.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users").Scan(&count)
+	trackTime(err == nil)
+
+	return count, err
+}
+
+// GetPreferences will get the preferences of the user with the received id from table
+func (sqlDb SqlRepository) GetPreferences(ctx context.Context, userID int64) (Preferences, error) {
+	return selectPreferences(ctx, sqlDb.db, userID)
+}
+
+// UpdatePreferences will set the received preferences of the user with the received id, deleting the ones with an
+// empty value, and return all its preferences. All inside a transaction, it return ErrPreferencesLimit (without
+// changing them) if the user would have more than maxKeys preferences
+func (sqlDb SqlRepository) UpdatePreferences(ctx context.Context, userID int64, changes Preferences,
+	maxKeys int) (Preferences, error) {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer tx.Rollback()
+
+	updatedAt := now()
+	for key, value := range changes {
+		trackTime := trackElapsed(ctx, "user_preference", "upsert")
+		if value == "" {
+			_, err = tx.ExecContext(ctx, "DELETE FROM user_preferences WHERE user_id = ? AND `key` = ?", userID, key)
+		} else {
+			_, err = tx.ExecContext(ctx, "INSERT INTO user_preferences(user_id, `key`, value, updated_at) "+
+				"VALUES(?, ?, ?, ?) ON DUPLICATE KEY UPDATE value = VALUES(value), updated_at = VALUES(updated_at)",
+				userID, key, value, updatedAt)
+		}
+		trackTime(err == nil)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	preferences, err := selectPreferences(ctx, tx, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(preferences) > maxKeys {
+		return nil, ErrPreferencesLimit
+	}
+
+	return preferences, tx.Commit()
+}
+
+// queryer is the query capability shared by sql.DB and sql.Tx
+type queryer interface {
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+}
+
+// selectPreferences get the preferences of the user with the received id using the received db or transaction
+func selectPreferences(ctx context.Context, db queryer, userID int64) (Preferences, error) {
+	trackTime := trackElapsed(ctx, "user_preference", "select")
+	rows, err := db.QueryContext(ctx, "SELECT `key`, value FROM user_preferences WHERE user_id = ?", userID)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	preferences := make(Preferences)
+	for rows.Next() {
+		var key, value string
+		if err := rows.Scan(&key, &value); err != nil {
+			return nil, err
+		}
+
+		preferences[key] = value
+	}
+
+	return preferences, rows.Err()
+}
+
+// userColumns are the columns selected to read a User with its password
+const userColumns = "id, uuid, email, password, role, name, phone, license_number, active, status_reason, totp_secret, " +
+	"two_factor_enabled, created_at, updated_at"
+
 // GetUser will get a User who has the received id from table
 func (sqlDb SqlRepository) GetUser(ctx context.Context, id int64) (User, error) {
-	queryStatement := fmt.Sprintf("SELECT * FROM users WHERE id = ?")
+	queryStatement := fmt.Sprintf("SELECT %s FROM users WHERE id = ? AND deleted_at IS NULL", userColumns)
 
 	query, err := sqlDb.db.Prepare(queryStatement)
 	if err != nil {
@@ -103,7 +711,9 @@ func (sqlDb SqlRepository) GetUser(ctx context.Context, id int64) (User, error)
 	newRecord := query.QueryRowContext(ctx, id)
 
 	var user User
-	err = newRecord.Scan(&user.ID, &user.Email, &user.Password, &user.Role)
+	err = newRecord.Scan(&user.ID, &user.UUID, &user.Email, &user.Password, &user.Role, &user.Name, &user.Phone,
+		&user.LicenseNumber, &user.Active, &user.StatusReason, &user.TOTPSecret, &user.TwoFactorEnabled,
+		&user.CreatedAt, &user.UpdatedAt)
 	trackTime(err == nil)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -115,13 +725,24 @@ func (sqlDb SqlRepository) GetUser(ctx context.Context, id int64) (User, error)
 	return user, nil
 }
 
-func (sqlDb SqlRepository) GetPaginate(ctx context.Context, limit, offset int64) ([]User, int64, error) {
-	queryStatement := fmt.Sprintf("SELECT id, role, email FROM users WHERE role = 'driver' LIMIT %d, %d", limit, offset)
-	if offset == 0 {
-		queryStatement = fmt.Sprintf("SELECT id, role, email FROM users WHERE role = 'driver' LIMIT %d", limit)
+// GetPaginate will get a page of the drivers (not deleted) sorted by id, and the total count of them. With a team id
+// (other than 0) only the drivers members of that team are returned, and with a min rating (other than 0) only the
+// ones with an average rating of at least it
+func (sqlDb SqlRepository) GetPaginate(ctx context.Context, teamID int64, minRating float64, limit,
+	offset int64) ([]User, int64, error) {
+	condition := "role = 'driver' AND deleted_at IS NULL"
+	var args []interface{}
+	if teamID != 0 {
+		condition += teamCondition
+		args = append(args, teamID)
+	}
+	if minRating != 0 {
+		condition += " AND ratings.average >= ?"
+		args = append(args, minRating)
 	}
 
-	query, err := sqlDb.db.Prepare(queryStatement)
+	query, err := sqlDb.db.Prepare(fmt.Sprintf("SELECT %s FROM users %s WHERE %s ORDER BY id LIMIT ? OFFSET ?",
+		driverColumns, driverRatingJoin, condition))
 	if err != nil {
 		return nil, 0, err
 	}
@@ -129,53 +750,212 @@ func (sqlDb SqlRepository) GetPaginate(ctx context.Context, limit, offset int64)
 	defer query.Close()
 
 	trackTime := trackElapsed(ctx, entityMetricName, "select_paginate")
-	rows, err := query.QueryContext(ctx)
+	rows, err := query.QueryContext(ctx, append(args, limit, offset)...)
 	trackTime(err == nil)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, 0, ErrUserNotFound
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		user, err := scanDriver(rows)
+		if err != nil {
+			return nil, 0, err
 		}
+
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
 		return nil, 0, err
+	}
 
+	count, err := sqlDb.db.Prepare(fmt.Sprintf("SELECT COUNT(*) FROM users %s WHERE %s", driverRatingJoin, condition))
+	if err != nil {
+		return nil, 0, err
 	}
 
+	defer count.Close()
+
+	var total int64
+	trackTime = trackElapsed(ctx, entityMetricName, "select_count")
+	err = count.QueryRowContext(ctx, args...).Scan(&total)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// GetFreeDrivers will get a page of the active (not suspended) drivers without travels on any of the busy statuses
+// sorted by id, and the total count of them. The drivers are the users with any of the roles of the availability.
+// With a zone id (other than 0) only the drivers registered on that zone are returned, with a team id (other than 0)
+// only the members of that team, and with a min rating (other than 0) only the ones with an average rating of at
+// least it
+func (sqlDb SqlRepository) GetFreeDrivers(ctx context.Context, availability DriverAvailability, zoneID, teamID int64,
+	minRating float64, limit, offset int64) ([]User, int64, error) {
+	condition := fmt.Sprintf("role IN (%s) AND active = 1 AND deleted_at IS NULL AND id NOT IN (select user_id "+
+		"from travels WHERE user_id IS NOT NULL AND deleted_at IS NULL AND status IN (%s))",
+		placeholders(len(availability.Roles)), placeholders(len(availability.BusyStatuses)))
+
+	args := append(stringArgs(availability.Roles), stringArgs(availability.BusyStatuses)...)
+	if zoneID != 0 {
+		condition += " AND id IN (SELECT user_id FROM zone_drivers WHERE zone_id = ?)"
+		args = append(args, zoneID)
+	}
+	if teamID != 0 {
+		condition += teamCondition
+		args = append(args, teamID)
+	}
+	if minRating != 0 {
+		condition += " AND ratings.average >= ?"
+		args = append(args, minRating)
+	}
+
+	query, err := sqlDb.db.Prepare(fmt.Sprintf("SELECT %s FROM users %s WHERE %s ORDER BY id LIMIT ? OFFSET ?",
+		driverColumns, driverRatingJoin, condition))
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer query.Close()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "select_free")
+	rows, err := query.QueryContext(ctx, append(args, limit, offset)...)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer rows.Close()
+
 	var users []User
 	for rows.Next() {
-		var user User
-		err := rows.Scan(&user.ID, &user.Role, &user.Email)
+		user, err := scanDriver(rows)
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				return nil, 0, ErrUserNotFound
-			}
 			return nil, 0, err
 		}
 
 		users = append(users, user)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+
+	count, err := sqlDb.db.Prepare(fmt.Sprintf("SELECT COUNT(*) FROM users %s WHERE %s", driverRatingJoin, condition))
+	if err != nil {
+		return nil, 0, err
+	}
 
-	queryStatement = "SELECT COUNT(*) FROM users"
+	defer count.Close()
 
-	trackTime = trackElapsed(ctx, entityMetricName, "select_count")
-	query, err = sqlDb.db.Prepare(queryStatement)
+	var total int64
+	trackTime = trackElapsed(ctx, entityMetricName, "count_free")
+	err = count.QueryRowContext(ctx, args...).Scan(&total)
 	trackTime(err == nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
+}
+
+// userSortOrder is the order clause of each sort of the users, the most recent users first when sorted by date
+var userSortOrder = map[UserSort]string{
+	SortByID:        "id",
+	SortByCreatedAt: "created_at DESC, id DESC",
+	SortByUpdatedAt: "updated_at DESC, id DESC",
+}
+
+// GetByRole will get a page of the users (not deleted) with the received role sorted as received (by id if the sort
+// is unknown), or of every role if it is empty, and the total count of them
+func (sqlDb SqlRepository) GetByRole(ctx context.Context, role string, sort UserSort, limit,
+	offset int64) ([]User, int64, error) {
+	condition := "deleted_at IS NULL"
+	var args []interface{}
+	if role != "" {
+		condition += " AND role = ?"
+		args = append(args, role)
+	}
 
+	order, ok := userSortOrder[sort]
+	if !ok {
+		order = userSortOrder[SortByID]
+	}
+
+	query, err := sqlDb.db.Prepare("SELECT id, uuid, email, role, name, phone, license_number, active, " +
+		"status_reason, created_at, updated_at FROM users WHERE " + condition + " ORDER BY " + order + " LIMIT ? OFFSET ?")
 	if err != nil {
 		return nil, 0, err
 	}
 
 	defer query.Close()
 
-	newRecord := query.QueryRowContext(ctx)
+	trackTime := trackElapsed(ctx, entityMetricName, "select_by_role")
+	rows, err := query.QueryContext(ctx, append(args, limit, offset)...)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, 0, err
+	}
 
-	var count int64
-	err = newRecord.Scan(&count)
+	defer rows.Close()
+
+	var users []User
+	for rows.Next() {
+		var user User
+		err := rows.Scan(&user.ID, &user.UUID, &user.Email, &user.Role, &user.Name, &user.Phone, &user.LicenseNumber,
+			&user.Active, &user.StatusReason, &user.CreatedAt, &user.UpdatedAt)
+		if err != nil {
+			return nil, 0, err
+		}
+
+		users = append(users, user)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
 
-	return users, count, nil
+	count, err := sqlDb.db.Prepare("SELECT COUNT(*) FROM users WHERE " + condition)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	defer count.Close()
+
+	var total int64
+	trackTime = trackElapsed(ctx, entityMetricName, "count_by_role")
+	err = count.QueryRowContext(ctx, args...).Scan(&total)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	return users, total, nil
 }
 
-func (sqlDb SqlRepository) GetFreeDrivers(ctx context.Context) ([]User, error) {
-	queryStatement := fmt.Sprintf("SELECT id, role, email FROM users WHERE role = 'driver' AND id NOT IN " +
-		"(select user_id from travels WHERE user_id IS NOT NULL AND (status = 'Pending' OR status = 'in_process'))")
+// GetBusyDrivers will get the drivers (users with any of the roles of the availability) with travels on any of the
+// busy statuses, with the id of the (oldest) travel they are busy with. With a team id (other than 0) only the
+// drivers members of that team are returned, and with a min rating (other than 0) only the ones with an average rating
+// of at least it
+func (sqlDb SqlRepository) GetBusyDrivers(ctx context.Context, availability DriverAvailability, teamID int64,
+	minRating float64) ([]User, error) {
+	condition := fmt.Sprintf("role IN (%s) AND deleted_at IS NULL", placeholders(len(availability.Roles)))
+	args := append(stringArgs(availability.BusyStatuses), stringArgs(availability.Roles)...)
+	if teamID != 0 {
+		condition += teamCondition
+		args = append(args, teamID)
+	}
+	if minRating != 0 {
+		condition += " AND ratings.average >= ?"
+		args = append(args, minRating)
+	}
+
+	queryStatement := fmt.Sprintf("SELECT %s, busy.travel_id FROM users %s JOIN "+
+		"(SELECT user_id, MIN(id) AS travel_id FROM travels WHERE user_id IS NOT NULL AND deleted_at IS NULL AND "+
+		"status IN (%s) GROUP BY user_id) busy ON busy.user_id = users.id WHERE %s ORDER BY id",
+		driverColumns, driverRatingJoin, placeholders(len(availability.BusyStatuses)), condition)
 
 	query, err := sqlDb.db.Prepare(queryStatement)
 	if err != nil {
@@ -184,37 +964,96 @@ func (sqlDb SqlRepository) GetFreeDrivers(ctx context.Context) ([]User, error) {
 
 	defer query.Close()
 
-	trackTime := trackElapsed(ctx, entityMetricName, "select_free")
-	rows, err := query.QueryContext(ctx)
+	trackTime := trackElapsed(ctx, entityMetricName, "select_busy")
+	rows, err := query.QueryContext(ctx, args...)
 	trackTime(err == nil)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			return nil, ErrUserNotFound
-		}
 		return nil, err
-
 	}
 
+	defer rows.Close()
+
 	var users []User
 	for rows.Next() {
-		var user User
-		err := rows.Scan(&user.ID, &user.Role, &user.Email)
+		var travelID int64
+		user, err := scanDriver(rows, &travelID)
 		if err != nil {
-			if errors.Is(err, sql.ErrNoRows) {
-				return nil, ErrUserNotFound
-			}
 			return nil, err
 		}
 
+		user.TravelID = &travelID
 		users = append(users, user)
 	}
 
-	return users, nil
+	return users, rows.Err()
+}
+
+// placeholders return n comma separated placeholders, to query with an IN clause
+func placeholders(n int) string {
+	return strings.TrimSuffix(strings.Repeat("?, ", n), ", ")
+}
+
+// stringArgs return the values as query arguments
+func stringArgs(values []string) []interface{} {
+	args := make([]interface{}, 0, len(values))
+	for _, value := range values {
+		args = append(args, value)
+	}
+
+	return args
+}
+
+// teamCondition filter the drivers on the members of a team
+const teamCondition = " AND id IN (SELECT user_id FROM team_members WHERE team_id = ?)"
+
+// driverColumns are the columns selected on drivers search, including its rating aggregation
+const driverColumns = "id, uuid, role, email, name, phone, license_number, active, status_reason, created_at, updated_at, " +
+	"ratings.average, COALESCE(ratings.count, 0)"
+
+// driverRatingJoin join the users with the aggregation of the ratings received on their travels
+const driverRatingJoin = "LEFT JOIN (SELECT user_id, AVG(score) AS average, COUNT(*) AS count FROM ratings " +
+	"GROUP BY user_id) ratings ON ratings.user_id = users.id"
+
+// scanDriver read a driver selected with driverColumns, followed by the extra columns scanned into dest
+func scanDriver(rows *sql.Rows, dest ...interface{}) (User, error) {
+	var user User
+	var average sql.NullFloat64
+	var count int64
+	columns := []interface{}{&user.ID, &user.UUID, &user.Role, &user.Email, &user.Name, &user.Phone, &user.LicenseNumber,
+		&user.Active, &user.StatusReason, &user.CreatedAt, &user.UpdatedAt, &average, &count}
+	err := rows.Scan(append(columns, dest...)...)
+	if err != nil {
+		return User{}, err
+	}
+
+	user.Rating = &DriverRating{
+		Average: average.Float64,
+		Count:   count,
+	}
+
+	return user, nil
+}
+
+// GetUserIDByUUID will get the id of the User (not deleted) who has the received uuid
+func (sqlDb SqlRepository) GetUserIDByUUID(ctx context.Context, publicID string) (int64, error) {
+	var id int64
+	trackTime := trackElapsed(ctx, entityMetricName, "select_by_uuid")
+	err := sqlDb.db.QueryRowContext(ctx, "SELECT id FROM users WHERE uuid = ? AND deleted_at IS NULL", publicID).
+		Scan(&id)
+	trackTime(err == nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrUserNotFound
+		}
+		return 0, err
+	}
+
+	return id, nil
 }
 
 // GetUser will get a User who has the received id from table
 func (sqlDb SqlRepository) GetUserByEmail(ctx context.Context, email string) (User, error) {
-	queryStatement := fmt.Sprintf("SELECT * FROM users WHERE email = ?")
+	queryStatement := fmt.Sprintf("SELECT %s FROM users WHERE email = ? AND deleted_at IS NULL", userColumns)
 
 	query, err := sqlDb.db.Prepare(queryStatement)
 	if err != nil {
@@ -227,7 +1066,9 @@ func (sqlDb SqlRepository) GetUserByEmail(ctx context.Context, email string) (Us
 	newRecord := query.QueryRowContext(ctx, email)
 
 	var user User
-	err = newRecord.Scan(&user.ID, &user.Email, &user.Password, &user.Role)
+	err = newRecord.Scan(&user.ID, &user.UUID, &user.Email, &user.Password, &user.Role, &user.Name, &user.Phone,
+		&user.LicenseNumber, &user.Active, &user.StatusReason, &user.TOTPSecret, &user.TwoFactorEnabled,
+		&user.CreatedAt, &user.UpdatedAt)
 	trackTime(err == nil)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
@@ -239,13 +1080,23 @@ func (sqlDb SqlRepository) GetUserByEmail(ctx context.Context, email string) (Us
 	return user, nil
 }
 
+// trackElapsed trace the time of a query as a metric and a span of the trace of the context
 func trackElapsed(ctx context.Context, entity, action string) func(success bool) {
 	start := time.Now()
+	_, span := tracing.Start(ctx, tracing.KindClient, action+" "+entity, []string{
+		"db.system", "mysql",
+		"db.operation", action,
+		"db.sql.table", entity})
 	return func(success bool) {
 		metrics.Timing(ctx, timeMetricName, time.Since(start),
 			[]string{
 				"result", strconv.FormatBool(success),
 				"action", action,
 				"entity", entity})
+
+		if !success {
+			span.Fail("the query failed")
+		}
+		span.End()
 	}
 }
@@ -0,0 +1,28 @@
+package user
+
+import "github.com/nicocarolo/space-drivers/internal/platform/code_error"
+
+// Scopes of the tokens, a scoped token can only access the endpoints of its scope whatever its permissions
+const (
+	// ScopeDriverApp restricts the token to the endpoints of the mobile driver app: the own profile and travels and
+	// the location reports
+	ScopeDriverApp = "driver_app"
+)
+
+var ErrInvalidScope = code_error.Error{Code: "invalid_scope", Detail: "the scope should be driver_app, and it can only be requested by drivers"}
+
+// scopeRoles are the roles which can request each scope
+var scopeRoles = map[string]string{
+	ScopeDriverApp: RoleDriver,
+}
+
+// knownScope return if the scope is empty (no restriction) or one of the known scopes
+func knownScope(scope string) bool {
+	_, ok := scopeRoles[scope]
+	return scope == "" || ok
+}
+
+// validScope return if the scope is empty or the role can request it
+func validScope(scope, role string) bool {
+	return scope == "" || scopeRoles[scope] == role
+}
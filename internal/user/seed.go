@@ -0,0 +1,48 @@
+package user
+
+import (
+	"context"
+	"errors"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+)
+
+var (
+	ErrInvalidSeedPassword = code_error.Error{Code: "invalid_password", Detail: "the password of the admin to seed cannot be empty"}
+)
+
+// SeedAdmin will create an admin with the received email and password if there are no users yet (deleted users are
+// counted too), so the first admin can login to create the other users. It return if the admin was created, an admin
+// created at the same time by another instance is not an error
+func (userStorage UserStorage) SeedAdmin(ctx context.Context, email, password string) (bool, error) {
+	if password == "" {
+		log.Info(ctx, "invalid check on seed admin: empty password", log.String("email", email))
+		return false, ErrInvalidSeedPassword
+	}
+
+	count, err := userStorage.repository.CountUsers(ctx)
+	if err != nil {
+		log.Error(ctx, "there was an error counting users on seed admin", log.Err(err))
+		return false, ErrStorageGet
+	}
+
+	if count > 0 {
+		return false, nil
+	}
+
+	admin, err := userStorage.Save(ctx, User{
+		SecuredUser: SecuredUser{Email: email, Role: RoleAdmin},
+		Password:    password,
+	})
+	if err != nil {
+		if errors.Is(err, ErrEmailAlreadyExists) {
+			return false, nil
+		}
+		return false, err
+	}
+
+	auditlog.Log(ctx, "admin seeded", log.Int64("user_id", admin.ID), log.String("email", admin.Email))
+
+	return true, nil
+}
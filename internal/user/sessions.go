@@ -0,0 +1,71 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"time"
+)
+
+var ErrNotFoundSession = code_error.Error{Code: "not_found_session", Detail: "not founded the session to get"}
+
+// UserSession is a session opened by a login of the user on a device, it lasts while its refresh tokens can be used.
+// The ip and user agent are the ones of the login, and the scope is the one of its tokens
+type UserSession struct {
+	ID         int64     `json:"id"`
+	UserID     int64     `json:"-"`
+	IP         string    `json:"ip"`
+	UserAgent  string    `json:"user_agent"`
+	Scope      string    `json:"scope,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	LastUsedAt time.Time `json:"last_used_at"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// ListSessions return the active sessions of the user logged in: the ones which were not revoked nor expired
+func (userStorage UserStorage) ListSessions(ctx context.Context) ([]UserSession, error) {
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims on list sessions")
+		return nil, ErrInvalidUserClaims
+	}
+
+	sessions, err := userStorage.repository.GetSessions(ctx, userLogged.UserID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting sessions", log.Int64("user_id", userLogged.UserID), log.Err(err))
+		return nil, ErrStorageGet
+	}
+
+	if sessions == nil {
+		sessions = []UserSession{}
+	}
+
+	return sessions, nil
+}
+
+// RevokeSession will revoke the session with the received id of the user logged in, its refresh tokens cannot be
+// used anymore. The tokens already issued to the session are valid until they expire, but they cannot be renewed
+func (userStorage UserStorage) RevokeSession(ctx context.Context, id int64) error {
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims on revoke session",
+			log.Int64("session_id", id))
+		return ErrInvalidUserClaims
+	}
+
+	if err := userStorage.repository.RevokeSession(ctx, userLogged.UserID, id); err != nil {
+		log.Error(ctx, "there was an error revoking session", log.Int64("user_id", userLogged.UserID),
+			log.Int64("session_id", id), log.Err(err))
+		if errors.Is(err, ErrSessionNotFound) {
+			return ErrNotFoundSession
+		}
+		return ErrStorageUpdate
+	}
+	userStorage.audit(ctx, audit.Event{Type: audit.EventTokenRevoked, UserID: userLogged.UserID,
+		Detail: "session revoked"})
+
+	return nil
+}
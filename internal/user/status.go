@@ -0,0 +1,74 @@
+package user
+
+import (
+	"context"
+	"errors"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+)
+
+var (
+	ErrInvalidStatusAccess = code_error.Error{Code: "invalid_user_access", Detail: "the user logged in cannot change its own status"}
+)
+
+// StatusChange is the suspension (active false) or activation of a user, with the reason of the change
+type StatusChange struct {
+	Active *bool  `json:"active" binding:"required"`
+	Reason string `json:"reason" binding:"max=255"`
+}
+
+// ChangeStatus will suspend or activate the user with the received id and return it. A suspended user cannot login,
+// is not found on free drivers search and cannot be assigned to travels. The user logged in cannot change its own
+// status, and every change is logged on the audit log with its reason
+func (userStorage UserStorage) ChangeStatus(ctx context.Context, id int64, change StatusChange) (SecuredUser, error) {
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims on change user status",
+			log.Int64("user_id", id))
+		return SecuredUser{}, ErrInvalidUserClaims
+	}
+
+	if userLogged.UserID == id {
+		log.Info(ctx, "invalid check on change user status: the user logged in cannot change its own status",
+			log.Int64("user_id", id))
+		return SecuredUser{}, ErrInvalidStatusAccess
+	}
+
+	current, err := userStorage.repository.GetUser(ctx, id)
+	if err != nil {
+		log.Error(ctx, "there was an error getting user on change status", log.Int64("user_id", id), log.Err(err))
+		if errors.Is(err, ErrUserNotFound) {
+			return SecuredUser{}, ErrNotFoundUser
+		}
+		return SecuredUser{}, ErrStorageGet
+	}
+
+	current.Active = *change.Active
+	current.StatusReason = change.Reason
+	current, err = userStorage.repository.UpdateStatus(ctx, current)
+	userStorage.invalidateUser(id)
+	if err != nil {
+		log.Error(ctx, "there was an error changing user status", log.Int64("user_id", id), log.Err(err))
+		return SecuredUser{}, ErrStorageUpdate
+	}
+
+	auditlog.Log(ctx, "user status changed",
+		log.Int64("user_id", id),
+		log.Bool("active", current.Active),
+		log.String("reason", current.StatusReason),
+		log.Int64("logged_user_id", userLogged.UserID))
+
+	return SecuredUser{
+		ID:           current.ID,
+		UUID:         current.UUID,
+		Email:        current.Email,
+		Role:         current.Role,
+		Profile:      current.Profile,
+		Active:       current.Active,
+		StatusReason: current.StatusReason,
+		CreatedAt:    current.CreatedAt,
+		UpdatedAt:    current.UpdatedAt,
+	}, nil
+}
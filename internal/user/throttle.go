@@ -0,0 +1,227 @@
+package user
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	loginFailuresMetricName  = "application.space.login.failures"
+	loginThrottledMetricName = "application.space.login.throttled"
+)
+
+var ErrTooManyLoginAttempts = code_error.Error{Code: "too_many_login_attempts", Detail: "there were too many failed login attempts, try again later"}
+
+// LoginThrottleConfig is how the failed logins are throttled: after MaxFailures failures of an email its logins are
+// blocked for Backoff, doubled on each new failure up to MaxBackoff, and after IPMaxFailures failures of an ip (of
+// any email) its logins are banned for IPBan. The failures are forgotten after Window without new ones
+type LoginThrottleConfig struct {
+	MaxFailures   int
+	Backoff       time.Duration
+	MaxBackoff    time.Duration
+	IPMaxFailures int
+	IPBan         time.Duration
+	Window        time.Duration
+}
+
+// DefaultLoginThrottle is the LoginThrottleConfig used for the values which are not configured
+var DefaultLoginThrottle = LoginThrottleConfig{
+	MaxFailures:   5,
+	Backoff:       30 * time.Second,
+	MaxBackoff:    15 * time.Minute,
+	IPMaxFailures: 20,
+	IPBan:         15 * time.Minute,
+	Window:        15 * time.Minute,
+}
+
+// LoginThrottle is an in-memory register of the failed logins by email and ip, to block credential stuffing and
+// brute force attacks. It is safe for concurrent use, so the same throttle can be shared by every UserStorage
+type LoginThrottle struct {
+	mu     sync.Mutex
+	config LoginThrottleConfig
+	emails map[string]*loginFailures
+	ips    map[string]*loginFailures
+	// lastSweep is when the forgotten failures were removed for the last time
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type loginFailures struct {
+	count        int
+	last         time.Time
+	blockedUntil time.Time
+}
+
+// NewLoginThrottle creates and return a LoginThrottle with the received config, the values which are not positive
+// are taken from DefaultLoginThrottle
+func NewLoginThrottle(config LoginThrottleConfig) *LoginThrottle {
+	if config.MaxFailures <= 0 {
+		config.MaxFailures = DefaultLoginThrottle.MaxFailures
+	}
+	if config.Backoff <= 0 {
+		config.Backoff = DefaultLoginThrottle.Backoff
+	}
+	if config.MaxBackoff <= 0 {
+		config.MaxBackoff = DefaultLoginThrottle.MaxBackoff
+	}
+	if config.IPMaxFailures <= 0 {
+		config.IPMaxFailures = DefaultLoginThrottle.IPMaxFailures
+	}
+	if config.IPBan <= 0 {
+		config.IPBan = DefaultLoginThrottle.IPBan
+	}
+	if config.Window <= 0 {
+		config.Window = DefaultLoginThrottle.Window
+	}
+
+	return &LoginThrottle{
+		config: config,
+		emails: make(map[string]*loginFailures),
+		ips:    make(map[string]*loginFailures),
+		now:    time.Now,
+	}
+}
+
+// WithLoginThrottle will block the logins of the emails and ips with too many failed logins with the received
+// throttle, a nil throttle disables it
+func WithLoginThrottle(throttle *LoginThrottle) UserStorageOption {
+	return func(ust *UserStorage) {
+		ust.throttle = throttle
+	}
+}
+
+// allowLogin return if the login of the email from the client on context is not blocked, the blocked logins are
+// recorded as failed
+func (userStorage UserStorage) allowLogin(ctx context.Context, email string) bool {
+	if userStorage.throttle == nil {
+		return true
+	}
+
+	by, blocked := userStorage.throttle.blocked(normalizeEmail(email), requestClient(ctx).IP)
+	if !blocked {
+		return true
+	}
+
+	metrics.Inc(ctx, loginThrottledMetricName, []string{"by", by})
+	userStorage.audit(ctx, audit.Event{Type: audit.EventLoginFailed, Email: email,
+		Detail: "too many attempts by " + by})
+
+	return false
+}
+
+// loginFailed register a failed login of the email from the client on context
+func (userStorage UserStorage) loginFailed(ctx context.Context, email, reason string) {
+	metrics.Inc(ctx, loginFailuresMetricName, []string{"reason", reason})
+	if userStorage.throttle == nil {
+		return
+	}
+
+	userStorage.throttle.fail(normalizeEmail(email), requestClient(ctx).IP)
+}
+
+// loginSucceeded forget the failed logins of the email
+func (userStorage UserStorage) loginSucceeded(email string) {
+	if userStorage.throttle == nil {
+		return
+	}
+
+	userStorage.throttle.reset(normalizeEmail(email))
+}
+
+// blocked return if the logins of the email or the ip are blocked, and which of them is
+func (t *LoginThrottle) blocked(email, ip string) (string, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	if failures, ok := t.ips[ip]; ok && ip != "" && now.Before(failures.blockedUntil) {
+		return "ip", true
+	}
+
+	if failures, ok := t.emails[email]; ok && now.Before(failures.blockedUntil) {
+		return "email", true
+	}
+
+	return "", false
+}
+
+// fail register a failed login of the email from the ip, blocking them if they reach their max failures
+func (t *LoginThrottle) fail(email, ip string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	now := t.now()
+	t.sweep(now)
+
+	failures := t.failures(t.emails, email, now)
+	if failures.count >= t.config.MaxFailures {
+		backoff := t.config.Backoff << uint(failures.count-t.config.MaxFailures)
+		if backoff > t.config.MaxBackoff || backoff <= 0 {
+			backoff = t.config.MaxBackoff
+		}
+		failures.blockedUntil = now.Add(backoff)
+	}
+
+	if ip == "" {
+		return
+	}
+
+	failures = t.failures(t.ips, ip, now)
+	if failures.count >= t.config.IPMaxFailures {
+		failures.blockedUntil = now.Add(t.config.IPBan)
+	}
+}
+
+// reset forget the failed logins of the email
+func (t *LoginThrottle) reset(email string) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	delete(t.emails, email)
+}
+
+// failures add a failure to the key on the received register and return its failures, the failures older than the
+// window are forgotten
+func (t *LoginThrottle) failures(register map[string]*loginFailures, key string, now time.Time) *loginFailures {
+	failures, ok := register[key]
+	if !ok || t.forgotten(failures, now) {
+		failures = &loginFailures{}
+		register[key] = failures
+	}
+
+	failures.count++
+	failures.last = now
+
+	return failures
+}
+
+// forgotten return if the failures are older than the window and they are not blocked
+func (t *LoginThrottle) forgotten(failures *loginFailures, now time.Time) bool {
+	return now.Sub(failures.last) > t.config.Window && !now.Before(failures.blockedUntil)
+}
+
+// sweep remove the forgotten failures, at most once each window
+func (t *LoginThrottle) sweep(now time.Time) {
+	if now.Sub(t.lastSweep) < t.config.Window {
+		return
+	}
+	t.lastSweep = now
+
+	for _, register := range []map[string]*loginFailures{t.emails, t.ips} {
+		for key, failures := range register {
+			if t.forgotten(failures, now) {
+				delete(register, key)
+			}
+		}
+	}
+}
+
+// normalizeEmail return the email as it is throttled, so the case of the email does not avoid the throttle
+func normalizeEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
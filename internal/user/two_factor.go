@@ -0,0 +1,198 @@
+package user
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/platform/totp"
+	"time"
+)
+
+// DefaultTwoFactorIssuer is the issuer shown by the authenticator apps for the enrolled secrets
+const DefaultTwoFactorIssuer = "Space Drivers"
+
+var (
+	ErrInvalidChallenge        = code_error.Error{Code: "invalid_challenge", Detail: "the two factor challenge received is invalid or expired"}
+	ErrInvalidTwoFactorCode    = code_error.Error{Code: "invalid_two_factor_code", Detail: "the two factor code received is invalid"}
+	ErrTwoFactorAlreadyEnabled = code_error.Error{Code: "two_factor_already_enabled", Detail: "the user has already enabled two factor authentication"}
+	ErrTwoFactorNotEnrolled    = code_error.Error{Code: "two_factor_not_enrolled", Detail: "the user has not enrolled two factor authentication"}
+)
+
+// Session is the result of a login: the token to authenticate the user, or the challenge to send with the two factor
+// code when the user has two factor authentication
+type Session struct {
+	Token     string `json:"token,omitempty"`
+	Challenge string `json:"challenge,omitempty"`
+	// RefreshToken is returned with the token, to get a new session with Refresh once the token expires
+	RefreshToken string `json:"refresh_token,omitempty"`
+	// TwoFactorEnrollment is true when the role requires two factor authentication and the user did not enroll it,
+	// the token only allows to enroll it
+	TwoFactorEnrollment bool `json:"two_factor_enrollment,omitempty"`
+}
+
+// TwoFactorEnrollment is the secret generated to enroll the two factor authentication, with its provisioning uri to
+// show it as a QR code to authenticator apps
+type TwoFactorEnrollment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"uri"`
+}
+
+type twoFactorConfig struct {
+	issuer string
+	// roles which require two factor authentication to login
+	roles map[string]bool
+}
+
+// WithTwoFactor will change the issuer of the enrolled secrets and require two factor authentication to login to the
+// users with the received roles. Users of other roles can enroll it optionally
+func WithTwoFactor(issuer string, roles ...string) UserStorageOption {
+	return func(ust *UserStorage) {
+		ust.twoFactor.issuer = issuer
+		ust.twoFactor.roles = make(map[string]bool, len(roles))
+		for _, role := range roles {
+			ust.twoFactor.roles[role] = true
+		}
+	}
+}
+
+// EnrollTwoFactor will generate a new secret for the user logged in and return it with its provisioning uri. The
+// two factor authentication is enabled once a code of the secret is confirmed with ConfirmTwoFactor, enrolling again
+// before it replaces the secret
+func (userStorage UserStorage) EnrollTwoFactor(ctx context.Context) (TwoFactorEnrollment, error) {
+	current, err := userStorage.twoFactorUser(ctx)
+	if err != nil {
+		return TwoFactorEnrollment{}, err
+	}
+
+	if current.TwoFactorEnabled {
+		log.Info(ctx, "invalid check on enroll two factor: it is already enabled", log.Int64("user_id", current.ID))
+		return TwoFactorEnrollment{}, ErrTwoFactorAlreadyEnabled
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		log.Error(ctx, "there was an error generating two factor secret", log.Int64("user_id", current.ID),
+			log.Err(err))
+		return TwoFactorEnrollment{}, ErrStorageUpdate
+	}
+
+	if err := userStorage.repository.UpdateTwoFactor(ctx, current.ID, secret, false); err != nil {
+		log.Error(ctx, "there was an error saving two factor secret", log.Int64("user_id", current.ID), log.Err(err))
+		return TwoFactorEnrollment{}, ErrStorageUpdate
+	}
+	userStorage.invalidateUser(current.ID)
+
+	return TwoFactorEnrollment{
+		Secret: secret,
+		URI:    totp.ProvisioningURI(userStorage.twoFactor.issuer, current.Email, secret),
+	}, nil
+}
+
+// ConfirmTwoFactor will enable the two factor authentication of the user logged in if the code received is valid for
+// the enrolled secret
+func (userStorage UserStorage) ConfirmTwoFactor(ctx context.Context, code string) error {
+	current, err := userStorage.twoFactorUser(ctx)
+	if err != nil {
+		return err
+	}
+
+	if current.TwoFactorEnabled {
+		log.Info(ctx, "invalid check on confirm two factor: it is already enabled", log.Int64("user_id", current.ID))
+		return ErrTwoFactorAlreadyEnabled
+	}
+
+	if current.TOTPSecret == "" {
+		log.Info(ctx, "invalid check on confirm two factor: it was not enrolled", log.Int64("user_id", current.ID))
+		return ErrTwoFactorNotEnrolled
+	}
+
+	if !totp.Validate(current.TOTPSecret, code, time.Now()) {
+		log.Info(ctx, "invalid check on confirm two factor: invalid code", log.Int64("user_id", current.ID))
+		return ErrInvalidTwoFactorCode
+	}
+
+	if err := userStorage.repository.UpdateTwoFactor(ctx, current.ID, current.TOTPSecret, true); err != nil {
+		log.Error(ctx, "there was an error enabling two factor", log.Int64("user_id", current.ID), log.Err(err))
+		return ErrStorageUpdate
+	}
+	userStorage.invalidateUser(current.ID)
+
+	return nil
+}
+
+// LoginTwoFactor complete the login of a user with two factor authentication: if the challenge returned on Login is
+// valid and the code is valid for the user secret then return a session with a generated jwt token and refresh token.
+// A challenge completes one login, it cannot be replayed once its code was accepted
+func (userStorage UserStorage) LoginTwoFactor(ctx context.Context, challenge, code string) (Session, error) {
+	token, err := jwt.ValidateToken(ctx, challenge)
+	if err != nil {
+		log.Info(ctx, "invalid check on two factor login: invalid challenge", log.Err(err))
+		return Session{}, ErrInvalidChallenge
+	}
+
+	claims, err := jwt.GetClaims(token)
+	if err != nil || !Permissions(claims.Permissions).Has(PermissionTwoFactorChallenge) {
+		log.Info(ctx, "invalid check on two factor login: the token is not a challenge")
+		return Session{}, ErrInvalidChallenge
+	}
+
+	userGet, err := userStorage.repository.GetUser(ctx, claims.UserID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting user on two factor login", log.Int64("user_id", claims.UserID),
+			log.Err(err))
+		if errors.Is(err, ErrUserNotFound) {
+			return Session{}, ErrNotFoundUser
+		}
+		return Session{}, ErrStorageGet
+	}
+
+	if !userGet.Active {
+		log.Info(ctx, "invalid check on two factor login: the user is suspended", log.Int64("user_id", userGet.ID))
+		userStorage.audit(ctx, audit.Event{Type: audit.EventLoginFailed, UserID: userGet.ID, Email: userGet.Email,
+			Detail: "suspended user"})
+		return Session{}, ErrSuspendedUser
+	}
+
+	if !userGet.TwoFactorEnabled || !totp.Validate(userGet.TOTPSecret, code, time.Now()) {
+		log.Info(ctx, "invalid check on two factor login: invalid code", log.Int64("user_id", userGet.ID))
+		userStorage.audit(ctx, audit.Event{Type: audit.EventLoginFailed, UserID: userGet.ID, Email: userGet.Email,
+			Detail: "invalid two factor code"})
+		return Session{}, ErrInvalidTwoFactorCode
+	}
+
+	consumed, err := userStorage.consumeToken(ctx, "two factor challenge", claims.ID, claims.Expiration, userGet.Email)
+	if err != nil {
+		return Session{}, ErrStorageGet
+	}
+	if !consumed {
+		log.Info(ctx, "invalid check on two factor login: the challenge was already used",
+			log.Int64("user_id", userGet.ID))
+		return Session{}, ErrInvalidChallenge
+	}
+
+	return userStorage.session(ctx, userGet, claims.Scope)
+}
+
+// twoFactorUser return the user logged in, read from the repository to get its two factor secret
+func (userStorage UserStorage) twoFactorUser(ctx context.Context) (User, error) {
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims on two factor enrollment")
+		return User{}, ErrInvalidUserClaims
+	}
+
+	current, err := userStorage.repository.GetUser(ctx, userLogged.UserID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting user on two factor enrollment",
+			log.Int64("user_id", userLogged.UserID), log.Err(err))
+		if errors.Is(err, ErrUserNotFound) {
+			return User{}, ErrNotFoundUser
+		}
+		return User{}, ErrStorageGet
+	}
+
+	return current, nil
+}
@@ -0,0 +1,109 @@
+package user
+
+import (
+	"context"
+	"errors"
+	auditlog "github.com/nicocarolo/space-drivers/internal/platform/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+)
+
+var (
+	ErrStorageUpdate      = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to update user"}
+	ErrInvalidUserClaims  = code_error.Error{Code: "invalid_user_access", Detail: "cannot identify user logged in"}
+	ErrInvalidUserAccess  = code_error.Error{Code: "invalid_user_access", Detail: "the user logged in can only edit itself and cannot change its role, unless it is an admin"}
+	ErrEmailAlreadyExists = code_error.Error{Code: "email_already_exists", Detail: "there is already a user with the received email"}
+)
+
+// Update will change the email, role and profile of the stored user with the id of the received one and return it.
+// Admins can edit any user, other users can only edit themselves without changing their role. The email cannot belong
+// to another user
+func (userStorage UserStorage) Update(ctx context.Context, user SecuredUser) (SecuredUser, error) {
+	userLogged, ok := ctx.Value("user_on_call").(jwt.Claims)
+	if !ok {
+		log.Info(ctx, "there was an error trying to access to user logged in claims on update user",
+			log.Int64("user_id", user.ID))
+		return SecuredUser{}, ErrInvalidUserClaims
+	}
+
+	isAdmin := ClaimsPermissions(userLogged).Has(PermissionUserWrite)
+	if !isAdmin && userLogged.UserID != user.ID {
+		log.Info(ctx, "invalid check on update user: the user logged in cannot edit another user",
+			log.Int64("user_id", user.ID),
+			log.Int64("logged_user_id", userLogged.UserID),
+			log.String("logged_role", userLogged.Role))
+		return SecuredUser{}, ErrInvalidUserAccess
+	}
+
+	if !validRole(user.Role) {
+		log.Info(ctx, "invalid check on update user: invalid role", log.String("role", user.Role))
+		return SecuredUser{}, ErrInvalidRole
+	}
+
+	current, err := userStorage.repository.GetUser(ctx, user.ID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting user on update", log.Int64("user_id", user.ID), log.Err(err))
+		if errors.Is(err, ErrUserNotFound) {
+			return SecuredUser{}, ErrNotFoundUser
+		}
+		return SecuredUser{}, ErrStorageGet
+	}
+
+	if !isAdmin && user.Role != current.Role {
+		log.Info(ctx, "invalid check on update user: the user logged in cannot change its role",
+			log.Int64("user_id", user.ID),
+			log.String("role", user.Role))
+		return SecuredUser{}, ErrInvalidUserAccess
+	}
+
+	if user.Email != current.Email {
+		withEmail, err := userStorage.repository.GetUserByEmail(ctx, user.Email)
+		if err == nil && withEmail.ID != user.ID {
+			log.Info(ctx, "invalid check on update user: the email belongs to another user",
+				log.Int64("user_id", user.ID),
+				log.Int64("email_user_id", withEmail.ID))
+			return SecuredUser{}, ErrEmailAlreadyExists
+		}
+		if err != nil && !errors.Is(err, ErrUserNotFound) {
+			log.Error(ctx, "there was an error getting user by email on update", log.Int64("user_id", user.ID),
+				log.Err(err))
+			return SecuredUser{}, ErrStorageGet
+		}
+	}
+
+	previousRole, emailChanged := current.Role, user.Email != current.Email
+	current.Email = user.Email
+	current.Role = user.Role
+	current.Profile = user.Profile
+	current, err = userStorage.repository.UpdateUser(ctx, current)
+	userStorage.invalidateUser(user.ID)
+	if err != nil {
+		log.Error(ctx, "there was an error updating user", log.Int64("user_id", user.ID), log.Err(err))
+		if errors.Is(err, ErrUserNotFound) {
+			return SecuredUser{}, ErrNotFoundUser
+		}
+		if errors.Is(err, ErrUserDuplicated) {
+			return SecuredUser{}, ErrEmailAlreadyExists
+		}
+		return SecuredUser{}, ErrStorageUpdate
+	}
+
+	auditlog.Log(ctx, "user updated",
+		log.Int64("user_id", current.ID),
+		log.String("previous_role", previousRole),
+		log.String("role", current.Role),
+		log.Bool("email_changed", emailChanged))
+
+	return SecuredUser{
+		ID:           current.ID,
+		UUID:         current.UUID,
+		Email:        current.Email,
+		Role:         current.Role,
+		Profile:      current.Profile,
+		Active:       current.Active,
+		StatusReason: current.StatusReason,
+		CreatedAt:    current.CreatedAt,
+		UpdatedAt:    current.UpdatedAt,
+	}, nil
+}
@@ -4,14 +4,20 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/clock"
 	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
 	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
 	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/vehicle"
+	"net/mail"
+	"time"
 )
 
 const (
-	RoleAdmin  = "admin"
-	RoleDriver = "driver"
+	RoleAdmin      = "admin"
+	RoleDispatcher = "dispatcher"
+	RoleDriver     = "driver"
 )
 
 var (
@@ -20,9 +26,19 @@ var (
 	ErrStorageSave            = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to save user"}
 	ErrStorageGet             = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to get user"}
 	ErrNotFoundUser           = code_error.Error{Code: "not_found_user", Detail: "not founded the user to get"}
-	ErrInvalidRole            = code_error.Error{Code: "invalid_role", Detail: "the received role should be admin or driver"}
+	ErrInvalidRole            = code_error.Error{Code: "invalid_role", Detail: "the received role should be admin, dispatcher or driver"}
+	ErrInvalidEmail           = code_error.Error{Code: "invalid_email", Detail: "the received email has an invalid format"}
+	ErrSuspendedUser          = code_error.Error{Code: "suspended_user", Detail: "the user is suspended and cannot login"}
 )
 
+// WithClock will change the clock the sessions and tokens are dated and expired with, it should be the jwt.Clock the
+// tokens are validated with. The tests can set a clock.Fake to control the time
+func WithClock(c clock.Clock) UserStorageOption {
+	return func(ust *UserStorage) {
+		ust.clock = c
+	}
+}
+
 // WithPasswordEncrypter will change the algorithm to encrypt password with the received
 func WithPasswordEncrypter(enc PasswordEncrypter) UserStorageOption {
 	return func(ust *UserStorage) {
@@ -31,19 +47,66 @@ func WithPasswordEncrypter(enc PasswordEncrypter) UserStorageOption {
 }
 
 type SecuredUser struct {
-	ID    int64  `json:"id"`
+	ID int64 `json:"id"`
+	// UUID is the public id of the user, generated on save, it is also accepted instead of the id on the urls
+	UUID  string `json:"uuid"`
 	Email string `json:"email" binding:"required"`
 	Role  string `json:"role" binding:"required"`
+	Profile
+
+	// Rating is only filled on drivers search
+	Rating *DriverRating `json:"rating,omitempty"`
+	// TravelID is the travel the driver is busy with, only filled on busy drivers search
+	TravelID *int64 `json:"travel_id,omitempty"`
+	// Vehicle is the vehicle assigned to the driver, only filled on drivers get and search
+	Vehicle *vehicle.Vehicle `json:"vehicle,omitempty"`
+
+	// Active is false for suspended users, they cannot login nor be assigned to travels
+	Active bool `json:"active"`
+	// StatusReason is the reason of the last suspension or activation of the user
+	StatusReason string `json:"status_reason,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+	// UpdatedAt is the date of the last change of the user, including its password and deletion
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Profile the contact data of a user, so dispatchers can contact drivers. Every field is optional
+type Profile struct {
+	Name          string `json:"name,omitempty" binding:"max=100"`
+	Phone         string `json:"phone,omitempty" binding:"max=30"`
+	LicenseNumber string `json:"license_number,omitempty" binding:"max=30"`
+}
+
+// DriverRating the aggregation of the ratings received by a driver on its travels
+type DriverRating struct {
+	Average float64 `json:"average"`
+	Count   int64   `json:"count"`
 }
 
 type User struct {
 	SecuredUser
 	Password string `json:"password" binding:"required"`
+
+	// TOTPSecret is the secret of the two factor authentication, it is enabled once the user verifies a code of it
+	TOTPSecret       string `json:"-"`
+	TwoFactorEnabled bool   `json:"-"`
 }
 
 type UserStorage struct {
 	repository        repository
 	passwordEncrypter PasswordEncrypter
+	vehicles          VehicleFinder
+	cache             *Cache
+	twoFactor         twoFactorConfig
+	availability      DriverAvailability
+	invitations       invitationConfig
+	refreshTokenTTL   time.Duration
+	auditor           SecurityAuditor
+	throttle          *LoginThrottle
+	impersonationTTL  time.Duration
+	renewalWindow     time.Duration
+	clock             clock.Clock
 }
 
 // UserStorageOption type to change UserStorage configuration
@@ -51,11 +114,28 @@ type UserStorageOption func(ust *UserStorage)
 
 // NewUserStorage will create and return a UserStorage with the received repository and applying the options
 // Default options are:
-// 	- bcryptEncrypter to encrypt password
+// 	- bcryptEncrypter to encrypt password with DefaultBcryptCost
+// 	- no cache of the users got by id
+// 	- two factor authentication optional for every role, issued by DefaultTwoFactorIssuer
+// 	- DefaultDriverAvailability to search free and busy drivers
+// 	- invitations valid for DefaultInvitationTTL, without link
+// 	- refresh tokens valid for DefaultRefreshTokenTTL
+// 	- no security events recorded
+// 	- no throttle of the failed logins
+// 	- impersonation tokens valid for DefaultImpersonationTTL
+// 	- tokens renewed within DefaultRenewalWindow of their expiration
+// 	- the clock of the system
 func NewUserStorage(repository repository, opts ...UserStorageOption) UserStorage {
 	defaultUserStorage := UserStorage{
 		repository:        repository,
 		passwordEncrypter: bcryptEncrypt{},
+		twoFactor:         twoFactorConfig{issuer: DefaultTwoFactorIssuer},
+		availability:      DefaultDriverAvailability,
+		invitations:       invitationConfig{ttl: DefaultInvitationTTL},
+		refreshTokenTTL:   DefaultRefreshTokenTTL,
+		impersonationTTL:  DefaultImpersonationTTL,
+		renewalWindow:     DefaultRenewalWindow,
+		clock:             clock.System{},
 	}
 
 	for _, opt := range opts {
@@ -65,9 +145,9 @@ func NewUserStorage(repository repository, opts ...UserStorageOption) UserStorag
 	return defaultUserStorage
 }
 
-// Get and return the User from repository with the received id
+// Get and return the User from repository (or from the cache, if it is configured) with the received id
 func (userStorage UserStorage) Get(ctx context.Context, id int64) (SecuredUser, error) {
-	user, err := userStorage.repository.GetUser(ctx, id)
+	user, err := userStorage.getUser(ctx, id)
 	if err != nil {
 		log.Error(ctx, "there was an error getting user", log.Err(err))
 		if errors.Is(err, ErrUserNotFound) {
@@ -76,17 +156,47 @@ func (userStorage UserStorage) Get(ctx context.Context, id int64) (SecuredUser,
 		return SecuredUser{}, ErrStorageGet
 	}
 
-	return SecuredUser{
-		ID:    user.ID,
-		Email: user.Email,
-		Role:  user.Role,
-	}, nil
+	secUsers := []SecuredUser{{
+		ID:           user.ID,
+		UUID:         user.UUID,
+		Email:        user.Email,
+		Role:         user.Role,
+		Profile:      user.Profile,
+		Active:       user.Active,
+		StatusReason: user.StatusReason,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
+	}}
+	if err := userStorage.withVehicles(ctx, secUsers); err != nil {
+		return SecuredUser{}, err
+	}
+
+	return secUsers[0], nil
+}
+
+// IDByUUID return the id of the User (not deleted) with the received public uuid
+func (userStorage UserStorage) IDByUUID(ctx context.Context, publicID string) (int64, error) {
+	id, err := userStorage.repository.GetUserIDByUUID(ctx, publicID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting user id by uuid", log.String("uuid", publicID), log.Err(err))
+		if errors.Is(err, ErrUserNotFound) {
+			return 0, ErrNotFoundUser
+		}
+		return 0, ErrStorageGet
+	}
+
+	return id, nil
 }
 
 // Save will store a User on repository and return it.
-// The password received is encrypted with passwordEncrypter on UserStorage, and the roles accepted are
-// 'admin' or 'driver's
+// The email should be a valid address not used by another user, the password received is encrypted with
+// passwordEncrypter on UserStorage, and the roles accepted are 'admin' or 'driver's
 func (userStorage UserStorage) Save(ctx context.Context, user User) (SecuredUser, error) {
+	if !validEmail(user.Email) {
+		log.Info(ctx, "there was an error due to invalid email on save user", log.String("email", user.Email))
+		return SecuredUser{}, ErrInvalidEmail
+	}
+
 	pwd, err := userStorage.passwordEncrypter.Encrypt(user.Password)
 	if err != nil {
 		log.Error(ctx, "there was an error encrypting password on save user", log.Err(err))
@@ -95,7 +205,7 @@ func (userStorage UserStorage) Save(ctx context.Context, user User) (SecuredUser
 
 	user.Password = string(pwd)
 
-	if user.Role != RoleDriver && user.Role != RoleAdmin {
+	if !validRole(user.Role) {
 		log.Error(ctx, fmt.Sprintf("there was an error due to invalid role (%s) on save user", user.Role))
 		return SecuredUser{}, ErrInvalidRole
 	}
@@ -103,47 +213,123 @@ func (userStorage UserStorage) Save(ctx context.Context, user User) (SecuredUser
 	user, err = userStorage.repository.SaveUser(ctx, user)
 	if err != nil {
 		log.Error(ctx, "there was an error saving user", log.Err(err))
+		if errors.Is(err, ErrUserDuplicated) {
+			return SecuredUser{}, ErrEmailAlreadyExists
+		}
 		return SecuredUser{}, ErrStorageSave
 	}
 
 	return SecuredUser{
-		ID:    user.ID,
-		Email: user.Email,
-		Role:  user.Role,
+		ID:           user.ID,
+		UUID:         user.UUID,
+		Email:        user.Email,
+		Role:         user.Role,
+		Profile:      user.Profile,
+		Active:       user.Active,
+		StatusReason: user.StatusReason,
+		CreatedAt:    user.CreatedAt,
+		UpdatedAt:    user.UpdatedAt,
 	}, nil
 }
 
 // Login receive an email and password from User, search the user on db and compare the password.
-// If the user exists and password is correct then return a generated jwt token.
-func (userStorage UserStorage) Login(ctx context.Context, user User) (string, error) {
+// If the user exists and password is correct then return a session with a generated jwt token and refresh token, the password is
+// encrypted again if it was stored with older parameters. Users with two factor
+// authentication get a challenge instead, to complete the login with LoginTwoFactor, and users whose role requires it
+// but did not enroll it get a token which only allows to enroll it. The logins of an email or ip with too many failed
+// logins are blocked for a while, if a LoginThrottle is configured
+func (userStorage UserStorage) Login(ctx context.Context, user User) (Session, error) {
+	return userStorage.LoginWithScope(ctx, user, "")
+}
+
+// LoginWithScope login the user as Login, restricting its tokens to the received scope (e.g. ScopeDriverApp for the
+// mobile driver app), the scope is kept when the session is refreshed. An empty scope does not restrict them
+func (userStorage UserStorage) LoginWithScope(ctx context.Context, user User, scope string) (Session, error) {
+	if !knownScope(scope) {
+		log.Info(ctx, "invalid check on login user: unknown scope", log.String("scope", scope))
+		return Session{}, ErrInvalidScope
+	}
+
+	if !userStorage.allowLogin(ctx, user.Email) {
+		log.InfoLimited(ctx, "invalid check on login user: too many failed login attempts", log.String("email", user.Email))
+		return Session{}, ErrTooManyLoginAttempts
+	}
+
 	userGet, err := userStorage.repository.GetUserByEmail(ctx, user.Email)
 	if err != nil {
 		log.Error(ctx, "there was an error on logging user", log.Err(err))
 		if errors.Is(err, ErrUserNotFound) {
-			return "", ErrNotFoundUser
+			userStorage.loginFailed(ctx, user.Email, "unknown_email")
+			userStorage.audit(ctx, audit.Event{Type: audit.EventLoginFailed, Email: user.Email,
+				Detail: "unknown email"})
+			return Session{}, ErrNotFoundUser
 		}
-		return "", ErrStorageGet
+		return Session{}, ErrStorageGet
 	}
 
 	err = userStorage.passwordEncrypter.Compare(userGet.Password, user.Password)
 	if err != nil {
-		log.Error(ctx, "there was an error with the received password on login user", log.Err(err))
-		return "", ErrInvalidPasswordToLogin
+		log.ErrorLimited(ctx, "there was an error with the received password on login user", log.Err(err))
+		userStorage.loginFailed(ctx, user.Email, "invalid_password")
+		userStorage.audit(ctx, audit.Event{Type: audit.EventLoginFailed, UserID: userGet.ID, Email: userGet.Email,
+			Detail: "invalid password"})
+		return Session{}, ErrInvalidPasswordToLogin
 	}
 
-	token, err := jwt.GenerateToken(userGet.ID, userGet.Role)
-	if err != nil {
-		log.Error(ctx, "there was an error while generating token on login user", log.Err(err))
-		return "", err
+	if !userGet.Active {
+		log.Info(ctx, "invalid check on login user: the user is suspended", log.Int64("user_id", userGet.ID))
+		userStorage.audit(ctx, audit.Event{Type: audit.EventLoginFailed, UserID: userGet.ID, Email: userGet.Email,
+			Detail: "suspended user"})
+		return Session{}, ErrSuspendedUser
+	}
+
+	userStorage.loginSucceeded(user.Email)
+	userStorage.rehashPassword(ctx, userGet.ID, userGet.Password, user.Password)
+
+	if !validScope(scope, userGet.Role) {
+		log.Info(ctx, "invalid check on login user: the role cannot request the scope", log.Int64("user_id", userGet.ID),
+			log.String("scope", scope))
+		return Session{}, ErrInvalidScope
 	}
 
-	return token, nil
+	// the challenge keeps the scope, to complete the login with it
+	if userGet.TwoFactorEnabled {
+		challenge, err := jwt.GenerateScopedToken(userGet.ID, userGet.Email, userGet.Role, scope,
+			[]string{PermissionTwoFactorChallenge})
+		if err != nil {
+			log.Error(ctx, "there was an error while generating challenge on login user", log.Err(err))
+			return Session{}, err
+		}
+
+		return Session{Challenge: challenge}, nil
+	}
+
+	if userStorage.twoFactor.roles[userGet.Role] {
+		token, err := jwt.GenerateScopedToken(userGet.ID, userGet.Email, userGet.Role, scope,
+			[]string{PermissionTwoFactorEnroll})
+		if err != nil {
+			log.Error(ctx, "there was an error while generating enrollment token on login user", log.Err(err))
+			return Session{}, err
+		}
+		userStorage.audit(ctx, audit.Event{Type: audit.EventLogin, UserID: userGet.ID, Email: userGet.Email,
+			Detail: "two factor enrollment required"})
+
+		return Session{Token: token, TwoFactorEnrollment: true}, nil
+	}
+
+	return userStorage.session(ctx, userGet, scope)
 }
 
 type Search struct {
-	status StatusSearch
-	offset int64
-	limit  int64
+	status    StatusSearch
+	zoneID    int64
+	teamID    int64
+	minRating float64
+	role      string
+	email     string
+	sort      UserSort
+	offset    int64
+	limit     int64
 }
 
 type StatusSearch string
@@ -160,6 +346,28 @@ func WithStatus(status StatusSearch) SearchOption {
 	}
 }
 
+// WithZone filter the free drivers on the ones registered on the zone with the received id
+func WithZone(zoneID int64) SearchOption {
+	return func(s *Search) {
+		s.zoneID = zoneID
+	}
+}
+
+// WithTeam filter the searched drivers on the members of the team with the received id
+func WithTeam(teamID int64) SearchOption {
+	return func(s *Search) {
+		s.teamID = teamID
+	}
+}
+
+// WithMinRating filter the searched drivers on the ones with an average rating of at least the received one, drivers
+// without ratings are not found
+func WithMinRating(minRating float64) SearchOption {
+	return func(s *Search) {
+		s.minRating = minRating
+	}
+}
+
 func WithOffset(offset int64) SearchOption {
 	return func(s *Search) {
 		s.offset = offset
@@ -179,7 +387,8 @@ type Metadata struct {
 	Pending int64
 }
 
-// Search users on repository by status (currently only free drivers) or with pagination
+// Search users on repository by status (free or busy drivers) or with pagination, every search but the busy drivers
+// one is paginated
 func (userStorage UserStorage) Search(ctx context.Context, opt ...SearchOption) ([]SecuredUser, Metadata, error) {
 	// default search options
 	search := Search{
@@ -199,17 +408,21 @@ func (userStorage UserStorage) Search(ctx context.Context, opt ...SearchOption)
 	// if none status, then search all user with pagination
 	if search.status == StatusSearchNone {
 		var totalCount int64
-		users, totalCount, err = userStorage.repository.GetPaginate(ctx, search.limit, search.offset)
-		metadata.Total = totalCount
-		metadata.Pending = totalCount - search.limit - search.offset
-		if metadata.Pending < 0 {
-			metadata.Pending = 0
-		}
-	} else {
-		// get free drivers
-		users, err = userStorage.repository.GetFreeDrivers(ctx)
+		users, totalCount, err = userStorage.repository.GetPaginate(ctx, search.teamID, search.minRating,
+			search.limit, search.offset)
+		metadata = pageMetadata(totalCount, search.limit, search.offset)
+	} else if search.status == StatusSearchBusy {
+		// get busy drivers with the travel they are busy with
+		users, err = userStorage.repository.GetBusyDrivers(ctx, userStorage.availability, search.teamID,
+			search.minRating)
 		metadata.Total = int64(len(users))
 		metadata.Pending = 0
+	} else {
+		// get a page of the free drivers (of the zone if it was received)
+		var totalCount int64
+		users, totalCount, err = userStorage.repository.GetFreeDrivers(ctx, userStorage.availability, search.zoneID,
+			search.teamID, search.minRating, search.limit, search.offset)
+		metadata = pageMetadata(totalCount, search.limit, search.offset)
 	}
 
 	if err != nil {
@@ -225,5 +438,29 @@ func (userStorage UserStorage) Search(ctx context.Context, opt ...SearchOption)
 		secUsers = append(secUsers, u.SecuredUser)
 	}
 
+	if err := userStorage.withVehicles(ctx, secUsers); err != nil {
+		return nil, Metadata{}, err
+	}
+
 	return secUsers, metadata, nil
 }
+
+// pageMetadata return the metadata of a page of a search: the total count and how many results are left after the
+// page
+func pageMetadata(total, limit, offset int64) Metadata {
+	pending := total - limit - offset
+	if pending < 0 {
+		pending = 0
+	}
+
+	return Metadata{
+		Total:   total,
+		Pending: pending,
+	}
+}
+
+// validEmail return if the received email is a plain address as user@domain, without display name nor spaces
+func validEmail(email string) bool {
+	address, err := mail.ParseAddress(email)
+	return err == nil && address.Address == email
+}
@@ -4,10 +4,18 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/audit"
+	"github.com/nicocarolo/space-drivers/internal/platform/clock"
+	"github.com/nicocarolo/space-drivers/internal/platform/jwt"
+	"github.com/nicocarolo/space-drivers/internal/platform/totp"
+	"github.com/nicocarolo/space-drivers/internal/vehicle"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 	"os"
+	"sort"
 	"strings"
 	"testing"
+	"time"
 )
 
 type FailureEncrypter struct{}
@@ -43,7 +51,24 @@ type mockDb struct {
 
 	saveError           map[string]error
 	getError            map[int64]error
+	updateError         map[int64]error
 	getFreeDriversError error
+	getByRoleError      error
+
+	// activeTravels are the users with active travels, which cannot be deleted
+	activeTravels map[int64]bool
+
+	preferences      map[int64]Preferences
+	preferencesError error
+
+	// refreshTokens are the stored refresh tokens by hash, revoked ones are kept to detect their reuse
+	refreshTokens map[string]RefreshToken
+	revokedTokens map[string]bool
+	// sessions are the stored sessions by id, revoked ones are kept with their revocation
+	sessions        map[int64]UserSession
+	revokedSessions map[int64]bool
+	// consumedTokens are the ids of the one-time tokens already used
+	consumedTokens map[string]bool
 }
 
 func (db *mockDb) onCreate(email string, err error) *mockDb {
@@ -56,6 +81,16 @@ func (db *mockDb) onGet(id int64, err error) *mockDb {
 	return db
 }
 
+func (db *mockDb) onUpdate(id int64, err error) *mockDb {
+	db.updateError[id] = err
+	return db
+}
+
+func (db *mockDb) onGetByRole(err error) *mockDb {
+	db.getByRoleError = err
+	return db
+}
+
 func (db *mockDb) onGetFreeDrivers(err error) *mockDb {
 	db.getFreeDriversError = err
 	return db
@@ -67,6 +102,8 @@ func (db *mockDb) SaveUser(ctx context.Context, user User) (User, error) {
 	}
 
 	user.ID = db.idCount
+	user.UUID = fmt.Sprintf("00000000-0000-4000-8000-%012d", user.ID)
+	user.Active = true
 	db.users[user.ID] = user
 
 	db.idCount++
@@ -96,11 +133,250 @@ func (db mockDb) GetUserByEmail(ctx context.Context, email string) (User, error)
 	return User{}, ErrUserNotFound
 }
 
-func (db mockDb) GetFreeDrivers(ctx context.Context) ([]User, error) {
+func (db mockDb) GetUserIDByUUID(ctx context.Context, publicID string) (int64, error) {
+	for _, u := range db.users {
+		if u.UUID == publicID {
+			return u.ID, nil
+		}
+	}
+	return 0, ErrUserNotFound
+}
+
+func (db *mockDb) UpdateUser(ctx context.Context, u User) (User, error) {
+	if err, ok := db.updateError[u.ID]; ok {
+		return User{}, err
+	}
+
+	if _, exist := db.users[u.ID]; !exist {
+		return User{}, ErrUserNotFound
+	}
+
+	db.users[u.ID] = u
+
+	return u, nil
+}
+
+func (db *mockDb) UpdateStatus(ctx context.Context, u User) (User, error) {
+	if err, ok := db.updateError[u.ID]; ok {
+		return User{}, err
+	}
+
+	db.users[u.ID] = u
+
+	return u, nil
+}
+
+func (db *mockDb) UpdateTwoFactor(ctx context.Context, id int64, secret string, enabled bool) error {
+	if err, ok := db.updateError[id]; ok {
+		return err
+	}
+
+	u := db.users[id]
+	u.TOTPSecret, u.TwoFactorEnabled = secret, enabled
+	db.users[id] = u
+
+	return nil
+}
+
+func (db *mockDb) UpdatePassword(ctx context.Context, id int64, password string) error {
+	if err, ok := db.updateError[id]; ok {
+		return err
+	}
+
+	u, exist := db.users[id]
+	if !exist {
+		return ErrUserNotFound
+	}
+
+	u.Password = password
+	db.users[id] = u
+
+	return nil
+}
+
+func (db *mockDb) DeleteUser(ctx context.Context, id int64, deletedAt time.Time) error {
+	if _, exist := db.users[id]; !exist {
+		return ErrUserNotFound
+	}
+
+	if db.activeTravels[id] {
+		return ErrUserActiveTravels
+	}
+
+	delete(db.users, id)
+
+	return nil
+}
+
+func (db *mockDb) AnonymizeUser(ctx context.Context, id int64, erasedAt time.Time) error {
+	u, exist := db.users[id]
+	if !exist {
+		return ErrUserNotFound
+	}
+
+	if db.activeTravels[id] {
+		return ErrUserActiveTravels
+	}
+
+	db.users[id] = User{SecuredUser: SecuredUser{
+		ID:           id,
+		Email:        anonymousEmail(id),
+		Role:         u.Role,
+		StatusReason: ErasedStatusReason,
+		CreatedAt:    u.CreatedAt,
+		UpdatedAt:    erasedAt,
+	}}
+
+	delete(db.preferences, id)
+
+	return nil
+}
+
+func (db *mockDb) SaveRefreshToken(ctx context.Context, token RefreshToken) error {
+	db.refreshTokens[token.TokenHash] = token
+	return nil
+}
+
+func (db *mockDb) RotateRefreshToken(ctx context.Context, tokenHash string, next RefreshToken) (UserSession, error) {
+	token, exist := db.refreshTokens[tokenHash]
+	if !exist {
+		return UserSession{}, ErrRefreshTokenNotFound
+	}
+
+	if db.revokedSessions[token.SessionID] {
+		return UserSession{}, ErrRefreshTokenNotFound
+	}
+
+	if db.revokedTokens[tokenHash] {
+		_ = db.RevokeRefreshTokens(ctx, token.UserID)
+		return UserSession{UserID: token.UserID}, ErrRefreshTokenReused
+	}
+
+	if !token.ExpiresAt.After(next.CreatedAt) {
+		return UserSession{}, ErrRefreshTokenNotFound
+	}
+
+	db.revokedTokens[tokenHash] = true
+	next.UserID = token.UserID
+	next.SessionID = token.SessionID
+	db.refreshTokens[next.TokenHash] = next
+
+	session, exist := db.sessions[token.SessionID]
+	if exist {
+		session.LastUsedAt = next.CreatedAt
+		session.ExpiresAt = next.ExpiresAt
+		db.sessions[session.ID] = session
+	}
+
+	return UserSession{ID: token.SessionID, UserID: token.UserID, Scope: session.Scope}, nil
+}
+
+func (db *mockDb) RevokeRefreshTokens(ctx context.Context, userID int64) error {
+	for hash, token := range db.refreshTokens {
+		if token.UserID == userID {
+			db.revokedTokens[hash] = true
+		}
+	}
+	for id, session := range db.sessions {
+		if session.UserID == userID {
+			db.revokedSessions[id] = true
+		}
+	}
+	return nil
+}
+
+func (db *mockDb) SaveSession(ctx context.Context, session UserSession) (UserSession, error) {
+	session.ID = int64(len(db.sessions) + 1)
+	db.sessions[session.ID] = session
+	return session, nil
+}
+
+func (db *mockDb) GetSessions(ctx context.Context, userID int64) ([]UserSession, error) {
+	var sessions []UserSession
+	for id := int64(len(db.sessions)); id > 0; id-- {
+		session := db.sessions[id]
+		if session.UserID == userID && !db.revokedSessions[id] && session.ExpiresAt.After(time.Now()) {
+			sessions = append(sessions, session)
+		}
+	}
+	return sessions, nil
+}
+
+func (db *mockDb) RevokeSession(ctx context.Context, userID, id int64) error {
+	session, exist := db.sessions[id]
+	if !exist || session.UserID != userID || db.revokedSessions[id] {
+		return ErrSessionNotFound
+	}
+
+	db.revokedSessions[id] = true
+	for hash, token := range db.refreshTokens {
+		if token.SessionID == id {
+			db.revokedTokens[hash] = true
+		}
+	}
+	return nil
+}
+
+func (db *mockDb) ConsumeToken(ctx context.Context, id string, expiresAt time.Time) error {
+	if db.consumedTokens[id] {
+		return ErrTokenConsumed
+	}
+
+	db.consumedTokens[id] = true
+	return nil
+}
+
+func (db *mockDb) ReleaseToken(ctx context.Context, id string) error {
+	delete(db.consumedTokens, id)
+	return nil
+}
+
+func (db mockDb) CountUsers(ctx context.Context) (int64, error) {
+	return int64(len(db.users)), nil
+}
+
+func (db mockDb) GetPreferences(ctx context.Context, userID int64) (Preferences, error) {
+	if db.preferencesError != nil {
+		return nil, db.preferencesError
+	}
+
+	preferences := make(Preferences)
+	for key, value := range db.preferences[userID] {
+		preferences[key] = value
+	}
+
+	return preferences, nil
+}
+
+func (db *mockDb) UpdatePreferences(ctx context.Context, userID int64, changes Preferences,
+	maxKeys int) (Preferences, error) {
+	if db.preferencesError != nil {
+		return nil, db.preferencesError
+	}
+
+	preferences, _ := db.GetPreferences(ctx, userID)
+	for key, value := range changes {
+		if value == "" {
+			delete(preferences, key)
+		} else {
+			preferences[key] = value
+		}
+	}
+
+	if len(preferences) > maxKeys {
+		return nil, ErrPreferencesLimit
+	}
+	db.preferences[userID] = preferences
+
+	return db.GetPreferences(ctx, userID)
+}
+
+func (db mockDb) GetFreeDrivers(ctx context.Context, availability DriverAvailability, zoneID, teamID int64,
+	minRating float64, limit, offset int64) ([]User, int64, error) {
 	if db.getFreeDriversError != nil {
-		return nil, db.getFreeDriversError
+		return nil, 0, db.getFreeDriversError
 	}
-	return []User{
+	drivers := []User{
 		User{
 			SecuredUser: SecuredUser{
 				ID:    1,
@@ -115,10 +391,83 @@ func (db mockDb) GetFreeDrivers(ctx context.Context) ([]User, error) {
 				Role:  "driver",
 			},
 		},
-	}, nil
+	}
+
+	// the drivers of the mock have the driver role
+	var roleDrivers []User
+	for _, driver := range drivers {
+		for _, role := range availability.Roles {
+			if driver.Role == role {
+				roleDrivers = append(roleDrivers, driver)
+			}
+		}
+	}
+	drivers = roleDrivers
+
+	if minRating != 0 {
+		var ratedDrivers []User
+		for _, driver := range drivers {
+			if driver.Rating != nil && driver.Rating.Average >= minRating {
+				ratedDrivers = append(ratedDrivers, driver)
+			}
+		}
+		drivers = ratedDrivers
+	}
+
+	if zoneID != 0 {
+		// only the second driver is registered on the zone 1
+		var zoneDrivers []User
+		for _, driver := range drivers {
+			if zoneID == 1 && driver.ID == 2 {
+				zoneDrivers = append(zoneDrivers, driver)
+			}
+		}
+		drivers = zoneDrivers
+	}
+
+	if teamID != 0 {
+		drivers = mockTeamDrivers(drivers, teamID)
+	}
+
+	total := int64(len(drivers))
+	if offset >= total {
+		return nil, total, nil
+	}
+	if offset+limit < total {
+		drivers = drivers[:offset+limit]
+	}
+
+	return drivers[offset:], total, nil
+}
+
+func (db mockDb) GetBusyDrivers(ctx context.Context, availability DriverAvailability, teamID int64,
+	minRating float64) ([]User, error) {
+	if db.getFreeDriversError != nil {
+		return nil, db.getFreeDriversError
+	}
+
+	// the third driver is busy with the travel 10
+	travelID := int64(10)
+	drivers := []User{
+		{
+			SecuredUser: SecuredUser{
+				ID:       3,
+				Email:    "busy_email@hotmail.com",
+				Role:     "driver",
+				TravelID: &travelID,
+			},
+		},
+	}
+
+	if teamID != 0 {
+		drivers = mockTeamDrivers(drivers, teamID)
+	}
+
+	return drivers, nil
 }
 
-func (db mockDb) GetPaginate(ctx context.Context, limit, offset int64) ([]User, int64, error) {
+func (db mockDb) GetPaginate(ctx context.Context, teamID int64, minRating float64, limit,
+	offset int64) ([]User, int64, error) {
 	users := []User{
 		User{
 			SecuredUser: SecuredUser{
@@ -143,6 +492,10 @@ func (db mockDb) GetPaginate(ctx context.Context, limit, offset int64) ([]User,
 		},
 	}
 
+	if teamID != 0 {
+		users = mockTeamDrivers(users, teamID)
+	}
+
 	top := int64(len(users))
 	if limit+offset < top {
 		top = limit + offset
@@ -150,13 +503,67 @@ func (db mockDb) GetPaginate(ctx context.Context, limit, offset int64) ([]User,
 	return users[offset:top], int64(len(users)), nil
 }
 
+// mockTeamDrivers return the drivers members of the team: the drivers 1 and 3 are members of the team 1
+func mockTeamDrivers(drivers []User, teamID int64) []User {
+	var teamDrivers []User
+	for _, driver := range drivers {
+		if teamID == 1 && (driver.ID == 1 || driver.ID == 3) {
+			teamDrivers = append(teamDrivers, driver)
+		}
+	}
+
+	return teamDrivers
+}
+
+func (db mockDb) GetByRole(ctx context.Context, role string, userSort UserSort, limit, offset int64) ([]User, int64, error) {
+	if db.getByRoleError != nil {
+		return nil, 0, db.getByRoleError
+	}
+
+	var users []User
+	for _, u := range db.users {
+		if role == "" || u.Role == role {
+			users = append(users, u)
+		}
+	}
+	sort.Slice(users, func(i, j int) bool { return users[i].ID < users[j].ID })
+	switch userSort {
+	case SortByCreatedAt:
+		sort.SliceStable(users, func(i, j int) bool { return users[i].CreatedAt.After(users[j].CreatedAt) })
+	case SortByUpdatedAt:
+		sort.SliceStable(users, func(i, j int) bool { return users[i].UpdatedAt.After(users[j].UpdatedAt) })
+	}
+
+	total := int64(len(users))
+	if offset > total {
+		offset = total
+	}
+	top := total
+	if limit+offset < top {
+		top = limit + offset
+	}
+	return users[offset:top], total, nil
+}
+
 func newMockDB() *mockDb {
 	return &mockDb{
 		idCount: 1,
 		users:   make(map[int64]User),
 
-		saveError: make(map[string]error),
-		getError:  make(map[int64]error),
+		saveError:   make(map[string]error),
+		getError:    make(map[int64]error),
+		updateError: make(map[int64]error),
+
+		activeTravels: make(map[int64]bool),
+		preferences:   make(map[int64]Preferences),
+
+		refreshTokens: make(map[string]RefreshToken),
+		revokedTokens: make(map[string]bool),
+
+		sessions:        make(map[int64]UserSession),
+		revokedSessions: make(map[int64]bool),
+
+		consumedTokens: make(map[string]bool),
 	}
 }
 
@@ -183,6 +590,21 @@ func Test_createUser(t *testing.T) {
 			},
 		},
 
+		"successful dispatcher save": {
+			db: newMockDB(),
+			us: User{
+				SecuredUser: SecuredUser{
+					Email: "dispatcher@hotmail.com",
+					Role:  "dispatcher",
+				},
+				Password: "a_pass",
+			},
+			want: SecuredUser{
+				Email: "dispatcher@hotmail.com",
+				Role:  "dispatcher",
+			},
+		},
+
 		"db failure on user save": {
 			db: newMockDB().onCreate("failure_email@hotmail.com", fmt.Errorf("mock db save error")),
 			us: User{
@@ -195,6 +617,30 @@ func Test_createUser(t *testing.T) {
 			expected: ErrStorageSave,
 		},
 
+		"invalid email failure on user save": {
+			db: newMockDB(),
+			us: User{
+				SecuredUser: SecuredUser{
+					Email: "an invalid email",
+					Role:  "admin",
+				},
+				Password: "a_pass",
+			},
+			expected: ErrInvalidEmail,
+		},
+
+		"duplicated email failure on user save": {
+			db: newMockDB().onCreate("duplicated_email@hotmail.com", ErrUserDuplicated),
+			us: User{
+				SecuredUser: SecuredUser{
+					Email: "duplicated_email@hotmail.com",
+					Role:  "admin",
+				},
+				Password: "a_pass",
+			},
+			expected: ErrEmailAlreadyExists,
+		},
+
 		"invalid role failure on user save": {
 			db: newMockDB(),
 			us: User{
@@ -300,6 +746,27 @@ func Test_getUser(t *testing.T) {
 	}
 }
 
+func Test_userIDByUUID(t *testing.T) {
+	db := newMockDB()
+	createdUser, _ := NewUserStorage(db).Save(context.Background(), User{
+		SecuredUser: SecuredUser{
+			Email: "driver@hotmail.com",
+			Role:  "driver",
+		},
+		Password: "a pass",
+	})
+	userStorage := NewUserStorage(db)
+
+	assert.NotEmpty(t, createdUser.UUID)
+
+	id, err := userStorage.IDByUUID(context.Background(), createdUser.UUID)
+	assert.Nil(t, err)
+	assert.Equal(t, createdUser.ID, id)
+
+	_, err = userStorage.IDByUUID(context.Background(), "6ba7b810-9dad-41d1-80b4-00c04fd430c8")
+	assert.Equal(t, ErrNotFoundUser.Error(), err.Error())
+}
+
 func Test_loginUser(t *testing.T) {
 	// config secret
 	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
@@ -312,6 +779,15 @@ func Test_loginUser(t *testing.T) {
 		},
 		Password: "a pass",
 	})
+	suspended, _ := dbWithUser.SaveUser(context.Background(), User{
+		SecuredUser: SecuredUser{
+			Email: "suspended@asa.com",
+			Role:  "driver",
+		},
+		Password: "a pass",
+	})
+	suspended.Active = false
+	_, _ = dbWithUser.UpdateStatus(context.Background(), suspended)
 
 	tests := map[string]struct {
 		db        repository
@@ -330,6 +806,18 @@ func Test_loginUser(t *testing.T) {
 			encrypter: NoEncrypter{},
 		},
 
+		"failure suspended user": {
+			db: dbWithUser,
+			user: User{
+				SecuredUser: SecuredUser{
+					Email: "suspended@asa.com",
+				},
+				Password: "a pass",
+			},
+			encrypter: NoEncrypter{},
+			expected:  ErrSuspendedUser,
+		},
+
 		"db failure user not found": {
 			db: newMockDB(),
 			user: User{
@@ -372,33 +860,374 @@ func Test_loginUser(t *testing.T) {
 	}
 }
 
-func Test_searchUser(t *testing.T) {
-	tests := map[string]struct {
-		db           repository
-		opts         []SearchOption
-		wantUsers    []SecuredUser
-		wantMetadata Metadata
-		expected     error
-	}{
-		"successful free drivers search": {
-			db:   newMockDB(),
-			opts: []SearchOption{WithStatus(StatusSearchFree)},
-			wantUsers: []SecuredUser{
-				{
-					ID:    1,
-					Email: "an_email@hotmail.com",
-					Role:  "driver",
-				},
-				{
-					ID:    2,
-					Email: "another_email@hotmail.com",
-					Role:  "driver",
-				},
-			},
-			wantMetadata: Metadata{
-				Total:   2,
-				Pending: 0,
-			},
+func Test_rehashPasswordOnLogin(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	db := newMockDB()
+	created, err := NewUserStorage(db, WithBcryptCost(bcrypt.MinCost)).Save(context.Background(), User{
+		SecuredUser: SecuredUser{
+			Email: "anEmail@asa.com",
+			Role:  "admin",
+		},
+		Password: "a pass",
+	})
+	assert.Nil(t, err)
+
+	login := User{SecuredUser: SecuredUser{Email: "anEmail@asa.com"}, Password: "a pass"}
+
+	// a higher cost encrypts again the password
+	_, err = NewUserStorage(db, WithBcryptCost(bcrypt.MinCost+1)).Login(context.Background(), login)
+	assert.Nil(t, err)
+
+	cost, err := bcrypt.Cost([]byte(db.users[created.ID].Password))
+	assert.Nil(t, err)
+	assert.Equal(t, bcrypt.MinCost+1, cost)
+
+	// a lower cost keeps the password
+	_, err = NewUserStorage(db, WithBcryptCost(bcrypt.MinCost)).Login(context.Background(), login)
+	assert.Nil(t, err)
+
+	cost, err = bcrypt.Cost([]byte(db.users[created.ID].Password))
+	assert.Nil(t, err)
+	assert.Equal(t, bcrypt.MinCost+1, cost)
+
+	// an invalid password is not encrypted again
+	login.Password = "another pass"
+	_, err = NewUserStorage(db, WithBcryptCost(bcrypt.MinCost+2)).Login(context.Background(), login)
+	assert.Equal(t, ErrInvalidPasswordToLogin.Error(), err.Error())
+
+	cost, err = bcrypt.Cost([]byte(db.users[created.ID].Password))
+	assert.Nil(t, err)
+	assert.Equal(t, bcrypt.MinCost+1, cost)
+}
+
+func Test_refreshSession(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	db := newMockDB()
+	storage := NewUserStorage(db, WithPasswordEncrypter(NoEncrypter{}))
+	created, err := storage.Save(context.Background(), User{
+		SecuredUser: SecuredUser{
+			Email: "anEmail@asa.com",
+			Role:  "driver",
+		},
+		Password: "a pass",
+	})
+	assert.Nil(t, err)
+
+	login := User{SecuredUser: SecuredUser{Email: "anEmail@asa.com"}, Password: "a pass"}
+
+	// an invalid refresh token
+	_, err = storage.Refresh(context.Background(), "a refresh token")
+	assert.Equal(t, ErrInvalidRefreshToken.Error(), err.Error())
+
+	// an expired refresh token
+	session, err := storage.Login(context.Background(), login)
+	assert.Nil(t, err)
+
+	expired := db.refreshTokens[hashRefreshToken(session.RefreshToken)]
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	db.refreshTokens[expired.TokenHash] = expired
+
+	_, err = storage.Refresh(context.Background(), session.RefreshToken)
+	assert.Equal(t, ErrInvalidRefreshToken.Error(), err.Error())
+
+	// changing the password revokes the refresh tokens
+	session, err = storage.Login(context.Background(), login)
+	assert.Nil(t, err)
+
+	adminCtx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: RoleAdmin})
+	err = storage.ChangePassword(adminCtx, created.ID, PasswordChange{NewPassword: "a pass"})
+	assert.Nil(t, err)
+
+	_, err = storage.Refresh(context.Background(), session.RefreshToken)
+	assert.Equal(t, ErrInvalidRefreshToken.Error(), err.Error())
+
+	// a suspended user cannot refresh its session
+	session, err = storage.Login(context.Background(), login)
+	assert.Nil(t, err)
+
+	suspended := db.users[created.ID]
+	suspended.Active = false
+	db.users[created.ID] = suspended
+
+	_, err = storage.Refresh(context.Background(), session.RefreshToken)
+	assert.Equal(t, ErrSuspendedUser.Error(), err.Error())
+}
+
+func Test_loginWithScope(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	db := newMockDB()
+	db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "driver@hotmail.com", Role: RoleDriver, Active: true},
+		Password: "a pass"}
+	db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "dispatcher@hotmail.com", Role: RoleDispatcher,
+		Active: true}, Password: "a pass"}
+	db.users[3] = User{SecuredUser: SecuredUser{ID: 3, Email: "secured@hotmail.com", Role: RoleDriver, Active: true},
+		TwoFactorEnabled: true, TOTPSecret: "JBSWY3DPEHPK3PXP", Password: "a pass"}
+	storage := NewUserStorage(db, WithPasswordEncrypter(NoEncrypter{}))
+	login := func(email, scope string) (Session, error) {
+		return storage.LoginWithScope(context.Background(), User{SecuredUser: SecuredUser{Email: email},
+			Password: "a pass"}, scope)
+	}
+	scopeOf := func(token string) string {
+		parsed, err := jwt.ValidateToken(context.Background(), token)
+		assert.Nil(t, err)
+		claims, err := jwt.GetClaims(parsed)
+		assert.Nil(t, err)
+		return claims.Scope
+	}
+
+	// the scope is kept by the session and its refreshes
+	session, err := login("driver@hotmail.com", ScopeDriverApp)
+	assert.Nil(t, err)
+	assert.Equal(t, ScopeDriverApp, scopeOf(session.Token))
+	assert.Equal(t, ScopeDriverApp, db.sessions[1].Scope)
+
+	session, err = storage.Refresh(context.Background(), session.RefreshToken)
+	assert.Nil(t, err)
+	assert.Equal(t, ScopeDriverApp, scopeOf(session.Token))
+
+	session, err = login("driver@hotmail.com", "")
+	assert.Nil(t, err)
+	assert.Empty(t, scopeOf(session.Token))
+
+	// the challenge keeps the scope to complete the login
+	session, err = login("secured@hotmail.com", ScopeDriverApp)
+	assert.Nil(t, err)
+	code, err := totp.Code("JBSWY3DPEHPK3PXP", time.Now())
+	assert.Nil(t, err)
+	session, err = storage.LoginTwoFactor(context.Background(), session.Challenge, code)
+	assert.Nil(t, err)
+	assert.Equal(t, ScopeDriverApp, scopeOf(session.Token))
+
+	_, err = login("dispatcher@hotmail.com", ScopeDriverApp)
+	assert.Equal(t, ErrInvalidScope.Error(), err.Error())
+
+	_, err = login("driver@hotmail.com", "admin_app")
+	assert.Equal(t, ErrInvalidScope.Error(), err.Error())
+}
+
+// eventRecorder a SecurityAuditor which keeps the recorded events
+type eventRecorder struct {
+	events []audit.Event
+}
+
+func (r *eventRecorder) Record(ctx context.Context, event audit.Event) {
+	r.events = append(r.events, event)
+}
+
+func Test_securityEvents(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	recorder := &eventRecorder{}
+	storage := NewUserStorage(newMockDB(), WithPasswordEncrypter(NoEncrypter{}), WithSecurityAuditor(recorder))
+	created, err := storage.Save(context.Background(), User{
+		SecuredUser: SecuredUser{
+			Email: "anEmail@asa.com",
+			Role:  "driver",
+		},
+		Password: "a pass",
+	})
+	assert.Nil(t, err)
+
+	login := func(email, password string) (Session, error) {
+		return storage.Login(context.Background(), User{SecuredUser: SecuredUser{Email: email}, Password: password})
+	}
+
+	_, err = login("other@asa.com", "a pass")
+	assert.Equal(t, ErrNotFoundUser.Error(), err.Error())
+
+	// the mocked encrypter fails to compare passwords with error
+	_, err = login("anEmail@asa.com", "an error")
+	assert.Equal(t, ErrInvalidPasswordToLogin.Error(), err.Error())
+
+	session, err := login("anEmail@asa.com", "a pass")
+	assert.Nil(t, err)
+
+	_, err = storage.Refresh(context.Background(), session.RefreshToken)
+	assert.Nil(t, err)
+
+	// the reuse of a refresh token revokes every refresh token of the user
+	_, err = storage.Refresh(context.Background(), session.RefreshToken)
+	assert.Equal(t, ErrInvalidRefreshToken.Error(), err.Error())
+
+	assert.Equal(t, []audit.Event{
+		{Type: audit.EventLoginFailed, Email: "other@asa.com", Detail: "unknown email"},
+		{Type: audit.EventLoginFailed, UserID: created.ID, Email: "anEmail@asa.com", Detail: "invalid password"},
+		{Type: audit.EventLogin, UserID: created.ID, Email: "anEmail@asa.com"},
+		{Type: audit.EventTokenRefresh, UserID: created.ID, Email: "anEmail@asa.com"},
+		{Type: audit.EventTokenRevoked, UserID: created.ID, Detail: "refresh token reused"},
+	}, recorder.events)
+}
+
+func Test_loginThrottle(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	now := time.Now()
+	throttle := NewLoginThrottle(LoginThrottleConfig{MaxFailures: 2, Backoff: time.Minute, IPMaxFailures: 4})
+	throttle.now = func() time.Time { return now }
+
+	storage := NewUserStorage(newMockDB(), WithPasswordEncrypter(NoEncrypter{}), WithLoginThrottle(throttle))
+	for _, email := range []string{"anEmail@asa.com", "other@asa.com"} {
+		_, err := storage.Save(context.Background(), User{
+			SecuredUser: SecuredUser{Email: email, Role: "driver"},
+			Password:    "a pass",
+		})
+		assert.Nil(t, err)
+	}
+
+	login := func(ip, email, password string) error {
+		ctx := context.WithValue(context.Background(), audit.ClientKey, audit.Client{IP: ip})
+		_, err := storage.Login(ctx, User{SecuredUser: SecuredUser{Email: email}, Password: password})
+		return err
+	}
+
+	// the mocked encrypter fails to compare passwords with error
+	for i := 0; i < 2; i++ {
+		err := login("10.0.0.1", "anEmail@asa.com", "an error")
+		assert.Equal(t, ErrInvalidPasswordToLogin.Error(), err.Error())
+	}
+
+	// the email is blocked for the backoff, even with the right password or from another ip
+	err := login("10.0.0.2", "ANEMAIL@asa.com", "a pass")
+	assert.Equal(t, ErrTooManyLoginAttempts.Error(), err.Error())
+
+	now = now.Add(time.Minute)
+	err = login("10.0.0.1", "anEmail@asa.com", "an error")
+	assert.Equal(t, ErrInvalidPasswordToLogin.Error(), err.Error())
+
+	// the backoff is doubled on each new failure
+	now = now.Add(time.Minute)
+	err = login("10.0.0.2", "anEmail@asa.com", "a pass")
+	assert.Equal(t, ErrTooManyLoginAttempts.Error(), err.Error())
+
+	now = now.Add(time.Minute)
+	err = login("10.0.0.2", "anEmail@asa.com", "a pass")
+	assert.Nil(t, err)
+
+	// the ip is banned after its max failures of any email
+	err = login("10.0.0.1", "unknown@asa.com", "a pass")
+	assert.Equal(t, ErrNotFoundUser.Error(), err.Error())
+
+	err = login("10.0.0.1", "other@asa.com", "a pass")
+	assert.Equal(t, ErrTooManyLoginAttempts.Error(), err.Error())
+
+	err = login("10.0.0.2", "other@asa.com", "a pass")
+	assert.Nil(t, err)
+}
+
+func Test_searchUser(t *testing.T) {
+	// the travel the busy driver of the mock db is busy with
+	busyTravelID := int64(10)
+
+	tests := map[string]struct {
+		db           repository
+		storageOpts  []UserStorageOption
+		opts         []SearchOption
+		wantUsers    []SecuredUser
+		wantMetadata Metadata
+		expected     error
+	}{
+		"successful free drivers search": {
+			db:   newMockDB(),
+			opts: []SearchOption{WithStatus(StatusSearchFree)},
+			wantUsers: []SecuredUser{
+				{
+					ID:    1,
+					Email: "an_email@hotmail.com",
+					Role:  "driver",
+				},
+				{
+					ID:    2,
+					Email: "another_email@hotmail.com",
+					Role:  "driver",
+				},
+			},
+			wantMetadata: Metadata{
+				Total:   2,
+				Pending: 0,
+			},
+		},
+
+		"successful free drivers search on zone": {
+			db:   newMockDB(),
+			opts: []SearchOption{WithStatus(StatusSearchFree), WithZone(1)},
+			wantUsers: []SecuredUser{
+				{
+					ID:    2,
+					Email: "another_email@hotmail.com",
+					Role:  "driver",
+				},
+			},
+			wantMetadata: Metadata{
+				Total:   1,
+				Pending: 0,
+			},
+		},
+
+		"successful free drivers search on team": {
+			db:   newMockDB(),
+			opts: []SearchOption{WithStatus(StatusSearchFree), WithTeam(1)},
+			wantUsers: []SecuredUser{
+				{
+					ID:    1,
+					Email: "an_email@hotmail.com",
+					Role:  "driver",
+				},
+			},
+			wantMetadata: Metadata{
+				Total:   1,
+				Pending: 0,
+			},
+		},
+
+		"successful free drivers paginate search": {
+			db:   newMockDB(),
+			opts: []SearchOption{WithStatus(StatusSearchFree), WithLimit(1), WithOffset(1)},
+			wantUsers: []SecuredUser{
+				{
+					ID:    2,
+					Email: "another_email@hotmail.com",
+					Role:  "driver",
+				},
+			},
+			wantMetadata: Metadata{
+				Total:   2,
+				Pending: 0,
+			},
+		},
+
+		"successful free drivers search with other driver roles": {
+			db:          newMockDB(),
+			storageOpts: []UserStorageOption{WithDriverAvailability([]string{RoleDispatcher}, nil)},
+			opts:        []SearchOption{WithStatus(StatusSearchFree)},
+			wantMetadata: Metadata{
+				Total:   0,
+				Pending: 0,
+			},
+		},
+
+		"successful busy drivers search": {
+			db:   newMockDB(),
+			opts: []SearchOption{WithStatus(StatusSearchBusy)},
+			wantUsers: []SecuredUser{
+				{
+					ID:       3,
+					Email:    "busy_email@hotmail.com",
+					Role:     "driver",
+					TravelID: &busyTravelID,
+				},
+			},
+			wantMetadata: Metadata{
+				Total:   1,
+				Pending: 0,
+			},
 		},
 
 		"failure free drivers search: not found": {
@@ -500,12 +1329,14 @@ func Test_searchUser(t *testing.T) {
 
 	for name, tc := range tests {
 		t.Run(name, func(t *testing.T) {
-			userStorage := NewUserStorage(tc.db)
+			userStorage := NewUserStorage(tc.db, tc.storageOpts...)
 			result, meta, err := userStorage.Search(context.Background(), tc.opts...)
 
 			if tc.expected == nil {
 				assert.Nil(t, err)
-				assert.NotNil(t, result)
+				if len(tc.wantUsers) > 0 {
+					assert.NotNil(t, result)
+				}
 
 				assert.Len(t, result, len(tc.wantUsers))
 				assert.Equal(t, tc.wantMetadata.Total, meta.Total)
@@ -523,3 +1354,1256 @@ func Test_searchUser(t *testing.T) {
 		})
 	}
 }
+
+func Test_updateUser(t *testing.T) {
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: RoleAdmin}, Password: "a pass"}
+		db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver}, Password: "a pass"}
+		return db
+	}
+
+	admin := &jwt.Claims{UserID: 1, Role: RoleAdmin}
+	driver := &jwt.Claims{UserID: 2, Role: RoleDriver}
+
+	tests := map[string]struct {
+		db         *mockDb
+		userLogged *jwt.Claims
+		user       SecuredUser
+		want       SecuredUser
+		expected   error
+	}{
+		"successful user update from admin": {
+			db:         newDb(),
+			userLogged: admin,
+			user:       SecuredUser{ID: 2, Email: "new-driver@hotmail.com", Role: RoleAdmin},
+			want:       SecuredUser{ID: 2, Email: "new-driver@hotmail.com", Role: RoleAdmin},
+		},
+
+		"successful user update from the same driver": {
+			db:         newDb(),
+			userLogged: driver,
+			user:       SecuredUser{ID: 2, Email: "new-driver@hotmail.com", Role: RoleDriver},
+			want:       SecuredUser{ID: 2, Email: "new-driver@hotmail.com", Role: RoleDriver},
+		},
+
+		"successful user update with profile": {
+			db:         newDb(),
+			userLogged: driver,
+			user: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver,
+				Profile: Profile{Name: "a driver name", Phone: "+54 11 5555-5555", LicenseNumber: "AB123456"}},
+			want: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver,
+				Profile: Profile{Name: "a driver name", Phone: "+54 11 5555-5555", LicenseNumber: "AB123456"}},
+		},
+
+		"failure user update: no user logged in": {
+			db:       newDb(),
+			user:     SecuredUser{ID: 2, Email: "new-driver@hotmail.com", Role: RoleDriver},
+			expected: ErrInvalidUserClaims,
+		},
+
+		"failure user update: driver editing another user": {
+			db:         newDb(),
+			userLogged: driver,
+			user:       SecuredUser{ID: 1, Email: "new-admin@hotmail.com", Role: RoleAdmin},
+			expected:   ErrInvalidUserAccess,
+		},
+
+		"failure user update: driver changing its role": {
+			db:         newDb(),
+			userLogged: driver,
+			user:       SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleAdmin},
+			expected:   ErrInvalidUserAccess,
+		},
+
+		"failure user update: invalid role": {
+			db:         newDb(),
+			userLogged: admin,
+			user:       SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: "an invalid role"},
+			expected:   ErrInvalidRole,
+		},
+
+		"failure user update: email of another user": {
+			db:         newDb(),
+			userLogged: admin,
+			user:       SecuredUser{ID: 2, Email: "admin@hotmail.com", Role: RoleDriver},
+			expected:   ErrEmailAlreadyExists,
+		},
+
+		"failure user update: user not found": {
+			db:         newDb().onGet(3, ErrUserNotFound),
+			userLogged: admin,
+			user:       SecuredUser{ID: 3, Email: "another@hotmail.com", Role: RoleDriver},
+			expected:   ErrNotFoundUser,
+		},
+
+		"db failure user update": {
+			db:         newDb().onUpdate(2, errors.New("mocked update error")),
+			userLogged: admin,
+			user:       SecuredUser{ID: 2, Email: "new-driver@hotmail.com", Role: RoleDriver},
+			expected:   ErrStorageUpdate,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.userLogged != nil {
+				ctx = context.WithValue(ctx, "user_on_call", *tc.userLogged)
+			}
+
+			result, err := NewUserStorage(tc.db).Update(ctx, tc.user)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+
+				// the password is kept
+				assert.Equal(t, tc.want.Email, tc.db.users[tc.want.ID].Email)
+				assert.Equal(t, tc.want.Profile, tc.db.users[tc.want.ID].Profile)
+				assert.Equal(t, "a pass", tc.db.users[tc.want.ID].Password)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_deleteUser(t *testing.T) {
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "driver@hotmail.com", Role: RoleDriver}}
+		db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "busy-driver@hotmail.com", Role: RoleDriver}}
+		db.activeTravels[2] = true
+		return db
+	}
+
+	tests := map[string]struct {
+		id       int64
+		expected error
+	}{
+		"successful user delete": {
+			id: 1,
+		},
+
+		"failure user delete: user not found": {
+			id:       3,
+			expected: ErrNotFoundUser,
+		},
+
+		"failure user delete: user with active travels": {
+			id:       2,
+			expected: ErrUserHasActiveTravels,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			db := newDb()
+			userStorage := NewUserStorage(db)
+			err := userStorage.Delete(context.Background(), tc.id)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+
+				// the deleted user cannot be got nor login
+				_, err = userStorage.Get(context.Background(), tc.id)
+				assert.NotNil(t, err)
+				_, err = userStorage.Login(context.Background(), User{SecuredUser: SecuredUser{Email: "driver@hotmail.com"}})
+				assert.Equal(t, ErrNotFoundUser, err)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_changePassword(t *testing.T) {
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: RoleAdmin}, Password: "a pass"}
+		db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver}, Password: "a pass"}
+		return db
+	}
+
+	admin := &jwt.Claims{UserID: 1, Role: RoleAdmin}
+	driver := &jwt.Claims{UserID: 2, Role: RoleDriver}
+
+	tests := map[string]struct {
+		db         *mockDb
+		userLogged *jwt.Claims
+		id         int64
+		change     PasswordChange
+		expected   error
+	}{
+		"successful password change from the same driver": {
+			db:         newDb(),
+			userLogged: driver,
+			id:         2,
+			change:     PasswordChange{CurrentPassword: "a pass", NewPassword: "a new pass"},
+		},
+
+		"successful password change from admin without current password": {
+			db:         newDb(),
+			userLogged: admin,
+			id:         2,
+			change:     PasswordChange{NewPassword: "a new pass"},
+		},
+
+		"failure password change: no user logged in": {
+			db:       newDb(),
+			id:       2,
+			change:   PasswordChange{CurrentPassword: "a pass", NewPassword: "a new pass"},
+			expected: ErrInvalidUserClaims,
+		},
+
+		"failure password change: driver changing another user password": {
+			db:         newDb(),
+			userLogged: driver,
+			id:         1,
+			change:     PasswordChange{CurrentPassword: "a pass", NewPassword: "a new pass"},
+			expected:   ErrInvalidPasswordAccess,
+		},
+
+		"failure password change: invalid current password": {
+			db:         newDb(),
+			userLogged: driver,
+			id:         2,
+			change:     PasswordChange{CurrentPassword: "an error pass", NewPassword: "a new pass"},
+			expected:   ErrInvalidCurrentPassword,
+		},
+
+		"failure password change: user not found": {
+			db:         newDb().onGet(3, ErrUserNotFound),
+			userLogged: admin,
+			id:         3,
+			change:     PasswordChange{NewPassword: "a new pass"},
+			expected:   ErrNotFoundUser,
+		},
+
+		"failure password change: encrypter error": {
+			db:         newDb(),
+			userLogged: admin,
+			id:         2,
+			change:     PasswordChange{NewPassword: "an error pass"},
+			expected:   ErrInvalidPasswordToSave,
+		},
+
+		"db failure password change": {
+			db:         newDb().onUpdate(2, errors.New("mocked update error")),
+			userLogged: admin,
+			id:         2,
+			change:     PasswordChange{NewPassword: "a new pass"},
+			expected:   ErrStorageUpdate,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.userLogged != nil {
+				ctx = context.WithValue(ctx, "user_on_call", *tc.userLogged)
+			}
+
+			userStorage := NewUserStorage(tc.db, WithPasswordEncrypter(NoEncrypter{}))
+			err := userStorage.ChangePassword(ctx, tc.id, tc.change)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.change.NewPassword, tc.db.users[tc.id].Password)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				assert.Equal(t, "a pass", tc.db.users[2].Password)
+			}
+		})
+	}
+}
+
+func Test_changeStatus(t *testing.T) {
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: RoleAdmin, Active: true}}
+		db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver, Active: true}}
+		db.users[3] = User{SecuredUser: SecuredUser{ID: 3, Email: "suspended@hotmail.com", Role: RoleDriver,
+			StatusReason: "expired license"}}
+		return db
+	}
+
+	admin := &jwt.Claims{UserID: 1, Role: RoleAdmin}
+	suspend, activate := false, true
+
+	tests := map[string]struct {
+		db         *mockDb
+		userLogged *jwt.Claims
+		id         int64
+		change     StatusChange
+		want       SecuredUser
+		expected   error
+	}{
+		"successful driver suspension": {
+			db:         newDb(),
+			userLogged: admin,
+			id:         2,
+			change:     StatusChange{Active: &suspend, Reason: "too many complaints"},
+			want: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver,
+				StatusReason: "too many complaints"},
+		},
+
+		"successful driver activation": {
+			db:         newDb(),
+			userLogged: admin,
+			id:         3,
+			change:     StatusChange{Active: &activate, Reason: "renewed license"},
+			want: SecuredUser{ID: 3, Email: "suspended@hotmail.com", Role: RoleDriver, Active: true,
+				StatusReason: "renewed license"},
+		},
+
+		"failure status change: no user logged in": {
+			db:       newDb(),
+			id:       2,
+			change:   StatusChange{Active: &suspend},
+			expected: ErrInvalidUserClaims,
+		},
+
+		"failure status change: admin suspending itself": {
+			db:         newDb(),
+			userLogged: admin,
+			id:         1,
+			change:     StatusChange{Active: &suspend},
+			expected:   ErrInvalidStatusAccess,
+		},
+
+		"failure status change: user not found": {
+			db:         newDb().onGet(4, ErrUserNotFound),
+			userLogged: admin,
+			id:         4,
+			change:     StatusChange{Active: &suspend},
+			expected:   ErrNotFoundUser,
+		},
+
+		"db failure status change": {
+			db:         newDb().onUpdate(2, errors.New("mocked update error")),
+			userLogged: admin,
+			id:         2,
+			change:     StatusChange{Active: &suspend},
+			expected:   ErrStorageUpdate,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			if tc.userLogged != nil {
+				ctx = context.WithValue(ctx, "user_on_call", *tc.userLogged)
+			}
+
+			userStorage := NewUserStorage(tc.db)
+			result, err := userStorage.ChangeStatus(ctx, tc.id, tc.change)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+				assert.Equal(t, tc.want.Active, tc.db.users[tc.id].Active)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				assert.True(t, tc.db.users[2].Active)
+			}
+		})
+	}
+}
+
+func Test_listUsers(t *testing.T) {
+	// the admin was the last one created and the first driver the last one updated
+	day := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: RoleAdmin,
+			CreatedAt: day.Add(2 * time.Hour), UpdatedAt: day.Add(2 * time.Hour)}}
+		db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver,
+			CreatedAt: day, UpdatedAt: day.Add(3 * time.Hour)}}
+		db.users[3] = User{SecuredUser: SecuredUser{ID: 3, Email: "another-driver@hotmail.com", Role: RoleDriver,
+			CreatedAt: day.Add(time.Hour), UpdatedAt: day.Add(time.Hour)}}
+		return db
+	}
+
+	tests := map[string]struct {
+		db       *mockDb
+		opts     []SearchOption
+		want     []int64
+		wantMeta Metadata
+		expected error
+	}{
+		"successful list of every role": {
+			db:       newDb(),
+			want:     []int64{1, 2, 3},
+			wantMeta: Metadata{Total: 3},
+		},
+
+		"successful list of admins": {
+			db:       newDb(),
+			opts:     []SearchOption{WithRole(RoleAdmin)},
+			want:     []int64{1},
+			wantMeta: Metadata{Total: 1},
+		},
+
+		"successful list of drivers paginated": {
+			db:       newDb(),
+			opts:     []SearchOption{WithRole(RoleDriver), WithLimit(1)},
+			want:     []int64{2},
+			wantMeta: Metadata{Total: 2, Pending: 1},
+		},
+
+		"successful list with offset": {
+			db:       newDb(),
+			opts:     []SearchOption{WithLimit(2), WithOffset(2)},
+			want:     []int64{3},
+			wantMeta: Metadata{Total: 3},
+		},
+
+		"successful list sorted by creation": {
+			db:       newDb(),
+			opts:     []SearchOption{WithSort(SortByCreatedAt)},
+			want:     []int64{1, 3, 2},
+			wantMeta: Metadata{Total: 3},
+		},
+
+		"successful list of drivers sorted by modification": {
+			db:       newDb(),
+			opts:     []SearchOption{WithRole(RoleDriver), WithSort(SortByUpdatedAt)},
+			want:     []int64{2, 3},
+			wantMeta: Metadata{Total: 2},
+		},
+
+		"failure list: invalid sort": {
+			db:       newDb(),
+			opts:     []SearchOption{WithSort("email")},
+			expected: ErrInvalidSort,
+		},
+
+		"successful list by email": {
+			db:       newDb(),
+			opts:     []SearchOption{WithEmail("driver@hotmail.com")},
+			want:     []int64{2},
+			wantMeta: Metadata{Total: 1},
+		},
+
+		"successful list by email: not found": {
+			db:   newDb(),
+			opts: []SearchOption{WithEmail("unknown@hotmail.com")},
+		},
+
+		"successful list by email: user of another role": {
+			db:   newDb(),
+			opts: []SearchOption{WithEmail("driver@hotmail.com"), WithRole(RoleAdmin)},
+		},
+
+		"failure list: invalid role": {
+			db:       newDb(),
+			opts:     []SearchOption{WithRole("an invalid role")},
+			expected: ErrInvalidRole,
+		},
+
+		"db failure list": {
+			db:       newDb().onGetByRole(errors.New("mocked get error")),
+			expected: ErrStorageGet,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, meta, err := NewUserStorage(tc.db).List(context.Background(), tc.opts...)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.wantMeta, meta)
+
+				var ids []int64
+				for _, u := range result {
+					ids = append(ids, u.ID)
+				}
+				assert.Equal(t, tc.want, ids)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+// mockVehicleFinder return the vehicles of the drivers on its map
+type mockVehicleFinder struct {
+	vehicles map[int64]vehicle.Vehicle
+	err      error
+}
+
+func (finder mockVehicleFinder) ByDrivers(ctx context.Context, userIDs ...int64) (map[int64]vehicle.Vehicle, error) {
+	if finder.err != nil {
+		return nil, finder.err
+	}
+
+	vehicles := make(map[int64]vehicle.Vehicle)
+	for _, userID := range userIDs {
+		if v, ok := finder.vehicles[userID]; ok {
+			vehicles[userID] = v
+		}
+	}
+
+	return vehicles, nil
+}
+
+func Test_userVehicle(t *testing.T) {
+	driverID := int64(2)
+	driverVehicle := vehicle.Vehicle{ID: 1, Plate: "AB123CD", Capacity: 4, Class: vehicle.ClassEconomy, UserID: &driverID}
+	finder := mockVehicleFinder{vehicles: map[int64]vehicle.Vehicle{2: driverVehicle}}
+
+	t.Run("driver got with its vehicle", func(t *testing.T) {
+		db := newMockDB()
+		db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver}}
+
+		result, err := NewUserStorage(db, WithVehicleFinder(finder)).Get(context.Background(), 2)
+		assert.Nil(t, err)
+		assert.Equal(t, &driverVehicle, result.Vehicle)
+	})
+
+	t.Run("free drivers searched with their vehicles", func(t *testing.T) {
+		result, _, err := NewUserStorage(newMockDB(), WithVehicleFinder(finder)).Search(context.Background(),
+			WithStatus(StatusSearchFree))
+		assert.Nil(t, err)
+
+		if assert.Len(t, result, 2) {
+			assert.Nil(t, result[0].Vehicle)
+			assert.Equal(t, &driverVehicle, result[1].Vehicle)
+		}
+	})
+
+	t.Run("failure getting vehicles", func(t *testing.T) {
+		_, _, err := NewUserStorage(newMockDB(), WithVehicleFinder(mockVehicleFinder{err: errors.New("mocked error")})).
+			Search(context.Background(), WithStatus(StatusSearchFree))
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrStorageGet.Error(), err.Error())
+	})
+}
+
+func Test_userCache(t *testing.T) {
+	now := time.Date(2021, 12, 1, 10, 0, 0, 0, time.UTC)
+	newCache := func(size int) *Cache {
+		cache := NewCache(size, time.Minute)
+		cache.now = func() time.Time { return now }
+		return cache
+	}
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: RoleAdmin, Active: true}}
+		db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver, Active: true}}
+		return db
+	}
+	ctx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: RoleAdmin})
+
+	t.Run("user got from the cache until it expires", func(t *testing.T) {
+		db := newDb()
+		cache := newCache(10)
+		userStorage := NewUserStorage(db, WithCache(cache))
+
+		_, err := userStorage.Get(ctx, 2)
+		assert.Nil(t, err)
+
+		db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "changed@hotmail.com", Role: RoleDriver}}
+		result, err := userStorage.Get(ctx, 2)
+		assert.Nil(t, err)
+		assert.Equal(t, "driver@hotmail.com", result.Email)
+
+		now = now.Add(time.Minute)
+		result, err = userStorage.Get(ctx, 2)
+		assert.Nil(t, err)
+		assert.Equal(t, "changed@hotmail.com", result.Email)
+	})
+
+	t.Run("user invalidated on update and suspension from another storage", func(t *testing.T) {
+		db := newDb()
+		cache := newCache(10)
+		userStorage := NewUserStorage(db, WithCache(cache))
+		anotherStorage := NewUserStorage(db, WithCache(cache))
+
+		_, err := userStorage.Get(ctx, 2)
+		assert.Nil(t, err)
+
+		_, err = anotherStorage.Update(ctx, SecuredUser{ID: 2, Email: "changed@hotmail.com", Role: RoleDriver})
+		assert.Nil(t, err)
+		result, err := userStorage.Get(ctx, 2)
+		assert.Nil(t, err)
+		assert.Equal(t, "changed@hotmail.com", result.Email)
+
+		suspend := false
+		_, err = anotherStorage.ChangeStatus(ctx, 2, StatusChange{Active: &suspend})
+		assert.Nil(t, err)
+		result, err = userStorage.Get(ctx, 2)
+		assert.Nil(t, err)
+		assert.False(t, result.Active)
+	})
+
+	t.Run("user invalidated on delete", func(t *testing.T) {
+		db := newDb()
+		userStorage := NewUserStorage(db, WithCache(newCache(10)))
+
+		_, err := userStorage.Get(ctx, 2)
+		assert.Nil(t, err)
+
+		assert.Nil(t, userStorage.Delete(ctx, 2))
+		_, err = userStorage.Get(ctx, 2)
+		assert.NotNil(t, err)
+	})
+
+	t.Run("least recently used user evicted", func(t *testing.T) {
+		db := newDb()
+		userStorage := NewUserStorage(db, WithCache(newCache(1)))
+
+		_, err := userStorage.Get(ctx, 1)
+		assert.Nil(t, err)
+		_, err = userStorage.Get(ctx, 2)
+		assert.Nil(t, err)
+
+		db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "changed@hotmail.com", Role: RoleAdmin}}
+		db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "changed@hotmail.com", Role: RoleDriver}}
+		result, err := userStorage.Get(ctx, 1)
+		assert.Nil(t, err)
+		assert.Equal(t, "changed@hotmail.com", result.Email)
+		result, err = userStorage.Get(ctx, 2)
+		assert.Nil(t, err)
+		assert.Equal(t, "changed@hotmail.com", result.Email)
+	})
+}
+
+func Test_twoFactor(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: RoleAdmin, Active: true}}
+		db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver, Active: true}}
+		return db
+	}
+	adminCtx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: RoleAdmin})
+	login := func(userStorage UserStorage, email string) (Session, error) {
+		return userStorage.Login(context.Background(), User{SecuredUser: SecuredUser{Email: email}})
+	}
+
+	t.Run("successful enrollment and two factor login", func(t *testing.T) {
+		db := newDb()
+		userStorage := NewUserStorage(db, WithPasswordEncrypter(NoEncrypter{}), WithTwoFactor("Space", RoleAdmin))
+
+		session, err := login(userStorage, "admin@hotmail.com")
+		assert.Nil(t, err)
+		assert.True(t, session.TwoFactorEnrollment)
+		assert.NotEmpty(t, session.Token)
+
+		enrollment, err := userStorage.EnrollTwoFactor(adminCtx)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, enrollment.Secret)
+		assert.True(t, strings.HasPrefix(enrollment.URI, "otpauth://totp/Space:admin@hotmail.com?"))
+		assert.False(t, db.users[1].TwoFactorEnabled)
+
+		code, err := totp.Code(enrollment.Secret, time.Now())
+		assert.Nil(t, err)
+		assert.Nil(t, userStorage.ConfirmTwoFactor(adminCtx, code))
+		assert.True(t, db.users[1].TwoFactorEnabled)
+
+		session, err = login(userStorage, "admin@hotmail.com")
+		assert.Nil(t, err)
+		assert.Empty(t, session.Token)
+		assert.NotEmpty(t, session.Challenge)
+
+		challenge := session.Challenge
+		session, err = userStorage.LoginTwoFactor(context.Background(), challenge, code)
+		assert.Nil(t, err)
+		assert.NotEmpty(t, session.Token)
+
+		_, err = userStorage.LoginTwoFactor(context.Background(), challenge, code)
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrInvalidChallenge.Error(), err.Error())
+
+		_, err = userStorage.EnrollTwoFactor(adminCtx)
+		assert.Equal(t, ErrTwoFactorAlreadyEnabled.Error(), err.Error())
+	})
+
+	t.Run("roles which do not require two factor login with the token", func(t *testing.T) {
+		userStorage := NewUserStorage(newDb(), WithPasswordEncrypter(NoEncrypter{}), WithTwoFactor("Space", RoleAdmin))
+
+		session, err := login(userStorage, "driver@hotmail.com")
+		assert.Nil(t, err)
+		assert.False(t, session.TwoFactorEnrollment)
+		assert.NotEmpty(t, session.Token)
+		assert.Empty(t, session.Challenge)
+	})
+
+	t.Run("failure confirmation without enrollment", func(t *testing.T) {
+		err := NewUserStorage(newDb()).ConfirmTwoFactor(adminCtx, "123456")
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrTwoFactorNotEnrolled.Error(), err.Error())
+	})
+
+	t.Run("failure confirmation with invalid code", func(t *testing.T) {
+		userStorage := NewUserStorage(newDb())
+		_, err := userStorage.EnrollTwoFactor(adminCtx)
+		assert.Nil(t, err)
+
+		err = userStorage.ConfirmTwoFactor(adminCtx, "abcdef")
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrInvalidTwoFactorCode.Error(), err.Error())
+	})
+
+	t.Run("failure two factor login with a token instead of a challenge", func(t *testing.T) {
+		token, err := jwt.GenerateToken(1, "admin@hotmail.com", RoleAdmin, RolePermissions(RoleAdmin))
+		assert.Nil(t, err)
+
+		_, err = NewUserStorage(newDb()).LoginTwoFactor(context.Background(), token, "123456")
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrInvalidChallenge.Error(), err.Error())
+	})
+}
+
+func Test_invitation(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: RoleAdmin, Active: true}}
+		db.idCount = 2
+		return db
+	}
+	adminCtx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: RoleAdmin})
+
+	t.Run("successful invitation and acceptance", func(t *testing.T) {
+		db := newDb()
+		userStorage := NewUserStorage(db, WithPasswordEncrypter(NoEncrypter{}),
+			WithInvitations("https://space-drivers.com/invitations/", time.Hour))
+
+		invitation, err := userStorage.Invite(adminCtx, Invitation{Email: "driver@hotmail.com", Role: RoleDriver})
+		assert.Nil(t, err)
+		assert.NotEmpty(t, invitation.Token)
+		assert.Equal(t, "https://space-drivers.com/invitations/"+invitation.Token, invitation.Link)
+		assert.WithinDuration(t, time.Now().Add(time.Hour), invitation.ExpiresAt, 2*time.Second)
+
+		created, err := userStorage.AcceptInvitation(context.Background(), invitation.Token, InvitationAcceptance{
+			Password: "a password",
+			Profile:  Profile{Name: "A driver"},
+		})
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), created.ID)
+		assert.Equal(t, "driver@hotmail.com", created.Email)
+		assert.Equal(t, RoleDriver, created.Role)
+		assert.Equal(t, "A driver", created.Name)
+		assert.Equal(t, "a password", db.users[2].Password)
+	})
+
+	t.Run("invitation tokens cannot authenticate", func(t *testing.T) {
+		invitation, err := NewUserStorage(newDb()).Invite(adminCtx, Invitation{Email: "driver@hotmail.com",
+			Role: RoleDriver})
+		assert.Nil(t, err)
+
+		token, err := jwt.ValidateToken(context.Background(), invitation.Token)
+		assert.Nil(t, err)
+		_, err = jwt.GetClaims(token)
+		assert.Equal(t, jwt.ErrInvalidClaims, err)
+	})
+
+	t.Run("failure invitation: email of a user", func(t *testing.T) {
+		_, err := NewUserStorage(newDb()).Invite(adminCtx, Invitation{Email: "admin@hotmail.com", Role: RoleDriver})
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrEmailAlreadyExists.Error(), err.Error())
+	})
+
+	t.Run("failure invitation: invalid role", func(t *testing.T) {
+		_, err := NewUserStorage(newDb()).Invite(adminCtx, Invitation{Email: "driver@hotmail.com", Role: "pilot"})
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrInvalidRole.Error(), err.Error())
+	})
+
+	t.Run("failure invitation: invalid email", func(t *testing.T) {
+		_, err := NewUserStorage(newDb()).Invite(adminCtx, Invitation{Email: "driver", Role: RoleDriver})
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrInvalidEmail.Error(), err.Error())
+	})
+
+	t.Run("failure invitation: without user logged in", func(t *testing.T) {
+		_, err := NewUserStorage(newDb()).Invite(context.Background(), Invitation{Email: "driver@hotmail.com",
+			Role: RoleDriver})
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrInvalidUserClaims.Error(), err.Error())
+	})
+
+	t.Run("failure acceptance: a login token", func(t *testing.T) {
+		token, err := jwt.GenerateToken(1, "admin@hotmail.com", RoleAdmin, RolePermissions(RoleAdmin))
+		assert.Nil(t, err)
+
+		_, err = NewUserStorage(newDb()).AcceptInvitation(context.Background(), token,
+			InvitationAcceptance{Password: "a password"})
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrInvalidInvitation.Error(), err.Error())
+	})
+
+	t.Run("failure acceptance: already accepted", func(t *testing.T) {
+		userStorage := NewUserStorage(newDb().onCreate("driver@hotmail.com", ErrUserDuplicated))
+		invitation, err := userStorage.Invite(adminCtx, Invitation{Email: "driver@hotmail.com", Role: RoleDriver})
+		assert.Nil(t, err)
+
+		_, err = userStorage.AcceptInvitation(context.Background(), invitation.Token,
+			InvitationAcceptance{Password: "a password"})
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrEmailAlreadyExists.Error(), err.Error())
+	})
+
+	t.Run("failure acceptance: replayed invitation", func(t *testing.T) {
+		db := newDb()
+		recorder := &eventRecorder{}
+		userStorage := NewUserStorage(db, WithPasswordEncrypter(NoEncrypter{}), WithSecurityAuditor(recorder))
+		invitation, err := userStorage.Invite(adminCtx, Invitation{Email: "driver@hotmail.com", Role: RoleDriver})
+		assert.Nil(t, err)
+
+		_, err = userStorage.AcceptInvitation(context.Background(), invitation.Token,
+			InvitationAcceptance{Password: "a password"})
+		assert.Nil(t, err)
+
+		// the email is free again, but the invitation was already consumed
+		delete(db.users, 2)
+		_, err = userStorage.AcceptInvitation(context.Background(), invitation.Token,
+			InvitationAcceptance{Password: "another password"})
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrInvalidInvitation.Error(), err.Error())
+		assert.Equal(t, audit.EventTokenReplay, recorder.events[len(recorder.events)-1].Type)
+		assert.Equal(t, "driver@hotmail.com", recorder.events[len(recorder.events)-1].Email)
+	})
+
+	t.Run("successful acceptance after a failed one", func(t *testing.T) {
+		db := newDb().onCreate("driver@hotmail.com", errors.New("mock error"))
+		userStorage := NewUserStorage(db, WithPasswordEncrypter(NoEncrypter{}))
+		invitation, err := userStorage.Invite(adminCtx, Invitation{Email: "driver@hotmail.com", Role: RoleDriver})
+		assert.Nil(t, err)
+
+		_, err = userStorage.AcceptInvitation(context.Background(), invitation.Token,
+			InvitationAcceptance{Password: "a password"})
+		assert.NotNil(t, err)
+
+		delete(db.saveError, "driver@hotmail.com")
+		created, err := userStorage.AcceptInvitation(context.Background(), invitation.Token,
+			InvitationAcceptance{Password: "a password"})
+		assert.Nil(t, err)
+		assert.Equal(t, "driver@hotmail.com", created.Email)
+	})
+}
+
+func Test_erasePersonalData(t *testing.T) {
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: RoleAdmin, Active: true}}
+		db.users[2] = User{
+			SecuredUser: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver, Active: true,
+				Profile: Profile{Name: "A driver", Phone: "1234", LicenseNumber: "A1"}},
+			Password:   "a password",
+			TOTPSecret: "JBSWY3DPEHPK3PXP",
+		}
+		db.users[3] = User{SecuredUser: SecuredUser{ID: 3, Email: "busy@hotmail.com", Role: RoleDriver, Active: true}}
+		db.activeTravels[3] = true
+		return db
+	}
+	adminCtx := context.WithValue(context.Background(), "user_on_call", jwt.Claims{UserID: 1, Role: RoleAdmin})
+
+	t.Run("successful erased user", func(t *testing.T) {
+		db := newDb()
+		err := NewUserStorage(db).ErasePersonalData(adminCtx, 2)
+		assert.Nil(t, err)
+
+		erased := db.users[2]
+		assert.Equal(t, "erased-2@space-drivers.invalid", erased.Email)
+		assert.Equal(t, RoleDriver, erased.Role)
+		assert.Equal(t, Profile{}, erased.Profile)
+		assert.Empty(t, erased.Password)
+		assert.Empty(t, erased.TOTPSecret)
+		assert.False(t, erased.Active)
+		assert.Equal(t, ErasedStatusReason, erased.StatusReason)
+	})
+
+	t.Run("failure erased user: not found", func(t *testing.T) {
+		err := NewUserStorage(newDb()).ErasePersonalData(adminCtx, 4)
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrNotFoundUser.Error(), err.Error())
+	})
+
+	t.Run("failure erased user: active travels", func(t *testing.T) {
+		err := NewUserStorage(newDb()).ErasePersonalData(adminCtx, 3)
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrUserHasActiveTravels.Error(), err.Error())
+	})
+
+	t.Run("failure erased user: without user logged in", func(t *testing.T) {
+		err := NewUserStorage(newDb()).ErasePersonalData(context.Background(), 2)
+		assert.NotNil(t, err)
+		assert.Equal(t, ErrInvalidUserClaims.Error(), err.Error())
+	})
+}
+
+func Test_preferences(t *testing.T) {
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.preferences[1] = Preferences{"locale": "es-AR", "notifications.email": "true"}
+		return db
+	}
+
+	tests := map[string]struct {
+		db       *mockDb
+		changes  Preferences
+		want     Preferences
+		expected error
+	}{
+		"successful set and removed preferences": {
+			db:      newDb(),
+			changes: Preferences{"units": "metric", "notifications.email": ""},
+			want:    Preferences{"locale": "es-AR", "units": "metric"},
+		},
+
+		"failure due to invalid key": {
+			db:       newDb(),
+			changes:  Preferences{"a locale": "es-AR"},
+			expected: ErrInvalidPreferenceKey,
+		},
+
+		"failure due to invalid value": {
+			db:       newDb(),
+			changes:  Preferences{"locale": strings.Repeat("a", 256)},
+			expected: ErrInvalidPreferenceValue,
+		},
+
+		"failure due to too many preferences": {
+			db: newDb(),
+			changes: func() Preferences {
+				changes := make(Preferences)
+				for i := 0; i < MaxPreferences; i++ {
+					changes[fmt.Sprintf("key_%d", i)] = "a value"
+				}
+				return changes
+			}(),
+			expected: ErrTooManyPreferences,
+		},
+
+		"failure due to storage error": {
+			db: func() *mockDb {
+				db := newDb()
+				db.preferencesError = errors.New("mocked storage error")
+				return db
+			}(),
+			changes:  Preferences{"units": "metric"},
+			expected: ErrStoragePreferences,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			userStorage := NewUserStorage(tc.db)
+			result, err := userStorage.UpdatePreferences(context.Background(), 1, tc.changes)
+
+			if tc.expected != nil {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, result)
+
+			got, err := userStorage.GetPreferences(context.Background(), 1)
+			assert.Nil(t, err)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func Test_seedAdmin(t *testing.T) {
+	tests := map[string]struct {
+		db          *mockDb
+		password    string
+		wantCreated bool
+		expected    error
+	}{
+		"successful seeded admin on empty users": {
+			db:          newMockDB(),
+			password:    "a password",
+			wantCreated: true,
+		},
+
+		"not seeded admin with users": {
+			db: func() *mockDb {
+				db := newMockDB()
+				db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "driver@hotmail.com", Role: RoleDriver}}
+				return db
+			}(),
+			password: "a password",
+		},
+
+		"not seeded admin created by another instance": {
+			db:       newMockDB().onCreate("admin@hotmail.com", ErrUserDuplicated),
+			password: "a password",
+		},
+
+		"failure due to empty password": {
+			db:       newMockDB(),
+			expected: ErrInvalidSeedPassword,
+		},
+
+		"failure due to storage error": {
+			db:       newMockDB().onCreate("admin@hotmail.com", errors.New("mocked storage error")),
+			password: "a password",
+			expected: ErrStorageSave,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			userStorage := NewUserStorage(tc.db, WithPasswordEncrypter(NoEncrypter{}))
+			created, err := userStorage.SeedAdmin(context.Background(), "admin@hotmail.com", tc.password)
+
+			if tc.expected != nil {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+				return
+			}
+
+			assert.Nil(t, err)
+			assert.Equal(t, tc.wantCreated, created)
+			if tc.wantCreated {
+				admin, err := tc.db.GetUserByEmail(context.Background(), "admin@hotmail.com")
+				assert.Nil(t, err)
+				assert.Equal(t, RoleAdmin, admin.Role)
+				assert.Equal(t, "a password", admin.Password)
+			}
+		})
+	}
+}
+
+func Test_impersonation(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[1] = User{SecuredUser: SecuredUser{ID: 1, Email: "admin@hotmail.com", Role: RoleAdmin, Active: true}}
+		db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver, Active: true}}
+		db.users[3] = User{SecuredUser: SecuredUser{ID: 3, Email: "suspended@hotmail.com", Role: RoleDriver}}
+		return db.onGet(9, ErrUserNotFound)
+	}
+	adminCtx := context.WithValue(context.Background(), "user_on_call",
+		jwt.Claims{UserID: 1, Email: "admin@hotmail.com", Role: RoleAdmin})
+
+	t.Run("successful impersonation", func(t *testing.T) {
+		recorder := &eventRecorder{}
+		userStorage := NewUserStorage(newDb(), WithImpersonationTTL(5*time.Minute), WithSecurityAuditor(recorder))
+
+		impersonation, err := userStorage.Impersonate(adminCtx, 2)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), impersonation.UserID)
+		assert.WithinDuration(t, time.Now().Add(5*time.Minute), impersonation.ExpiresAt, 2*time.Second)
+
+		token, err := jwt.ValidateToken(context.Background(), impersonation.Token)
+		assert.Nil(t, err)
+		claims, err := jwt.GetClaims(token)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), claims.UserID)
+		assert.Equal(t, "driver@hotmail.com", claims.Email)
+		assert.Equal(t, int64(1), claims.ImpersonatorID)
+
+		assert.Len(t, recorder.events, 1)
+		assert.Equal(t, audit.EventImpersonation, recorder.events[0].Type)
+		assert.Equal(t, int64(1), recorder.events[0].UserID)
+		assert.Equal(t, "as user 2 (driver@hotmail.com)", recorder.events[0].Detail)
+	})
+
+	tests := map[string]struct {
+		ctx      context.Context
+		id       int64
+		expected error
+	}{
+		"failure impersonation: not a driver":        {ctx: adminCtx, id: 1, expected: ErrInvalidImpersonation},
+		"failure impersonation: suspended driver":    {ctx: adminCtx, id: 3, expected: ErrInvalidImpersonation},
+		"failure impersonation: not founded user":    {ctx: adminCtx, id: 9, expected: ErrNotFoundUser},
+		"failure impersonation: without user logged": {ctx: context.Background(), id: 2, expected: ErrInvalidUserClaims},
+		"failure impersonation: while impersonating": {
+			ctx: context.WithValue(context.Background(), "user_on_call",
+				jwt.Claims{UserID: 2, Role: RoleDriver, ImpersonatorID: 1}),
+			id:       2,
+			expected: ErrInvalidImpersonation,
+		},
+	}
+
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewUserStorage(newDb()).Impersonate(tt.ctx, tt.id)
+			assert.NotNil(t, err)
+			assert.Equal(t, tt.expected.Error(), err.Error())
+		})
+	}
+}
+
+func Test_renewToken(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	newDb := func() *mockDb {
+		db := newMockDB()
+		db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver, Active: true}}
+		db.users[3] = User{SecuredUser: SecuredUser{ID: 3, Email: "suspended@hotmail.com", Role: RoleDriver}}
+		// the users 2, 3 and 9 have the sessions 1, 2 and 3, and the session 4 of the user 2 was revoked
+		for _, userID := range []int64{2, 3, 9, 2} {
+			_, _ = db.SaveSession(context.Background(), UserSession{UserID: userID,
+				ExpiresAt: time.Now().Add(time.Hour)})
+		}
+		_ = db.RevokeSession(context.Background(), 2, 4)
+		return db.onGet(9, ErrUserNotFound)
+	}
+	expiresIn := func(d time.Duration) int64 {
+		return time.Now().Add(d).Unix()
+	}
+	driverPermissions := RolePermissions(RoleDriver)
+
+	t.Run("successful renewal keeping the scope", func(t *testing.T) {
+		recorder := &eventRecorder{}
+		userStorage := NewUserStorage(newDb(), WithRenewalWindow(5*time.Minute), WithSecurityAuditor(recorder))
+
+		renewed, err := userStorage.RenewToken(context.Background(), jwt.Claims{UserID: 2, Role: RoleDriver,
+			Permissions: driverPermissions, Scope: ScopeDriverApp, SessionID: 1, Expiration: expiresIn(time.Minute)})
+		assert.Nil(t, err)
+		assert.NotEmpty(t, renewed)
+
+		token, err := jwt.ValidateToken(context.Background(), renewed)
+		assert.Nil(t, err)
+		claims, err := jwt.GetClaims(token)
+		assert.Nil(t, err)
+		assert.Equal(t, int64(2), claims.UserID)
+		assert.Equal(t, ScopeDriverApp, claims.Scope)
+		assert.Equal(t, int64(1), claims.SessionID)
+		assert.ElementsMatch(t, RolePermissions(RoleDriver), claims.Permissions)
+		assert.Greater(t, claims.Expiration, expiresIn(5*time.Minute))
+
+		assert.Len(t, recorder.events, 1)
+		assert.Equal(t, audit.EventTokenRefresh, recorder.events[0].Type)
+		assert.Equal(t, "token renewed", recorder.events[0].Detail)
+	})
+
+	notRenewed := map[string]struct {
+		storage UserStorage
+		claims  jwt.Claims
+	}{
+		"token which does not expire within the window": {
+			storage: NewUserStorage(newDb(), WithRenewalWindow(5*time.Minute)),
+			claims: jwt.Claims{UserID: 2, Role: RoleDriver, Permissions: driverPermissions, SessionID: 1,
+				Expiration: expiresIn(10 * time.Minute)},
+		},
+		"impersonation token": {
+			storage: NewUserStorage(newDb(), WithRenewalWindow(5*time.Minute)),
+			claims: jwt.Claims{UserID: 2, Role: RoleDriver, Permissions: driverPermissions, ImpersonatorID: 1,
+				Expiration: expiresIn(time.Minute)},
+		},
+		"token without session": {
+			storage: NewUserStorage(newDb(), WithRenewalWindow(5*time.Minute)),
+			claims:  jwt.Claims{UserID: 2, Role: RoleDriver, Permissions: driverPermissions, Expiration: expiresIn(time.Minute)},
+		},
+		"two factor challenge token": {
+			storage: NewUserStorage(newDb(), WithRenewalWindow(5*time.Minute)),
+			claims: jwt.Claims{UserID: 2, Role: RoleDriver, Permissions: []string{PermissionTwoFactorChallenge},
+				SessionID: 1, Expiration: expiresIn(time.Minute)},
+		},
+		"two factor enrollment token": {
+			storage: NewUserStorage(newDb(), WithRenewalWindow(5*time.Minute)),
+			claims: jwt.Claims{UserID: 2, Role: RoleDriver, Permissions: []string{PermissionTwoFactorEnroll},
+				SessionID: 1, Expiration: expiresIn(time.Minute)},
+		},
+		"renewal disabled": {
+			storage: NewUserStorage(newDb(), WithRenewalWindow(0)),
+			claims: jwt.Claims{UserID: 2, Role: RoleDriver, Permissions: driverPermissions, SessionID: 1,
+				Expiration: expiresIn(time.Minute)},
+		},
+	}
+
+	for name, tt := range notRenewed {
+		t.Run(name, func(t *testing.T) {
+			renewed, err := tt.storage.RenewToken(context.Background(), tt.claims)
+			assert.Nil(t, err)
+			assert.Empty(t, renewed)
+		})
+	}
+
+	failures := map[string]struct {
+		id        int64
+		sessionID int64
+		expected  error
+	}{
+		"failure renewal: suspended user":       {id: 3, sessionID: 2, expected: ErrSuspendedUser},
+		"failure renewal: not founded user":     {id: 9, sessionID: 3, expected: ErrNotFoundUser},
+		"failure renewal: revoked session":      {id: 2, sessionID: 4, expected: ErrNotFoundSession},
+		"failure renewal: another user session": {id: 2, sessionID: 2, expected: ErrNotFoundSession},
+	}
+
+	for name, tt := range failures {
+		t.Run(name, func(t *testing.T) {
+			renewed, err := NewUserStorage(newDb()).RenewToken(context.Background(),
+				jwt.Claims{UserID: tt.id, Role: RoleDriver, Permissions: driverPermissions, SessionID: tt.sessionID,
+					Expiration: expiresIn(time.Minute)})
+			assert.NotNil(t, err)
+			assert.Equal(t, tt.expected.Error(), err.Error())
+			assert.Empty(t, renewed)
+		})
+	}
+}
+
+func Test_renewTokenClock(t *testing.T) {
+	// config secret
+	_ = os.Setenv("JWT_SECRET", "jdnfksdmfksd")
+
+	// the tokens and the sessions are dated with a clock far from the system one
+	now := clock.NewFake(time.Date(2022, 3, 1, 10, 0, 0, 0, time.UTC))
+	previous := jwt.Clock
+	jwt.Clock = now
+	defer func() { jwt.Clock = previous }()
+
+	db := newMockDB()
+	db.users[2] = User{SecuredUser: SecuredUser{ID: 2, Email: "driver@hotmail.com", Role: RoleDriver, Active: true}}
+	_, _ = db.SaveSession(context.Background(), UserSession{UserID: 2, ExpiresAt: time.Now().Add(time.Hour)})
+	userStorage := NewUserStorage(db, WithRenewalWindow(5*time.Minute), WithClock(now))
+
+	generated, err := jwt.GenerateSessionToken(2, "driver@hotmail.com", RoleDriver, "", RolePermissions(RoleDriver), 1)
+	assert.Nil(t, err)
+	token, err := jwt.ValidateToken(context.Background(), generated)
+	assert.Nil(t, err)
+	claims, err := jwt.GetClaims(token)
+	assert.Nil(t, err)
+
+	// the token expires in 20 minutes, it is not renewed until it is within the window
+	renewed, err := userStorage.RenewToken(context.Background(), claims)
+	assert.Nil(t, err)
+	assert.Empty(t, renewed)
+
+	now.Advance(14 * time.Minute)
+	renewed, err = userStorage.RenewToken(context.Background(), claims)
+	assert.Nil(t, err)
+	assert.Empty(t, renewed)
+
+	now.Advance(2 * time.Minute)
+	renewed, err = userStorage.RenewToken(context.Background(), claims)
+	assert.Nil(t, err)
+	assert.NotEmpty(t, renewed)
+
+	token, err = jwt.ValidateToken(context.Background(), renewed)
+	assert.Nil(t, err)
+	claims, err = jwt.GetClaims(token)
+	assert.Nil(t, err)
+	assert.Equal(t, now.Now().Add(20*time.Minute).Unix(), claims.Expiration)
+
+	// the refresh tokens expire with the same clock
+	refreshToken, _, err := userStorage.newRefreshToken()
+	assert.Nil(t, err)
+	assert.Equal(t, now.Now(), refreshToken.CreatedAt)
+	assert.Equal(t, now.Now().Add(DefaultRefreshTokenTTL), refreshToken.ExpiresAt)
+}
@@ -0,0 +1,52 @@
+package user
+
+import (
+	"context"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/vehicle"
+)
+
+// VehicleFinder return the vehicles assigned to the drivers by user id
+type VehicleFinder interface {
+	ByDrivers(ctx context.Context, userIDs ...int64) (map[int64]vehicle.Vehicle, error)
+}
+
+// WithVehicleFinder fill the assigned vehicle of the drivers got by id and searched
+func WithVehicleFinder(finder VehicleFinder) UserStorageOption {
+	return func(ust *UserStorage) {
+		ust.vehicles = finder
+	}
+}
+
+// withVehicles fill the vehicle of the received drivers, users who are not drivers or drivers without vehicle are
+// kept as received
+func (userStorage UserStorage) withVehicles(ctx context.Context, users []SecuredUser) error {
+	if userStorage.vehicles == nil {
+		return nil
+	}
+
+	var driverIDs []int64
+	for _, u := range users {
+		if u.Role == RoleDriver {
+			driverIDs = append(driverIDs, u.ID)
+		}
+	}
+
+	if len(driverIDs) == 0 {
+		return nil
+	}
+
+	vehicles, err := userStorage.vehicles.ByDrivers(ctx, driverIDs...)
+	if err != nil {
+		log.Error(ctx, "there was an error getting drivers vehicles", log.Err(err))
+		return ErrStorageGet
+	}
+
+	for i := range users {
+		if v, ok := vehicles[users[i].ID]; ok {
+			users[i].Vehicle = &v
+		}
+	}
+
+	return nil
+}
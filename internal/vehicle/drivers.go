@@ -0,0 +1,79 @@
+package vehicle
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+)
+
+var (
+	ErrInvalidVehicleDriver  = code_error.Error{Code: "invalid_user", Detail: "the user to assign to the vehicle should be a driver"}
+	ErrNotFoundVehicleDriver = code_error.Error{Code: "not_found_vehicle_driver", Detail: "the vehicle has no driver assigned"}
+)
+
+// AssignDriver assign the vehicle with the received id to the driver with the received user id and return it. A
+// driver drives a single vehicle, so its previous vehicle (if any) is left without driver
+func (vehicleStorage VehicleStorage) AssignDriver(ctx context.Context, id int64, userID int64) (Vehicle, error) {
+	current, err := vehicleStorage.Get(ctx, id)
+	if err != nil {
+		return Vehicle{}, err
+	}
+
+	if err := vehicleStorage.repository.AssignVehicleDriver(ctx, id, userID); err != nil {
+		if errors.Is(err, ErrDriverNotFound) {
+			log.Info(ctx, "invalid check on assign vehicle driver: the user is not a driver",
+				log.Int64("vehicle_id", id),
+				log.Int64("user_id", userID))
+			return Vehicle{}, ErrInvalidVehicleDriver
+		}
+
+		log.Error(ctx, "there was an error assigning vehicle driver", log.Int64("vehicle_id", id),
+			log.Int64("user_id", userID), log.Err(err))
+		if errors.Is(err, ErrVehicleNotFound) {
+			return Vehicle{}, ErrNotFoundVehicle
+		}
+		return Vehicle{}, ErrStorageUpdate
+	}
+
+	current.UserID = &userID
+
+	return current, nil
+}
+
+// UnassignDriver leave the vehicle with the received id without driver
+func (vehicleStorage VehicleStorage) UnassignDriver(ctx context.Context, id int64) error {
+	if err := vehicleStorage.repository.UnassignVehicleDriver(ctx, id); err != nil {
+		if errors.Is(err, ErrVehicleDriverNotFound) {
+			return ErrNotFoundVehicleDriver
+		}
+
+		log.Error(ctx, "there was an error unassigning vehicle driver", log.Int64("vehicle_id", id), log.Err(err))
+		return ErrStorageUpdate
+	}
+
+	return nil
+}
+
+// ByDrivers return the vehicles assigned to the drivers with the received user ids by user id, drivers without
+// vehicle are not on the result
+func (vehicleStorage VehicleStorage) ByDrivers(ctx context.Context, userIDs ...int64) (map[int64]Vehicle, error) {
+	byDriver := make(map[int64]Vehicle, len(userIDs))
+	if len(userIDs) == 0 {
+		return byDriver, nil
+	}
+
+	vehicles, err := vehicleStorage.repository.GetDriversVehicles(ctx, userIDs)
+	if err != nil {
+		log.Error(ctx, "there was an error getting drivers vehicles", log.Err(err))
+		return nil, ErrStorageGet
+	}
+
+	for _, vehicle := range vehicles {
+		if vehicle.UserID != nil {
+			byDriver[*vehicle.UserID] = vehicle
+		}
+	}
+
+	return byDriver, nil
+}
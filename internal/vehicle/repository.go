@@ -0,0 +1,317 @@
+package vehicle
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"github.com/go-sql-driver/mysql"
+	"github.com/nicocarolo/space-drivers/internal/platform/config"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dbnameDefault = "space_drivers"
+
+	timeMetricName   = "application.space.repository.time"
+	entityMetricName = "vehicle"
+
+	// mysqlDuplicateEntry is the mysql error number of a unique key violation
+	mysqlDuplicateEntry = 1062
+)
+
+var (
+	ErrVehicleNotFound       = errors.New("not founded vehicle")
+	ErrDriverNotFound        = errors.New("not founded driver")
+	ErrVehicleDriverNotFound = errors.New("not founded vehicle driver")
+	ErrPlateDuplicated       = errors.New("there is already a vehicle with the plate")
+)
+
+type repository interface {
+	SaveVehicle(ctx context.Context, vehicle Vehicle) (Vehicle, error)
+	GetVehicle(ctx context.Context, id int64) (Vehicle, error)
+	GetVehicles(ctx context.Context) ([]Vehicle, error)
+	UpdateVehicle(ctx context.Context, vehicle Vehicle) error
+	DeleteVehicle(ctx context.Context, id int64) error
+
+	AssignVehicleDriver(ctx context.Context, id, userID int64) error
+	UnassignVehicleDriver(ctx context.Context, id int64) error
+	GetDriversVehicles(ctx context.Context, userIDs []int64) ([]Vehicle, error)
+}
+
+// SqlRepository sql client wrapper for vehicle model
+type SqlRepository struct {
+	db *sql.DB
+}
+
+// NewRepository creates and return an SqlRepository
+func NewRepository() (SqlRepository, error) {
+	dbname := os.Getenv("DB_NAME")
+	dbuser := os.Getenv("DB_USER")
+	dbpass := config.Secret("DB_PASSWORD", "")
+	dbimage := os.Getenv("DB_IMAGE_NAME")
+	scope := os.Getenv("SCOPE")
+
+	if dbname == "" {
+		dbname = dbnameDefault
+	}
+	if dbuser == "" || dbpass == "" || dbimage == "" {
+		return SqlRepository{}, fmt.Errorf("cannot initialize vehicle repository: the following settings " +
+			"(DB_USER, DB_PASSWORD, DB_IMAGE_NAME) are invalid")
+	}
+
+	dataSourceConnection := fmt.Sprintf("%s:%s@/%s?parseTime=true", dbuser, dbpass, dbname)
+	if scope != "" {
+		dataSourceConnection = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?parseTime=true", dbuser, dbpass, dbimage, dbname)
+	}
+	db, err := sql.Open("mysql", dataSourceConnection)
+	if err != nil {
+		return SqlRepository{}, err
+	}
+
+	return SqlRepository{
+		db: db,
+	}, nil
+}
+
+// Close the connections to the db, once the repository is not used anymore
+func (sqlDb SqlRepository) Close() error {
+	return sqlDb.db.Close()
+}
+
+// Stats return the stats of the connections to the db, as the open and in use ones
+func (sqlDb SqlRepository) Stats() sql.DBStats {
+	return sqlDb.db.Stats()
+}
+
+// vehicleColumns are the columns selected to read a vehicle with scanVehicle
+const vehicleColumns = "id, plate, capacity, class, user_id, created_at"
+
+// SaveVehicle will store a Vehicle on sql table, it return ErrPlateDuplicated if the plate belongs to another vehicle
+func (sqlDb SqlRepository) SaveVehicle(ctx context.Context, vehicle Vehicle) (Vehicle, error) {
+	trackTime := trackElapsed(ctx, entityMetricName, "insert")
+	result, err := sqlDb.db.ExecContext(ctx, "INSERT INTO vehicles(plate, capacity, class, created_at) "+
+		"VALUES(?, ?, ?, ?)", vehicle.Plate, vehicle.Capacity, vehicle.Class, vehicle.CreatedAt)
+	trackTime(err == nil)
+	if err != nil {
+		return Vehicle{}, duplicatedError(err)
+	}
+
+	vehicle.ID, err = result.LastInsertId()
+	if err != nil {
+		return Vehicle{}, err
+	}
+
+	return vehicle, nil
+}
+
+// GetVehicle will get the Vehicle who has the received id from table
+func (sqlDb SqlRepository) GetVehicle(ctx context.Context, id int64) (Vehicle, error) {
+	trackTime := trackElapsed(ctx, entityMetricName, "select")
+	row := sqlDb.db.QueryRowContext(ctx, "SELECT "+vehicleColumns+" FROM vehicles WHERE id = ?", id)
+
+	vehicle, err := scanVehicle(row)
+	trackTime(err == nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Vehicle{}, ErrVehicleNotFound
+		}
+		return Vehicle{}, err
+	}
+
+	return vehicle, nil
+}
+
+// GetVehicles will get all the vehicles from table ordered by id
+func (sqlDb SqlRepository) GetVehicles(ctx context.Context) ([]Vehicle, error) {
+	return sqlDb.selectVehicles(ctx, "select_all", "SELECT "+vehicleColumns+" FROM vehicles ORDER BY id")
+}
+
+// UpdateVehicle will store the plate, capacity and class of the received vehicle
+func (sqlDb SqlRepository) UpdateVehicle(ctx context.Context, vehicle Vehicle) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "update")
+	result, err := sqlDb.db.ExecContext(ctx, "UPDATE vehicles SET plate = ?, capacity = ?, class = ? WHERE id = ?",
+		vehicle.Plate, vehicle.Capacity, vehicle.Class, vehicle.ID)
+	trackTime(err == nil)
+	if err != nil {
+		return duplicatedError(err)
+	}
+
+	return checkAffected(result, ErrVehicleNotFound)
+}
+
+// DeleteVehicle will remove the vehicle with the received id from table
+func (sqlDb SqlRepository) DeleteVehicle(ctx context.Context, id int64) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "delete")
+	result, err := sqlDb.db.ExecContext(ctx, "DELETE FROM vehicles WHERE id = ?", id)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(result, ErrVehicleNotFound)
+}
+
+// AssignVehicleDriver will assign the vehicle to the driver with the received user id, leaving its previous vehicle
+// without driver. It return ErrDriverNotFound if the user does not exist or it is not a driver
+func (sqlDb SqlRepository) AssignVehicleDriver(ctx context.Context, id, userID int64) error {
+	tx, err := sqlDb.db.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+
+	defer tx.Rollback()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "select_for_update")
+	var vehicleID int64
+	err = tx.QueryRowContext(ctx, "SELECT id FROM vehicles WHERE id = ? FOR UPDATE", id).Scan(&vehicleID)
+	trackTime(err == nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrVehicleNotFound
+		}
+		return err
+	}
+
+	trackTime = trackElapsed(ctx, entityMetricName, "select_driver")
+	var drivers int64
+	err = tx.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE id = ? AND role = 'driver' "+
+		"AND deleted_at IS NULL", userID).Scan(&drivers)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	if drivers == 0 {
+		return ErrDriverNotFound
+	}
+
+	trackTime = trackElapsed(ctx, entityMetricName, "unassign_driver")
+	_, err = tx.ExecContext(ctx, "UPDATE vehicles SET user_id = NULL WHERE user_id = ? AND id <> ?", userID, id)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	trackTime = trackElapsed(ctx, entityMetricName, "assign_driver")
+	_, err = tx.ExecContext(ctx, "UPDATE vehicles SET user_id = ? WHERE id = ?", userID, id)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// UnassignVehicleDriver will leave the vehicle with the received id without driver, it return
+// ErrVehicleDriverNotFound if the vehicle does not exist or it has no driver
+func (sqlDb SqlRepository) UnassignVehicleDriver(ctx context.Context, id int64) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "unassign_driver")
+	result, err := sqlDb.db.ExecContext(ctx, "UPDATE vehicles SET user_id = NULL WHERE id = ? AND user_id IS NOT NULL",
+		id)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(result, ErrVehicleDriverNotFound)
+}
+
+// GetDriversVehicles will get the vehicles assigned to the drivers with the received user ids
+func (sqlDb SqlRepository) GetDriversVehicles(ctx context.Context, userIDs []int64) ([]Vehicle, error) {
+	placeholders := make([]string, 0, len(userIDs))
+	args := make([]interface{}, 0, len(userIDs))
+	for _, userID := range userIDs {
+		placeholders = append(placeholders, "?")
+		args = append(args, userID)
+	}
+
+	return sqlDb.selectVehicles(ctx, "select_by_drivers", "SELECT "+vehicleColumns+" FROM vehicles "+
+		"WHERE user_id IN ("+strings.Join(placeholders, ", ")+") ORDER BY id", args...)
+}
+
+// selectVehicles run a query selecting vehicleColumns
+func (sqlDb SqlRepository) selectVehicles(ctx context.Context, action, query string,
+	args ...interface{}) ([]Vehicle, error) {
+	trackTime := trackElapsed(ctx, entityMetricName, action)
+	rows, err := sqlDb.db.QueryContext(ctx, query, args...)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var vehicles []Vehicle
+	for rows.Next() {
+		vehicle, err := scanVehicle(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		vehicles = append(vehicles, vehicle)
+	}
+
+	return vehicles, rows.Err()
+}
+
+// duplicatedError return ErrPlateDuplicated if the received error is due to a unique key violation (the plate is
+// unique), otherwise the same error is returned
+func duplicatedError(err error) error {
+	var mysqlErr *mysql.MySQLError
+	if errors.As(err, &mysqlErr) && mysqlErr.Number == mysqlDuplicateEntry {
+		return ErrPlateDuplicated
+	}
+
+	return err
+}
+
+// checkAffected return the received not found error if the statement did not change any row
+func checkAffected(result sql.Result, notFound error) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return notFound
+	}
+
+	return nil
+}
+
+// rowScanner is the scan capability shared by sql.Row and sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanVehicle read a vehicle from a row with vehicleColumns
+func scanVehicle(row rowScanner) (Vehicle, error) {
+	var vehicle Vehicle
+	var userID sql.NullInt64
+	err := row.Scan(&vehicle.ID, &vehicle.Plate, &vehicle.Capacity, &vehicle.Class, &userID, &vehicle.CreatedAt)
+	if err != nil {
+		return Vehicle{}, err
+	}
+
+	if userID.Valid {
+		vehicle.UserID = &userID.Int64
+	}
+
+	return vehicle, nil
+}
+
+func trackElapsed(ctx context.Context, entity, action string) func(success bool) {
+	start := time.Now()
+	return func(success bool) {
+		metrics.Timing(ctx, timeMetricName, time.Since(start),
+			[]string{
+				"result", strconv.FormatBool(success),
+				"action", action,
+				"entity", entity})
+	}
+}
@@ -0,0 +1,172 @@
+package vehicle
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"strings"
+	"time"
+)
+
+const (
+	maxPlateLength = 15
+	maxCapacity    = 100
+)
+
+// Class of a vehicle, the kind of travels it can take
+type Class string
+
+const (
+	ClassEconomy Class = "economy"
+	ClassComfort Class = "comfort"
+	ClassCargo   Class = "cargo"
+)
+
+var (
+	ErrInvalidPlate       = code_error.Error{Code: "invalid_vehicle", Detail: "the vehicle plate should have between 1 and 15 characters"}
+	ErrInvalidCapacity    = code_error.Error{Code: "invalid_vehicle", Detail: "the vehicle capacity should be between 1 and 100"}
+	ErrInvalidClass       = code_error.Error{Code: "invalid_vehicle", Detail: "the vehicle class should be economy, comfort or cargo"}
+	ErrPlateAlreadyExists = code_error.Error{Code: "plate_already_exists", Detail: "there is already a vehicle with the received plate"}
+	ErrNotFoundVehicle    = code_error.Error{Code: "not_found_vehicle", Detail: "not founded the vehicle to get"}
+	ErrStorageSave        = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to save vehicle"}
+	ErrStorageGet         = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to get vehicle"}
+	ErrStorageUpdate      = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to update vehicle"}
+	ErrStorageDelete      = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to delete vehicle"}
+)
+
+// Vehicle is a vehicle of the fleet, it can be assigned to a single driver who drives it on its travels
+type Vehicle struct {
+	ID       int64  `json:"id"`
+	Plate    string `json:"plate" binding:"required"`
+	Capacity int    `json:"capacity" binding:"required"`
+	Class    Class  `json:"class" binding:"required"`
+
+	// UserID is the driver the vehicle is assigned to (if any)
+	UserID *int64 `json:"user_id,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type VehicleStorage struct {
+	repository repository
+}
+
+// NewVehicleStorage will create and return a VehicleStorage with the received repository
+func NewVehicleStorage(repository repository) VehicleStorage {
+	return VehicleStorage{
+		repository: repository,
+	}
+}
+
+// Save will store a Vehicle (without driver) on repository and return it
+func (vehicleStorage VehicleStorage) Save(ctx context.Context, vehicle Vehicle) (Vehicle, error) {
+	vehicle, err := normalizeVehicle(ctx, vehicle)
+	if err != nil {
+		return Vehicle{}, err
+	}
+
+	vehicle.UserID = nil
+	vehicle.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	vehicle, err = vehicleStorage.repository.SaveVehicle(ctx, vehicle)
+	if err != nil {
+		log.Error(ctx, "there was an error saving vehicle", log.Err(err))
+		if errors.Is(err, ErrPlateDuplicated) {
+			return Vehicle{}, ErrPlateAlreadyExists
+		}
+		return Vehicle{}, ErrStorageSave
+	}
+
+	return vehicle, nil
+}
+
+// Get and return the Vehicle from repository with the received id
+func (vehicleStorage VehicleStorage) Get(ctx context.Context, id int64) (Vehicle, error) {
+	vehicle, err := vehicleStorage.repository.GetVehicle(ctx, id)
+	if err != nil {
+		log.Error(ctx, "there was an error getting vehicle", log.Int64("vehicle_id", id), log.Err(err))
+		if errors.Is(err, ErrVehicleNotFound) {
+			return Vehicle{}, ErrNotFoundVehicle
+		}
+		return Vehicle{}, ErrStorageGet
+	}
+
+	return vehicle, nil
+}
+
+// List return all the vehicles on repository ordered by id
+func (vehicleStorage VehicleStorage) List(ctx context.Context) ([]Vehicle, error) {
+	vehicles, err := vehicleStorage.repository.GetVehicles(ctx)
+	if err != nil {
+		log.Error(ctx, "there was an error getting vehicles", log.Err(err))
+		return nil, ErrStorageGet
+	}
+
+	return vehicles, nil
+}
+
+// Update will replace the plate, capacity and class of the vehicle with the received id, its driver is kept
+func (vehicleStorage VehicleStorage) Update(ctx context.Context, vehicle Vehicle) (Vehicle, error) {
+	vehicle, err := normalizeVehicle(ctx, vehicle)
+	if err != nil {
+		return Vehicle{}, err
+	}
+
+	current, err := vehicleStorage.Get(ctx, vehicle.ID)
+	if err != nil {
+		return Vehicle{}, err
+	}
+
+	current.Plate = vehicle.Plate
+	current.Capacity = vehicle.Capacity
+	current.Class = vehicle.Class
+
+	if err := vehicleStorage.repository.UpdateVehicle(ctx, current); err != nil {
+		log.Error(ctx, "there was an error updating vehicle", log.Int64("vehicle_id", vehicle.ID), log.Err(err))
+		if errors.Is(err, ErrVehicleNotFound) {
+			return Vehicle{}, ErrNotFoundVehicle
+		}
+		if errors.Is(err, ErrPlateDuplicated) {
+			return Vehicle{}, ErrPlateAlreadyExists
+		}
+		return Vehicle{}, ErrStorageUpdate
+	}
+
+	return current, nil
+}
+
+// Delete will remove the vehicle with the received id from repository
+func (vehicleStorage VehicleStorage) Delete(ctx context.Context, id int64) error {
+	if err := vehicleStorage.repository.DeleteVehicle(ctx, id); err != nil {
+		log.Error(ctx, "there was an error deleting vehicle", log.Int64("vehicle_id", id), log.Err(err))
+		if errors.Is(err, ErrVehicleNotFound) {
+			return ErrNotFoundVehicle
+		}
+		return ErrStorageDelete
+	}
+
+	return nil
+}
+
+// normalizeVehicle validate the vehicle plate, capacity and class, the plate is trimmed and uppercase
+func normalizeVehicle(ctx context.Context, vehicle Vehicle) (Vehicle, error) {
+	vehicle.Plate = strings.ToUpper(strings.TrimSpace(vehicle.Plate))
+	if vehicle.Plate == "" || len(vehicle.Plate) > maxPlateLength {
+		log.Info(ctx, "invalid check on vehicle: invalid plate", log.String("vehicle_plate", vehicle.Plate))
+		return Vehicle{}, ErrInvalidPlate
+	}
+
+	if vehicle.Capacity < 1 || vehicle.Capacity > maxCapacity {
+		log.Info(ctx, "invalid check on vehicle: invalid capacity", log.Int64("vehicle_capacity", int64(vehicle.Capacity)))
+		return Vehicle{}, ErrInvalidCapacity
+	}
+
+	vehicle.Class = Class(strings.ToLower(strings.TrimSpace(string(vehicle.Class))))
+	if vehicle.Class != ClassEconomy && vehicle.Class != ClassComfort && vehicle.Class != ClassCargo {
+		log.Info(ctx, "invalid check on vehicle: invalid class", log.String("vehicle_class", string(vehicle.Class)))
+		return Vehicle{}, ErrInvalidClass
+	}
+
+	return vehicle, nil
+}
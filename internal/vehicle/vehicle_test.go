@@ -0,0 +1,316 @@
+package vehicle
+
+import (
+	"context"
+	"errors"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+// mockDb a 'db' to use on VehicleStorage test with the capabilities to mock errors on save action
+type mockDb struct {
+	idCount  int64
+	vehicles map[int64]Vehicle
+
+	saveError error
+}
+
+func newMockDB(vehicles ...Vehicle) *mockDb {
+	db := &mockDb{
+		idCount:  1,
+		vehicles: make(map[int64]Vehicle),
+	}
+
+	for _, v := range vehicles {
+		db.vehicles[v.ID] = v
+		db.idCount++
+	}
+
+	return db
+}
+
+func (db *mockDb) onCreate(err error) *mockDb {
+	db.saveError = err
+	return db
+}
+
+func (db *mockDb) SaveVehicle(ctx context.Context, vehicle Vehicle) (Vehicle, error) {
+	if db.saveError != nil {
+		return Vehicle{}, db.saveError
+	}
+
+	for _, v := range db.vehicles {
+		if v.Plate == vehicle.Plate {
+			return Vehicle{}, ErrPlateDuplicated
+		}
+	}
+
+	vehicle.ID = db.idCount
+	db.vehicles[vehicle.ID] = vehicle
+
+	db.idCount++
+
+	return vehicle, nil
+}
+
+func (db mockDb) GetVehicle(ctx context.Context, id int64) (Vehicle, error) {
+	vehicle, exist := db.vehicles[id]
+	if !exist {
+		return Vehicle{}, ErrVehicleNotFound
+	}
+
+	return vehicle, nil
+}
+
+func (db mockDb) GetVehicles(ctx context.Context) ([]Vehicle, error) {
+	var vehicles []Vehicle
+	for _, vehicle := range db.vehicles {
+		vehicles = append(vehicles, vehicle)
+	}
+
+	sort.Slice(vehicles, func(i, j int) bool { return vehicles[i].ID < vehicles[j].ID })
+
+	return vehicles, nil
+}
+
+func (db *mockDb) UpdateVehicle(ctx context.Context, vehicle Vehicle) error {
+	if _, exist := db.vehicles[vehicle.ID]; !exist {
+		return ErrVehicleNotFound
+	}
+
+	for _, v := range db.vehicles {
+		if v.Plate == vehicle.Plate && v.ID != vehicle.ID {
+			return ErrPlateDuplicated
+		}
+	}
+
+	db.vehicles[vehicle.ID] = vehicle
+
+	return nil
+}
+
+func (db *mockDb) DeleteVehicle(ctx context.Context, id int64) error {
+	if _, exist := db.vehicles[id]; !exist {
+		return ErrVehicleNotFound
+	}
+
+	delete(db.vehicles, id)
+
+	return nil
+}
+
+// AssignVehicleDriver users from 1 to 3 are the only drivers
+func (db *mockDb) AssignVehicleDriver(ctx context.Context, id, userID int64) error {
+	if _, exist := db.vehicles[id]; !exist {
+		return ErrVehicleNotFound
+	}
+
+	if userID < 1 || userID > 3 {
+		return ErrDriverNotFound
+	}
+
+	for vehicleID, v := range db.vehicles {
+		if v.UserID != nil && *v.UserID == userID {
+			v.UserID = nil
+			db.vehicles[vehicleID] = v
+		}
+	}
+
+	vehicle := db.vehicles[id]
+	vehicle.UserID = &userID
+	db.vehicles[id] = vehicle
+
+	return nil
+}
+
+func (db *mockDb) UnassignVehicleDriver(ctx context.Context, id int64) error {
+	vehicle, exist := db.vehicles[id]
+	if !exist || vehicle.UserID == nil {
+		return ErrVehicleDriverNotFound
+	}
+
+	vehicle.UserID = nil
+	db.vehicles[id] = vehicle
+
+	return nil
+}
+
+func (db mockDb) GetDriversVehicles(ctx context.Context, userIDs []int64) ([]Vehicle, error) {
+	vehicles, _ := db.GetVehicles(ctx)
+
+	var assigned []Vehicle
+	for _, vehicle := range vehicles {
+		for _, userID := range userIDs {
+			if vehicle.UserID != nil && *vehicle.UserID == userID {
+				assigned = append(assigned, vehicle)
+			}
+		}
+	}
+
+	return assigned, nil
+}
+
+func Test_saveVehicle(t *testing.T) {
+	driverID := int64(1)
+
+	tests := map[string]struct {
+		db       *mockDb
+		vehicle  Vehicle
+		want     Vehicle
+		expected error
+	}{
+		"successful vehicle save": {
+			db:      newMockDB(),
+			vehicle: Vehicle{Plate: " ab 123 cd ", Capacity: 4, Class: "Economy"},
+			want:    Vehicle{ID: 1, Plate: "AB 123 CD", Capacity: 4, Class: ClassEconomy},
+		},
+
+		"successful vehicle save without the received driver": {
+			db:      newMockDB(),
+			vehicle: Vehicle{Plate: "AB123CD", Capacity: 2, Class: ClassCargo, UserID: &driverID},
+			want:    Vehicle{ID: 1, Plate: "AB123CD", Capacity: 2, Class: ClassCargo},
+		},
+
+		"failure vehicle save: invalid plate": {
+			db:       newMockDB(),
+			vehicle:  Vehicle{Plate: "  ", Capacity: 4, Class: ClassEconomy},
+			expected: ErrInvalidPlate,
+		},
+
+		"failure vehicle save: invalid capacity": {
+			db:       newMockDB(),
+			vehicle:  Vehicle{Plate: "AB123CD", Capacity: 0, Class: ClassEconomy},
+			expected: ErrInvalidCapacity,
+		},
+
+		"failure vehicle save: invalid class": {
+			db:       newMockDB(),
+			vehicle:  Vehicle{Plate: "AB123CD", Capacity: 4, Class: "spaceship"},
+			expected: ErrInvalidClass,
+		},
+
+		"failure vehicle save: duplicated plate": {
+			db:       newMockDB(Vehicle{ID: 1, Plate: "AB123CD", Capacity: 4, Class: ClassEconomy}),
+			vehicle:  Vehicle{Plate: "ab123cd", Capacity: 4, Class: ClassEconomy},
+			expected: ErrPlateAlreadyExists,
+		},
+
+		"db failure vehicle save": {
+			db:       newMockDB().onCreate(errors.New("mocked save error")),
+			vehicle:  Vehicle{Plate: "AB123CD", Capacity: 4, Class: ClassEconomy},
+			expected: ErrStorageSave,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := NewVehicleStorage(tc.db).Save(context.Background(), tc.vehicle)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.False(t, result.CreatedAt.IsZero())
+
+				result.CreatedAt = tc.want.CreatedAt
+				assert.Equal(t, tc.want, result)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_updateVehicle(t *testing.T) {
+	driverID := int64(1)
+	newDb := func() *mockDb {
+		return newMockDB(
+			Vehicle{ID: 1, Plate: "AB123CD", Capacity: 4, Class: ClassEconomy, UserID: &driverID},
+			Vehicle{ID: 2, Plate: "EF456GH", Capacity: 2, Class: ClassCargo},
+		)
+	}
+
+	tests := map[string]struct {
+		vehicle  Vehicle
+		want     Vehicle
+		expected error
+	}{
+		"successful vehicle update keeping its driver": {
+			vehicle: Vehicle{ID: 1, Plate: "AB123CE", Capacity: 5, Class: ClassComfort},
+			want:    Vehicle{ID: 1, Plate: "AB123CE", Capacity: 5, Class: ClassComfort, UserID: &driverID},
+		},
+
+		"failure vehicle update: not found": {
+			vehicle:  Vehicle{ID: 3, Plate: "AB123CE", Capacity: 5, Class: ClassComfort},
+			expected: ErrNotFoundVehicle,
+		},
+
+		"failure vehicle update: plate of another vehicle": {
+			vehicle:  Vehicle{ID: 1, Plate: "EF456GH", Capacity: 4, Class: ClassEconomy},
+			expected: ErrPlateAlreadyExists,
+		},
+
+		"failure vehicle update: invalid capacity": {
+			vehicle:  Vehicle{ID: 1, Plate: "AB123CD", Capacity: 101, Class: ClassEconomy},
+			expected: ErrInvalidCapacity,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := NewVehicleStorage(newDb()).Update(context.Background(), tc.vehicle)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_vehicleDrivers(t *testing.T) {
+	db := newMockDB(
+		Vehicle{ID: 1, Plate: "AB123CD", Capacity: 4, Class: ClassEconomy},
+		Vehicle{ID: 2, Plate: "EF456GH", Capacity: 2, Class: ClassCargo},
+	)
+	vehicleStorage := NewVehicleStorage(db)
+	ctx := context.Background()
+
+	// only drivers can be assigned
+	_, err := vehicleStorage.AssignDriver(ctx, 1, 4)
+	assert.Equal(t, ErrInvalidVehicleDriver, err)
+
+	_, err = vehicleStorage.AssignDriver(ctx, 3, 1)
+	assert.Equal(t, ErrNotFoundVehicle, err)
+
+	assigned, err := vehicleStorage.AssignDriver(ctx, 1, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), *assigned.UserID)
+
+	byDriver, err := vehicleStorage.ByDrivers(ctx, 1, 2)
+	assert.Nil(t, err)
+	assert.Len(t, byDriver, 1)
+	assert.Equal(t, int64(1), byDriver[1].ID)
+
+	// the driver drives a single vehicle, the previous one is left without driver
+	_, err = vehicleStorage.AssignDriver(ctx, 2, 1)
+	assert.Nil(t, err)
+
+	byDriver, err = vehicleStorage.ByDrivers(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), byDriver[1].ID)
+
+	previous, err := vehicleStorage.Get(ctx, 1)
+	assert.Nil(t, err)
+	assert.Nil(t, previous.UserID)
+
+	assert.Equal(t, ErrNotFoundVehicleDriver, vehicleStorage.UnassignDriver(ctx, 1))
+	assert.Nil(t, vehicleStorage.UnassignDriver(ctx, 2))
+
+	byDriver, err = vehicleStorage.ByDrivers(ctx, 1)
+	assert.Nil(t, err)
+	assert.Empty(t, byDriver)
+}
@@ -0,0 +1,115 @@
+package zone
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/travel"
+)
+
+var (
+	ErrInvalidZoneDriver  = code_error.Error{Code: "invalid_user", Detail: "the user to register on the zone should be a driver"}
+	ErrNotFoundZoneDriver = code_error.Error{Code: "not_found_zone_driver", Detail: "the driver is not registered on the zone"}
+)
+
+// ZoneDrivers is the zone membership, the drivers who can be assigned to the travels starting inside the zone
+type ZoneDrivers struct {
+	ZoneID  int64   `json:"zone_id"`
+	UserIDs []int64 `json:"user_ids"`
+}
+
+// AddDriver register the driver with the received user id on the zone, registering it twice has no effect
+func (zoneStorage ZoneStorage) AddDriver(ctx context.Context, id int64, userID int64) error {
+	if _, err := zoneStorage.Get(ctx, id); err != nil {
+		return err
+	}
+
+	if err := zoneStorage.repository.AddZoneDriver(ctx, id, userID); err != nil {
+		if errors.Is(err, ErrDriverNotFound) {
+			log.Info(ctx, "invalid check on add zone driver: the user is not a driver",
+				log.Int64("zone_id", id),
+				log.Int64("user_id", userID))
+			return ErrInvalidZoneDriver
+		}
+
+		log.Error(ctx, "there was an error adding zone driver", log.Int64("zone_id", id),
+			log.Int64("user_id", userID), log.Err(err))
+		return ErrStorageSave
+	}
+
+	return nil
+}
+
+// RemoveDriver unregister the driver with the received user id from the zone
+func (zoneStorage ZoneStorage) RemoveDriver(ctx context.Context, id int64, userID int64) error {
+	if err := zoneStorage.repository.RemoveZoneDriver(ctx, id, userID); err != nil {
+		if errors.Is(err, ErrZoneDriverNotFound) {
+			return ErrNotFoundZoneDriver
+		}
+
+		log.Error(ctx, "there was an error removing zone driver", log.Int64("zone_id", id),
+			log.Int64("user_id", userID), log.Err(err))
+		return ErrStorageDelete
+	}
+
+	return nil
+}
+
+// Drivers return the drivers registered on the zone with the received id
+func (zoneStorage ZoneStorage) Drivers(ctx context.Context, id int64) (ZoneDrivers, error) {
+	if _, err := zoneStorage.Get(ctx, id); err != nil {
+		return ZoneDrivers{}, err
+	}
+
+	userIDs, err := zoneStorage.repository.GetZoneDrivers(ctx, id)
+	if err != nil {
+		log.Error(ctx, "there was an error getting zone drivers", log.Int64("zone_id", id), log.Err(err))
+		return ZoneDrivers{}, ErrStorageGet
+	}
+
+	if userIDs == nil {
+		userIDs = []int64{}
+	}
+
+	return ZoneDrivers{ZoneID: id, UserIDs: userIDs}, nil
+}
+
+// Eligible return if the driver with the received user id can be assigned to a travel starting on the point, it
+// should be registered on one of the zones containing the point. Points outside every zone have no restriction
+func (zoneStorage ZoneStorage) Eligible(ctx context.Context, point travel.Point, userID int64) (bool, error) {
+	zones, err := zoneStorage.List(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	var containing []Zone
+	for _, zone := range zones {
+		if zone.Contains(point) {
+			containing = append(containing, zone)
+		}
+	}
+
+	if len(containing) == 0 {
+		return true, nil
+	}
+
+	driverZones, err := zoneStorage.repository.GetDriverZones(ctx, userID)
+	if err != nil {
+		log.Error(ctx, "there was an error getting driver zones", log.Int64("user_id", userID), log.Err(err))
+		return false, ErrStorageGet
+	}
+
+	registered := make(map[int64]bool, len(driverZones))
+	for _, zoneID := range driverZones {
+		registered[zoneID] = true
+	}
+
+	for _, zone := range containing {
+		if registered[zone.ID] {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
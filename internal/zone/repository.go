@@ -0,0 +1,349 @@
+package zone
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	_ "github.com/go-sql-driver/mysql"
+	"github.com/nicocarolo/space-drivers/internal/platform/config"
+	"github.com/nicocarolo/space-drivers/internal/platform/metrics"
+	"github.com/nicocarolo/space-drivers/internal/travel"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	dbnameDefault = "space_drivers"
+
+	timeMetricName   = "application.space.repository.time"
+	entityMetricName = "zone"
+)
+
+var (
+	ErrZoneNotFound       = errors.New("not founded zone")
+	ErrDriverNotFound     = errors.New("not founded driver")
+	ErrZoneDriverNotFound = errors.New("not founded zone driver")
+)
+
+type repository interface {
+	SaveZone(ctx context.Context, zone Zone) (Zone, error)
+	GetZone(ctx context.Context, id int64) (Zone, error)
+	GetZones(ctx context.Context) ([]Zone, error)
+	UpdateZone(ctx context.Context, zone Zone) error
+	DeleteZone(ctx context.Context, id int64) error
+
+	AddZoneDriver(ctx context.Context, zoneID, userID int64) error
+	RemoveZoneDriver(ctx context.Context, zoneID, userID int64) error
+	GetZoneDrivers(ctx context.Context, zoneID int64) ([]int64, error)
+	GetDriverZones(ctx context.Context, userID int64) ([]int64, error)
+}
+
+// SqlRepository sql client wrapper for zone model
+type SqlRepository struct {
+	db *sql.DB
+}
+
+// NewRepository creates and return an SqlRepository
+func NewRepository() (SqlRepository, error) {
+	dbname := os.Getenv("DB_NAME")
+	dbuser := os.Getenv("DB_USER")
+	dbpass := config.Secret("DB_PASSWORD", "")
+	dbimage := os.Getenv("DB_IMAGE_NAME")
+	scope := os.Getenv("SCOPE")
+
+	if dbname == "" {
+		dbname = dbnameDefault
+	}
+	if dbuser == "" || dbpass == "" || dbimage == "" {
+		return SqlRepository{}, fmt.Errorf("cannot initialize zone repository: the following settings " +
+			"(DB_USER, DB_PASSWORD, DB_IMAGE_NAME) are invalid")
+	}
+
+	dataSourceConnection := fmt.Sprintf("%s:%s@/%s?parseTime=true", dbuser, dbpass, dbname)
+	if scope != "" {
+		dataSourceConnection = fmt.Sprintf("%s:%s@tcp(%s:3306)/%s?parseTime=true", dbuser, dbpass, dbimage, dbname)
+	}
+	db, err := sql.Open("mysql", dataSourceConnection)
+	if err != nil {
+		return SqlRepository{}, err
+	}
+
+	return SqlRepository{
+		db: db,
+	}, nil
+}
+
+// Close the connections to the db, once the repository is not used anymore
+func (sqlDb SqlRepository) Close() error {
+	return sqlDb.db.Close()
+}
+
+// Stats return the stats of the connections to the db, as the open and in use ones
+func (sqlDb SqlRepository) Stats() sql.DBStats {
+	return sqlDb.db.Stats()
+}
+
+// SaveZone will store a Zone on sql table, the area is stored as a spatial polygon
+func (sqlDb SqlRepository) SaveZone(ctx context.Context, zone Zone) (Zone, error) {
+	q, err := sqlDb.db.Prepare("INSERT INTO zones(name, area, created_at) VALUES(?, ST_GeomFromText(?), ?)")
+	if err != nil {
+		return Zone{}, err
+	}
+
+	defer q.Close()
+
+	trackTime := trackElapsed(ctx, entityMetricName, "insert")
+	result, err := q.ExecContext(ctx, zone.Name, polygonWKT(zone.Area), zone.CreatedAt)
+	trackTime(err == nil)
+	if err != nil {
+		return Zone{}, err
+	}
+
+	zone.ID, err = result.LastInsertId()
+	if err != nil {
+		return Zone{}, err
+	}
+
+	return zone, nil
+}
+
+// GetZone will get the Zone who has the received id from table
+func (sqlDb SqlRepository) GetZone(ctx context.Context, id int64) (Zone, error) {
+	trackTime := trackElapsed(ctx, entityMetricName, "select")
+	row := sqlDb.db.QueryRowContext(ctx, "SELECT id, name, ST_AsText(area), created_at FROM zones WHERE id = ?", id)
+
+	zone, err := scanZone(row)
+	trackTime(err == nil)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return Zone{}, ErrZoneNotFound
+		}
+		return Zone{}, err
+	}
+
+	return zone, nil
+}
+
+// GetZones will get all the zones from table ordered by id
+func (sqlDb SqlRepository) GetZones(ctx context.Context) ([]Zone, error) {
+	trackTime := trackElapsed(ctx, entityMetricName, "select_all")
+	rows, err := sqlDb.db.QueryContext(ctx, "SELECT id, name, ST_AsText(area), created_at FROM zones ORDER BY id")
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var zones []Zone
+	for rows.Next() {
+		zone, err := scanZone(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		zones = append(zones, zone)
+	}
+
+	return zones, rows.Err()
+}
+
+// UpdateZone will store the name and area of the received zone
+func (sqlDb SqlRepository) UpdateZone(ctx context.Context, zone Zone) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "update")
+	result, err := sqlDb.db.ExecContext(ctx, "UPDATE zones SET name = ?, area = ST_GeomFromText(?) WHERE id = ?",
+		zone.Name, polygonWKT(zone.Area), zone.ID)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(result)
+}
+
+// DeleteZone will remove the zone with the received id from table, with its drivers registrations
+func (sqlDb SqlRepository) DeleteZone(ctx context.Context, id int64) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "delete")
+	result, err := sqlDb.db.ExecContext(ctx, "DELETE zones, zone_drivers FROM zones "+
+		"LEFT JOIN zone_drivers ON zone_drivers.zone_id = zones.id WHERE zones.id = ?", id)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	return checkAffected(result)
+}
+
+// AddZoneDriver will register the driver with the received user id on the zone, it return ErrDriverNotFound if
+// the user does not exist or it is not a driver
+func (sqlDb SqlRepository) AddZoneDriver(ctx context.Context, zoneID, userID int64) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "select_driver")
+	var drivers int64
+	err := sqlDb.db.QueryRowContext(ctx, "SELECT COUNT(*) FROM users WHERE id = ? AND role = 'driver' "+
+		"AND deleted_at IS NULL", userID).Scan(&drivers)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	if drivers == 0 {
+		return ErrDriverNotFound
+	}
+
+	trackTime = trackElapsed(ctx, entityMetricName, "insert_driver")
+	_, err = sqlDb.db.ExecContext(ctx, "INSERT IGNORE INTO zone_drivers(zone_id, user_id) VALUES(?, ?)",
+		zoneID, userID)
+	trackTime(err == nil)
+
+	return err
+}
+
+// RemoveZoneDriver will unregister the driver with the received user id from the zone
+func (sqlDb SqlRepository) RemoveZoneDriver(ctx context.Context, zoneID, userID int64) error {
+	trackTime := trackElapsed(ctx, entityMetricName, "delete_driver")
+	result, err := sqlDb.db.ExecContext(ctx, "DELETE FROM zone_drivers WHERE zone_id = ? AND user_id = ?",
+		zoneID, userID)
+	trackTime(err == nil)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrZoneDriverNotFound
+	}
+
+	return nil
+}
+
+// GetZoneDrivers will get the user ids of the drivers registered on the zone ordered by id
+func (sqlDb SqlRepository) GetZoneDrivers(ctx context.Context, zoneID int64) ([]int64, error) {
+	return sqlDb.selectIDs(ctx, "select_drivers",
+		"SELECT user_id FROM zone_drivers WHERE zone_id = ? ORDER BY user_id", zoneID)
+}
+
+// GetDriverZones will get the ids of the zones where the driver is registered ordered by id
+func (sqlDb SqlRepository) GetDriverZones(ctx context.Context, userID int64) ([]int64, error) {
+	return sqlDb.selectIDs(ctx, "select_driver_zones",
+		"SELECT zone_id FROM zone_drivers WHERE user_id = ? ORDER BY zone_id", userID)
+}
+
+// selectIDs run a query selecting a single id column
+func (sqlDb SqlRepository) selectIDs(ctx context.Context, action, query string, args ...interface{}) ([]int64, error) {
+	trackTime := trackElapsed(ctx, entityMetricName, action)
+	rows, err := sqlDb.db.QueryContext(ctx, query, args...)
+	trackTime(err == nil)
+	if err != nil {
+		return nil, err
+	}
+
+	defer rows.Close()
+
+	var ids []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+
+		ids = append(ids, id)
+	}
+
+	return ids, rows.Err()
+}
+
+// checkAffected return ErrZoneNotFound if the statement did not change any row
+func checkAffected(result sql.Result) error {
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if affected == 0 {
+		return ErrZoneNotFound
+	}
+
+	return nil
+}
+
+// rowScanner is the scan capability shared by sql.Row and sql.Rows
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+// scanZone read a zone from a row with id, name, area as well-known text and created at
+func scanZone(row rowScanner) (Zone, error) {
+	var zone Zone
+	var area string
+	if err := row.Scan(&zone.ID, &zone.Name, &area, &zone.CreatedAt); err != nil {
+		return Zone{}, err
+	}
+
+	vertices, err := parsePolygonWKT(area)
+	if err != nil {
+		return Zone{}, err
+	}
+	zone.Area = vertices
+
+	return zone, nil
+}
+
+// polygonWKT return the well-known text representation of the polygon with the received vertices, where x is the
+// longitude and y the latitude. The polygon is closed repeating the first vertex
+func polygonWKT(vertices []travel.Point) string {
+	coordinates := make([]string, 0, len(vertices)+1)
+	for _, vertex := range vertices {
+		coordinates = append(coordinates, strconv.FormatFloat(vertex.Lng, 'g', -1, 64)+" "+
+			strconv.FormatFloat(vertex.Lat, 'g', -1, 64))
+	}
+
+	return "POLYGON((" + strings.Join(append(coordinates, coordinates[0]), ", ") + "))"
+}
+
+// parsePolygonWKT return the vertices (without the closing one) of a polygon with a single ring in well-known text
+func parsePolygonWKT(wkt string) ([]travel.Point, error) {
+	ring := strings.TrimSuffix(strings.TrimPrefix(wkt, "POLYGON(("), "))")
+	if ring == wkt || strings.Contains(ring, "(") {
+		return nil, fmt.Errorf("invalid polygon %q", wkt)
+	}
+
+	var vertices []travel.Point
+	for _, coordinates := range strings.Split(ring, ",") {
+		xy := strings.Fields(coordinates)
+		if len(xy) != 2 {
+			return nil, fmt.Errorf("invalid polygon %q", wkt)
+		}
+
+		lng, errLng := strconv.ParseFloat(xy[0], 64)
+		lat, errLat := strconv.ParseFloat(xy[1], 64)
+		if errLng != nil || errLat != nil {
+			return nil, fmt.Errorf("invalid polygon %q", wkt)
+		}
+
+		vertices = append(vertices, travel.Point{Lat: lat, Lng: lng})
+	}
+
+	if len(vertices) > 1 && vertices[0] == vertices[len(vertices)-1] {
+		vertices = vertices[:len(vertices)-1]
+	}
+
+	return vertices, nil
+}
+
+func trackElapsed(ctx context.Context, entity, action string) func(success bool) {
+	start := time.Now()
+	return func(success bool) {
+		metrics.Timing(ctx, timeMetricName, time.Since(start),
+			[]string{
+				"result", strconv.FormatBool(success),
+				"action", action,
+				"entity", entity})
+	}
+}
@@ -0,0 +1,206 @@
+package zone
+
+import (
+	"context"
+	"errors"
+	"github.com/nicocarolo/space-drivers/internal/platform/code_error"
+	"github.com/nicocarolo/space-drivers/internal/platform/geo"
+	"github.com/nicocarolo/space-drivers/internal/platform/log"
+	"github.com/nicocarolo/space-drivers/internal/travel"
+	"strings"
+	"time"
+)
+
+const (
+	maxZoneNameLength = 50
+	minZoneVertices   = 3
+	maxZoneVertices   = 100
+)
+
+var (
+	ErrInvalidZoneName = code_error.Error{Code: "invalid_zone", Detail: "the zone name should have between 1 and 50 characters"}
+	ErrInvalidZoneArea = code_error.Error{Code: "invalid_zone", Detail: "the zone area should be a polygon of 3 to 100 valid vertices"}
+	ErrNotFoundZone    = code_error.Error{Code: "not_found_zone", Detail: "not founded the zone to get"}
+	ErrStorageSave     = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to save zone"}
+	ErrStorageGet      = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to get zone"}
+	ErrStorageUpdate   = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to update zone"}
+	ErrStorageDelete   = code_error.Error{Code: "storage_failure", Detail: "an error ocurred trying to delete zone"}
+)
+
+// Zone is an operating zone, the area where travels can start and end. The area is a polygon given by its
+// vertices (it is closed from the last vertex to the first one)
+type Zone struct {
+	ID        int64          `json:"id"`
+	Name      string         `json:"name" binding:"required"`
+	Area      []travel.Point `json:"area" binding:"required"`
+	CreatedAt time.Time      `json:"created_at"`
+}
+
+// Contains return if the point is inside the zone area (ray casting algorithm), points on the border may be
+// considered outside
+func (z Zone) Contains(point travel.Point) bool {
+	polygon := make([]geo.Coordinate, 0, len(z.Area))
+	for _, vertex := range z.Area {
+		polygon = append(polygon, vertex.Coordinate())
+	}
+
+	return geo.PolygonContains(polygon, point.Coordinate())
+}
+
+type ZoneStorage struct {
+	repository repository
+}
+
+// NewZoneStorage will create and return a ZoneStorage with the received repository
+func NewZoneStorage(repository repository) ZoneStorage {
+	return ZoneStorage{
+		repository: repository,
+	}
+}
+
+// Save will store a Zone on repository and return it
+func (zoneStorage ZoneStorage) Save(ctx context.Context, zone Zone) (Zone, error) {
+	zone, err := normalizeZone(ctx, zone)
+	if err != nil {
+		return Zone{}, err
+	}
+
+	zone.CreatedAt = time.Now().UTC().Truncate(time.Second)
+
+	zone, err = zoneStorage.repository.SaveZone(ctx, zone)
+	if err != nil {
+		log.Error(ctx, "there was an error saving zone", log.Err(err))
+		return Zone{}, ErrStorageSave
+	}
+
+	return zone, nil
+}
+
+// Get and return the Zone from repository with the received id
+func (zoneStorage ZoneStorage) Get(ctx context.Context, id int64) (Zone, error) {
+	zone, err := zoneStorage.repository.GetZone(ctx, id)
+	if err != nil {
+		log.Error(ctx, "there was an error getting zone", log.Int64("zone_id", id), log.Err(err))
+		if errors.Is(err, ErrZoneNotFound) {
+			return Zone{}, ErrNotFoundZone
+		}
+		return Zone{}, ErrStorageGet
+	}
+
+	return zone, nil
+}
+
+// List return all the zones on repository ordered by id
+func (zoneStorage ZoneStorage) List(ctx context.Context) ([]Zone, error) {
+	zones, err := zoneStorage.repository.GetZones(ctx)
+	if err != nil {
+		log.Error(ctx, "there was an error getting zones", log.Err(err))
+		return nil, ErrStorageGet
+	}
+
+	return zones, nil
+}
+
+// Update will replace the name and area of the zone with the received id
+func (zoneStorage ZoneStorage) Update(ctx context.Context, zone Zone) (Zone, error) {
+	zone, err := normalizeZone(ctx, zone)
+	if err != nil {
+		return Zone{}, err
+	}
+
+	current, err := zoneStorage.Get(ctx, zone.ID)
+	if err != nil {
+		return Zone{}, err
+	}
+
+	current.Name = zone.Name
+	current.Area = zone.Area
+
+	if err := zoneStorage.repository.UpdateZone(ctx, current); err != nil {
+		log.Error(ctx, "there was an error updating zone", log.Int64("zone_id", zone.ID), log.Err(err))
+		if errors.Is(err, ErrZoneNotFound) {
+			return Zone{}, ErrNotFoundZone
+		}
+		return Zone{}, ErrStorageUpdate
+	}
+
+	return current, nil
+}
+
+// Delete will remove the zone with the received id from repository
+func (zoneStorage ZoneStorage) Delete(ctx context.Context, id int64) error {
+	if err := zoneStorage.repository.DeleteZone(ctx, id); err != nil {
+		log.Error(ctx, "there was an error deleting zone", log.Int64("zone_id", id), log.Err(err))
+		if errors.Is(err, ErrZoneNotFound) {
+			return ErrNotFoundZone
+		}
+		return ErrStorageDelete
+	}
+
+	return nil
+}
+
+// Covers return if the point is inside any of the zones, when there are no zones every point is covered so
+// travels are not restricted until the first zone is created
+func (zoneStorage ZoneStorage) Covers(ctx context.Context, point travel.Point) (bool, error) {
+	zones, err := zoneStorage.List(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	if len(zones) == 0 {
+		return true, nil
+	}
+
+	for _, zone := range zones {
+		if zone.Contains(point) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Locate return the id of the zone containing the point (the oldest one if several contain it), or 0 if the point
+// is outside every zone
+func (zoneStorage ZoneStorage) Locate(ctx context.Context, point travel.Point) (int64, error) {
+	zones, err := zoneStorage.List(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, zone := range zones {
+		if zone.Contains(point) {
+			return zone.ID, nil
+		}
+	}
+
+	return 0, nil
+}
+
+// normalizeZone validate the zone name and area, removing the closing vertex of the area if it was received
+func normalizeZone(ctx context.Context, zone Zone) (Zone, error) {
+	zone.Name = strings.TrimSpace(zone.Name)
+	if zone.Name == "" || len(zone.Name) > maxZoneNameLength {
+		log.Info(ctx, "invalid check on zone: invalid name", log.String("zone_name", zone.Name))
+		return Zone{}, ErrInvalidZoneName
+	}
+
+	area := zone.Area
+	if len(area) > 1 && area[0].Coordinate() == area[len(area)-1].Coordinate() {
+		area = area[:len(area)-1]
+	}
+
+	valid := len(area) >= minZoneVertices && len(area) <= maxZoneVertices
+	for _, vertex := range area {
+		valid = valid && vertex.Valid()
+	}
+	if !valid {
+		log.Info(ctx, "invalid check on zone: invalid area", log.Int64("zone_vertices", int64(len(area))))
+		return Zone{}, ErrInvalidZoneArea
+	}
+
+	zone.Area = area
+
+	return zone, nil
+}
@@ -0,0 +1,469 @@
+package zone
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/nicocarolo/space-drivers/internal/travel"
+	"github.com/stretchr/testify/assert"
+	"sort"
+	"testing"
+)
+
+// mockDb a 'db' to use on ZoneStorage test with the capabilities to mock errors on save/get action
+type mockDb struct {
+	idCount int64
+	zones   map[int64]Zone
+	// drivers are the registered user ids by zone id, users from 1 to 3 are the only drivers
+	drivers map[int64][]int64
+
+	saveError error
+	getError  error
+}
+
+func newMockDB() *mockDb {
+	return &mockDb{
+		idCount: 1,
+		zones:   make(map[int64]Zone),
+		drivers: make(map[int64][]int64),
+	}
+}
+
+func newMockDBFromMap(zones map[int64]Zone) *mockDb {
+	return &mockDb{
+		idCount: int64(len(zones) + 1),
+		zones:   zones,
+		drivers: make(map[int64][]int64),
+	}
+}
+
+func (db *mockDb) onCreate(err error) *mockDb {
+	db.saveError = err
+
+	return db
+}
+
+func (db *mockDb) onGet(err error) *mockDb {
+	db.getError = err
+
+	return db
+}
+
+func (db *mockDb) SaveZone(ctx context.Context, zone Zone) (Zone, error) {
+	if db.saveError != nil {
+		return Zone{}, db.saveError
+	}
+
+	zone.ID = db.idCount
+	db.zones[zone.ID] = zone
+
+	db.idCount++
+
+	return zone, nil
+}
+
+func (db mockDb) GetZone(ctx context.Context, id int64) (Zone, error) {
+	if db.getError != nil {
+		return Zone{}, db.getError
+	}
+
+	zone, exist := db.zones[id]
+	if !exist {
+		return Zone{}, ErrZoneNotFound
+	}
+
+	return zone, nil
+}
+
+func (db mockDb) GetZones(ctx context.Context) ([]Zone, error) {
+	if db.getError != nil {
+		return nil, db.getError
+	}
+
+	var zones []Zone
+	for _, zone := range db.zones {
+		zones = append(zones, zone)
+	}
+
+	sort.Slice(zones, func(i, j int) bool { return zones[i].ID < zones[j].ID })
+
+	return zones, nil
+}
+
+func (db *mockDb) UpdateZone(ctx context.Context, zone Zone) error {
+	if _, exist := db.zones[zone.ID]; !exist {
+		return ErrZoneNotFound
+	}
+
+	db.zones[zone.ID] = zone
+
+	return nil
+}
+
+func (db *mockDb) DeleteZone(ctx context.Context, id int64) error {
+	if _, exist := db.zones[id]; !exist {
+		return ErrZoneNotFound
+	}
+
+	delete(db.zones, id)
+
+	return nil
+}
+
+func (db *mockDb) AddZoneDriver(ctx context.Context, zoneID, userID int64) error {
+	if userID < 1 || userID > 3 {
+		return ErrDriverNotFound
+	}
+
+	for _, id := range db.drivers[zoneID] {
+		if id == userID {
+			return nil
+		}
+	}
+
+	db.drivers[zoneID] = append(db.drivers[zoneID], userID)
+
+	return nil
+}
+
+func (db *mockDb) RemoveZoneDriver(ctx context.Context, zoneID, userID int64) error {
+	for i, id := range db.drivers[zoneID] {
+		if id == userID {
+			db.drivers[zoneID] = append(db.drivers[zoneID][:i], db.drivers[zoneID][i+1:]...)
+			return nil
+		}
+	}
+
+	return ErrZoneDriverNotFound
+}
+
+func (db mockDb) GetZoneDrivers(ctx context.Context, zoneID int64) ([]int64, error) {
+	if db.getError != nil {
+		return nil, db.getError
+	}
+
+	return db.drivers[zoneID], nil
+}
+
+func (db mockDb) GetDriverZones(ctx context.Context, userID int64) ([]int64, error) {
+	if db.getError != nil {
+		return nil, db.getError
+	}
+
+	var zoneIDs []int64
+	for zoneID, userIDs := range db.drivers {
+		for _, id := range userIDs {
+			if id == userID {
+				zoneIDs = append(zoneIDs, zoneID)
+			}
+		}
+	}
+
+	return zoneIDs, nil
+}
+
+// square is a zone of 1 degree side with its south west corner on the received point
+func square(id int64, lat, lng float64) Zone {
+	return Zone{
+		ID:   id,
+		Name: fmt.Sprintf("zone %d", id),
+		Area: []travel.Point{
+			{Lat: lat, Lng: lng},
+			{Lat: lat + 1, Lng: lng},
+			{Lat: lat + 1, Lng: lng + 1},
+			{Lat: lat, Lng: lng + 1},
+		},
+	}
+}
+
+func Test_zoneContains(t *testing.T) {
+	triangle := Zone{Area: []travel.Point{{Lat: 0, Lng: 0}, {Lat: 10, Lng: 5}, {Lat: 0, Lng: 10}}}
+
+	tests := map[string]struct {
+		zone  Zone
+		point travel.Point
+		want  bool
+	}{
+		"point inside square":    {zone: square(1, -35, -59), point: travel.Point{Lat: -34.6, Lng: -58.4}, want: true},
+		"point outside square":   {zone: square(1, -35, -59), point: travel.Point{Lat: -34.9, Lng: -56.1}, want: false},
+		"point inside triangle":  {zone: triangle, point: travel.Point{Lat: 2, Lng: 5}, want: true},
+		"point outside triangle": {zone: triangle, point: travel.Point{Lat: 8, Lng: 1}, want: false},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, tc.zone.Contains(tc.point))
+		})
+	}
+}
+
+func Test_saveZone(t *testing.T) {
+	tests := map[string]struct {
+		db       repository
+		zone     Zone
+		want     []travel.Point
+		expected error
+	}{
+		"successful save zone": {
+			db:   newMockDB(),
+			zone: square(0, -35, -59),
+			want: square(0, -35, -59).Area,
+		},
+
+		"successful save zone removing closing vertex": {
+			db: newMockDB(),
+			zone: Zone{
+				Name: "closed",
+				Area: append(square(0, -35, -59).Area, travel.Point{Lat: -35, Lng: -59}),
+			},
+			want: square(0, -35, -59).Area,
+		},
+
+		"error on save zone: empty name": {
+			db:       newMockDB(),
+			zone:     Zone{Name: " ", Area: square(0, -35, -59).Area},
+			expected: ErrInvalidZoneName,
+		},
+
+		"error on save zone: not enough vertices": {
+			db:       newMockDB(),
+			zone:     Zone{Name: "line", Area: []travel.Point{{Lat: 1, Lng: 1}, {Lat: 2, Lng: 2}}},
+			expected: ErrInvalidZoneArea,
+		},
+
+		"error on save zone: invalid vertex": {
+			db: newMockDB(),
+			zone: Zone{
+				Name: "invalid",
+				Area: []travel.Point{{Lat: 1, Lng: 1}, {Lat: 95, Lng: 2}, {Lat: 2, Lng: 3}},
+			},
+			expected: ErrInvalidZoneArea,
+		},
+
+		"db failure on save zone": {
+			db:       newMockDB().onCreate(errors.New("mocked save error")),
+			zone:     square(0, -35, -59),
+			expected: ErrStorageSave,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			zoneStorage := NewZoneStorage(tc.db)
+			result, err := zoneStorage.Save(context.Background(), tc.zone)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Greater(t, result.ID, int64(0))
+				assert.Equal(t, tc.want, result.Area)
+				assert.False(t, result.CreatedAt.IsZero())
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_updateAndDeleteZone(t *testing.T) {
+	db := newMockDBFromMap(map[int64]Zone{1: square(1, -35, -59)})
+	zoneStorage := NewZoneStorage(db)
+
+	moved := square(1, -34, -58)
+	moved.Name = "moved"
+	result, err := zoneStorage.Update(context.Background(), moved)
+
+	assert.Nil(t, err)
+	assert.Equal(t, moved, result)
+	assert.Equal(t, moved, db.zones[1])
+
+	_, err = zoneStorage.Update(context.Background(), square(2, -34, -58))
+	assert.Equal(t, ErrNotFoundZone.Error(), err.Error())
+
+	assert.Nil(t, zoneStorage.Delete(context.Background(), 1))
+	assert.Empty(t, db.zones)
+
+	err = zoneStorage.Delete(context.Background(), 1)
+	assert.Equal(t, ErrNotFoundZone.Error(), err.Error())
+}
+
+func Test_zonesCover(t *testing.T) {
+	tests := map[string]struct {
+		db       repository
+		point    travel.Point
+		want     bool
+		expected error
+	}{
+		"point inside a zone": {
+			db:    newMockDBFromMap(map[int64]Zone{1: square(1, -35, -59), 2: square(2, -35, -57)}),
+			point: travel.Point{Lat: -34.5, Lng: -56.5},
+			want:  true,
+		},
+
+		"point outside zones": {
+			db:    newMockDBFromMap(map[int64]Zone{1: square(1, -35, -59), 2: square(2, -35, -57)}),
+			point: travel.Point{Lat: -34.5, Lng: -57.5},
+			want:  false,
+		},
+
+		"without zones every point is covered": {
+			db:    newMockDB(),
+			point: travel.Point{Lat: 40.4, Lng: -3.7},
+			want:  true,
+		},
+
+		"db failure on cover": {
+			db:       newMockDB().onGet(errors.New("mocked get error")),
+			point:    travel.Point{Lat: -34.5, Lng: -56.5},
+			expected: ErrStorageGet,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			zoneStorage := NewZoneStorage(tc.db)
+			result, err := zoneStorage.Covers(context.Background(), tc.point)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}
+
+func Test_zoneLocate(t *testing.T) {
+	db := newMockDBFromMap(map[int64]Zone{1: square(1, -35, -59), 2: square(2, -35, -57), 3: square(3, -34.5, -57.5)})
+
+	zoneStorage := NewZoneStorage(db)
+
+	zoneID, err := zoneStorage.Locate(context.Background(), travel.Point{Lat: -34.5, Lng: -58.5})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(1), zoneID)
+
+	// the oldest zone is used when several contain the point
+	zoneID, err = zoneStorage.Locate(context.Background(), travel.Point{Lat: -34.2, Lng: -56.8})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(2), zoneID)
+
+	zoneID, err = zoneStorage.Locate(context.Background(), travel.Point{Lat: 40.4, Lng: -3.7})
+	assert.Nil(t, err)
+	assert.Equal(t, int64(0), zoneID)
+
+	_, err = NewZoneStorage(newMockDB().onGet(errors.New("mocked get error"))).
+		Locate(context.Background(), travel.Point{Lat: -34.5, Lng: -58.5})
+	assert.Equal(t, ErrStorageGet.Error(), err.Error())
+}
+
+func Test_polygonWKT(t *testing.T) {
+	area := square(1, -35, -59).Area
+	wkt := polygonWKT(area)
+
+	assert.Equal(t, "POLYGON((-59 -35, -59 -34, -58 -34, -58 -35, -59 -35))", wkt)
+
+	vertices, err := parsePolygonWKT(wkt)
+	assert.Nil(t, err)
+	assert.Equal(t, area, vertices)
+
+	_, err = parsePolygonWKT("POINT(1 2)")
+	assert.NotNil(t, err)
+}
+
+func Test_zoneDrivers(t *testing.T) {
+	db := newMockDBFromMap(map[int64]Zone{1: square(1, -35, -59)})
+	zoneStorage := NewZoneStorage(db)
+	ctx := context.Background()
+
+	assert.Nil(t, zoneStorage.AddDriver(ctx, 1, 2))
+	// registering twice has no effect
+	assert.Nil(t, zoneStorage.AddDriver(ctx, 1, 2))
+	assert.Nil(t, zoneStorage.AddDriver(ctx, 1, 3))
+
+	drivers, err := zoneStorage.Drivers(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, ZoneDrivers{ZoneID: 1, UserIDs: []int64{2, 3}}, drivers)
+
+	err = zoneStorage.AddDriver(ctx, 1, 10)
+	assert.Equal(t, ErrInvalidZoneDriver.Error(), err.Error())
+
+	err = zoneStorage.AddDriver(ctx, 2, 1)
+	assert.Equal(t, ErrNotFoundZone.Error(), err.Error())
+
+	_, err = zoneStorage.Drivers(ctx, 2)
+	assert.Equal(t, ErrNotFoundZone.Error(), err.Error())
+
+	assert.Nil(t, zoneStorage.RemoveDriver(ctx, 1, 3))
+
+	err = zoneStorage.RemoveDriver(ctx, 1, 3)
+	assert.Equal(t, ErrNotFoundZoneDriver.Error(), err.Error())
+
+	drivers, err = zoneStorage.Drivers(ctx, 1)
+	assert.Nil(t, err)
+	assert.Equal(t, []int64{2}, drivers.UserIDs)
+}
+
+func Test_zoneDriverEligible(t *testing.T) {
+	db := newMockDBFromMap(map[int64]Zone{1: square(1, -35, -59), 2: square(2, -35, -57)})
+	db.drivers[1] = []int64{1}
+	db.drivers[2] = []int64{2}
+
+	tests := map[string]struct {
+		db       *mockDb
+		point    travel.Point
+		userID   int64
+		want     bool
+		expected error
+	}{
+		"driver registered on the zone": {
+			db:     db,
+			point:  travel.Point{Lat: -34.5, Lng: -58.5},
+			userID: 1,
+			want:   true,
+		},
+
+		"driver registered on another zone": {
+			db:     db,
+			point:  travel.Point{Lat: -34.5, Lng: -58.5},
+			userID: 2,
+			want:   false,
+		},
+
+		"driver without zones": {
+			db:     db,
+			point:  travel.Point{Lat: -34.5, Lng: -56.5},
+			userID: 3,
+			want:   false,
+		},
+
+		"point outside every zone": {
+			db:     db,
+			point:  travel.Point{Lat: 40.4, Lng: -3.7},
+			userID: 3,
+			want:   true,
+		},
+
+		"db failure on eligible": {
+			db:       newMockDB().onGet(errors.New("mocked get error")),
+			point:    travel.Point{Lat: -34.5, Lng: -58.5},
+			userID:   1,
+			expected: ErrStorageGet,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			result, err := NewZoneStorage(tc.db).Eligible(context.Background(), tc.point, tc.userID)
+
+			if tc.expected == nil {
+				assert.Nil(t, err)
+				assert.Equal(t, tc.want, result)
+			} else {
+				assert.NotNil(t, err)
+				assert.Equal(t, tc.expected.Error(), err.Error())
+			}
+		})
+	}
+}